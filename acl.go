@@ -0,0 +1,97 @@
+// +build !js
+
+package onet
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+)
+
+// SetACL replaces the ACL of the server, which refuses the connections of
+// other servers and the requests of clients to the websocket. Open
+// connections that the new ACL refuses are closed. A nil ACL allows
+// everybody.
+func (c *Server) SetACL(acl *network.ACL) error {
+	if err := c.Router.SetACL(acl); err != nil {
+		return err
+	}
+	c.websocket.setACL(acl)
+	c.RecordEvent(EventACLChanged, "new ACL")
+	c.Audit(AuditConfigChange, auditLocal, "new ACL")
+	return nil
+}
+
+// SetACLFile reads the ACL of the server from the toml file, see
+// network.ReadACL. The file is read again by ReloadACL.
+func (c *Server) SetACLFile(file string) error {
+	c.aclLock.Lock()
+	c.aclFile = file
+	c.aclLock.Unlock()
+	return c.ReloadACL()
+}
+
+// ReloadACL reads the ACL again from the file given to SetACLFile. The ACL
+// is kept if the file cannot be read.
+func (c *Server) ReloadACL() error {
+	c.aclLock.Lock()
+	file := c.aclFile
+	c.aclLock.Unlock()
+	if file == "" {
+		return nil
+	}
+	acl, err := network.ReadACL(file)
+	if err != nil {
+		return err
+	}
+	return c.SetACL(acl)
+}
+
+func (w *WebSocket) setACL(acl *network.ACL) {
+	w.Lock()
+	defer w.Unlock()
+	w.acl = acl
+}
+
+func (w *WebSocket) getACL() *network.ACL {
+	w.Lock()
+	defer w.Unlock()
+	return w.acl
+}
+
+// serveACL is the admin API of the ACL. GET returns the ACL as JSON, PUT
+// replaces it with the JSON ACL of the body and POST reloads it from the file
+// given to SetACLFile.
+func (c *Server) serveACL(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		acl := &network.ACL{}
+		if err := json.NewDecoder(r.Body).Decode(acl); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := c.SetACL(acl); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case http.MethodPost:
+		if err := c.ReloadACL(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	acl := c.ACL()
+	if acl == nil {
+		acl = &network.ACL{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(acl); err != nil {
+		log.Error("Couldn't encode ACL:", err)
+	}
+}
@@ -0,0 +1,71 @@
+package onet
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/dedis/onet/network"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_serveACL(t *testing.T) {
+	l := NewLocalTest(tSuite)
+	defer l.CloseAll()
+	s := l.GenServers(1)[0]
+	s.SetAdminToken(adminTestToken)
+
+	do := func(method, remote, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/admin/acl", strings.NewReader(body))
+		req.RemoteAddr = remote
+		req.Header.Set("Authorization", "Bearer "+adminTestToken)
+		rec := httptest.NewRecorder()
+		headerHandler{s.websocket}.ServeHTTP(rec, req)
+		return rec
+	}
+
+	require.Equal(t, http.StatusForbidden,
+		adminRequest(s, "GET", "/admin/acl", "10.0.0.1:1234", "", "").Code)
+	rec := do("GET", "127.0.0.1:1234", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "{}\n", rec.Body.String())
+
+	require.Equal(t, http.StatusBadRequest, do("PUT", "127.0.0.1:1234", `{"DenyIPs":["x"]}`).Code)
+	rec = do("PUT", "127.0.0.1:1234", `{"DenyIPs":["10.0.0.0/8"]}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), "10.0.0.0/8")
+	require.False(t, s.ACL().AllowsAddress("10.1.1.1:2000"))
+
+	// the websocket refuses the clients denied by the ACL
+	rec = do("GET", "10.0.0.1:1234", "")
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	require.Equal(t, "forbidden\n", rec.Body.String())
+
+	require.Nil(t, s.SetACL(nil))
+	require.Equal(t, http.StatusMethodNotAllowed, do("DELETE", "[::1]:1234", "").Code)
+	events := s.Events()
+	require.Equal(t, EventACLChanged, events[len(events)-1].Kind)
+}
+
+func TestServer_SetACLFile(t *testing.T) {
+	l := NewLocalTest(tSuite)
+	defer l.CloseAll()
+	s := l.GenServers(1)[0]
+	require.Nil(t, s.ReloadACL())
+
+	file := path.Join(l.path, "acl.toml")
+	require.NotNil(t, s.SetACLFile(file))
+	require.Nil(t, ioutil.WriteFile(file, []byte(`DenyIPs = ["192.168.0.0/16"]`), 0600))
+	require.Nil(t, s.ReloadACL())
+	require.False(t, s.ACL().AllowsAddress("192.168.1.1:2000"))
+
+	// a broken file keeps the ACL
+	require.Nil(t, ioutil.WriteFile(file, []byte(`DenyIPs = 3`), 0600))
+	require.NotNil(t, s.ReloadACL())
+	require.False(t, s.ACL().AllowsAddress("192.168.1.1:2000"))
+	require.Nil(t, s.SetACL(&network.ACL{}))
+	require.True(t, s.ACL().AllowsAddress("192.168.1.1:2000"))
+}
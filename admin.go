@@ -0,0 +1,369 @@
+// +build !js
+
+package onet
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/dedis/onet/log"
+	"gopkg.in/satori/go.uuid.v1"
+)
+
+// The admin API lets the operators manage a running server through the
+// websocket, under /admin/:
+//
+//   GET  /admin/debug         returns the debug level
+//   PUT  /admin/debug         sets the debug level, e.g. {"Level":3}
+//   GET  /admin/protocols     lists the protocol instances
+//   DELETE /admin/protocols?id=<token> kills a protocol instance
+//   GET  /admin/goroutines    dumps the stacks of all goroutines
+//   GET  /admin/backup        returns a copy of the database
+//   POST /admin/tls           reads the certificate of the websocket again
+//   GET  /admin/connections   lists the connections to other servers
+//   GET  /admin/messages      returns the traced messages, see serveAdminMessages
+//   PUT  /admin/messages      starts tracing the messages, e.g. {"Size":1000}
+//   DELETE /admin/messages    stops tracing the messages
+//   GET  /admin/audit         exports the audit log, see serveAdminAudit
+//   GET  /admin/logs          dumps the latest log entries, see SetLogRing
+//   GET, PUT, POST /admin/acl see serveACL
+//   GET  /admin/features      lists the feature flags that have been set
+//   PUT  /admin/features      sets a feature flag, e.g. {"Name":"fastPath","Enabled":true}
+//
+// The introspection endpoints /metrics, /status, /events and /trees are
+// protected the same way.
+//
+// The API is only enabled once an admin token is set. It then answers every
+// request that holds the token in the header "Authorization: Bearer
+// <token>", and no other, wherever it comes from.
+
+// SetAdminToken sets the secret the clients of the admin API must give. An
+// empty token disables the API.
+func (c *Server) SetAdminToken(token string) {
+	c.adminLock.Lock()
+	defer c.adminLock.Unlock()
+	c.adminToken = token
+	c.Audit(AuditConfigChange, auditLocal, "new admin token")
+}
+
+// adminAllowed returns whether the request may use the admin API, and
+// answers it with an error if not.
+func (c *Server) adminAllowed(w http.ResponseWriter, r *http.Request) bool {
+	c.adminLock.Lock()
+	token := c.adminToken
+	c.adminLock.Unlock()
+	ok := false
+	if token != "" {
+		given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		ok = subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+	}
+	if !ok {
+		c.Audit(AuditAuthFailure, r.RemoteAddr, "admin API: ", r.URL.Path)
+		http.Error(w, "forbidden", http.StatusForbidden)
+	}
+	return ok
+}
+
+// registerAdmin adds the handlers of the admin API to the websocket.
+func (c *Server) registerAdmin() {
+	handlers := map[string]http.HandlerFunc{
+		"acl":         c.serveACL,
+		"debug":       c.serveAdminDebug,
+		"protocols":   c.serveAdminProtocols,
+		"goroutines":  c.serveAdminGoroutines,
+		"backup":      c.serveAdminBackup,
+		"tls":         c.serveAdminTLS,
+		"connections": c.serveAdminConnections,
+		"messages":    c.serveAdminMessages,
+		"audit":       c.serveAdminAudit,
+		"logs":        c.serveAdminLogs,
+		"features":    c.serveAdminFeatures,
+	}
+	for name, h := range handlers {
+		c.handleAdmin("/admin/"+name, h)
+	}
+	c.handleAdmin("/metrics", c.serveOpenMetrics)
+	c.handleAdmin("/status", c.serveStatus)
+	c.handleAdmin("/events", c.serveEvents)
+	c.handleAdmin("/trees", c.serveTrees)
+}
+
+// handleAdmin serves path with h for the clients allowed to use the admin
+// API.
+func (c *Server) handleAdmin(path string, h http.HandlerFunc) {
+	c.websocket.mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		if c.adminAllowed(w, r) {
+			h(w, r)
+		}
+	})
+}
+
+func writeAdminJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Error("Couldn't encode admin answer:", err)
+	}
+}
+
+// AdminDebug is the debug level in the admin API.
+type AdminDebug struct {
+	Level int
+}
+
+func (c *Server) serveAdminDebug(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var d AdminDebug
+		if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Lvl1("Admin sets debug level to", d.Level)
+		c.Audit(AuditConfigChange, r.RemoteAddr, "debug level ", d.Level)
+		log.SetDebugVisible(d.Level)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeAdminJSON(w, AdminDebug{log.DebugVisible()})
+}
+
+// ProtocolInstanceInfo describes a running protocol instance.
+type ProtocolInstanceInfo struct {
+	ID       TokenID
+	Protocol string
+	// Service is empty for the protocols started by onet itself.
+	Service string
+	Tree    TreeID
+	Roster  RosterID
+	IsRoot  bool
+}
+
+// Instances returns the protocol instances running on this server, sorted
+// by protocol name.
+func (o *Overlay) Instances() []ProtocolInstanceInfo {
+	o.instancesLock.Lock()
+	defer o.instancesLock.Unlock()
+	list := make([]ProtocolInstanceInfo, 0, len(o.instances))
+	for id, tni := range o.instances {
+		tok := tni.Token()
+		list = append(list, ProtocolInstanceInfo{
+			ID:       id,
+			Protocol: tni.ProtocolName(),
+			Service:  o.server.serviceManager.serviceName(tok.ServiceID),
+			Tree:     tok.TreeID,
+			Roster:   tok.RosterID,
+			IsRoot:   tni.IsRoot(),
+		})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Protocol != list[j].Protocol {
+			return list[i].Protocol < list[j].Protocol
+		}
+		return list[i].ID.String() < list[j].ID.String()
+	})
+	return list
+}
+
+// KillInstance shuts the protocol instance down and releases it, as if it
+// were done.
+func (o *Overlay) KillInstance(id TokenID) error {
+	o.instancesLock.Lock()
+	defer o.instancesLock.Unlock()
+	tni, ok := o.instances[id]
+	if !ok {
+		return errors.New("no protocol instance " + id.String())
+	}
+	log.Lvl1(o.server.Address(), "kills protocol instance", id, tni.ProtocolName())
+	o.nodeDelete(tni.Token())
+	return nil
+}
+
+func (c *Server) serveAdminProtocols(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeAdminJSON(w, c.overlay.Instances())
+	case http.MethodDelete:
+		id, err := uuid.FromString(r.URL.Query().Get("id"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := c.overlay.KillInstance(TokenID(id)); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// SetLogRing makes the admin API dump the entries kept by r, which should
+// be registered with log.RegisterLogger.
+func (c *Server) SetLogRing(r *log.RingLogger) {
+	c.adminLock.Lock()
+	defer c.adminLock.Unlock()
+	c.logRing = r
+}
+
+func (c *Server) serveAdminLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	c.adminLock.Lock()
+	ring := c.logRing
+	c.adminLock.Unlock()
+	if ring == nil {
+		http.Error(w, "no log ring", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	if err := ring.Dump(w); err != nil {
+		log.Error("Couldn't dump the log ring:", err)
+	}
+}
+
+func (c *Server) serveAdminGoroutines(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	if err := pprof.Lookup("goroutine").WriteTo(w, 2); err != nil {
+		log.Error("Couldn't dump goroutines:", err)
+	}
+}
+
+// BackupDB writes a consistent copy of the database to w, while the services
+// keep on using it. It returns the number of bytes written. The copy is
+// first written to a temporary file next to the database, so that a slow w
+// doesn't hold the database.
+func (c *Server) BackupDB(w io.Writer) (int64, error) {
+	f, err := c.serviceManager.backupDB()
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	return io.Copy(w, f)
+}
+
+// backupDB returns a temporary file with a copy of the database, rewound to
+// its start. The caller must close and remove it.
+func (s *serviceManager) backupDB() (*os.File, error) {
+	s.dbMut.RLock()
+	defer s.dbMut.RUnlock()
+	if s.db == nil {
+		return nil, errors.New("database is closed")
+	}
+	f, err := ioutil.TempFile(filepath.Dir(s.db.Path()), "backup")
+	if err != nil {
+		return nil, err
+	}
+	err = s.db.View(func(tx *bolt.Tx) error {
+		_, err := tx.WriteTo(f)
+		return err
+	})
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return f, nil
+}
+
+func (c *Server) serveAdminBackup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+
+		time.Now().Format("20060102-150405")+`.db"`)
+	n, err := c.BackupDB(w)
+	if err != nil {
+		if n == 0 {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		log.Error("Couldn't backup database:", err)
+		return
+	}
+	log.Lvl2("Admin backed up", n, "bytes of the database")
+}
+
+// ReloadWebSocketTLS reads the certificate files of the websocket again,
+// even if they didn't change. The former certificate is kept if the files
+// can't be read.
+func (c *Server) ReloadWebSocketTLS() error {
+	c.websocket.Lock()
+	cr := c.websocket.certs
+	c.websocket.Unlock()
+	if cr == nil {
+		return errors.New("the websocket has no certificate files")
+	}
+	return cr.forceReload()
+}
+
+func (c *Server) serveAdminTLS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := c.ReloadWebSocketTLS(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// AdminConnection is the state of the connections to a server in the admin
+// API.
+type AdminConnection struct {
+	Address      string
+	Public       string
+	Connections  int
+	Established  time.Time
+	LastActivity time.Time
+	RTT          time.Duration
+	Tx, Rx       uint64
+	MsgsIn       uint64
+	MsgsOut      uint64
+	Reconnects   int
+}
+
+func (c *Server) serveAdminConnections(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	list := []AdminConnection{}
+	for _, p := range c.Peers() {
+		list = append(list, AdminConnection{
+			Address:      p.ServerIdentity.Address.String(),
+			Public:       p.ServerIdentity.Public.String(),
+			Connections:  p.Connections,
+			Established:  p.Established,
+			LastActivity: p.LastActivity,
+			RTT:          p.RTT,
+			Tx:           p.Tx,
+			Rx:           p.Rx,
+			MsgsIn:       p.MsgsIn,
+			MsgsOut:      p.MsgsOut,
+			Reconnects:   p.Reconnects,
+		})
+	}
+	writeAdminJSON(w, list)
+}
@@ -0,0 +1,176 @@
+package onet
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/dedis/onet/log"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/satori/go.uuid.v1"
+)
+
+// adminTestToken is the admin token of the servers in the tests.
+const adminTestToken = "secret"
+
+func adminRequest(s *Server, method, url, remote, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	req.RemoteAddr = remote
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	headerHandler{s.websocket}.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestServer_adminAllowed(t *testing.T) {
+	l := NewLocalTest(tSuite)
+	defer l.CloseAll()
+	s := l.GenServers(1)[0]
+
+	do := func(remote, token string) int {
+		return adminRequest(s, "GET", "/admin/debug", remote, token, "").Code
+	}
+	// Without a token, the API is disabled, even on the loopback interface.
+	require.Equal(t, http.StatusForbidden, do("10.0.0.1:1234", ""))
+	require.Equal(t, http.StatusForbidden, do("127.0.0.1:1234", ""))
+
+	// With a token, only the requests holding it are allowed, wherever they
+	// come from.
+	s.SetAdminToken(adminTestToken)
+	require.Equal(t, http.StatusForbidden, do("127.0.0.1:1234", ""))
+	require.Equal(t, http.StatusForbidden, do("127.0.0.1:1234", "wrong"))
+	require.Equal(t, http.StatusOK, do("10.0.0.1:1234", adminTestToken))
+	require.Equal(t, http.StatusOK,
+		adminRequest(s, "GET", "/admin/acl", "10.0.0.1:1234", adminTestToken, "").Code)
+}
+
+func TestServer_adminIntrospection(t *testing.T) {
+	l := NewLocalTest(tSuite)
+	defer l.CloseAll()
+	s := l.GenServers(1)[0]
+	s.SetAdminToken(adminTestToken)
+
+	for _, path := range []string{"/metrics", "/status", "/events", "/trees"} {
+		require.Equal(t, http.StatusForbidden,
+			adminRequest(s, "GET", path, "127.0.0.1:1234", "", "").Code, path)
+		require.Equal(t, http.StatusOK,
+			adminRequest(s, "GET", path, "10.0.0.1:1234", adminTestToken, "").Code, path)
+	}
+}
+
+func TestServer_adminDebug(t *testing.T) {
+	l := NewLocalTest(tSuite)
+	defer l.CloseAll()
+	s := l.GenServers(1)[0]
+	s.SetAdminToken(adminTestToken)
+	lvl := log.DebugVisible()
+	defer log.SetDebugVisible(lvl)
+
+	rec := adminRequest(s, "PUT", "/admin/debug", "127.0.0.1:1234", adminTestToken, `{"Level":4}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "{\"Level\":4}\n", rec.Body.String())
+	require.Equal(t, 4, log.DebugVisible())
+
+	rec = adminRequest(s, "PUT", "/admin/debug", "127.0.0.1:1234", adminTestToken, `x`)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = adminRequest(s, "POST", "/admin/debug", "127.0.0.1:1234", adminTestToken, "")
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestServer_adminProtocols(t *testing.T) {
+	l := NewLocalTest(tSuite)
+	defer l.CloseAll()
+	servers, _, tree := l.GenTree(2, true)
+	s := servers[0]
+	s.SetAdminToken(adminTestToken)
+
+	rec := adminRequest(s, "GET", "/admin/protocols", "127.0.0.1:1234", adminTestToken, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "[]\n", rec.Body.String())
+
+	pi, err := s.overlay.CreateProtocol(spawnName, tree, NilServiceID)
+	require.Nil(t, err)
+	list := s.overlay.Instances()
+	require.Equal(t, 1, len(list))
+	require.Equal(t, pi.Token().ID(), list[0].ID)
+	require.Equal(t, spawnName, list[0].Protocol)
+	require.True(t, list[0].IsRoot)
+
+	rec = adminRequest(s, "DELETE", "/admin/protocols?id=x", "127.0.0.1:1234", adminTestToken, "")
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = adminRequest(s, "DELETE", "/admin/protocols?id="+uuid.NewV4().String(),
+		"127.0.0.1:1234", adminTestToken, "")
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	rec = adminRequest(s, "DELETE", "/admin/protocols?id="+list[0].ID.String(),
+		"127.0.0.1:1234", adminTestToken, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, 0, len(s.overlay.Instances()))
+}
+
+func TestServer_adminGoroutinesBackup(t *testing.T) {
+	l := NewLocalTest(tSuite)
+	defer l.CloseAll()
+	s := l.GenServers(1)[0]
+	s.SetAdminToken(adminTestToken)
+
+	rec := adminRequest(s, "GET", "/admin/goroutines", "127.0.0.1:1234", adminTestToken, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), "goroutine")
+
+	rec = adminRequest(s, "GET", "/admin/backup", "127.0.0.1:1234", adminTestToken, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NotZero(t, rec.Body.Len())
+
+	rec = adminRequest(s, "GET", "/admin/connections", "127.0.0.1:1234", adminTestToken, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "[]\n", rec.Body.String())
+}
+
+func TestServer_ReloadWebSocketTLS(t *testing.T) {
+	l := NewLocalTest(tSuite)
+	defer l.CloseAll()
+	s := l.GenServers(1)[0]
+	s.SetAdminToken(adminTestToken)
+
+	rec := adminRequest(s, "POST", "/admin/tls", "127.0.0.1:1234", adminTestToken, "")
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+
+	tmp, err := ioutil.TempDir("", "admin")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmp)
+	certFile, keyFile, _ := writeTestCert(t, tmp, 1)
+	// The websocket of the server is already started, so the reloader is
+	// set directly.
+	cr, err := newCertReloader(certFile, keyFile)
+	require.Nil(t, err)
+	s.websocket.Lock()
+	s.websocket.certs = cr
+	s.websocket.Unlock()
+	require.Nil(t, s.ReloadWebSocketTLS())
+	rec = adminRequest(s, "POST", "/admin/tls", "127.0.0.1:1234", adminTestToken, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestServer_adminLogs(t *testing.T) {
+	l := NewLocalTest(tSuite)
+	defer l.CloseAll()
+	s := l.GenServers(1)[0]
+	s.SetAdminToken(adminTestToken)
+
+	rec := adminRequest(s, "GET", "/admin/logs", "127.0.0.1:1234", adminTestToken, "")
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	ring := log.NewRingLogger(10)
+	key := log.RegisterLogger(ring)
+	defer log.UnregisterLogger(key)
+	s.SetLogRing(ring)
+	log.Lvl5("hidden but kept")
+	rec = adminRequest(s, "GET", "/admin/logs", "127.0.0.1:1234", adminTestToken, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.True(t, strings.Contains(rec.Body.String(), "hidden but kept"))
+}
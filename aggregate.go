@@ -0,0 +1,301 @@
+// +build !js
+
+package onet
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+)
+
+// AggregateProtocolName is the name of AggregateProtocol, which is registered
+// by default.
+const AggregateProtocolName = "OnetAggregate"
+
+func init() {
+	network.RegisterMessage(AggregateAnnounce{})
+	network.RegisterMessage(AggregateReply{})
+	GlobalProtocolRegister(AggregateProtocolName, NewAggregateProtocol)
+}
+
+// Aggregation holds the functions of an aggregation run by
+// AggregateProtocol. It must be registered under the same name on all
+// nodes with RegisterAggregation.
+type Aggregation struct {
+	// Map returns the contribution of the node, given the input of the root.
+	Map func(n *TreeNodeInstance, input []byte) ([]byte, error)
+	// Reduce combines the contribution of an inner node with the results of
+	// its children, and returns the result of its subtree. own is nil if the
+	// Map of the node failed, and children only holds the results of the
+	// children that replied without error.
+	Reduce func(n *TreeNodeInstance, own []byte, children [][]byte) ([]byte, error)
+}
+
+var aggregations = struct {
+	m map[string]Aggregation
+	sync.Mutex
+}{m: make(map[string]Aggregation)}
+
+// RegisterAggregation registers an aggregation under the given name, so that
+// AggregateProtocol can run it.
+func RegisterAggregation(name string, agg Aggregation) error {
+	if agg.Map == nil || agg.Reduce == nil {
+		return errors.New("aggregation needs a Map and a Reduce function")
+	}
+	aggregations.Lock()
+	defer aggregations.Unlock()
+	aggregations.m[name] = agg
+	return nil
+}
+
+func getAggregation(name string) (Aggregation, error) {
+	aggregations.Lock()
+	defer aggregations.Unlock()
+	agg, ok := aggregations.m[name]
+	if !ok {
+		return agg, fmt.Errorf("unknown aggregation %q", name)
+	}
+	return agg, nil
+}
+
+// AggregateAnnounce is sent down the tree to start the aggregation.
+type AggregateAnnounce struct {
+	Aggregation string
+	Input       []byte
+	Timeout     time.Duration
+}
+
+// AggregateReply is sent up the tree with the result of a subtree.
+type AggregateReply struct {
+	Data []byte
+	// Nodes is the number of nodes whose contribution is in Data.
+	Nodes int
+	// Errors of the nodes of the subtree which didn't contribute.
+	Errors []string
+}
+
+// AggregateResult is the result of the aggregation, given by the root.
+type AggregateResult struct {
+	Data []byte
+	// Nodes is the number of nodes whose contribution is in Data.
+	Nodes int
+	// Errors of the nodes which didn't contribute, because their Map or
+	// Reduce failed, or because they didn't reply in time.
+	Errors []string
+}
+
+// AggregateProtocol runs an aggregation over a tree: every node computes its
+// contribution with the Map function, and the inner nodes combine it with
+// the results of their children with the Reduce function, until the result
+// reaches the root. A failing node doesn't fail the whole aggregation, its
+// error is given in the result instead.
+type AggregateProtocol struct {
+	*TreeNodeInstance
+	// Aggregation, Input and Timeout must be set on the root before calling
+	// Start. Timeout is the time the root waits for the results, the
+	// other nodes wait less according to their height. If it is 0, the
+	// nodes wait forever.
+	Aggregation string
+	Input       []byte
+	Timeout     time.Duration
+	// Result gets the result on the root.
+	Result chan *AggregateResult
+
+	own      []byte
+	mapped   bool
+	children [][]byte
+	nodes    int
+	errs     []string
+	replied  int
+	timer    network.Timer
+	finished bool
+	sync.Mutex
+}
+
+// NewAggregateProtocol returns a new AggregateProtocol.
+func NewAggregateProtocol(n *TreeNodeInstance) (ProtocolInstance, error) {
+	p := &AggregateProtocol{
+		TreeNodeInstance: n,
+		Result:           make(chan *AggregateResult, 1),
+	}
+	err := p.RegisterHandlers(p.handleAnnounce, p.handleReply)
+	return p, err
+}
+
+// Start sends the announcement down the tree.
+func (p *AggregateProtocol) Start() error {
+	if _, err := getAggregation(p.Aggregation); err != nil {
+		return err
+	}
+	p.announce()
+	return nil
+}
+
+func (p *AggregateProtocol) handleAnnounce(a struct {
+	*TreeNode
+	AggregateAnnounce
+}) error {
+	p.Aggregation = a.Aggregation
+	p.Input = a.Input
+	p.Timeout = a.Timeout
+	p.announce()
+	return nil
+}
+
+// announce sends the announcement to the children and computes the
+// contribution of the node while they work on theirs.
+func (p *AggregateProtocol) announce() {
+	if !p.IsLeaf() {
+		wait := p.wait()
+		if wait > 0 {
+			p.Lock()
+			p.timer = p.Clock().AfterFunc(wait, p.timeout)
+			p.Unlock()
+		}
+		ann := &AggregateAnnounce{p.Aggregation, p.Input, p.Timeout}
+		for _, c := range p.Children() {
+			if err := p.SendTo(c, ann); err != nil {
+				p.addReply(nil, 0, []string{c.Name() + ": " + err.Error()})
+			}
+		}
+	}
+
+	agg, err := getAggregation(p.Aggregation)
+	if err == nil {
+		var own []byte
+		own, err = agg.Map(p.TreeNodeInstance, p.Input)
+		p.Lock()
+		p.own, p.mapped = own, err == nil
+		p.Unlock()
+	}
+	if err != nil {
+		p.Lock()
+		p.errs = append(p.errs, p.Name()+": "+err.Error())
+		p.Unlock()
+	}
+	p.addReply(nil, 0, nil)
+}
+
+// wait returns how long the node waits for its children: the deeper the
+// node, the less it waits, so that its parent gets the result in time.
+func (p *AggregateProtocol) wait() time.Duration {
+	if p.Timeout <= 0 {
+		return 0
+	}
+	height := func(tn *TreeNode) int {
+		h := 0
+		tn.Visit(0, func(d int, _ *TreeNode) {
+			if d > h {
+				h = d
+			}
+		})
+		return h
+	}
+	return p.Timeout * time.Duration(height(p.TreeNode())) /
+		time.Duration(height(p.Root()))
+}
+
+func (p *AggregateProtocol) handleReply(r struct {
+	*TreeNode
+	AggregateReply
+}) error {
+	p.addReply(r.Data, r.Nodes, r.Errors)
+	return nil
+}
+
+// addReply adds the result of a child, or of the node itself if nodes is 0
+// and there are no errors, and finishes once all are in.
+func (p *AggregateProtocol) addReply(data []byte, nodes int, errs []string) {
+	p.Lock()
+	if p.finished {
+		p.Unlock()
+		return
+	}
+	if nodes > 0 {
+		p.children = append(p.children, data)
+		p.nodes += nodes
+	}
+	p.errs = append(p.errs, errs...)
+	p.replied++
+	// the children and the node itself
+	done := p.replied == len(p.Children())+1
+	p.Unlock()
+	if done {
+		p.finish()
+	}
+}
+
+// timeout finishes with the results received so far.
+func (p *AggregateProtocol) timeout() {
+	p.Lock()
+	missing := len(p.Children()) + 1 - p.replied
+	p.Unlock()
+	log.Lvl2(p.Name(), "aggregation timed out,", missing, "missing")
+	p.finish()
+}
+
+// finish reduces the results and sends them to the parent, or to Result on
+// the root.
+func (p *AggregateProtocol) finish() {
+	p.Lock()
+	if p.finished {
+		p.Unlock()
+		return
+	}
+	p.finished = true
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+	if missing := len(p.Children()) + 1 - p.replied; missing > 0 {
+		p.errs = append(p.errs, fmt.Sprintf("%s: timeout with %d replies missing",
+			p.Name(), missing))
+	}
+	own, children, nodes := p.own, p.children, p.nodes
+	errs := p.errs
+	if p.mapped {
+		nodes++
+	}
+	p.Unlock()
+
+	data := own
+	if !p.IsLeaf() && nodes > 0 {
+		agg, err := getAggregation(p.Aggregation)
+		if err == nil {
+			data, err = agg.Reduce(p.TreeNodeInstance, own, children)
+		}
+		if err != nil {
+			errs = append(errs, p.Name()+": "+err.Error())
+			data, nodes = nil, 0
+		}
+	}
+
+	if p.IsRoot() {
+		p.Result <- &AggregateResult{Data: data, Nodes: nodes, Errors: errs}
+	} else if err := p.SendToParent(&AggregateReply{data, nodes, errs}); err != nil {
+		log.Error(p.Name(), "couldn't send aggregation to parent:", err)
+	}
+	p.Done()
+}
+
+// Aggregate runs the registered aggregation over the tree and returns its
+// result. If timeout is 0, it waits until all nodes replied.
+func (c *Context) Aggregate(t *Tree, aggregation string, input []byte,
+	timeout time.Duration) (*AggregateResult, error) {
+	pi, err := c.CreateProtocol(AggregateProtocolName, t)
+	if err != nil {
+		return nil, err
+	}
+	p := pi.(*AggregateProtocol)
+	p.Aggregation = aggregation
+	p.Input = input
+	p.Timeout = timeout
+	if err := p.Start(); err != nil {
+		p.Done()
+		return nil, err
+	}
+	return <-p.Result, nil
+}
@@ -0,0 +1,98 @@
+package onet
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// sumAggregation sums the roster indexes of the nodes plus the input, and
+// fails on the node with index 2 if the input is 1.
+var sumAggregation = Aggregation{
+	Map: func(n *TreeNodeInstance, input []byte) ([]byte, error) {
+		in := binary.BigEndian.Uint64(input)
+		if in == 1 && n.TreeNode().RosterIndex == 2 {
+			return nil, errors.New("map failed")
+		}
+		return encodeSum(uint64(n.TreeNode().RosterIndex) + in), nil
+	},
+	Reduce: func(n *TreeNodeInstance, own []byte, children [][]byte) ([]byte, error) {
+		var sum uint64
+		if own != nil {
+			sum = binary.BigEndian.Uint64(own)
+		}
+		for _, c := range children {
+			sum += binary.BigEndian.Uint64(c)
+		}
+		return encodeSum(sum), nil
+	},
+}
+
+func encodeSum(s uint64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, s)
+	return buf
+}
+
+func init() {
+	RegisterAggregation("sum", sumAggregation)
+}
+
+func runAggregation(t *testing.T, tree *Tree, local *LocalTest, input uint64) *AggregateResult {
+	pi, err := local.CreateProtocol(AggregateProtocolName, tree)
+	require.Nil(t, err)
+	p := pi.(*AggregateProtocol)
+	p.Aggregation = "sum"
+	p.Input = encodeSum(input)
+	p.Timeout = 5 * time.Second
+	require.Nil(t, p.Start())
+	select {
+	case res := <-p.Result:
+		return res
+	case <-time.After(10 * time.Second):
+		t.Fatal("no aggregation result")
+	}
+	return nil
+}
+
+func TestAggregateProtocol(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	_, _, tree := local.GenBigTree(7, 7, 2, true)
+
+	res := runAggregation(t, tree, local, 0)
+	require.Equal(t, 7, res.Nodes)
+	require.Empty(t, res.Errors)
+	// 0+1+...+6
+	require.Equal(t, uint64(21), binary.BigEndian.Uint64(res.Data))
+
+	// every node adds 1, and the node 2 fails
+	res = runAggregation(t, tree, local, 1)
+	require.Equal(t, 6, res.Nodes)
+	require.Equal(t, 1, len(res.Errors))
+	require.Contains(t, res.Errors[0], "map failed")
+	require.Equal(t, uint64(21-2+6), binary.BigEndian.Uint64(res.Data))
+}
+
+func TestAggregateProtocol_Unknown(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	_, _, tree := local.GenTree(3, true)
+	pi, err := local.CreateProtocol(AggregateProtocolName, tree)
+	require.Nil(t, err)
+	p := pi.(*AggregateProtocol)
+	p.Aggregation = "unknown"
+	require.NotNil(t, p.Start())
+	p.Done()
+}
+
+func TestRegisterAggregation(t *testing.T) {
+	require.NotNil(t, RegisterAggregation("nil", Aggregation{}))
+	_, err := getAggregation("nil")
+	require.NotNil(t, err)
+	_, err = getAggregation("sum")
+	require.Nil(t, err)
+}
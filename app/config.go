@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
 	"strings"
 
@@ -23,6 +24,66 @@ type CothorityConfig struct {
 	Private     string
 	Address     network.Address
 	Description string
+	// FirstPublic is the key the server had before its key was rotated,
+	// see onet.Server.RotateKey. The ID of the server and the name of its
+	// database are derived from it.
+	FirstPublic string `toml:",omitempty"`
+	// AltAddresses are other addresses of the server, tried by the others
+	// after Address.
+	AltAddresses []network.Address `toml:",omitempty"`
+	// SRV is a DNS SRV name giving more addresses of the server.
+	SRV string `toml:",omitempty"`
+	// Features is a comma-separated list of feature flags to set on the
+	// server, a name prefixed with '-' is disabled.
+	Features string
+	// WebSocketTLS, if set, makes the websocket serve wss:// with the given
+	// certificate files or with a certificate from Let's Encrypt.
+	WebSocketTLS *onet.WebSocketTLS `toml:",omitempty"`
+	// HTTPHeaders, if set, are the CORS and security headers of the
+	// websocket port, for browser clients.
+	HTTPHeaders *onet.HTTPHeaders `toml:",omitempty"`
+	// Rendezvous, if set, is the server relaying the messages to this
+	// server if it cannot be reached directly, for example because it is
+	// behind a NAT. All servers of the roster must use the same rendezvous.
+	Rendezvous *ServerToml `toml:",omitempty"`
+	// Relay makes the server relay messages as a rendezvous.
+	Relay bool `toml:",omitempty"`
+	// STUNServer, given as host:port, is asked at startup for the external
+	// address of the server, to warn if it is behind a NAT without a
+	// rendezvous.
+	STUNServer string `toml:",omitempty"`
+	// ACLFile, if set, is the toml file of the ACL refusing connections
+	// and requests, see network.ACL. It can be reloaded with the admin API
+	// of the websocket port.
+	ACLFile string `toml:",omitempty"`
+	// AdminToken, if set, is the secret the clients of the admin API must
+	// give. Without it, the admin API is disabled.
+	AdminToken string `toml:",omitempty"`
+	// Proxy, if set, is the URL of the SOCKS5 or HTTP proxy used to connect
+	// to the other servers, or "env" to take it from the environment, see
+	// network.ProxyFromEnvironment.
+	Proxy string `toml:",omitempty"`
+	// DBPath, if set, is the directory of the database, instead of
+	// $CONODE_SERVICE_PATH or the default one.
+	DBPath string `toml:",omitempty"`
+	// DBBackend is the database engine. Only "bolt", the default, exists.
+	DBBackend string `toml:",omitempty"`
+	// Log, if set, overrides the logging settings of the command line.
+	Log *LogConfig `toml:",omitempty"`
+	// ProtocolLimits, if set, limits the resources of every protocol
+	// instance, see onet.ProtocolLimits.
+	ProtocolLimits *onet.ProtocolLimits `toml:",omitempty"`
+	// RosterThreshold, if set, is how many members of a roster must have
+	// signed it before the server accepts it, see
+	// onet.Overlay.SetRosterThreshold.
+	RosterThreshold int `toml:",omitempty"`
+	// RosterGroup, if set, is the group file whose members' signatures
+	// count for RosterThreshold, besides the server's own, see
+	// onet.Overlay.TrustRoster.
+	RosterGroup string `toml:",omitempty"`
+	// Services holds a block of settings for every service that needs
+	// some, by service name, see onet.RegisterNewServiceWithConfig.
+	Services map[string]map[string]interface{} `toml:",omitempty"`
 }
 
 // Save will save this CothorityConfig to the given file name. It
@@ -42,43 +103,214 @@ func (hc *CothorityConfig) Save(file string) error {
 	return nil
 }
 
-// ParseCothority parses the config file into a CothorityConfig.
-// It returns the CothorityConfig, the Host so we can already use it, and an error if
-// the file is inaccessible or has wrong values in it.
+// SaveKey stores the new keypair of a server whose key has been rotated
+// and writes the configuration to file, replacing it only once it is
+// written. It is the onet.KeySaver of the servers started by RunServer.
+func (hc *CothorityConfig) SaveKey(file string, public kyber.Point, private kyber.Scalar) error {
+	suite, err := suites.Find(hc.Suite)
+	if err != nil {
+		return err
+	}
+	pub, err := encoding.PointToStringHex(suite, public)
+	if err != nil {
+		return err
+	}
+	priv, err := encoding.ScalarToStringHex(suite, private)
+	if err != nil {
+		return err
+	}
+	nc := *hc
+	if nc.FirstPublic == "" {
+		nc.FirstPublic = nc.Public
+	}
+	nc.Public, nc.Private = pub, priv
+	tmp := file + ".tmp"
+	if err := nc.Save(tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	*hc = nc
+	return nil
+}
+
+// ParseCothority parses the config file into a CothorityConfig, see
+// ReadConfig. It returns the CothorityConfig, the Host so we can already use
+// it, and an error if the file is inaccessible or has wrong values in it.
 func ParseCothority(file string) (*CothorityConfig, *onet.Server, error) {
-	hc := &CothorityConfig{}
-	_, err := toml.DecodeFile(file, hc)
+	hc, err := ReadConfig(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	server, err := hc.NewServer()
 	if err != nil {
 		return nil, nil, err
 	}
+	return hc, server, nil
+}
 
-	// Backwards compatibility with configs before we included the suite name
-	if hc.Suite == "" {
-		hc.Suite = "Ed25519"
+// NewServer builds the server described by the configuration, which should
+// have been validated.
+func (hc *CothorityConfig) NewServer() (*onet.Server, error) {
+	if hc.Log != nil {
+		hc.Log.apply()
 	}
 	suite, err := suites.Find(hc.Suite)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
 	// Try to decode the Hex values
 	private, err := encoding.StringHexToScalar(suite, hc.Private)
 	if err != nil {
-		return nil, nil, fmt.Errorf("parsing private key: %v", err)
+		return nil, fmt.Errorf("parsing private key: %v", err)
 	}
 	point, err := encoding.StringHexToPoint(suite, hc.Public)
 	if err != nil {
-		return nil, nil, fmt.Errorf("parsing public key: %v", err)
+		return nil, fmt.Errorf("parsing public key: %v", err)
+	}
+	var first kyber.Point
+	if hc.FirstPublic != "" {
+		first, err = encoding.StringHexToPoint(suite, hc.FirstPublic)
+		if err != nil {
+			return nil, fmt.Errorf("parsing first public key: %v", err)
+		}
 	}
 	si := network.NewServerIdentity(point, hc.Address)
-	si.SetPrivate(private)
+	if first != nil {
+		si = network.NewServerIdentity(first, hc.Address)
+	}
+	si.SetKeys(point, private)
 	si.Description = hc.Description
-	server := onet.NewServerTCP(si, suite)
-	return hc, server, nil
+	si.AltAddresses = hc.AltAddresses
+	si.SRV = hc.SRV
+	server, err := onet.NewServerTCPWithOptions(si, suite, onet.ServerOptions{
+		DBPath:         hc.DBPath,
+		ServiceConfigs: hc.Services,
+		FirstPublic:    first,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("server: %v", err)
+	}
+	server.SetFeatures(hc.Features)
+	if logRing != nil {
+		server.SetLogRing(logRing)
+	}
+	if hc.WebSocketTLS != nil {
+		if err := server.SetWebSocketTLS(hc.WebSocketTLS); err != nil {
+			return nil, fmt.Errorf("websocket TLS: %v", err)
+		}
+	}
+	server.SetHTTPHeaders(hc.HTTPHeaders)
+	if hc.Rendezvous != nil {
+		rdv, err := hc.Rendezvous.toServerIdentity()
+		if err != nil {
+			return nil, fmt.Errorf("rendezvous: %v", err)
+		}
+		server.SetRendezvous(rdv)
+	}
+	if hc.Relay {
+		server.EnableRelay()
+	}
+	if hc.ACLFile != "" {
+		if err := server.SetACLFile(hc.ACLFile); err != nil {
+			return nil, fmt.Errorf("ACL: %v", err)
+		}
+	}
+	if hc.AdminToken != "" {
+		server.SetAdminToken(hc.AdminToken)
+	}
+	if hc.ProtocolLimits != nil {
+		server.SetProtocolLimits(*hc.ProtocolLimits)
+	}
+	if hc.RosterThreshold > 0 {
+		server.SetRosterThreshold(hc.RosterThreshold)
+	}
+	if hc.RosterGroup != "" {
+		ro, err := readRosterGroup(hc.RosterGroup)
+		if err != nil {
+			return nil, fmt.Errorf("roster group: %v", err)
+		}
+		server.TrustRoster(ro)
+	}
+	if hc.Proxy != "" {
+		proxy, err := parseProxy(hc.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("proxy: %v", err)
+		}
+		if err := server.SetProxy(proxy); err != nil {
+			return nil, fmt.Errorf("proxy: %v", err)
+		}
+	}
+	return server, nil
 }
 
-// GroupToml holds the data of the group.toml file.
+// parseProxy returns the ProxyFunc of the Proxy of the configuration.
+func parseProxy(proxy string) (network.ProxyFunc, error) {
+	if proxy == "env" {
+		return network.ProxyFromEnvironment, nil
+	}
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "socks5", "socks5h", "http":
+	default:
+		return nil, fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	return network.ProxyURL(u), nil
+}
+
+// CheckGroup verifies the entries of the group with the public key or the
+// address of this server. They must have the same suite, public key and
+// address as the configuration, otherwise the error lists the differences.
+func (hc *CothorityConfig) CheckGroup(group *GroupToml) error {
+	suite := hc.Suite
+	if suite == "" {
+		suite = "Ed25519"
+	}
+	for i, s := range group.Servers {
+		// A group file written before a key rotation has the first key.
+		samePublic := strings.EqualFold(strings.TrimSpace(s.Public),
+			strings.TrimSpace(hc.Public)) || hc.FirstPublic != "" &&
+			strings.EqualFold(strings.TrimSpace(s.Public), strings.TrimSpace(hc.FirstPublic))
+		sameHost := s.Address.NetworkAddress() == hc.Address.NetworkAddress()
+		if !samePublic && !sameHost {
+			continue
+		}
+		var diffs []string
+		sSuite := s.Suite
+		if sSuite == "" {
+			sSuite = "Ed25519"
+		}
+		if !strings.EqualFold(sSuite, suite) {
+			diffs = append(diffs, fmt.Sprintf("suite: group has %s, config has %s",
+				sSuite, suite))
+		}
+		if !samePublic {
+			diffs = append(diffs, fmt.Sprintf("public key: group has %s, config has %s",
+				s.Public, hc.Public))
+		}
+		if s.Address != hc.Address {
+			diffs = append(diffs, fmt.Sprintf("address: group has %s, config has %s",
+				s.Address, hc.Address))
+		}
+		if len(diffs) > 0 {
+			return fmt.Errorf("server %d of the group doesn't match this server:\n\t%s",
+				i, strings.Join(diffs, "\n\t"))
+		}
+	}
+	return nil
+}
+
+// GroupToml holds the data of the group.toml file. See GroupVersion for the
+// versions of the format.
 type GroupToml struct {
+	Version int           `toml:"version,omitempty"`
 	Servers []*ServerToml `toml:"servers"`
 }
 
@@ -87,6 +319,7 @@ type GroupToml struct {
 // a snippet which can be used to create a Cothority.
 func NewGroupToml(servers ...*ServerToml) *GroupToml {
 	return &GroupToml{
+		Version: GroupVersion,
 		Servers: servers,
 	}
 }
@@ -94,16 +327,24 @@ func NewGroupToml(servers ...*ServerToml) *GroupToml {
 // ServerToml is one entry in the group.toml file describing one server to use for
 // the cothority.
 type ServerToml struct {
-	Address     network.Address
-	Suite       string
-	Public      string
-	Description string
+	Address      network.Address
+	Suite        string
+	Public       string
+	Description  string
+	AltAddresses []network.Address `toml:",omitempty"`
+	SRV          string            `toml:",omitempty"`
+	// Region, Tags and URLs are the metadata of the server, see
+	// ServerMetadata.
+	Region string            `toml:",omitempty"`
+	Tags   []string          `toml:",omitempty"`
+	URLs   map[string]string `toml:",omitempty"`
 }
 
-// Group holds the Roster and the server-description.
+// Group holds the Roster and the server-description and metadata.
 type Group struct {
 	Roster      *onet.Roster
 	Description map[*network.ServerIdentity]string
+	Metadata    map[*network.ServerIdentity]*ServerMetadata
 }
 
 // GetDescription returns the description of a ServerIdentity.
@@ -113,31 +354,42 @@ func (g *Group) GetDescription(e *network.ServerIdentity) string {
 
 // ReadGroupDescToml reads a group.toml file and returns the list of ServerIdentities
 // and descriptions in the file.
-// If the file couldn't be decoded or doesn't hold valid ServerIdentities,
-// an error is returned.
+// If the file couldn't be decoded or isn't valid, as checked by
+// GroupToml.Validate, an error is returned.
 func ReadGroupDescToml(f io.Reader) (*Group, error) {
-	group := &GroupToml{}
-	_, err := toml.DecodeReader(f, group)
+	group, err := ReadGroupToml(f)
 	if err != nil {
 		return nil, err
 	}
 	// convert from ServerTomls to entities
 	var entities = make([]*network.ServerIdentity, len(group.Servers))
 	var descs = make(map[*network.ServerIdentity]string)
+	var metadata = make(map[*network.ServerIdentity]*ServerMetadata)
 	for i, s := range group.Servers {
-		// Backwards compatibility with old group files.
-		if s.Suite == "" {
-			s.Suite = "Ed25519"
-		}
 		en, err := s.toServerIdentity()
 		if err != nil {
 			return nil, err
 		}
 		entities[i] = en
 		descs[en] = s.Description
+		metadata[en] = s.Metadata()
 	}
 	el := onet.NewRoster(entities)
-	return &Group{el, descs}, nil
+	return &Group{el, descs, metadata}, nil
+}
+
+// readRosterGroup returns the roster of the group file with the given name.
+func readRosterGroup(fname string) (*onet.Roster, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	group, err := ReadGroupDescToml(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fname, err)
+	}
+	return group.Roster, nil
 }
 
 // Save writes the GroupToml definition into the file given by its name.
@@ -180,7 +432,10 @@ func (s *ServerToml) toServerIdentity() (*network.ServerIdentity, error) {
 	if err != nil {
 		return nil, err
 	}
-	return network.NewServerIdentity(public, s.Address), nil
+	si := network.NewServerIdentity(public, s.Address)
+	si.AltAddresses = s.AltAddresses
+	si.SRV = s.SRV
+	return si, nil
 }
 
 // NewServerToml takes a public key and an address and returns
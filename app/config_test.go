@@ -5,6 +5,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/BurntSushi/toml"
 	"github.com/dedis/onet/log"
 	"github.com/dedis/onet/network"
 )
@@ -27,7 +28,8 @@ var serverGroup string = `Description = "Default Dedis Cothority"
   Address = "tcp://185.26.156.40:61117"
   Suite = "Ed25519"
   Public = "6a921638a4ade8970ebcd9e371570f08d71a24987f90f12391b9f6c525be5be4"
-  Description = "Ismail's server"`
+  Description = "Ismail's server"
+  AltAddresses = ["tcp://10.0.0.2:61117"]`
 
 func TestReadGroupDescToml(t *testing.T) {
 	group, err := ReadGroupDescToml(strings.NewReader(serverGroup))
@@ -48,4 +50,68 @@ func TestReadGroupDescToml(t *testing.T) {
 	if group.Description[group.Roster.List[1]] != "Ismail's server" {
 		t.Fatal("This should be Ismail's server")
 	}
+	alt := group.Roster.List[1].AltAddresses
+	if len(alt) != 1 || alt[0] != network.NewAddress(network.PlainTCP, "10.0.0.2:61117") {
+		t.Fatal("Wrong alternative addresses", alt)
+	}
+}
+
+func TestCothorityConfig_CheckGroup(t *testing.T) {
+	group := &GroupToml{}
+	if _, err := toml.Decode(serverGroup, group); err != nil {
+		t.Fatal(err)
+	}
+	conf := &CothorityConfig{
+		Address: network.NewAddress(network.PlainTCP, "185.26.156.40:61117"),
+		Public:  "6a921638a4ade8970ebcd9e371570f08d71a24987f90f12391b9f6c525be5be4",
+	}
+	if err := conf.CheckGroup(group); err != nil {
+		t.Fatal("correct group refused:", err)
+	}
+
+	conf.Address = network.NewAddress(network.TLS, "185.26.156.40:61117")
+	err := conf.CheckGroup(group)
+	if err == nil || !strings.Contains(err.Error(), "address: group has tcp://185.26.156.40:61117") {
+		t.Fatal("wrong address not detected:", err)
+	}
+
+	conf.Address = network.NewAddress(network.PlainTCP, "5.135.161.91:2000")
+	err = conf.CheckGroup(group)
+	if err == nil || !strings.Contains(err.Error(), "server 0 of the group") ||
+		!strings.Contains(err.Error(), "public key: group has 94b8") {
+		t.Fatal("wrong public key not detected:", err)
+	}
+
+	conf.Address = network.NewAddress(network.PlainTCP, "127.0.0.1:2000")
+	conf.Public = "94b8255379e11df5167b8a7ae3b85f7e7eb5f13894abee85bd31b3270f1e4c65"
+	conf.Suite = "bn256.adapter"
+	err = conf.CheckGroup(group)
+	if err == nil || !strings.Contains(err.Error(), "suite: group has Ed25519, config has bn256.adapter") {
+		t.Fatal("wrong suite not detected:", err)
+	}
+
+	conf.Public = "0000"
+	if err := conf.CheckGroup(group); err != nil {
+		t.Fatal("group without this server refused:", err)
+	}
+}
+
+func TestParseProxy(t *testing.T) {
+	p, err := parseProxy("socks5://user:pw@10.0.0.1:1080")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := p("10.0.0.2:7770")
+	if err != nil || u.Host != "10.0.0.1:1080" || u.User.Username() != "user" {
+		t.Fatal("wrong proxy:", u, err)
+	}
+
+	for _, ok := range []string{"http://proxy:3128", "env"} {
+		if _, err := parseProxy(ok); err != nil {
+			t.Fatal(ok, "refused:", err)
+		}
+	}
+	if _, err := parseProxy("ftp://proxy:21"); err == nil {
+		t.Fatal("wrong scheme accepted")
+	}
 }
@@ -0,0 +1,402 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/dedis/kyber/suites"
+	"github.com/dedis/kyber/util/encoding"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+	"gopkg.in/yaml.v2"
+)
+
+// LogConfig is the logging part of the configuration of a server.
+type LogConfig struct {
+	// Level is the debug level, from 0 (only errors and warnings) to 5.
+	Level     int
+	ShowTime  bool `toml:",omitempty"`
+	UseColors bool `toml:",omitempty"`
+	// TimeFormat is the format of the time, see log.SetTimeFormat.
+	TimeFormat string `toml:",omitempty"`
+	// UTC shows the time in UTC instead of the local time.
+	UTC bool `toml:",omitempty"`
+	// Format is the template of the lines, see log.SetFormat.
+	Format string `toml:",omitempty"`
+	// Theme gives the colors of the levels, see log.Theme.
+	Theme log.Theme `toml:",omitempty"`
+	// Dedup are the levels whose identical consecutive messages are
+	// collapsed, e.g. ["W", "E"], see log.SetDedup.
+	Dedup []string `toml:",omitempty"`
+	// Network, if set, also sends the log to a Graylog or Fluentd
+	// aggregator, see log.NetworkLogger.
+	Network *log.NetworkLoggerConfig `toml:",omitempty"`
+	// File, if set, also appends the log to a file, see log.FileLogger.
+	File *log.FileLoggerConfig `toml:",omitempty"`
+	// RingSize, if not 0, keeps the latest RingSize entries of all levels
+	// in memory, see log.RingLogger. They are dumped on a crash and by the
+	// admin API.
+	RingSize int `toml:",omitempty"`
+}
+
+// networkLogger is the key of the logger registered for
+// LogConfig.Network, or -1.
+var networkLogger = -1
+
+// fileLogger is the key of the logger registered for LogConfig.File, or
+// -1.
+var fileLogger = -1
+
+// logRing is the logger registered for LogConfig.RingSize, or nil. It is
+// kept when the ring is disabled, with a size of 0, so that the server
+// doesn't need to know about a new one.
+var logRing *log.RingLogger
+
+// apply sets the configuration of the log package. The format and theme
+// have been checked by Validate.
+func (lc *LogConfig) apply() {
+	log.SetDebugVisible(lc.Level)
+	log.SetShowTime(lc.ShowTime)
+	log.SetUseColors(lc.UseColors)
+	log.SetTimeUTC(lc.UTC)
+	if err := log.SetTimeFormat(lc.TimeFormat); err != nil {
+		log.Error("Invalid log time format:", err)
+	}
+	if err := log.SetFormat(lc.Format); err != nil {
+		log.Error("Invalid log format:", err)
+	}
+	if err := log.SetTheme(lc.Theme); err != nil {
+		log.Error("Invalid log theme:", err)
+	}
+	if err := log.SetDedup(lc.Dedup); err != nil {
+		log.Error("Invalid log dedup:", err)
+	}
+	if logRing != nil {
+		logRing.Resize(lc.RingSize)
+	} else if lc.RingSize > 0 {
+		logRing = log.NewRingLogger(lc.RingSize)
+		log.RegisterLogger(logRing)
+	}
+	if fileLogger >= 0 {
+		log.UnregisterLogger(fileLogger)
+		fileLogger = -1
+	}
+	if lc.File != nil {
+		fl, err := log.NewFileLogger(*lc.File)
+		if err != nil {
+			log.Error("Couldn't open the log file:", err)
+		} else {
+			fileLogger = log.RegisterLogger(fl)
+		}
+	}
+	if networkLogger >= 0 {
+		log.UnregisterLogger(networkLogger)
+		networkLogger = -1
+	}
+	if lc.Network != nil {
+		nl, err := log.NewNetworkLogger(*lc.Network)
+		if err != nil {
+			log.Error("Invalid network logger:", err)
+			return
+		}
+		networkLogger = log.RegisterLogger(nl)
+	}
+}
+
+// ReadConfig reads the configuration of a server from a TOML file, or from a
+// YAML file if its name ends in .yaml or .yml, and validates it. The names of
+// the settings are the same in both formats. Unknown settings are refused,
+// as they are most probably typos.
+func ReadConfig(file string) (*CothorityConfig, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	hc := &CothorityConfig{}
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		err = decodeYAML(data, hc)
+	default:
+		err = decodeTOML(data, hc)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	// Backwards compatibility with configs before we included the suite name
+	if hc.Suite == "" {
+		hc.Suite = "Ed25519"
+	}
+	if err := hc.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return hc, nil
+}
+
+func decodeTOML(data []byte, hc *CothorityConfig) error {
+	md, err := toml.Decode(string(data), hc)
+	if err != nil {
+		return err
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, len(undecoded))
+		for i, k := range undecoded {
+			keys[i] = k.String()
+		}
+		return fmt.Errorf("unknown settings: %s", strings.Join(keys, ", "))
+	}
+	return nil
+}
+
+// decodeYAML decodes the YAML document into v with the rules of
+// encoding/json, so that the settings have the same names as in TOML.
+func decodeYAML(data []byte, v interface{}) error {
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	doc, err := yamlToJSON(doc)
+	if err != nil {
+		return err
+	}
+	buf, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("unknown or invalid setting: %v", err)
+	}
+	return nil
+}
+
+// yamlToJSON converts the maps of a decoded YAML document, which can have
+// keys of any type, to maps with string keys.
+func yamlToJSON(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			ks, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("key %v is not a string", k)
+			}
+			var err error
+			if m[ks], err = yamlToJSON(val); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case []interface{}:
+		for i, val := range v {
+			var err error
+			if v[i], err = yamlToJSON(val); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return v, nil
+}
+
+// Validate checks the configuration and returns all the problems found at
+// once.
+func (hc *CothorityConfig) Validate() error {
+	var errs []string
+	add := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Sprintf(format, args...))
+	}
+
+	suite, err := suites.Find(hc.Suite)
+	if err != nil {
+		add("Suite: unknown suite %q", hc.Suite)
+	} else {
+		private, err := encoding.StringHexToScalar(suite, hc.Private)
+		if err != nil {
+			add("Private: not a private key in hexadecimal: %v", err)
+		}
+		public, err := encoding.StringHexToPoint(suite, hc.Public)
+		if err != nil {
+			add("Public: not a public key in hexadecimal: %v", err)
+		}
+		if private != nil && public != nil &&
+			!suite.Point().Mul(private, nil).Equal(public) {
+			add("Private: doesn't match the Public key")
+		}
+		if hc.FirstPublic != "" {
+			if _, err := encoding.StringHexToPoint(suite, hc.FirstPublic); err != nil {
+				add("FirstPublic: not a public key in hexadecimal: %v", err)
+			}
+		}
+	}
+
+	checkAddress := func(name string, a network.Address) {
+		if !a.Valid() {
+			add("%s: invalid address %q, it should look like tls://1.2.3.4:7770", name, a)
+		} else if a.ConnType() == network.Local {
+			add("%s: local addresses are only for tests", name)
+		}
+	}
+	checkAddress("Address", hc.Address)
+	for i, a := range hc.AltAddresses {
+		checkAddress(fmt.Sprintf("AltAddresses[%d]", i), a)
+	}
+
+	switch hc.DBBackend {
+	case "", "bolt":
+	default:
+		add("DBBackend: unknown backend %q, only \"bolt\" is supported", hc.DBBackend)
+	}
+	if hc.Log != nil && (hc.Log.Level < 0 || hc.Log.Level > 5) {
+		add("Log.Level: %d is not between 0 and 5", hc.Log.Level)
+	}
+	if hc.Log != nil {
+		if err := log.CheckTimeFormat(hc.Log.TimeFormat); err != nil {
+			add("Log.TimeFormat: %v", err)
+		}
+		if err := log.CheckFormat(hc.Log.Format); err != nil {
+			add("Log.Format: %v", err)
+		}
+		if err := hc.Log.Theme.Check(); err != nil {
+			add("Log.Theme: %v", err)
+		}
+		if err := log.CheckDedup(hc.Log.Dedup); err != nil {
+			add("Log.Dedup: %v", err)
+		}
+		if hc.Log.Network != nil {
+			if err := hc.Log.Network.Check(); err != nil {
+				add("Log.Network: %v", err)
+			}
+		}
+		if hc.Log.File != nil {
+			if err := hc.Log.File.Check(); err != nil {
+				add("Log.File: %v", err)
+			}
+		}
+		if hc.Log.RingSize < 0 {
+			add("Log.RingSize: %d is negative", hc.Log.RingSize)
+		}
+	}
+	if hc.RosterThreshold < 0 {
+		add("RosterThreshold: %d is negative", hc.RosterThreshold)
+	}
+	if hc.RosterGroup != "" {
+		if _, err := readRosterGroup(hc.RosterGroup); err != nil {
+			add("RosterGroup: %v", err)
+		}
+	}
+	if tc := hc.WebSocketTLS; tc != nil {
+		switch {
+		case tc.CertFile != "" && tc.KeyFile == "":
+			add("WebSocketTLS: CertFile needs a KeyFile")
+		case tc.CertFile == "" && len(tc.ACMEDomains) == 0:
+			add("WebSocketTLS: needs a CertFile and KeyFile, or ACMEDomains")
+		}
+	}
+	if hc.Rendezvous != nil {
+		if hc.Rendezvous.Suite == "" {
+			hc.Rendezvous.Suite = "Ed25519"
+		}
+		if _, err := hc.Rendezvous.toServerIdentity(); err != nil {
+			add("Rendezvous: %v", err)
+		}
+	}
+	if hc.STUNServer != "" {
+		if _, _, err := net.SplitHostPort(hc.STUNServer); err != nil {
+			add("STUNServer: %v, it should be host:port", err)
+		}
+	}
+	if hc.ACLFile != "" {
+		if _, err := network.ReadACL(hc.ACLFile); err != nil {
+			add("ACLFile: %v", err)
+		}
+	}
+	if hc.Proxy != "" {
+		if _, err := parseProxy(hc.Proxy); err != nil {
+			add("Proxy: %v", err)
+		}
+	}
+	if err := onet.CheckServiceConfigs(hc.Services); err != nil {
+		add("Services: %v", err)
+	}
+	if hc.DBPath != "" {
+		if fi, err := os.Stat(hc.DBPath); err == nil && !fi.IsDir() {
+			add("DBPath: %s is not a directory", hc.DBPath)
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n\t%s", strings.Join(errs, "\n\t"))
+	}
+	return nil
+}
+
+// reloadable are the settings that Reload applies to a running server.
+var reloadable = map[string]bool{
+	"Log":             true,
+	"ACLFile":         true,
+	"AdminToken":      true,
+	"Features":        true,
+	"HTTPHeaders":     true,
+	"ProtocolLimits":  true,
+	"RosterThreshold": true,
+}
+
+// Reload reads the configuration file again and applies to the server the
+// settings that can change while it runs: Log, ACLFile, AdminToken, Features,
+// HTTPHeaders, ProtocolLimits and RosterThreshold. It returns the names of the other settings
+// that changed, which need a restart. The configuration is only changed if
+// the file is valid.
+func (hc *CothorityConfig) Reload(server *onet.Server, file string) ([]string, error) {
+	nc, err := ReadConfig(file)
+	if err != nil {
+		return nil, err
+	}
+	if nc.ACLFile != "" {
+		if err := server.SetACLFile(nc.ACLFile); err != nil {
+			return nil, fmt.Errorf("ACL: %v", err)
+		}
+	} else if hc.ACLFile != "" {
+		if err := server.SetACLFile(""); err != nil {
+			return nil, err
+		}
+		if err := server.SetACL(nil); err != nil {
+			return nil, err
+		}
+	}
+	if nc.Log != nil {
+		nc.Log.apply()
+		if logRing != nil {
+			server.SetLogRing(logRing)
+		}
+	}
+	server.SetAdminToken(nc.AdminToken)
+	server.SetFeatures(nc.Features)
+	server.SetHTTPHeaders(nc.HTTPHeaders)
+	if nc.ProtocolLimits != nil {
+		server.SetProtocolLimits(*nc.ProtocolLimits)
+	} else {
+		server.SetProtocolLimits(onet.ProtocolLimits{})
+	}
+	server.SetRosterThreshold(nc.RosterThreshold)
+
+	var restart []string
+	oldV, newV := reflect.ValueOf(hc).Elem(), reflect.ValueOf(nc).Elem()
+	for i := 0; i < oldV.NumField(); i++ {
+		name := oldV.Type().Field(i).Name
+		if !reloadable[name] &&
+			!reflect.DeepEqual(oldV.Field(i).Interface(), newV.Field(i).Interface()) {
+			restart = append(restart, name)
+		}
+	}
+	*hc = *nc
+	return restart, nil
+}
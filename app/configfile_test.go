@@ -0,0 +1,198 @@
+package app
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/dedis/kyber/suites"
+	"github.com/dedis/kyber/util/encoding"
+	"github.com/dedis/kyber/util/key"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+	"github.com/stretchr/testify/require"
+)
+
+type appConfigServiceConfig struct {
+	Interval int
+}
+
+func init() {
+	onet.RegisterNewServiceWithConfig("AppConfigService", func(c *onet.Context) (onet.Service, error) {
+		return onet.NewServiceProcessor(c), nil
+	}, &appConfigServiceConfig{})
+}
+
+// testKeys returns a private and a public key of the Ed25519 suite, in
+// hexadecimal.
+func testKeys(t *testing.T) (string, string) {
+	suite := suites.MustFind("Ed25519")
+	kp := key.NewKeyPair(suite)
+	priv, err := encoding.ScalarToStringHex(suite, kp.Private)
+	require.Nil(t, err)
+	pub, err := encoding.PointToStringHex(suite, kp.Public)
+	require.Nil(t, err)
+	return priv, pub
+}
+
+func writeConfig(t *testing.T, dir, name, content string) string {
+	file := path.Join(dir, name)
+	require.Nil(t, ioutil.WriteFile(file, []byte(content), 0600))
+	return file
+}
+
+func TestReadConfig(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "configfile")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmp)
+	priv, pub := testKeys(t)
+
+	tomlFile := writeConfig(t, tmp, "private.toml", `
+Public = "`+pub+`"
+Private = "`+priv+`"
+Address = "tls://127.0.0.1:7770"
+DBPath = "`+tmp+`"
+
+[Log]
+  Level = 2
+  TimeFormat = "rfc3339"
+  UTC = true
+  Format = "{{.Level}} {{.Message}}"
+  [Log.Theme]
+    E = "bright-red"
+
+[Services.AppConfigService]
+  Interval = 5
+`)
+	yamlFile := writeConfig(t, tmp, "private.yaml", `
+Public: "`+pub+`"
+Private: "`+priv+`"
+Address: tls://127.0.0.1:7770
+DBPath: "`+tmp+`"
+Log:
+  Level: 2
+  TimeFormat: rfc3339
+  UTC: true
+  Format: "{{.Level}} {{.Message}}"
+  Theme:
+    E: bright-red
+Services:
+  AppConfigService:
+    Interval: 5
+`)
+	for _, file := range []string{tomlFile, yamlFile} {
+		hc, err := ReadConfig(file)
+		require.Nil(t, err, file)
+		require.Equal(t, "Ed25519", hc.Suite)
+		require.Equal(t, network.NewAddress(network.TLS, "127.0.0.1:7770"), hc.Address)
+		require.Equal(t, tmp, hc.DBPath)
+		require.Equal(t, 2, hc.Log.Level)
+		require.Equal(t, log.TimeFormatRFC3339, hc.Log.TimeFormat)
+		require.True(t, hc.Log.UTC)
+		require.Equal(t, "{{.Level}} {{.Message}}", hc.Log.Format)
+		require.Equal(t, "bright-red", hc.Log.Theme["E"])
+		require.EqualValues(t, 5, hc.Services["AppConfigService"]["Interval"])
+	}
+}
+
+func TestReadConfig_unknown(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "configfile")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmp)
+	priv, pub := testKeys(t)
+
+	file := writeConfig(t, tmp, "private.toml", `
+Public = "`+pub+`"
+Private = "`+priv+`"
+Address = "tls://127.0.0.1:7770"
+Adress = "tls://127.0.0.1:7770"
+`)
+	_, err = ReadConfig(file)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "Adress")
+
+	file = writeConfig(t, tmp, "private.yml", `
+Public: "`+pub+`"
+Private: "`+priv+`"
+Address: tls://127.0.0.1:7770
+Adress: tls://127.0.0.1:7770
+`)
+	_, err = ReadConfig(file)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "Adress")
+}
+
+func TestCothorityConfig_Validate(t *testing.T) {
+	priv, pub := testKeys(t)
+	_, pub2 := testKeys(t)
+	hc := &CothorityConfig{
+		Suite:   "Ed25519",
+		Public:  pub,
+		Private: priv,
+		Address: network.NewAddress(network.TLS, "127.0.0.1:7770"),
+	}
+	require.Nil(t, hc.Validate())
+
+	hc.Public = pub2
+	hc.Address = "127.0.0.1:7770"
+	hc.DBBackend = "leveldb"
+	hc.Log = &LogConfig{Level: 7, TimeFormat: "iso", Format: "{{.Lvl}}", Theme: log.Theme{"X": "red"},
+		Network: &log.NetworkLoggerConfig{Network: "udp", Format: log.NetFormatFluentd}, RingSize: -1, Dedup: []string{"warn"},
+		File: &log.FileLoggerConfig{SyncEvery: -1}}
+	hc.WebSocketTLS = &onet.WebSocketTLS{CertFile: "cert.pem"}
+	hc.RosterThreshold = -1
+	hc.RosterGroup = "/nonexistent/group.toml"
+	hc.Services = map[string]map[string]interface{}{
+		"AppConfigService": {"Intervall": 3},
+	}
+	err := hc.Validate()
+	require.NotNil(t, err)
+	for _, s := range []string{"Private:", "Address:", "DBBackend:", "Log.Level:",
+		"Log.TimeFormat:", "Log.Format:", "Log.Theme:", "Log.Dedup:", "Log.Network:", "Log.File:", "Log.RingSize:", "RosterThreshold:", "RosterGroup:", "WebSocketTLS:", "Services:"} {
+		require.True(t, strings.Contains(err.Error(), s), s)
+	}
+}
+
+func TestCothorityConfig_Reload(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "configfile")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmp)
+	priv, pub := testKeys(t)
+	l := onet.NewLocalTest(suites.MustFind("Ed25519"))
+	defer l.CloseAll()
+	server := l.GenServers(1)[0]
+
+	conf := func(address, features string) string {
+		return `
+Public = "` + pub + `"
+Private = "` + priv + `"
+Address = "` + address + `"
+Features = "` + features + `"
+`
+	}
+	file := writeConfig(t, tmp, "private.toml", conf("tls://127.0.0.1:7770", ""))
+	hc, err := ReadConfig(file)
+	require.Nil(t, err)
+
+	writeConfig(t, tmp, "private.toml", conf("tls://127.0.0.1:7770", "reloaded"))
+	restart, err := hc.Reload(server, file)
+	require.Nil(t, err)
+	require.Equal(t, 0, len(restart))
+	require.True(t, server.FeatureEnabled("reloaded"))
+
+	writeConfig(t, tmp, "private.toml", conf("tls://127.0.0.1:7780", "reloaded"))
+	restart, err = hc.Reload(server, file)
+	require.Nil(t, err)
+	require.Equal(t, []string{"Address"}, restart)
+	require.Equal(t, network.NewAddress(network.TLS, "127.0.0.1:7780"), hc.Address)
+
+	// An invalid file keeps the former configuration.
+	writeConfig(t, tmp, "private.toml", conf("nowhere", ""))
+	_, err = hc.Reload(server, file)
+	require.NotNil(t, err)
+	require.Equal(t, network.NewAddress(network.TLS, "127.0.0.1:7780"), hc.Address)
+	require.True(t, server.FeatureEnabled("reloaded"))
+}
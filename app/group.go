@@ -0,0 +1,184 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/network"
+)
+
+// GroupVersion is the version of the group.toml files written by this
+// package. Version 1, or no version at all, is the format without metadata.
+// Version 2 adds the Region, Tags and URLs of the servers.
+const GroupVersion = 2
+
+// ServerMetadata describes a server of a group beyond what is needed to
+// contact it, e.g. for the placement of the work.
+type ServerMetadata struct {
+	// Region where the server is located, e.g. "eu-west"
+	Region string
+	// Tags of the server, e.g. its capacity as "large" or "gpu"
+	Tags []string
+	// URLs of the services of the server, by service name
+	URLs map[string]string
+}
+
+// HasTag returns true if the server has the tag.
+func (sm *ServerMetadata) HasTag(tag string) bool {
+	for _, t := range sm.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Metadata returns the metadata of the server of the group file.
+func (s *ServerToml) Metadata() *ServerMetadata {
+	return &ServerMetadata{
+		Region: s.Region,
+		Tags:   append([]string{}, s.Tags...),
+		URLs:   copyURLs(s.URLs),
+	}
+}
+
+func copyURLs(urls map[string]string) map[string]string {
+	c := make(map[string]string, len(urls))
+	for k, v := range urls {
+		c[k] = v
+	}
+	return c
+}
+
+// ReadGroupToml reads a group file and validates it. The servers of files
+// without a suite use Ed25519.
+func ReadGroupToml(r io.Reader) (*GroupToml, error) {
+	group := &GroupToml{}
+	if _, err := toml.DecodeReader(r, group); err != nil {
+		return nil, err
+	}
+	for _, s := range group.Servers {
+		// Backwards compatibility with old group files.
+		if s.Suite == "" {
+			s.Suite = "Ed25519"
+		}
+	}
+	if err := group.Validate(); err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+// ReadGroupTomlFile is ReadGroupToml for the file with the given name.
+func ReadGroupTomlFile(fname string) (*GroupToml, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	group, err := ReadGroupToml(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fname, err)
+	}
+	return group, nil
+}
+
+// Validate returns an error if the group can't be used: if its version is
+// unknown, if it has no servers, or if a server has an invalid address,
+// public key or metadata, or the same address or public key as another
+// server.
+func (gt *GroupToml) Validate() error {
+	if gt.Version < 0 || gt.Version > GroupVersion {
+		return fmt.Errorf("group has version %d, only versions up to %d are known",
+			gt.Version, GroupVersion)
+	}
+	if len(gt.Servers) == 0 {
+		return fmt.Errorf("group has no servers")
+	}
+	addresses := make(map[network.Address]int)
+	publics := make(map[string]int)
+	for i, s := range gt.Servers {
+		if err := s.validate(); err != nil {
+			return fmt.Errorf("server %d of the group: %v", i, err)
+		}
+		if j, ok := addresses[s.Address]; ok {
+			return fmt.Errorf("servers %d and %d of the group have the address %s",
+				j, i, s.Address)
+		}
+		addresses[s.Address] = i
+		public := strings.ToLower(strings.TrimSpace(s.Public))
+		if j, ok := publics[public]; ok {
+			return fmt.Errorf("servers %d and %d of the group have the same public key",
+				j, i)
+		}
+		publics[public] = i
+	}
+	return nil
+}
+
+// validate checks one server of the group.
+func (s *ServerToml) validate() error {
+	if !s.Address.Valid() {
+		return fmt.Errorf("invalid address %q", s.Address)
+	}
+	for _, a := range s.AltAddresses {
+		if !a.Valid() {
+			return fmt.Errorf("invalid alternative address %q", a)
+		}
+	}
+	if _, err := s.toServerIdentity(); err != nil {
+		return fmt.Errorf("invalid public key: %v", err)
+	}
+	if strings.ContainsAny(s.Region, " \t\n") {
+		return fmt.Errorf("region %q has spaces", s.Region)
+	}
+	for _, t := range s.Tags {
+		if t == "" || strings.ContainsAny(t, " \t\n,") {
+			return fmt.Errorf("invalid tag %q", t)
+		}
+	}
+	for service, u := range s.URLs {
+		pu, err := url.Parse(u)
+		if err != nil || pu.Scheme == "" || pu.Host == "" {
+			return fmt.Errorf("invalid URL %q of service %s", u, service)
+		}
+	}
+	return nil
+}
+
+// GetMetadata returns the metadata of a ServerIdentity of the group.
+func (g *Group) GetMetadata(e *network.ServerIdentity) *ServerMetadata {
+	return g.Metadata[e]
+}
+
+// Select returns the roster of the servers of the group in the region,
+// if it isn't empty, that have all the tags. It returns nil if no server
+// matches.
+func (g *Group) Select(region string, tags ...string) *onet.Roster {
+	var list []*network.ServerIdentity
+	for _, si := range g.Roster.List {
+		md := g.Metadata[si]
+		if md == nil || (region != "" && md.Region != region) {
+			continue
+		}
+		match := true
+		for _, t := range tags {
+			if !md.HasTag(t) {
+				match = false
+				break
+			}
+		}
+		if match {
+			list = append(list, si)
+		}
+	}
+	if len(list) == 0 {
+		return nil
+	}
+	return onet.NewRoster(list)
+}
@@ -0,0 +1,130 @@
+package app
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dedis/onet/network"
+)
+
+var metadataGroup = `version = 2
+
+[[servers]]
+  Address = "tcp://5.135.161.91:2000"
+  Suite = "Ed25519"
+  Public = "94b8255379e11df5167b8a7ae3b85f7e7eb5f13894abee85bd31b3270f1e4c65"
+  Description = "Nikkolasg's server"
+  Region = "eu-west"
+  Tags = ["large", "ssd"]
+  [servers.URLs]
+    status = "https://5.135.161.91/status"
+
+[[servers]]
+  Address = "tcp://185.26.156.40:61117"
+  Suite = "Ed25519"
+  Public = "6a921638a4ade8970ebcd9e371570f08d71a24987f90f12391b9f6c525be5be4"
+  Description = "Ismail's server"
+  Region = "eu-central"
+  Tags = ["large"]`
+
+func TestReadGroupDescToml_Metadata(t *testing.T) {
+	group, err := ReadGroupDescToml(strings.NewReader(metadataGroup))
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := group.GetMetadata(group.Roster.List[0])
+	if md.Region != "eu-west" || !md.HasTag("ssd") || md.HasTag("gpu") {
+		t.Fatal("wrong metadata", md)
+	}
+	if md.URLs["status"] != "https://5.135.161.91/status" {
+		t.Fatal("wrong URLs", md.URLs)
+	}
+	if len(group.GetMetadata(group.Roster.List[1]).URLs) != 0 {
+		t.Fatal("second server has no URLs")
+	}
+
+	if r := group.Select("", "large"); r == nil || len(r.List) != 2 {
+		t.Fatal("both servers are large", r)
+	}
+	r := group.Select("eu-west", "large")
+	if r == nil || len(r.List) != 1 || r.List[0] != group.Roster.List[0] {
+		t.Fatal("only the first server is in eu-west", r)
+	}
+	if group.Select("us-east") != nil {
+		t.Fatal("no server is in us-east")
+	}
+
+	// Version 1 files are still read, without metadata
+	group, err = ReadGroupDescToml(strings.NewReader(serverGroup))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md := group.GetMetadata(group.Roster.List[0]); md.Region != "" || len(md.Tags) != 0 {
+		t.Fatal("old group has no metadata", md)
+	}
+}
+
+func TestGroupToml_String(t *testing.T) {
+	group, err := ReadGroupToml(strings.NewReader(metadataGroup))
+	if err != nil {
+		t.Fatal(err)
+	}
+	group2, err := ReadGroupToml(strings.NewReader(group.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if group2.Version != GroupVersion || len(group2.Servers) != 2 {
+		t.Fatal("wrong group", group2)
+	}
+	s := group2.Servers[0]
+	if s.Region != "eu-west" || len(s.Tags) != 2 || s.URLs["status"] == "" {
+		t.Fatal("metadata got lost", s)
+	}
+	if NewGroupToml().Version != GroupVersion {
+		t.Fatal("new groups should have the current version")
+	}
+}
+
+func TestGroupToml_Validate(t *testing.T) {
+	for _, tc := range []struct {
+		change func(gt *GroupToml)
+		err    string
+	}{
+		{func(gt *GroupToml) { gt.Version = GroupVersion + 1 }, "version 3"},
+		{func(gt *GroupToml) { gt.Servers = nil }, "no servers"},
+		{func(gt *GroupToml) { gt.Servers[1].Address = "tcp://nowhere" },
+			"server 1 of the group: invalid address"},
+		{func(gt *GroupToml) { gt.Servers[1].Public = "1234" },
+			"server 1 of the group: invalid public key"},
+		{func(gt *GroupToml) { gt.Servers[1].Address = gt.Servers[0].Address },
+			"servers 0 and 1 of the group have the address"},
+		{func(gt *GroupToml) { gt.Servers[1].Public = strings.ToUpper(gt.Servers[0].Public) },
+			"servers 0 and 1 of the group have the same public key"},
+		{func(gt *GroupToml) { gt.Servers[0].Tags = []string{"large", ""} },
+			`server 0 of the group: invalid tag ""`},
+		{func(gt *GroupToml) { gt.Servers[0].Region = "eu west" },
+			"server 0 of the group: region"},
+		{func(gt *GroupToml) { gt.Servers[0].URLs["status"] = "/status" },
+			"server 0 of the group: invalid URL"},
+	} {
+		group, err := ReadGroupToml(strings.NewReader(metadataGroup))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tc.change(group)
+		err = group.Validate()
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("expected %q, got %v", tc.err, err)
+		}
+	}
+
+	// An alternative address is checked like the address
+	group, err := ReadGroupToml(strings.NewReader(metadataGroup))
+	if err != nil {
+		t.Fatal(err)
+	}
+	group.Servers[0].AltAddresses = []network.Address{"10.0.0.2:2000"}
+	if err := group.Validate(); err == nil {
+		t.Fatal("invalid alternative address not detected")
+	}
+}
@@ -0,0 +1,128 @@
+// The onetadmin command manages a running server through its admin API:
+//
+//   onetadmin [-url <url>] [-token <token>] debug [<level>]
+//   onetadmin [-url <url>] [-token <token>] protocols
+//   onetadmin [-url <url>] [-token <token>] kill <instance-id>
+//   onetadmin [-url <url>] [-token <token>] goroutines
+//   onetadmin [-url <url>] [-token <token>] backup <file>
+//   onetadmin [-url <url>] [-token <token>] reload-tls
+//   onetadmin [-url <url>] [-token <token>] connections
+//   onetadmin [-url <url>] [-token <token>] acl [reload]
+//   onetadmin [-url <url>] [-token <token>] features [<name> on|off]
+//
+// The url is the one of the websocket of the server, which is one port above
+// the server's. The token can also be given in the environment variable
+// ONET_ADMIN_TOKEN.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/dedis/onet/log"
+)
+
+var url, token string
+
+func init() {
+	flag.StringVar(&url, "url", "http://localhost:7771", "url of the websocket of the server")
+	flag.StringVar(&token, "token", os.Getenv("ONET_ADMIN_TOKEN"), "admin token of the server")
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: onetadmin [flags] debug [<level>] | protocols | "+
+			"kill <id> | goroutines | backup <file> | reload-tls | connections | acl [reload] | "+
+			"features [<name> on|off]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	var err error
+	switch {
+	case args[0] == "debug" && len(args) == 1:
+		err = do("GET", "debug", "", os.Stdout)
+	case args[0] == "debug" && len(args) == 2:
+		if _, err = strconv.Atoi(args[1]); err == nil {
+			err = do("PUT", "debug", `{"Level":`+args[1]+`}`, os.Stdout)
+		}
+	case args[0] == "protocols" && len(args) == 1:
+		err = do("GET", "protocols", "", os.Stdout)
+	case args[0] == "kill" && len(args) == 2:
+		err = do("DELETE", "protocols?id="+args[1], "", os.Stdout)
+	case args[0] == "goroutines" && len(args) == 1:
+		err = do("GET", "goroutines", "", os.Stdout)
+	case args[0] == "backup" && len(args) == 2:
+		err = backup(args[1])
+	case args[0] == "reload-tls" && len(args) == 1:
+		err = do("POST", "tls", "", os.Stdout)
+	case args[0] == "connections" && len(args) == 1:
+		err = do("GET", "connections", "", os.Stdout)
+	case args[0] == "acl" && len(args) == 1:
+		err = do("GET", "acl", "", os.Stdout)
+	case args[0] == "acl" && len(args) == 2 && args[1] == "reload":
+		err = do("POST", "acl", "", os.Stdout)
+	case args[0] == "features" && len(args) == 1:
+		err = do("GET", "features", "", os.Stdout)
+	case args[0] == "features" && len(args) == 3 && (args[2] == "on" || args[2] == "off"):
+		var body []byte
+		body, err = json.Marshal(map[string]interface{}{"Name": args[1], "Enabled": args[2] == "on"})
+		if err == nil {
+			err = do("PUT", "features", string(body), os.Stdout)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	log.ErrFatal(err)
+}
+
+// do sends the request to /admin/<path> and copies the answer to out.
+func do(method, path, body string, out io.Writer) error {
+	req, err := http.NewRequest(method, strings.TrimRight(url, "/")+"/admin/"+path,
+		bytes.NewBufferString(body))
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return errors.New(resp.Status + ": " + strings.TrimSpace(string(msg)))
+	}
+	_, err = io.Copy(out, resp.Body)
+	return err
+}
+
+// backup writes the copy of the database to file.
+func backup(file string) error {
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if err := do("GET", "backup", "", f); err != nil {
+		f.Close()
+		os.Remove(file)
+		return err
+	}
+	return f.Close()
+}
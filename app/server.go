@@ -12,6 +12,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/dedis/kyber"
 	"github.com/dedis/kyber/util/encoding"
 	"github.com/dedis/kyber/util/key"
 	"github.com/dedis/onet/cfgpath"
@@ -96,7 +97,7 @@ func InteractiveConfig(suite network.Suite, binaryName string) {
 				log.Error("Could not parse your public IP address", err)
 				failedPublic = true
 			} else {
-				publicAddress = network.NewAddress(network.TLS, strings.TrimSpace(string(buff))+":"+portStr)
+				publicAddress = network.NewHostPortAddress(network.TLS, strings.TrimSpace(string(buff)), portStr)
 			}
 		}
 	} else {
@@ -222,22 +223,22 @@ func saveFiles(conf *CothorityConfig, fileConf string, group *GroupToml, fileGro
 func askReachableAddress(port string) network.Address {
 	ipStr := Input(DefaultAddress, "IP-address where your server can be reached")
 
-	splitted := strings.Split(ipStr, ":")
-	if len(splitted) == 2 && splitted[1] != port {
+	if net.ParseIP(ipStr) != nil {
+		// only the IP address was given, IPv6 addresses without brackets
+		return network.NewHostPortAddress(network.TLS, ipStr, port)
+	}
+	host, p, err := net.SplitHostPort(ipStr)
+	if err != nil {
+		log.Fatal("Invalid IP address given:", ipStr)
+	}
+	if p != port {
 		// if the client gave a port number, it must be the same
 		log.Fatal("The port you gave is not the same as the one your server will be listening. Abort.")
-	} else if len(splitted) == 2 && net.ParseIP(splitted[0]) == nil {
-		// of if the IP address is wrong
+	}
+	if net.ParseIP(host) == nil {
 		log.Fatal("Invalid IP:port address given:", ipStr)
-	} else if len(splitted) == 1 {
-		// check if the ip is valid
-		if net.ParseIP(ipStr) == nil {
-			log.Fatal("Invalid IP address given:", ipStr)
-		}
-		// add the port
-		ipStr = ipStr + ":" + port
 	}
-	return network.NewAddress(network.TLS, ipStr)
+	return network.NewHostPortAddress(network.TLS, host, port)
 }
 
 // tryConnect binds to the given IP address and ask an internet service to
@@ -316,9 +317,57 @@ func RunServer(configFilename string) {
 		log.Fatalf("[-] Configuration file does not exist. %s", configFilename)
 	}
 	// Let's read the config
-	_, server, err := ParseCothority(configFilename)
+	conf, server, err := ParseCothority(configFilename)
 	if err != nil {
 		log.Fatal("Couldn't parse config:", err)
 	}
+	if err := checkGroupFile(conf, path.Join(path.Dir(configFilename), DefaultGroupFile)); err != nil {
+		log.Fatal("Wrong group file:", err)
+	}
+	if conf.STUNServer != "" {
+		checkExternalAddress(conf)
+	}
+	server.SetReloader(func() ([]string, error) {
+		return conf.Reload(server, configFilename)
+	})
+	server.SetKeySaver(func(public kyber.Point, private kyber.Scalar) error {
+		return conf.SaveKey(configFilename, public, private)
+	})
 	server.Start()
 }
+
+// checkExternalAddress warns if the server is behind a NAT, according to
+// the STUN server of the configuration, and has no rendezvous.
+func checkExternalAddress(conf *CothorityConfig) {
+	ext, err := network.DiscoverExternalAddress(conf.STUNServer)
+	if err != nil {
+		log.Warn("Couldn't get the external address:", err)
+		return
+	}
+	host, _, err := net.SplitHostPort(ext)
+	if err != nil {
+		log.Warn("Wrong external address", ext, ":", err)
+		return
+	}
+	log.Info("External address is", host)
+	if host != conf.Address.Host() && conf.Rendezvous == nil {
+		log.Warn("The server seems to be behind a NAT: the others may not be able",
+			"to connect to", conf.Address, "unless it has a Rendezvous")
+	}
+}
+
+// checkGroupFile verifies the group file next to the configuration, if
+// there is one, with CothorityConfig.CheckGroup.
+func checkGroupFile(conf *CothorityConfig, groupFile string) error {
+	if _, err := os.Stat(groupFile); os.IsNotExist(err) {
+		return nil
+	}
+	group, err := ReadGroupTomlFile(groupFile)
+	if err != nil {
+		return err
+	}
+	if err := conf.CheckGroup(group); err != nil {
+		return fmt.Errorf("%s: %v", groupFile, err)
+	}
+	return nil
+}
@@ -0,0 +1,308 @@
+// +build !js
+
+package onet
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/dedis/onet/log"
+)
+
+// The kinds of records written to the audit log by onet itself. Services
+// can write records of their own kinds with Context.Audit.
+const (
+	AuditClientRequest = "client-request"
+	AuditProtocolStart = "protocol-start"
+	AuditConfigChange  = "config-change"
+	AuditAuthFailure   = "auth-failure"
+)
+
+// auditLocal is the actor of the changes made through the API of the
+// server.
+const auditLocal = "local"
+
+var auditBucket = []byte("onet_audit")
+
+// AuditRecord is an entry of the audit log.
+type AuditRecord struct {
+	// Seq numbers the records from 1, without gaps
+	Seq  uint64
+	Time time.Time
+	Kind string
+	// Actor is who caused the record: the address of a client, the
+	// identity of a server, or "local" for the API of this server
+	Actor   string
+	Message string
+	// Hash links the record to the previous one if the log is
+	// hash-chained, see EnableAuditLog
+	Hash []byte `json:",omitempty"`
+}
+
+// hash returns the hash of the record linked to prev, the hash of the
+// record before it.
+func (r *AuditRecord) hash(prev []byte) []byte {
+	h := sha256.New()
+	h.Write(prev)
+	binary.Write(h, binary.BigEndian, r.Seq)
+	binary.Write(h, binary.BigEndian, r.Time.UnixNano())
+	for _, s := range []string{r.Kind, r.Actor, r.Message} {
+		binary.Write(h, binary.BigEndian, uint32(len(s)))
+		h.Write([]byte(s))
+	}
+	return h.Sum(nil)
+}
+
+// AuditQuery selects records of the audit log. The zero value selects all
+// of them.
+type AuditQuery struct {
+	// Kind and Actor, if set, must equal the ones of the records
+	Kind  string
+	Actor string
+	// Since and Until, if set, bound the time of the records
+	Since time.Time
+	Until time.Time
+	// From is the first sequence number returned
+	From uint64
+	// Limit, if not 0, returns only the first Limit records
+	Limit int
+}
+
+func (q AuditQuery) matches(r *AuditRecord) bool {
+	return (q.Kind == "" || q.Kind == r.Kind) &&
+		(q.Actor == "" || q.Actor == r.Actor) &&
+		(q.Since.IsZero() || !r.Time.Before(q.Since)) &&
+		(q.Until.IsZero() || r.Time.Before(q.Until))
+}
+
+// auditLog writes the records to the database of the server. It does
+// nothing until it is enabled.
+type auditLog struct {
+	server  *Server
+	enabled bool
+	chain   bool
+	// seq and last are the sequence number and hash of the latest record
+	seq  uint64
+	last []byte
+	sync.Mutex
+}
+
+func newAuditLog(c *Server) *auditLog {
+	return &auditLog{server: c}
+}
+
+// EnableAuditLog starts writing the security-relevant events to the audit
+// log in the database: the requests of the clients, the protocols started
+// here, the changes of the configuration and the refused requests. The
+// records are kept across restarts and never removed. If chain is true,
+// every record holds a hash linking it to the previous one, so that
+// VerifyAuditLog detects changed or removed records.
+func (c *Server) EnableAuditLog(chain bool) error {
+	return c.audit.enable(chain)
+}
+
+// Audit writes a record to the audit log, if it is enabled.
+func (c *Server) Audit(kind, actor string, msg ...interface{}) {
+	c.audit.record(kind, actor, msg...)
+}
+
+// Audit writes a record of the service to the audit log, if it is enabled.
+// The message is prefixed with the name of the service.
+func (c *Context) Audit(kind, actor string, msg ...interface{}) {
+	c.server.Audit(kind, actor, c.name+": "+fmt.Sprint(msg...))
+}
+
+// AuditRecords returns the records of the audit log selected by q, oldest
+// first.
+func (c *Server) AuditRecords(q AuditQuery) ([]AuditRecord, error) {
+	var records []AuditRecord
+	err := c.audit.each(q.From, func(r *AuditRecord) bool {
+		if q.matches(r) {
+			records = append(records, *r)
+		}
+		return q.Limit == 0 || len(records) < q.Limit
+	})
+	return records, err
+}
+
+// ExportAuditLog writes the records selected by q to w, one JSON object
+// per line.
+func (c *Server) ExportAuditLog(w io.Writer, q AuditQuery) error {
+	enc := json.NewEncoder(w)
+	var werr error
+	n := 0
+	err := c.audit.each(q.From, func(r *AuditRecord) bool {
+		if !q.matches(r) {
+			return true
+		}
+		if werr = enc.Encode(r); werr != nil {
+			return false
+		}
+		n++
+		return q.Limit == 0 || n < q.Limit
+	})
+	if err != nil {
+		return err
+	}
+	return werr
+}
+
+// VerifyAuditLog checks that no record of the audit log is missing and that
+// the hashes of the chained records are valid. The removal of the latest
+// records can't be detected.
+func (c *Server) VerifyAuditLog() error {
+	var prev []byte
+	var seq uint64
+	var verr error
+	err := c.audit.each(0, func(r *AuditRecord) bool {
+		seq++
+		if r.Seq != seq {
+			verr = fmt.Errorf("audit record %d is missing", seq)
+			return false
+		}
+		if r.Hash != nil && !bytes.Equal(r.Hash, r.hash(prev)) {
+			verr = fmt.Errorf("audit record %d has been changed", r.Seq)
+			return false
+		}
+		prev = r.Hash
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	return verr
+}
+
+// enable loads the latest record, so that the new ones follow it.
+func (a *auditLog) enable(chain bool) error {
+	a.Lock()
+	defer a.Unlock()
+	err := a.server.serviceManager.dbUpdate(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(auditBucket)
+		if err != nil {
+			return err
+		}
+		_, v := b.Cursor().Last()
+		if v == nil {
+			return nil
+		}
+		var r AuditRecord
+		if err := json.Unmarshal(v, &r); err != nil {
+			return err
+		}
+		a.seq, a.last = r.Seq, r.Hash
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	a.enabled, a.chain = true, chain
+	return nil
+}
+
+// record appends a record if the log is enabled. It is safe to call on a
+// nil auditLog.
+func (a *auditLog) record(kind, actor string, msg ...interface{}) {
+	if a == nil {
+		return
+	}
+	a.Lock()
+	defer a.Unlock()
+	if !a.enabled {
+		return
+	}
+	r := &AuditRecord{
+		Seq:     a.seq + 1,
+		Time:    time.Now(),
+		Kind:    kind,
+		Actor:   actor,
+		Message: fmt.Sprint(msg...),
+	}
+	if a.chain {
+		r.Hash = r.hash(a.last)
+	}
+	buf, err := json.Marshal(r)
+	if err != nil {
+		log.Error("Couldn't encode audit record:", err)
+		return
+	}
+	err = a.server.serviceManager.dbUpdate(func(tx *bolt.Tx) error {
+		return tx.Bucket(auditBucket).Put(auditKey(r.Seq), buf)
+	})
+	if err != nil {
+		log.Error("Couldn't write audit record:", err)
+		return
+	}
+	a.seq, a.last = r.Seq, r.Hash
+}
+
+// each calls fn on the records from the sequence number from on, until fn
+// returns false.
+func (a *auditLog) each(from uint64, fn func(*AuditRecord) bool) error {
+	return a.server.serviceManager.dbView(func(tx *bolt.Tx) error {
+		b := tx.Bucket(auditBucket)
+		if b == nil {
+			return nil
+		}
+		cur := b.Cursor()
+		for k, v := cur.Seek(auditKey(from)); k != nil; k, v = cur.Next() {
+			var r AuditRecord
+			if err := json.Unmarshal(v, &r); err != nil {
+				return errors.New("invalid audit record: " + err.Error())
+			}
+			if !fn(&r) {
+				return nil
+			}
+		}
+		return nil
+	})
+}
+
+func auditKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
+
+// serveAdminAudit exports the audit log. The records can be selected with
+// kind=, actor=, since= and until= in RFC3339, from= and n=.
+func (c *Server) serveAdminAudit(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	query := AuditQuery{Kind: q.Get("kind"), Actor: q.Get("actor")}
+	var err error
+	if s := q.Get("since"); s != "" {
+		if query.Since, err = time.Parse(time.RFC3339, s); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if s := q.Get("until"); s != "" {
+		if query.Until, err = time.Parse(time.RFC3339, s); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if s := q.Get("from"); s != "" {
+		if query.From, err = strconv.ParseUint(s, 10, 64); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if n, err := strconv.Atoi(q.Get("n")); err == nil && n > 0 {
+		query.Limit = n
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	if err := c.ExportAuditLog(w, query); err != nil {
+		log.Error("Couldn't export audit log:", err)
+	}
+}
@@ -0,0 +1,96 @@
+package onet
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/dedis/onet/network"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_AuditLog(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	s := local.GenServers(1)[0]
+
+	// Nothing is recorded before the log is enabled
+	s.Audit(AuditAuthFailure, "1.2.3.4", "ignored")
+	records, err := s.AuditRecords(AuditQuery{})
+	require.Nil(t, err)
+	require.Empty(t, records)
+
+	require.Nil(t, s.EnableAuditLog(true))
+	s.Audit(AuditAuthFailure, "1.2.3.4", "bad token")
+	require.Nil(t, s.SetACL(&network.ACL{}))
+	s.SetFeature("test", true)
+	c := s.Service(callServiceName).(*callService).Context
+	c.Audit("custom", "5.6.7.8", "done")
+
+	records, err = s.AuditRecords(AuditQuery{})
+	require.Nil(t, err)
+	require.Equal(t, 4, len(records))
+	for i, r := range records {
+		require.Equal(t, uint64(i+1), r.Seq)
+		require.NotNil(t, r.Hash)
+	}
+	require.Equal(t, "bad token", records[0].Message)
+	require.Equal(t, callServiceName+": done", records[3].Message)
+
+	records, err = s.AuditRecords(AuditQuery{Kind: AuditConfigChange})
+	require.Nil(t, err)
+	require.Equal(t, 2, len(records))
+	require.Equal(t, auditLocal, records[0].Actor)
+	records, err = s.AuditRecords(AuditQuery{Actor: "5.6.7.8"})
+	require.Nil(t, err)
+	require.Equal(t, 1, len(records))
+	records, err = s.AuditRecords(AuditQuery{From: 2, Limit: 1})
+	require.Nil(t, err)
+	require.Equal(t, 1, len(records))
+	require.Equal(t, uint64(2), records[0].Seq)
+	records, err = s.AuditRecords(AuditQuery{Since: time.Now().Add(time.Hour)})
+	require.Nil(t, err)
+	require.Empty(t, records)
+
+	var buf bytes.Buffer
+	require.Nil(t, s.ExportAuditLog(&buf, AuditQuery{Kind: AuditAuthFailure}))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Equal(t, 1, len(lines))
+	var r AuditRecord
+	require.Nil(t, json.Unmarshal([]byte(lines[0]), &r))
+	require.Equal(t, "1.2.3.4", r.Actor)
+
+	require.Nil(t, s.VerifyAuditLog())
+
+	// Enabling the log again continues the chain
+	require.Nil(t, s.EnableAuditLog(true))
+	s.Audit("custom", "x", "after")
+	require.Nil(t, s.VerifyAuditLog())
+
+	// Changing a record breaks the chain
+	records, err = s.AuditRecords(AuditQuery{From: 2, Limit: 1})
+	require.Nil(t, err)
+	records[0].Message = "changed"
+	writeAuditRecord(t, s, &records[0])
+	require.NotNil(t, s.VerifyAuditLog())
+	records[0].Message = "new ACL"
+	writeAuditRecord(t, s, &records[0])
+	require.Nil(t, s.VerifyAuditLog())
+
+	// Removing a record too
+	require.Nil(t, s.serviceManager.dbUpdate(func(tx *bolt.Tx) error {
+		return tx.Bucket(auditBucket).Delete(auditKey(3))
+	}))
+	require.NotNil(t, s.VerifyAuditLog())
+}
+
+func writeAuditRecord(t *testing.T, s *Server, r *AuditRecord) {
+	buf, err := json.Marshal(r)
+	require.Nil(t, err)
+	require.Nil(t, s.serviceManager.dbUpdate(func(tx *bolt.Tx) error {
+		return tx.Bucket(auditBucket).Put(auditKey(r.Seq), buf)
+	}))
+}
@@ -0,0 +1,242 @@
+package onet
+
+import (
+	"errors"
+	"hash/fnv"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dedis/onet/network"
+	"github.com/dedis/protobuf"
+)
+
+// Balancer chooses which node of a roster receives a request sent with
+// Client.SendToRoster. After every request, Report is called with the
+// outcome, so that strategies can learn from the history.
+type Balancer interface {
+	// Pick returns the node of ro that receives the request. The key
+	// identifies the request for strategies that depend on it, it can be
+	// empty.
+	Pick(ro *Roster, key string) *network.ServerIdentity
+	// Report gives the duration and the error of a request sent to si.
+	Report(si *network.ServerIdentity, took time.Duration, err error)
+	// Status returns the metrics of the strategy.
+	Status() *Status
+}
+
+// balancerStats counts the requests per node. It is embedded in all
+// strategies to implement Report and Status.
+type balancerStats struct {
+	nodes map[network.ServerIdentityID]*nodeStats
+	sync.Mutex
+}
+
+type nodeStats struct {
+	address  network.Address
+	requests int
+	errors   int
+	// latency is an exponentially weighted moving average of the
+	// successful requests.
+	latency time.Duration
+}
+
+// latencyWeight is the weight of the last request in the average latency.
+const latencyWeight = 0.2
+
+func (bs *balancerStats) Report(si *network.ServerIdentity, took time.Duration, err error) {
+	bs.Lock()
+	defer bs.Unlock()
+	if bs.nodes == nil {
+		bs.nodes = make(map[network.ServerIdentityID]*nodeStats)
+	}
+	ns, ok := bs.nodes[si.ID]
+	if !ok {
+		ns = &nodeStats{address: si.Address}
+		bs.nodes[si.ID] = ns
+	}
+	ns.requests++
+	if err != nil {
+		ns.errors++
+		return
+	}
+	if ns.latency == 0 {
+		ns.latency = took
+	} else {
+		ns.latency = time.Duration(latencyWeight*float64(took) +
+			(1-latencyWeight)*float64(ns.latency))
+	}
+}
+
+// latency returns the average latency of si and whether there has been a
+// successful request to it.
+func (bs *balancerStats) latency(si *network.ServerIdentity) (time.Duration, bool) {
+	bs.Lock()
+	defer bs.Unlock()
+	ns, ok := bs.nodes[si.ID]
+	if !ok || ns.latency == 0 {
+		return 0, false
+	}
+	return ns.latency, true
+}
+
+func (bs *balancerStats) status(strategy string) *Status {
+	bs.Lock()
+	defer bs.Unlock()
+	st := NewStatus()
+	st.Set("Strategy", strategy)
+	var total int
+	for _, ns := range bs.nodes {
+		total += ns.requests
+		st.Set(ns.address.String(), map[string]interface{}{
+			"Requests": ns.requests,
+			"Errors":   ns.errors,
+			"Latency":  ns.latency,
+		})
+	}
+	st.Set("Requests", total)
+	return st
+}
+
+// RandomBalancer sends every request to a random node.
+type RandomBalancer struct {
+	balancerStats
+}
+
+// Pick implements Balancer.
+func (rb *RandomBalancer) Pick(ro *Roster, key string) *network.ServerIdentity {
+	return ro.RandomServerIdentity()
+}
+
+// Status implements Balancer.
+func (rb *RandomBalancer) Status() *Status {
+	return rb.status("random")
+}
+
+// RoundRobinBalancer sends the requests to the nodes of the roster one
+// after the other.
+type RoundRobinBalancer struct {
+	next int
+	balancerStats
+}
+
+// Pick implements Balancer.
+func (rr *RoundRobinBalancer) Pick(ro *Roster, key string) *network.ServerIdentity {
+	rr.Lock()
+	defer rr.Unlock()
+	si := ro.List[rr.next%len(ro.List)]
+	rr.next++
+	return si
+}
+
+// Status implements Balancer.
+func (rr *RoundRobinBalancer) Status() *Status {
+	return rr.status("round-robin")
+}
+
+// LatencyBalancer sends the requests to the node with the lowest average
+// latency. Nodes that have never answered are tried first, so that every
+// node gets measured. With probability Explore a random node is picked, so
+// that nodes that got faster are detected.
+type LatencyBalancer struct {
+	Explore float64
+	balancerStats
+}
+
+// Pick implements Balancer.
+func (lb *LatencyBalancer) Pick(ro *Roster, key string) *network.ServerIdentity {
+	if lb.Explore > 0 && randFloat64() < lb.Explore {
+		return ro.RandomServerIdentity()
+	}
+	var best *network.ServerIdentity
+	var bestLatency time.Duration
+	for _, si := range ro.List {
+		l, ok := lb.latency(si)
+		if !ok {
+			return si
+		}
+		if best == nil || l < bestLatency {
+			best, bestLatency = si, l
+		}
+	}
+	return best
+}
+
+// Status implements Balancer.
+func (lb *LatencyBalancer) Status() *Status {
+	return lb.status("lowest-latency")
+}
+
+// StickyBalancer always sends the requests with the same key to the same
+// node, as long as the roster doesn't change. Requests with an empty key go
+// to a random node.
+type StickyBalancer struct {
+	balancerStats
+}
+
+// Pick implements Balancer.
+func (sb *StickyBalancer) Pick(ro *Roster, key string) *network.ServerIdentity {
+	if key == "" {
+		return ro.RandomServerIdentity()
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return ro.List[int(h.Sum32()%uint32(len(ro.List)))]
+}
+
+// Status implements Balancer.
+func (sb *StickyBalancer) Status() *Status {
+	return sb.status("sticky")
+}
+
+// SetBalancer sets the strategy used by SendToRoster. The default strategy
+// is a RandomBalancer.
+func (c *Client) SetBalancer(b Balancer) {
+	c.Lock()
+	defer c.Unlock()
+	c.balancer = b
+}
+
+// Balancer returns the strategy used by SendToRoster.
+func (c *Client) Balancer() Balancer {
+	c.Lock()
+	defer c.Unlock()
+	if c.balancer == nil {
+		c.balancer = &RandomBalancer{}
+	}
+	return c.balancer
+}
+
+// SendToRoster sends buf to one node of ro, chosen by the balancer of the
+// client, and returns the reply and the node that answered.
+func (c *Client) SendToRoster(ro *Roster, key, path string, buf []byte) ([]byte, *network.ServerIdentity, error) {
+	if ro == nil || len(ro.List) == 0 {
+		return nil, nil, errors.New("empty roster")
+	}
+	b := c.Balancer()
+	si := b.Pick(ro, key)
+	start := time.Now()
+	reply, err := c.Send(si, path, buf)
+	b.Report(si, time.Since(start), err)
+	return reply, si, err
+}
+
+// SendProtobufToRoster is like SendProtobuf, but sends to a node of ro
+// chosen by the balancer of the client.
+func (c *Client) SendProtobufToRoster(ro *Roster, key string, msg interface{}, ret interface{}) error {
+	buf, err := protobuf.Encode(msg)
+	if err != nil {
+		return err
+	}
+	path := strings.Split(reflect.TypeOf(msg).String(), ".")[1]
+	reply, _, err := c.SendToRoster(ro, key, path, buf)
+	if err != nil {
+		return err
+	}
+	if ret != nil {
+		return protobuf.DecodeWithConstructors(reply, ret,
+			network.DefaultConstructors(c.suite))
+	}
+	return nil
+}
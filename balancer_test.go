@@ -0,0 +1,86 @@
+package onet
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoundRobinBalancer(t *testing.T) {
+	ro := genRoster(tSuite, genLocalhostPeerNames(3, 2000))
+	rr := &RoundRobinBalancer{}
+	for i := 0; i < 6; i++ {
+		require.Equal(t, ro.List[i%3], rr.Pick(ro, ""))
+	}
+}
+
+func TestLatencyBalancer(t *testing.T) {
+	ro := genRoster(tSuite, genLocalhostPeerNames(3, 2000))
+	lb := &LatencyBalancer{}
+	// Unmeasured nodes come first.
+	require.Equal(t, ro.List[0], lb.Pick(ro, ""))
+	lb.Report(ro.List[0], 30*time.Millisecond, nil)
+	require.Equal(t, ro.List[1], lb.Pick(ro, ""))
+	lb.Report(ro.List[1], 10*time.Millisecond, nil)
+	require.Equal(t, ro.List[2], lb.Pick(ro, ""))
+	lb.Report(ro.List[2], 20*time.Millisecond, nil)
+	require.Equal(t, ro.List[1], lb.Pick(ro, ""))
+
+	// The average moves towards the new measurements.
+	for i := 0; i < 10; i++ {
+		lb.Report(ro.List[1], 50*time.Millisecond, nil)
+	}
+	require.Equal(t, ro.List[2], lb.Pick(ro, ""))
+
+	lb.Report(ro.List[2], 0, errors.New("failed"))
+	st := lb.Status()
+	v, ok := st.Value(ro.List[2].Address.String())
+	require.True(t, ok)
+	require.Equal(t, 2, v.(map[string]interface{})["Requests"])
+	require.Equal(t, 1, v.(map[string]interface{})["Errors"])
+	v, _ = st.Value("Requests")
+	require.Equal(t, 14, v)
+}
+
+func TestStickyBalancer(t *testing.T) {
+	ro := genRoster(tSuite, genLocalhostPeerNames(5, 2000))
+	sb := &StickyBalancer{}
+	for _, key := range []string{"a", "b", "c"} {
+		si := sb.Pick(ro, key)
+		for i := 0; i < 5; i++ {
+			require.Equal(t, si, sb.Pick(ro, key))
+		}
+	}
+	require.NotNil(t, sb.Pick(ro, ""))
+}
+
+func TestClient_SendToRoster(t *testing.T) {
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	RegisterNewService(backForthServiceName, func(c *Context) (Service, error) {
+		return &simpleService{ctx: c}, nil
+	})
+	defer ServiceFactory.Unregister(backForthServiceName)
+	_, ro, _ := local.GenTree(3, false)
+
+	c := local.NewClient(backForthServiceName)
+	rr := &RoundRobinBalancer{}
+	c.SetBalancer(rr)
+	require.Equal(t, rr, c.Balancer())
+	for i := 0; i < 3; i++ {
+		sr := &SimpleResponse{}
+		require.Nil(t, c.SendProtobufToRoster(ro, "",
+			&SimpleRequest{ServerIdentities: ro, Val: i}, sr))
+		require.Equal(t, i, sr.Val)
+	}
+	for _, si := range ro.List {
+		v, ok := rr.Status().Value(si.Address.String())
+		require.True(t, ok)
+		require.Equal(t, 1, v.(map[string]interface{})["Requests"])
+	}
+
+	_, _, err := c.SendToRoster(&Roster{}, "", "", nil)
+	require.NotNil(t, err)
+}
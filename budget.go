@@ -0,0 +1,145 @@
+// +build !js
+
+package onet
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+)
+
+// The resources of a ProtocolBudget, as given in BudgetExceededError.
+const (
+	BudgetDeadline = "deadline"
+	BudgetMessages = "messages"
+	BudgetBytes    = "bytes"
+)
+
+// ProtocolBudget is the execution budget of a protocol run, set by its
+// initiator with TreeNodeInstance.SetBudget. It is sent along with the
+// first message to every node of the tree, and each node aborts its
+// instance once it is exceeded. A zero value means no limit.
+type ProtocolBudget struct {
+	// Deadline is the wall-clock time at which the run is aborted on every
+	// node, so the clocks of the nodes should be synchronised.
+	Deadline time.Time
+	// MaxMessages limits the number of messages sent and received by the
+	// instance on each node.
+	MaxMessages uint64
+	// MaxBytes limits the size of the messages sent and received by the
+	// instance on each node.
+	MaxBytes uint64
+}
+
+// BudgetExceededError is returned by TreeNodeInstance.AbortError if the
+// instance was aborted because it exceeded its budget.
+type BudgetExceededError struct {
+	Protocol string
+	// Resource is one of BudgetDeadline, BudgetMessages or BudgetBytes
+	Resource string
+	// Limit and Used are the allowed and the used messages or bytes, or the
+	// deadline in nanoseconds since the epoch.
+	Limit uint64
+	Used  uint64
+}
+
+func (e *BudgetExceededError) Error() string {
+	if e.Resource == BudgetDeadline {
+		return fmt.Sprintf("%s: budget exceeded: deadline %s passed", e.Protocol,
+			time.Unix(0, int64(e.Limit)).Format(time.RFC3339Nano))
+	}
+	return fmt.Sprintf("%s: budget exceeded: %d %s out of %d", e.Protocol,
+		e.Used, e.Resource, e.Limit)
+}
+
+// SetBudget sets the execution budget of the protocol run. It must be
+// called on the root before sending the first message, so that the budget
+// is passed on to the other nodes.
+func (n *TreeNodeInstance) SetBudget(b *ProtocolBudget) {
+	n.usage.Lock()
+	defer n.usage.Unlock()
+	n.usage.budget = b
+	if n.usage.budgetTimer != nil {
+		n.usage.budgetTimer.Stop()
+		n.usage.budgetTimer = nil
+	}
+	if b.Deadline.IsZero() {
+		return
+	}
+	clock := n.Clock()
+	n.usage.budgetTimer = clock.AfterFunc(b.Deadline.Sub(clock.Now()), func() {
+		n.abort(&BudgetExceededError{
+			Protocol: n.ProtocolName(),
+			Resource: BudgetDeadline,
+			Limit:    uint64(b.Deadline.UnixNano()),
+		})
+	})
+}
+
+// Budget returns the execution budget of the protocol run, or nil if it
+// has none.
+func (n *TreeNodeInstance) Budget() *ProtocolBudget {
+	n.usage.Lock()
+	defer n.usage.Unlock()
+	return n.usage.budget
+}
+
+// spendBudget adds a message of the given size to the used budget. If this
+// exceeds the budget, the instance is aborted and false is returned.
+func (n *TreeNodeInstance) spendBudget(size uint64) bool {
+	n.usage.Lock()
+	if n.usage.aborted {
+		n.usage.Unlock()
+		return false
+	}
+	n.usage.messages++
+	n.usage.bytes += size
+	b := n.usage.budget
+	var err error
+	switch {
+	case b == nil:
+	case b.MaxMessages > 0 && n.usage.messages > b.MaxMessages:
+		err = &BudgetExceededError{Protocol: n.ProtocolName(), Resource: BudgetMessages,
+			Limit: b.MaxMessages, Used: n.usage.messages}
+	case b.MaxBytes > 0 && n.usage.bytes > b.MaxBytes:
+		err = &BudgetExceededError{Protocol: n.ProtocolName(), Resource: BudgetBytes,
+			Limit: b.MaxBytes, Used: n.usage.bytes}
+	}
+	n.usage.Unlock()
+	if err != nil {
+		n.abort(err)
+		return false
+	}
+	return true
+}
+
+// sendBudget sends the budget of the instance from to the node to, where
+// it is applied to the instance created for the following message.
+func (o *Overlay) sendBudget(from *Token, to *TreeNode, b *ProtocolBudget) (uint64, error) {
+	return o.server.Send(to.ServerIdentity, &BudgetMsg{*b, from.ChangeTreeNodeID(to.ID).ID()})
+}
+
+// handleBudgetMessage stores the budget until the instance it is for is
+// created.
+func (o *Overlay) handleBudgetMessage(env *network.Envelope) {
+	bm, ok := env.Msg.(*BudgetMsg)
+	if !ok {
+		log.Error(o.server.Address(), "wrong budget type")
+		return
+	}
+	o.pendingConfigsMut.Lock()
+	defer o.pendingConfigsMut.Unlock()
+	o.pendingBudgets[bm.Dest] = &bm.Budget
+}
+
+// getBudget returns the budget of the instance if present, and removes it
+// from the pending budgets.
+func (o *Overlay) getBudget(id TokenID) *ProtocolBudget {
+	o.pendingConfigsMut.Lock()
+	defer o.pendingConfigsMut.Unlock()
+	b := o.pendingBudgets[id]
+	delete(o.pendingBudgets, id)
+	return b
+}
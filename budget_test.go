@@ -0,0 +1,81 @@
+package onet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBudget_Messages(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	tni := newLimitedInstance(t, local, ProtocolLimits{})
+	tni.SetBudget(&ProtocolBudget{MaxMessages: 2})
+
+	require.True(t, tni.spendBudget(10))
+	require.True(t, tni.spendBudget(10))
+	require.False(t, tni.spendBudget(10))
+	waitAborted(t, tni)
+	err, ok := tni.AbortError().(*BudgetExceededError)
+	require.True(t, ok)
+	require.Equal(t, BudgetMessages, err.Resource)
+	require.Equal(t, uint64(2), err.Limit)
+	require.Equal(t, uint64(3), err.Used)
+	require.Equal(t, "ProtocolOverlay: budget exceeded: 3 messages out of 2", err.Error())
+	require.NotNil(t, tni.SendToChildren(&SimpleMessage{}))
+}
+
+func TestBudget_Bytes(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	tni := newLimitedInstance(t, local, ProtocolLimits{})
+	tni.SetBudget(&ProtocolBudget{MaxBytes: 100})
+
+	require.True(t, tni.spendBudget(60))
+	require.False(t, tni.spendBudget(60))
+	waitAborted(t, tni)
+	err, ok := tni.AbortError().(*BudgetExceededError)
+	require.True(t, ok)
+	require.Equal(t, BudgetBytes, err.Resource)
+	require.Equal(t, uint64(120), err.Used)
+}
+
+func TestBudget_Deadline(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	tni := newLimitedInstance(t, local, ProtocolLimits{})
+	require.Nil(t, tni.AbortError())
+	tni.SetBudget(&ProtocolBudget{Deadline: time.Now().Add(50 * time.Millisecond)})
+	waitAborted(t, tni)
+	err, ok := tni.AbortError().(*BudgetExceededError)
+	require.True(t, ok)
+	require.Equal(t, BudgetDeadline, err.Resource)
+}
+
+// The budget set on the root is applied on the other nodes.
+func TestBudget_Propagation(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	tni := newLimitedInstance(t, local, ProtocolLimits{})
+	budget := &ProtocolBudget{MaxMessages: 10, MaxBytes: 1e6}
+	tni.SetBudget(budget)
+	require.Nil(t, tni.SendToChildren(&SimpleMessage{1}))
+
+	child := local.Overlays[tni.Children()[0].ServerIdentity.ID]
+	for i := 0; i < 50; i++ {
+		child.instancesLock.Lock()
+		var got *ProtocolBudget
+		for _, c := range child.instances {
+			got = c.Budget()
+		}
+		child.instancesLock.Unlock()
+		if got != nil {
+			require.Equal(t, budget.MaxMessages, got.MaxMessages)
+			require.Equal(t, budget.MaxBytes, got.MaxBytes)
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("budget didn't reach the child")
+}
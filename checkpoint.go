@@ -0,0 +1,198 @@
+// +build !js
+
+package onet
+
+import (
+	"errors"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+)
+
+var checkpointBucket = []byte("onet_checkpoints")
+
+// Resumer is implemented by the protocols that can continue after a
+// restart of their server. Such a protocol saves its state with
+// TreeNodeInstance.Checkpoint whenever it progresses; when the server
+// starts again, the protocol is created anew, as for a message from
+// another node, and Resume gets the last state saved. It is called before
+// the instance gets any message.
+type Resumer interface {
+	Resume(state []byte) error
+}
+
+// storedCheckpoint is the last state saved by a protocol instance.
+type storedCheckpoint struct {
+	Token    *Token
+	Protocol string
+	Stored   int64
+	State    []byte
+}
+
+func init() {
+	network.RegisterMessage(&storedCheckpoint{})
+}
+
+// Checkpoint saves the state of the protocol in the database, replacing
+// the previous one, so that it can be resumed after a restart of the
+// server, see Resumer. The state is removed when the instance is Done.
+func (n *TreeNodeInstance) Checkpoint(state []byte) error {
+	sm := n.overlay.server.serviceManager
+	if sm == nil {
+		return errors.New("server has no database")
+	}
+	if pi := n.ProtocolInstance(); pi != nil {
+		if _, ok := pi.(Resumer); !ok {
+			return errors.New(n.ProtocolName() + " can't be resumed")
+		}
+	}
+	buf, err := network.Marshal(&storedCheckpoint{
+		Token:    n.token,
+		Protocol: n.ProtocolName(),
+		Stored:   n.Clock().Now().UnixNano(),
+		State:    state,
+	})
+	if err != nil {
+		return err
+	}
+	id := n.token.ID()
+	err = sm.dbUpdate(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(checkpointBucket)
+		if err != nil {
+			return err
+		}
+		return b.Put(id[:], buf)
+	})
+	if err == nil {
+		n.checkpointed = true
+	}
+	return err
+}
+
+// forgetCheckpoint removes the saved state of the instance, if it has one.
+func (o *Overlay) forgetCheckpoint(tni *TreeNodeInstance) {
+	if !tni.checkpointed || o.server.serviceManager == nil {
+		return
+	}
+	id := tni.token.ID()
+	err := o.server.serviceManager.dbUpdate(func(tx *bolt.Tx) error {
+		b := tx.Bucket(checkpointBucket)
+		if b == nil {
+			return nil
+		}
+		return b.Delete(id[:])
+	})
+	if err != nil {
+		log.Error("Couldn't remove checkpoint:", err)
+	}
+}
+
+// resumeProtocols creates the protocol instances that have a checkpoint
+// and resumes them. The checkpoints that can't be decoded, and those of
+// instances that can't be resumed, for example because their tree is
+// unknown, are removed.
+func (o *Overlay) resumeProtocols() {
+	var keys [][]byte
+	var stored []*storedCheckpoint
+	err := o.server.serviceManager.dbView(func(tx *bolt.Tx) error {
+		b := tx.Bucket(checkpointBucket)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			keys = append(keys, append([]byte{}, k...))
+			_, msg, err := network.Unmarshal(v, o.suite())
+			sc, ok := msg.(*storedCheckpoint)
+			if err == nil && (!ok || sc.Token == nil) {
+				err = errors.New("not a checkpoint")
+			}
+			if err != nil {
+				log.Error("Dropping invalid checkpoint:", err)
+				sc = nil
+			}
+			stored = append(stored, sc)
+			return nil
+		})
+	})
+	if err != nil {
+		log.Error("Couldn't read checkpoints:", err)
+		return
+	}
+	for i, sc := range stored {
+		if sc == nil {
+			o.deleteCheckpoint(keys[i])
+			continue
+		}
+		if err := o.resumeProtocol(sc); err != nil {
+			log.Error(o.server.Address(), "couldn't resume", sc.Protocol, ":", err)
+			o.server.RecordEvent(EventProtocolFailure, "resuming ", sc.Protocol, ": ", err)
+			o.deleteCheckpoint(keys[i])
+		}
+	}
+}
+
+// deleteCheckpoint removes the checkpoint stored under key.
+func (o *Overlay) deleteCheckpoint(key []byte) {
+	err := o.server.serviceManager.dbUpdate(func(tx *bolt.Tx) error {
+		return tx.Bucket(checkpointBucket).Delete(key)
+	})
+	if err != nil {
+		log.Error("Couldn't remove checkpoint:", err)
+	}
+}
+
+// resumeProtocol creates the instance of the checkpoint and resumes it.
+func (o *Overlay) resumeProtocol(sc *storedCheckpoint) error {
+	tok := sc.Token
+	o.instancesLock.Lock()
+	_, running := o.instances[tok.ID()]
+	o.instancesLock.Unlock()
+	if running {
+		return nil
+	}
+	tn, err := o.TreeNodeFromToken(tok)
+	if err != nil {
+		return err
+	}
+	tni := o.newTreeNodeInstanceFromToken(tn, tok, o.protoIO.getByName(sc.Protocol))
+	tni.checkpointed = true
+	pi, err := o.server.serviceManager.newProtocol(tni, nil)
+	if err == nil && pi == nil {
+		err = errors.New("no protocol instance")
+	}
+	if err != nil {
+		o.dropInstance(tok)
+		return err
+	}
+	r, ok := pi.(Resumer)
+	if !ok {
+		o.dropInstance(tok)
+		return errors.New("protocol can't be resumed")
+	}
+	if err := r.Resume(sc.State); err != nil {
+		o.dropInstance(tok)
+		return err
+	}
+	if err := o.RegisterProtocolInstance(pi); err != nil {
+		o.dropInstance(tok)
+		return err
+	}
+	go func() {
+		defer tni.recoverPanic("dispatching")
+		pi.Dispatch()
+	}()
+	log.Lvlf2("%s resumed %s from its checkpoint of %s", o.server.Address(),
+		sc.Protocol, time.Unix(0, sc.Stored))
+	return nil
+}
+
+// dropInstance removes an instance that couldn't be resumed, without
+// marking it as done, so that a message for it creates a new one.
+func (o *Overlay) dropInstance(tok *Token) {
+	o.instancesLock.Lock()
+	defer o.instancesLock.Unlock()
+	o.nodeDelete(tok)
+	delete(o.instancesInfo, tok.ID())
+}
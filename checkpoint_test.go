@@ -0,0 +1,82 @@
+package onet
+
+import (
+	"testing"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/satori/go.uuid.v1"
+)
+
+const resumeProtocolName = "ResumeProtocol"
+
+// resumeProtocol sends the states it resumes from to resumed.
+type resumeProtocol struct {
+	*TreeNodeInstance
+}
+
+var resumed = make(chan string, 1)
+
+func init() {
+	GlobalProtocolRegister(resumeProtocolName, func(n *TreeNodeInstance) (ProtocolInstance, error) {
+		return &resumeProtocol{n}, nil
+	})
+}
+
+func (p *resumeProtocol) Start() error {
+	return nil
+}
+
+func (p *resumeProtocol) Resume(state []byte) error {
+	resumed <- string(state)
+	return nil
+}
+
+func TestTreeNodeInstance_Checkpoint(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	servers, _, tree := local.GenTree(1, true)
+	s := servers[0]
+	o := s.overlay
+
+	pi, err := s.CreateProtocol(resumeProtocolName, tree)
+	require.Nil(t, err)
+	require.Nil(t, pi.(*resumeProtocol).Checkpoint([]byte("state")))
+	require.Equal(t, 1, storedCount(t, s, checkpointBucket))
+
+	// A restart loses the instance, which is resumed from its checkpoint
+	tok := pi.Token()
+	o.dropInstance(tok)
+	_, ok := o.TokenToNode(tok)
+	require.False(t, ok)
+	o.resumeProtocols()
+	select {
+	case state := <-resumed:
+		require.Equal(t, "state", state)
+	case <-time.After(time.Second):
+		t.Fatal("not resumed")
+	}
+	tni, ok := o.TokenToNode(tok)
+	require.True(t, ok)
+	require.Equal(t, 1, storedCount(t, s, checkpointBucket))
+	tni.Done()
+	require.Equal(t, 0, storedCount(t, s, checkpointBucket))
+
+	// Checkpoints of unknown trees are removed
+	pi, err = s.CreateProtocol(resumeProtocolName, tree)
+	require.Nil(t, err)
+	pi.Token().TreeID = TreeID(uuid.NewV4())
+	require.Nil(t, pi.(*resumeProtocol).Checkpoint([]byte("lost")))
+	o.resumeProtocols()
+	require.Equal(t, 0, storedCount(t, s, checkpointBucket))
+	require.Equal(t, 0, len(resumed))
+
+	// So are the checkpoints that can't be decoded
+	require.Nil(t, s.serviceManager.dbUpdate(func(tx *bolt.Tx) error {
+		return tx.Bucket(checkpointBucket).Put([]byte("invalid"), []byte("garbage"))
+	}))
+	require.Equal(t, 1, storedCount(t, s, checkpointBucket))
+	o.resumeProtocols()
+	require.Equal(t, 0, storedCount(t, s, checkpointBucket))
+}
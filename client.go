@@ -0,0 +1,366 @@
+package onet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+	"github.com/dedis/protobuf"
+	"github.com/gorilla/websocket"
+)
+
+// ErrServiceBusy is returned if a service already handles as many requests as
+// it allows and its queue is full. The websocket is closed with the error
+// code 4002, so that clients can retry later.
+var ErrServiceBusy = errors.New("service is busy")
+
+// wsBusyCode is the websocket close code for ErrServiceBusy.
+const wsBusyCode = 4002
+
+// wsInvalidCode is the websocket close code for a ValidationError.
+const wsInvalidCode = 4400
+
+// wsServiceErrorCode is the websocket close code after a ServiceError.
+const wsServiceErrorCode = 4500
+
+// timeoutHeader is the header with which Client.SendWithContext gives the
+// time left before the deadline of the request, as a time.Duration.
+const timeoutHeader = "Onet-Timeout"
+
+type destination struct {
+	si   *network.ServerIdentity
+	path string
+}
+
+// Client is a struct used to communicate with a remote Service running on a
+// onet.Server. Using Send it can connect to multiple remote Servers.
+type Client struct {
+	service  string
+	suite    network.Suite
+	balancer Balancer
+	// how to connect with wss, nil for ws
+	tls *clientTLS
+	// called in order by Send
+	interceptors []ClientInterceptor
+	// proxy, if set, gives the proxies of the connections
+	proxy network.ProxyFunc
+	// sharedPort is set if the websockets are on the ports of the servers
+	sharedPort bool
+
+	// whether to keep the connections, see SetPool
+	keep        bool
+	pool        map[destination]*connPool
+	poolCond    *sync.Cond
+	maxConns    int
+	idleTimeout time.Duration
+	rx          uint64
+	tx          uint64
+	sync.Mutex
+}
+
+// NewClient returns a client using the service s. On the first Send, the
+// connection will be started, until Close is called.
+func NewClient(suite network.Suite, s string) *Client {
+	return &Client{
+		service: s,
+		suite:   suite,
+	}
+}
+
+// NewClientKeep returns a Client that doesn't close the connection between
+// two messages if it's the same server. It opens up to DefaultPoolSize
+// connections to an endpoint for parallel requests, see SetPool.
+func NewClientKeep(suite network.Suite, s string) *Client {
+	return &Client{
+		service:  s,
+		keep:     true,
+		maxConns: DefaultPoolSize,
+		suite:    suite,
+	}
+}
+
+// SetProxy makes the client connect through the proxies returned by proxy,
+// for example network.ProxyFromEnvironment.
+func (c *Client) SetProxy(proxy network.ProxyFunc) {
+	c.Lock()
+	c.proxy = proxy
+	c.Unlock()
+}
+
+// SetSharedPort makes the client connect to the websockets on the ports of
+// the servers, for servers started with ServerOptions.SharedPort.
+func (c *Client) SetSharedPort(shared bool) {
+	c.Lock()
+	c.sharedPort = shared
+	c.Unlock()
+}
+
+// Suite returns the cryptographic suite in use on this connection.
+func (c *Client) Suite() network.Suite {
+	return c.suite
+}
+
+// Send will marshal the message into a ClientRequest message and send it.
+func (c *Client) Send(dst *network.ServerIdentity, path string, buf []byte) ([]byte, error) {
+	return c.SendWithContext(context.Background(), dst, path, buf)
+}
+
+// SendWithContext is like Send, but stops waiting for the reply once ctx is
+// done, and then returns ctx.Err(). The deadline of ctx is given to the
+// server, which cancels the context of the handler when it is exceeded. A
+// request with a context that can be done uses its own connection.
+func (c *Client) SendWithContext(ctx context.Context, dst *network.ServerIdentity, path string, buf []byte) ([]byte, error) {
+	c.Lock()
+	interceptors := c.interceptors
+	c.Unlock()
+	req := &ClientRequest{
+		Destination: dst,
+		Service:     c.service,
+		Path:        path,
+		Header:      make(http.Header),
+		Payload:     buf,
+		Context:     ctx,
+	}
+	return chainInterceptors(interceptors, c.send)(req)
+}
+
+// send is the last step of Send, after all interceptors.
+func (c *Client) send(req *ClientRequest) ([]byte, error) {
+	if req.Context != nil && req.Context.Done() != nil {
+		return c.sendContext(req)
+	}
+	conn, err := c.take(req)
+	if err != nil {
+		return nil, err
+	}
+	log.Lvlf4("Sending %x to %s/%s/%s", req.Payload, req.Destination.Address,
+		req.Service, req.Path)
+	if err := conn.WriteMessage(websocket.BinaryMessage, req.Payload); err != nil {
+		c.giveBack(conn, true)
+		return nil, err
+	}
+	rcv, err := readReply(conn.clientConn)
+	c.giveBack(conn, err != nil)
+	if err != nil {
+		return nil, err
+	}
+	log.Lvlf4("Received %x", rcv)
+	c.Lock()
+	c.tx += uint64(len(req.Payload))
+	c.rx += uint64(len(rcv))
+	c.Unlock()
+	return rcv, nil
+}
+
+// sendContext sends a request that can be cancelled. It doesn't use the
+// kept connections, as the deadline is sent in the header of the connection
+// and cancelling closes it.
+func (c *Client) sendContext(req *ClientRequest) ([]byte, error) {
+	ctx := req.Context
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if dl, ok := ctx.Deadline(); ok {
+		if req.Header == nil {
+			req.Header = make(http.Header)
+		}
+		req.Header.Set(timeoutHeader, dl.Sub(time.Now()).String())
+	}
+	c.Lock()
+	conn, err := c.dial(req)
+	c.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	done := make(chan struct{})
+	defer func() {
+		close(done)
+		closeWebsocket(conn)
+	}()
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	if err := conn.WriteMessage(websocket.BinaryMessage, req.Payload); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	rcv, err := readReply(conn)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	c.Lock()
+	c.tx += uint64(len(req.Payload))
+	c.rx += uint64(len(rcv))
+	c.Unlock()
+	return rcv, nil
+}
+
+// dial opens a websocket to the service and path of the request. The
+// caller must hold the lock.
+func (c *Client) dial(req *ClientRequest) (clientConn, error) {
+	url, err := getWebAddress(req.Destination, false)
+	if err != nil {
+		return nil, err
+	}
+	if c.sharedPort {
+		url = req.Destination.Address.NetworkAddress()
+	}
+	tlsConf := c.tlsConfig(req.Destination, req.Destination.Address.Host())
+	scheme, origin := "ws", "http"
+	if tlsConf != nil {
+		scheme, origin = "wss", "https"
+	}
+	var conn clientConn
+	// Re-try to connect in case the websocket is just about to start
+	for a := 0; a < network.MaxRetryConnect; a++ {
+		header := http.Header{"Origin": []string{origin + "://" + url}}
+		for k, v := range req.Header {
+			header[k] = v
+		}
+		conn, err = dialWebsocket(fmt.Sprintf("%s://%s/%s/%s", scheme, url, req.Service, req.Path),
+			header, tlsConf, c.proxy)
+		if err == nil {
+			break
+		}
+		time.Sleep(network.WaitRetry)
+	}
+	return conn, err
+}
+
+// wsError returns the error sent by the server when it closed the
+// websocket.
+func wsError(err error) error {
+	if websocket.IsCloseError(err, wsBusyCode) {
+		return ErrServiceBusy
+	}
+	if ce, ok := err.(*websocket.CloseError); ok && ce.Code == wsInvalidCode {
+		if ve := parseValidationError(ce.Text); ve != nil {
+			return ve
+		}
+	}
+	return err
+}
+
+// SendProtobuf wraps protobuf.(En|De)code over the Client.Send-function. It
+// takes the destination, a pointer to a msg-structure that will be
+// protobuf-encoded and sent over the websocket. If ret is non-nil, it
+// has to be a pointer to the struct that is sent back to the
+// client. If there is no error, the ret-structure is filled with the
+// data from the service.
+func (c *Client) SendProtobuf(dst *network.ServerIdentity, msg interface{}, ret interface{}) error {
+	return c.SendProtobufWithContext(context.Background(), dst, msg, ret)
+}
+
+// SendProtobufWithContext is like SendProtobuf, but the request is
+// cancelled with ctx, as with SendWithContext.
+func (c *Client) SendProtobufWithContext(ctx context.Context, dst *network.ServerIdentity, msg interface{}, ret interface{}) error {
+	buf, err := protobuf.Encode(msg)
+	if err != nil {
+		return err
+	}
+	path := strings.Split(reflect.TypeOf(msg).String(), ".")[1]
+	reply, err := c.SendWithContext(ctx, dst, path, buf)
+	if err != nil {
+		return err
+	}
+	if ret != nil {
+		return protobuf.DecodeWithConstructors(reply, ret,
+			network.DefaultConstructors(c.suite))
+	}
+	return nil
+}
+
+// SendToAll sends a message to all ServerIdentities of the Roster and returns
+// all errors encountered concatenated together as a string.
+func (c *Client) SendToAll(dst *Roster, path string, buf []byte) ([][]byte, error) {
+	msgs := make([][]byte, len(dst.List))
+	var errstrs []string
+	for i, e := range dst.List {
+		var err error
+		msgs[i], err = c.Send(e, path, buf)
+		if err != nil {
+			errstrs = append(errstrs, fmt.Sprint(e.String(), err.Error()))
+		}
+	}
+	var err error
+	if len(errstrs) > 0 {
+		err = errors.New(strings.Join(errstrs, "\n"))
+	}
+	return msgs, err
+}
+
+// Close sends a close-command to all open connections and returns nil if no
+// errors occurred or all errors encountered concatenated together as a string.
+// The connections in use are closed at the end of their request.
+func (c *Client) Close() error {
+	c.Lock()
+	defer c.Unlock()
+	var errstrs []string
+	for _, p := range c.pool {
+		for _, pc := range p.idle {
+			if pc.timer != nil {
+				pc.timer.Stop()
+			}
+			if err := closeWebsocket(pc.clientConn); err != nil {
+				errstrs = append(errstrs, err.Error())
+			}
+		}
+	}
+	c.pool = nil
+	c.poolChanged().Broadcast()
+	var err error
+	if len(errstrs) > 0 {
+		err = errors.New(strings.Join(errstrs, "\n"))
+	}
+	return err
+}
+
+// Tx returns the number of bytes transmitted by this Client. It implements
+// the monitor.CounterIOMeasure interface.
+func (c *Client) Tx() uint64 {
+	c.Lock()
+	defer c.Unlock()
+	return c.tx
+}
+
+// Rx returns the number of bytes read by this Client. It implements
+// the monitor.CounterIOMeasure interface.
+func (c *Client) Rx() uint64 {
+	c.Lock()
+	defer c.Unlock()
+	return c.rx
+}
+
+// getWebAddress returns the host:port+1 of the serverIdentity. If
+// global is true, the host is left empty, so that it listens on all IPv4 and
+// IPv6 addresses.
+func getWebAddress(si *network.ServerIdentity, global bool) (string, error) {
+	p, err := strconv.Atoi(si.Address.Port())
+	if err != nil {
+		return "", err
+	}
+	host := si.Address.Host()
+	if global {
+		host = ""
+	}
+	return net.JoinHostPort(host, strconv.Itoa(p+1)), nil
+}
@@ -0,0 +1,11 @@
+package onet
+
+// clientConn is the websocket of a Client. Natively it is a
+// *websocket.Conn; in the browser it is the WebSocket of JavaScript, see
+// clientconn_js.go. The message types and the close errors are the ones of
+// github.com/gorilla/websocket in both cases.
+type clientConn interface {
+	ReadMessage() (messageType int, p []byte, err error)
+	WriteMessage(messageType int, data []byte) error
+	Close() error
+}
@@ -0,0 +1,152 @@
+// +build js,wasm
+
+package onet
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"sync"
+	"syscall/js"
+
+	"github.com/dedis/onet/network"
+	"github.com/gorilla/websocket"
+)
+
+// jsConn is a WebSocket of the browser. The callbacks of JavaScript must not
+// block, so the messages are queued until ReadMessage takes them.
+type jsConn struct {
+	ws    js.Value
+	funcs []js.Func
+	sync.Mutex
+	queue []jsMessage
+	// err is the error of the connection once it is closed
+	err   error
+	ready chan struct{}
+}
+
+type jsMessage struct {
+	mt  int
+	buf []byte
+}
+
+// dialWebsocket opens a WebSocket of the browser to url. The browser sets
+// the header and handles TLS and proxies itself, so header, tlsConf and
+// proxy are not used: the headers of the interceptors and the timeout of
+// SendWithContext are not sent, and public keys can't be pinned.
+func dialWebsocket(url string, header http.Header, tlsConf *tls.Config,
+	proxy network.ProxyFunc) (clientConn, error) {
+	ctor := js.Global().Get("WebSocket")
+	if ctor.IsUndefined() {
+		return nil, errors.New("no WebSocket in this JavaScript environment")
+	}
+	c := &jsConn{ws: ctor.New(url), ready: make(chan struct{}, 1)}
+	c.ws.Set("binaryType", "arraybuffer")
+	opened := make(chan bool, 1)
+	c.on("open", func(js.Value) {
+		opened <- true
+	})
+	c.on("message", func(ev js.Value) {
+		data := ev.Get("data")
+		if data.Type() == js.TypeString {
+			c.push(jsMessage{websocket.TextMessage, []byte(data.String())}, nil)
+			return
+		}
+		arr := js.Global().Get("Uint8Array").New(data)
+		buf := make([]byte, arr.Get("length").Int())
+		js.CopyBytesToGo(buf, arr)
+		c.push(jsMessage{websocket.BinaryMessage, buf}, nil)
+	})
+	c.on("close", func(ev js.Value) {
+		c.push(jsMessage{}, &websocket.CloseError{
+			Code: ev.Get("code").Int(),
+			Text: ev.Get("reason").String(),
+		})
+		select {
+		case opened <- false:
+		default:
+		}
+		for _, f := range c.funcs {
+			f.Release()
+		}
+	})
+	if !<-opened {
+		_, _, err := c.ReadMessage()
+		return nil, err
+	}
+	return c, nil
+}
+
+// on sets the handler of an event of the WebSocket.
+func (c *jsConn) on(event string, fn func(ev js.Value)) {
+	f := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		fn(args[0])
+		return nil
+	})
+	c.funcs = append(c.funcs, f)
+	c.ws.Set("on"+event, f)
+}
+
+// push queues a message, or the error closing the connection if err is
+// set.
+func (c *jsConn) push(m jsMessage, err error) {
+	c.Lock()
+	if err != nil {
+		c.err = err
+	} else {
+		c.queue = append(c.queue, m)
+	}
+	c.Unlock()
+	select {
+	case c.ready <- struct{}{}:
+	default:
+	}
+}
+
+// ReadMessage returns the next message, or the close error once all
+// messages are read.
+func (c *jsConn) ReadMessage() (int, []byte, error) {
+	for {
+		c.Lock()
+		if len(c.queue) > 0 {
+			m := c.queue[0]
+			c.queue = c.queue[1:]
+			c.Unlock()
+			return m.mt, m.buf, nil
+		}
+		err := c.err
+		c.Unlock()
+		if err != nil {
+			return 0, nil, err
+		}
+		<-c.ready
+	}
+}
+
+// WriteMessage sends a text or binary message. A close message does
+// nothing, the WebSocket sends it in Close.
+func (c *jsConn) WriteMessage(mt int, data []byte) error {
+	c.Lock()
+	err := c.err
+	c.Unlock()
+	if err != nil {
+		return err
+	}
+	switch mt {
+	case websocket.CloseMessage:
+		return nil
+	case websocket.TextMessage:
+		c.ws.Call("send", string(data))
+	default:
+		arr := js.Global().Get("Uint8Array").New(len(data))
+		js.CopyBytesToJS(arr, data)
+		c.ws.Call("send", arr)
+	}
+	return nil
+}
+
+// Close closes the WebSocket.
+func (c *jsConn) Close() error {
+	c.ws.Call("close")
+	return nil
+}
@@ -0,0 +1,29 @@
+// +build !js
+
+package onet
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+
+	"github.com/dedis/onet/network"
+	"github.com/gorilla/websocket"
+)
+
+// dialWebsocket opens a websocket to url, with the given header. If proxy
+// is set, the connection goes through the proxy it returns.
+func dialWebsocket(url string, header http.Header, tlsConf *tls.Config,
+	proxy network.ProxyFunc) (clientConn, error) {
+	d := &websocket.Dialer{TLSClientConfig: tlsConf}
+	if proxy != nil {
+		d.NetDial = func(netw, addr string) (net.Conn, error) {
+			return network.DialProxy(netw, addr, proxy)
+		}
+	}
+	conn, _, err := d.Dial(url, header)
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
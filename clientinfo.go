@@ -0,0 +1,132 @@
+// +build !js
+
+package onet
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+	"time"
+
+	"github.com/dedis/onet/log"
+	"github.com/gorilla/websocket"
+)
+
+// ClientInfo describes the client of a websocket request. The handlers
+// taking a context.Context get it with ClientFromContext.
+type ClientInfo struct {
+	// RemoteAddr is the address of the client, as given by net/http.
+	RemoteAddr string
+	// Service and Path are the endpoint called by the client.
+	Service string
+	Path    string
+	// Certificates are the certificates given by the client over TLS, if
+	// any.
+	Certificates []*x509.Certificate
+}
+
+type clientInfoKey struct{}
+
+// ClientFromContext returns the client of the request handled with ctx.
+func ClientFromContext(ctx context.Context) (*ClientInfo, bool) {
+	ci, ok := ctx.Value(clientInfoKey{}).(*ClientInfo)
+	return ci, ok
+}
+
+// SetRequestTimeout sets the deadline of the context given to the handlers
+// of the services, counted from the arrival of the request. A handler that
+// keeps computing after it should stop and return ctx.Err(). A timeout of
+// 0, the default, sets no deadline. Streams are not limited.
+func (c *Server) SetRequestTimeout(d time.Duration) {
+	c.websocket.Lock()
+	defer c.websocket.Unlock()
+	c.websocket.requestTimeout = d
+}
+
+// connContext returns the context of a websocket connection. It is
+// cancelled when the connection ends or the server stops.
+func (t wsHandler) connContext(r *http.Request) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(r.Context())
+	if t.ws != nil {
+		go func() {
+			select {
+			case <-t.ws.shutdown:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+	return ctx, cancel
+}
+
+// requestContext returns the context of one request of the connection,
+// with the client, and with the deadline of the request if withTimeout is
+// set. Streams have no deadline, unless the client gave one in the
+// timeoutHeader: the earliest of both is used.
+func (t wsHandler) requestContext(ctx context.Context, r *http.Request,
+	path string, withTimeout bool) (context.Context, context.CancelFunc) {
+	ci := &ClientInfo{
+		RemoteAddr: r.RemoteAddr,
+		Service:    t.serviceName,
+		Path:       path,
+	}
+	if r.TLS != nil {
+		ci.Certificates = r.TLS.PeerCertificates
+	}
+	ctx = context.WithValue(ctx, clientInfoKey{}, ci)
+	var timeout time.Duration
+	if t.ws != nil && withTimeout {
+		t.ws.Lock()
+		timeout = t.ws.requestTimeout
+		t.ws.Unlock()
+	}
+	if h := r.Header.Get(timeoutHeader); h != "" {
+		ct, err := time.ParseDuration(h)
+		if err != nil {
+			log.Lvl2("Invalid timeout from", r.RemoteAddr, ":", h)
+		} else {
+			if ct <= 0 {
+				// The deadline passed on the way.
+				ct = time.Nanosecond
+			}
+			if timeout == 0 || ct < timeout {
+				timeout = ct
+			}
+		}
+	}
+	if timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// wsMessage is a message read from a websocket, or the error that ended it.
+type wsMessage struct {
+	mt  int
+	buf []byte
+	err error
+}
+
+// readMessages reads the messages of the client in the background, so that
+// a disconnection is noticed while a request is processed: then cancel is
+// called. The reading stops once ctx is done.
+func readMessages(ctx context.Context, ws *websocket.Conn, cancel context.CancelFunc) <-chan wsMessage {
+	msgs := make(chan wsMessage)
+	go func() {
+		for {
+			mt, buf, err := ws.ReadMessage()
+			if err != nil {
+				cancel()
+			}
+			select {
+			case msgs <- wsMessage{mt, buf, err}:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return msgs
+}
@@ -0,0 +1,146 @@
+package onet
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+	"github.com/stretchr/testify/require"
+)
+
+const ctxServiceName = "ctxService"
+
+// ctxService waits for the context of the request to be done, and passes
+// the client and the error of the context on.
+type ctxService struct {
+	started chan *ClientInfo
+	done    chan error
+}
+
+func (cs *ctxService) ProcessClientRequest(req *http.Request, path string, buf []byte) ([]byte, error) {
+	ctx := req.Context()
+	ci, _ := ClientFromContext(ctx)
+	cs.started <- ci
+	select {
+	case <-ctx.Done():
+	case <-time.After(10 * time.Second):
+	}
+	cs.done <- ctx.Err()
+	return nil, ctx.Err()
+}
+
+func (cs *ctxService) NewProtocol(tn *TreeNodeInstance, conf *GenericConfig) (ProtocolInstance, error) {
+	return nil, nil
+}
+
+func (cs *ctxService) Process(env *network.Envelope) {
+}
+
+func registerCtxService(t *testing.T) *ctxService {
+	cs := &ctxService{make(chan *ClientInfo, 1), make(chan error, 1)}
+	_, err := RegisterNewService(ctxServiceName, func(c *Context) (Service, error) {
+		return cs, nil
+	})
+	log.ErrFatal(err)
+	return cs
+}
+
+func TestServer_SetRequestTimeout(t *testing.T) {
+	cs := registerCtxService(t)
+	defer UnregisterService(ctxServiceName)
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	server := local.GenServers(1)[0]
+	server.SetRequestTimeout(50 * time.Millisecond)
+
+	_, err := NewClient(tSuite, ctxServiceName).Send(server.ServerIdentity, "wait", nil)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "deadline exceeded")
+	ci := <-cs.started
+	require.Equal(t, ctxServiceName, ci.Service)
+	require.Equal(t, "wait", ci.Path)
+	require.NotEqual(t, "", ci.RemoteAddr)
+	require.NotNil(t, <-cs.done)
+}
+
+func TestWebSocket_CancelOnStop(t *testing.T) {
+	cs := registerCtxService(t)
+	defer UnregisterService(ctxServiceName)
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	server := local.GenServers(1)[0]
+
+	go NewClient(tSuite, ctxServiceName).Send(server.ServerIdentity, "wait", nil)
+	<-cs.started
+	server.websocket.stop()
+	select {
+	case err := <-cs.done:
+		require.NotNil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the request has not been cancelled")
+	}
+}
+
+func TestWsHandler_RequestContextTimeout(t *testing.T) {
+	r := httptest.NewRequest("GET", "/ctxService/wait", nil)
+	r.Header.Set(timeoutHeader, "1h")
+	wsh := wsHandler{ws: &WebSocket{requestTimeout: time.Minute}}
+	ctx, cancel := wsh.requestContext(context.Background(), r, "wait", true)
+	defer cancel()
+	dl, ok := ctx.Deadline()
+	require.True(t, ok)
+	require.True(t, dl.Sub(time.Now()) <= time.Minute)
+
+	ctx, cancel = wsh.requestContext(context.Background(), r, "wait", false)
+	defer cancel()
+	dl, ok = ctx.Deadline()
+	require.True(t, ok)
+	require.True(t, dl.Sub(time.Now()) > time.Minute)
+
+	r.Header.Set(timeoutHeader, "-1s")
+	ctx, cancel = wsh.requestContext(context.Background(), r, "wait", false)
+	defer cancel()
+	<-ctx.Done()
+
+	r.Header.Set(timeoutHeader, "soon")
+	ctx, cancel = wsh.requestContext(context.Background(), r, "wait", false)
+	defer cancel()
+	_, ok = ctx.Deadline()
+	require.False(t, ok)
+}
+
+func TestClient_SendWithContext(t *testing.T) {
+	cs := registerCtxService(t)
+	defer UnregisterService(ctxServiceName)
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	server := local.GenServers(1)[0]
+	client := NewClient(tSuite, ctxServiceName)
+
+	// The deadline is passed to the handler.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := client.SendWithContext(ctx, server.ServerIdentity, "wait", nil)
+	require.Equal(t, context.DeadlineExceeded, err)
+	<-cs.started
+	require.Equal(t, context.DeadlineExceeded, <-cs.done)
+
+	// Cancelling stops the wait of the client and the handler.
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		<-cs.started
+		cancel()
+	}()
+	_, err = client.SendWithContext(ctx, server.ServerIdentity, "wait", nil)
+	require.Equal(t, context.Canceled, err)
+	select {
+	case err := <-cs.done:
+		require.NotNil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the request has not been cancelled on the server")
+	}
+}
@@ -0,0 +1,128 @@
+package onet
+
+import (
+	"sync"
+	"time"
+
+	"github.com/dedis/onet/log"
+	"github.com/gorilla/websocket"
+)
+
+// DefaultPoolSize is the maximum number of connections a Client returned
+// by NewClientKeep opens to the same endpoint.
+const DefaultPoolSize = 4
+
+// connPool holds the connections of a Client to one endpoint.
+type connPool struct {
+	idle []*pooledConn
+	// open counts the idle connections and the ones in use
+	open int
+}
+
+// pooledConn is a connection of a connPool.
+type pooledConn struct {
+	clientConn
+	dest destination
+	pool *connPool
+	// timer closes the connection once it is idle for too long
+	timer *time.Timer
+}
+
+// SetPool makes the client keep its connections to reuse them for later
+// requests to the same endpoint, as with NewClientKeep. At most maxConns
+// connections are opened to an endpoint, further requests wait for one of
+// them to be free. A connection that is not used for idleTimeout is closed.
+// A maxConns or idleTimeout of 0 means no limit.
+func (c *Client) SetPool(maxConns int, idleTimeout time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+	c.keep = true
+	c.maxConns = maxConns
+	c.idleTimeout = idleTimeout
+	c.poolChanged().Broadcast()
+}
+
+// poolChanged returns the condition signalled when a connection is given
+// back. The caller must hold the lock.
+func (c *Client) poolChanged() *sync.Cond {
+	if c.poolCond == nil {
+		c.poolCond = sync.NewCond(&c.Mutex)
+	}
+	return c.poolCond
+}
+
+// take returns a connection for the request: an idle one if there is one,
+// else a new one if the limit allows it. Otherwise it waits for a
+// connection to be given back.
+func (c *Client) take(req *ClientRequest) (*pooledConn, error) {
+	dest := destination{req.Destination, req.Service + "/" + req.Path}
+	c.Lock()
+	defer c.Unlock()
+	for {
+		if c.pool == nil {
+			c.pool = make(map[destination]*connPool)
+		}
+		p := c.pool[dest]
+		if p == nil {
+			p = &connPool{}
+			c.pool[dest] = p
+		}
+		if n := len(p.idle); n > 0 {
+			pc := p.idle[n-1]
+			p.idle = p.idle[:n-1]
+			if pc.timer != nil {
+				pc.timer.Stop()
+			}
+			return pc, nil
+		}
+		if c.maxConns <= 0 || p.open < c.maxConns {
+			log.Lvlf4("Opening connection to %s/%s", dest.si.Address, dest.path)
+			conn, err := c.dial(req)
+			if err != nil {
+				return nil, err
+			}
+			p.open++
+			return &pooledConn{clientConn: conn, dest: dest, pool: p}, nil
+		}
+		c.poolChanged().Wait()
+	}
+}
+
+// giveBack returns a connection to its pool after a request. It is closed
+// instead if the request failed, if the client doesn't keep its
+// connections, or if the client has been closed in the meantime.
+func (c *Client) giveBack(pc *pooledConn, failed bool) {
+	c.Lock()
+	defer c.Unlock()
+	defer c.poolChanged().Broadcast()
+	if failed || !c.keep || c.pool[pc.dest] != pc.pool {
+		pc.pool.open--
+		closeWebsocket(pc.clientConn)
+		return
+	}
+	pc.pool.idle = append(pc.pool.idle, pc)
+	if c.idleTimeout > 0 {
+		pc.timer = time.AfterFunc(c.idleTimeout, func() { c.expire(pc) })
+	}
+}
+
+// expire closes a connection that was idle for too long.
+func (c *Client) expire(pc *pooledConn) {
+	c.Lock()
+	defer c.Unlock()
+	for i, idle := range pc.pool.idle {
+		if idle == pc {
+			pc.pool.idle = append(pc.pool.idle[:i], pc.pool.idle[i+1:]...)
+			pc.pool.open--
+			closeWebsocket(pc.clientConn)
+			c.poolChanged().Broadcast()
+			return
+		}
+	}
+}
+
+// closeWebsocket sends a close-command and closes the connection.
+func closeWebsocket(conn clientConn) error {
+	conn.WriteMessage(websocket.CloseMessage, nil)
+	return conn.Close()
+}
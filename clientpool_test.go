@@ -0,0 +1,101 @@
+package onet
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dedis/onet/log"
+	"github.com/dedis/protobuf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// poolStatus returns the number of open and idle connections of the client
+// to the endpoint.
+func poolStatus(c *Client, dest destination) (open, idle int) {
+	c.Lock()
+	defer c.Unlock()
+	if p := c.pool[dest]; p != nil {
+		return p.open, len(p.idle)
+	}
+	return 0, 0
+}
+
+func TestClient_Pool(t *testing.T) {
+	_, err := RegisterNewService(dummyService3Name, func(c *Context) (Service, error) {
+		return &DummyService3{}, nil
+	})
+	log.ErrFatal(err)
+	defer UnregisterService(dummyService3Name)
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	server := local.GenServers(1)[0]
+
+	client := NewClient(tSuite, dummyService3Name)
+	client.SetPool(2, time.Hour)
+	msg, err := protobuf.Encode(&DummyMsg{})
+	require.Nil(t, err)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := client.Send(server.ServerIdentity, "path1", msg)
+			assert.Nil(t, err)
+			assert.Equal(t, "path1", string(resp))
+		}()
+	}
+	wg.Wait()
+	dest := destination{server.ServerIdentity, dummyService3Name + "/path1"}
+	open, idle := poolStatus(client, dest)
+	require.True(t, open >= 1 && open <= 2, "%d connections", open)
+	require.Equal(t, open, idle)
+
+	require.Nil(t, client.Close())
+	open, _ = poolStatus(client, dest)
+	require.Equal(t, 0, open)
+}
+
+func TestClient_PoolIdleTimeout(t *testing.T) {
+	_, err := RegisterNewService(dummyService3Name, func(c *Context) (Service, error) {
+		return &DummyService3{}, nil
+	})
+	log.ErrFatal(err)
+	defer UnregisterService(dummyService3Name)
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	server := local.GenServers(1)[0]
+
+	client := NewClient(tSuite, dummyService3Name)
+	client.SetPool(0, 50*time.Millisecond)
+	msg, err := protobuf.Encode(&DummyMsg{})
+	require.Nil(t, err)
+	_, err = client.Send(server.ServerIdentity, "path1", msg)
+	require.Nil(t, err)
+	dest := destination{server.ServerIdentity, dummyService3Name + "/path1"}
+	open, _ := poolStatus(client, dest)
+	require.Equal(t, 1, open)
+	for i := 0; i < 50 && open > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+		open, _ = poolStatus(client, dest)
+	}
+	require.Equal(t, 0, open)
+}
+
+func TestClient_NoPool(t *testing.T) {
+	_, err := RegisterNewService(dummyService3Name, func(c *Context) (Service, error) {
+		return &DummyService3{}, nil
+	})
+	log.ErrFatal(err)
+	defer UnregisterService(dummyService3Name)
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	server := local.GenServers(1)[0]
+
+	client := NewClient(tSuite, dummyService3Name)
+	_, err = client.Send(server.ServerIdentity, "path1", nil)
+	require.Nil(t, err)
+	open, _ := poolStatus(client, destination{server.ServerIdentity, dummyService3Name + "/path1"})
+	require.Equal(t, 0, open)
+}
@@ -0,0 +1,123 @@
+package onet
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/dedis/onet/network"
+	"github.com/dedis/protobuf"
+	"github.com/gorilla/websocket"
+)
+
+// sessionPath is the path of the session endpoint of every service.
+const sessionPath = "session"
+
+// SessionSubscribe is sent by the client of a session to subscribe to a
+// stream of the service, or to unsubscribe from it. The events after Cursor
+// are sent, 0 for all events in the backlog of the stream.
+type SessionSubscribe struct {
+	Stream      string
+	Cursor      uint64
+	Unsubscribe bool
+}
+
+// SessionEvent is pushed by the server to the client of a session. Data is
+// the protobuf-encoded message published on the stream. If Error is set,
+// the subscription to Stream has been stopped by the server, for example
+// because the cursor expired or the client was too slow. The client can
+// subscribe again with the cursor of the last event it got.
+type SessionEvent struct {
+	Stream string
+	Cursor uint64
+	Data   []byte
+	Error  string
+}
+
+// Session is a persistent connection to a service, on which the server
+// pushes the events of the subscribed streams.
+type Session struct {
+	conn   clientConn
+	client *Client
+}
+
+// Session opens a persistent connection to the service on dst. It must be
+// closed once done. The service only accepts the subscriptions allowed by
+// its SessionAuthorizer.
+func (c *Client) Session(dst *network.ServerIdentity) (*Session, error) {
+	c.Lock()
+	defer c.Unlock()
+	conn, err := c.dial(&ClientRequest{
+		Destination: dst,
+		Service:     c.service,
+		Path:        sessionPath,
+		Header:      make(http.Header),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Session{conn: conn, client: c}, nil
+}
+
+// Subscribe asks for the events of stream after cursor, 0 for all events
+// in the backlog of the stream. Subscribing again to a stream replaces the
+// former subscription.
+func (s *Session) Subscribe(stream string, cursor uint64) error {
+	return s.write(&SessionSubscribe{Stream: stream, Cursor: cursor})
+}
+
+// Unsubscribe stops the events of stream. Events that were already sent by
+// the server can still be read.
+func (s *Session) Unsubscribe(stream string) error {
+	return s.write(&SessionSubscribe{Stream: stream, Unsubscribe: true})
+}
+
+func (s *Session) write(req *SessionSubscribe) error {
+	buf, err := protobuf.Encode(req)
+	if err != nil {
+		return err
+	}
+	if err := s.conn.WriteMessage(websocket.BinaryMessage, buf); err != nil {
+		return err
+	}
+	s.client.Lock()
+	s.client.tx += uint64(len(buf))
+	s.client.Unlock()
+	return nil
+}
+
+// Read waits for the next event pushed by the server.
+func (s *Session) Read() (*SessionEvent, error) {
+	_, buf, err := s.conn.ReadMessage()
+	if err != nil {
+		return nil, wsError(err)
+	}
+	s.client.Lock()
+	s.client.rx += uint64(len(buf))
+	s.client.Unlock()
+	ev := &SessionEvent{}
+	if err := protobuf.Decode(buf, ev); err != nil {
+		return nil, err
+	}
+	return ev, nil
+}
+
+// ReadMessage waits for the next event and decodes its data into ret,
+// which must be a pointer to the published struct. It returns the stream
+// and cursor of the event. If the server stopped the subscription, the
+// error of the event is returned.
+func (s *Session) ReadMessage(ret interface{}) (string, uint64, error) {
+	ev, err := s.Read()
+	if err != nil {
+		return "", 0, err
+	}
+	if ev.Error != "" {
+		return ev.Stream, ev.Cursor, errors.New(ev.Error)
+	}
+	return ev.Stream, ev.Cursor, protobuf.DecodeWithConstructors(ev.Data, ret,
+		network.DefaultConstructors(s.client.suite))
+}
+
+// Close ends the session and all its subscriptions.
+func (s *Session) Close() error {
+	return s.conn.Close()
+}
@@ -0,0 +1,74 @@
+package onet
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/dedis/onet/network"
+	"github.com/dedis/protobuf"
+	"github.com/gorilla/websocket"
+)
+
+// StreamingConn is the client side of a streaming endpoint.
+type StreamingConn struct {
+	conn   clientConn
+	client *Client
+}
+
+// Stream sends the request in buf to the streaming endpoint path of dst.
+// The replies are then read from the returned StreamingConn, which must be
+// closed once done.
+func (c *Client) Stream(dst *network.ServerIdentity, path string, buf []byte) (*StreamingConn, error) {
+	c.Lock()
+	conn, err := c.dial(&ClientRequest{
+		Destination: dst,
+		Service:     c.service,
+		Path:        path,
+		Header:      make(http.Header),
+	})
+	c.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.WriteMessage(websocket.BinaryMessage, buf); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	c.Lock()
+	c.tx += uint64(len(buf))
+	c.Unlock()
+	return &StreamingConn{conn: conn, client: c}, nil
+}
+
+// Read returns the next reply of the stream. At the end of the stream, it
+// returns io.EOF.
+func (sc *StreamingConn) Read() ([]byte, error) {
+	buf, err := readReply(sc.conn)
+	if err != nil {
+		if websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+	sc.client.Lock()
+	sc.client.rx += uint64(len(buf))
+	sc.client.Unlock()
+	return buf, nil
+}
+
+// ReadMessage decodes the next reply of the stream into ret, which must be
+// a pointer to the reply-struct. At the end of the stream, it returns
+// io.EOF.
+func (sc *StreamingConn) ReadMessage(ret interface{}) error {
+	buf, err := sc.Read()
+	if err != nil {
+		return err
+	}
+	return protobuf.DecodeWithConstructors(buf, ret,
+		network.DefaultConstructors(sc.client.suite))
+}
+
+// Close stops the stream. The service is told that the client went away.
+func (sc *StreamingConn) Close() error {
+	return sc.conn.Close()
+}
@@ -0,0 +1,116 @@
+package onet
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/dedis/onet/network"
+)
+
+// ErrPinMismatch is returned when the certificate of a server doesn't match
+// the public key pinned for it.
+var ErrPinMismatch = errors.New("certificate doesn't match the pinned public key")
+
+// clientTLS holds how a Client connects with wss.
+type clientTLS struct {
+	// enabled is set by UseTLS
+	enabled bool
+	// roots are the trusted CAs, nil for the system ones
+	roots *x509.CertPool
+	// pins are the hashes of the public keys accepted per server
+	pins map[network.ServerIdentityID][][]byte
+}
+
+// LoadCertPool returns the certificates of the system trust store together
+// with the ones in the given PEM files, for example the CA of a private
+// deployment.
+func LoadCertPool(files ...string) (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	for _, f := range files {
+		buf, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(buf) {
+			return nil, fmt.Errorf("no certificate found in %s", f)
+		}
+	}
+	return pool, nil
+}
+
+// PublicKeyPin returns the pin of the public key of cert: the SHA-256 hash
+// of its DER-encoded SubjectPublicKeyInfo, as used by HPKP.
+func PublicKeyPin(cert *x509.Certificate) []byte {
+	h := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return h[:]
+}
+
+// UseTLS makes the Client connect with wss instead of ws. The certificates
+// of the servers are validated against roots, or against the system trust
+// store if roots is nil. See LoadCertPool to add custom CAs.
+func (c *Client) UseTLS(roots *x509.CertPool) {
+	c.Lock()
+	defer c.Unlock()
+	if c.tls == nil {
+		c.tls = &clientTLS{pins: make(map[network.ServerIdentityID][][]byte)}
+	}
+	c.tls.enabled = true
+	c.tls.roots = roots
+}
+
+// PinPublicKey accepts the certificate of si if its public key has the
+// given pin, see PublicKeyPin. For a pinned server, the certificate doesn't
+// need to be signed by a trusted CA, so self-signed certificates can be
+// used. More than one pin can be given for a server, for key rollovers.
+// UseTLS must be called for the pins to be used.
+func (c *Client) PinPublicKey(si *network.ServerIdentity, pin []byte) {
+	c.Lock()
+	defer c.Unlock()
+	if c.tls == nil {
+		c.tls = &clientTLS{pins: make(map[network.ServerIdentityID][][]byte)}
+	}
+	c.tls.pins[si.ID] = append(c.tls.pins[si.ID], pin)
+}
+
+// tlsConfig returns the configuration to connect to si, or nil if the
+// Client doesn't use TLS. The caller must hold the lock.
+func (c *Client) tlsConfig(si *network.ServerIdentity, host string) *tls.Config {
+	if c.tls == nil || !c.tls.enabled {
+		return nil
+	}
+	conf := &tls.Config{
+		RootCAs:    c.tls.roots,
+		ServerName: host,
+	}
+	pins := c.tls.pins[si.ID]
+	if len(pins) == 0 {
+		return conf
+	}
+	// The chain is not checked against the CAs, only the key.
+	conf.InsecureSkipVerify = true
+	conf.VerifyPeerCertificate = func(raw [][]byte, _ [][]*x509.Certificate) error {
+		if len(raw) == 0 {
+			return ErrPinMismatch
+		}
+		cert, err := x509.ParseCertificate(raw[0])
+		if err != nil {
+			return err
+		}
+		pin := PublicKeyPin(cert)
+		for _, p := range pins {
+			if bytes.Equal(p, pin) {
+				return nil
+			}
+		}
+		return ErrPinMismatch
+	}
+	return conf
+}
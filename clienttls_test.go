@@ -0,0 +1,65 @@
+package onet
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/dedis/onet/network"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/satori/go.uuid.v1"
+)
+
+func TestClient_TLSPinning(t *testing.T) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+	si := &network.ServerIdentity{ID: network.ServerIdentityID(uuid.NewV4())}
+
+	c := NewClient(tSuite, backForthServiceName)
+	require.Nil(t, c.tlsConfig(si, "127.0.0.1"))
+	c.UseTLS(nil)
+	conf := c.tlsConfig(si, "127.0.0.1")
+	require.NotNil(t, conf)
+	// The self-signed certificate is not in the system trust store.
+	_, err := tls.Dial("tcp", srv.Listener.Addr().String(), conf)
+	require.NotNil(t, err)
+
+	c.PinPublicKey(si, []byte("wrong pin"))
+	conf = c.tlsConfig(si, "127.0.0.1")
+	_, err = tls.Dial("tcp", srv.Listener.Addr().String(), conf)
+	require.NotNil(t, err)
+
+	c.PinPublicKey(si, PublicKeyPin(srv.Certificate()))
+	conf = c.tlsConfig(si, "127.0.0.1")
+	conn, err := tls.Dial("tcp", srv.Listener.Addr().String(), conf)
+	require.Nil(t, err)
+	require.Nil(t, conn.Close())
+}
+
+func TestClient_TLSCertPool(t *testing.T) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+	tmp, err := ioutil.TempDir("", "clienttls")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmp)
+	ca := path.Join(tmp, "ca.pem")
+	require.Nil(t, ioutil.WriteFile(ca, pem.EncodeToMemory(&pem.Block{
+		Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0600))
+
+	_, err = LoadCertPool(path.Join(tmp, "missing.pem"))
+	require.NotNil(t, err)
+	pool, err := LoadCertPool(ca)
+	require.Nil(t, err)
+
+	c := NewClient(tSuite, backForthServiceName)
+	c.UseTLS(pool)
+	si := &network.ServerIdentity{ID: network.ServerIdentityID(uuid.NewV4())}
+	conn, err := tls.Dial("tcp", srv.Listener.Addr().String(), c.tlsConfig(si, "127.0.0.1"))
+	require.Nil(t, err)
+	require.Nil(t, conn.Close())
+}
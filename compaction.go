@@ -0,0 +1,414 @@
+// +build !js
+
+package onet
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/dedis/onet/log"
+)
+
+// DBCompaction configures the compaction of the database of a Server. Bolt
+// never shrinks its file, so a database with a lot of deleted or
+// overwritten data keeps growing. Compaction copies all data to a new file
+// and replaces the old one.
+//
+// The compaction is done when the server starts, before the database is
+// opened, see ServerOptions.DBCompaction, and, if Interval is set, in the
+// background while the server runs. In the background, the data is copied
+// while the services keep using the database, then the access to the
+// database is blocked while the new file replaces the old one. The
+// services must reach the database through Context.DB or Context.Load and
+// Context.Save: the *bolt.DB of Context.GetAdditionalBucket can't be
+// replaced, so the server doesn't compact in the background once a service
+// asked for it.
+type DBCompaction struct {
+	// Interval between two checks of the fragmentation while the server
+	// runs. 0 disables the background compaction.
+	Interval time.Duration
+	// Windows restrict the background compaction to times of the day. If
+	// empty, it can happen at any time.
+	Windows []CompactionWindow
+	// MinFragmentation is the share of free space in the file, between 0
+	// and 1, above which the database is compacted.
+	MinFragmentation float64
+	// BytesPerSecond limits the speed of the copy to reduce the IO load.
+	// 0 means no limit.
+	BytesPerSecond int
+}
+
+// CompactionWindow is a time of the day, given as the offsets of its start
+// and end since midnight UTC. The window can wrap around midnight.
+type CompactionWindow struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// contains returns whether the time of the day of t is in the window.
+func (w CompactionWindow) contains(t time.Time) bool {
+	t = t.UTC()
+	off := t.Sub(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC))
+	if w.Start <= w.End {
+		return off >= w.Start && off < w.End
+	}
+	return off >= w.Start || off < w.End
+}
+
+// inWindow returns whether t is in one of the windows, or if there are
+// none.
+func (conf DBCompaction) inWindow(t time.Time) bool {
+	for _, w := range conf.Windows {
+		if w.contains(t) {
+			return true
+		}
+	}
+	return len(conf.Windows) == 0
+}
+
+// errCompactionBlocked is returned by the background compaction once a
+// service got the *bolt.DB of the server.
+var errCompactionBlocked = errors.New("a service uses the database directly")
+
+// dbCompactor runs the background compaction of the database of a
+// serviceManager, and keeps its statistics for the status.
+type dbCompactor struct {
+	sm     *serviceManager
+	config DBCompaction
+	stop   chan struct{}
+	// blocked is set once a service got the *bolt.DB
+	blocked  bool
+	runs     int
+	last     time.Time
+	lastTook time.Duration
+	sync.Mutex
+}
+
+func newDBCompactor(sm *serviceManager) *dbCompactor {
+	return &dbCompactor{sm: sm}
+}
+
+// done records a compaction that started at start.
+func (dc *dbCompactor) done(start time.Time) {
+	dc.Lock()
+	defer dc.Unlock()
+	dc.runs++
+	dc.last = time.Now()
+	dc.lastTook = dc.last.Sub(start)
+}
+
+// block stops the background compaction for good, as the *bolt.DB has been
+// given to a service.
+func (dc *dbCompactor) block() {
+	dc.Lock()
+	defer dc.Unlock()
+	dc.blocked = true
+}
+
+// SetDBCompaction sets how the database of this server is compacted in the
+// background, see DBCompaction. It replaces the previous configuration.
+func (c *Server) SetDBCompaction(conf DBCompaction) {
+	c.serviceManager.compaction.set(conf)
+}
+
+// CompactDB compacts the database of this server now, whatever its
+// fragmentation and the windows.
+func (c *Server) CompactDB() error {
+	return c.serviceManager.compaction.compact()
+}
+
+func (dc *dbCompactor) set(conf DBCompaction) {
+	dc.Lock()
+	defer dc.Unlock()
+	dc.halt()
+	dc.config = conf
+	if conf.Interval > 0 {
+		dc.stop = make(chan struct{})
+		go dc.run(conf, dc.stop)
+	}
+}
+
+// close ends the background compaction, also if it is copying. It must be
+// called before the database is closed.
+func (dc *dbCompactor) close() {
+	dc.Lock()
+	defer dc.Unlock()
+	dc.halt()
+}
+
+// halt closes the stop channel, if any. It must be called with the lock
+// held.
+func (dc *dbCompactor) halt() {
+	if dc.stop != nil {
+		close(dc.stop)
+		dc.stop = nil
+	}
+}
+
+// run checks the fragmentation of the database every conf.Interval, in the
+// windows, until stop is closed.
+func (dc *dbCompactor) run(conf DBCompaction, stop chan struct{}) {
+	ticker := time.NewTicker(conf.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			if !conf.inWindow(now) {
+				continue
+			}
+			frag, err := dc.fragmentation()
+			if err != nil {
+				log.Error("Couldn't get the fragmentation of the db:", err)
+				continue
+			}
+			if frag < conf.MinFragmentation {
+				continue
+			}
+			log.Lvlf2("Compacting db with %.0f%% fragmentation", frag*100)
+			if err := dc.compactOnline(conf.BytesPerSecond, stop); err != nil {
+				log.Error("Compacting db failed:", err)
+			}
+		}
+	}
+}
+
+// fragmentation returns the fragmentation of the database of the
+// serviceManager.
+func (dc *dbCompactor) fragmentation() (float64, error) {
+	dc.sm.dbMut.RLock()
+	defer dc.sm.dbMut.RUnlock()
+	if dc.sm.db == nil {
+		return 0, errors.New("database is closed")
+	}
+	return dbFragmentation(dc.sm.db)
+}
+
+// compact compacts the database with the throttling of the configuration.
+func (dc *dbCompactor) compact() error {
+	dc.Lock()
+	bps := dc.config.BytesPerSecond
+	dc.Unlock()
+	return dc.compactOnline(bps, nil)
+}
+
+// compactOnline copies the database to a new file while the services keep
+// using it, then blocks the access to the database to replace it by the
+// copy. If the database changed during the copy, it is copied again while
+// the access is blocked, without throttling. A close of stop aborts the
+// copy.
+func (dc *dbCompactor) compactOnline(bps int, stop chan struct{}) error {
+	dc.Lock()
+	blocked := dc.blocked
+	dc.Unlock()
+	if blocked {
+		return errCompactionBlocked
+	}
+	sm := dc.sm
+	start := time.Now()
+	file := sm.dbFileName()
+	tmpFile := file + ".compact"
+	os.Remove(tmpFile)
+	dst, err := openDb(tmpFile)
+	if err != nil {
+		return err
+	}
+	fail := func(err error) error {
+		dst.Close()
+		os.Remove(tmpFile)
+		return err
+	}
+
+	var copied int
+	err = sm.dbView(func(tx *bolt.Tx) error {
+		copied = tx.ID()
+		return copyTx(dst, tx, bps, stop)
+	})
+	if err != nil {
+		return fail(err)
+	}
+
+	sm.dbMut.Lock()
+	defer sm.dbMut.Unlock()
+	if sm.db == nil {
+		return fail(errors.New("database is closed"))
+	}
+	dc.Lock()
+	blocked = dc.blocked
+	dc.Unlock()
+	if blocked {
+		return fail(errCompactionBlocked)
+	}
+	err = sm.db.View(func(tx *bolt.Tx) error {
+		if tx.ID() == copied {
+			return nil
+		}
+		log.Lvl2("Db changed during the compaction, copying it again")
+		dst.Close()
+		os.Remove(tmpFile)
+		again, err := openDb(tmpFile)
+		if err != nil {
+			return err
+		}
+		dst = again
+		return copyTx(dst, tx, 0, nil)
+	})
+	if err != nil {
+		return fail(err)
+	}
+	// The copy is opened under its temporary name and moved over the old
+	// file, so that the server always has an open database.
+	if err := os.Rename(tmpFile, file); err != nil {
+		return fail(err)
+	}
+	if err := sm.db.Close(); err != nil {
+		log.Error("Couldn't close the old db:", err)
+	}
+	sm.db = dst
+	dc.done(start)
+	return nil
+}
+
+// CompactDBFile compacts the database in file if its fragmentation is at
+// least config.MinFragmentation, and returns whether it did. The database
+// must not be open: a server still using it makes CompactDBFile fail after
+// a second. If anything fails, the old file is kept unchanged.
+func CompactDBFile(file string, config DBCompaction) (bool, error) {
+	if _, err := os.Stat(file); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	src, err := bolt.Open(file, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return false, err
+	}
+	frag, err := dbFragmentation(src)
+	if err != nil || frag < config.MinFragmentation {
+		src.Close()
+		return false, err
+	}
+	log.Lvlf2("Compacting db with %.0f%% fragmentation", frag*100)
+	tmpFile := file + ".compact"
+	os.Remove(tmpFile)
+	dst, err := openDb(tmpFile)
+	if err != nil {
+		src.Close()
+		return false, err
+	}
+	err = copyDB(dst, src, config.BytesPerSecond)
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	src.Close()
+	if err == nil {
+		err = os.Rename(tmpFile, file)
+	}
+	if err != nil {
+		os.Remove(tmpFile)
+		return false, err
+	}
+	return true, nil
+}
+
+func dbFragmentation(db *bolt.DB) (float64, error) {
+	var size int64
+	err := db.View(func(tx *bolt.Tx) error {
+		size = tx.Size()
+		return nil
+	})
+	if err != nil || size == 0 {
+		return 0, err
+	}
+	st := db.Stats()
+	free := int64(st.FreePageN+st.PendingPageN) * int64(os.Getpagesize())
+	return float64(free) / float64(size), nil
+}
+
+// copyDB copies all buckets of src to dst, writing at most bps bytes per
+// second if bps is bigger than 0.
+func copyDB(dst, src *bolt.DB, bps int) error {
+	return src.View(func(tx *bolt.Tx) error {
+		return copyTx(dst, tx, bps, nil)
+	})
+}
+
+// copyTx copies all buckets of the transaction to dst, writing at most bps
+// bytes per second if bps is bigger than 0. It returns an error if stop is
+// closed before the end.
+func copyTx(dst *bolt.DB, src *bolt.Tx, bps int, stop chan struct{}) error {
+	start := time.Now()
+	var written int64
+	throttle := func(n int) error {
+		select {
+		case <-stop:
+			return errors.New("compaction stopped")
+		default:
+		}
+		if bps <= 0 {
+			return nil
+		}
+		written += int64(n)
+		should := time.Duration(written * int64(time.Second) / int64(bps))
+		if wait := should - time.Since(start); wait > 0 {
+			select {
+			case <-stop:
+				return errors.New("compaction stopped")
+			case <-time.After(wait):
+			}
+		}
+		return nil
+	}
+	return src.ForEach(func(name []byte, sb *bolt.Bucket) error {
+		return dst.Update(func(dtx *bolt.Tx) error {
+			db, err := dtx.CreateBucket(name)
+			if err != nil {
+				return err
+			}
+			return copyBucket(db, sb, throttle)
+		})
+	})
+}
+
+// copyBucket recursively copies all keys and nested buckets of src to dst.
+func copyBucket(dst, src *bolt.Bucket, throttle func(int) error) error {
+	return src.ForEach(func(k, v []byte) error {
+		if v == nil {
+			nested, err := dst.CreateBucket(k)
+			if err != nil {
+				return err
+			}
+			return copyBucket(nested, src.Bucket(k), throttle)
+		}
+		if err := throttle(len(k) + len(v)); err != nil {
+			return err
+		}
+		return dst.Put(k, v)
+	})
+}
+
+// addStatus adds the fragmentation of db and the statistics of the
+// compaction to the status.
+func (dc *dbCompactor) addStatus(db *bolt.DB, status *Status) {
+	if frag, err := dbFragmentation(db); err == nil {
+		status.Set("Fragmentation", frag)
+	}
+	if fi, err := os.Stat(dc.sm.dbFileName()); err == nil {
+		status.Set("FileSize", fi.Size())
+	}
+	dc.Lock()
+	defer dc.Unlock()
+	status.Set("Compactions", dc.runs)
+	if dc.runs > 0 {
+		status.Set("LastCompaction", dc.last.Format(time.RFC3339))
+		status.Set("LastCompactionTook", dc.lastTook)
+	}
+	if dc.blocked && dc.config.Interval > 0 {
+		status.Set("CompactionBlocked", true)
+	}
+}
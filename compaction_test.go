@@ -0,0 +1,152 @@
+package onet
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompactDBFile(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "compaction")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmp)
+	file := path.Join(tmp, "test.db")
+
+	done, err := CompactDBFile(file, DBCompaction{})
+	require.Nil(t, err)
+	require.False(t, done)
+
+	db, err := openDb(file)
+	require.Nil(t, err)
+	bucket := []byte("compact")
+	value := make([]byte, 1024)
+	require.Nil(t, db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket(bucket)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < 1000; i++ {
+			if err := b.Put([]byte(fmt.Sprint(i)), value); err != nil {
+				return err
+			}
+		}
+		_, err = b.CreateBucket([]byte("nested"))
+		return err
+	}))
+	require.Nil(t, db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		for i := 1; i < 1000; i++ {
+			if err := b.Delete([]byte(fmt.Sprint(i))); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+
+	// An open database can't be compacted
+	_, err = CompactDBFile(file, DBCompaction{})
+	require.NotNil(t, err)
+	require.Nil(t, db.Close())
+	fi, err := os.Stat(file)
+	require.Nil(t, err)
+	before := fi.Size()
+
+	// Below the fragmentation, nothing is done
+	done, err = CompactDBFile(file, DBCompaction{MinFragmentation: 1.1})
+	require.Nil(t, err)
+	require.False(t, done)
+
+	done, err = CompactDBFile(file, DBCompaction{})
+	require.Nil(t, err)
+	require.True(t, done)
+	fi, err = os.Stat(file)
+	require.Nil(t, err)
+	require.True(t, fi.Size() < before)
+
+	db, err = openDb(file)
+	require.Nil(t, err)
+	defer db.Close()
+	require.Nil(t, db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		require.Equal(t, value, b.Get([]byte("0")))
+		require.Nil(t, b.Get([]byte("1")))
+		require.NotNil(t, b.Bucket([]byte("nested")))
+		return nil
+	}))
+}
+
+func TestDBCompactor_Online(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "compaction")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmp)
+	c := createContext(t, tmp)
+	sm := c.manager
+	defer sm.db.Close()
+
+	db, bucket := c.DB([]byte("compact"))
+	value := make([]byte, 1024)
+	require.Nil(t, db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		for i := 0; i < 1000; i++ {
+			if err := b.Put([]byte(fmt.Sprint(i)), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	require.Nil(t, db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		for i := 1; i < 1000; i++ {
+			if err := b.Delete([]byte(fmt.Sprint(i))); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	fi, err := os.Stat(sm.dbFileName())
+	require.Nil(t, err)
+	before := fi.Size()
+
+	require.Nil(t, sm.compaction.compact())
+	fi, err = os.Stat(sm.dbFileName())
+	require.Nil(t, err)
+	require.True(t, fi.Size() < before)
+	_, err = os.Stat(sm.dbFileName() + ".compact")
+	require.True(t, os.IsNotExist(err))
+	// The DB of the service reaches the new database
+	require.Nil(t, db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		require.Equal(t, value, b.Get([]byte("0")))
+		require.Nil(t, b.Get([]byte("1")))
+		return nil
+	}))
+	st := NewStatus()
+	sm.compaction.addStatus(sm.db, st)
+	require.Equal(t, "1", st.Field["Compactions"])
+
+	// A service keeping the *bolt.DB stops the compaction
+	c.GetAdditionalBucket([]byte("raw"))
+	require.Equal(t, errCompactionBlocked, sm.compaction.compact())
+}
+
+func TestDBCompaction_Windows(t *testing.T) {
+	at := func(h, m int) time.Time {
+		return time.Date(2020, 1, 1, h, m, 0, 0, time.UTC)
+	}
+	require.True(t, DBCompaction{}.inWindow(at(12, 0)))
+	night := DBCompaction{Windows: []CompactionWindow{
+		{Start: 23 * time.Hour, End: 2 * time.Hour},
+		{Start: 12 * time.Hour, End: 12*time.Hour + 30*time.Minute},
+	}}
+	require.True(t, night.inWindow(at(23, 30)))
+	require.True(t, night.inWindow(at(1, 59)))
+	require.True(t, night.inWindow(at(12, 15)))
+	require.False(t, night.inWindow(at(2, 0)))
+	require.False(t, night.inWindow(at(12, 30)))
+}
@@ -0,0 +1,203 @@
+// +build !js
+
+package onet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+	"github.com/dedis/protobuf"
+)
+
+// OnetServiceName is the name of the service of onet itself on the
+// websocket of every server, which answers CheckConnectivity.
+const OnetServiceName = "Onet"
+
+// maxConnectivityRoster is the largest roster a server pings the members of
+// for a CheckConnectivity.
+const maxConnectivityRoster = 1000
+
+// CheckConnectivity asks a server to ping all other members of the roster,
+// each with the given timeout in nanoseconds. The server must be a member.
+type CheckConnectivity struct {
+	Roster  *Roster
+	Timeout int64
+}
+
+// CheckConnectivityReply holds the result of the pings of the members of
+// the roster, in the order of the roster: the round-trip time in
+// nanoseconds, or the error if there was no answer.
+type CheckConnectivityReply struct {
+	RTT    []int64
+	Errors []string
+}
+
+// Connectivity is the result of Roster.CheckConnectivity. The slices are
+// indexed by the position of the members in the roster.
+type Connectivity struct {
+	Roster *Roster
+	// Reachable[i][j] is true if member i got an answer to its ping of
+	// member j. A member reaches itself.
+	Reachable [][]bool
+	// RTT[i][j] is the round-trip time of the ping of member j by member i
+	RTT [][]time.Duration
+	// PingErrors[i][j] is why member i couldn't ping member j
+	PingErrors [][]string
+	// Errors[i] is why member i couldn't be asked to ping the others, nil
+	// if it answered
+	Errors []error
+}
+
+// onetService answers the requests of the clients to onet itself. It isn't
+// a service of the serviceManager, it only takes requests on the websocket.
+type onetService struct {
+	server *Server
+}
+
+// NewProtocol implements Service, onetService has no protocols.
+func (s *onetService) NewProtocol(*TreeNodeInstance, *GenericConfig) (ProtocolInstance, error) {
+	return nil, nil
+}
+
+// Process implements Service, onetService gets no messages.
+func (s *onetService) Process(*network.Envelope) {}
+
+// ProcessClientRequest implements Service.
+func (s *onetService) ProcessClientRequest(req *http.Request, path string, buf []byte) ([]byte, error) {
+	if path != "CheckConnectivity" {
+		return nil, errors.New("unknown request " + path)
+	}
+	cc := &CheckConnectivity{}
+	err := protobuf.DecodeWithConstructors(buf, cc, network.DefaultConstructors(s.server.suite))
+	if err != nil {
+		return nil, err
+	}
+	reply, err := s.server.checkConnectivity(cc)
+	if err != nil {
+		return nil, err
+	}
+	return protobuf.Encode(reply)
+}
+
+// checkConnectivity pings all members of the roster of cc but this server.
+func (c *Server) checkConnectivity(cc *CheckConnectivity) (*CheckConnectivityReply, error) {
+	if cc.Roster == nil || len(cc.Roster.List) > maxConnectivityRoster {
+		return nil, errors.New("need a roster of at most 1000 members")
+	}
+	if i, _ := cc.Roster.Search(c.ServerIdentity.ID); i < 0 {
+		return nil, errors.New("this server is not in the roster")
+	}
+	timeout := time.Duration(cc.Timeout)
+	if timeout <= 0 {
+		return nil, errors.New("timeout must be positive")
+	}
+	n := len(cc.Roster.List)
+	reply := &CheckConnectivityReply{RTT: make([]int64, n), Errors: make([]string, n)}
+	var wg sync.WaitGroup
+	for i, si := range cc.Roster.List {
+		if si.ID.Equal(c.ServerIdentity.ID) {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, si *network.ServerIdentity) {
+			defer wg.Done()
+			rtt, err := c.Ping(si, timeout)
+			if err != nil {
+				reply.Errors[i] = err.Error()
+				return
+			}
+			reply.RTT[i] = int64(rtt)
+		}(i, si)
+	}
+	wg.Wait()
+	log.Lvl3(c.Address(), "checked the connectivity of", n, "members")
+	return reply, nil
+}
+
+// CheckConnectivity asks every member of the roster to ping all others,
+// each ping waiting at most timeout for the answer, and returns who could
+// reach whom. It is meant to be run before a protocol, to find the members
+// behind a firewall or with a wrong address. The members that can't be
+// asked have their error in Connectivity.Errors and reach no one.
+func (ro *Roster) CheckConnectivity(suite network.Suite, timeout time.Duration) (*Connectivity, error) {
+	if len(ro.List) == 0 {
+		return nil, errors.New("empty roster")
+	}
+	n := len(ro.List)
+	conn := &Connectivity{
+		Roster:     ro,
+		Reachable:  make([][]bool, n),
+		RTT:        make([][]time.Duration, n),
+		PingErrors: make([][]string, n),
+		Errors:     make([]error, n),
+	}
+	client := NewClient(suite, OnetServiceName)
+	defer client.Close()
+	req := &CheckConnectivity{Roster: ro, Timeout: int64(timeout)}
+	var wg sync.WaitGroup
+	for i, si := range ro.List {
+		conn.Reachable[i] = make([]bool, n)
+		conn.Reachable[i][i] = true
+		conn.RTT[i] = make([]time.Duration, n)
+		conn.PingErrors[i] = make([]string, n)
+		wg.Add(1)
+		go func(i int, si *network.ServerIdentity) {
+			defer wg.Done()
+			// the member needs timeout for its pings, and the time to
+			// connect to it and send the reply
+			ctx, cancel := context.WithTimeout(context.Background(), 2*timeout+5*time.Second)
+			defer cancel()
+			reply := &CheckConnectivityReply{}
+			err := client.SendProtobufWithContext(ctx, si, req, reply)
+			if err == nil && (len(reply.RTT) != n || len(reply.Errors) != n) {
+				err = errors.New("wrong number of results")
+			}
+			if err != nil {
+				conn.Errors[i] = err
+				return
+			}
+			for j := range ro.List {
+				if j == i {
+					continue
+				}
+				conn.PingErrors[i][j] = reply.Errors[j]
+				conn.RTT[i][j] = time.Duration(reply.RTT[j])
+				conn.Reachable[i][j] = reply.Errors[j] == ""
+			}
+		}(i, si)
+	}
+	wg.Wait()
+	return conn, nil
+}
+
+// Problems returns a line for every member that couldn't be asked and every
+// ping without answer, empty if all members reach each other.
+func (c *Connectivity) Problems() []string {
+	var problems []string
+	for i, si := range c.Roster.List {
+		if c.Errors[i] != nil {
+			problems = append(problems, fmt.Sprintf("%s: couldn't be asked: %v",
+				si.Address, c.Errors[i]))
+			continue
+		}
+		for j, sj := range c.Roster.List {
+			if !c.Reachable[i][j] {
+				problems = append(problems, fmt.Sprintf("%s: can't reach %s: %s",
+					si.Address, sj.Address, c.PingErrors[i][j]))
+			}
+		}
+	}
+	return problems
+}
+
+// Latencies returns the round-trip times of the check, for
+// Roster.GenerateLatencyOptimizedTree.
+func (c *Connectivity) Latencies() *LatencyMatrix {
+	return &LatencyMatrix{Roster: c.Roster, RTT: c.RTT, Measured: time.Now()}
+}
@@ -0,0 +1,60 @@
+package onet
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoster_CheckConnectivity(t *testing.T) {
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	servers, roster, _ := local.GenTree(3, false)
+
+	conn, err := roster.CheckConnectivity(tSuite, time.Second)
+	require.Nil(t, err)
+	require.Empty(t, conn.Problems())
+	for i := range roster.List {
+		require.Nil(t, conn.Errors[i])
+		for j := range roster.List {
+			require.True(t, conn.Reachable[i][j])
+			if i != j {
+				require.True(t, conn.RTT[i][j] > 0)
+			}
+		}
+	}
+	require.Equal(t, 3, roster.GenerateLatencyOptimizedTree(2, conn.Latencies()).Size())
+
+	require.Nil(t, servers[2].Close())
+	conn, err = roster.CheckConnectivity(tSuite, time.Second)
+	require.Nil(t, err)
+	require.NotNil(t, conn.Errors[2])
+	require.False(t, conn.Reachable[0][2])
+	require.False(t, conn.Reachable[1][2])
+	require.True(t, conn.Reachable[0][1])
+	require.NotEqual(t, "", conn.PingErrors[0][2])
+	problems := strings.Join(conn.Problems(), "\n")
+	require.Contains(t, problems, roster.List[2].Address.String()+": couldn't be asked")
+	require.Contains(t, problems, "can't reach "+roster.List[2].Address.String())
+}
+
+func TestServer_checkConnectivity(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	servers, roster, _ := local.GenTree(2, false)
+	other := local.GenRosterFromHost(servers[1])
+
+	_, err := servers[0].checkConnectivity(&CheckConnectivity{Roster: other, Timeout: int64(time.Second)})
+	require.NotNil(t, err)
+	_, err = servers[0].checkConnectivity(&CheckConnectivity{Roster: roster})
+	require.NotNil(t, err)
+	reply, err := servers[0].checkConnectivity(&CheckConnectivity{Roster: roster, Timeout: int64(time.Second)})
+	require.Nil(t, err)
+	require.Equal(t, "", reply.Errors[1])
+	require.True(t, reply.RTT[1] > 0)
+
+	_, err = RegisterNewService(OnetServiceName, nil)
+	require.NotNil(t, err)
+}
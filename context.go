@@ -1,3 +1,5 @@
+// +build !js
+
 package onet
 
 import (
@@ -15,6 +17,11 @@ type Context struct {
 	serviceID  ServiceID
 	manager    *serviceManager
 	bucketName []byte
+	config     interface{}
+	// name is the name of the service on the websocket
+	name string
+	// tenant is nil for the default services of the server
+	tenant *tenant
 }
 
 // defaultContext is the implementation of the Context interface. It is
@@ -26,6 +33,7 @@ func newContext(c *Server, o *Overlay, servID ServiceID, manager *serviceManager
 		serviceID:  servID,
 		manager:    manager,
 		bucketName: []byte(ServiceFactory.Name(servID)),
+		name:       ServiceFactory.Name(servID),
 	}
 }
 
@@ -37,12 +45,45 @@ func (c *Context) NewTreeNodeInstance(t *Tree, tn *TreeNode, protoName string) *
 }
 
 // SendRaw sends a message to the ServerIdentity.
+// The services of a tenant only reach the same tenant on the other server.
 func (c *Context) SendRaw(si *network.ServerIdentity, msg interface{}) error {
-	_, err := c.server.Send(si, msg)
+	msg, err := c.wrap(msg)
+	if err != nil {
+		return err
+	}
+	_, err = c.server.Send(si, msg)
 	return err
 }
 
-// ServerIdentity returns this server's identity.
+// wrap returns msg in a TenantMsg for the services of a tenant, else msg.
+func (c *Context) wrap(msg interface{}) (interface{}, error) {
+	if c.tenant == nil {
+		return msg, nil
+	}
+	return c.tenant.wrap(msg)
+}
+
+// Broadcast sends msg to all members of the roster, see Overlay.Broadcast.
+func (c *Context) Broadcast(roster *Roster, msg network.Message) error {
+	msg, err := c.wrap(msg)
+	if err != nil {
+		return err
+	}
+	return c.overlay.Broadcast(roster, msg)
+}
+
+// Gossip disseminates msg epidemically to the members of the roster, see
+// Overlay.Gossip.
+func (c *Context) Gossip(roster *Roster, msg network.Message, conf *GossipConfig) error {
+	msg, err := c.wrap(msg)
+	if err != nil {
+		return err
+	}
+	return c.overlay.Gossip(roster, msg, conf)
+}
+
+// ServerIdentity returns this server's identity. Its keys are replaced by
+// Server.RotateKey, so they must be read with GetPublic and GetPrivate.
 func (c *Context) ServerIdentity() *network.ServerIdentity {
 	return c.server.ServerIdentity
 }
@@ -52,6 +93,11 @@ func (c *Context) Suite() network.Suite {
 	return c.server.Suite()
 }
 
+// FeatureEnabled returns whether the given feature flag is set on the server.
+func (c *Context) FeatureEnabled(name string) bool {
+	return c.server.FeatureEnabled(name)
+}
+
 // ServiceID returns the service-id.
 func (c *Context) ServiceID() ServiceID {
 	return c.serviceID
@@ -87,15 +133,31 @@ func (c *Context) RegisterStatusReporter(name string, s StatusReporter) {
 	c.server.statusReporterStruct.RegisterStatusReporter(name, s)
 }
 
+// SetMaxConcurrentRequests limits how many client requests to this service
+// are handled at the same time. Up to queue more requests wait for a free
+// slot, any further request is refused with ErrServiceBusy. A max of 0
+// removes the limit.
+func (c *Context) SetMaxConcurrentRequests(max, queue int) {
+	c.server.websocket.setConcurrency(c.name, max, queue)
+}
+
 // RegisterProcessor overrides the RegisterProcessor methods of the Dispatcher.
 // It delegates the dispatching to the serviceManager.
 func (c *Context) RegisterProcessor(p network.Processor, msgType network.MessageTypeID) {
+	if c.tenant != nil {
+		c.tenant.RegisterProcessor(p, msgType)
+		return
+	}
 	c.manager.registerProcessor(p, msgType)
 }
 
 // RegisterProcessorFunc takes a message-type and a function that will be called
 // if this message-type is received.
 func (c *Context) RegisterProcessorFunc(msgType network.MessageTypeID, fn func(*network.Envelope)) {
+	if c.tenant != nil {
+		c.tenant.RegisterProcessorFunc(msgType, fn)
+		return
+	}
 	c.manager.registerProcessorFunc(msgType, fn)
 }
 
@@ -105,8 +167,12 @@ func (c *Context) RegisterMessageProxy(m MessageProxy) {
 	c.overlay.RegisterMessageProxy(m)
 }
 
-// Service returns the corresponding service.
+// Service returns the corresponding service, of the same tenant for the
+// services of a tenant.
 func (c *Context) Service(name string) Service {
+	if c.tenant != nil {
+		return c.tenant.service(name)
+	}
 	return c.manager.service(name)
 }
 
@@ -115,6 +181,31 @@ func (c *Context) String() string {
 	return c.server.ServerIdentity.String()
 }
 
+// ReportPeer adds penalty to the misbehavior score of the given peer. The
+// score is stored in the database and shared by all services of this server.
+// It decays over time with ReputationHalfLife, so only peers that misbehave
+// consistently keep a high score.
+func (c *Context) ReportPeer(si *network.ServerIdentity, penalty float64) (*PeerReputation, error) {
+	return c.manager.reputation.report(si, penalty)
+}
+
+// PeerReputation returns the current, decayed, misbehavior score of the given
+// peer. A peer without any reports has a score of 0.
+func (c *Context) PeerReputation(si *network.ServerIdentity) (*PeerReputation, error) {
+	return c.manager.reputation.get(si.ID)
+}
+
+// PeerReputations returns the reputation of all reported peers, starting with
+// the worst one.
+func (c *Context) PeerReputations() ([]*PeerReputation, error) {
+	return c.manager.reputation.all()
+}
+
+// ResetPeerReputation forgets all misbehavior reported for the given peer.
+func (c *Context) ResetPeerReputation(si *network.ServerIdentity) error {
+	return c.manager.reputation.reset(si.ID)
+}
+
 var testContextData = struct {
 	service map[string][]byte
 	sync.Mutex
@@ -123,23 +214,28 @@ var testContextData = struct {
 // Save takes a key and an interface. The interface will be network.Marshal'ed
 // and saved in the database under the bucket named after the service name.
 //
-// The data will be stored in a different bucket for every service.
+// The data will be stored in a different bucket for every service. If the
+// service has a storage quota that would be exceeded, ErrQuotaExceeded is
+// returned and nothing is stored.
 func (c *Context) Save(key []byte, data interface{}) error {
 	buf, err := network.Marshal(data)
 	if err != nil {
 		return err
 	}
-	return c.manager.db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket(c.bucketName)
-		return b.Put(key, buf)
+	err = c.manager.dbUpdate(func(tx *bolt.Tx) error {
+		return c.manager.quotas.put(tx, c.bucketName, key, buf)
 	})
+	if err != nil && err != ErrQuotaExceeded {
+		c.manager.quotas.forget(string(c.bucketName))
+	}
+	return err
 }
 
 // Load takes an key and returns the network.Unmarshaled data.
 // Returns a nil value if the key does not exist.
 func (c *Context) Load(key []byte) (interface{}, error) {
 	var buf []byte
-	c.manager.db.View(func(tx *bolt.Tx) error {
+	c.manager.dbView(func(tx *bolt.Tx) error {
 		v := tx.Bucket(c.bucketName).Get(key)
 		if v == nil {
 			return nil
@@ -165,9 +261,47 @@ func (c *Context) Load(key []byte) (interface{}, error) {
 // This function should only be used if the Load and Save functions are not sufficient.
 // Additionally, the user should not create buckets directly on the DB but always
 // call this function to create new buckets to avoid bucket name conflicts.
+//
+// The *bolt.DB can't be replaced while the service keeps it, so the server
+// stops compacting its database in the background, see DBCompaction.
+// Services should rather use the bucket through DB.
 func (c *Context) GetAdditionalBucket(name []byte) (*bolt.DB, []byte) {
+	fullName := c.createAdditionalBucket(name)
+	c.manager.compaction.block()
+	c.manager.dbMut.RLock()
+	defer c.manager.dbMut.RUnlock()
+	return c.manager.db, fullName
+}
+
+// DB gives access to the database of the server. Unlike the *bolt.DB of
+// GetAdditionalBucket, it stays valid when the database is compacted, see
+// DBCompaction. The transactions must not be used after the functions given
+// to View and Update return.
+type DB struct {
+	sm *serviceManager
+}
+
+// View runs fn in a read-only transaction of the database.
+func (db *DB) View(fn func(*bolt.Tx) error) error {
+	return db.sm.dbView(fn)
+}
+
+// Update runs fn in a read-write transaction of the database.
+func (db *DB) Update(fn func(*bolt.Tx) error) error {
+	return db.sm.dbUpdate(fn)
+}
+
+// DB makes sure that a bucket with the given name exists, like
+// GetAdditionalBucket, and returns the database and the bucket name.
+func (c *Context) DB(name []byte) (*DB, []byte) {
+	return &DB{c.manager}, c.createAdditionalBucket(name)
+}
+
+// createAdditionalBucket creates the bucket servicename + "_" + name, if
+// needed, and returns its name.
+func (c *Context) createAdditionalBucket(name []byte) []byte {
 	fullName := append(append(c.bucketName, byte('_')), name...)
-	err := c.manager.db.Update(func(tx *bolt.Tx) error {
+	err := c.manager.dbUpdate(func(tx *bolt.Tx) error {
 		_, err := tx.CreateBucketIfNotExists(fullName)
 		if err != nil {
 			return fmt.Errorf("create bucket: %s", err)
@@ -177,5 +311,5 @@ func (c *Context) GetAdditionalBucket(name []byte) (*bolt.DB, []byte) {
 	if err != nil {
 		panic(err)
 	}
-	return c.manager.db, fullName
+	return fullName
 }
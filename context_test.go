@@ -154,6 +154,7 @@ func createContext(t *testing.T, dbPath string) *Context {
 	})
 	require.Nil(t, err)
 	sm.db = db
+	sm.compaction = newDBCompactor(sm)
 
 	return newContext(cn, nil, ServiceFactory.ServiceID(name), sm)
 }
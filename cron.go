@@ -0,0 +1,153 @@
+package onet
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a parsed cron specification, see ScheduleCron.
+type cronSchedule struct {
+	// the allowed values of each field, as bits
+	minute, hour, dom, month, dow uint64
+	// domStar and dowStar are set if the field was "*", as cron runs a
+	// task if either of the day fields matches when both are restricted
+	domStar, dowStar bool
+	// every, if set, replaces the fields
+	every time.Duration
+}
+
+// cronField describes the values of a field of a cron specification.
+type cronField struct {
+	min, max int
+}
+
+var cronFields = []cronField{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 6}}
+
+// cronMacros are the shortcuts for the usual specifications.
+var cronMacros = map[string]string{
+	"@yearly":  "0 0 1 1 *",
+	"@monthly": "0 0 1 * *",
+	"@weekly":  "0 0 * * 0",
+	"@daily":   "0 0 * * *",
+	"@hourly":  "0 * * * *",
+}
+
+// parseCron parses a specification with the five fields "minute hour
+// day-of-month month day-of-week" of cron, where each field is "*", a
+// number, a range "a-b", a list "a,b" or any of them with a step "/n". The
+// specifications "@every <duration>", "@hourly", "@daily", "@weekly",
+// "@monthly" and "@yearly" are accepted, too.
+func parseCron(spec string) (*cronSchedule, error) {
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "@every ") {
+		d, err := time.ParseDuration(strings.TrimSpace(spec[len("@every "):]))
+		if err != nil {
+			return nil, err
+		}
+		if d < time.Second {
+			return nil, errors.New("cron: @every needs at least a second")
+		}
+		return &cronSchedule{every: d}, nil
+	}
+	if m, ok := cronMacros[spec]; ok {
+		spec = m
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != len(cronFields) {
+		return nil, errors.New("cron: need 5 fields in \"" + spec + "\"")
+	}
+	bits := make([]uint64, len(fields))
+	for i, f := range fields {
+		var err error
+		if bits[i], err = parseCronField(f, cronFields[i]); err != nil {
+			return nil, err
+		}
+	}
+	return &cronSchedule{
+		minute:  bits[0],
+		hour:    bits[1],
+		dom:     bits[2],
+		month:   bits[3],
+		dow:     bits[4],
+		domStar: fields[2] == "*",
+		dowStar: fields[4] == "*",
+	}, nil
+}
+
+// parseCronField returns the values of the field f as bits.
+func parseCronField(f string, cf cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(f, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step <= 0 {
+				return 0, errors.New("cron: invalid step in " + f)
+			}
+			part = part[:i]
+		}
+		lo, hi := cf.min, cf.max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, errors.New("cron: invalid value in " + f)
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, errors.New("cron: invalid value in " + f)
+				}
+			} else if step > 1 {
+				hi = cf.max
+			}
+		}
+		if lo < cf.min || hi > cf.max || lo > hi {
+			return 0, errors.New("cron: value out of range in " + f)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// dayMatches returns whether the day of t is allowed.
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// next returns the first time after t the schedule allows, or the zero
+// time if there is none in the next five years.
+func (s *cronSchedule) next(t time.Time) time.Time {
+	if s.every > 0 {
+		return t.Add(s.every)
+	}
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		y, mo, d := t.Date()
+		switch {
+		case s.month&(1<<uint(mo)) == 0:
+			t = time.Date(y, mo+1, 1, 0, 0, 0, 0, loc)
+		case !s.dayMatches(t):
+			t = time.Date(y, mo, d+1, 0, 0, 0, 0, loc)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(y, mo, d, t.Hour()+1, 0, 0, 0, loc)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,41 @@
+package onet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCron(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *",
+		"* * 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *", "@every 1ms",
+		"@every x"} {
+		_, err := parseCron(spec)
+		require.NotNil(t, err, spec)
+	}
+
+	start := time.Date(2018, 3, 14, 10, 17, 30, 0, time.UTC)
+	for spec, next := range map[string]time.Time{
+		"* * * * *":         time.Date(2018, 3, 14, 10, 18, 0, 0, time.UTC),
+		"*/15 * * * *":      time.Date(2018, 3, 14, 10, 30, 0, 0, time.UTC),
+		"5,10 8-9 * * *":    time.Date(2018, 3, 15, 8, 5, 0, 0, time.UTC),
+		"0 0 1 * *":         time.Date(2018, 4, 1, 0, 0, 0, 0, time.UTC),
+		"@daily":            time.Date(2018, 3, 15, 0, 0, 0, 0, time.UTC),
+		"30 12 * * 0":       time.Date(2018, 3, 18, 12, 30, 0, 0, time.UTC),
+		"0 0 13 * 5":        time.Date(2018, 3, 16, 0, 0, 0, 0, time.UTC),
+		"0 0 29 2 *":        time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC),
+		"@every 90s":        start.Add(90 * time.Second),
+		"17/20 10 14 3 *":   time.Date(2018, 3, 14, 10, 37, 0, 0, time.UTC),
+		"0 0 1 1 *":         time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
+		"  0  0  1  1  *  ": time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
+	} {
+		cs, err := parseCron(spec)
+		require.Nil(t, err, spec)
+		require.Equal(t, next, cs.next(start), spec)
+	}
+
+	cs, err := parseCron("0 0 31 2 *")
+	require.Nil(t, err)
+	require.True(t, cs.next(start).IsZero())
+}
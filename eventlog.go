@@ -0,0 +1,168 @@
+// +build !js
+
+package onet
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dedis/onet/network"
+)
+
+// The kinds of events recorded by onet itself. Services can record events
+// of their own kinds with Context.RecordEvent.
+const (
+	EventPeerConnected    = "peer-connected"
+	EventPeerDisconnected = "peer-disconnected"
+	EventProtocolFailure  = "protocol-failure"
+	EventServiceError     = "service-error"
+	EventRosterMismatch   = "roster-mismatch"
+	EventACLChanged       = "acl-changed"
+	EventConfigReloaded   = "config-reloaded"
+)
+
+// DefaultEventLogSize is the number of events kept by a server, unless
+// changed with SetEventLogSize.
+const DefaultEventLogSize = 500
+
+// Event is a significant event of the server, kept in its event log for
+// the operators.
+type Event struct {
+	Time    time.Time
+	Kind    string
+	Message string
+}
+
+// String returns the event on one line.
+func (e Event) String() string {
+	return fmt.Sprintf("%s %s %s", e.Time.Format(time.RFC3339), e.Kind, e.Message)
+}
+
+// eventLog is a ring buffer of the latest events.
+type eventLog struct {
+	events []Event
+	// next is the index of the next event in events
+	next int
+	full bool
+	sync.Mutex
+}
+
+func newEventLog(size int) *eventLog {
+	return &eventLog{events: make([]Event, size)}
+}
+
+func (l *eventLog) add(e Event) {
+	l.Lock()
+	defer l.Unlock()
+	if len(l.events) == 0 {
+		return
+	}
+	l.events[l.next] = e
+	l.next = (l.next + 1) % len(l.events)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// list returns the events, oldest first.
+func (l *eventLog) list() []Event {
+	l.Lock()
+	defer l.Unlock()
+	if !l.full {
+		return append([]Event{}, l.events[:l.next]...)
+	}
+	return append(append([]Event{}, l.events[l.next:]...), l.events[:l.next]...)
+}
+
+// resize keeps the latest events that fit in the new size.
+func (l *eventLog) resize(size int) {
+	events := l.list()
+	if len(events) > size {
+		events = events[len(events)-size:]
+	}
+	l.Lock()
+	defer l.Unlock()
+	l.events = make([]Event, size)
+	l.next = copy(l.events, events)
+	l.full = false
+	if size > 0 && l.next == size {
+		l.next, l.full = 0, true
+	}
+}
+
+// RecordEvent adds an event to the event log of the server. The oldest
+// event is dropped if the log is full.
+func (c *Server) RecordEvent(kind string, msg ...interface{}) {
+	if c == nil || c.events == nil {
+		return
+	}
+	c.events.add(Event{
+		Time:    time.Now(),
+		Kind:    kind,
+		Message: fmt.Sprint(msg...),
+	})
+}
+
+// Events returns the events in the event log, oldest first.
+func (c *Server) Events() []Event {
+	return c.events.list()
+}
+
+// SetEventLogSize changes the number of events kept in the event log.
+func (c *Server) SetEventLogSize(size int) {
+	if size < 0 {
+		size = 0
+	}
+	c.events.resize(size)
+}
+
+// RecordEvent adds an event of the service to the event log of the server.
+// The message is prefixed with the name of the service.
+func (c *Context) RecordEvent(kind string, msg ...interface{}) {
+	c.server.RecordEvent(kind, c.name+": "+fmt.Sprint(msg...))
+}
+
+// recordPeerEvents adds the connections and disconnections of the peers to
+// the event log.
+func (c *Server) recordPeerEvents() {
+	c.Router.AddConnectHandler(func(si *network.ServerIdentity) {
+		c.RecordEvent(EventPeerConnected, si.Address)
+	})
+	c.Router.AddErrorHandler(func(si *network.ServerIdentity) {
+		c.RecordEvent(EventPeerDisconnected, si.Address)
+	})
+}
+
+// serveEvents is the handler of the /events path. It returns the event log
+// one event per line, or as a JSON array if the query contains
+// format=json. The events can be filtered with kind=, and n= returns only
+// the latest n events. Only the clients of the admin API get it.
+func (c *Server) serveEvents(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var events []Event
+	for _, e := range c.Events() {
+		if kind := q.Get("kind"); kind != "" && e.Kind != kind {
+			continue
+		}
+		events = append(events, e)
+	}
+	if n, err := strconv.Atoi(q.Get("n")); err == nil && n >= 0 && n < len(events) {
+		events = events[len(events)-n:]
+	}
+	if q.Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		if events == nil {
+			events = []Event{}
+		}
+		json.NewEncoder(w).Encode(events)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, e := range events {
+		fmt.Fprintln(w, e)
+	}
+}
@@ -0,0 +1,61 @@
+package onet
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventLog_Ring(t *testing.T) {
+	l := newEventLog(3)
+	require.Empty(t, l.list())
+	for _, m := range []string{"a", "b", "c", "d"} {
+		l.add(Event{Kind: "test", Message: m})
+	}
+	events := l.list()
+	require.Equal(t, 3, len(events))
+	require.Equal(t, "b", events[0].Message)
+	require.Equal(t, "d", events[2].Message)
+
+	l.resize(2)
+	events = l.list()
+	require.Equal(t, 2, len(events))
+	require.Equal(t, "c", events[0].Message)
+	l.add(Event{Kind: "test", Message: "e"})
+	require.Equal(t, "e", l.list()[1].Message)
+
+	l.resize(5)
+	l.add(Event{Kind: "test", Message: "f"})
+	require.Equal(t, 3, len(l.list()))
+
+	l.resize(0)
+	l.add(Event{Kind: "test", Message: "g"})
+	require.Empty(t, l.list())
+}
+
+func TestServer_serveEvents(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	srv := local.GenServers(1)[0]
+	srv.RecordEvent(EventServiceError, "failed: ", errors.New("boom"))
+	srv.RecordEvent(EventProtocolFailure, "timeout")
+	srv.RecordEvent(EventProtocolFailure, "refused")
+
+	rec := httptest.NewRecorder()
+	srv.serveEvents(rec, httptest.NewRequest("GET", "/events", nil))
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	require.Equal(t, 3, len(lines))
+	require.Contains(t, lines[0], EventServiceError+" failed: boom")
+
+	rec = httptest.NewRecorder()
+	srv.serveEvents(rec, httptest.NewRequest("GET",
+		"/events?format=json&kind="+EventProtocolFailure+"&n=1", nil))
+	var events []Event
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &events))
+	require.Equal(t, 1, len(events))
+	require.Equal(t, "refused", events[0].Message)
+}
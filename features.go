@@ -0,0 +1,144 @@
+// +build !js
+
+package onet
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// featuresEnv is the environment variable that holds the feature flags that
+// are set when a Server is created. It is a comma-separated list of names,
+// a name prefixed with a '-' is explicitly disabled:
+//	CONODE_FEATURES=newTreeBuilder,-fastPath
+const featuresEnv = "CONODE_FEATURES"
+
+// featureFlags holds the named flags that enable or disable behavior at
+// runtime. Flags that have never been set are disabled.
+type featureFlags struct {
+	flags map[string]bool
+	sync.RWMutex
+}
+
+func newFeatureFlags() *featureFlags {
+	return &featureFlags{flags: make(map[string]bool)}
+}
+
+// parse sets the flags from a comma-separated list like in featuresEnv.
+func (ff *featureFlags) parse(list string) {
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		enabled := true
+		if strings.HasPrefix(name, "-") {
+			name = name[1:]
+			enabled = false
+		}
+		if name != "" {
+			ff.set(name, enabled)
+		}
+	}
+}
+
+func (ff *featureFlags) set(name string, enabled bool) {
+	ff.Lock()
+	defer ff.Unlock()
+	ff.flags[name] = enabled
+}
+
+func (ff *featureFlags) enabled(name string) bool {
+	ff.RLock()
+	defer ff.RUnlock()
+	return ff.flags[name]
+}
+
+// list returns the sorted names of all enabled flags.
+func (ff *featureFlags) list() []string {
+	ff.RLock()
+	defer ff.RUnlock()
+	var names []string
+	for name, enabled := range ff.flags {
+		if enabled {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// all returns all flags that have been set, enabled or not, sorted by name.
+func (ff *featureFlags) all() []AdminFeature {
+	ff.RLock()
+	defer ff.RUnlock()
+	list := []AdminFeature{}
+	for name, enabled := range ff.flags {
+		list = append(list, AdminFeature{name, enabled})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// FeatureEnabled returns whether the feature flag with the given name is
+// set on this server. Services and protocols can use it to roll out risky
+// changes to only part of a roster.
+func (c *Server) FeatureEnabled(name string) bool {
+	return c.features.enabled(name)
+}
+
+// SetFeature enables or disables the feature flag with the given name. It
+// can be called at any time, but services only see flags set before their
+// creation during their startup.
+func (c *Server) SetFeature(name string, enabled bool) {
+	c.features.set(name, enabled)
+	c.Audit(AuditConfigChange, auditLocal, "feature ", name, " enabled: ", enabled)
+}
+
+// SetFeatures sets the flags from a comma-separated list of names. Names
+// prefixed with a '-' are disabled, all others are enabled.
+func (c *Server) SetFeatures(list string) {
+	c.features.parse(list)
+	c.Audit(AuditConfigChange, auditLocal, "features ", list)
+}
+
+// Features returns the sorted names of all enabled feature flags.
+func (c *Server) Features() []string {
+	return c.features.list()
+}
+
+// loadFeaturesFromEnv sets the flags found in the CONODE_FEATURES
+// environment variable.
+func (c *Server) loadFeaturesFromEnv() {
+	c.features.parse(os.Getenv(featuresEnv))
+}
+
+// AdminFeature is a feature flag in the admin API.
+type AdminFeature struct {
+	Name    string
+	Enabled bool
+}
+
+// serveAdminFeatures lists the feature flags that have been set, and sets
+// one with PUT, e.g. {"Name":"fastPath","Enabled":true}.
+func (c *Server) serveAdminFeatures(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var f AdminFeature
+		if err := json.NewDecoder(r.Body).Decode(&f); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if f.Name == "" {
+			http.Error(w, "missing name", http.StatusBadRequest)
+			return
+		}
+		c.SetFeature(f.Name, f.Enabled)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeAdminJSON(w, c.features.all())
+}
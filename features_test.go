@@ -0,0 +1,64 @@
+package onet
+
+import (
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeatureFlags_Parse(t *testing.T) {
+	ff := newFeatureFlags()
+	ff.parse(" one, two,,-three ")
+	require.True(t, ff.enabled("one"))
+	require.True(t, ff.enabled("two"))
+	require.False(t, ff.enabled("three"))
+	require.False(t, ff.enabled("unknown"))
+	require.Equal(t, []string{"one", "two"}, ff.list())
+
+	ff.parse("-one")
+	require.False(t, ff.enabled("one"))
+	require.Equal(t, []string{"two"}, ff.list())
+}
+
+func TestServer_FeatureEnabled(t *testing.T) {
+	os.Setenv(featuresEnv, "newTreeBuilder")
+	defer os.Unsetenv(featuresEnv)
+	l := NewLocalTest(tSuite)
+	defer l.CloseAll()
+	s := l.GenServers(1)[0]
+
+	require.True(t, s.FeatureEnabled("newTreeBuilder"))
+	require.False(t, s.FeatureEnabled("fastPath"))
+	s.SetFeature("fastPath", true)
+	c := newContext(s, s.overlay, ServiceID{}, s.serviceManager)
+	require.True(t, c.FeatureEnabled("fastPath"))
+	require.Equal(t, "fastPath,newTreeBuilder", s.GetStatus().Field["Features"])
+}
+
+func TestServer_adminFeatures(t *testing.T) {
+	l := NewLocalTest(tSuite)
+	defer l.CloseAll()
+	s := l.GenServers(1)[0]
+	s.SetAdminToken(adminTestToken)
+	s.SetFeatures("-slowPath")
+
+	rec := adminRequest(s, "GET", "/admin/features", "127.0.0.1:1234", adminTestToken, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, `[{"Name":"slowPath","Enabled":false}]`+"\n", rec.Body.String())
+
+	rec = adminRequest(s, "PUT", "/admin/features", "127.0.0.1:1234", adminTestToken,
+		`{"Name":"fastPath","Enabled":true}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, `[{"Name":"fastPath","Enabled":true},{"Name":"slowPath","Enabled":false}]`+"\n",
+		rec.Body.String())
+	require.True(t, s.FeatureEnabled("fastPath"))
+
+	rec = adminRequest(s, "PUT", "/admin/features", "127.0.0.1:1234", adminTestToken, `{"Enabled":true}`)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = adminRequest(s, "PUT", "/admin/features", "127.0.0.1:1234", adminTestToken, `x`)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = adminRequest(s, "DELETE", "/admin/features", "127.0.0.1:1234", adminTestToken, "")
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
@@ -0,0 +1,304 @@
+//go:build !js
+// +build !js
+
+package onet
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dedis/kyber"
+	"github.com/dedis/kyber/sign/schnorr"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+	"gopkg.in/satori/go.uuid.v1"
+)
+
+// DefaultGossipFanout is the number of nodes a gossiped message is
+// forwarded to by every node, if GossipConfig.Fanout is 0.
+const DefaultGossipFanout = 3
+
+// MaxGossipFanout is the highest fanout a node uses to forward the gossiped
+// messages of the others, whatever the origin asked for.
+const MaxGossipFanout = 10
+
+// gossipSeenTimeout is how long the IDs of the gossiped messages are kept to
+// drop the copies received later on. Messages created longer ago are
+// dropped, so that they can't be replayed once their ID is forgotten.
+const gossipSeenTimeout = 10 * time.Minute
+
+// GossipConfig configures the dissemination of a message with
+// Overlay.Gossip.
+type GossipConfig struct {
+	// Fanout is the number of random nodes of the roster every node sends
+	// the message to. If 0, DefaultGossipFanout is used.
+	Fanout int
+	// Rounds is the number of times the message is forwarded. If 0, it is
+	// chosen so that all nodes receive the message with high probability.
+	Rounds int
+}
+
+// fanout returns the fanout to use in a roster of n nodes.
+func (conf *GossipConfig) fanout(n int) int {
+	f := DefaultGossipFanout
+	if conf != nil && conf.Fanout > 0 {
+		f = conf.Fanout
+	}
+	if f > n-1 {
+		f = n - 1
+	}
+	return f
+}
+
+// rounds returns the number of rounds to use in a roster of n nodes.
+func (conf *GossipConfig) rounds(n int) int {
+	if conf != nil && conf.Rounds > 0 {
+		return conf.Rounds
+	}
+	f := conf.fanout(n)
+	if f <= 1 {
+		return n
+	}
+	return int(math.Ceil(math.Log(float64(n))/math.Log(float64(f)))) + 2
+}
+
+// Broadcast sends msg to all members of the roster but this server, without
+// creating a protocol instance or a tree. The message is received by the
+// processors registered for its type, like with Context.SendRaw. The
+// errors of all members that couldn't be reached are returned together.
+func (o *Overlay) Broadcast(roster *Roster, msg network.Message) error {
+	var errs []string
+	var eMut sync.Mutex
+	var wg sync.WaitGroup
+	for _, si := range roster.List {
+		if si.ID.Equal(o.server.ServerIdentity.ID) {
+			continue
+		}
+		wg.Add(1)
+		go func(si *network.ServerIdentity) {
+			defer wg.Done()
+			if _, err := o.server.Send(si, msg); err != nil {
+				eMut.Lock()
+				errs = append(errs, si.Address.String()+": "+err.Error())
+				eMut.Unlock()
+			}
+		}(si)
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		return errors.New("broadcast failed: " + strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// Gossip disseminates msg to the members of the roster epidemically: it is
+// sent to a few random members, which send it on to a few others, and so
+// on. The members receive it as if this server had sent it to them, and
+// only once. The message is signed by this server, so the members only
+// accept it if this server is in the roster. Unlike Broadcast, the load is
+// spread over the roster, but there is no guarantee that all members get
+// the message. A nil conf uses the default fanout and rounds.
+func (o *Overlay) Gossip(roster *Roster, msg network.Message, conf *GossipConfig) error {
+	if len(roster.List) < 2 {
+		return nil
+	}
+	buf, err := network.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	// If the key of this server has been rotated, the roster can still
+	// hold the old key, which signs while it is in its grace period.
+	origin := o.server.ServerIdentity.Copy()
+	if _, si := roster.Search(origin.ID); si != nil && si.Public != nil {
+		origin.Public = si.Public
+	}
+	gm := &GossipMsg{
+		ID:      newUUID(),
+		Origin:  origin,
+		Roster:  roster,
+		Rounds:  conf.rounds(len(roster.List)),
+		Fanout:  conf.fanout(len(roster.List)),
+		Created: time.Now().UnixNano(),
+		Msg:     buf,
+	}
+	h, err := gm.hash()
+	if err != nil {
+		return err
+	}
+	gm.Signature, err = schnorr.Sign(o.suite(), o.server.privateFor(origin.Public), h)
+	if err != nil {
+		return err
+	}
+	o.gossipSeen.add(gm.ID)
+	return o.forwardGossip(gm, gm.Fanout)
+}
+
+// hash returns the hash signed by the origin. Round is left out, as every
+// node changes it.
+func (gm *GossipMsg) hash() ([]byte, error) {
+	rh, err := gm.Roster.Hash()
+	if err != nil {
+		return nil, err
+	}
+	pub, err := gm.Origin.Public.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	h.Write(gm.ID[:])
+	h.Write(pub)
+	h.Write([]byte(gm.Origin.Address))
+	h.Write(rh)
+	binary.Write(h, binary.BigEndian, int64(gm.Rounds))
+	binary.Write(h, binary.BigEndian, int64(gm.Fanout))
+	binary.Write(h, binary.BigEndian, gm.Created)
+	h.Write(gm.Msg)
+	return h.Sum(nil), nil
+}
+
+// verify checks that the message has been signed by its origin, which is
+// a member of the roster, less than gossipSeenTimeout ago. rotated returns the latest key announced by a
+// server that rotated its key, see Server.RotateKey.
+func (gm *GossipMsg) verify(suite network.Suite, rotated func(network.ServerIdentityID) kyber.Point) error {
+	if gm.Origin == nil || gm.Origin.Public == nil || gm.Roster == nil {
+		return errors.New("missing origin or roster")
+	}
+	if age := time.Since(time.Unix(0, gm.Created)); age > gossipSeenTimeout || age < -gossipSeenTimeout {
+		return errors.New("message too old or from the future")
+	}
+	if !network.NewServerIdentity(gm.Origin.Public, gm.Origin.Address).ID.Equal(gm.Origin.ID) {
+		// The ID of a server that rotated its key is derived from its
+		// first key.
+		if pub := rotated(gm.Origin.ID); pub == nil || !pub.Equal(gm.Origin.Public) {
+			return errors.New("origin ID doesn't match its key")
+		}
+	}
+	member := false
+	for _, si := range gm.Roster.List {
+		if si.ID.Equal(gm.Origin.ID) && si.Public != nil && si.Public.Equal(gm.Origin.Public) {
+			member = true
+			break
+		}
+	}
+	if !member {
+		return errors.New("origin is not in the roster")
+	}
+	h, err := gm.hash()
+	if err != nil {
+		return err
+	}
+	return schnorr.Verify(suite, gm.Origin.Public, h, gm.Signature)
+}
+
+// forwardGossip sends the next round of the gossiped message to fanout
+// random members, other than this server and the origin. It only fails if
+// none of them could be reached.
+func (o *Overlay) forwardGossip(gm *GossipMsg, fanout int) error {
+	next := *gm
+	next.Round++
+	var lastErr error
+	sent := 0
+	for _, i := range randPerm(len(gm.Roster.List)) {
+		if sent == fanout {
+			break
+		}
+		si := gm.Roster.List[i]
+		if si.ID.Equal(o.server.ServerIdentity.ID) || si.ID.Equal(gm.Origin.ID) {
+			continue
+		}
+		if _, err := o.server.Send(si, &next); err != nil {
+			log.Lvl2(o.server.Address(), "couldn't gossip to", si, ":", err)
+			lastErr = err
+			continue
+		}
+		sent++
+	}
+	if sent == 0 && lastErr != nil {
+		return lastErr
+	}
+	return nil
+}
+
+// handleGossip delivers a gossiped message the first time it is received,
+// and forwards it if there are rounds left.
+func (o *Overlay) handleGossip(env *network.Envelope) {
+	gm, ok := env.Msg.(*GossipMsg)
+	if !ok {
+		log.Error(o.server.Address(), "wrong gossip type")
+		return
+	}
+	if err := gm.verify(o.suite(), o.server.rotatedKey); err != nil {
+		log.Lvl2(o.server.Address(), "dropping gossip from", env.ServerIdentity, ":", err)
+		return
+	}
+	if !o.gossipSeen.add(gm.ID) {
+		return
+	}
+	// The origin chose the rounds and fanout, which are signed, but this
+	// node doesn't forward more than its own limits.
+	rounds, fanout := gm.Rounds, gm.Fanout
+	if n := len(gm.Roster.List); rounds > n {
+		rounds = n
+	}
+	if fanout > MaxGossipFanout {
+		fanout = MaxGossipFanout
+	}
+	if gm.Round < rounds {
+		if err := o.forwardGossip(gm, fanout); err != nil {
+			log.Lvl2(o.server.Address(), "couldn't forward gossip:", err)
+		}
+	}
+	typ, msg, err := network.Unmarshal(gm.Msg, o.suite())
+	if err != nil {
+		log.Error(o.server.Address(), "couldn't unmarshal gossip:", err)
+		return
+	}
+	err = o.server.Dispatch(&network.Envelope{
+		ServerIdentity: gm.Origin,
+		MsgType:        typ,
+		Msg:            msg,
+		Size:           network.Size(len(gm.Msg)),
+	})
+	if err != nil {
+		log.Error(o.server.Address(), "couldn't deliver gossip:", err)
+	}
+}
+
+// gossipSeen remembers the IDs of the gossiped messages for some time.
+type gossipSeen struct {
+	ids       map[uuid.UUID]time.Time
+	lastPrune time.Time
+	sync.Mutex
+}
+
+func newGossipSeen() *gossipSeen {
+	return &gossipSeen{
+		ids:       make(map[uuid.UUID]time.Time),
+		lastPrune: time.Now(),
+	}
+}
+
+// add returns true if the ID has not been seen yet, and remembers it.
+func (gs *gossipSeen) add(id uuid.UUID) bool {
+	gs.Lock()
+	defer gs.Unlock()
+	now := time.Now()
+	if now.Sub(gs.lastPrune) > gossipSeenTimeout {
+		for i, t := range gs.ids {
+			if now.Sub(t) > gossipSeenTimeout {
+				delete(gs.ids, i)
+			}
+		}
+		gs.lastPrune = now
+	}
+	if _, ok := gs.ids[id]; ok {
+		return false
+	}
+	gs.ids[id] = now
+	return true
+}
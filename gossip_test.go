@@ -0,0 +1,173 @@
+package onet
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dedis/kyber"
+	"github.com/dedis/kyber/sign/schnorr"
+	"github.com/dedis/kyber/util/key"
+	"github.com/dedis/onet/network"
+	"github.com/stretchr/testify/require"
+)
+
+// countReceived registers a processor for SimpleResponse on every server
+// and returns the counters of the received messages by origin.
+func countReceived(servers []*Server) (map[network.ServerIdentityID]int, *sync.Mutex) {
+	received := make(map[network.ServerIdentityID]int)
+	mut := &sync.Mutex{}
+	for _, s := range servers {
+		s := s
+		s.RegisterProcessorFunc(SimpleResponseType, func(env *network.Envelope) {
+			mut.Lock()
+			defer mut.Unlock()
+			received[s.ServerIdentity.ID]++
+			if !env.ServerIdentity.ID.Equal(servers[0].ServerIdentity.ID) {
+				received[network.ServerIdentityID{}]++
+			}
+		})
+	}
+	return received, mut
+}
+
+// waitReceived waits until all servers but the first received the message
+// once.
+func waitReceived(t *testing.T, servers []*Server, received map[network.ServerIdentityID]int,
+	mut *sync.Mutex) {
+	for i := 0; i < 100; i++ {
+		mut.Lock()
+		n := len(received)
+		mut.Unlock()
+		if n == len(servers)-1 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// give the copies time to arrive
+	time.Sleep(50 * time.Millisecond)
+	mut.Lock()
+	defer mut.Unlock()
+	require.Equal(t, len(servers)-1, len(received), "wrong origin or missing messages")
+	for _, s := range servers[1:] {
+		require.Equal(t, 1, received[s.ServerIdentity.ID])
+	}
+}
+
+func TestOverlay_Broadcast(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	servers, roster, _ := local.GenTree(5, false)
+	received, mut := countReceived(servers)
+
+	require.Nil(t, servers[0].overlay.Broadcast(roster, &SimpleResponse{1}))
+	waitReceived(t, servers, received, mut)
+}
+
+func TestOverlay_Gossip(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	servers, roster, _ := local.GenTree(5, false)
+	received, mut := countReceived(servers)
+
+	// with a fanout of the whole roster, every node gets it in the first
+	// round, and drops the copies of the next rounds
+	require.Nil(t, servers[0].overlay.Gossip(roster, &SimpleResponse{1},
+		&GossipConfig{Fanout: 4, Rounds: 3}))
+	waitReceived(t, servers, received, mut)
+}
+
+func TestGossipConfig(t *testing.T) {
+	var conf *GossipConfig
+	require.Equal(t, DefaultGossipFanout, conf.fanout(10))
+	require.Equal(t, 1, conf.fanout(2))
+	require.Equal(t, 2, conf.rounds(2))
+	require.Equal(t, 5, conf.rounds(10))
+
+	conf = &GossipConfig{Fanout: 5, Rounds: 2}
+	require.Equal(t, 5, conf.fanout(10))
+	require.Equal(t, 2, conf.rounds(10))
+}
+
+func TestGossipSeen(t *testing.T) {
+	gs := newGossipSeen()
+	id := newUUID()
+	require.True(t, gs.add(id))
+	require.False(t, gs.add(id))
+
+	gs.ids[id] = time.Now().Add(-2 * gossipSeenTimeout)
+	gs.lastPrune = time.Now().Add(-2 * gossipSeenTimeout)
+	require.True(t, gs.add(id))
+}
+
+func TestGossipMsg_Verify(t *testing.T) {
+	var kps []*key.Pair
+	var ids []*network.ServerIdentity
+	for i := 0; i < 3; i++ {
+		kp := key.NewKeyPair(tSuite)
+		kps = append(kps, kp)
+		ids = append(ids, network.NewServerIdentity(kp.Public,
+			network.NewAddress(network.PlainTCP, "127.0.0.1:2000")))
+	}
+	roster := NewRoster(ids[:2])
+	sign := func(gm *GossipMsg, kp *key.Pair) {
+		h, err := gm.hash()
+		require.Nil(t, err)
+		gm.Signature, err = schnorr.Sign(tSuite, kp.Private, h)
+		require.Nil(t, err)
+	}
+	noRotation := func(network.ServerIdentityID) kyber.Point { return nil }
+	now := time.Now().UnixNano()
+	gm := &GossipMsg{ID: newUUID(), Origin: ids[0], Roster: roster, Rounds: 2, Fanout: 1,
+		Created: now, Msg: []byte("x")}
+	sign(gm, kps[0])
+	require.Nil(t, gm.verify(tSuite, noRotation))
+
+	// The round can change, but not the other fields
+	gm.Round = 1
+	require.Nil(t, gm.verify(tSuite, noRotation))
+	gm.Fanout = 5
+	require.NotNil(t, gm.verify(tSuite, noRotation))
+	gm.Fanout = 1
+	gm.Msg = []byte("y")
+	require.NotNil(t, gm.verify(tSuite, noRotation))
+	gm.Msg = []byte("x")
+	gm.Created++
+	require.NotNil(t, gm.verify(tSuite, noRotation))
+	gm.Created = now
+
+	// Messages older than the seen IDs are dropped, even if signed
+	old := *gm
+	old.Created = time.Now().Add(-2 * gossipSeenTimeout).UnixNano()
+	sign(&old, kps[0])
+	require.NotNil(t, old.verify(tSuite, noRotation))
+
+	// Another node can't pretend to be the origin
+	forged := *gm
+	forged.Origin = ids[1]
+	sign(&forged, kps[0])
+	require.NotNil(t, forged.verify(tSuite, noRotation))
+	forged.Origin = &network.ServerIdentity{ID: ids[0].ID, Public: ids[1].Public, Address: ids[0].Address}
+	sign(&forged, kps[1])
+	require.NotNil(t, forged.verify(tSuite, noRotation))
+
+	// The origin must be in the roster
+	outsider := *gm
+	outsider.Origin = ids[2]
+	sign(&outsider, kps[2])
+	require.NotNil(t, outsider.verify(tSuite, noRotation))
+
+	// A server that rotated its key keeps its ID
+	kp := key.NewKeyPair(tSuite)
+	rotated := &network.ServerIdentity{ID: ids[0].ID, Public: kp.Public, Address: ids[0].Address}
+	gm = &GossipMsg{ID: newUUID(), Origin: rotated, Roster: NewRoster([]*network.ServerIdentity{rotated, ids[1]}),
+		Rounds: 2, Fanout: 1, Created: now, Msg: []byte("x")}
+	sign(gm, kp)
+	require.NotNil(t, gm.verify(tSuite, noRotation))
+	require.Nil(t, gm.verify(tSuite, func(id network.ServerIdentityID) kyber.Point {
+		if id.Equal(ids[0].ID) {
+			return kp.Public
+		}
+		return nil
+	}))
+}
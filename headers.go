@@ -0,0 +1,161 @@
+// +build !js
+
+package onet
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dedis/onet/log"
+)
+
+// DefaultSecurityHeaders are set on every response of the websocket port if
+// HTTPHeaders.Security is nil.
+var DefaultSecurityHeaders = map[string]string{
+	"X-Content-Type-Options": "nosniff",
+	"X-Frame-Options":        "DENY",
+	"Referrer-Policy":        "no-referrer",
+}
+
+// HTTPHeaders configures the CORS and security headers of the websocket
+// port of a server, so that browsers can talk to it without a proxy. It is
+// set for the whole server with Server.SetHTTPHeaders, and a service can
+// override it with Context.SetHTTPHeaders.
+type HTTPHeaders struct {
+	// AllowedOrigins are the origins allowed for CORS requests and
+	// websockets, like "https://example.com". "*" allows all origins. If
+	// empty, all origins are allowed.
+	AllowedOrigins []string
+	// AllowedMethods are returned on preflight requests. If empty, only
+	// GET and OPTIONS are allowed.
+	AllowedMethods []string
+	// AllowedHeaders are the request headers allowed in CORS requests.
+	AllowedHeaders []string
+	// MaxAge is how many seconds browsers can cache a preflight response.
+	MaxAge int
+	// Security are set on every response, for example
+	// Strict-Transport-Security or Content-Security-Policy. If nil,
+	// DefaultSecurityHeaders are used.
+	Security map[string]string
+}
+
+// originAllowed returns whether a request from origin is allowed. Requests
+// without an origin don't come from a browser and are always allowed.
+func (h *HTTPHeaders) originAllowed(origin string) bool {
+	if h == nil || len(h.AllowedOrigins) == 0 || origin == "" {
+		return true
+	}
+	for _, o := range h.AllowedOrigins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// apply sets the headers of the response to r. It returns false if the
+// request is a preflight request, which has been answered.
+func (h *HTTPHeaders) apply(w http.ResponseWriter, r *http.Request) bool {
+	if h == nil {
+		return true
+	}
+	header := w.Header()
+	security := h.Security
+	if security == nil {
+		security = DefaultSecurityHeaders
+	}
+	for k, v := range security {
+		header.Set(k, v)
+	}
+
+	origin := r.Header.Get("Origin")
+	if origin != "" && h.originAllowed(origin) {
+		header.Set("Access-Control-Allow-Origin", origin)
+		header.Add("Vary", "Origin")
+	}
+	if r.Method != http.MethodOptions ||
+		r.Header.Get("Access-Control-Request-Method") == "" {
+		return true
+	}
+	methods := h.AllowedMethods
+	if len(methods) == 0 {
+		methods = []string{http.MethodGet, http.MethodOptions}
+	}
+	header.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+	if len(h.AllowedHeaders) > 0 {
+		header.Set("Access-Control-Allow-Headers", strings.Join(h.AllowedHeaders, ", "))
+	}
+	if h.MaxAge > 0 {
+		header.Set("Access-Control-Max-Age", strconv.Itoa(h.MaxAge))
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return false
+}
+
+// SetHTTPHeaders sets the CORS and security headers of the websocket port.
+// A nil h removes them, and all origins are allowed.
+func (c *Server) SetHTTPHeaders(h *HTTPHeaders) {
+	c.websocket.setHTTPHeaders("", h)
+}
+
+// SetHTTPHeaders sets the CORS and security headers of the endpoints of the
+// service, instead of the ones of the server. A nil h uses the ones of the
+// server again.
+func (c *Context) SetHTTPHeaders(h *HTTPHeaders) {
+	c.server.websocket.setHTTPHeaders(c.name, h)
+}
+
+// setHTTPHeaders sets the headers of the service, or of the whole server
+// if service is empty.
+func (w *WebSocket) setHTTPHeaders(service string, h *HTTPHeaders) {
+	w.Lock()
+	defer w.Unlock()
+	if service == "" {
+		w.headers = h
+		return
+	}
+	if h == nil {
+		delete(w.serviceHeaders, service)
+		return
+	}
+	w.serviceHeaders[service] = h
+}
+
+// httpHeaders returns the headers for the request to path.
+func (w *WebSocket) httpHeaders(path string) *HTTPHeaders {
+	service := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2)[0]
+	w.Lock()
+	defer w.Unlock()
+	if h, ok := w.serviceHeaders[service]; ok {
+		return h
+	}
+	return w.headers
+}
+
+// headerHandler sets the headers of all responses of the websocket port.
+type headerHandler struct {
+	ws *WebSocket
+}
+
+func (hh headerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !hh.ws.getACL().AllowsAddress(r.RemoteAddr) {
+		log.Lvl2("Refusing request from", r.RemoteAddr)
+		hh.ws.audit.record(AuditAuthFailure, r.RemoteAddr, "refused by the ACL: ", r.URL.Path)
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	if !hh.ws.httpHeaders(r.URL.Path).apply(w, r) {
+		return
+	}
+	hh.ws.mux.ServeHTTP(w, r)
+}
+
+// checkOrigin is used by the websocket upgraders to refuse the origins that
+// are not allowed.
+func (w *WebSocket) checkOrigin(r *http.Request) bool {
+	if w == nil {
+		return true
+	}
+	return w.httpHeaders(r.URL.Path).originAllowed(r.Header.Get("Origin"))
+}
@@ -0,0 +1,83 @@
+package onet
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dedis/onet/network"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPHeaders_originAllowed(t *testing.T) {
+	var h *HTTPHeaders
+	require.True(t, h.originAllowed("https://evil.com"))
+	h = &HTTPHeaders{}
+	require.True(t, h.originAllowed("https://evil.com"))
+	h.AllowedOrigins = []string{"https://example.com"}
+	require.True(t, h.originAllowed("https://EXAMPLE.com"))
+	require.True(t, h.originAllowed(""))
+	require.False(t, h.originAllowed("https://evil.com"))
+	h.AllowedOrigins = append(h.AllowedOrigins, "*")
+	require.True(t, h.originAllowed("https://evil.com"))
+}
+
+func TestWebSocket_HTTPHeaders(t *testing.T) {
+	si := &network.ServerIdentity{Address: network.NewAddress(network.PlainTCP, "127.0.0.1:2170")}
+	w := NewWebSocket(si)
+	handler := headerHandler{w}
+	get := func(method, path, origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		if method == http.MethodOptions {
+			req.Header.Set("Access-Control-Request-Method", "GET")
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Without configuration, nothing is added.
+	rec := get("GET", "/ok", "https://example.com")
+	require.Equal(t, "ok\n", rec.Body.String())
+	require.Empty(t, rec.Header().Get("X-Frame-Options"))
+
+	w.setHTTPHeaders("", &HTTPHeaders{
+		AllowedOrigins: []string{"https://example.com"},
+		MaxAge:         600,
+	})
+	rec = get("GET", "/ok", "https://example.com")
+	require.Equal(t, "ok\n", rec.Body.String())
+	require.Equal(t, "https://example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+	require.Equal(t, "DENY", rec.Header().Get("X-Frame-Options"))
+	rec = get("GET", "/ok", "https://evil.com")
+	require.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+
+	rec = get(http.MethodOptions, "/ok", "https://example.com")
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	require.Equal(t, "GET, OPTIONS", rec.Header().Get("Access-Control-Allow-Methods"))
+	require.Equal(t, "600", rec.Header().Get("Access-Control-Max-Age"))
+
+	// A service can have its own headers.
+	w.setHTTPHeaders("Open", &HTTPHeaders{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{"GET", "POST"},
+		Security:       map[string]string{},
+	})
+	req := httptest.NewRequest("GET", "/Open/Request", nil)
+	req.Header.Set("Origin", "https://evil.com")
+	require.True(t, w.checkOrigin(req))
+	req = httptest.NewRequest("GET", "/Closed/Request", nil)
+	req.Header.Set("Origin", "https://evil.com")
+	require.False(t, w.checkOrigin(req))
+	rec = get(http.MethodOptions, "/Open/Request", "https://evil.com")
+	require.Equal(t, "GET, POST", rec.Header().Get("Access-Control-Allow-Methods"))
+	require.Empty(t, rec.Header().Get("X-Frame-Options"))
+
+	w.setHTTPHeaders("Open", nil)
+	req = httptest.NewRequest("GET", "/Open/Request", nil)
+	req.Header.Set("Origin", "https://evil.com")
+	require.False(t, w.checkOrigin(req))
+}
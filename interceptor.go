@@ -0,0 +1,58 @@
+package onet
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/dedis/onet/network"
+)
+
+// ClientRequest is a request sent by Client.Send, as seen by the
+// interceptors. Interceptors can change all fields before calling the next
+// step of the chain.
+type ClientRequest struct {
+	// Destination is the server receiving the request.
+	Destination *network.ServerIdentity
+	// Service and Path form the endpoint on the server.
+	Service string
+	Path    string
+	// Header is sent when the websocket connection is opened. If the client
+	// keeps its connections, later requests to the same endpoint reuse the
+	// connection and their headers are not sent.
+	Header http.Header
+	// Payload is the encoded message.
+	Payload []byte
+	// Context cancels the request, see Client.SendWithContext. It is
+	// context.Background() for Client.Send.
+	Context context.Context
+}
+
+// ClientInvoker sends a request and returns the reply.
+type ClientInvoker func(req *ClientRequest) ([]byte, error)
+
+// ClientInterceptor is called for every request of a Client. It can
+// inspect or change the request, call next to continue, and inspect or
+// change the reply. Not calling next stops the request, which lets the
+// interceptor return a reply of its own.
+type ClientInterceptor func(req *ClientRequest, next ClientInvoker) ([]byte, error)
+
+// AddInterceptor appends ci to the interceptors of the client. The first
+// interceptor added is the first one called.
+func (c *Client) AddInterceptor(ci ClientInterceptor) {
+	c.Lock()
+	defer c.Unlock()
+	c.interceptors = append(c.interceptors, ci)
+}
+
+// chainInterceptors returns an invoker that calls all interceptors in
+// order, and last.
+func chainInterceptors(cis []ClientInterceptor, last ClientInvoker) ClientInvoker {
+	next := last
+	for i := len(cis) - 1; i >= 0; i-- {
+		ci, n := cis[i], next
+		next = func(req *ClientRequest) ([]byte, error) {
+			return ci(req, n)
+		}
+	}
+	return next
+}
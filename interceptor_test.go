@@ -0,0 +1,65 @@
+package onet
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/dedis/onet/network"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChainInterceptors(t *testing.T) {
+	var calls []string
+	last := func(req *ClientRequest) ([]byte, error) {
+		calls = append(calls, "last:"+req.Path)
+		return []byte("reply"), nil
+	}
+	first := func(req *ClientRequest, next ClientInvoker) ([]byte, error) {
+		calls = append(calls, "first")
+		req.Path = "rewritten"
+		return next(req)
+	}
+	second := func(req *ClientRequest, next ClientInvoker) ([]byte, error) {
+		calls = append(calls, "second")
+		reply, err := next(req)
+		return append(reply, '!'), err
+	}
+	reply, err := chainInterceptors([]ClientInterceptor{first, second}, last)(
+		&ClientRequest{Path: "orig"})
+	require.Nil(t, err)
+	require.Equal(t, "reply!", string(reply))
+	require.Equal(t, []string{"first", "second", "last:rewritten"}, calls)
+
+	stop := func(req *ClientRequest, next ClientInvoker) ([]byte, error) {
+		return nil, errors.New("stopped")
+	}
+	calls = nil
+	_, err = chainInterceptors([]ClientInterceptor{stop, first}, last)(&ClientRequest{})
+	require.NotNil(t, err)
+	require.Nil(t, calls)
+}
+
+func TestClient_Interceptor(t *testing.T) {
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	RegisterNewService(backForthServiceName, func(c *Context) (Service, error) {
+		return &simpleService{ctx: c}, nil
+	})
+	defer ServiceFactory.Unregister(backForthServiceName)
+	servers, ro, _ := local.GenTree(2, false)
+
+	client := local.NewClient(backForthServiceName)
+	var seen []*network.ServerIdentity
+	client.AddInterceptor(func(req *ClientRequest, next ClientInvoker) ([]byte, error) {
+		seen = append(seen, req.Destination)
+		req.Header.Set("Authorization", "test")
+		// Always send to the second server.
+		req.Destination = servers[1].ServerIdentity
+		return next(req)
+	})
+	sr := &SimpleResponse{}
+	require.Nil(t, client.SendProtobuf(servers[0].ServerIdentity,
+		&SimpleRequest{ServerIdentities: ro, Val: 10}, sr))
+	require.Equal(t, 10, sr.Val)
+	require.Equal(t, []*network.ServerIdentity{servers[0].ServerIdentity}, seen)
+}
@@ -0,0 +1,137 @@
+// +build !js
+
+package onet
+
+import (
+	"encoding/binary"
+	"errors"
+
+	bolt "github.com/coreos/bbolt"
+)
+
+// JournalReplayer is implemented by the services that journal their
+// operations. When the server starts, ReplayJournal is called for every
+// entry of the journal of the service, as with Context.ReplayJournal, after
+// the service is created and before it gets any request or message. An
+// error stops the server.
+type JournalReplayer interface {
+	ReplayJournal(seq uint64, op []byte) error
+}
+
+// journalBucket holds one bucket per service with its journal entries,
+// under their sequence number.
+var journalBucket = []byte("onet_journal")
+
+// Journal appends op to the write-ahead journal of the service and returns
+// its sequence number. The entry is on disk when Journal returns, so a
+// service journals an operation before applying it to its state, and calls
+// JournalDone once the new state is saved. After a crash, ReplayJournal
+// gives the operations whose state might be lost.
+func (c *Context) Journal(op []byte) (uint64, error) {
+	var seq uint64
+	err := c.manager.dbUpdate(func(tx *bolt.Tx) error {
+		b, err := c.journal(tx, true)
+		if err != nil {
+			return err
+		}
+		seq, err = b.NextSequence()
+		if err != nil {
+			return err
+		}
+		return b.Put(journalKey(seq), op)
+	})
+	return seq, err
+}
+
+// JournalDone removes the entries of the journal up to seq, whose
+// operations are in the saved state of the service.
+func (c *Context) JournalDone(seq uint64) error {
+	return c.manager.dbUpdate(func(tx *bolt.Tx) error {
+		b, err := c.journal(tx, false)
+		if b == nil {
+			return err
+		}
+		var done [][]byte
+		cur := b.Cursor()
+		for k, _ := cur.First(); k != nil && binary.BigEndian.Uint64(k) <= seq; k, _ = cur.Next() {
+			done = append(done, append([]byte{}, k...))
+		}
+		for _, k := range done {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ReplayJournal calls apply for every operation in the journal, in the
+// order they were journaled. A service calls it when it starts, after
+// loading its saved state, to redo the operations that were not saved
+// before a crash, or implements JournalReplayer to have the server do it
+// before the service gets any request. It stops at the first error of apply. The entries stay
+// in the journal until JournalDone is called.
+func (c *Context) ReplayJournal(apply func(seq uint64, op []byte) error) error {
+	type entry struct {
+		seq uint64
+		op  []byte
+	}
+	var entries []entry
+	err := c.manager.dbView(func(tx *bolt.Tx) error {
+		b, err := c.journal(tx, false)
+		if b == nil {
+			return err
+		}
+		return b.ForEach(func(k, v []byte) error {
+			entries = append(entries, entry{binary.BigEndian.Uint64(k),
+				append([]byte{}, v...)})
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := apply(e.seq, e.op); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replayJournal gives the journal of the service to its ReplayJournal, if
+// it is a JournalReplayer.
+func replayJournal(svc Service, c *Context) error {
+	r, ok := svc.(JournalReplayer)
+	if !ok {
+		return nil
+	}
+	return c.ReplayJournal(r.ReplayJournal)
+}
+
+// journal returns the journal bucket of the service. If it doesn't exist,
+// it is created if create is set, else nil is returned.
+func (c *Context) journal(tx *bolt.Tx, create bool) (*bolt.Bucket, error) {
+	if !create {
+		b := tx.Bucket(journalBucket)
+		if b == nil {
+			return nil, nil
+		}
+		return b.Bucket(c.bucketName), nil
+	}
+	if !tx.Writable() {
+		return nil, errors.New("can't create journal in a read transaction")
+	}
+	b, err := tx.CreateBucketIfNotExists(journalBucket)
+	if err != nil {
+		return nil, err
+	}
+	return b.CreateBucketIfNotExists(c.bucketName)
+}
+
+// journalKey returns the key of the entry seq, sorting like the numbers.
+func journalKey(seq uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, seq)
+	return k
+}
@@ -0,0 +1,100 @@
+package onet
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/dedis/kyber/util/key"
+	"github.com/dedis/onet/network"
+	"github.com/stretchr/testify/require"
+)
+
+const journalServiceName = "JournalService"
+
+// journalService keeps the operations replayed when it starts.
+type journalService struct {
+	*ServiceProcessor
+	replayed []string
+}
+
+func init() {
+	RegisterNewService(journalServiceName, func(c *Context) (Service, error) {
+		return &journalService{ServiceProcessor: NewServiceProcessor(c)}, nil
+	})
+}
+
+func (s *journalService) ReplayJournal(seq uint64, op []byte) error {
+	s.replayed = append(s.replayed, string(op))
+	return nil
+}
+
+func TestContext_Journal(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	s := local.GenServers(1)[0]
+	c := s.Service(callServiceName).(*callService).Context
+
+	replay := func() (ops []string) {
+		require.Nil(t, c.ReplayJournal(func(seq uint64, op []byte) error {
+			ops = append(ops, string(op))
+			return nil
+		}))
+		return
+	}
+	require.Empty(t, replay())
+	require.Nil(t, c.JournalDone(10))
+
+	seq1, err := c.Journal([]byte("one"))
+	require.Nil(t, err)
+	seq2, err := c.Journal([]byte("two"))
+	require.Nil(t, err)
+	require.True(t, seq2 > seq1)
+	require.Equal(t, []string{"one", "two"}, replay())
+
+	require.Nil(t, c.JournalDone(seq1))
+	require.Equal(t, []string{"two"}, replay())
+
+	errApply := errors.New("can't apply")
+	require.Equal(t, errApply, c.ReplayJournal(func(uint64, []byte) error {
+		return errApply
+	}))
+
+	// The journals of the services are separate
+	other := s.Service(tenantServiceName).(*tenantService).c
+	require.Nil(t, other.ReplayJournal(func(uint64, []byte) error {
+		return errApply
+	}))
+
+	require.Nil(t, c.JournalDone(seq2))
+	require.Empty(t, replay())
+}
+
+func TestJournalReplayer(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "journal")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmp)
+	dbPath := path.Join(tmp, "db")
+	kp := key.NewKeyPair(tSuite)
+	si := network.NewServerIdentity(kp.Public, network.NewAddress(network.PlainTCP, "127.0.0.1:0"))
+	si.SetPrivate(kp.Private)
+
+	s, err := NewServerTCPWithDB(si, tSuite, dbPath)
+	require.Nil(t, err)
+	js := s.Service(journalServiceName).(*journalService)
+	require.Empty(t, js.replayed)
+	seq, err := js.Journal([]byte("one"))
+	require.Nil(t, err)
+	_, err = js.Journal([]byte("two"))
+	require.Nil(t, err)
+	require.Nil(t, js.JournalDone(seq))
+	require.Nil(t, s.Close())
+
+	// After a restart, the service gets the operations not done yet
+	s, err = NewServerTCPWithDB(si, tSuite, dbPath)
+	require.Nil(t, err)
+	defer s.Close()
+	require.Equal(t, []string{"two"}, s.Service(journalServiceName).(*journalService).replayed)
+}
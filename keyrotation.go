@@ -0,0 +1,254 @@
+// +build !js
+
+package onet
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dedis/kyber"
+	"github.com/dedis/kyber/sign/schnorr"
+	"github.com/dedis/kyber/util/key"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+)
+
+// KeyRotation is sent to the peers of a server that changes its keypair. It
+// is signed by the old key, so that the peers can trust the new key.
+type KeyRotation struct {
+	// OldPublic is the key that is replaced
+	OldPublic kyber.Point
+	// New is the ServerIdentity with the new key and the same ID
+	New *network.ServerIdentity
+	// Signature by the old key on the hash of the new identity
+	Signature []byte
+}
+
+// KeyRotationMsgID is the message type of KeyRotation.
+var KeyRotationMsgID = network.RegisterMessage(KeyRotation{})
+
+// hash returns the message signed by the old key.
+func (kr *KeyRotation) hash() ([]byte, error) {
+	h := sha256.New()
+	for _, p := range []kyber.Point{kr.OldPublic, kr.New.Public} {
+		buf, err := p.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		h.Write(buf)
+	}
+	h.Write([]byte(kr.New.Address))
+	return h.Sum(nil), nil
+}
+
+// retiredKey is an old keypair of this server that is still valid until
+// expires.
+type retiredKey struct {
+	public  kyber.Point
+	private kyber.Scalar
+	expires time.Time
+}
+
+// keyRotations holds the keys this server retired and the rotations
+// announced by its peers.
+type keyRotations struct {
+	retired []retiredKey
+	// peers maps the ServerIdentityID of a peer to its latest identity.
+	peers map[network.ServerIdentityID]*network.ServerIdentity
+	sync.Mutex
+}
+
+func newKeyRotations() *keyRotations {
+	return &keyRotations{peers: make(map[network.ServerIdentityID]*network.ServerIdentity)}
+}
+
+// KeySaver stores the new keypair of the server when it is rotated, so that
+// the server restarts with it, see SetKeySaver.
+type KeySaver func(public kyber.Point, private kyber.Scalar) error
+
+// SetKeySaver sets the function RotateKey calls to store the new keypair
+// before using it. Without a KeySaver, a rotated key is lost when the server
+// stops.
+func (c *Server) SetKeySaver(ks KeySaver) {
+	c.keyLock.Lock()
+	defer c.keyLock.Unlock()
+	c.keySaver = ks
+}
+
+// privateKey returns the current private key of the server.
+func (c *Server) privateKey() kyber.Scalar {
+	c.keyLock.RLock()
+	defer c.keyLock.RUnlock()
+	return c.private
+}
+
+// privateFor returns the private key of public, if it is the current key of
+// the server or a retired key in its grace period, else the current private
+// key.
+func (c *Server) privateFor(public kyber.Point) kyber.Scalar {
+	if public != nil {
+		if private := c.retiredPrivate(public); private != nil {
+			return private
+		}
+	}
+	return c.privateKey()
+}
+
+// RotateKey replaces the keypair of this server by a new one. The new key
+// is first given to the KeySaver, if any, and RotateKey fails without
+// changing anything if it can't be stored. The new ServerIdentity is
+// announced, signed by the old key, to all members of the rosters known to
+// this server. During the grace period the old key is still accepted as one
+// of ours, for example to sign rosters created before the rotation.
+//
+// The ServerIdentity of the server keeps its ID, so the rosters and trees
+// still find it, and only its keys are replaced, see
+// network.ServerIdentity.SetKeys. RotateKey returns a copy of it.
+func (c *Server) RotateKey(grace time.Duration) (*network.ServerIdentity, error) {
+	c.rotateLock.Lock()
+	defer c.rotateLock.Unlock()
+	kp := key.NewKeyPair(c.suite)
+	own := c.ServerIdentity
+	oldPrivate := c.privateKey()
+	kr := &KeyRotation{
+		OldPublic: own.GetPublic(),
+		New:       own.Copy(),
+	}
+	kr.New.Public = kp.Public
+	msg, err := kr.hash()
+	if err != nil {
+		return nil, err
+	}
+	kr.Signature, err = schnorr.Sign(c.suite, oldPrivate, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	c.keyLock.RLock()
+	ks := c.keySaver
+	c.keyLock.RUnlock()
+	if ks != nil {
+		if err := ks(kp.Public, kp.Private); err != nil {
+			return nil, fmt.Errorf("couldn't store the new key: %v", err)
+		}
+	}
+
+	// The announcement must go out over the connections that are
+	// authenticated with the old key.
+	for _, si := range c.overlay.peers() {
+		if _, err := c.Router.Send(si, kr); err != nil {
+			log.Lvl2(c.Address(), "couldn't announce new key to", si, err)
+		}
+	}
+
+	c.keyRotations.Lock()
+	c.keyRotations.retired = append(c.keyRotations.retired, retiredKey{
+		public:  kr.OldPublic,
+		private: oldPrivate,
+		expires: time.Now().Add(grace),
+	})
+	c.keyRotations.Unlock()
+
+	c.keyLock.Lock()
+	c.private = kp.Private
+	own.SetKeys(kp.Public, kp.Private)
+	c.keyLock.Unlock()
+	log.Lvl2(c.Address(), "rotated its key to", kp.Public)
+	return own.Copy(), nil
+}
+
+// IsOwnKey returns true if the public key is the current key of this server
+// or an old key that is still in its grace period.
+func (c *Server) IsOwnKey(public kyber.Point) bool {
+	if c.ServerIdentity.GetPublic().Equal(public) {
+		return true
+	}
+	return c.retiredPrivate(public) != nil
+}
+
+// retiredPrivate returns the private key of a retired key that has not
+// expired yet, or nil.
+func (c *Server) retiredPrivate(public kyber.Point) kyber.Scalar {
+	c.keyRotations.Lock()
+	defer c.keyRotations.Unlock()
+	now := time.Now()
+	var valid []retiredKey
+	var private kyber.Scalar
+	for _, rk := range c.keyRotations.retired {
+		if now.After(rk.expires) {
+			continue
+		}
+		valid = append(valid, rk)
+		if rk.public.Equal(public) {
+			private = rk.private
+		}
+	}
+	c.keyRotations.retired = valid
+	return private
+}
+
+// CurrentIdentity returns the latest identity announced by a peer that
+// rotated its key, or si itself if it didn't.
+func (c *Server) CurrentIdentity(si *network.ServerIdentity) *network.ServerIdentity {
+	c.keyRotations.Lock()
+	defer c.keyRotations.Unlock()
+	if next, ok := c.keyRotations.peers[si.ID]; ok {
+		return next
+	}
+	return si
+}
+
+// rotatedKey returns the latest key announced by the peer with the given
+// ID, or nil if it didn't rotate its key.
+func (c *Server) rotatedKey(id network.ServerIdentityID) kyber.Point {
+	c.keyRotations.Lock()
+	defer c.keyRotations.Unlock()
+	if next, ok := c.keyRotations.peers[id]; ok {
+		return next.Public
+	}
+	return nil
+}
+
+// Send sends the message to the current identity of si, following the key
+// rotations announced by that peer.
+func (c *Server) Send(si *network.ServerIdentity, msg network.Message) (uint64, error) {
+	return c.Router.Send(c.CurrentIdentity(si), msg)
+}
+
+// handleKeyRotation verifies the announcement of a peer and stores its new
+// identity.
+func (c *Server) handleKeyRotation(env *network.Envelope) {
+	kr, ok := env.Msg.(*KeyRotation)
+	if !ok || kr.New == nil || kr.OldPublic == nil {
+		log.Error("Got invalid key rotation from", env.ServerIdentity)
+		return
+	}
+	if err := c.verifyKeyRotation(env.ServerIdentity, kr); err != nil {
+		log.Error("Refusing key rotation from", env.ServerIdentity, ":", err)
+		return
+	}
+	c.keyRotations.Lock()
+	c.keyRotations.peers[env.ServerIdentity.ID] = kr.New
+	c.keyRotations.Unlock()
+	log.Lvl2(c.Address(), "learned new key of", kr.New.Address)
+}
+
+func (c *Server) verifyKeyRotation(from *network.ServerIdentity, kr *KeyRotation) error {
+	if !from.Public.Equal(kr.OldPublic) {
+		return errors.New("old key is not the key of the sender")
+	}
+	if kr.New.Address != from.Address {
+		return errors.New("key rotation cannot change the address")
+	}
+	if !kr.New.ID.Equal(from.ID) {
+		return errors.New("key rotation cannot change the ID")
+	}
+	msg, err := kr.hash()
+	if err != nil {
+		return err
+	}
+	return schnorr.Verify(c.suite, kr.OldPublic, msg, kr.Signature)
+}
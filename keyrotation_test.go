@@ -0,0 +1,92 @@
+package onet
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dedis/kyber"
+	"github.com/dedis/kyber/sign/schnorr"
+	"github.com/dedis/kyber/util/key"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_RotateKey(t *testing.T) {
+	l := NewTCPTest(tSuite)
+	defer l.CloseAll()
+	servers, ro, _ := l.GenTree(2, true)
+	oldSI := servers[0].ServerIdentity.Copy()
+	oldPublic := oldSI.Public
+
+	// Make sure there is a connection that the announcement can use.
+	_, err := servers[0].Send(servers[1].ServerIdentity, ro)
+	require.Nil(t, err)
+
+	var saved kyber.Point
+	servers[0].SetKeySaver(func(public kyber.Point, private kyber.Scalar) error {
+		saved = public
+		return nil
+	})
+	si, err := servers[0].RotateKey(200 * time.Millisecond)
+	require.Nil(t, err)
+	require.False(t, si.Public.Equal(oldPublic))
+	require.True(t, si.Public.Equal(saved))
+	require.True(t, si.ID.Equal(oldSI.ID))
+	require.True(t, servers[0].ServerIdentity.GetPublic().Equal(si.Public))
+	require.True(t, servers[0].IsOwnKey(si.Public))
+	require.True(t, servers[0].IsOwnKey(oldPublic))
+	i, _ := ro.Search(si.ID)
+	require.Equal(t, 0, i)
+
+	for i := 0; i < 50; i++ {
+		if !servers[1].CurrentIdentity(oldSI).Public.Equal(oldPublic) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.True(t, servers[1].CurrentIdentity(oldSI).Public.Equal(si.Public))
+
+	time.Sleep(250 * time.Millisecond)
+	require.False(t, servers[0].IsOwnKey(oldPublic))
+
+	// If the key can't be stored, it is not rotated.
+	servers[0].SetKeySaver(func(kyber.Point, kyber.Scalar) error {
+		return errors.New("disk full")
+	})
+	_, err = servers[0].RotateKey(time.Second)
+	require.NotNil(t, err)
+	require.True(t, servers[0].ServerIdentity.GetPublic().Equal(si.Public))
+}
+
+func TestServer_VerifyKeyRotation(t *testing.T) {
+	l := NewLocalTest(tSuite)
+	defer l.CloseAll()
+	servers := l.GenServers(3)
+	from := servers[0].ServerIdentity
+
+	kr := &KeyRotation{
+		OldPublic: from.Public,
+		New:       from.Copy(),
+	}
+	kr.New.Public = key.NewKeyPair(tSuite).Public
+	sign := func() {
+		msg, err := kr.hash()
+		require.Nil(t, err)
+		kr.Signature, err = schnorr.Sign(tSuite, servers[0].privateKey(), msg)
+		require.Nil(t, err)
+	}
+	require.NotNil(t, servers[1].verifyKeyRotation(from, kr))
+	sign()
+	require.Nil(t, servers[1].verifyKeyRotation(from, kr))
+	// Only the owner of the old key can announce a rotation
+	require.NotNil(t, servers[1].verifyKeyRotation(servers[2].ServerIdentity, kr))
+	// The address must not change
+	kr.New.Address = servers[2].ServerIdentity.Address
+	sign()
+	require.NotNil(t, servers[1].verifyKeyRotation(from, kr))
+	// The ID must not change
+	kr.New.Address = from.Address
+	kr.New.ID = servers[2].ServerIdentity.ID
+	sign()
+	require.NotNil(t, servers[1].verifyKeyRotation(from, kr))
+}
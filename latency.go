@@ -0,0 +1,344 @@
+// +build !js
+
+package onet
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+)
+
+// latencyTimeout is how long MeasureLatencies waits for the rows of the
+// other members, and how long a member waits for the answer to a ping.
+var latencyTimeout = 10 * time.Second
+
+// LatencyMatrix holds the round-trip times between the members of a roster,
+// as measured by Overlay.MeasureLatencies.
+type LatencyMatrix struct {
+	Roster *Roster
+	// RTT[i][j] is the round-trip time from member i to member j of the
+	// roster, or 0 if i couldn't measure it.
+	RTT [][]time.Duration
+	// Measured is when the measurement ended
+	Measured time.Time
+}
+
+// latencyRequest asks a member of the roster for its round-trip times to
+// the other members.
+type latencyRequest struct {
+	Nonce  uint64
+	Roster *Roster
+}
+
+// latencyReply holds the round-trip times in nanoseconds from the sender to
+// the members of the roster of the request, in the order of the roster.
+type latencyReply struct {
+	Nonce uint64
+	RTT   []int64
+}
+
+var latencyRequestID = network.RegisterMessage(latencyRequest{})
+var latencyReplyID = network.RegisterMessage(latencyReply{})
+
+// latencies holds the matrices measured by the overlay and the
+// measurements waiting for replies.
+type latencies struct {
+	matrices map[RosterID]*LatencyMatrix
+	replies  map[uint64]chan *network.Envelope
+	// stops ends the periodic measurements started by TrackLatencies
+	stops map[RosterID]chan bool
+	sync.Mutex
+}
+
+func newLatencies() *latencies {
+	return &latencies{
+		matrices: make(map[RosterID]*LatencyMatrix),
+		replies:  make(map[uint64]chan *network.Envelope),
+		stops:    make(map[RosterID]chan bool),
+	}
+}
+
+// stop ends all periodic measurements.
+func (l *latencies) stop() {
+	l.Lock()
+	defer l.Unlock()
+	for id, stop := range l.stops {
+		close(stop)
+		delete(l.stops, id)
+	}
+}
+
+// registerLatencies lets the server answer the latency requests of others,
+// outside of the overlay so that they are answered while it is quiesced.
+func (o *Overlay) registerLatencies() {
+	o.server.RegisterProcessorFunc(latencyRequestID, func(env *network.Envelope) {
+		req := env.Msg.(*latencyRequest)
+		// Not in the receiving goroutine of the connection, which has to
+		// pass on the answers of the pings.
+		go func() {
+			reply := &latencyReply{Nonce: req.Nonce}
+			for _, rtt := range o.measureRow(req.Roster) {
+				reply.RTT = append(reply.RTT, int64(rtt))
+			}
+			if _, err := o.server.Send(env.ServerIdentity, reply); err != nil {
+				log.Lvl2(o.server.Address(), "couldn't send latencies:", err)
+			}
+		}()
+	})
+	o.server.RegisterProcessorFunc(latencyReplyID, func(env *network.Envelope) {
+		reply := env.Msg.(*latencyReply)
+		o.latencies.Lock()
+		ch := o.latencies.replies[reply.Nonce]
+		o.latencies.Unlock()
+		if ch != nil {
+			select {
+			case ch <- env:
+			default:
+			}
+		}
+	})
+}
+
+// measureRow returns the round-trip times from this server to the members
+// of the roster. The times measured by the router on its open connections
+// are used, the other members are pinged.
+func (o *Overlay) measureRow(roster *Roster) []time.Duration {
+	row := make([]time.Duration, len(roster.List))
+	var wg sync.WaitGroup
+	for i, si := range roster.List {
+		if si.ID.Equal(o.server.ServerIdentity.ID) {
+			continue
+		}
+		if st, ok := o.server.Peer(si.ID); ok && st.Connections > 0 && st.RTT > 0 {
+			row[i] = st.RTT
+			continue
+		}
+		wg.Add(1)
+		go func(i int, si *network.ServerIdentity) {
+			defer wg.Done()
+			rtt, err := o.server.Ping(si, latencyTimeout)
+			if err != nil {
+				log.Lvl3(o.server.Address(), "couldn't measure latency:", err)
+				return
+			}
+			row[i] = rtt
+		}(i, si)
+	}
+	wg.Wait()
+	return row
+}
+
+// MeasureLatencies asks all members of the roster for their round-trip
+// times to the other members and returns them. The members that don't
+// answer within 10 seconds have a row of unknown times. The matrix is also
+// kept as the latest one of the roster, see Latencies. This server must be
+// a member of the roster.
+func (o *Overlay) MeasureLatencies(roster *Roster) (*LatencyMatrix, error) {
+	own, _ := roster.Search(o.server.ServerIdentity.ID)
+	if own < 0 {
+		return nil, errors.New("this server is not in the roster")
+	}
+	nonce := uint64(rand.Int63())
+	replies := make(chan *network.Envelope, len(roster.List))
+	o.latencies.Lock()
+	o.latencies.replies[nonce] = replies
+	o.latencies.Unlock()
+	defer func() {
+		o.latencies.Lock()
+		delete(o.latencies.replies, nonce)
+		o.latencies.Unlock()
+	}()
+
+	lm := &LatencyMatrix{
+		Roster: roster,
+		RTT:    make([][]time.Duration, len(roster.List)),
+	}
+	index := make(map[network.ServerIdentityID]int)
+	for i, si := range roster.List {
+		lm.RTT[i] = make([]time.Duration, len(roster.List))
+		if i == own {
+			continue
+		}
+		index[si.ID] = i
+		if _, err := o.server.Send(si, &latencyRequest{nonce, roster}); err != nil {
+			log.Lvl2(o.server.Address(), "couldn't ask for latencies:", err)
+			delete(index, si.ID)
+		}
+	}
+	lm.RTT[own] = o.measureRow(roster)
+
+	timeout := time.After(latencyTimeout)
+	for len(index) > 0 {
+		select {
+		case env := <-replies:
+			i, ok := index[env.ServerIdentity.ID]
+			rtts := env.Msg.(*latencyReply).RTT
+			if !ok || len(rtts) != len(roster.List) {
+				continue
+			}
+			delete(index, env.ServerIdentity.ID)
+			for j, rtt := range rtts {
+				lm.RTT[i][j] = time.Duration(rtt)
+			}
+		case <-timeout:
+			log.Lvl2(o.server.Address(), len(index), "members didn't send their latencies")
+			index = nil
+		}
+	}
+	lm.Measured = time.Now()
+	o.latencies.Lock()
+	o.latencies.matrices[roster.ID] = lm
+	o.latencies.Unlock()
+	return lm, nil
+}
+
+// Latencies returns the latest matrix measured for the roster with the
+// given ID, or nil if there is none.
+func (o *Overlay) Latencies(id RosterID) *LatencyMatrix {
+	o.latencies.Lock()
+	defer o.latencies.Unlock()
+	return o.latencies.matrices[id]
+}
+
+// TrackLatencies measures the latencies of the roster every interval in the
+// background, so that Latencies returns recent ones. It replaces a former
+// tracking of the roster, and an interval of 0 stops it.
+func (o *Overlay) TrackLatencies(roster *Roster, interval time.Duration) {
+	o.latencies.Lock()
+	defer o.latencies.Unlock()
+	if stop := o.latencies.stops[roster.ID]; stop != nil {
+		close(stop)
+		delete(o.latencies.stops, roster.ID)
+	}
+	if interval <= 0 {
+		return
+	}
+	stop := make(chan bool)
+	o.latencies.stops[roster.ID] = stop
+	go func() {
+		for {
+			if _, err := o.MeasureLatencies(roster); err != nil {
+				log.Error("Couldn't measure latencies:", err)
+			}
+			select {
+			case <-stop:
+				return
+			case <-time.After(interval):
+			}
+		}
+	}()
+}
+
+// rtt returns the round-trip time between the members i and j. If i didn't
+// measure it, the time measured by j is used, and if none did, the largest
+// time of the matrix, so that unknown links are avoided.
+func (lm *LatencyMatrix) rtt(i, j int, max time.Duration) time.Duration {
+	if i == j {
+		return 0
+	}
+	if lm.RTT[i][j] > 0 {
+		return lm.RTT[i][j]
+	}
+	if lm.RTT[j][i] > 0 {
+		return lm.RTT[j][i]
+	}
+	return max
+}
+
+// max returns the largest round-trip time of the matrix.
+func (lm *LatencyMatrix) max() time.Duration {
+	var max time.Duration
+	for _, row := range lm.RTT {
+		for _, rtt := range row {
+			if rtt > max {
+				max = rtt
+			}
+		}
+	}
+	return max
+}
+
+// GenerateLatencyOptimizedTree creates a tree where each node has at most N
+// children, with the first element of the Roster as root, that keeps the
+// latency from the root to every node low: the nodes are added one by one,
+// always the one that can be reached fastest from the root through a node
+// of the tree that has less than N children. A slow link is thus only used
+// for the nodes that can't be reached otherwise, as deep in the tree as
+// possible. The latencies are taken from lm, usually measured by
+// Overlay.MeasureLatencies for this roster; members that are not in lm are
+// added last.
+func (ro *Roster) GenerateLatencyOptimizedTree(N int, lm *LatencyMatrix) *Tree {
+	n := len(ro.List)
+	if n == 0 || N < 1 {
+		return nil
+	}
+	// index of the members in the matrix, -1 if missing
+	lmIndex := make([]int, n)
+	for i, si := range ro.List {
+		lmIndex[i] = -1
+		if lm != nil && lm.Roster != nil {
+			lmIndex[i], _ = lm.Roster.Search(si.ID)
+		}
+	}
+	var max time.Duration
+	if lm != nil {
+		max = lm.max()
+	}
+	unknown := max*time.Duration(n) + 1
+	rtt := func(i, j int) time.Duration {
+		if lmIndex[i] < 0 || lmIndex[j] < 0 {
+			return unknown
+		}
+		return lm.rtt(lmIndex[i], lmIndex[j], max)
+	}
+
+	nodes := make([]*TreeNode, n)
+	nodes[0] = NewTreeNode(0, ro.List[0])
+	// dist is the latency from the root to the members in the tree, and
+	// for the others, through their best parent
+	dist := make([]time.Duration, n)
+	parent := make([]int, n)
+	for v := 1; v < n; v++ {
+		parent[v], dist[v] = 0, rtt(0, v)
+	}
+	// bestParent searches the best parent of v among the nodes in the tree
+	// with room for a child.
+	bestParent := func(v int) {
+		parent[v] = -1
+		for u, node := range nodes {
+			if node == nil || len(node.Children) >= N {
+				continue
+			}
+			if d := dist[u] + rtt(u, v); parent[v] < 0 || d < dist[v] {
+				parent[v], dist[v] = u, d
+			}
+		}
+	}
+	for added := 1; added < n; added++ {
+		v := -1
+		for w := 1; w < n; w++ {
+			if nodes[w] == nil && (v < 0 || dist[w] < dist[v]) {
+				v = w
+			}
+		}
+		u := parent[v]
+		nodes[v] = NewTreeNode(v, ro.List[v])
+		nodes[u].AddChild(nodes[v])
+		full := len(nodes[u].Children) >= N
+		for w := 1; w < n; w++ {
+			if nodes[w] != nil {
+				continue
+			}
+			if full && parent[w] == u {
+				bestParent(w)
+			} else if d := dist[v] + rtt(v, w); d < dist[w] {
+				parent[w], dist[w] = v, d
+			}
+		}
+	}
+	return NewTree(ro, nodes[0])
+}
@@ -0,0 +1,118 @@
+package onet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// latencyMatrix returns a symmetric matrix for the roster with the given
+// round-trip times in milliseconds.
+func latencyMatrix(ro *Roster, ms [][]int) *LatencyMatrix {
+	lm := &LatencyMatrix{Roster: ro, RTT: make([][]time.Duration, len(ms))}
+	for i, row := range ms {
+		lm.RTT[i] = make([]time.Duration, len(row))
+		for j, m := range row {
+			lm.RTT[i][j] = time.Duration(m) * time.Millisecond
+		}
+	}
+	return lm
+}
+
+func TestRoster_GenerateLatencyOptimizedTree(t *testing.T) {
+	ro := genRoster(tSuite, genLocalhostPeerNames(5, 2000))
+	// 1 and 2 are far from the root, but close to 3
+	lm := latencyMatrix(ro, [][]int{
+		{0, 200, 200, 10, 10},
+		{200, 0, 10, 20, 200},
+		{200, 10, 0, 20, 200},
+		{10, 20, 20, 0, 10},
+		{10, 200, 200, 10, 0},
+	})
+	tree := ro.GenerateLatencyOptimizedTree(2, lm)
+	require.Equal(t, 5, tree.Size())
+	root := tree.Root
+	require.Equal(t, ro.List[0], root.ServerIdentity)
+	require.Equal(t, 2, len(root.Children))
+	require.Equal(t, 3, root.Children[0].RosterIndex)
+	require.Equal(t, 4, root.Children[1].RosterIndex)
+	three := root.Children[0]
+	require.Equal(t, 2, len(three.Children))
+	require.Equal(t, 1, three.Children[0].RosterIndex)
+	require.Equal(t, 2, three.Children[1].RosterIndex)
+
+	// A full node is not used anymore
+	tree = ro.GenerateLatencyOptimizedTree(1, lm)
+	for _, tn := range tree.List() {
+		require.True(t, len(tn.Children) <= 1)
+	}
+	require.Equal(t, 5, tree.Size())
+
+	// Times measured by one side only are used for both
+	lm = latencyMatrix(ro, [][]int{
+		{0, 0, 0, 0, 0},
+		{0, 0, 0, 0, 0},
+		{0, 0, 0, 0, 0},
+		{0, 0, 0, 0, 0},
+		{0, 0, 0, 0, 0},
+	})
+	lm.RTT[2][0] = time.Millisecond
+	lm.RTT[0][1] = 100 * time.Millisecond
+	tree = ro.GenerateLatencyOptimizedTree(1, lm)
+	require.Equal(t, 2, tree.Root.Children[0].RosterIndex)
+
+	// Without latencies, all members are still in the tree
+	tree = ro.GenerateLatencyOptimizedTree(3, nil)
+	require.Equal(t, 5, tree.Size())
+	require.Equal(t, 3, len(tree.Root.Children))
+	require.Nil(t, ro.GenerateLatencyOptimizedTree(0, lm))
+}
+
+func TestOverlay_MeasureLatencies(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	servers, roster, _ := local.GenTree(4, false)
+
+	_, err := servers[0].overlay.MeasureLatencies(
+		genRoster(tSuite, genLocalhostPeerNames(2, 2100)))
+	require.NotNil(t, err)
+
+	lm, err := servers[0].overlay.MeasureLatencies(roster)
+	require.Nil(t, err)
+	require.Equal(t, len(roster.List), len(lm.RTT))
+	for i, row := range lm.RTT {
+		for j, rtt := range row {
+			if i == j {
+				require.Equal(t, time.Duration(0), rtt)
+			} else {
+				require.True(t, rtt > 0, "no latency from %d to %d", i, j)
+			}
+		}
+	}
+	require.Equal(t, lm, servers[0].overlay.Latencies(roster.ID))
+	require.Nil(t, servers[1].overlay.Latencies(roster.ID))
+
+	tree := roster.GenerateLatencyOptimizedTree(2, lm)
+	require.Equal(t, len(roster.List), tree.Size())
+}
+
+func TestOverlay_TrackLatencies(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	servers, roster, _ := local.GenTree(3, false)
+
+	o := servers[0].overlay
+	o.TrackLatencies(roster, 50*time.Millisecond)
+	var first *LatencyMatrix
+	for i := 0; i < 100 && first == nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+		first = o.Latencies(roster.ID)
+	}
+	require.NotNil(t, first)
+	for i := 0; i < 100 && o.Latencies(roster.ID) == first; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.True(t, o.Latencies(roster.ID).Measured.After(first.Measured))
+	o.TrackLatencies(roster, 0)
+}
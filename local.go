@@ -1,3 +1,5 @@
+// +build !js
+
 package onet
 
 import (
@@ -5,11 +7,12 @@ import (
 	"io/ioutil"
 	"net"
 	"os"
+	"path"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/dedis/kyber"
-	"github.com/dedis/kyber/util/key"
 	"github.com/dedis/onet/log"
 	"github.com/dedis/onet/network"
 )
@@ -36,6 +39,13 @@ type LocalTest struct {
 	// Once closed is set, do not allow further operation on it,
 	// since now the temp directory is gone.
 	closed bool
+	// serversLock protects Servers, Overlays and Services while the servers
+	// are created in parallel.
+	serversLock sync.Mutex
+	// clock is given to all the servers, see SetClock.
+	clock network.Clock
+	// localFaults are injected in the local connections, see Partition.
+	localFaults *localFaults
 }
 
 const (
@@ -43,11 +53,20 @@ const (
 	TCP = "tcp"
 	// Local represents the Local mode of networking for this local test
 	Local = "local"
+	// Unix represents the Unix socket mode of networking for this local test
+	Unix = "unix"
 )
 
 // NewLocalTest creates a new Local handler that can be used to test protocols
-// locally
+// locally. If the environment variable ONET_SEED is set, the test runs in
+// the deterministic mode with that seed, see SetSeed.
+//
+// Many LocalTests can run in parallel in the same process, for example in
+// tests calling t.Parallel, as they don't share servers, connections or
+// ports. This is not the case in the deterministic mode, where the order in
+// which the keys are created matters.
 func NewLocalTest(s network.Suite) *LocalTest {
+	seedFromEnv()
 	dir, err := ioutil.TempDir("", "onet")
 	if err != nil {
 		log.Fatal("could not create temp directory: ", err)
@@ -74,6 +93,15 @@ func NewTCPTest(s network.Suite) *LocalTest {
 	return t
 }
 
+// NewUnixTest returns a LocalTest that uses Unix sockets in its temporary
+// directory as the underlying communication layer. The servers of such a
+// test have no websocket.
+func NewUnixTest(s network.Suite) *LocalTest {
+	t := NewLocalTest(s)
+	t.mode = Unix
+	return t
+}
+
 // StartProtocol takes a name and a tree and will create a
 // new Node with the protocol 'name' running from the tree-root
 func (l *LocalTest) StartProtocol(name string, t *Tree) (ProtocolInstance, error) {
@@ -109,9 +137,7 @@ func (l *LocalTest) GenServers(n int) []*Server {
 	l.panicClosed()
 	servers := l.genLocalHosts(n)
 	for _, server := range servers {
-		l.Servers[server.ServerIdentity.ID] = server
-		l.Overlays[server.ServerIdentity.ID] = server.overlay
-		l.Services[server.ServerIdentity.ID] = server.serviceManager.services
+		l.addServer(server)
 	}
 	return servers
 
@@ -127,7 +153,7 @@ func (l *LocalTest) GenTree(n int, register bool) ([]*Server, *Roster, *Tree) {
 	tree := list.GenerateBinaryTree()
 	l.Trees[tree.ID] = tree
 	if register {
-		servers[0].overlay.RegisterRoster(list)
+		servers[0].overlay.registerRoster(list)
 		servers[0].overlay.RegisterTree(tree)
 	}
 	return servers, list, tree
@@ -148,7 +174,7 @@ func (l *LocalTest) GenBigTree(nbrTreeNodes, nbrServers, bf int, register bool)
 	tree := list.GenerateBigNaryTree(bf, nbrTreeNodes)
 	l.Trees[tree.ID] = tree
 	if register {
-		servers[0].overlay.RegisterRoster(list)
+		servers[0].overlay.registerRoster(list)
 		servers[0].overlay.RegisterTree(tree)
 	}
 	return servers, list, tree
@@ -176,23 +202,32 @@ func (l *LocalTest) CloseAll() {
 	log.Lvl3("Stopping all")
 	// If the debug-level is 0, we copy all errors to a buffer that
 	// will be discarded at the end.
-	if log.DebugVisible() == 0 {
-		log.OutputToBuf()
+	quiet := log.DebugVisible() == 0
+	if quiet {
+		silenceLog(true)
 	}
 	l.ctx.Stop()
+	var wg sync.WaitGroup
 	for _, server := range l.Servers {
-		log.Lvl3("Closing server", server.ServerIdentity.Address)
-		err := server.Close()
-		if err != nil {
-			log.Error("Closing server", server.ServerIdentity.Address,
-				"gives error", err)
-		}
-
-		for server.Listening() {
-			log.Lvl1("Sleeping while waiting to close...")
-			time.Sleep(10 * time.Millisecond)
-		}
-		delete(l.Servers, server.ServerIdentity.ID)
+		wg.Add(1)
+		go func(server *Server) {
+			defer wg.Done()
+			log.Lvl3("Closing server", server.ServerIdentity.Address)
+			err := server.Close()
+			if err != nil {
+				log.Error("Closing server", server.ServerIdentity.Address,
+					"gives error", err)
+			}
+
+			for server.Listening() {
+				log.Lvl1("Sleeping while waiting to close...")
+				time.Sleep(10 * time.Millisecond)
+			}
+		}(server)
+	}
+	wg.Wait()
+	for id := range l.Servers {
+		delete(l.Servers, id)
 	}
 	for _, node := range l.Nodes {
 		log.Lvl3("Closing node", node)
@@ -201,7 +236,31 @@ func (l *LocalTest) CloseAll() {
 	l.Nodes = make([]*TreeNodeInstance, 0)
 	os.RemoveAll(l.path)
 	l.closed = true
-	if log.DebugVisible() == 0 {
+	if quiet {
+		silenceLog(false)
+	}
+}
+
+// silenced counts the LocalTests that are closing and don't want their
+// errors to show up. The output goes to the os again only once all of them
+// are closed, so that LocalTests can be closed in parallel.
+var silenced struct {
+	count int
+	sync.Mutex
+}
+
+func silenceLog(on bool) {
+	silenced.Lock()
+	defer silenced.Unlock()
+	if on {
+		if silenced.count == 0 {
+			log.OutputToBuf()
+		}
+		silenced.count++
+		return
+	}
+	silenced.count--
+	if silenced.count == 0 {
 		log.OutputToOs()
 	}
 }
@@ -288,7 +347,7 @@ func (l *LocalTest) checkPendingTreeMarshal(c *Server, el *Roster) {
 
 // GetPrivate returns the private key of a server
 func (l *LocalTest) GetPrivate(c *Server) kyber.Scalar {
-	return c.private
+	return c.privateKey()
 }
 
 // GetServices returns a slice of all services asked for.
@@ -314,7 +373,7 @@ func (l *LocalTest) MakeSRS(s network.Suite, nbr int, sid ServiceID) ([]*Server,
 // "localserver:+port as first address.
 func NewPrivIdentity(suite network.Suite, port int) (kyber.Scalar, *network.ServerIdentity) {
 	address := network.NewLocalAddress("127.0.0.1:" + strconv.Itoa(port))
-	kp := key.NewKeyPair(suite)
+	kp := newKeyPair(suite)
 	id := network.NewServerIdentity(kp.Public, address)
 	return kp.Private, id
 }
@@ -326,6 +385,9 @@ func newTCPServer(s network.Suite, port int, path string) *Server {
 	addr := network.NewAddress(network.PlainTCP, id.Address.NetworkAddress())
 	id2 := network.NewServerIdentity(id.Public, addr)
 	var tcpHost *network.TCPHost
+	// reserved keeps the port of the websocket until the server starts, so
+	// that servers created in parallel don't take it.
+	var reserved net.Listener
 	// For the websocket we need a port at the address one higher than the
 	// TCPHost. Let TCPHost chose a port, then check if the port+1 is also
 	// available. Else redo the search.
@@ -345,7 +407,7 @@ func newTCPServer(s network.Suite, port int, path string) *Server {
 		}
 		addr := net.JoinHostPort(id.Address.Host(), strconv.Itoa(port+1))
 		if l, err := net.Listen("tcp", addr); err == nil {
-			l.Close()
+			reserved = l
 			break
 		}
 		log.Lvl2("Found closed port:", addr)
@@ -354,6 +416,9 @@ func newTCPServer(s network.Suite, port int, path string) *Server {
 	router := network.NewRouter(id, tcpHost)
 	router.UnauthOk = true
 	h := newServer(s, path, router, priv)
+	if reserved != nil {
+		reserved.Close()
+	}
 	go h.Start()
 	for !h.Listening() {
 		time.Sleep(10 * time.Millisecond)
@@ -395,17 +460,84 @@ func (l *LocalTest) NewClient(serviceName string) *Client {
 	}
 }
 
-// genLocalHosts returns n servers created with a localRouter
+// genLocalHosts returns n servers created with a localRouter. The servers
+// are created in parallel, except in the deterministic mode, where their keys
+// must be taken from the seed in order. Outside of the deterministic mode,
+// the ports are not shared with the other LocalTests of the process.
 func (l *LocalTest) genLocalHosts(n int) []*Server {
 	l.panicClosed()
 	servers := make([]*Server, n)
+	if _, ok := Seed(); ok {
+		for i := 0; i < n; i++ {
+			servers[i] = l.NewServer(l.Suite, 2000+i*10)
+		}
+		return servers
+	}
+	var wg sync.WaitGroup
 	for i := 0; i < n; i++ {
-		port := 2000 + i*10
-		servers[i] = l.NewServer(l.Suite, port)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			servers[i] = l.NewServer(l.Suite, nextLocalPort())
+		}(i)
 	}
+	wg.Wait()
 	return servers
 }
 
+// localPorts hands out the ports of the servers with local connections.
+// As their websockets listen on real TCP ports, the LocalTests running in
+// parallel must not use the same ones.
+var localPorts = struct {
+	next int
+	sync.Mutex
+}{next: 2000}
+
+// nextLocalPort returns a port not used by any other LocalTest of this
+// process, whose port+1 is free for the websocket.
+func nextLocalPort() int {
+	localPorts.Lock()
+	defer localPorts.Unlock()
+	for {
+		port := localPorts.next
+		localPorts.next += 10
+		if localPorts.next > 60000 {
+			localPorts.next = 2000
+		}
+		ln, err := net.Listen("tcp", ":"+strconv.Itoa(port+1))
+		if err == nil {
+			ln.Close()
+			return port
+		}
+	}
+}
+
+// addServer adds the server to the maps of the LocalTest.
+func (l *LocalTest) addServer(server *Server) {
+	l.serversLock.Lock()
+	defer l.serversLock.Unlock()
+	if l.clock != nil {
+		server.SetClock(l.clock)
+	}
+	l.Servers[server.ServerIdentity.ID] = server
+	l.Overlays[server.ServerIdentity.ID] = server.overlay
+	l.Services[server.ServerIdentity.ID] = server.serviceManager.services
+}
+
+// SetClock gives the clock to all the servers of the LocalTest, also to the
+// ones generated later. With a network.MockClock, the tests of timeouts move
+// the time forward with Advance instead of sleeping. The clock also measures
+// the delays of DelayMessages.
+func (l *LocalTest) SetClock(c network.Clock) {
+	l.serversLock.Lock()
+	defer l.serversLock.Unlock()
+	l.clock = c
+	l.ctx.SetClock(c)
+	for _, s := range l.Servers {
+		s.SetClock(c)
+	}
+}
+
 // NewServer returns a new server which type is determined by the local mode:
 // TCP or Local. If it's TCP, then an available port is used, otherwise, the
 // port given in argument is used.
@@ -415,6 +547,8 @@ func (l *LocalTest) NewServer(s network.Suite, port int) *Server {
 	switch l.mode {
 	case TCP:
 		server = l.newTCPServer(s)
+	case Unix:
+		server = l.newUnixServer(s)
 	default:
 		server = l.NewLocalServer(s, port)
 	}
@@ -425,13 +559,30 @@ func (l *LocalTest) NewServer(s network.Suite, port int) *Server {
 func (l *LocalTest) newTCPServer(s network.Suite) *Server {
 	l.panicClosed()
 	server := newTCPServer(s, 0, l.path)
-	l.Servers[server.ServerIdentity.ID] = server
-	l.Overlays[server.ServerIdentity.ID] = server.overlay
-	l.Services[server.ServerIdentity.ID] = server.serviceManager.services
+	l.addServer(server)
 
 	return server
 }
 
+// newUnixServer returns a new Server listening on a Unix socket in the
+// directory of this LocalTest.
+func (l *LocalTest) newUnixServer(s network.Suite) *Server {
+	l.panicClosed()
+	priv, id := NewPrivIdentity(s, 0)
+	id.Address = network.NewUnixAddress(path.Join(l.path, id.ID.String()+".sock"))
+	router, err := network.NewUnixRouter(id, s)
+	if err != nil {
+		panic(err)
+	}
+	server := newServer(s, l.path, router, priv)
+	go server.Start()
+	for !server.Listening() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	l.addServer(server)
+	return server
+}
+
 // NewLocalServer returns a fresh Host using local connections within the context
 // of this LocalTest
 func (l *LocalTest) NewLocalServer(s network.Suite, port int) *Server {
@@ -446,9 +597,7 @@ func (l *LocalTest) NewLocalServer(s network.Suite, port int) *Server {
 	for !server.Listening() {
 		time.Sleep(10 * time.Millisecond)
 	}
-	l.Servers[server.ServerIdentity.ID] = server
-	l.Overlays[server.ServerIdentity.ID] = server.overlay
-	l.Services[server.ServerIdentity.ID] = server.serviceManager.services
+	l.addServer(server)
 
 	return server
 
@@ -1,6 +1,7 @@
 package onet
 
 import (
+	"strconv"
 	"testing"
 
 	"github.com/dedis/kyber/suites"
@@ -34,6 +35,53 @@ func TestGenLocalHost(t *testing.T) {
 	}
 }
 
+func TestGenLocalHost_Parallel(t *testing.T) {
+	for _, l := range []*LocalTest{NewLocalTest(tSuite), NewTCPTest(tSuite)} {
+		servers, ro, _ := l.GenTree(20, true)
+		require.Equal(t, 20, len(l.Servers))
+		require.Equal(t, 20, len(l.Overlays))
+		require.Equal(t, 20, len(l.Services))
+		addresses := make(map[network.Address]bool)
+		for i, s := range servers {
+			require.True(t, ro.List[i].ID.Equal(s.ServerIdentity.ID))
+			require.False(t, addresses[s.Address()])
+			addresses[s.Address()] = true
+		}
+		_, err := servers[19].Send(servers[0].ServerIdentity, ro)
+		require.Nil(t, err)
+		l.CloseAll()
+		require.Equal(t, 0, len(l.Servers))
+	}
+}
+
+func TestLocalTest_RunParallel(t *testing.T) {
+	for i := 0; i < 3; i++ {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Parallel()
+			l := NewLocalTest(tSuite)
+			defer l.CloseAll()
+			servers, ro, _ := l.GenTree(5, true)
+			_, err := servers[4].Send(servers[0].ServerIdentity, ro)
+			require.Nil(t, err)
+			cl := l.NewClient(clientServiceName)
+			require.Nil(t, cl.SendProtobuf(ro.List[0], &SimpleMessage{}, nil))
+		})
+	}
+}
+
+func TestNextLocalPort(t *testing.T) {
+	ports := make(chan int, 20)
+	for i := 0; i < cap(ports); i++ {
+		go func() { ports <- nextLocalPort() }()
+	}
+	seen := make(map[int]bool)
+	for i := 0; i < cap(ports); i++ {
+		p := <-ports
+		require.False(t, seen[p])
+		seen[p] = true
+	}
+}
+
 // This tests the client-connection in the case of a non-garbage-collected
 // client that stays in the service.
 func TestNewTCPTest(t *testing.T) {
@@ -46,6 +94,29 @@ func TestNewTCPTest(t *testing.T) {
 	log.ErrFatal(err)
 }
 
+func TestNewUnixTest(t *testing.T) {
+	l := NewUnixTest(tSuite)
+	servers, el, _ := l.GenTree(2, true)
+	defer l.CloseAll()
+
+	require.Equal(t, network.ConnType(network.Unix), el.List[0].Address.ConnType())
+	_, err := servers[0].Send(servers[1].ServerIdentity, el)
+	require.Nil(t, err)
+}
+
+// The mock suite can replace the real one where the cryptography doesn't
+// matter.
+func TestLocalTest_MockSuite(t *testing.T) {
+	suite := network.NewMockSuite()
+	l := NewTCPTest(suite)
+	servers, el, _ := l.GenTree(3, true)
+	defer l.CloseAll()
+	require.Equal(t, suite, servers[0].Suite())
+
+	c1 := NewClient(suite, clientServiceName)
+	require.Nil(t, c1.SendProtobuf(el.List[0], &SimpleMessage{}, nil))
+}
+
 type clientService struct {
 	*ServiceProcessor
 	cl *Client
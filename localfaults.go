@@ -0,0 +1,125 @@
+// +build !js
+
+package onet
+
+import (
+	"sync"
+	"time"
+
+	"github.com/dedis/onet/network"
+)
+
+// localFaults are the faults injected in the network of a LocalTest.
+type localFaults struct {
+	sync.Mutex
+	// group is the partition of every address, see Partition
+	group map[network.Address]int
+	drop  map[network.MessageTypeID]bool
+	delay map[network.MessageTypeID]time.Duration
+}
+
+// fault implements the function given to LocalManager.SetFaults.
+func (lf *localFaults) fault(from, to network.Address, msg network.Message) network.Fault {
+	lf.Lock()
+	defer lf.Unlock()
+	gFrom, okFrom := lf.group[from]
+	gTo, okTo := lf.group[to]
+	if okFrom && okTo && gFrom != gTo {
+		return network.Fault{Drop: true}
+	}
+	if msg == nil {
+		return network.Fault{}
+	}
+	typ := network.MessageType(msg)
+	if pm, ok := msg.(*ProtocolMsg); ok {
+		typ = pm.MsgType
+	}
+	return network.Fault{Drop: lf.drop[typ], Delay: lf.delay[typ]}
+}
+
+// faults returns the faults of the LocalTest, and hooks them into the local
+// network the first time. It panics if the LocalTest doesn't use local
+// connections.
+func (l *LocalTest) faults() *localFaults {
+	if l.mode != Local {
+		panic("fault injection only works with local connections")
+	}
+	l.serversLock.Lock()
+	defer l.serversLock.Unlock()
+	if l.localFaults == nil {
+		l.localFaults = &localFaults{
+			drop:  make(map[network.MessageTypeID]bool),
+			delay: make(map[network.MessageTypeID]time.Duration),
+		}
+		l.ctx.SetFaults(l.localFaults.fault)
+	}
+	return l.localFaults
+}
+
+// KillServer closes the server as if it crashed, and removes it from the
+// LocalTest. The other servers see their connections to it fail.
+func (l *LocalTest) KillServer(s *Server) error {
+	l.panicClosed()
+	l.serversLock.Lock()
+	delete(l.Servers, s.ServerIdentity.ID)
+	delete(l.Overlays, s.ServerIdentity.ID)
+	delete(l.Services, s.ServerIdentity.ID)
+	l.serversLock.Unlock()
+	return s.Close()
+}
+
+// Partition splits the network into the given groups of servers: messages
+// between servers of different groups are lost, and they cannot connect to
+// each other. The servers in no group reach everybody. A new call replaces
+// the previous partition. It only works with local connections.
+func (l *LocalTest) Partition(groups ...[]*Server) {
+	lf := l.faults()
+	lf.Lock()
+	defer lf.Unlock()
+	lf.group = make(map[network.Address]int)
+	for i, g := range groups {
+		for _, s := range g {
+			lf.group[s.ServerIdentity.Address] = i
+		}
+	}
+}
+
+// Heal removes the partition, so that all servers reach each other again.
+// Connections that failed during the partition are set up again by the next
+// message.
+func (l *LocalTest) Heal() {
+	lf := l.faults()
+	lf.Lock()
+	defer lf.Unlock()
+	lf.group = nil
+}
+
+// DropMessages makes the network lose all messages of the given type. For
+// the messages of the protocols, the type is the one of the message sent by
+// the protocol. It only works with local connections.
+func (l *LocalTest) DropMessages(typ network.MessageTypeID) {
+	lf := l.faults()
+	lf.Lock()
+	defer lf.Unlock()
+	lf.drop[typ] = true
+}
+
+// DelayMessages makes the network deliver the messages of the given type
+// only after d. The delay uses the clock given to SetClock. It only works
+// with local connections.
+func (l *LocalTest) DelayMessages(typ network.MessageTypeID, d time.Duration) {
+	lf := l.faults()
+	lf.Lock()
+	defer lf.Unlock()
+	lf.delay[typ] = d
+}
+
+// DeliverMessages removes the effect of DropMessages and DelayMessages for
+// the given type.
+func (l *LocalTest) DeliverMessages(typ network.MessageTypeID) {
+	lf := l.faults()
+	lf.Lock()
+	defer lf.Unlock()
+	delete(lf.drop, typ)
+	delete(lf.delay, typ)
+}
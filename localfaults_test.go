@@ -0,0 +1,64 @@
+package onet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dedis/onet/network"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalFaults_Fault(t *testing.T) {
+	lf := &localFaults{
+		drop:  make(map[network.MessageTypeID]bool),
+		delay: make(map[network.MessageTypeID]time.Duration),
+	}
+	a, b, c := network.NewLocalAddress("a:1"), network.NewLocalAddress("b:1"),
+		network.NewLocalAddress("c:1")
+	typ := network.MessageType(&SimpleMessage{})
+	proto := &ProtocolMsg{MsgType: typ}
+
+	require.Equal(t, network.Fault{}, lf.fault(a, b, nil))
+	lf.group = map[network.Address]int{a: 0, b: 1}
+	require.True(t, lf.fault(a, b, nil).Drop)
+	require.True(t, lf.fault(b, a, &SimpleMessage{}).Drop)
+	require.False(t, lf.fault(a, c, nil).Drop)
+	lf.group = nil
+
+	lf.drop[typ] = true
+	require.True(t, lf.fault(a, b, &SimpleMessage{}).Drop)
+	require.True(t, lf.fault(a, b, proto).Drop)
+	require.False(t, lf.fault(a, b, nil).Drop)
+	delete(lf.drop, typ)
+	lf.delay[typ] = time.Second
+	require.Equal(t, network.Fault{Delay: time.Second}, lf.fault(a, b, proto))
+}
+
+func TestLocalTest_Partition(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	servers := local.GenServers(3)
+	msg := &SimpleMessage{3}
+
+	local.Partition(servers[:1], servers[1:])
+	_, err := servers[0].Send(servers[1].ServerIdentity, msg)
+	require.NotNil(t, err)
+	_, err = servers[1].Send(servers[2].ServerIdentity, msg)
+	require.Nil(t, err)
+
+	local.Heal()
+	_, err = servers[0].Send(servers[1].ServerIdentity, msg)
+	require.Nil(t, err)
+
+	require.Nil(t, local.KillServer(servers[2]))
+	_, ok := local.Servers[servers[2].ServerIdentity.ID]
+	require.False(t, ok)
+	_, err = servers[1].Send(servers[2].ServerIdentity, msg)
+	require.NotNil(t, err)
+}
+
+func TestLocalTest_FaultsNeedLocal(t *testing.T) {
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	require.Panics(t, func() { local.Heal() })
+}
@@ -0,0 +1,167 @@
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Captured holds the entries logged during a test, see Capture.
+type Captured struct {
+	entries []Entry
+	// goroutines tells for the goroutines that logged whether they belong
+	// to the test
+	goroutines map[int]bool
+	sync.Mutex
+}
+
+// Capture keeps the entries of all debug levels logged until the end of
+// the test, for the assertions of Captured. Unlike OutputToBuf, it doesn't
+// change the output of the log, so every test and subtest can have its own
+// capture, also with t.Parallel. The capture only gets the entries of the
+// goroutine calling Capture and of the goroutines it started, directly or
+// through other goroutines, as long as these are still running when they
+// log. The entries of the subtests are included.
+func Capture(t *testing.T) *Captured {
+	c := &Captured{goroutines: map[int]bool{currentGoroutine(): true}}
+	key := RegisterLogger(c)
+	t.Cleanup(func() { UnregisterLogger(key) })
+	return c
+}
+
+// MaxLevel implements LevelLogger, the capture gets all levels.
+func (c *Captured) MaxLevel() int {
+	return 5
+}
+
+// Log implements Logger, it keeps the entries of the goroutines of the
+// test.
+func (c *Captured) Log(e *Entry) {
+	c.Lock()
+	defer c.Unlock()
+	if c.owns(currentGoroutine()) {
+		c.entries = append(c.entries, *e)
+	}
+}
+
+// owns returns whether the goroutine id is the one of the test or has been
+// started by it. It must be called with the lock held.
+func (c *Captured) owns(id int) bool {
+	if owned, ok := c.goroutines[id]; ok {
+		return owned
+	}
+	parents := make(map[int]int)
+	for _, g := range runningGoroutines() {
+		parents[g.id] = parentGoroutine(g.stack)
+	}
+	owned := false
+	for p := parents[id]; p != 0; p = parents[p] {
+		if known, ok := c.goroutines[p]; ok {
+			owned = known
+			break
+		}
+	}
+	// The ancestors of a goroutine don't change, so the answer is kept.
+	c.goroutines[id] = owned
+	return owned
+}
+
+var goroutineCreator = regexp.MustCompile(`\ncreated by .* in goroutine (\d+)\n`)
+
+// parentGoroutine returns the id of the goroutine that started the one of
+// the stack, 0 if it is unknown.
+func parentGoroutine(stack string) int {
+	m := goroutineCreator.FindStringSubmatch(stack + "\n")
+	if m == nil {
+		return 0
+	}
+	id, _ := strconv.Atoi(m[1])
+	return id
+}
+
+// currentGoroutine returns the id of the calling goroutine.
+func currentGoroutine() int {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	m := goroutineHeader.FindSubmatch(buf)
+	if m == nil {
+		return 0
+	}
+	id, _ := strconv.Atoi(string(m[1]))
+	return id
+}
+
+// Close implements Logger.
+func (c *Captured) Close() error {
+	return nil
+}
+
+// Entries returns the captured entries, oldest first.
+func (c *Captured) Entries() []Entry {
+	c.Lock()
+	defer c.Unlock()
+	return append([]Entry{}, c.entries...)
+}
+
+// Reset forgets the captured entries.
+func (c *Captured) Reset() {
+	c.Lock()
+	defer c.Unlock()
+	c.entries = nil
+}
+
+// String returns the captured entries, one per line, as "level: message".
+func (c *Captured) String() string {
+	var buf bytes.Buffer
+	for _, e := range c.Entries() {
+		fmt.Fprintf(&buf, "%s: %s\n", e.LevelName, e.Message)
+	}
+	return buf.String()
+}
+
+// Contains fails the test if no entry contains s.
+func (c *Captured) Contains(t *testing.T, s string) {
+	t.Helper()
+	if !c.find(0, s) {
+		t.Errorf("no log entry contains %q in:\n%s", s, c)
+	}
+}
+
+// ContainsLevel fails the test if no entry of the level contains s. The
+// level is a debug level from 1 to 5, which also matches the LLvl
+// functions, or one of LevelPrint, LevelInfo, LevelWarning, LevelError,
+// LevelFatal and LevelPanic.
+func (c *Captured) ContainsLevel(t *testing.T, level int, s string) {
+	t.Helper()
+	if !c.find(level, s) {
+		t.Errorf("no log entry of level %s contains %q in:\n%s",
+			levelName(level), s, c)
+	}
+}
+
+// NotContains fails the test if an entry contains s.
+func (c *Captured) NotContains(t *testing.T, s string) {
+	t.Helper()
+	if c.find(0, s) {
+		t.Errorf("a log entry contains %q in:\n%s", s, c)
+	}
+}
+
+// find returns whether an entry of the level, or of any level if it is 0,
+// contains s.
+func (c *Captured) find(level int, s string) bool {
+	for _, e := range c.Entries() {
+		if level != 0 && e.Level != level && (level < 1 || e.Level != -level) {
+			continue
+		}
+		if strings.Contains(e.Message, s) {
+			return true
+		}
+	}
+	return false
+}
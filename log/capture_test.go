@@ -0,0 +1,89 @@
+package log
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCapture(t *testing.T) {
+	c := Capture(t)
+	Lvl1("one")
+	Lvl4("hidden four")
+	LLvl3("bright three")
+	Warn("careful")
+	Error("failed")
+
+	c.Contains(t, "hidden four")
+	c.NotContains(t, "nothing")
+	c.ContainsLevel(t, 1, "one")
+	c.ContainsLevel(t, 3, "bright")
+	c.ContainsLevel(t, LevelWarning, "careful")
+	c.ContainsLevel(t, LevelError, "fail")
+	require.Equal(t, 5, len(c.Entries()))
+	require.True(t, strings.HasPrefix(c.String(), "1: one\n4: hidden four\n"))
+
+	// The assertions fail the test given to them
+	ft := &testing.T{}
+	c.ContainsLevel(ft, LevelError, "careful")
+	c.NotContains(ft, "one")
+	require.True(t, ft.Failed())
+
+	c.Reset()
+	require.Empty(t, c.Entries())
+
+	// The UI functions print without the debug level, but still go to the
+	// loggers
+	defer SetDebugVisible(DebugVisible())
+	SetDebugVisible(0)
+	Warn("bare")
+	c.ContainsLevel(t, LevelWarning, "bare")
+	GetStdOut()
+	GetStdErr()
+}
+
+func TestCapture_Parallel(t *testing.T) {
+	t.Run("group", func(t *testing.T) {
+		for _, name := range []string{"a", "b", "c"} {
+			name := name
+			t.Run(name, func(t *testing.T) {
+				t.Parallel()
+				c := Capture(t)
+				for i := 0; i < 10; i++ {
+					Lvl5("parallel", name)
+				}
+				done := make(chan bool)
+				go func() {
+					Lvl5("goroutine", name)
+					close(done)
+				}()
+				<-done
+				c.ContainsLevel(t, 5, "parallel "+name)
+				c.ContainsLevel(t, 5, "goroutine "+name)
+				for _, other := range []string{"a", "b", "c"} {
+					if other != name {
+						c.NotContains(t, "parallel "+other)
+						c.NotContains(t, "goroutine "+other)
+					}
+				}
+				require.Equal(t, 11, len(c.Entries()))
+			})
+		}
+	})
+}
+
+func TestCapture_Subtests(t *testing.T) {
+	for _, name := range []string{"a", "b"} {
+		t.Run(name, func(t *testing.T) {
+			c := Capture(t)
+			Lvl5("subtest", name)
+			c.ContainsLevel(t, 5, "subtest "+name)
+			require.Equal(t, 1, len(c.Entries()))
+		})
+	}
+	// The captures are unregistered at the end of the subtests
+	debugMut.RLock()
+	defer debugMut.RUnlock()
+	require.Equal(t, 0, loggersLevel)
+}
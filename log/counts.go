@@ -0,0 +1,87 @@
+package log
+
+import (
+	"strconv"
+	"sync"
+)
+
+// MaxCallerCounts is the number of call sites counted by CallerCounts. The
+// messages of the other call sites are counted under CallerOther, so that
+// the counters don't grow without bounds.
+var MaxCallerCounts = 1000
+
+// CallerOther is the call site of CallerCounts for the messages of the
+// call sites beyond MaxCallerCounts.
+const CallerOther = "other"
+
+// counts are the number of messages shown, by level and by call site.
+var counts = struct {
+	levels  map[string]uint64
+	callers map[string]uint64
+	sync.Mutex
+}{levels: map[string]uint64{}, callers: map[string]uint64{}}
+
+// countMessage counts a message shown by the function fn at line.
+func countMessage(lvl int, fn string, line int) {
+	site := fn + ":" + strconv.Itoa(line)
+	counts.Lock()
+	defer counts.Unlock()
+	counts.levels[countName(lvl)]++
+	if _, ok := counts.callers[site]; !ok && len(counts.callers) >= MaxCallerCounts {
+		site = CallerOther
+	}
+	counts.callers[site]++
+}
+
+// countName returns the name of the level in Counts.
+func countName(lvl int) string {
+	switch lvl {
+	case lvlWarning:
+		return "warning"
+	case lvlError:
+		return "error"
+	case lvlFatal:
+		return "fatal"
+	case lvlPanic:
+		return "panic"
+	case lvlInfo, lvlPrint:
+		return "info"
+	}
+	if lvl < 0 {
+		lvl = -lvl
+	}
+	return strconv.Itoa(lvl)
+}
+
+// Counts returns the number of messages shown since the start or the last
+// ResetCounts, by level: "1" to "5", "info", "warning", "error", "fatal" and
+// "panic". The messages hidden by the debug level are not counted.
+func Counts() map[string]uint64 {
+	counts.Lock()
+	defer counts.Unlock()
+	return copyCounts(counts.levels)
+}
+
+// CallerCounts returns the number of messages shown since the start or the
+// last ResetCounts, by call site as "function:line".
+func CallerCounts() map[string]uint64 {
+	counts.Lock()
+	defer counts.Unlock()
+	return copyCounts(counts.callers)
+}
+
+// ResetCounts sets all counters to 0.
+func ResetCounts() {
+	counts.Lock()
+	defer counts.Unlock()
+	counts.levels = map[string]uint64{}
+	counts.callers = map[string]uint64{}
+}
+
+func copyCounts(m map[string]uint64) map[string]uint64 {
+	c := make(map[string]uint64, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
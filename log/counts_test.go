@@ -0,0 +1,43 @@
+package log
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCounts(t *testing.T) {
+	defer SetDebugVisible(DebugVisible())
+	SetDebugVisible(2)
+	ResetCounts()
+	for i := 0; i < 3; i++ {
+		Warn("spam")
+	}
+	Lvl1("one")
+	LLvl2("two")
+	Lvl3("hidden")
+	require.Equal(t, map[string]uint64{"warning": 3, "1": 1, "2": 1}, Counts())
+	callers := CallerCounts()
+	require.Equal(t, 3, len(callers))
+	var sum uint64
+	for site, n := range callers {
+		require.Contains(t, site, "log.TestCounts:")
+		sum += n
+	}
+	require.Equal(t, uint64(5), sum)
+
+	// The call sites beyond the limit are counted together
+	defer func(max int) { MaxCallerCounts = max }(MaxCallerCounts)
+	MaxCallerCounts = 3
+	Lvl1("new site")
+	Lvl1("other new site")
+	require.Equal(t, uint64(2), CallerCounts()[CallerOther])
+
+	// At level 0, the UI functions are still counted
+	SetDebugVisible(0)
+	ResetCounts()
+	Error("bare")
+	require.Equal(t, map[string]uint64{"error": 1}, Counts())
+	GetStdOut()
+	GetStdErr()
+}
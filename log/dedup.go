@@ -0,0 +1,112 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DedupInterval is how often a message repeated without interruption is
+// reported as repeated. The remaining repetitions are reported with the
+// next different message.
+var DedupInterval = 10 * time.Second
+
+// dedupLevels are the names of the levels set with SetDedup.
+var dedupLevels map[string]bool
+
+// dedupLast is the latest message of a level in dedupLevels, and how many
+// times it has been repeated since it was last shown.
+var dedupLast struct {
+	lvl      int
+	name     string
+	file     string
+	line     int
+	message  string
+	repeated int
+	shown    time.Time
+}
+
+// SetDedup collapses the identical consecutive messages of the given levels
+// into a "last message repeated N times" line. The levels have the names
+// they have in the output: "1" to "5", "I", "W", "E", "F" and "P". The
+// messages are identical if they have the same level and caller. The
+// registered loggers only get the lines shown. At debug level 0, the
+// messages of Warn and Error are not deduplicated. No level stops the
+// deduplication.
+func SetDedup(levels []string) error {
+	if err := CheckDedup(levels); err != nil {
+		return err
+	}
+	debugMut.Lock()
+	defer debugMut.Unlock()
+	dedupFlush()
+	dedupLevels = make(map[string]bool)
+	for _, l := range levels {
+		dedupLevels[l] = true
+	}
+	return nil
+}
+
+// Dedup returns the levels set with SetDedup.
+func Dedup() []string {
+	debugMut.RLock()
+	defer debugMut.RUnlock()
+	var levels []string
+	for _, l := range []string{"1", "2", "3", "4", "5", "I", "W", "E", "F", "P"} {
+		if dedupLevels[l] {
+			levels = append(levels, l)
+		}
+	}
+	return levels
+}
+
+// CheckDedup returns the error SetDedup would return for levels.
+func CheckDedup(levels []string) error {
+	for _, l := range levels {
+		switch l {
+		case "1", "2", "3", "4", "5", "I", "W", "E", "F", "P":
+		default:
+			return errors.New("unknown level " + strings.TrimSpace(l))
+		}
+	}
+	return nil
+}
+
+// dedup returns whether the message repeats the latest one and is not to be
+// shown. It must be called with debugMut held.
+func dedup(lvl int, name, file string, line int, message string) bool {
+	l := &dedupLast
+	if l.message != "" {
+		if lvl == l.lvl && name == l.name && line == l.line && message == l.message {
+			l.repeated++
+			if time.Since(l.shown) < DedupInterval {
+				return true
+			}
+			dedupFlush()
+			l.message = message
+			return true
+		}
+		dedupFlush()
+	}
+	if !dedupLevels[levelName(lvl)] {
+		l.message = ""
+		return false
+	}
+	l.lvl, l.name, l.file, l.line, l.message = lvl, name, file, line, message
+	l.shown = time.Now()
+	return false
+}
+
+// dedupFlush shows the number of repetitions of the latest message, if any,
+// and forgets it. It must be called with debugMut held.
+func dedupFlush() {
+	l := &dedupLast
+	if l.repeated > 0 {
+		outputLine(l.lvl, l.name, l.file, l.line,
+			fmt.Sprintf("last message repeated %d times\n", l.repeated))
+	}
+	l.repeated = 0
+	l.message = ""
+	l.shown = time.Now()
+}
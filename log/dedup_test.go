@@ -0,0 +1,52 @@
+package log
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDedup(t *testing.T) {
+	defer SetDebugVisible(DebugVisible())
+	SetDebugVisible(1)
+	defer SetDedup(nil)
+	require.NotNil(t, SetDedup([]string{"X"}))
+	require.Nil(t, SetDedup([]string{"W"}))
+	require.Equal(t, []string{"W"}, Dedup())
+	GetStdErr()
+
+	for i := 0; i < 4; i++ {
+		Warn("flapping")
+	}
+	require.Equal(t, "W : (log.TestDedup: 0) - flapping\n", GetStdErr())
+	Warn("other")
+	require.Equal(t, "W : (log.TestDedup: 0) - last message repeated 3 times\n"+
+		"W : (log.TestDedup: 0) - other\n", GetStdErr())
+
+	// Only the given levels are deduplicated
+	for i := 0; i < 2; i++ {
+		Lvl1("same")
+	}
+	require.Equal(t, 2, strings.Count(GetStdOut(), "same"))
+
+	// A long repetition is reported every DedupInterval
+	defer func(i time.Duration) { DedupInterval = i }(DedupInterval)
+	DedupInterval = 0
+	warnAgain := func() { Warn("again") }
+	warnAgain()
+	warnAgain()
+	warnAgain()
+	require.Equal(t, "W : (log.TestDedup.func2: 0) - again\n"+
+		"W : (log.TestDedup.func2: 0) - last message repeated 1 times\n"+
+		"W : (log.TestDedup.func2: 0) - last message repeated 1 times\n", GetStdErr())
+
+	// Stopping the deduplication shows the remaining repetitions
+	DedupInterval = time.Hour
+	warnAgain()
+	require.Nil(t, SetDedup(nil))
+	require.Equal(t, "W : (log.TestDedup.func2: 0) - last message repeated 1 times\n", GetStdErr())
+	warnAgain()
+	require.Equal(t, "W : (log.TestDedup.func2: 0) - again\n", GetStdErr())
+}
@@ -0,0 +1,84 @@
+package log
+
+import (
+	"fmt"
+	"sort"
+)
+
+// If deterministic is true, the lines are kept in roundLines until the end
+// of the round.
+var deterministic = false
+
+// round is the logical time of the deterministic output.
+var round = 0
+
+type roundLine struct {
+	stdErr bool
+	str    string
+}
+
+var roundLines []roundLine
+
+// SetDeterministic turns the deterministic output on or off. In
+// deterministic mode, the lines are not written out directly, but buffered
+// until NextRound is called. Then they are sorted, so that the order in which
+// concurrent go-routines logged doesn't matter, and written with the round
+// and their position in the round instead of the wall-clock time:
+//	[3.1] 1 : (log.TestDeterministic: 0) - message
+// This allows to compare the output of a protocol run with a golden file.
+// Turning it off flushes the remaining lines. The lines of Fatal and Panic
+// are written out at once with the rest of their round, as the program
+// stops.
+func SetDeterministic(on bool) {
+	debugMut.Lock()
+	defer debugMut.Unlock()
+	if !on {
+		flushRound()
+	}
+	deterministic = on
+	round = 0
+}
+
+// Deterministic returns whether the output is in deterministic mode.
+func Deterministic() bool {
+	debugMut.Lock()
+	defer debugMut.Unlock()
+	return deterministic
+}
+
+// NextRound writes out the lines of the current round in sorted order and
+// starts a new round. It does nothing if the output is not deterministic.
+func NextRound() {
+	debugMut.Lock()
+	defer debugMut.Unlock()
+	if deterministic {
+		flushRound()
+	}
+}
+
+// flushDeterministic writes out the current round before the program
+// exits.
+func flushDeterministic() {
+	debugMut.Lock()
+	defer debugMut.Unlock()
+	if deterministic {
+		flushRound()
+	}
+}
+
+// flushRound must be called with debugMut held.
+func flushRound() {
+	sort.SliceStable(roundLines, func(i, j int) bool {
+		return roundLines[i].str < roundLines[j].str
+	})
+	for i, l := range roundLines {
+		str := fmt.Sprintf("[%d.%d] %s", round, i, l.str)
+		if l.stdErr {
+			fmt.Fprint(stdErr, str)
+		} else {
+			fmt.Fprint(stdOut, str)
+		}
+	}
+	roundLines = nil
+	round++
+}
@@ -0,0 +1,54 @@
+package log
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeterministic(t *testing.T) {
+	SetDebugVisible(1)
+	GetStdOut()
+	GetStdErr()
+	SetShowTime(true)
+	defer SetShowTime(false)
+	SetDeterministic(true)
+	require.True(t, Deterministic())
+
+	var wg sync.WaitGroup
+	for _, s := range []string{"c", "a", "b"} {
+		wg.Add(1)
+		go func(s string) {
+			Lvl1(s)
+			wg.Done()
+		}(s)
+	}
+	wg.Wait()
+	require.Equal(t, "", GetStdOut())
+	NextRound()
+	require.Equal(t, "[0.0] 1 : (log.TestDeterministic.func1: 0) - a\n"+
+		"[0.1] 1 : (log.TestDeterministic.func1: 0) - b\n"+
+		"[0.2] 1 : (log.TestDeterministic.func1: 0) - c\n", GetStdOut())
+
+	Lvl1("second")
+	Error("error")
+	SetDeterministic(false)
+	require.False(t, Deterministic())
+	require.Equal(t, "[1.0] 1 : (log.TestDeterministic: 0) - second\n", GetStdOut())
+	require.Equal(t, "[1.1] E : (log.TestDeterministic: 0) - error\n", GetStdErr())
+}
+
+func TestDeterministic_Panic(t *testing.T) {
+	SetDebugVisible(1)
+	GetStdOut()
+	GetStdErr()
+	SetDeterministic(true)
+	defer SetDeterministic(false)
+
+	Lvl1("before")
+	require.Panics(t, func() { Panic("stop") })
+	require.Equal(t, "[0.0] 1 : (log.TestDeterministic_Panic: 0) - before\n",
+		GetStdOut())
+	require.Contains(t, GetStdErr(), "[0.1] P : ")
+}
@@ -0,0 +1,146 @@
+package log
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// WrappedError is an error returned by Wrap, Wrapf and ErrorReturn. It
+// keeps the error it wraps, for errors.Is and errors.As, and the place it
+// was wrapped.
+type WrappedError struct {
+	// Caller is the function and line that wrapped the error
+	Caller string
+	// Msg is the context given to Wrap, can be empty
+	Msg string
+	Err error
+}
+
+// Error returns the context followed by the wrapped error.
+func (e *WrappedError) Error() string {
+	if e.Msg == "" {
+		return e.Err.Error()
+	}
+	return e.Msg + ": " + e.Err.Error()
+}
+
+// Unwrap returns the wrapped error.
+func (e *WrappedError) Unwrap() error {
+	return e.Err
+}
+
+// Wrap returns err with the context of the arguments, formatted like
+// Print, and the place of the caller. It returns nil if err is nil.
+func Wrap(err error, args ...interface{}) error {
+	if err == nil {
+		return nil
+	}
+	return wrap(err, fmt.Sprint(args...))
+}
+
+// Wrapf is like Wrap but with a format-string.
+func Wrapf(err error, f string, args ...interface{}) error {
+	if err == nil {
+		return nil
+	}
+	return wrap(err, fmt.Sprintf(f, args...))
+}
+
+// wrap must be called by the exported function called by the user.
+func wrap(err error, msg string) *WrappedError {
+	pc, _, line, _ := runtime.Caller(2)
+	fn := regexpPaths.ReplaceAllString(runtime.FuncForPC(pc).Name(), "")
+	return &WrappedError{Caller: fn + ":" + strconv.Itoa(line), Msg: msg, Err: err}
+}
+
+// Callers returns the places where err was wrapped, outermost first.
+func Callers(err error) []string {
+	var callers []string
+	for err != nil {
+		if we, ok := err.(*WrappedError); ok {
+			callers = append(callers, we.Caller)
+		}
+		u, ok := err.(interface{ Unwrap() error })
+		if !ok {
+			break
+		}
+		err = u.Unwrap()
+	}
+	return callers
+}
+
+// ErrorReturn shows err with Error, wrapped with the context of the
+// arguments, and returns it. It does nothing and returns nil if err is
+// nil. It is meant for
+//	return log.ErrorReturn(err, "couldn't store the block")
+func ErrorReturn(err error, args ...interface{}) error {
+	if err == nil {
+		return nil
+	}
+	we := wrap(err, fmt.Sprint(args...))
+	lvlUI(lvlError, we)
+	return we
+}
+
+// errorHooks are the functions given to OnError, by key.
+var errorHooks = map[int]func(error){}
+
+// errorHooksNext is the key of the next hook.
+var errorHooksNext = 0
+
+var errorHooksMut sync.Mutex
+
+// OnError adds fn to the functions called with every error logged: the
+// errors given to ErrFatal, ErrFatalf and ErrorReturn, and the errors in
+// the arguments of Error, Fatal and Panic. This lets a monitoring system
+// count or report them. fn must not log errors itself. OnError returns
+// the key to remove fn with RemoveOnError.
+func OnError(fn func(error)) int {
+	errorHooksMut.Lock()
+	defer errorHooksMut.Unlock()
+	key := errorHooksNext
+	errorHooksNext++
+	errorHooks[key] = fn
+	return key
+}
+
+// RemoveOnError removes the function with the given key.
+func RemoveOnError(key int) {
+	errorHooksMut.Lock()
+	defer errorHooksMut.Unlock()
+	delete(errorHooks, key)
+}
+
+// notifyError calls the hooks, in the order of their registration.
+func notifyError(err error) {
+	errorHooksMut.Lock()
+	keys := make([]int, 0, len(errorHooks))
+	for k := range errorHooks {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	hooks := make([]func(error), len(keys))
+	for i, k := range keys {
+		hooks[i] = errorHooks[k]
+	}
+	errorHooksMut.Unlock()
+	for _, h := range hooks {
+		h(err)
+	}
+}
+
+// notifyErrors calls the hooks with the errors in args, if lvl is an error
+// level.
+func notifyErrors(lvl int, args []interface{}) {
+	if lvl != lvlError && lvl != lvlFatal && lvl != lvlPanic {
+		return
+	}
+	for _, a := range args {
+		if err, ok := a.(error); ok {
+			notifyError(err)
+		}
+	}
+}
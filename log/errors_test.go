@@ -0,0 +1,52 @@
+package log
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrap(t *testing.T) {
+	require.Nil(t, Wrap(nil, "nothing"))
+	require.Nil(t, Wrapf(nil, "nothing %d", 1))
+
+	err := Wrapf(Wrap(os.ErrNotExist), "reading %s", "file")
+	require.Equal(t, "reading file: "+os.ErrNotExist.Error(), err.Error())
+	require.True(t, errors.Is(err, os.ErrNotExist))
+	var we *WrappedError
+	require.True(t, errors.As(err, &we))
+	require.Equal(t, "reading file", we.Msg)
+
+	callers := Callers(err)
+	require.Equal(t, 2, len(callers))
+	for _, c := range callers {
+		require.True(t, strings.HasPrefix(c, "log.TestWrap:"), c)
+	}
+	require.Empty(t, Callers(os.ErrNotExist))
+}
+
+func TestErrorReturn(t *testing.T) {
+	defer SetDebugVisible(DebugVisible())
+	SetDebugVisible(1)
+	var logged []error
+	key := OnError(func(err error) { logged = append(logged, err) })
+
+	require.Nil(t, ErrorReturn(nil, "nothing"))
+	err := ErrorReturn(os.ErrClosed, "closing")
+	require.True(t, errors.Is(err, os.ErrClosed))
+	require.Equal(t, "E : (log.TestErrorReturn: 0) - closing: "+os.ErrClosed.Error()+"\n",
+		GetStdErr())
+
+	Error("failed:", os.ErrPermission)
+	Warn("not an error level", os.ErrPermission)
+	Error("no error")
+	require.Equal(t, []error{err, os.ErrPermission}, logged)
+
+	RemoveOnError(key)
+	Error(os.ErrPermission)
+	require.Equal(t, 2, len(logged))
+	GetStdErr()
+}
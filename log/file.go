@@ -0,0 +1,169 @@
+package log
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultFileFlushInterval is how often a FileLogger writes its buffer to
+// the file, if the configuration doesn't say.
+const DefaultFileFlushInterval = time.Second
+
+// FileLoggerConfig is the configuration of a FileLogger.
+type FileLoggerConfig struct {
+	// Path is the file, created if needed. The entries are appended.
+	Path string
+	// FlushInterval is how often the buffer is written to the file,
+	// DefaultFileFlushInterval if 0.
+	FlushInterval time.Duration
+	// SyncEvery, if not 0, writes the buffer and syncs the file to the
+	// disk after every SyncEvery entries. If 0, the file is only synced
+	// when the logger is closed.
+	SyncEvery int
+}
+
+// Check returns the error NewFileLogger would return for conf, except for
+// the errors of opening the file.
+func (conf FileLoggerConfig) Check() error {
+	switch {
+	case conf.Path == "":
+		return errors.New("no path")
+	case conf.FlushInterval < 0:
+		return errors.New("negative flush interval")
+	case conf.SyncEvery < 0:
+		return errors.New("negative sync policy")
+	}
+	return nil
+}
+
+// FileLogger appends the entries to a file, in the format of
+// RingLogger.Dump. The file stays open and the entries are buffered, so
+// an entry can take up to FlushInterval to reach the file. If the file is
+// removed or renamed, for example by logrotate, a new file is created at
+// the next flush.
+type FileLogger struct {
+	conf  FileLoggerConfig
+	file  *os.File
+	buf   *bufio.Writer
+	count int
+	quit  chan struct{}
+	done  chan struct{}
+	once  sync.Once
+	sync.Mutex
+}
+
+// NewFileLogger opens the file of conf and returns a logger writing to it,
+// to be given to RegisterLogger.
+func NewFileLogger(conf FileLoggerConfig) (*FileLogger, error) {
+	if err := conf.Check(); err != nil {
+		return nil, err
+	}
+	if conf.FlushInterval == 0 {
+		conf.FlushInterval = DefaultFileFlushInterval
+	}
+	fl := &FileLogger{
+		conf: conf,
+		quit: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	f, err := openLogFile(conf.Path)
+	if err != nil {
+		return nil, err
+	}
+	fl.file = f
+	fl.buf = bufio.NewWriter(f)
+	go fl.run()
+	return fl, nil
+}
+
+// Log implements Logger.
+func (fl *FileLogger) Log(e *Entry) {
+	fl.Lock()
+	defer fl.Unlock()
+	if fl.file == nil {
+		return
+	}
+	fl.buf.WriteString(entryLine(e))
+	fl.count++
+	if fl.conf.SyncEvery > 0 && fl.count%fl.conf.SyncEvery == 0 {
+		fl.buf.Flush()
+		fl.file.Sync()
+	}
+}
+
+// Flush writes the buffered entries to the file, and creates a new file if
+// it has been removed or renamed.
+func (fl *FileLogger) Flush() error {
+	fl.Lock()
+	defer fl.Unlock()
+	if fl.file == nil {
+		return errors.New("file logger closed")
+	}
+	err := fl.buf.Flush()
+	if fl.moved() {
+		// Keep the old file until a new one can be created.
+		f, oerr := openLogFile(fl.conf.Path)
+		if oerr != nil {
+			return oerr
+		}
+		fl.file.Close()
+		fl.file = f
+		fl.buf.Reset(f)
+	}
+	return err
+}
+
+// Close implements Logger. It writes the buffered entries and syncs the
+// file.
+func (fl *FileLogger) Close() error {
+	fl.once.Do(func() { close(fl.quit) })
+	<-fl.done
+	fl.Lock()
+	defer fl.Unlock()
+	if fl.file == nil {
+		return nil
+	}
+	err := fl.buf.Flush()
+	if serr := fl.file.Sync(); err == nil {
+		err = serr
+	}
+	if cerr := fl.file.Close(); err == nil {
+		err = cerr
+	}
+	fl.file = nil
+	return err
+}
+
+// run flushes the buffer every FlushInterval.
+func (fl *FileLogger) run() {
+	defer close(fl.done)
+	t := time.NewTicker(fl.conf.FlushInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			// A failed flush is tried again at the next tick.
+			fl.Flush()
+		case <-fl.quit:
+			return
+		}
+	}
+}
+
+func openLogFile(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+}
+
+// moved returns whether the path doesn't lead to the open file anymore. It
+// must be called with the lock held.
+func (fl *FileLogger) moved() bool {
+	fi, err := os.Stat(fl.conf.Path)
+	if err != nil {
+		return os.IsNotExist(err)
+	}
+	open, err := fl.file.Stat()
+	return err == nil && !os.SameFile(fi, open)
+}
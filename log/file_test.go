@@ -0,0 +1,59 @@
+package log
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileLogger(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "filelogger")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmp)
+	path := filepath.Join(tmp, "onet.log")
+
+	_, err = NewFileLogger(FileLoggerConfig{})
+	require.NotNil(t, err)
+	_, err = NewFileLogger(FileLoggerConfig{Path: filepath.Join(tmp, "none", "x.log")})
+	require.NotNil(t, err)
+
+	fl, err := NewFileLogger(FileLoggerConfig{Path: path, FlushInterval: time.Hour, SyncEvery: 2})
+	require.Nil(t, err)
+	fl.Log(&Entry{LevelName: "1", Function: "f", Line: 1, Message: "one"})
+	read := func(p string) string {
+		buf, err := ioutil.ReadFile(p)
+		require.Nil(t, err)
+		return string(buf)
+	}
+	// Buffered until the second entry
+	require.Equal(t, "", read(path))
+	fl.Log(&Entry{LevelName: "W", Function: "f", Line: 2, Message: "two"})
+	lines := strings.Split(strings.TrimSpace(read(path)), "\n")
+	require.Equal(t, 2, len(lines))
+	require.True(t, strings.HasSuffix(lines[1], " W  f:2 - two"), lines[1])
+
+	// After a rotation, the entries go to a new file
+	require.Nil(t, os.Rename(path, path+".1"))
+	fl.Log(&Entry{LevelName: "1", Message: "old"})
+	require.Nil(t, fl.Flush())
+	fl.Log(&Entry{LevelName: "1", Message: "new"})
+	require.Nil(t, fl.Close())
+	require.True(t, strings.Contains(read(path+".1"), "old"))
+	require.True(t, strings.Contains(read(path), "new"))
+	require.False(t, strings.Contains(read(path), "old"))
+
+	// Removing the file works the same
+	fl, err = NewFileLogger(FileLoggerConfig{Path: path, FlushInterval: 10 * time.Millisecond})
+	require.Nil(t, err)
+	require.Nil(t, os.Remove(path))
+	time.Sleep(50 * time.Millisecond)
+	fl.Log(&Entry{LevelName: "1", Message: "recreated"})
+	require.Nil(t, fl.Close())
+	require.True(t, strings.Contains(read(path), "recreated"))
+	require.NotNil(t, fl.Flush())
+}
@@ -0,0 +1,243 @@
+package log
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/daviddengcn/go-colortext"
+)
+
+// Line holds the parts of a log line given to the template of SetFormat.
+type Line struct {
+	// Level is "1" to "5", "I", "W", "E", "F" or "P", with a "!" for the
+	// LLvl functions
+	Level string
+	// Time is when the line was logged, or the zero time in deterministic
+	// mode. It is in UTC if SetTimeUTC is set.
+	Time time.Time
+	// Timestamp is Time in the format of SetTimeFormat, or empty in
+	// deterministic mode
+	Timestamp string
+	// Caller is the function and line number of the caller
+	Caller string
+	// Static is StaticMsg
+	Static string
+	// Message is the message, without the final newline
+	Message string
+}
+
+// format is the template of the lines, or nil for the default format.
+var format *template.Template
+
+// formatString is the template given to SetFormat.
+var formatString string
+
+// SetFormat sets the template of the lines of the log, in the syntax of
+// text/template with a Line as data, for example
+//	{{.Level}} {{.Time.Format "15:04:05"}} {{.Caller}}: {{.Message}}
+// A newline is added to each line. SetShowTime doesn't apply to a template.
+// An empty template restores the default format.
+func SetFormat(f string) error {
+	t, err := parseFormat(f)
+	if err != nil {
+		return err
+	}
+	debugMut.Lock()
+	defer debugMut.Unlock()
+	format = t
+	formatString = f
+	return nil
+}
+
+// Format returns the template set with SetFormat.
+func Format() string {
+	debugMut.RLock()
+	defer debugMut.RUnlock()
+	return formatString
+}
+
+// CheckFormat returns the error SetFormat would return for f.
+func CheckFormat(f string) error {
+	_, err := parseFormat(f)
+	return err
+}
+
+func parseFormat(f string) (*template.Template, error) {
+	if f == "" {
+		return nil, nil
+	}
+	t, err := template.New("log").Parse(f)
+	if err != nil {
+		return nil, err
+	}
+	// Catch the unknown fields now instead of at every line.
+	if err := t.Execute(&bytes.Buffer{}, &Line{}); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// formatLine returns the line made with the template.
+func formatLine(l *Line) string {
+	var buf bytes.Buffer
+	if err := format.Execute(&buf, l); err != nil {
+		return l.Level + " " + l.Message + " (" + err.Error() + ")\n"
+	}
+	buf.WriteByte('\n')
+	return buf.String()
+}
+
+// The formats of the time accepted by SetTimeFormat.
+const (
+	// TimeFormatDefault is "06/02/01 15:04:05.000000000", the format of
+	// the first versions
+	TimeFormatDefault = ""
+	// TimeFormatRFC3339 is "2006-01-02T15:04:05Z07:00"
+	TimeFormatRFC3339 = "rfc3339"
+	// TimeFormatRFC3339Nano is TimeFormatRFC3339 with nanoseconds
+	TimeFormatRFC3339Nano = "rfc3339nano"
+	// TimeFormatUnixMillis is the number of milliseconds since 1970
+	TimeFormatUnixMillis = "unixmillis"
+)
+
+// timeFormat is the format of the time, see SetTimeFormat.
+var timeFormat = TimeFormatDefault
+
+// timeUTC is set if the time is shown in UTC instead of the local time.
+var timeUTC = false
+
+// SetTimeFormat sets the format of the time shown by SetShowTime and of
+// Line.Timestamp: one of the TimeFormat constants.
+func SetTimeFormat(f string) error {
+	if err := CheckTimeFormat(f); err != nil {
+		return err
+	}
+	debugMut.Lock()
+	defer debugMut.Unlock()
+	timeFormat = f
+	return nil
+}
+
+// TimeFormat returns the format set with SetTimeFormat.
+func TimeFormat() string {
+	debugMut.RLock()
+	defer debugMut.RUnlock()
+	return timeFormat
+}
+
+// CheckTimeFormat returns the error SetTimeFormat would return for f.
+func CheckTimeFormat(f string) error {
+	switch strings.ToLower(f) {
+	case TimeFormatDefault, TimeFormatRFC3339, TimeFormatRFC3339Nano, TimeFormatUnixMillis:
+		return nil
+	}
+	return errors.New("unknown time format " + f)
+}
+
+// SetTimeUTC shows the time in UTC if utc is true, else in the local time.
+func SetTimeUTC(utc bool) {
+	debugMut.Lock()
+	defer debugMut.Unlock()
+	timeUTC = utc
+}
+
+// TimeUTC returns whether the time is shown in UTC.
+func TimeUTC() bool {
+	debugMut.RLock()
+	defer debugMut.RUnlock()
+	return timeUTC
+}
+
+// now returns the time of a line in the timezone of the settings.
+func now() time.Time {
+	if timeUTC {
+		return time.Now().UTC()
+	}
+	return time.Now()
+}
+
+// formatTime returns t in the format of the settings.
+func formatTime(t time.Time) string {
+	switch strings.ToLower(timeFormat) {
+	case TimeFormatRFC3339:
+		return t.Format(time.RFC3339)
+	case TimeFormatRFC3339Nano:
+		return t.Format(time.RFC3339Nano)
+	case TimeFormatUnixMillis:
+		return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)
+	}
+	return fmt.Sprintf("%s.%09d", t.Format("06/02/01 15:04:05"), t.Nanosecond())
+}
+
+// Theme gives the colors of the levels, by the names they have in the
+// output: "1" to "5", "I", "W", "E", "F" and "P". A color is one of
+// "black", "red", "green", "yellow", "blue", "magenta", "cyan", "white" or
+// "none", and can be prefixed with "bright-". The levels missing from the
+// theme keep their default color.
+type Theme map[string]string
+
+var themeColors = map[string]ct.Color{
+	"none":    ct.None,
+	"black":   ct.Black,
+	"red":     ct.Red,
+	"green":   ct.Green,
+	"yellow":  ct.Yellow,
+	"blue":    ct.Blue,
+	"magenta": ct.Magenta,
+	"cyan":    ct.Cyan,
+	"white":   ct.White,
+}
+
+// themeColor is a parsed color of a Theme.
+type themeColor struct {
+	color  ct.Color
+	bright bool
+}
+
+// theme is the parsed theme set with SetTheme.
+var theme map[string]themeColor
+
+// SetTheme sets the colors used by SetUseColors. A nil theme restores the
+// default colors.
+func SetTheme(t Theme) error {
+	parsed, err := t.parse()
+	if err != nil {
+		return err
+	}
+	debugMut.Lock()
+	defer debugMut.Unlock()
+	theme = parsed
+	return nil
+}
+
+// Check returns the error SetTheme would return for t.
+func (t Theme) Check() error {
+	_, err := t.parse()
+	return err
+}
+
+func (t Theme) parse() (map[string]themeColor, error) {
+	if t == nil {
+		return nil, nil
+	}
+	parsed := make(map[string]themeColor, len(t))
+	for level, name := range t {
+		switch level {
+		case "1", "2", "3", "4", "5", "I", "W", "E", "F", "P":
+		default:
+			return nil, errors.New("theme: unknown level " + level)
+		}
+		bright := strings.HasPrefix(name, "bright-")
+		c, ok := themeColors[strings.TrimPrefix(name, "bright-")]
+		if !ok {
+			return nil, errors.New("theme: unknown color " + name)
+		}
+		parsed[level] = themeColor{c, bright}
+	}
+	return parsed, nil
+}
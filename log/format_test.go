@@ -0,0 +1,100 @@
+package log
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/daviddengcn/go-colortext"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetFormat(t *testing.T) {
+	SetDebugVisible(1)
+	defer SetFormat("")
+	GetStdOut()
+
+	require.Nil(t, SetFormat("{{.Level}}|{{.Caller}}|{{.Message}}"))
+	require.Equal(t, "{{.Level}}|{{.Caller}}|{{.Message}}", Format())
+	Lvl1("templated")
+	require.Equal(t, "1|log.TestSetFormat:0|templated\n", GetStdOut())
+	Warn("warned")
+	require.Equal(t, "W|log.TestSetFormat:0|warned\n", GetStdErr())
+
+	StaticMsg = "node"
+	require.Nil(t, SetFormat("[{{.Static}}] {{.Message}}"))
+	LLvl3("always")
+	require.Equal(t, "[node] always\n", GetStdOut())
+	StaticMsg = ""
+
+	require.Nil(t, SetFormat(`{{.Time.Format "2006"}} {{.Message}}`))
+	Lvl1("timed")
+	ok, err := regexp.MatchString(`^\d{4} timed\n$`, GetStdOut())
+	require.Nil(t, err)
+	require.True(t, ok)
+
+	require.NotNil(t, SetFormat("{{.Level"))
+	require.NotNil(t, SetFormat("{{.Unknown}}"))
+	require.NotNil(t, CheckFormat("{{.Unknown}}"))
+	require.Nil(t, CheckFormat("{{.Message}}"))
+	require.Equal(t, `{{.Time.Format "2006"}} {{.Message}}`, Format())
+
+	require.Nil(t, SetFormat(""))
+	Lvl1("default")
+	require.Equal(t, "1 : (log.TestSetFormat: 0) - default\n", GetStdOut())
+}
+
+func TestSetTheme(t *testing.T) {
+	defer SetTheme(nil)
+	require.Nil(t, SetTheme(Theme{"E": "bright-magenta", "3": "none"}))
+	debugMut.RLock()
+	require.Equal(t, themeColor{ct.Magenta, true}, theme["E"])
+	require.Equal(t, themeColor{ct.None, false}, theme["3"])
+	debugMut.RUnlock()
+
+	require.NotNil(t, SetTheme(Theme{"6": "red"}))
+	require.NotNil(t, Theme{"W": "pink"}.Check())
+	require.Nil(t, Theme{"W": "bright-yellow"}.Check())
+	require.Nil(t, SetTheme(nil))
+	debugMut.RLock()
+	require.Nil(t, theme)
+	debugMut.RUnlock()
+}
+
+func TestSetTimeFormat(t *testing.T) {
+	SetDebugVisible(1)
+	SetShowTime(true)
+	SetTimeUTC(true)
+	defer func() {
+		SetShowTime(false)
+		SetTimeUTC(false)
+		SetTimeFormat(TimeFormatDefault)
+	}()
+	GetStdOut()
+
+	require.Nil(t, SetTimeFormat(TimeFormatRFC3339))
+	Lvl1("rfc")
+	out := GetStdOut()
+	ok, err := regexp.MatchString(`^1 \d{4}-\d\d-\d\dT\d\d:\d\d:\d\dZ: \(log.TestSetTimeFormat: 0\) - rfc\n$`, out)
+	require.Nil(t, err)
+	require.True(t, ok, out)
+
+	require.Nil(t, SetTimeFormat("RFC3339Nano"))
+	require.Nil(t, SetFormat("{{.Timestamp}} {{.Time.Location}} {{.Message}}"))
+	Lvl1("nano")
+	out = GetStdOut()
+	SetFormat("")
+	ok, err = regexp.MatchString(`^\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d(\.\d+)?Z UTC nano\n$`, out)
+	require.Nil(t, err)
+	require.True(t, ok, out)
+
+	require.Nil(t, SetTimeFormat(TimeFormatUnixMillis))
+	Lvl1("millis")
+	out = GetStdOut()
+	ok, err = regexp.MatchString(`^1 \d{13}: `, out)
+	require.Nil(t, err)
+	require.True(t, ok, out)
+
+	require.NotNil(t, SetTimeFormat("iso"))
+	require.Equal(t, TimeFormatUnixMillis, TimeFormat())
+	require.True(t, TimeUTC())
+}
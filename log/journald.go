@@ -0,0 +1,116 @@
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// journalSocket is where journald listens for the entries in its native
+// protocol.
+var journalSocket = "/run/systemd/journal/socket"
+
+// JournaldLogger writes the entries to systemd-journald with its native
+// protocol, so that the priority and the caller are kept as fields of the
+// journal instead of being part of the message.
+type JournaldLogger struct {
+	// Fields are added to every entry, for example SYSLOG_IDENTIFIER. The
+	// names must be upper case letters, digits and underscores.
+	Fields map[string]string
+	conn   *net.UnixConn
+	sync.Mutex
+}
+
+// NewJournaldLogger returns a logger writing to the local journald, to be
+// given to RegisterLogger. It fails if journald doesn't run.
+func NewJournaldLogger() (*JournaldLogger, error) {
+	addr := &net.UnixAddr{Name: journalSocket, Net: "unixgram"}
+	conn, err := net.DialUnix("unixgram", nil, addr)
+	if err != nil {
+		return nil, err
+	}
+	return &JournaldLogger{
+		Fields: map[string]string{
+			"SYSLOG_IDENTIFIER": filepath.Base(os.Args[0]),
+		},
+		conn: conn,
+	}, nil
+}
+
+// Log implements Logger. The entries that can't be written are dropped.
+func (j *JournaldLogger) Log(e *Entry) {
+	j.Lock()
+	defer j.Unlock()
+	var buf bytes.Buffer
+	journalField(&buf, "MESSAGE", e.Message)
+	journalField(&buf, "PRIORITY", strconv.Itoa(syslogPriority(e)))
+	journalField(&buf, "CODE_FILE", e.File)
+	journalField(&buf, "CODE_LINE", strconv.Itoa(e.Line))
+	journalField(&buf, "CODE_FUNC", e.Function)
+	journalField(&buf, "ONET_LEVEL", e.LevelName)
+	if e.Static != "" {
+		journalField(&buf, "ONET_STATIC", e.Static)
+	}
+	for k, v := range j.Fields {
+		if validJournalField(k) {
+			journalField(&buf, k, v)
+		}
+	}
+	// Can't log the error, the log package is locked.
+	j.conn.Write(buf.Bytes())
+}
+
+// Close implements Logger.
+func (j *JournaldLogger) Close() error {
+	return j.conn.Close()
+}
+
+// syslogPriority returns the syslog severity of the entry.
+func syslogPriority(e *Entry) int {
+	switch e.Level {
+	case lvlPanic, lvlFatal:
+		return 2
+	case lvlError:
+		return 3
+	case lvlWarning:
+		return 4
+	case lvlInfo, lvlPrint, 1, -1:
+		return 6
+	}
+	return 7
+}
+
+// journalField writes a field in the native protocol: "KEY=value\n", or
+// for a value with newlines "KEY\n", its length in 64 bits little endian,
+// the value and "\n".
+func journalField(buf *bytes.Buffer, key, value string) {
+	buf.WriteString(key)
+	if !strings.Contains(value, "\n") {
+		buf.WriteByte('=')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+		return
+	}
+	buf.WriteByte('\n')
+	binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
+
+// validJournalField returns whether journald accepts the name of a field.
+func validJournalField(k string) bool {
+	if k == "" || k[0] == '_' || (k[0] >= '0' && k[0] <= '9') {
+		return false
+	}
+	for _, c := range k {
+		if !(c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,82 @@
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// readJournalFields decodes an entry of the native protocol of journald.
+func readJournalFields(t *testing.T, buf []byte) map[string]string {
+	fields := map[string]string{}
+	for len(buf) > 0 {
+		i := bytes.IndexAny(buf, "=\n")
+		require.True(t, i > 0)
+		key := string(buf[:i])
+		if buf[i] == '=' {
+			end := bytes.IndexByte(buf, '\n')
+			fields[key] = string(buf[i+1 : end])
+			buf = buf[end+1:]
+			continue
+		}
+		n := binary.LittleEndian.Uint64(buf[i+1 : i+9])
+		fields[key] = string(buf[i+9 : i+9+int(n)])
+		buf = buf[i+9+int(n)+1:]
+	}
+	return fields
+}
+
+func TestJournaldLogger(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "journald")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmp)
+	old := journalSocket
+	journalSocket = filepath.Join(tmp, "socket")
+	defer func() { journalSocket = old }()
+
+	_, err = NewJournaldLogger()
+	require.NotNil(t, err)
+
+	srv, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+	require.Nil(t, err)
+	defer srv.Close()
+	jl, err := NewJournaldLogger()
+	require.Nil(t, err)
+	jl.Fields["APP"] = "test"
+	jl.Fields["bad-name"] = "ignored"
+	key := RegisterLogger(jl)
+
+	SetDebugVisible(1)
+	GetStdErr()
+	Error("two\nlines")
+	GetStdErr()
+	require.Nil(t, UnregisterLogger(key))
+	Error("not in the journal")
+	GetStdErr()
+
+	buf := make([]byte, 4096)
+	n, err := srv.Read(buf)
+	require.Nil(t, err)
+	fields := readJournalFields(t, buf[:n])
+	require.Equal(t, "two\nlines", fields["MESSAGE"])
+	require.Equal(t, "3", fields["PRIORITY"])
+	require.Equal(t, "E", fields["ONET_LEVEL"])
+	require.Equal(t, "journald_test.go", filepath.Base(fields["CODE_FILE"]))
+	require.Equal(t, "log.TestJournaldLogger", fields["CODE_FUNC"])
+	require.Equal(t, "test", fields["APP"])
+	require.Equal(t, filepath.Base(os.Args[0]), fields["SYSLOG_IDENTIFIER"])
+	_, ok := fields["bad-name"]
+	require.False(t, ok)
+}
+
+func TestJournalPriority(t *testing.T) {
+	for l, p := range map[int]int{lvlPanic: 2, lvlWarning: 4, lvlInfo: 6, 1: 6, -1: 6, 2: 7, -5: 7} {
+		require.Equal(t, p, syslogPriority(&Entry{Level: l}))
+	}
+}
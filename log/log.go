@@ -22,6 +22,17 @@
 // You can also add a 'f' to the name and use it like fmt.Printf:
 //	log.Lvlf1("Level: %d/%d", now, max)
 //
+// For log statements in hot paths, like a per-message loop, the output can
+// be sampled or rate-limited per call-site:
+//	log.Sampled(100).Lvl4("Only every 100th message is shown")
+//	log.RateLimited(10).Lvl4("At most 10 lines per second are shown")
+// The number of suppressed lines is added to the next line shown.
+//
+// Besides the console, the lines can go to other Loggers, for example
+// systemd-journald:
+//	jl, err := log.NewJournaldLogger()
+//	key := log.RegisterLogger(jl)
+//
 // The common messages are:
 //	log.Print("Simple output")
 //	log.Info("For your information")
@@ -35,10 +46,20 @@
 // - Format == FormatPython - with some nice python-style formatting
 // - Format == FormatNone - just as plain text
 //
+// Errors can be given context while keeping them usable with errors.Is
+// and errors.As, and logged on their way up:
+//	return log.Wrapf(err, "reading %s", file)
+//	return log.ErrorReturn(err, "couldn't store the block")
+// OnError registers a function called with every error logged.
+//
 // The log-package also takes into account the following environment-variables:
 //	DEBUG_LVL // will act like SetDebugVisible
 //	DEBUG_TIME // if 'true' it will print the date and time
 //	DEBUG_COLOR // if 'false' it will not use colors
+//	DEBUG_FORMAT // the template of the lines, see SetFormat
+//	DEBUG_TIME_FORMAT // the format of the time, see SetTimeFormat
+//	DEBUG_UTC // if 'true' the time is in UTC
+//	DEBUG_DEDUP // the levels to deduplicate, e.g. "W,E", see SetDedup
 // But for this the function ParseEnv() or AddFlags() has to be called.
 package log
 
@@ -62,7 +83,9 @@ var bufStdErr bytes.Buffer
 
 // OutputToBuf is called for sending all the log.*-outputs to internal buffers
 // that can be used for checking what the logger would've written. This is
-// mostly used for tests. The buffers are zeroed after this call.
+// mostly used for tests. The buffers are zeroed after this call. As the
+// output is redirected for the whole process, tests should rather use
+// Capture, which leaves the output as it is.
 func OutputToBuf() {
 	debugMut.Lock()
 	defer debugMut.Unlock()
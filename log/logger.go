@@ -0,0 +1,185 @@
+package log
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Entry is a line of the log, as given to the registered Loggers.
+type Entry struct {
+	// Level is the debug level from 1 to 5, negative for the LLvl
+	// functions, or one of LevelPrint, LevelInfo, LevelWarning,
+	// LevelError, LevelFatal and LevelPanic
+	Level int
+	// LevelName is the level as shown in the output: "1" to "5", "I",
+	// "W", "E", "F" or "P", with a "!" for the LLvl functions
+	LevelName string
+	Time      time.Time
+	// File, Line and Function are the caller of the log function
+	File     string
+	Line     int
+	Function string
+	// Static is StaticMsg
+	Static string
+	// Message is the message, without the final newline
+	Message string
+}
+
+// Logger gets the entries of the log, in addition to the output on the
+// console. It only gets the entries allowed by the debug level. Log is
+// called with the log package locked, so it must not log itself.
+type Logger interface {
+	Log(e *Entry)
+	// Close is called when the logger is unregistered.
+	Close() error
+}
+
+// LevelLogger is a Logger that gets the entries up to its own debug level,
+// even those DebugVisible hides.
+type LevelLogger interface {
+	Logger
+	// MaxLevel returns the highest debug level the logger gets.
+	MaxLevel() int
+}
+
+// loggers are the registered loggers, by key.
+var loggers = map[int]Logger{}
+
+// loggersLevel is the highest MaxLevel of the registered LevelLoggers.
+var loggersLevel = 0
+
+// loggersNext is the key of the next registered logger.
+var loggersNext = 0
+
+// RegisterLogger adds l to the loggers and returns the key to unregister
+// it.
+func RegisterLogger(l Logger) int {
+	debugMut.Lock()
+	defer debugMut.Unlock()
+	key := loggersNext
+	loggersNext++
+	loggers[key] = l
+	updateLoggersLevel()
+	return key
+}
+
+// UnregisterLogger removes and closes the logger with the given key.
+func UnregisterLogger(key int) error {
+	debugMut.Lock()
+	l, ok := loggers[key]
+	delete(loggers, key)
+	updateLoggersLevel()
+	debugMut.Unlock()
+	if !ok {
+		return nil
+	}
+	return l.Close()
+}
+
+// updateLoggersLevel must be called with debugMut held.
+func updateLoggersLevel() {
+	loggersLevel = 0
+	for _, l := range loggers {
+		if ll, ok := l.(LevelLogger); ok && ll.MaxLevel() > loggersLevel {
+			loggersLevel = ll.MaxLevel()
+		}
+	}
+}
+
+// hidden returns whether the level is neither visible nor wanted by a
+// logger. It must be called with debugMut held.
+func hidden(lvl int) bool {
+	return lvl > debugVisible && lvl > loggersLevel
+}
+
+// wanted returns whether the level is visible or wanted by a logger.
+func wanted(lvl int) bool {
+	debugMut.RLock()
+	defer debugMut.RUnlock()
+	return !hidden(lvl)
+}
+
+// logEntry gives e to the loggers, in the order of their registration. The
+// loggers only get the entries above DebugVisible if they are
+// LevelLoggers that want them. It must be called with debugMut held.
+func logEntry(e *Entry) {
+	if len(loggers) == 0 {
+		return
+	}
+	keys := make([]int, 0, len(loggers))
+	for k := range loggers {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	for _, k := range keys {
+		l := loggers[k]
+		if e.Level > debugVisible {
+			ll, ok := l.(LevelLogger)
+			if !ok || e.Level > ll.MaxLevel() {
+				continue
+			}
+		}
+		l.Log(e)
+	}
+}
+
+// entryLine returns e as a line of the RingLogger and FileLogger.
+func entryLine(e *Entry) string {
+	return fmt.Sprintf("%s %-2s %s:%d - %s\n",
+		e.Time.Format(time.RFC3339Nano), e.LevelName, e.Function, e.Line, e.Message)
+}
+
+// logUI counts the message of a UI function and gives its entry to the
+// loggers when the debug level is 0 or FormatPython, as the UI functions
+// then print the bare message without going through output.
+func logUI(lvl int, args ...interface{}) {
+	debugMut.Lock()
+	defer debugMut.Unlock()
+	pc, file, line, _ := runtime.Caller(3)
+	fn := regexpPaths.ReplaceAllString(runtime.FuncForPC(pc).Name(), "")
+	countMessage(lvl, fn, line)
+	if len(loggers) == 0 {
+		return
+	}
+	if !outputLines {
+		line = 0
+	}
+	e := &Entry{
+		Level:     lvl,
+		LevelName: levelName(lvl),
+		File:      file,
+		Line:      line,
+		Function:  fn,
+		Static:    StaticMsg,
+		Message:   strings.TrimSuffix(fmt.Sprintln(args...), "\n"),
+	}
+	if !deterministic {
+		e.Time = now()
+	}
+	logEntry(e)
+}
+
+// levelName returns the name of the level as shown in the output, without
+// the "!" of the LLvl functions.
+func levelName(level int) string {
+	switch level {
+	case lvlWarning:
+		return "W"
+	case lvlError:
+		return "E"
+	case lvlFatal:
+		return "F"
+	case lvlPanic:
+		return "P"
+	case lvlInfo, lvlPrint:
+		return "I"
+	}
+	if level < 0 {
+		level = -level
+	}
+	return strconv.Itoa(level)
+}
@@ -0,0 +1,52 @@
+package log
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// sliceLogger keeps the entries it gets.
+type sliceLogger struct {
+	entries []Entry
+	closed  bool
+}
+
+func (l *sliceLogger) Log(e *Entry) {
+	l.entries = append(l.entries, *e)
+}
+
+func (l *sliceLogger) Close() error {
+	l.closed = true
+	return nil
+}
+
+func TestRegisterLogger(t *testing.T) {
+	SetDebugVisible(2)
+	defer SetDebugVisible(1)
+	sl := &sliceLogger{}
+	key := RegisterLogger(sl)
+
+	Lvl2("shown")
+	Lvl3("hidden")
+	LLvl4("always")
+	Warn("warning")
+	GetStdOut()
+	GetStdErr()
+	require.Equal(t, 3, len(sl.entries))
+	e := sl.entries[0]
+	require.Equal(t, 2, e.Level)
+	require.Equal(t, "2", e.LevelName)
+	require.Equal(t, "shown", e.Message)
+	require.Equal(t, "log.TestRegisterLogger", e.Function)
+	require.False(t, e.Time.IsZero())
+	require.Equal(t, "4!", sl.entries[1].LevelName)
+	require.Equal(t, "W", sl.entries[2].LevelName)
+
+	require.Nil(t, UnregisterLogger(key))
+	require.True(t, sl.closed)
+	Lvl1("not logged")
+	GetStdOut()
+	require.Equal(t, 3, len(sl.entries))
+	require.Nil(t, UnregisterLogger(key))
+}
@@ -8,6 +8,7 @@ import (
 	"runtime"
 	"runtime/pprof"
 	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -24,6 +25,17 @@ const (
 	lvlPrint
 )
 
+// The levels of Print, Info, Warn, Error, Fatal and Panic, as in
+// Entry.Level, for NewWriter and NewStdLogger.
+const (
+	LevelWarning = lvlWarning
+	LevelError   = lvlError
+	LevelFatal   = lvlFatal
+	LevelPanic   = lvlPanic
+	LevelInfo    = lvlInfo
+	LevelPrint   = lvlPrint
+)
+
 // These formats can be used in place of the debugVisible
 const (
 	// FormatPython uses [x] and others to indicate what is shown
@@ -83,11 +95,30 @@ func lvl(lvl, skip int, args ...interface{}) {
 	debugMut.Lock()
 	defer debugMut.Unlock()
 
-	if lvl > debugVisible {
+	if hidden(lvl) {
 		return
 	}
-	pc, _, line, _ := runtime.Caller(skip)
-	name := regexpPaths.ReplaceAllString(runtime.FuncForPC(pc).Name(), "")
+	pc, file, line, _ := runtime.Caller(skip)
+	output(lvl, runtime.FuncForPC(pc).Name(), file, line, args...)
+}
+
+// output writes the line of the caller, the function fn in file at line.
+// It must be called with debugMut held.
+func output(lvl int, fn, file string, line int, args ...interface{}) {
+	name := regexpPaths.ReplaceAllString(fn, "")
+	if lvl <= debugVisible {
+		countMessage(lvl, name, line)
+	}
+	message := fmt.Sprintln(args...)
+	if dedup(lvl, name, file, line, message) {
+		return
+	}
+	outputLine(lvl, name, file, line, message)
+}
+
+// outputLine writes the message, ending with a newline, of the function
+// name. It must be called with debugMut held.
+func outputLine(lvl int, name, file string, line int, message string) {
 	lineStr := fmt.Sprintf("%d", line)
 
 	// For the testing-framework, we check the resulting string. So as not to
@@ -113,7 +144,6 @@ func lvl(lvl, skip int, args ...interface{}) {
 	if StaticMsg != "" {
 		caller += "@" + StaticMsg
 	}
-	message := fmt.Sprintln(args...)
 	bright := lvl < 0
 	lvlAbs := lvl
 	if bright {
@@ -123,40 +153,85 @@ func lvl(lvl, skip int, args ...interface{}) {
 	if lvl < 0 {
 		lvlStr += "!"
 	}
+	color := ct.None
 	switch lvl {
 	case lvlPrint:
-		fg(ct.White, true)
+		color, bright = ct.White, true
 		lvlStr = "I"
 	case lvlInfo:
-		fg(ct.White, true)
+		color, bright = ct.White, true
 		lvlStr = "I"
 	case lvlWarning:
-		fg(ct.Green, true)
+		color, bright = ct.Green, true
 		lvlStr = "W"
 	case lvlError:
-		fg(ct.Red, false)
+		color, bright = ct.Red, false
 		lvlStr = "E"
 	case lvlFatal:
-		fg(ct.Red, true)
+		color, bright = ct.Red, true
 		lvlStr = "F"
 	case lvlPanic:
-		fg(ct.Red, true)
+		color, bright = ct.Red, true
 		lvlStr = "P"
 	default:
 		if lvl != 0 {
 			if lvlAbs <= 5 {
 				colors := []ct.Color{ct.Yellow, ct.Cyan, ct.Green, ct.Blue, ct.Cyan}
-				fg(colors[lvlAbs-1], bright)
+				color = colors[lvlAbs-1]
 			}
 		}
 	}
-	str := fmt.Sprintf(": (%s) - %s", caller, message)
-	if showTime {
-		ti := time.Now()
-		str = fmt.Sprintf("%s.%09d%s", ti.Format("06/02/01 15:04:05"), ti.Nanosecond(), str)
+	if tc, ok := theme[strings.TrimSuffix(lvlStr, "!")]; ok {
+		color, bright = tc.color, tc.bright
+	}
+	var ti time.Time
+	if !deterministic {
+		ti = now()
+	}
+	logEntry(&Entry{
+		Level:     lvl,
+		LevelName: lvlStr,
+		Time:      ti,
+		File:      file,
+		Line:      line,
+		Function:  name,
+		Static:    StaticMsg,
+		Message:   strings.TrimSuffix(message, "\n"),
+	})
+	if lvl > debugVisible {
+		// only for the loggers
+		return
 	}
-	str = fmt.Sprintf("%-2s%s", lvlStr, str)
-	if lvl < lvlInfo {
+	if color != ct.None {
+		fg(color, bright)
+	}
+	var str string
+	if format != nil {
+		l := &Line{
+			Level:   lvlStr,
+			Time:    ti,
+			Caller:  fmt.Sprintf("%s:%d", name, line),
+			Static:  StaticMsg,
+			Message: strings.TrimSuffix(message, "\n"),
+		}
+		if !deterministic {
+			l.Timestamp = formatTime(ti)
+		}
+		str = formatLine(l)
+	} else {
+		str = fmt.Sprintf(": (%s) - %s", caller, message)
+		if showTime && !deterministic {
+			str = formatTime(ti) + str
+		}
+		str = fmt.Sprintf("%-2s%s", lvlStr, str)
+	}
+	if deterministic {
+		roundLines = append(roundLines, roundLine{lvl < lvlInfo, str})
+		if lvl == lvlFatal || lvl == lvlPanic {
+			// The program stops, so the round wouldn't be written.
+			flushRound()
+		}
+	} else if lvl < lvlInfo {
 		fmt.Fprint(stdErr, str)
 	} else {
 		fmt.Fprint(stdOut, str)
@@ -177,7 +252,7 @@ func fg(c ct.Color, bright bool) {
 // or
 // Lvl1 -> lvld -> lvl
 func lvlf(l int, f string, args ...interface{}) {
-	if l > DebugVisible() {
+	if !wanted(l) {
 		return
 	}
 	lvl(l, 3, fmt.Sprintf(f, args...))
@@ -334,6 +409,8 @@ func UseColors() bool {
 // debig-lvl to that integer. As `go test` will only output whenever
 // `-v` is given, this gives no disadvantage over setting the default
 // output-level.
+// Goroutines that were already running before the tests are not reported
+// as leaks.
 func MainTest(m *testing.M, ls ...int) {
 	flag.Parse()
 	l := defaultMainTest
@@ -341,6 +418,7 @@ func MainTest(m *testing.M, ls ...int) {
 		l = ls[0]
 	}
 	TestOutput(testing.Verbose(), l)
+	BeforeTest()
 	done := make(chan int)
 	go func() {
 		code := m.Run()
@@ -349,9 +427,11 @@ func MainTest(m *testing.M, ls ...int) {
 	select {
 	case code := <-done:
 		AfterTest(nil)
+		flushDeterministic()
 		os.Exit(code)
 	case <-time.After(MainTestWait):
 		Error("Didn't finish in time")
+		flushDeterministic()
 		pprof.Lookup("goroutine").WriteTo(os.Stdout, 1)
 		os.Exit(1)
 	}
@@ -361,6 +441,9 @@ func MainTest(m *testing.M, ls ...int) {
 //   DEBUG_LVL - for the actual debug-lvl - default is 1
 //   DEBUG_TIME - whether to show the timestamp - default is false
 //   DEBUG_COLOR - whether to color the output - default is false
+//   DEBUG_FORMAT - the template of the lines, see SetFormat
+//   DEBUG_TIME_FORMAT - the format of the time, see SetTimeFormat
+//   DEBUG_UTC - whether to show the time in UTC - default is false
 func ParseEnv() {
 	dv := os.Getenv("DEBUG_LVL")
 	if dv != "" {
@@ -389,6 +472,28 @@ func ParseEnv() {
 			Error("Couldn't convert", dc, "to boolean")
 		}
 	}
+	if df := os.Getenv("DEBUG_FORMAT"); df != "" {
+		if err := SetFormat(df); err != nil {
+			Error("Couldn't use", df, "as format:", err)
+		}
+	}
+	if tf := os.Getenv("DEBUG_TIME_FORMAT"); tf != "" {
+		if err := SetTimeFormat(tf); err != nil {
+			Error("Couldn't use", tf, "as time format:", err)
+		}
+	}
+	if du := os.Getenv("DEBUG_UTC"); du != "" {
+		utc, err := strconv.ParseBool(du)
+		SetTimeUTC(utc)
+		if err != nil {
+			Error("Couldn't convert", du, "to boolean")
+		}
+	}
+	if dd := os.Getenv("DEBUG_DEDUP"); dd != "" {
+		if err := SetDedup(strings.Split(dd, ",")); err != nil {
+			Error("Couldn't use", dd, "as levels to deduplicate:", err)
+		}
+	}
 }
 
 // RegisterFlags adds the flags and the variables for the debug-control using
@@ -195,4 +195,7 @@ func clearEnv() {
 	os.Setenv("DEBUG_LVL", "")
 	os.Setenv("DEBUG_TIME", "")
 	os.Setenv("DEBUG_COLOR", "")
+	os.Setenv("DEBUG_FORMAT", "")
+	os.Setenv("DEBUG_TIME_FORMAT", "")
+	os.Setenv("DEBUG_UTC", "")
 }
@@ -0,0 +1,321 @@
+package log
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The formats of the messages of a NetworkLogger.
+const (
+	// NetFormatGELF is the format of Graylog, over TCP or UDP
+	NetFormatGELF = "gelf"
+	// NetFormatFluentd is the forward protocol of Fluentd, over TCP
+	NetFormatFluentd = "fluentd"
+)
+
+// DefaultNetBufferSize is the number of entries a NetworkLogger keeps
+// while the aggregator is unreachable, if the configuration doesn't say.
+const DefaultNetBufferSize = 1000
+
+// netRetryMin and netRetryMax bound the time between the connection
+// attempts of a NetworkLogger.
+var netRetryMin = time.Second
+var netRetryMax = 30 * time.Second
+
+// netTimeout is the timeout of the connection and of every write.
+var netTimeout = 5 * time.Second
+
+// gelfChunkSize is the size of the chunks of the GELF messages over UDP.
+const gelfChunkSize = 8192
+
+// NetworkLoggerConfig is the configuration of a NetworkLogger.
+type NetworkLoggerConfig struct {
+	// Network is "tcp" or "udp".
+	Network string
+	// Address is the host:port of the aggregator.
+	Address string
+	// Format is NetFormatGELF or NetFormatFluentd.
+	Format string
+	// Host is the host of the GELF messages, the hostname by default.
+	Host string
+	// Tag is the tag of the Fluentd messages, "onet" by default.
+	Tag string
+	// BufferSize is the number of entries kept while the aggregator is
+	// unreachable, DefaultNetBufferSize if 0.
+	BufferSize int
+	// Fields are added to every message.
+	Fields map[string]string
+}
+
+// Check returns the error NewNetworkLogger would return for conf.
+func (conf NetworkLoggerConfig) Check() error {
+	switch {
+	case conf.Format != NetFormatGELF && conf.Format != NetFormatFluentd:
+		return errors.New("unknown log format " + conf.Format)
+	case conf.Network != "tcp" && conf.Network != "udp":
+		return errors.New("unknown network " + conf.Network)
+	case conf.Format == NetFormatFluentd && conf.Network != "tcp":
+		return errors.New("fluentd needs tcp")
+	}
+	_, _, err := net.SplitHostPort(conf.Address)
+	return err
+}
+
+// NetworkLogger sends the entries to a log aggregator like Graylog or
+// Fluentd, without a local agent. The entries are sent in the background
+// and buffered while the aggregator is unreachable, with a new connection
+// attempt up to every 30 seconds. The entries that don't fit in the buffer
+// are dropped.
+type NetworkLogger struct {
+	conf    NetworkLoggerConfig
+	entries chan []byte
+	conn    net.Conn
+	dropped uint64
+	quit    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+// NewNetworkLogger returns a logger sending to the aggregator of conf, to
+// be given to RegisterLogger. The aggregator doesn't need to be reachable
+// yet.
+func NewNetworkLogger(conf NetworkLoggerConfig) (*NetworkLogger, error) {
+	if err := conf.Check(); err != nil {
+		return nil, err
+	}
+	if conf.Host == "" {
+		conf.Host, _ = os.Hostname()
+	}
+	if conf.Tag == "" {
+		conf.Tag = "onet"
+	}
+	if conf.BufferSize <= 0 {
+		conf.BufferSize = DefaultNetBufferSize
+	}
+	nl := &NetworkLogger{
+		conf:    conf,
+		entries: make(chan []byte, conf.BufferSize),
+		quit:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go nl.run()
+	return nl, nil
+}
+
+// Log implements Logger.
+func (nl *NetworkLogger) Log(e *Entry) {
+	var msg []byte
+	if nl.conf.Format == NetFormatGELF {
+		msg = nl.gelf(e)
+	} else {
+		msg = nl.fluentd(e)
+	}
+	select {
+	case nl.entries <- msg:
+	default:
+		atomic.AddUint64(&nl.dropped, 1)
+	}
+}
+
+// Dropped returns the number of entries dropped because the buffer was
+// full.
+func (nl *NetworkLogger) Dropped() uint64 {
+	return atomic.LoadUint64(&nl.dropped)
+}
+
+// Close implements Logger. It sends the buffered entries if the aggregator
+// is reachable, and drops them if not.
+func (nl *NetworkLogger) Close() error {
+	nl.once.Do(func() { close(nl.quit) })
+	<-nl.done
+	return nil
+}
+
+// run sends the entries, and connects again after an error.
+func (nl *NetworkLogger) run() {
+	defer close(nl.done)
+	defer func() {
+		if nl.conn != nil {
+			nl.conn.Close()
+		}
+	}()
+	retry := netRetryMin
+	var msg []byte
+	for {
+		if msg == nil {
+			select {
+			case msg = <-nl.entries:
+			case <-nl.quit:
+				nl.flush()
+				return
+			}
+		}
+		if err := nl.send(msg); err != nil {
+			select {
+			case <-time.After(retry):
+			case <-nl.quit:
+				return
+			}
+			if retry *= 2; retry > netRetryMax {
+				retry = netRetryMax
+			}
+			continue
+		}
+		retry = netRetryMin
+		msg = nil
+	}
+}
+
+// flush sends the buffered entries until the first error.
+func (nl *NetworkLogger) flush() {
+	for {
+		select {
+		case msg := <-nl.entries:
+			if nl.send(msg) != nil {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// send writes msg, after connecting if needed. The connection is closed
+// after an error.
+func (nl *NetworkLogger) send(msg []byte) error {
+	if nl.conn == nil {
+		conn, err := net.DialTimeout(nl.conf.Network, nl.conf.Address, netTimeout)
+		if err != nil {
+			return err
+		}
+		nl.conn = conn
+	}
+	var err error
+	nl.conn.SetWriteDeadline(time.Now().Add(netTimeout))
+	if nl.conf.Network == "udp" && len(msg) > gelfChunkSize {
+		err = nl.sendChunks(msg)
+	} else {
+		_, err = nl.conn.Write(msg)
+	}
+	if err != nil {
+		nl.conn.Close()
+		nl.conn = nil
+	}
+	return err
+}
+
+// sendChunks sends a GELF message too big for a datagram in chunks.
+func (nl *NetworkLogger) sendChunks(msg []byte) error {
+	const payload = gelfChunkSize - 12
+	count := (len(msg) + payload - 1) / payload
+	if count > 128 {
+		return errors.New("message too big for GELF")
+	}
+	id := make([]byte, 8)
+	rand.Read(id)
+	for i := 0; i < count; i++ {
+		end := (i + 1) * payload
+		if end > len(msg) {
+			end = len(msg)
+		}
+		chunk := append([]byte{0x1e, 0x0f}, id...)
+		chunk = append(chunk, byte(i), byte(count))
+		chunk = append(chunk, msg[i*payload:end]...)
+		if _, err := nl.conn.Write(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// gelf returns the GELF message of the entry. Over TCP, it ends with a
+// null byte.
+func (nl *NetworkLogger) gelf(e *Entry) []byte {
+	m := map[string]interface{}{
+		"version":       "1.1",
+		"host":          nl.conf.Host,
+		"short_message": e.Message,
+		"timestamp":     float64(entryTime(e).UnixNano()) / 1e9,
+		"level":         syslogPriority(e),
+		"_file":         e.File,
+		"_line":         e.Line,
+		"_function":     e.Function,
+		"_onet_level":   e.LevelName,
+	}
+	if e.Static != "" {
+		m["_static"] = e.Static
+	}
+	for k, v := range nl.conf.Fields {
+		// "_id" is reserved by GELF
+		if k != "id" {
+			m["_"+k] = v
+		}
+	}
+	buf, _ := json.Marshal(m)
+	if nl.conf.Network == "tcp" {
+		buf = append(buf, 0)
+	}
+	return buf
+}
+
+// fluentd returns the message of the entry in the forward protocol: the
+// msgpack array [tag, time, record].
+func (nl *NetworkLogger) fluentd(e *Entry) []byte {
+	record := map[string]string{
+		"message":  e.Message,
+		"level":    e.LevelName,
+		"file":     e.File,
+		"function": e.Function,
+		"line":     strconv.Itoa(e.Line),
+		"severity": strconv.Itoa(syslogPriority(e)),
+	}
+	if e.Static != "" {
+		record["static"] = e.Static
+	}
+	for k, v := range nl.conf.Fields {
+		record[k] = v
+	}
+	var buf bytes.Buffer
+	buf.WriteByte(0x93)
+	msgpackString(&buf, nl.conf.Tag)
+	buf.WriteByte(0xd3)
+	binary.Write(&buf, binary.BigEndian, entryTime(e).Unix())
+	keys := make([]string, 0, len(record))
+	for k := range record {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	buf.WriteByte(0xdf)
+	binary.Write(&buf, binary.BigEndian, uint32(len(keys)))
+	for _, k := range keys {
+		msgpackString(&buf, k)
+		msgpackString(&buf, record[k])
+	}
+	return buf.Bytes()
+}
+
+// msgpackString writes s as a msgpack str 32.
+func msgpackString(buf *bytes.Buffer, s string) {
+	buf.WriteByte(0xdb)
+	binary.Write(buf, binary.BigEndian, uint32(len(s)))
+	buf.WriteString(s)
+}
+
+// entryTime returns the time of the entry, which is not set in
+// deterministic mode.
+func entryTime(e *Entry) time.Time {
+	if e.Time.IsZero() {
+		return time.Now()
+	}
+	return e.Time
+}
@@ -0,0 +1,170 @@
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// acceptOne returns the first connection of ln.
+func acceptOne(t *testing.T, ln net.Listener) net.Conn {
+	c, err := ln.Accept()
+	require.Nil(t, err)
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return c
+}
+
+func TestNetworkLogger_GELFTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer ln.Close()
+	nl, err := NewNetworkLogger(NetworkLoggerConfig{Network: "tcp",
+		Address: ln.Addr().String(), Format: NetFormatGELF, Host: "conode",
+		Fields: map[string]string{"cluster": "test"}})
+	require.Nil(t, err)
+	key := RegisterLogger(nl)
+	Error("over tcp")
+	GetStdErr()
+	require.Nil(t, UnregisterLogger(key))
+
+	c := acceptOne(t, ln)
+	defer c.Close()
+	msg, err := bufio.NewReader(c).ReadBytes(0)
+	require.Nil(t, err)
+	var m map[string]interface{}
+	require.Nil(t, json.Unmarshal(msg[:len(msg)-1], &m))
+	require.Equal(t, "1.1", m["version"])
+	require.Equal(t, "conode", m["host"])
+	require.Equal(t, "over tcp", m["short_message"])
+	require.Equal(t, float64(3), m["level"])
+	require.Equal(t, "E", m["_onet_level"])
+	require.Equal(t, "log.TestNetworkLogger_GELFTCP", m["_function"])
+	require.Equal(t, "test", m["_cluster"])
+}
+
+func TestNetworkLogger_GELFUDPChunks(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer pc.Close()
+	nl, err := NewNetworkLogger(NetworkLoggerConfig{Network: "udp",
+		Address: pc.LocalAddr().String(), Format: NetFormatGELF})
+	require.Nil(t, err)
+	defer nl.Close()
+
+	long := strings.Repeat("x", 3*gelfChunkSize)
+	nl.Log(&Entry{Level: 1, LevelName: "1", Message: long})
+	var whole []byte
+	buf := make([]byte, 2*gelfChunkSize)
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for count := 1; count > 0; count-- {
+		n, _, err := pc.ReadFrom(buf)
+		require.Nil(t, err)
+		require.True(t, n <= gelfChunkSize)
+		require.Equal(t, []byte{0x1e, 0x0f}, buf[:2])
+		if whole == nil {
+			count = int(buf[11])
+		}
+		whole = append(whole, buf[12:n]...)
+	}
+	var m map[string]interface{}
+	require.Nil(t, json.Unmarshal(whole, &m))
+	require.Equal(t, long, m["short_message"])
+}
+
+func TestNetworkLogger_Fluentd(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer ln.Close()
+	nl, err := NewNetworkLogger(NetworkLoggerConfig{Network: "tcp",
+		Address: ln.Addr().String(), Format: NetFormatFluentd, Tag: "conode.log"})
+	require.Nil(t, err)
+	defer nl.Close()
+	nl.Log(&Entry{Level: lvlWarning, LevelName: "W", Message: "forwarded"})
+
+	c := acceptOne(t, ln)
+	defer c.Close()
+	r := bufio.NewReader(c)
+	readString := func() string {
+		b, err := r.ReadByte()
+		require.Nil(t, err)
+		require.Equal(t, byte(0xdb), b)
+		var l uint32
+		require.Nil(t, binary.Read(r, binary.BigEndian, &l))
+		s := make([]byte, l)
+		_, err = r.Read(s)
+		require.Nil(t, err)
+		return string(s)
+	}
+	b, err := r.ReadByte()
+	require.Nil(t, err)
+	require.Equal(t, byte(0x93), b)
+	require.Equal(t, "conode.log", readString())
+	b, err = r.ReadByte()
+	require.Nil(t, err)
+	require.Equal(t, byte(0xd3), b)
+	var ts int64
+	require.Nil(t, binary.Read(r, binary.BigEndian, &ts))
+	require.True(t, ts > 0)
+	b, err = r.ReadByte()
+	require.Nil(t, err)
+	require.Equal(t, byte(0xdf), b)
+	var n uint32
+	require.Nil(t, binary.Read(r, binary.BigEndian, &n))
+	record := map[string]string{}
+	for i := uint32(0); i < n; i++ {
+		k := readString()
+		record[k] = readString()
+	}
+	require.Equal(t, "forwarded", record["message"])
+	require.Equal(t, "W", record["level"])
+	require.Equal(t, "4", record["severity"])
+}
+
+func TestNetworkLogger_Reconnect(t *testing.T) {
+	oldMin := netRetryMin
+	netRetryMin = 10 * time.Millisecond
+	defer func() { netRetryMin = oldMin }()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	addr := ln.Addr().String()
+	ln.Close()
+
+	nl, err := NewNetworkLogger(NetworkLoggerConfig{Network: "tcp",
+		Address: addr, Format: NetFormatGELF, BufferSize: 2})
+	require.Nil(t, err)
+	defer nl.Close()
+	for i := 0; i < 5; i++ {
+		nl.Log(&Entry{Level: 1, LevelName: "1", Message: "buffered"})
+	}
+	// One entry is being sent, two are in the buffer
+	require.True(t, nl.Dropped() >= 2)
+
+	ln, err = net.Listen("tcp", addr)
+	require.Nil(t, err)
+	defer ln.Close()
+	c := acceptOne(t, ln)
+	defer c.Close()
+	msg, err := bufio.NewReader(c).ReadBytes(0)
+	require.Nil(t, err)
+	require.True(t, bytes.Contains(msg, []byte("buffered")))
+}
+
+func TestNewNetworkLogger(t *testing.T) {
+	for _, conf := range []NetworkLoggerConfig{
+		{Network: "tcp", Address: "localhost:12201", Format: "syslog"},
+		{Network: "sctp", Address: "localhost:12201", Format: NetFormatGELF},
+		{Network: "udp", Address: "localhost:24224", Format: NetFormatFluentd},
+		{Network: "tcp", Address: "localhost", Format: NetFormatGELF},
+	} {
+		_, err := NewNetworkLogger(conf)
+		require.NotNil(t, err, conf)
+	}
+}
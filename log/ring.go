@@ -0,0 +1,98 @@
+package log
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// RingLogger keeps the latest entries of all debug levels in memory, so
+// that the context of a crash is known even if DebugVisible hid it. It
+// dumps them when Fatal or Panic is called, and on demand with Dump.
+type RingLogger struct {
+	// CrashOutput gets the dump on Fatal and Panic, os.Stderr by default,
+	// or nothing if it is nil.
+	CrashOutput io.Writer
+	entries     []Entry
+	// next is the index of the next entry in entries
+	next int
+	full bool
+	sync.Mutex
+}
+
+// NewRingLogger returns a logger keeping the latest size entries, to be
+// given to RegisterLogger.
+func NewRingLogger(size int) *RingLogger {
+	if size < 0 {
+		size = 0
+	}
+	return &RingLogger{CrashOutput: os.Stderr, entries: make([]Entry, size)}
+}
+
+// MaxLevel implements LevelLogger, the ring gets all levels.
+func (r *RingLogger) MaxLevel() int {
+	return 5
+}
+
+// Log implements Logger.
+func (r *RingLogger) Log(e *Entry) {
+	r.Lock()
+	if len(r.entries) > 0 {
+		r.entries[r.next] = *e
+		r.next = (r.next + 1) % len(r.entries)
+		if r.next == 0 {
+			r.full = true
+		}
+	}
+	out := r.CrashOutput
+	r.Unlock()
+	if (e.Level == lvlFatal || e.Level == lvlPanic) && out != nil {
+		fmt.Fprintln(out, "Latest log entries before the crash:")
+		r.Dump(out)
+	}
+}
+
+// Close implements Logger.
+func (r *RingLogger) Close() error {
+	return nil
+}
+
+// Entries returns the kept entries, oldest first.
+func (r *RingLogger) Entries() []Entry {
+	r.Lock()
+	defer r.Unlock()
+	if !r.full {
+		return append([]Entry{}, r.entries[:r.next]...)
+	}
+	return append(append([]Entry{}, r.entries[r.next:]...), r.entries[:r.next]...)
+}
+
+// Dump writes the kept entries to w, one per line, oldest first.
+func (r *RingLogger) Dump(w io.Writer) error {
+	for _, e := range r.Entries() {
+		if _, err := io.WriteString(w, entryLine(&e)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Resize keeps the latest entries that fit in the new size.
+func (r *RingLogger) Resize(size int) {
+	if size < 0 {
+		size = 0
+	}
+	entries := r.Entries()
+	if len(entries) > size {
+		entries = entries[len(entries)-size:]
+	}
+	r.Lock()
+	defer r.Unlock()
+	r.entries = make([]Entry, size)
+	r.next = copy(r.entries, entries)
+	r.full = false
+	if size > 0 && r.next == size {
+		r.next, r.full = 0, true
+	}
+}
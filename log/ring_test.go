@@ -0,0 +1,54 @@
+package log
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRingLogger(t *testing.T) {
+	SetDebugVisible(1)
+	r := NewRingLogger(3)
+	var crash bytes.Buffer
+	r.CrashOutput = &crash
+	key := RegisterLogger(r)
+	defer UnregisterLogger(key)
+
+	Lvl1("one")
+	Lvl4("hidden four")
+	Lvlf5("hidden %s", "five")
+	require.Equal(t, "1 : (log.TestRingLogger: 0) - one\n", GetStdOut())
+	entries := r.Entries()
+	require.Equal(t, 3, len(entries))
+	require.Equal(t, "one", entries[0].Message)
+	require.Equal(t, "hidden four", entries[1].Message)
+	require.Equal(t, "hidden five", entries[2].Message)
+
+	Lvl3("three")
+	entries = r.Entries()
+	require.Equal(t, 3, len(entries))
+	require.Equal(t, "three", entries[2].Message)
+
+	var buf bytes.Buffer
+	require.Nil(t, r.Dump(&buf))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Equal(t, 3, len(lines))
+	require.True(t, strings.HasSuffix(lines[0], " 4  log.TestRingLogger:0 - hidden four"), lines[0])
+
+	require.Panics(t, func() { Panic("boom") })
+	GetStdErr()
+	require.Contains(t, crash.String(), "before the crash")
+	require.Contains(t, crash.String(), "- three\n")
+	require.Contains(t, crash.String(), "- boom\n")
+
+	r.Resize(2)
+	entries = r.Entries()
+	require.Equal(t, 2, len(entries))
+	require.Equal(t, "boom", entries[1].Message)
+	r.Resize(0)
+	Lvl1("not kept")
+	GetStdOut()
+	require.Empty(t, r.Entries())
+}
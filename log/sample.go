@@ -0,0 +1,202 @@
+package log
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Sampler limits the output of a single call-site, so that a log statement
+// inside a per-message loop doesn't flood the output. A Sampler either
+// outputs one line out of every N calls, or at most N lines per second.
+// Every line that is not output is counted, and the number of suppressed
+// lines is appended to the next line that gets through.
+//
+// Samplers are retrieved per call-site and parameter with Sampled or
+// RateLimited, so a call-site that passes varying parameters gets one
+// Sampler for each of them:
+//	for _, msg := range msgs {
+//		log.Sampled(100).Lvl4("Got message", msg)
+//	}
+type Sampler struct {
+	// every is the sampling rate: only one out of 'every' lines is shown.
+	every uint64
+	// perSecond is the maximum number of lines shown per second.
+	perSecond uint64
+	// calls counts all calls that passed the debug-level.
+	calls uint64
+	// suppressed counts the lines not shown since the last shown line.
+	suppressed uint64
+	// suppressedTotal counts all lines not shown.
+	suppressedTotal uint64
+	// window is the start of the current one-second window.
+	window time.Time
+	// inWindow counts the lines shown in the current window.
+	inWindow uint64
+	sync.Mutex
+}
+
+// samplerKey identifies the Sampler of a call-site with its parameters.
+type samplerKey struct {
+	pc        uintptr
+	every     uint64
+	perSecond uint64
+}
+
+// samplers holds one Sampler per call-site and parameters.
+var samplers = struct {
+	sites map[samplerKey]*Sampler
+	sync.Mutex
+}{sites: make(map[samplerKey]*Sampler)}
+
+// Sampled returns the Sampler of the calling call-site that only outputs
+// one line out of every n. The first call always outputs.
+func Sampled(n int) *Sampler {
+	if n < 1 {
+		n = 1
+	}
+	return sampler(&Sampler{every: uint64(n)})
+}
+
+// RateLimited returns the Sampler of the calling call-site that outputs
+// at most n lines per second.
+func RateLimited(n int) *Sampler {
+	if n < 1 {
+		n = 1
+	}
+	return sampler(&Sampler{perSecond: uint64(n)})
+}
+
+// sampler returns the Sampler stored for the call-site two levels above
+// with the parameters of s, or stores and returns s if there is none yet.
+func sampler(s *Sampler) *Sampler {
+	pc, _, _, _ := runtime.Caller(2)
+	key := samplerKey{pc, s.every, s.perSecond}
+	samplers.Lock()
+	defer samplers.Unlock()
+	if old, ok := samplers.sites[key]; ok {
+		return old
+	}
+	samplers.sites[key] = s
+	return s
+}
+
+// Suppressed returns how many lines have not been output by this Sampler
+// since its creation.
+func (s *Sampler) Suppressed() uint64 {
+	s.Lock()
+	defer s.Unlock()
+	return s.suppressedTotal
+}
+
+// allow returns whether the next line can be shown and how many lines have
+// been suppressed since the last line shown.
+func (s *Sampler) allow() (bool, uint64) {
+	s.Lock()
+	defer s.Unlock()
+	s.calls++
+	ok := true
+	if s.every > 0 {
+		ok = (s.calls-1)%s.every == 0
+	}
+	if s.perSecond > 0 {
+		now := time.Now()
+		if now.Sub(s.window) >= time.Second {
+			s.window = now
+			s.inWindow = 0
+		}
+		ok = s.inWindow < s.perSecond
+		if ok {
+			s.inWindow++
+		}
+	}
+	if !ok {
+		s.suppressed++
+		s.suppressedTotal++
+		return false, 0
+	}
+	sup := s.suppressed
+	s.suppressed = 0
+	return true, sup
+}
+
+// Needs two functions to keep the caller-depth the same as for lvld and
+// lvlf.
+func (s *Sampler) lvlf(l int, f string, args ...interface{}) {
+	if l > DebugVisible() {
+		return
+	}
+	ok, sup := s.allow()
+	if !ok {
+		return
+	}
+	msg := fmt.Sprintf(f, args...)
+	if sup > 0 {
+		msg += fmt.Sprintf(" (%d suppressed)", sup)
+	}
+	lvl(l, 3, msg)
+}
+func (s *Sampler) lvld(l int, args ...interface{}) {
+	if l > DebugVisible() {
+		return
+	}
+	ok, sup := s.allow()
+	if !ok {
+		return
+	}
+	if sup > 0 {
+		args = append(args, fmt.Sprintf("(%d suppressed)", sup))
+	}
+	lvl(l, 3, args...)
+}
+
+// Lvl1 is like log.Lvl1, but sampled
+func (s *Sampler) Lvl1(args ...interface{}) {
+	s.lvld(1, args...)
+}
+
+// Lvl2 is like log.Lvl2, but sampled
+func (s *Sampler) Lvl2(args ...interface{}) {
+	s.lvld(2, args...)
+}
+
+// Lvl3 is like log.Lvl3, but sampled
+func (s *Sampler) Lvl3(args ...interface{}) {
+	s.lvld(3, args...)
+}
+
+// Lvl4 is like log.Lvl4, but sampled
+func (s *Sampler) Lvl4(args ...interface{}) {
+	s.lvld(4, args...)
+}
+
+// Lvl5 is like log.Lvl5, but sampled
+func (s *Sampler) Lvl5(args ...interface{}) {
+	s.lvld(5, args...)
+}
+
+// Lvlf1 is like log.Lvlf1, but sampled
+func (s *Sampler) Lvlf1(f string, args ...interface{}) {
+	s.lvlf(1, f, args...)
+}
+
+// Lvlf2 is like log.Lvlf2, but sampled
+func (s *Sampler) Lvlf2(f string, args ...interface{}) {
+	s.lvlf(2, f, args...)
+}
+
+// Lvlf3 is like log.Lvlf3, but sampled
+func (s *Sampler) Lvlf3(f string, args ...interface{}) {
+	s.lvlf(3, f, args...)
+}
+
+// Lvlf4 is like log.Lvlf4, but sampled
+func (s *Sampler) Lvlf4(f string, args ...interface{}) {
+	s.lvlf(4, f, args...)
+}
+
+// Lvlf5 is like log.Lvlf5, but sampled
+func (s *Sampler) Lvlf5(f string, args ...interface{}) {
+	s.lvlf(5, f, args...)
+}
@@ -0,0 +1,60 @@
+package log
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSampled(t *testing.T) {
+	SetDebugVisible(1)
+	GetStdOut()
+	var s *Sampler
+	for i := 0; i < 10; i++ {
+		s = Sampled(4)
+		s.Lvl1("Sampled", i)
+	}
+	lines := strings.Split(strings.TrimSpace(GetStdOut()), "\n")
+	require.Equal(t, 3, len(lines))
+	assert.True(t, strings.HasSuffix(lines[0], "Sampled 0"))
+	assert.True(t, strings.HasSuffix(lines[1], "Sampled 4 (3 suppressed)"))
+	assert.True(t, strings.HasSuffix(lines[2], "Sampled 8 (3 suppressed)"))
+	assert.Equal(t, uint64(7), s.Suppressed())
+
+	// Invisible levels are not counted.
+	for i := 0; i < 10; i++ {
+		Sampled(4).Lvl2("Hidden")
+	}
+	assert.Equal(t, "", GetStdOut())
+}
+
+func TestRateLimited(t *testing.T) {
+	SetDebugVisible(1)
+	GetStdOut()
+	var s *Sampler
+	for i := 0; i < 10; i++ {
+		s = RateLimited(2)
+		s.Lvlf1("Limited %d", i)
+	}
+	lines := strings.Split(strings.TrimSpace(GetStdOut()), "\n")
+	require.Equal(t, 2, len(lines))
+	assert.True(t, strings.HasSuffix(lines[1], "Limited 1"))
+	assert.Equal(t, uint64(8), s.Suppressed())
+}
+
+func TestSampler_Parameters(t *testing.T) {
+	// The same call-site with other parameters gets another Sampler.
+	var sampled, limited []*Sampler
+	for _, n := range []int{2, 3, 2} {
+		sampled = append(sampled, Sampled(n))
+		limited = append(limited, RateLimited(n))
+	}
+	require.True(t, sampled[0] == sampled[2])
+	require.True(t, sampled[0] != sampled[1])
+	require.Equal(t, uint64(3), sampled[1].every)
+	require.True(t, limited[0] == limited[2])
+	require.True(t, limited[0] != limited[1])
+	require.Equal(t, uint64(3), limited[1].perSecond)
+}
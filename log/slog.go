@@ -0,0 +1,160 @@
+// +build go1.21
+
+package log
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// slogHandler writes the records of slog to the log.
+type slogHandler struct {
+	// attrs are the formatted attributes of WithAttrs
+	attrs string
+	// group is the prefix of the keys, from WithGroup
+	group string
+}
+
+// NewSlogHandler returns a slog.Handler writing the records to the log,
+// so that the libraries using slog follow the debug level: LevelError and
+// LevelWarn are written as Error and Warn, LevelInfo as Lvl1, LevelDebug as
+// Lvl2 and the lower levels as Lvl4. The attributes are appended to the
+// message as key=value.
+func NewSlogHandler() slog.Handler {
+	return &slogHandler{}
+}
+
+// fromSlog returns the level of the log for a level of slog.
+func fromSlog(l slog.Level) int {
+	switch {
+	case l >= slog.LevelError:
+		return lvlError
+	case l >= slog.LevelWarn:
+		return lvlWarning
+	case l >= slog.LevelInfo:
+		return 1
+	case l >= slog.LevelDebug:
+		return 2
+	}
+	return 4
+}
+
+// Enabled implements slog.Handler.
+func (h *slogHandler) Enabled(_ context.Context, l slog.Level) bool {
+	return wanted(fromSlog(l))
+}
+
+// Handle implements slog.Handler.
+func (h *slogHandler) Handle(_ context.Context, r slog.Record) error {
+	var msg strings.Builder
+	msg.WriteString(r.Message)
+	msg.WriteString(h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		writeSlogAttr(&msg, h.group, a)
+		return true
+	})
+
+	debugMut.Lock()
+	defer debugMut.Unlock()
+	l := fromSlog(r.Level)
+	if hidden(l) {
+		return nil
+	}
+	var f runtime.Frame
+	if r.PC != 0 {
+		f, _ = runtime.CallersFrames([]uintptr{r.PC}).Next()
+	}
+	output(l, f.Function, f.File, f.Line, msg.String())
+	return nil
+}
+
+// WithAttrs implements slog.Handler.
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var b strings.Builder
+	b.WriteString(h.attrs)
+	for _, a := range attrs {
+		writeSlogAttr(&b, h.group, a)
+	}
+	return &slogHandler{attrs: b.String(), group: h.group}
+}
+
+// WithGroup implements slog.Handler.
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &slogHandler{attrs: h.attrs, group: h.group + name + "."}
+}
+
+// writeSlogAttr writes " key=value" for a, and for each attribute if it is
+// a group.
+func writeSlogAttr(b *strings.Builder, prefix string, a slog.Attr) {
+	v := a.Value.Resolve()
+	if v.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range v.Group() {
+			writeSlogAttr(b, prefix, ga)
+		}
+		return
+	}
+	if a.Key == "" {
+		return
+	}
+	s := v.String()
+	if strings.ContainsAny(s, " \t\n\"=") {
+		s = strconv.Quote(s)
+	}
+	b.WriteString(" " + prefix + a.Key + "=" + s)
+}
+
+// slogLogger gives the entries of the log to a slog.Handler.
+type slogLogger struct {
+	h slog.Handler
+}
+
+// NewSlogLogger returns a Logger giving the entries to h, to be given to
+// RegisterLogger. The caller is added as the attributes "file", "line" and
+// "function". The handler must not write to the log, so it can't be a
+// handler of NewSlogHandler.
+func NewSlogLogger(h slog.Handler) Logger {
+	return &slogLogger{h}
+}
+
+// toSlog returns the level of slog for a level of the log.
+func toSlog(l int) slog.Level {
+	switch l {
+	case lvlError, lvlFatal, lvlPanic:
+		return slog.LevelError
+	case lvlWarning:
+		return slog.LevelWarn
+	case lvlInfo, lvlPrint, 1, -1:
+		return slog.LevelInfo
+	}
+	return slog.LevelDebug
+}
+
+// Log implements Logger.
+func (sl *slogLogger) Log(e *Entry) {
+	ctx := context.Background()
+	level := toSlog(e.Level)
+	if !sl.h.Enabled(ctx, level) {
+		return
+	}
+	r := slog.NewRecord(entryTime(e), level, e.Message, 0)
+	r.AddAttrs(slog.String("file", e.File), slog.Int("line", e.Line),
+		slog.String("function", e.Function))
+	if e.Static != "" {
+		r.AddAttrs(slog.String("static", e.Static))
+	}
+	sl.h.Handle(ctx, r)
+}
+
+// Close implements Logger.
+func (sl *slogLogger) Close() error {
+	return nil
+}
@@ -0,0 +1,63 @@
+// +build go1.21
+
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlogHandler(t *testing.T) {
+	SetDebugVisible(1)
+	GetStdOut()
+	GetStdErr()
+	logger := slog.New(NewSlogHandler())
+
+	logger.Info("started", "port", 7771, "name", "a b")
+	require.Equal(t, "1 : (log.TestSlogHandler: 0) - started port=7771 name=\"a b\"\n", GetStdOut())
+	logger.Debug("hidden")
+	require.Equal(t, "", GetStdOut())
+	logger.Error("failed")
+	require.Equal(t, "E : (log.TestSlogHandler: 0) - failed\n", GetStdErr())
+
+	logger.With("service", "skipchain").WithGroup("req").Warn("slow",
+		"ms", 20, slog.Group("from", "ip", "1.2.3.4"))
+	require.Equal(t, "W : (log.TestSlogHandler: 0) - slow service=skipchain req.ms=20 req.from.ip=1.2.3.4\n",
+		GetStdErr())
+
+	require.False(t, NewSlogHandler().Enabled(context.Background(), slog.LevelDebug))
+	SetDebugVisible(2)
+	defer SetDebugVisible(1)
+	require.True(t, NewSlogHandler().Enabled(context.Background(), slog.LevelDebug))
+}
+
+func TestSlogLogger(t *testing.T) {
+	SetDebugVisible(2)
+	defer SetDebugVisible(1)
+	var buf bytes.Buffer
+	h := slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo})
+	key := RegisterLogger(NewSlogLogger(h))
+	Lvl1("info")
+	Lvl2("debug")
+	Warn("warning")
+	GetStdOut()
+	GetStdErr()
+	require.Nil(t, UnregisterLogger(key))
+
+	dec := json.NewDecoder(&buf)
+	var rec map[string]interface{}
+	require.Nil(t, dec.Decode(&rec))
+	require.Equal(t, "INFO", rec["level"])
+	require.Equal(t, "info", rec["msg"])
+	require.Equal(t, "log.TestSlogLogger", rec["function"])
+	rec = nil
+	require.Nil(t, dec.Decode(&rec))
+	require.Equal(t, "WARN", rec["level"])
+	require.Equal(t, "warning", rec["msg"])
+	require.False(t, dec.More())
+}
@@ -2,77 +2,228 @@ package log
 
 import (
 	"fmt"
+	"regexp"
 	"runtime"
 	"runtime/debug"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
 
-func interestingGoroutines() (gs []string) {
+// ignoredGoroutines holds the parts of a stack that mark a goroutine as
+// not leaking, see IgnoreGoroutine.
+var ignoredGoroutines = []string{
+	"created by testing.RunTests",
+	"testing.RunTests(",
+	"testing.Main(",
+	"runtime.goexit",
+	"interestingGoroutines",
+	"created by runtime.gc",
+	"runtime.MHeap_Scavenger",
+	"sigqueue",
+	"log.MainTest",
+}
+
+// beforeTest holds the ids of the goroutines running when BeforeTest was
+// called, nil if it wasn't called.
+var beforeTest map[int]bool
+
+var leakMut sync.Mutex
+
+// IgnoreGoroutine tells AfterTest to never report the goroutines whose stack
+// contains the given string, because they are expected to run until the end
+// of the process. Packages can call it from an init function for their own
+// long-running goroutines.
+func IgnoreGoroutine(stackPart string) {
+	leakMut.Lock()
+	defer leakMut.Unlock()
+	ignoredGoroutines = append(ignoredGoroutines, stackPart)
+}
+
+// BeforeTest takes a snapshot of the running goroutines, so that AfterTest
+// only reports the goroutines started afterwards. MainTest calls it before
+// running the tests, and AfterTest after every check, so that a test is not
+// blamed for the goroutines of the tests before it that called AfterTest.
+// A test can call it first to also ignore the goroutines of the other
+// tests, or use LeakTest.
+func BeforeTest() {
+	ids := snapshotGoroutines()
+	leakMut.Lock()
+	beforeTest = ids
+	leakMut.Unlock()
+}
+
+// LeakTest takes a snapshot of the running goroutines for t, and fails t if
+// goroutines started during t are still running at its end, like
+// AfterTest. It is meant to be called first in a test, instead of
+// deferring AfterTest, and doesn't work with parallel tests.
+func LeakTest(t *testing.T) {
+	before := snapshotGoroutines()
+	t.Cleanup(func() { checkLeaks(t, before) })
+}
+
+// snapshotGoroutines returns the ids of the running goroutines.
+func snapshotGoroutines() map[int]bool {
+	ids := make(map[int]bool)
+	for _, g := range runningGoroutines() {
+		ids[g.id] = true
+	}
+	return ids
+}
+
+// goroutine is one entry of the dump of runtime.Stack.
+type goroutine struct {
+	id    int
+	stack string
+}
+
+var goroutineHeader = regexp.MustCompile(`^goroutine (\d+) \[`)
+
+// creator returns the function and the place that started the goroutine.
+func (g goroutine) creator() string {
+	lines := strings.Split(g.stack, "\n")
+	for i, l := range lines {
+		if !strings.HasPrefix(l, "created by ") {
+			continue
+		}
+		fn := strings.TrimPrefix(l, "created by ")
+		if j := strings.Index(fn, " in goroutine "); j >= 0 {
+			fn = fn[:j]
+		}
+		if i+1 < len(lines) {
+			place := strings.TrimSpace(lines[i+1])
+			if j := strings.LastIndex(place, " +0x"); j >= 0 {
+				place = place[:j]
+			}
+			return fn + " at " + place
+		}
+		return fn
+	}
+	return "unknown place"
+}
+
+func runningGoroutines() (gs []goroutine) {
 	buf := make([]byte, 2<<20)
-	buf = buf[:runtime.Stack(buf, true)]
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
 	for _, g := range strings.Split(string(buf), "\n\n") {
 		sl := strings.SplitN(g, "\n", 2)
 		if len(sl) != 2 {
 			continue
 		}
-		stack := strings.TrimSpace(sl[1])
-		if stack == "" ||
-			strings.Contains(stack, "created by testing.RunTests") ||
-			strings.Contains(stack, "testing.RunTests(") ||
-			strings.Contains(stack, "testing.Main(") ||
-			strings.Contains(stack, "runtime.goexit") ||
-			strings.Contains(stack, "interestingGoroutines") ||
-			strings.Contains(stack, "created by runtime.gc") ||
-			strings.Contains(stack, "runtime.MHeap_Scavenger") ||
-			strings.Contains(stack, "graceful") ||
-			strings.Contains(stack, "sigqueue") ||
-			strings.Contains(stack, "log.MainTest") {
+		m := goroutineHeader.FindStringSubmatch(sl[0])
+		if m == nil {
+			continue
+		}
+		id, _ := strconv.Atoi(m[1])
+		gs = append(gs, goroutine{id, strings.TrimSpace(sl[1])})
+	}
+	return
+}
+
+// interestingGoroutines returns the goroutines that are neither ignored nor
+// in before.
+func interestingGoroutines(before map[int]bool) (gs []goroutine) {
+	leakMut.Lock()
+	defer leakMut.Unlock()
+	for _, g := range runningGoroutines() {
+		if g.stack == "" || before[g.id] {
 			continue
 		}
-		gs = append(gs, stack)
+		ignored := false
+		for _, part := range ignoredGoroutines {
+			if strings.Contains(g.stack, part) {
+				ignored = true
+				break
+			}
+		}
+		if !ignored {
+			gs = append(gs, g)
+		}
 	}
-	sort.Strings(gs)
 	return
 }
 
+// leakReport groups the goroutines by the place that started them.
+func leakReport(gs []goroutine) []string {
+	stacks := make(map[string]map[string]int)
+	for _, g := range gs {
+		c := g.creator()
+		if stacks[c] == nil {
+			stacks[c] = make(map[string]int)
+		}
+		stacks[c][g.stack]++
+	}
+	var report []string
+	for c, s := range stacks {
+		for stack, count := range s {
+			report = append(report, fmt.Sprintf("%d goroutines created by %s:\n%s\n",
+				count, c, stack))
+		}
+	}
+	sort.Strings(report)
+	return report
+}
+
 // AfterTest can be called to wait for leaking goroutines to finish. If
 // they do not finish after a reasonable time (600ms) the test will fail.
+// Only the goroutines started after BeforeTest, or after the previous call
+// to AfterTest, are taken into account, and the ones given to
+// IgnoreGoroutine are never reported. Every leak is shown with the place
+// that created the goroutine.
 //
 // Inspired by https://golang.org/src/net/http/main_test.go
 // and https://github.com/coreos/etcd/blob/master/pkg/testutil/leak.go
 func AfterTest(t *testing.T) {
-	var stackCount map[string]int
+	leakMut.Lock()
+	before := beforeTest
+	leakMut.Unlock()
+	// The leaks are only reported once, by the test that left them.
+	defer BeforeTest()
+	var tb testing.TB
+	if t != nil {
+		tb = t
+	}
+	checkLeaks(tb, before)
+}
+
+// checkLeaks waits for the goroutines not in before to finish, and reports
+// the ones that don't to t, or to the log if t is nil.
+func checkLeaks(t testing.TB, before map[int]bool) {
+	var gs []goroutine
 	for i := 0; i < 6; i++ {
-		n := 0
-		stackCount = make(map[string]int)
-		gs := interestingGoroutines()
-		for _, g := range gs {
-			stackCount[g]++
-			n++
-		}
-		if n == 0 {
+		gs = interestingGoroutines(before)
+		if len(gs) == 0 {
 			break
 		}
 		// Wait for goroutines to schedule and die off:
 		time.Sleep(100 * time.Millisecond)
 	}
-	for stack, count := range stackCount {
-		if t != nil {
-			t.Logf("%d instances of:\n%s\n", count, stack)
-		} else {
-			Fatal(fmt.Sprintf("%d instances of:\n%s\n", count, stack))
-		}
+	if len(gs) == 0 {
+		return
 	}
-	if len(stackCount) > 0 {
+	report := leakReport(gs)
+	for _, r := range report {
 		if t != nil {
-			t.Fatalf("Test leaks %d gorountines.", len(stackCount))
+			t.Log(r)
 		} else {
-			Fatal(fmt.Sprintf("Test leaks %d gorountines.", len(stackCount)))
+			Error(r)
 		}
 	}
+	if t != nil {
+		t.Fatalf("Test leaks %d goroutines.", len(gs))
+	} else {
+		Fatal(fmt.Sprintf("Test leaks %d goroutines.", len(gs)))
+	}
 }
 
 // Stack converts []byte to string
@@ -0,0 +1,110 @@
+package log
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func leakingGoroutine(stop chan bool) {
+	<-stop
+}
+
+func TestInterestingGoroutines(t *testing.T) {
+	before := snapshotGoroutines()
+	require.Equal(t, 0, len(interestingGoroutines(before)))
+
+	stop := make(chan bool)
+	defer close(stop)
+	go leakingGoroutine(stop)
+	time.Sleep(10 * time.Millisecond)
+	gs := interestingGoroutines(before)
+	require.Equal(t, 1, len(gs))
+	require.True(t, strings.Contains(gs[0].creator(),
+		"log.TestInterestingGoroutines at "))
+	require.True(t, strings.Contains(gs[0].creator(), "testutil_test.go:"))
+
+	report := leakReport(append(gs, gs[0]))
+	require.Equal(t, 1, len(report))
+	require.True(t, strings.HasPrefix(report[0],
+		"2 goroutines created by github.com/dedis/onet/log.TestInterestingGoroutines at "))
+
+	IgnoreGoroutine("log.leakingGoroutine")
+	defer func() {
+		leakMut.Lock()
+		ignoredGoroutines = ignoredGoroutines[:len(ignoredGoroutines)-1]
+		leakMut.Unlock()
+	}()
+	require.Equal(t, 0, len(interestingGoroutines(before)))
+}
+
+func TestLeakTest(t *testing.T) {
+	LeakTest(t)
+	stop := make(chan bool)
+	go leakingGoroutine(stop)
+	close(stop)
+}
+
+// fakeTB records what the leak check reports, without failing the test.
+type fakeTB struct {
+	testing.TB
+	logs   []string
+	failed string
+}
+
+func (f *fakeTB) Log(args ...interface{}) {
+	f.logs = append(f.logs, fmt.Sprint(args...))
+}
+
+func (f *fakeTB) Fatalf(format string, args ...interface{}) {
+	f.failed = fmt.Sprintf(format, args...)
+}
+
+func TestCheckLeaks(t *testing.T) {
+	before := snapshotGoroutines()
+	stop := make(chan bool)
+	defer close(stop)
+	go leakingGoroutine(stop)
+	time.Sleep(10 * time.Millisecond)
+
+	tb := &fakeTB{}
+	checkLeaks(tb, before)
+	require.Equal(t, "Test leaks 1 goroutines.", tb.failed)
+	require.Equal(t, 1, len(tb.logs))
+	require.True(t, strings.HasPrefix(tb.logs[0],
+		"1 goroutines created by github.com/dedis/onet/log.TestCheckLeaks at "), tb.logs[0])
+	require.True(t, strings.Contains(tb.logs[0], "testutil_test.go:"))
+	require.True(t, strings.Contains(tb.logs[0], "log.leakingGoroutine"))
+}
+
+func TestCheckLeaks_Ignored(t *testing.T) {
+	before := snapshotGoroutines()
+	stop := make(chan bool)
+	defer close(stop)
+	go leakingGoroutine(stop)
+	time.Sleep(10 * time.Millisecond)
+
+	IgnoreGoroutine("log.leakingGoroutine")
+	defer func() {
+		leakMut.Lock()
+		ignoredGoroutines = ignoredGoroutines[:len(ignoredGoroutines)-1]
+		leakMut.Unlock()
+	}()
+	tb := &fakeTB{}
+	checkLeaks(tb, before)
+	require.Equal(t, "", tb.failed)
+	require.Empty(t, tb.logs)
+}
+
+func TestGoroutine_Creator(t *testing.T) {
+	g := goroutine{1, `main.wait(...)
+	/src/main.go:5 +0x20
+created by main.main in goroutine 1
+	/src/main.go:12 +0x3c`}
+	require.Equal(t, "main.main at /src/main.go:12", g.creator())
+	g.stack = "main.main()\n\t/src/main.go:3 +0x20"
+	require.Equal(t, "unknown place", g.creator())
+}
@@ -7,10 +7,12 @@ import (
 )
 
 func lvlUI(l int, args ...interface{}) {
+	notifyErrors(l, args)
 	if DebugVisible() > 0 {
 		lvl(l, 3, args...)
 	} else {
 		print(l, args...)
+		logUI(l, args...)
 	}
 }
 
@@ -68,7 +70,7 @@ func Errorf(f string, args ...interface{}) {
 
 // Panicf is like Panic but with a format-string
 func Panicf(f string, args ...interface{}) {
-	lvlUI(lvlWarning, fmt.Sprintf(f, args...))
+	lvlUI(lvlPanic, fmt.Sprintf(f, args...))
 	panic(args)
 }
 
@@ -81,6 +83,7 @@ func Fatalf(f string, args ...interface{}) {
 // ErrFatal calls log.Fatal in the case err != nil
 func ErrFatal(err error, args ...interface{}) {
 	if err != nil {
+		notifyError(err)
 		lvlUI(lvlFatal, err.Error()+" "+fmt.Sprint(args...))
 		os.Exit(1)
 	}
@@ -89,6 +92,7 @@ func ErrFatal(err error, args ...interface{}) {
 // ErrFatalf will call Fatalf when the error is non-nil
 func ErrFatalf(err error, f string, args ...interface{}) {
 	if err != nil {
+		notifyError(err)
 		lvlUI(lvlFatal, err.Error()+fmt.Sprintf(" "+f, args...))
 		os.Exit(1)
 	}
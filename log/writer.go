@@ -0,0 +1,50 @@
+package log
+
+import (
+	"bytes"
+	"io"
+	stdlog "log"
+	"sync"
+)
+
+// writer writes the lines written to it to the log.
+type writer struct {
+	level int
+	// buf holds the start of a line not finished yet
+	buf []byte
+	sync.Mutex
+}
+
+// NewWriter returns an io.Writer writing every line to the log at the
+// given level: a debug level from 1 to 5, or one of the Level constants.
+// It lets the libraries that log to an io.Writer use the log package.
+// A Writer at LevelFatal or LevelPanic neither exits nor panics.
+func NewWriter(level int) io.Writer {
+	return &writer{level: level}
+}
+
+// Write implements io.Writer.
+func (w *writer) Write(p []byte) (int, error) {
+	w.Lock()
+	defer w.Unlock()
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		lvl(w.level, 2, string(w.buf[:i]))
+		w.buf = w.buf[i+1:]
+	}
+	if len(w.buf) == 0 {
+		w.buf = nil
+	}
+	return len(p), nil
+}
+
+// NewStdLogger returns a logger of the standard library writing to the log
+// at the given level, for example for the ErrorLog of an http.Server. The
+// prefix is added to every line.
+func NewStdLogger(level int, prefix string) *stdlog.Logger {
+	return stdlog.New(NewWriter(level), prefix, 0)
+}
@@ -0,0 +1,29 @@
+package log
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewWriter(t *testing.T) {
+	SetDebugVisible(1)
+	GetStdOut()
+	GetStdErr()
+
+	w := NewWriter(1)
+	fmt.Fprint(w, "first line\nsecond")
+	out := GetStdOut()
+	require.Contains(t, out, "- first line\n")
+	require.NotContains(t, out, "second")
+	fmt.Fprint(w, " part\n")
+	require.Contains(t, GetStdOut(), "- second part\n")
+
+	fmt.Fprintln(NewWriter(2), "hidden")
+	require.Equal(t, "", GetStdOut())
+
+	NewStdLogger(LevelError, "http: ").Println("TLS handshake error")
+	require.Contains(t, GetStdErr(), "E : (")
+	GetStdErr()
+}
@@ -1,3 +1,5 @@
+// +build !js
+
 package onet
 
 import (
@@ -24,6 +26,15 @@ var SendRosterMsgID = RosterTypeID
 // ConfigMsgID of the generic config message
 var ConfigMsgID = network.RegisterMessage(ConfigMsg{})
 
+// BudgetMsgID of the budget message
+var BudgetMsgID = network.RegisterMessage(BudgetMsg{})
+
+// AbortMsgID of the message telling a parent that its child aborted
+var AbortMsgID = network.RegisterMessage(AbortMsg{})
+
+// GossipMsgID of the gossip message
+var GossipMsgID = network.RegisterMessage(GossipMsg{})
+
 // ProtocolMsg is to be embedded in every message that is made for a
 // ProtocolInstance
 type ProtocolMsg struct {
@@ -39,6 +50,11 @@ type ProtocolMsg struct {
 	Msg network.Message
 	// The actual data as binary blob
 	MsgSlice []byte
+	// TraceContext is the trace context of the sending instance, see
+	// TracerName
+	TraceContext map[string]string
+	// size of the message on the wire, used for the resource accounting
+	size uint64
 }
 
 // ConfigMsg is sent by the overlay containing a generic slice of bytes to
@@ -48,6 +64,44 @@ type ConfigMsg struct {
 	Dest   TokenID
 }
 
+// BudgetMsg is sent by the overlay with the execution budget of a protocol
+// run, before the first message to a node.
+type BudgetMsg struct {
+	Budget ProtocolBudget
+	Dest   TokenID
+}
+
+// AbortMsg is sent by the overlay to the parent of an instance aborted
+// after a panic, so that the parent aborts too. It is also sent to the
+// sender of a message for which a node refuses to create an instance. It
+// is only accepted from a child of the instance.
+type AbortMsg struct {
+	Dest TokenID
+	// Origin is the node that panicked
+	Origin *network.ServerIdentity
+	Reason string
+}
+
+// GossipMsg carries a message gossiped with Overlay.Gossip. Every node
+// receiving it for the first time delivers Msg to its processors as if
+// Origin had sent it, and forwards it to Fanout random nodes of the roster
+// until Rounds is reached.
+type GossipMsg struct {
+	ID     uuid.UUID
+	Origin *network.ServerIdentity
+	Roster *Roster
+	Round  int
+	Rounds int
+	Fanout int
+	// Created is when the origin sent the message, in nanoseconds since
+	// the epoch. Older messages than gossipSeenTimeout are dropped.
+	Created int64
+	// Msg is the marshalled message
+	Msg []byte
+	// Signature is the signature of the origin on all fields but Round
+	Signature []byte
+}
+
 // RoundID uniquely identifies a round of a protocol run
 type RoundID uuid.UUID
 
@@ -136,6 +190,8 @@ type TreeNodeInfo struct {
 // roster.
 type OverlayMsg struct {
 	TreeNodeInfo *TreeNodeInfo
+	// TraceContext is passed along with the message of TreeNodeInfo
+	TraceContext map[string]string
 
 	RequestTree   *RequestTree
 	TreeMarshal   *TreeMarshal
@@ -0,0 +1,40 @@
+// +build !js
+
+package onet
+
+import "net/http"
+
+// ServiceRequestHandler handles the request of a client to the given path
+// of a service, and returns the reply.
+type ServiceRequestHandler func(req *http.Request, service, path string, msg []byte) ([]byte, error)
+
+// ServiceMiddleware wraps the handling of the requests of the clients to
+// the services. It can refuse a request by returning an error without
+// calling next, or look at the request and at the reply of next.
+type ServiceMiddleware func(next ServiceRequestHandler) ServiceRequestHandler
+
+// UseServiceMiddleware adds a middleware to the requests of all services.
+// The first middleware added is the first one to see the request. The
+// middlewares only wrap the requests with a reply, not the streams.
+func (c *Server) UseServiceMiddleware(m ServiceMiddleware) {
+	c.websocket.Lock()
+	defer c.websocket.Unlock()
+	c.websocket.middlewares = append(c.websocket.middlewares, m)
+}
+
+// handler returns the handling of the requests to s with all middlewares
+// around it.
+func (w *WebSocket) handler(s Service) ServiceRequestHandler {
+	h := func(req *http.Request, service, path string, msg []byte) ([]byte, error) {
+		return s.ProcessClientRequest(req, path, msg)
+	}
+	if w == nil {
+		return h
+	}
+	w.Lock()
+	defer w.Unlock()
+	for i := len(w.middlewares) - 1; i >= 0; i-- {
+		h = w.middlewares[i](h)
+	}
+	return h
+}
@@ -0,0 +1,68 @@
+package onet
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/dedis/onet/network"
+	"github.com/stretchr/testify/require"
+)
+
+// echoService replies with the path of the request.
+type echoService struct{}
+
+func (echoService) ProcessClientRequest(req *http.Request, path string, buf []byte) ([]byte, error) {
+	return []byte(path), nil
+}
+
+func (echoService) NewProtocol(tn *TreeNodeInstance, conf *GenericConfig) (ProtocolInstance, error) {
+	return nil, nil
+}
+
+func (echoService) Process(env *network.Envelope) {
+}
+
+func TestWebSocket_Middlewares(t *testing.T) {
+	var w *WebSocket
+	reply, err := w.handler(echoService{})(nil, "echo", "path", nil)
+	require.Nil(t, err)
+	require.Equal(t, "path", string(reply))
+
+	w = &WebSocket{}
+	var order []string
+	tag := func(name string) ServiceMiddleware {
+		return func(next ServiceRequestHandler) ServiceRequestHandler {
+			return func(req *http.Request, service, path string, msg []byte) ([]byte, error) {
+				order = append(order, name+" "+service)
+				reply, err := next(req, service, path, msg)
+				return append(reply, []byte(" "+name)...), err
+			}
+		}
+	}
+	w.middlewares = []ServiceMiddleware{tag("first"), tag("second")}
+	reply, err = w.handler(echoService{})(nil, "echo", "path", nil)
+	require.Nil(t, err)
+	require.Equal(t, "path second first", string(reply))
+	require.Equal(t, []string{"first echo", "second echo"}, order)
+}
+
+func TestServer_UseServiceMiddleware(t *testing.T) {
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	server := local.GenServers(1)[0]
+	errRefused := errors.New("refused by middleware")
+	server.UseServiceMiddleware(func(next ServiceRequestHandler) ServiceRequestHandler {
+		return func(req *http.Request, service, path string, msg []byte) ([]byte, error) {
+			if service == serviceWebSocket {
+				return nil, errRefused
+			}
+			return next(req, service, path, msg)
+		}
+	})
+
+	client := NewClient(tSuite, serviceWebSocket)
+	err := client.SendProtobuf(server.ServerIdentity, &SimpleResponse{1}, nil)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), errRefused.Error())
+}
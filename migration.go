@@ -0,0 +1,133 @@
+// +build !js
+
+package onet
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/dedis/onet/log"
+)
+
+// MigrationFunc changes the data of a service from the previous version of
+// its schema to the next one. It gets the transaction in which all pending
+// migrations of the service run, and the bucket of the service. If it
+// returns an error, none of the pending migrations is applied.
+type MigrationFunc func(tx *bolt.Tx, bucket *bolt.Bucket) error
+
+type migration struct {
+	version uint64
+	fn      MigrationFunc
+}
+
+// schemaBucket holds the schema version of every service.
+var schemaBucket = []byte("onet_schema")
+
+// migrations holds the registered migrations of all services.
+var migrations = struct {
+	services map[string][]migration
+	sync.Mutex
+}{services: make(map[string][]migration)}
+
+// RegisterMigration adds a migration of the storage of the service name to
+// the given version, which must be bigger than 0. When a server starts,
+// all migrations of a service with a version bigger than the one stored in
+// the database are applied in order, before the service is started. As a
+// service starts with version 0, a new database goes through all
+// migrations, too.
+//
+// Migrations should be registered in an init function, like the service.
+func RegisterMigration(name string, version uint64, fn MigrationFunc) error {
+	if version == 0 {
+		return errors.New("migration version must be bigger than 0")
+	}
+	migrations.Lock()
+	defer migrations.Unlock()
+	for _, m := range migrations.services[name] {
+		if m.version == version {
+			return fmt.Errorf("migration %d of %s already registered",
+				version, name)
+		}
+	}
+	ms := append(migrations.services[name], migration{version, fn})
+	sort.Slice(ms, func(i, j int) bool { return ms[i].version < ms[j].version })
+	migrations.services[name] = ms
+	return nil
+}
+
+// UnregisterMigrations removes all migrations of the service name.
+func UnregisterMigrations(name string) {
+	migrations.Lock()
+	defer migrations.Unlock()
+	delete(migrations.services, name)
+}
+
+// schemaVersion returns the stored schema version of the service name.
+func schemaVersion(tx *bolt.Tx, name string) uint64 {
+	b := tx.Bucket(schemaBucket)
+	if b == nil {
+		return 0
+	}
+	v := b.Get([]byte(name))
+	if len(v) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(v)
+}
+
+// migrate applies the pending migrations of the service name in a single
+// transaction and stores the new schema version.
+func (s *serviceManager) migrate(name string) error {
+	return s.migrateBucket(name, name)
+}
+
+// migrateBucket is like migrate, for the storage of the service name in
+// bucket, which holds its own schema version.
+func (s *serviceManager) migrateBucket(name, bucket string) error {
+	migrations.Lock()
+	ms := migrations.services[name]
+	migrations.Unlock()
+	if len(ms) == 0 {
+		return nil
+	}
+	return s.dbUpdate(func(tx *bolt.Tx) error {
+		current := schemaVersion(tx, bucket)
+		version := current
+		for _, m := range ms {
+			if m.version <= current {
+				continue
+			}
+			log.Lvlf2("Migrating %s from version %d to %d", bucket, version, m.version)
+			if err := m.fn(tx, tx.Bucket([]byte(bucket))); err != nil {
+				return fmt.Errorf("migration of %s to version %d: %s",
+					bucket, m.version, err)
+			}
+			version = m.version
+		}
+		if version == current {
+			return nil
+		}
+		b, err := tx.CreateBucketIfNotExists(schemaBucket)
+		if err != nil {
+			return err
+		}
+		buf := make([]byte, 8)
+		binary.BigEndian.PutUint64(buf, version)
+		return b.Put([]byte(bucket), buf)
+	})
+}
+
+// SchemaVersion returns the version of the storage schema of this service,
+// that is the version of the last migration applied.
+func (c *Context) SchemaVersion() (uint64, error) {
+	var version uint64
+	err := c.manager.dbView(func(tx *bolt.Tx) error {
+		version = schemaVersion(tx, string(c.bucketName))
+		return nil
+	})
+	return version, err
+}
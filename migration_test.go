@@ -0,0 +1,66 @@
+package onet
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterMigration(t *testing.T) {
+	name := "testMigrationRegister"
+	defer UnregisterMigrations(name)
+	fn := func(tx *bolt.Tx, b *bolt.Bucket) error { return nil }
+	require.NotNil(t, RegisterMigration(name, 0, fn))
+	require.Nil(t, RegisterMigration(name, 2, fn))
+	require.Nil(t, RegisterMigration(name, 1, fn))
+	require.NotNil(t, RegisterMigration(name, 2, fn))
+	ms := migrations.services[name]
+	require.Equal(t, uint64(1), ms[0].version)
+	require.Equal(t, uint64(2), ms[1].version)
+}
+
+func TestServiceManager_migrate(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "conode")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmp)
+	c := createContext(t, tmp)
+	name := string(c.bucketName)
+	defer UnregisterMigrations(name)
+
+	var applied []uint64
+	add := func(v uint64, err error) {
+		RegisterMigration(name, v, func(tx *bolt.Tx, b *bolt.Bucket) error {
+			if err != nil {
+				return err
+			}
+			applied = append(applied, v)
+			return b.Put([]byte("version"), []byte{byte(v)})
+		})
+	}
+	add(1, nil)
+	add(2, nil)
+	require.Nil(t, c.manager.migrate(name))
+	require.Equal(t, []uint64{1, 2}, applied)
+	v, err := c.SchemaVersion()
+	require.Nil(t, err)
+	require.Equal(t, uint64(2), v)
+
+	// Already applied migrations are skipped, a failing migration aborts
+	// all pending ones.
+	applied = nil
+	add(3, nil)
+	add(4, errors.New("failing"))
+	require.NotNil(t, c.manager.migrate(name))
+	require.Equal(t, []uint64{3}, applied)
+	v, err = c.SchemaVersion()
+	require.Nil(t, err)
+	require.Equal(t, uint64(2), v)
+	c.manager.dbView(func(tx *bolt.Tx) error {
+		require.Equal(t, []byte{2}, tx.Bucket(c.bucketName).Get([]byte("version")))
+		return nil
+	})
+}
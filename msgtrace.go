@@ -0,0 +1,267 @@
+// +build !js
+
+package onet
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+)
+
+// MessageTrace is a protocol message sent or received by an Overlay, as
+// recorded once TraceMessages is called.
+type MessageTrace struct {
+	Time time.Time
+	// Sent is true for the messages sent by the overlay, false for the
+	// received ones
+	Sent     bool
+	Protocol string
+	Round    string
+	Type     string
+	Size     uint64
+	From     network.Address
+	To       network.Address
+	FromNode TreeNodeID
+	ToNode   TreeNodeID
+}
+
+// messageTracer keeps the latest traces in a ring buffer, and writes all of
+// them to w if set.
+type messageTracer struct {
+	traces []MessageTrace
+	// next is the index of the next trace in traces
+	next int
+	full bool
+	w    io.Writer
+	sync.Mutex
+}
+
+func (mt *messageTracer) add(t MessageTrace) {
+	mt.Lock()
+	defer mt.Unlock()
+	if mt.w != nil {
+		buf, err := json.Marshal(t)
+		if err == nil {
+			_, err = mt.w.Write(append(buf, '\n'))
+		}
+		if err != nil {
+			log.Error("Couldn't write message trace:", err)
+		}
+	}
+	if len(mt.traces) == 0 {
+		return
+	}
+	mt.traces[mt.next] = t
+	mt.next = (mt.next + 1) % len(mt.traces)
+	if mt.next == 0 {
+		mt.full = true
+	}
+}
+
+func (mt *messageTracer) list() []MessageTrace {
+	mt.Lock()
+	defer mt.Unlock()
+	if !mt.full {
+		return append([]MessageTrace{}, mt.traces[:mt.next]...)
+	}
+	return append(append([]MessageTrace{}, mt.traces[mt.next:]...), mt.traces[:mt.next]...)
+}
+
+// TraceMessages makes the overlay record the protocol messages it sends and
+// receives. The latest size messages are kept for MessageTraces, and if w
+// is not nil, every message is written to it as one line of JSON. Tracing
+// slows down the overlay, so it is off by default. A new call replaces the
+// previous traces.
+func (o *Overlay) TraceMessages(size int, w io.Writer) {
+	if size < 0 {
+		size = 0
+	}
+	o.msgTracerLock.Lock()
+	defer o.msgTracerLock.Unlock()
+	o.msgTracer = &messageTracer{traces: make([]MessageTrace, size), w: w}
+}
+
+// StopTracingMessages stops the recording of the messages. The traces
+// recorded so far are dropped.
+func (o *Overlay) StopTracingMessages() {
+	o.msgTracerLock.Lock()
+	defer o.msgTracerLock.Unlock()
+	o.msgTracer = nil
+}
+
+// MessageTraces returns the messages recorded since TraceMessages, oldest
+// first.
+func (o *Overlay) MessageTraces() []MessageTrace {
+	o.msgTracerLock.Lock()
+	mt := o.msgTracer
+	o.msgTracerLock.Unlock()
+	if mt == nil {
+		return nil
+	}
+	return mt.list()
+}
+
+// traceMessage records a protocol message if tracing is on. The receiver
+// of a sent message is to, the sender of a received one is from.
+func (o *Overlay) traceMessage(sent bool, from, to *Token, si *network.ServerIdentity,
+	msg network.Message, size uint64) {
+	o.msgTracerLock.Lock()
+	mt := o.msgTracer
+	o.msgTracerLock.Unlock()
+	if mt == nil || from == nil || to == nil {
+		return
+	}
+	t := MessageTrace{
+		Time:     o.Clock().Now(),
+		Sent:     sent,
+		Protocol: o.server.protocols.ProtocolIDToName(to.ProtoID),
+		Round:    to.RoundID.String(),
+		Type:     strings.TrimPrefix(fmt.Sprintf("%T", msg), "*"),
+		Size:     size,
+		From:     o.server.Address(),
+		To:       si.Address,
+		FromNode: from.TreeNodeID,
+		ToNode:   to.TreeNodeID,
+	}
+	if !sent {
+		t.From, t.To = si.Address, o.server.Address()
+	}
+	mt.add(t)
+}
+
+// SequenceDiagram is the flow of the messages of one or more overlays, in a
+// form that tools drawing sequence diagrams can read: Participants are the
+// servers, sorted, and every message is an arrow between two of them.
+type SequenceDiagram struct {
+	Participants []network.Address `json:"participants"`
+	Messages     []SequenceMessage `json:"messages"`
+}
+
+// SequenceMessage is an arrow of a SequenceDiagram. Received is zero if the
+// message wasn't seen at its destination, and Sent is zero if it wasn't
+// seen leaving.
+type SequenceMessage struct {
+	From     network.Address `json:"from"`
+	To       network.Address `json:"to"`
+	Label    string          `json:"label"`
+	Protocol string          `json:"protocol"`
+	Round    string          `json:"round"`
+	Size     uint64          `json:"size"`
+	Sent     time.Time       `json:"sent"`
+	Received time.Time       `json:"received"`
+}
+
+// NewSequenceDiagram merges the traces of one or more overlays, e.g. all the
+// servers of a LocalTest. A message traced when it is sent and when it is
+// received becomes a single arrow with both times. The arrows are sorted by
+// the time they left.
+func NewSequenceDiagram(traces ...[]MessageTrace) *SequenceDiagram {
+	type arrow struct {
+		from, to, label, round string
+		fromNode, toNode       TreeNodeID
+	}
+	sd := &SequenceDiagram{Participants: []network.Address{}, Messages: []SequenceMessage{}}
+	seen := make(map[network.Address]bool)
+	// received holds the index of the messages received but not matched
+	// with a sent message yet
+	received := make(map[arrow][]int)
+	var all []MessageTrace
+	for _, ts := range traces {
+		all = append(all, ts...)
+	}
+	// Sent messages first, so that the received ones find them.
+	sort.SliceStable(all, func(i, j int) bool {
+		if all[i].Sent != all[j].Sent {
+			return all[i].Sent
+		}
+		return all[i].Time.Before(all[j].Time)
+	})
+	for _, t := range all {
+		for _, a := range []network.Address{t.From, t.To} {
+			if !seen[a] {
+				seen[a] = true
+				sd.Participants = append(sd.Participants, a)
+			}
+		}
+		key := arrow{string(t.From), string(t.To), t.Type, t.Round, t.FromNode, t.ToNode}
+		if t.Sent {
+			received[key] = append(received[key], len(sd.Messages))
+			sd.Messages = append(sd.Messages, SequenceMessage{
+				From: t.From, To: t.To, Label: t.Type, Protocol: t.Protocol,
+				Round: t.Round, Size: t.Size, Sent: t.Time,
+			})
+			continue
+		}
+		if idx := received[key]; len(idx) > 0 {
+			sd.Messages[idx[0]].Received = t.Time
+			received[key] = idx[1:]
+			continue
+		}
+		sd.Messages = append(sd.Messages, SequenceMessage{
+			From: t.From, To: t.To, Label: t.Type, Protocol: t.Protocol,
+			Round: t.Round, Size: t.Size, Received: t.Time,
+		})
+	}
+	sort.Slice(sd.Participants, func(i, j int) bool {
+		return sd.Participants[i] < sd.Participants[j]
+	})
+	sort.SliceStable(sd.Messages, func(i, j int) bool {
+		return sd.Messages[i].start().Before(sd.Messages[j].start())
+	})
+	return sd
+}
+
+// start returns the time the message left, or arrived if it wasn't seen
+// leaving.
+func (sm SequenceMessage) start() time.Time {
+	if sm.Sent.IsZero() {
+		return sm.Received
+	}
+	return sm.Sent
+}
+
+// WriteJSON writes the diagram as JSON.
+func (sd *SequenceDiagram) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sd)
+}
+
+// AdminMessageTrace starts the tracing of the messages in the admin API.
+type AdminMessageTrace struct {
+	// Size is the number of messages kept
+	Size int
+}
+
+// serveAdminMessages is the handler of /admin/messages. GET returns the
+// messages traced by the server as a SequenceDiagram, PUT starts tracing
+// and DELETE stops it.
+func (c *Server) serveAdminMessages(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeAdminJSON(w, NewSequenceDiagram(c.overlay.MessageTraces()))
+	case http.MethodPut:
+		var mt AdminMessageTrace
+		if err := json.NewDecoder(r.Body).Decode(&mt); err != nil || mt.Size <= 0 {
+			http.Error(w, "need a positive Size", http.StatusBadRequest)
+			return
+		}
+		log.Lvl1("Admin starts tracing", mt.Size, "messages")
+		c.overlay.TraceMessages(mt.Size, nil)
+		writeAdminJSON(w, mt)
+	case http.MethodDelete:
+		log.Lvl1("Admin stops tracing messages")
+		c.overlay.StopTracingMessages()
+		writeAdminJSON(w, AdminMessageTrace{})
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
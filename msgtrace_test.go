@@ -0,0 +1,112 @@
+package onet
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dedis/onet/network"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageTracer(t *testing.T) {
+	buf := &bytes.Buffer{}
+	mt := &messageTracer{traces: make([]MessageTrace, 2), w: buf}
+	for i := 0; i < 3; i++ {
+		mt.add(MessageTrace{Size: uint64(i)})
+	}
+	list := mt.list()
+	require.Equal(t, 2, len(list))
+	require.Equal(t, uint64(1), list[0].Size)
+	require.Equal(t, uint64(2), list[1].Size)
+	require.Equal(t, 3, strings.Count(buf.String(), "\n"))
+}
+
+func TestNewSequenceDiagram(t *testing.T) {
+	t0 := time.Now()
+	a, b := network.Address("tcp://a:1"), network.Address("tcp://b:1")
+	sent := MessageTrace{Time: t0, Sent: true, Type: "onet.SimpleMessage",
+		Round: "r", From: a, To: b}
+	recv := sent
+	recv.Time, recv.Sent = t0.Add(time.Millisecond), false
+	// Received without being traced by its sender
+	lone := MessageTrace{Time: t0.Add(-time.Second), Type: "onet.SimpleMessage",
+		Round: "r", From: b, To: a}
+
+	sd := NewSequenceDiagram([]MessageTrace{recv, lone}, []MessageTrace{sent})
+	require.Equal(t, []network.Address{a, b}, sd.Participants)
+	require.Equal(t, 2, len(sd.Messages))
+	require.Equal(t, b, sd.Messages[0].From)
+	require.True(t, sd.Messages[0].Sent.IsZero())
+	require.Equal(t, a, sd.Messages[1].From)
+	require.Equal(t, t0, sd.Messages[1].Sent)
+	require.Equal(t, recv.Time, sd.Messages[1].Received)
+
+	buf := &bytes.Buffer{}
+	require.Nil(t, sd.WriteJSON(buf))
+	require.Contains(t, buf.String(), `"label": "onet.SimpleMessage"`)
+}
+
+func TestOverlay_TraceMessages(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	tni := newLimitedInstance(t, local, ProtocolLimits{})
+	for _, o := range local.Overlays {
+		o.TraceMessages(10, nil)
+	}
+	child := tni.Children()[0]
+	require.Nil(t, tni.SendTo(child, &SimpleMessage{3}))
+
+	var traces [][]MessageTrace
+	for i := 0; i < 50; i++ {
+		traces = traces[:0]
+		n := 0
+		for _, o := range local.Overlays {
+			traces = append(traces, o.MessageTraces())
+			n += len(o.MessageTraces())
+		}
+		if n == 2 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	sd := NewSequenceDiagram(traces...)
+	require.Equal(t, 1, len(sd.Messages))
+	m := sd.Messages[0]
+	require.Equal(t, tni.ServerIdentity().Address, m.From)
+	require.Equal(t, child.ServerIdentity.Address, m.To)
+	require.Equal(t, "onet.SimpleMessage", m.Label)
+	require.Equal(t, "ProtocolOverlay", m.Protocol)
+	require.False(t, m.Received.Before(m.Sent))
+
+	for _, o := range local.Overlays {
+		o.StopTracingMessages()
+		require.Nil(t, o.MessageTraces())
+	}
+}
+
+func TestServer_AdminMessages(t *testing.T) {
+	l := NewLocalTest(tSuite)
+	defer l.CloseAll()
+	s := l.GenServers(1)[0]
+	s.SetAdminToken(adminTestToken)
+
+	rec := adminRequest(s, "PUT", "/admin/messages", "127.0.0.1:1234", adminTestToken, `{"Size":0}`)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = adminRequest(s, "PUT", "/admin/messages", "127.0.0.1:1234", adminTestToken, `{"Size":10}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NotNil(t, s.overlay.MessageTraces())
+
+	rec = adminRequest(s, "GET", "/admin/messages", "127.0.0.1:1234", adminTestToken, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	sd := &SequenceDiagram{}
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), sd))
+	require.Equal(t, 0, len(sd.Messages))
+
+	rec = adminRequest(s, "DELETE", "/admin/messages", "127.0.0.1:1234", adminTestToken, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Nil(t, s.overlay.MessageTraces())
+}
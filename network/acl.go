@@ -0,0 +1,173 @@
+package network
+
+import (
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/dedis/onet/log"
+)
+
+// ACL holds the allow- and deny-lists of the remotes that may connect. IPs
+// are single addresses or CIDR networks like "10.0.0.0/8", keys are the
+// public keys of the servers as written in the group files. A remote is
+// refused if it matches a deny-list, or if an allow-list of its kind is not
+// empty and it doesn't match it. A nil ACL allows everybody.
+type ACL struct {
+	AllowIPs  []string `toml:",omitempty" json:",omitempty"`
+	DenyIPs   []string `toml:",omitempty" json:",omitempty"`
+	AllowKeys []string `toml:",omitempty" json:",omitempty"`
+	DenyKeys  []string `toml:",omitempty" json:",omitempty"`
+
+	allowNets []*net.IPNet
+	denyNets  []*net.IPNet
+}
+
+// ReadACL reads the ACL from a toml file.
+func ReadACL(file string) (*ACL, error) {
+	acl := &ACL{}
+	if _, err := toml.DecodeFile(file, acl); err != nil {
+		return nil, err
+	}
+	return acl, acl.parse()
+}
+
+// parse checks the IPs of the lists and prepares them for AllowsIP.
+func (a *ACL) parse() error {
+	var err error
+	if a.allowNets, err = parseIPNets(a.AllowIPs); err != nil {
+		return err
+	}
+	a.denyNets, err = parseIPNets(a.DenyIPs)
+	return err
+}
+
+func parseIPNets(list []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, len(list))
+	for i, s := range list {
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, errors.New("invalid IP: " + s)
+			}
+			bits := net.IPv6len * 8
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, net.IPv4len*8
+			}
+			nets[i] = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+			continue
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+		nets[i] = n
+	}
+	return nets, nil
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsIP returns whether the IP may connect.
+func (a *ACL) AllowsIP(ip net.IP) bool {
+	if a == nil {
+		return true
+	}
+	if containsIP(a.denyNets, ip) {
+		return false
+	}
+	return len(a.allowNets) == 0 || containsIP(a.allowNets, ip)
+}
+
+// AllowsAddress returns whether the remote with the given host:port or
+// Address may connect. Addresses without IP, like the ones of Unix sockets,
+// are always allowed.
+func (a *ACL) AllowsAddress(addr string) bool {
+	if a == nil {
+		return true
+	}
+	if ad := Address(addr); ad.Valid() {
+		addr = ad.NetworkAddress()
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return true
+	}
+	return a.AllowsIP(ip)
+}
+
+// AllowsIdentity returns whether the server may connect.
+func (a *ACL) AllowsIdentity(si *ServerIdentity) bool {
+	if a == nil {
+		return true
+	}
+	key := si.Public.String()
+	for _, k := range a.DenyKeys {
+		if k == key {
+			return false
+		}
+	}
+	if len(a.AllowKeys) == 0 {
+		return true
+	}
+	for _, k := range a.AllowKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// SetACL replaces the ACL of the incoming connections. The open connections
+// that the new ACL refuses are closed. A nil ACL allows everybody.
+func (r *Router) SetACL(acl *ACL) error {
+	if acl != nil {
+		if err := acl.parse(); err != nil {
+			return err
+		}
+	}
+	r.Lock()
+	r.acl = acl
+	var refused []Conn
+	for id, arr := range r.connections {
+		r.peers.Lock()
+		var si *ServerIdentity
+		if pe, ok := r.peers.m[id]; ok {
+			si = pe.stats.ServerIdentity
+		}
+		r.peers.Unlock()
+		for _, c := range arr {
+			if !acl.AllowsAddress(c.Remote().String()) ||
+				(si != nil && !acl.AllowsIdentity(si)) {
+				refused = append(refused, c)
+			}
+		}
+	}
+	r.Unlock()
+	for _, c := range refused {
+		log.Lvl2(r.address, "closes connection to", c.Remote(), "refused by the ACL")
+		if err := c.Close(); err != nil {
+			log.Lvl3(err)
+		}
+	}
+	return nil
+}
+
+// ACL returns the ACL of the incoming connections, nil if there is none.
+func (r *Router) ACL() *ACL {
+	r.Lock()
+	defer r.Unlock()
+	return r.acl
+}
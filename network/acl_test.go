@@ -0,0 +1,115 @@
+package network
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/dedis/kyber/util/key"
+	"github.com/dedis/onet/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestACL_Allows(t *testing.T) {
+	var nilACL *ACL
+	require.True(t, nilACL.AllowsIP(net.ParseIP("10.0.0.1")))
+	require.True(t, nilACL.AllowsAddress("10.0.0.1:2000"))
+
+	acl := &ACL{
+		AllowIPs: []string{"10.0.0.0/8", "::1"},
+		DenyIPs:  []string{"10.0.0.66"},
+	}
+	require.Nil(t, acl.parse())
+	for addr, ok := range map[string]bool{
+		"10.0.0.1:2000":         true,
+		"10.0.0.66:2000":        false,
+		"192.168.0.1:2000":      false,
+		"[::1]:2000":            true,
+		"tls://10.1.2.3:2000":   true,
+		"tls://10.0.0.66:2000":  false,
+		"unix:///tmp/s.sock":    true,
+		"tcp://localhost:2000":  true,
+		"local://10.0.0.1:2000": true,
+	} {
+		require.Equal(t, ok, acl.AllowsAddress(addr), addr)
+	}
+
+	require.NotNil(t, (&ACL{AllowIPs: []string{"10.0.0"}}).parse())
+	require.NotNil(t, (&ACL{DenyIPs: []string{"10.0.0.0/33"}}).parse())
+
+	kp1, kp2 := key.NewKeyPair(tSuite), key.NewKeyPair(tSuite)
+	si1 := NewServerIdentity(kp1.Public, "tls://10.0.0.1:2000")
+	si2 := NewServerIdentity(kp2.Public, "tls://10.0.0.2:2000")
+	require.True(t, acl.AllowsIdentity(si1))
+	acl.DenyKeys = []string{kp1.Public.String()}
+	require.False(t, acl.AllowsIdentity(si1))
+	require.True(t, acl.AllowsIdentity(si2))
+	acl.DenyKeys = nil
+	acl.AllowKeys = []string{kp1.Public.String()}
+	require.True(t, acl.AllowsIdentity(si1))
+	require.False(t, acl.AllowsIdentity(si2))
+}
+
+func TestReadACL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "acl")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, "acl.toml")
+	require.Nil(t, ioutil.WriteFile(file, []byte(`DenyIPs = ["192.168.1.0/24"]`), 0600))
+	acl, err := ReadACL(file)
+	require.Nil(t, err)
+	require.False(t, acl.AllowsAddress("192.168.1.5:2000"))
+	require.True(t, acl.AllowsAddress("192.168.2.5:2000"))
+
+	require.Nil(t, ioutil.WriteFile(file, []byte(`DenyIPs = ["192.168.1"]`), 0600))
+	_, err = ReadACL(file)
+	require.NotNil(t, err)
+	_, err = ReadACL(path.Join(dir, "none.toml"))
+	require.NotNil(t, err)
+}
+
+func TestRouter_SetACL(t *testing.T) {
+	h1, err := NewTestRouterTCP(0)
+	require.Nil(t, err)
+	h2, err := NewTestRouterTCP(0)
+	require.Nil(t, err)
+	go h1.Start()
+	go h2.Start()
+	defer h1.Stop()
+	defer h2.Stop()
+
+	proc := make(envelopeProc, 1)
+	h2.RegisterProcessor(proc, SimpleMessageType)
+	_, err = h1.Send(h2.ServerIdentity, &SimpleMessage{3})
+	require.Nil(t, err)
+	<-proc
+
+	// the open connection is closed
+	require.NotNil(t, h2.SetACL(&ACL{DenyIPs: []string{"invalid"}}))
+	require.Nil(t, h2.SetACL(&ACL{DenyIPs: []string{"127.0.0.1", "::1"}}))
+	for h2.connection(h1.ServerIdentity.ID) != nil {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// and new ones are refused
+	log.OutputToBuf()
+	defer log.OutputToOs()
+	h1.Send(h2.ServerIdentity, &SimpleMessage{3})
+	select {
+	case <-proc:
+		t.Fatal("message went through the ACL")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	require.Nil(t, h2.SetACL(nil))
+	require.Nil(t, h2.ACL())
+	for h1.connection(h2.ServerIdentity.ID) != nil {
+		time.Sleep(10 * time.Millisecond)
+	}
+	_, err = h1.Send(h2.ServerIdentity, &SimpleMessage{3})
+	require.Nil(t, err)
+	<-proc
+}
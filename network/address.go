@@ -14,8 +14,8 @@ type ConnType string
 // Address contains the ConnType and the actual network address. It is used to connect
 // to a remote host with a Conn and to listen by a Listener.
 // A network address holds an IP address and the port number joined
-// by a colon.
-// It doesn't support IPv6 yet.
+// by a colon. IPv6 addresses are written in brackets, as in
+// "tls://[2001:db8::1]:2000".
 type Address string
 
 var lookupHost = net.LookupHost
@@ -27,6 +27,12 @@ const (
 	TLS = "tls"
 	// Local is a channel based connection type.
 	Local = "local"
+	// Unix is a connection over a Unix domain socket. The network address
+	// is the path of the socket, e.g. "unix:///tmp/conode.sock".
+	Unix = "unix"
+	// Noise is a connection over TCP encrypted by the Noise protocol, with
+	// the keys of the ServerIdentities.
+	Noise = "noise"
 	// InvalidConnType is an invalid connection type.
 	InvalidConnType = "wrong"
 )
@@ -39,7 +45,7 @@ const typeAddressSep = "://"
 // it returns InvalidConnType.
 func connType(t string) ConnType {
 	ct := ConnType(t)
-	types := []ConnType{PlainTCP, TLS, Local}
+	types := []ConnType{PlainTCP, TLS, Local, Unix, Noise}
 	for _, t := range types {
 		if t == ct {
 			return ct
@@ -100,10 +106,6 @@ func (a Address) Resolve() string {
 		return ""
 	}
 	host := a.Host()
-	// Ipv6 not handled properly yet
-	if host == "[::]" {
-		return "::"
-	}
 	// If the address is defined by an IP address, return it
 	if net.ParseIP(host) != nil {
 		return host
@@ -186,6 +188,10 @@ func (a Address) Valid() bool {
 	if connType(vals[0]) == InvalidConnType {
 		return false
 	}
+	// Unix sockets have a path instead of host and port.
+	if connType(vals[0]) == Unix {
+		return len(vals[1]) > 0
+	}
 
 	ip, port, e := net.SplitHostPort(vals[1])
 	if e != nil {
@@ -216,7 +222,7 @@ func (a Address) String() string {
 
 // Host returns the host part of the address.
 // ex: "tcp://127.0.0.1:2000" => "127.0.0.1"
-// In case of an error, it returns an empty string.
+// In case of an error, or for a Unix address, it returns an empty string.
 func (a Address) Host() string {
 	na := a.NetworkAddress()
 	if na == "" {
@@ -248,18 +254,31 @@ func (a Address) Port() string {
 // Public returns true if the address is a public and valid one
 // or false otherwise.
 // Specifically it checks if it is a private address by checking
-// 192.168.**,10.***,127.***,172.16-31.**,169.254.**,^::1,^fd.{0,2}:
+// 192.168.**,10.***,127.***,172.16-31.**,169.254.**,^::1,^fc/fd.{0,2}: and the
+// link-local fe80::/10.
 func (a Address) Public() bool {
 	private, err := regexp.MatchString("(^127\\.)|(^10\\.)|"+
 		"(^172\\.1[6-9]\\.)|(^172\\.2[0-9]\\.)|"+
 		"(^172\\.3[0-1]\\.)|(^192\\.168\\.)|(^169\\.254)|"+
-		"(^\\[::1\\])|(^\\[fd.{0,2}:)", a.NetworkAddressResolved())
+		"(^\\[::1\\])|(^\\[f[cd].{0,2}:)|(^\\[fe[89ab].?:)", a.NetworkAddressResolved())
 	if err != nil {
 		return false
 	}
 	return !private && a.Valid()
 }
 
+// NewUnixAddress returns a new Address of type Unix for the socket at the
+// given path.
+func NewUnixAddress(path string) Address {
+	return NewAddress(Unix, path)
+}
+
+// NewHostPortAddress returns a new Address of type t for the host and port,
+// putting IPv6 hosts in brackets.
+func NewHostPortAddress(t ConnType, host, port string) Address {
+	return NewAddress(t, net.JoinHostPort(host, port))
+}
+
 // NewAddress takes a connection type and the raw address. It returns a
 // correctly formatted address, which will be of type t.
 // It doesn't do any checking of ConnType or network.
@@ -17,6 +17,7 @@ func TestConnType(t *testing.T) {
 	}{
 		{"tcp", PlainTCP},
 		{"tls", TLS},
+		{"unix", Unix},
 		{"tcp4", InvalidConnType},
 		{"_tls", InvalidConnType},
 	}
@@ -28,6 +29,16 @@ func TestConnType(t *testing.T) {
 	}
 }
 
+func TestUnixAddress(t *testing.T) {
+	a := NewUnixAddress("/tmp/conode.sock")
+	assert.True(t, a.Valid())
+	assert.Equal(t, ConnType(Unix), a.ConnType())
+	assert.Equal(t, "/tmp/conode.sock", a.NetworkAddress())
+	assert.Equal(t, "", a.Host())
+	assert.Equal(t, "", a.Port())
+	assert.False(t, Address("unix://").Valid())
+}
+
 var staticHostIPMapping = make(map[string]string)
 
 func dummyResolver(s string) ([]string, error) {
@@ -63,6 +74,12 @@ func TestAddress(t *testing.T) {
 		{"tcp://10.0.0.4:2000", true, PlainTCP, "10.0.0.4:2000", "10.0.0.4", "2000", false, "10.0.0.4", "10.0.0.4:2000"},
 		{"tcp://67.43.129.85:2000", true, PlainTCP, "67.43.129.85:2000", "67.43.129.85", "2000", true, "67.43.129.85", "67.43.129.85:2000"},
 		{"tls://[::]:1000", true, TLS, "[::]:1000", "::", "1000", true, "::", "[::]:1000"},
+		{"tcp://[::1]:2000", true, PlainTCP, "[::1]:2000", "::1", "2000", false, "::1", "[::1]:2000"},
+		{"tls://[2001:db8::1]:2000", true, TLS, "[2001:db8::1]:2000", "2001:db8::1", "2000", true, "2001:db8::1", "[2001:db8::1]:2000"},
+		{"tls://[fe80::1]:2000", true, TLS, "[fe80::1]:2000", "fe80::1", "2000", false, "fe80::1", "[fe80::1]:2000"},
+		{"tls://[fc00::1]:2000", true, TLS, "[fc00::1]:2000", "fc00::1", "2000", false, "fc00::1", "[fc00::1]:2000"},
+		{"tls://172.32.0.1:2000", true, TLS, "172.32.0.1:2000", "172.32.0.1", "2000", true, "172.32.0.1", "172.32.0.1:2000"},
+		{"tls://::1:2000", false, InvalidConnType, "", "", "", false, "", ""},
 		{"tls4://10.0.0.4:2000", false, InvalidConnType, "", "", "", false, "", ""},
 		{"tls://1000.0.0.4:2000", false, InvalidConnType, "", "", "", false, "", ""},
 		{"tls://10.0.0.4:20000000", false, InvalidConnType, "", "", "", false, "", ""},
@@ -98,6 +115,11 @@ func TestAddress(t *testing.T) {
 	}
 }
 
+func TestNewHostPortAddress(t *testing.T) {
+	require.Equal(t, Address("tls://[::1]:2000"), NewHostPortAddress(TLS, "::1", "2000"))
+	require.Equal(t, Address("tcp://10.0.0.1:2000"), NewHostPortAddress(PlainTCP, "10.0.0.1", "2000"))
+}
+
 // Isolated test case for validHostname
 func TestDNSNames(t *testing.T) {
 	assert.True(t, validHostname("myhost.secondlabel.org"))
@@ -0,0 +1,171 @@
+package network
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is the source of time for the timeouts and the periodic tasks of
+// the Router and of the Overlay. Tests use a MockClock to make the time go
+// forward without waiting.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// After sends the time on the returned channel once d passed.
+	After(d time.Duration) <-chan time.Time
+	// AfterFunc calls f in its own goroutine once d passed.
+	AfterFunc(d time.Duration, f func()) Timer
+	// Sleep blocks until d passed.
+	Sleep(d time.Duration)
+}
+
+// Timer can stop a call of Clock.AfterFunc.
+type Timer interface {
+	// Stop prevents the call of the function. It returns false if the
+	// function was already called or the timer stopped.
+	Stop() bool
+}
+
+// RealClock is the Clock of the time package.
+var RealClock Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (realClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+// MockClock is a Clock whose time only goes forward with Advance.
+type MockClock struct {
+	sync.Mutex
+	now     time.Time
+	waiters []*mockTimer
+	changed *sync.Cond
+}
+
+type mockTimer struct {
+	clock *MockClock
+	when  time.Time
+	ch    chan time.Time
+	fn    func()
+}
+
+// NewMockClock returns a MockClock starting at the given time.
+func NewMockClock(start time.Time) *MockClock {
+	m := &MockClock{now: start}
+	m.changed = sync.NewCond(&m.Mutex)
+	return m
+}
+
+// Now returns the time of the clock.
+func (m *MockClock) Now() time.Time {
+	m.Lock()
+	defer m.Unlock()
+	return m.now
+}
+
+// After returns a channel that receives the time once the clock advanced
+// by d.
+func (m *MockClock) After(d time.Duration) <-chan time.Time {
+	t := &mockTimer{ch: make(chan time.Time, 1)}
+	m.add(t, d)
+	return t.ch
+}
+
+// AfterFunc calls f in its own goroutine once the clock advanced by d.
+func (m *MockClock) AfterFunc(d time.Duration, f func()) Timer {
+	t := &mockTimer{fn: f}
+	m.add(t, d)
+	return t
+}
+
+// Sleep blocks until the clock advanced by d.
+func (m *MockClock) Sleep(d time.Duration) {
+	<-m.After(d)
+}
+
+// Advance moves the clock forward by d and fires all the timers that
+// expire on the way.
+func (m *MockClock) Advance(d time.Duration) {
+	m.Lock()
+	m.now = m.now.Add(d)
+	var fire []*mockTimer
+	waiting := m.waiters[:0]
+	for _, t := range m.waiters {
+		if t.when.After(m.now) {
+			waiting = append(waiting, t)
+		} else {
+			fire = append(fire, t)
+		}
+	}
+	m.waiters = waiting
+	now := m.now
+	m.changed.Broadcast()
+	m.Unlock()
+	sort.SliceStable(fire, func(i, j int) bool {
+		return fire[i].when.Before(fire[j].when)
+	})
+	for _, t := range fire {
+		t.fire(now)
+	}
+}
+
+// Waiters returns the number of timers and sleepers waiting for the clock.
+func (m *MockClock) Waiters() int {
+	m.Lock()
+	defer m.Unlock()
+	return len(m.waiters)
+}
+
+// WaitForWaiters blocks until at least n timers or sleepers wait for the
+// clock, so that a test knows that the code it tests reached its timeout
+// before calling Advance.
+func (m *MockClock) WaitForWaiters(n int) {
+	m.Lock()
+	defer m.Unlock()
+	for len(m.waiters) < n {
+		m.changed.Wait()
+	}
+}
+
+func (m *MockClock) add(t *mockTimer, d time.Duration) {
+	m.Lock()
+	t.clock = m
+	t.when = m.now.Add(d)
+	if d <= 0 {
+		now := m.now
+		m.Unlock()
+		t.fire(now)
+		return
+	}
+	m.waiters = append(m.waiters, t)
+	m.changed.Broadcast()
+	m.Unlock()
+}
+
+func (t *mockTimer) fire(now time.Time) {
+	if t.fn != nil {
+		go t.fn()
+	} else {
+		t.ch <- now
+	}
+}
+
+// Stop removes the timer from the clock.
+func (t *mockTimer) Stop() bool {
+	m := t.clock
+	m.Lock()
+	defer m.Unlock()
+	for i, w := range m.waiters {
+		if w == t {
+			m.waiters = append(m.waiters[:i], m.waiters[i+1:]...)
+			m.changed.Broadcast()
+			return true
+		}
+	}
+	return false
+}
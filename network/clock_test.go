@@ -0,0 +1,51 @@
+package network
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMockClock(t *testing.T) {
+	start := time.Unix(1000, 0)
+	c := NewMockClock(start)
+	require.Equal(t, start, c.Now())
+
+	after := c.After(time.Second)
+	called := make(chan bool, 1)
+	c.AfterFunc(2*time.Second, func() { called <- true })
+	stopped := c.AfterFunc(time.Second, func() { t.Error("stopped timer called") })
+	require.Equal(t, 3, c.Waiters())
+	require.True(t, stopped.Stop())
+	require.False(t, stopped.Stop())
+
+	c.Advance(500 * time.Millisecond)
+	select {
+	case <-after:
+		t.Fatal("fired too early")
+	default:
+	}
+	c.Advance(500 * time.Millisecond)
+	require.Equal(t, start.Add(time.Second), <-after)
+	require.Equal(t, 1, c.Waiters())
+
+	c.Advance(time.Second)
+	<-called
+	require.Equal(t, 0, c.Waiters())
+
+	slept := make(chan bool)
+	go func() {
+		c.Sleep(time.Minute)
+		close(slept)
+	}()
+	c.WaitForWaiters(1)
+	c.Advance(time.Minute)
+	<-slept
+
+	select {
+	case <-c.After(0):
+	default:
+		t.Fatal("zero duration should fire right away")
+	}
+}
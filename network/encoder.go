@@ -0,0 +1,64 @@
+package network
+
+import (
+	"fmt"
+
+	"github.com/dedis/protobuf"
+)
+
+// Encoder serializes the body of a registered message. The type of the
+// message is always written before the body by Marshal, so the encoders
+// only need to handle the message itself.
+type Encoder interface {
+	// Encode returns the serialized form of msg.
+	Encode(msg Message) ([]byte, error)
+	// Decode fills msg, a pointer to the registered type, from buf. The
+	// suite is used to create the points and scalars of the message.
+	Decode(buf []byte, msg Message, suite Suite) error
+}
+
+// reflectEncoder is the default encoder. It uses github.com/dedis/protobuf,
+// which derives the protobuf encoding from the go structure by reflection.
+type reflectEncoder struct{}
+
+func (reflectEncoder) Encode(msg Message) ([]byte, error) {
+	return protobuf.Encode(msg)
+}
+
+func (reflectEncoder) Decode(buf []byte, msg Message, suite Suite) error {
+	return protobuf.DecodeWithConstructors(buf, msg, DefaultConstructors(suite))
+}
+
+// ProtoMessage is implemented by messages generated by protoc with the
+// gogo/protobuf marshaler plugins. Their encoding is defined by a .proto
+// file instead of the go structure, which makes it readable by other
+// languages and stable across refactorings of the go code.
+type ProtoMessage interface {
+	Marshal() ([]byte, error)
+	Unmarshal([]byte) error
+}
+
+// ProtoEncoder serializes messages implementing ProtoMessage with their
+// generated code. Register a message with
+//	network.RegisterMessageEncoder(&MyProto{}, network.ProtoEncoder{})
+// to use it. Points and scalars have to be stored as bytes in such messages,
+// so the suite is not used.
+type ProtoEncoder struct{}
+
+// Encode implements the Encoder interface.
+func (ProtoEncoder) Encode(msg Message) ([]byte, error) {
+	pm, ok := msg.(ProtoMessage)
+	if !ok {
+		return nil, fmt.Errorf("%T doesn't implement ProtoMessage", msg)
+	}
+	return pm.Marshal()
+}
+
+// Decode implements the Encoder interface.
+func (ProtoEncoder) Decode(buf []byte, msg Message, suite Suite) error {
+	pm, ok := msg.(ProtoMessage)
+	if !ok {
+		return fmt.Errorf("%T doesn't implement ProtoMessage", msg)
+	}
+	return pm.Unmarshal(buf)
+}
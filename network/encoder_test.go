@@ -0,0 +1,50 @@
+package network
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// protoCounter mimics a message generated by protoc for
+//	message protoCounter { uint64 count = 1; }
+type protoCounter struct {
+	Count uint64
+}
+
+func (p *protoCounter) Marshal() ([]byte, error) {
+	buf := make([]byte, 1+binary.MaxVarintLen64)
+	buf[0] = 1<<3 | 0
+	n := binary.PutUvarint(buf[1:], p.Count)
+	return buf[:1+n], nil
+}
+
+func (p *protoCounter) Unmarshal(buf []byte) error {
+	if len(buf) < 2 || buf[0] != 1<<3|0 {
+		return errors.New("wrong field")
+	}
+	c, n := binary.Uvarint(buf[1:])
+	if n <= 0 {
+		return errors.New("wrong varint")
+	}
+	p.Count = c
+	return nil
+}
+
+func TestProtoEncoder(t *testing.T) {
+	typ := RegisterMessageEncoder(&protoCounter{}, ProtoEncoder{})
+	buf, err := Marshal(&protoCounter{Count: 300})
+	require.Nil(t, err)
+	// After the type comes the canonical protobuf encoding.
+	require.Equal(t, []byte{0x08, 0xac, 0x02}, buf[16:])
+
+	mt, msg, err := Unmarshal(buf, tSuite)
+	require.Nil(t, err)
+	require.Equal(t, typ, mt)
+	require.Equal(t, uint64(300), msg.(*protoCounter).Count)
+
+	_, err = ProtoEncoder{}.Encode(&SimpleMessage{3})
+	require.NotNil(t, err)
+}
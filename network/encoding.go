@@ -66,13 +66,23 @@ var globalOrder = binary.BigEndian
 // corresponding MessageTypeID. Once a struct is registered, it can be sent and
 // received by the network library.
 func RegisterMessage(msg Message) MessageTypeID {
+	return RegisterMessageEncoder(msg, nil)
+}
+
+// RegisterMessageEncoder registers msg like RegisterMessage, but its body
+// will be serialized by enc. If enc is nil, the default reflection-based
+// encoding is used.
+func RegisterMessageEncoder(msg Message, enc Encoder) MessageTypeID {
 	msgType := computeMessageType(msg)
 	val := reflect.ValueOf(msg)
 	if val.Kind() == reflect.Ptr {
 		val = val.Elem()
 	}
 	t := val.Type()
-	registry.put(msgType, t)
+	if enc == nil {
+		enc = reflectEncoder{}
+	}
+	registry.put(msgType, t, enc)
 	return msgType
 }
 
@@ -124,7 +134,7 @@ func Marshal(msg Message) ([]byte, error) {
 	}
 	var buf []byte
 	var err error
-	if buf, err = protobuf.Encode(msg); err != nil {
+	if buf, err = registry.encoder(msgType).Encode(msg); err != nil {
 		log.Errorf("Error for protobuf encoding: %s %+v", err, msg)
 		if log.DebugVisible() > 0 {
 			log.Error(log.Stack())
@@ -152,8 +162,7 @@ func Unmarshal(buf []byte, suite Suite) (MessageTypeID, Message, error) {
 	}
 	ptrVal := reflect.New(typ)
 	ptr := ptrVal.Interface()
-	constructors := DefaultConstructors(suite)
-	if err := protobuf.DecodeWithConstructors(b.Bytes(), ptr, constructors); err != nil {
+	if err := registry.encoder(tID).Decode(b.Bytes(), ptr, suite); err != nil {
 		return ErrorType, nil, err
 	}
 	return tID, ptrVal.Interface(), nil
@@ -181,14 +190,16 @@ func DefaultConstructors(suite Suite) protobuf.Constructors {
 var registry = newTypeRegistry()
 
 type typeRegistry struct {
-	types map[MessageTypeID]reflect.Type
-	lock  sync.Mutex
+	types    map[MessageTypeID]reflect.Type
+	encoders map[MessageTypeID]Encoder
+	lock     sync.Mutex
 }
 
 func newTypeRegistry() *typeRegistry {
 	return &typeRegistry{
-		types: make(map[MessageTypeID]reflect.Type),
-		lock:  sync.Mutex{},
+		types:    make(map[MessageTypeID]reflect.Type),
+		encoders: make(map[MessageTypeID]Encoder),
+		lock:     sync.Mutex{},
 	}
 }
 
@@ -201,9 +212,21 @@ func (tr *typeRegistry) get(mid MessageTypeID) (reflect.Type, bool) {
 	return t, ok
 }
 
-// put stores the given type in the typeRegistry.
-func (tr *typeRegistry) put(mid MessageTypeID, typ reflect.Type) {
+// encoder returns the Encoder of the registered PacketTypeID, or the
+// default one if it is not registered.
+func (tr *typeRegistry) encoder(mid MessageTypeID) Encoder {
+	tr.lock.Lock()
+	defer tr.lock.Unlock()
+	if enc, ok := tr.encoders[mid]; ok {
+		return enc
+	}
+	return reflectEncoder{}
+}
+
+// put stores the given type and its encoder in the typeRegistry.
+func (tr *typeRegistry) put(mid MessageTypeID, typ reflect.Type, enc Encoder) {
 	tr.lock.Lock()
 	defer tr.lock.Unlock()
 	tr.types[mid] = typ
+	tr.encoders[mid] = enc
 }
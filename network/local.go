@@ -45,6 +45,50 @@ type LocalManager struct {
 	stopped  bool
 	// a waitgroup to check that all serving goroutines are done
 	wg sync.WaitGroup
+	// faults decides the fate of the messages, see SetFaults.
+	faults func(from, to Address, msg Message) Fault
+	// clock delays the messages, see SetClock.
+	clock Clock
+}
+
+// Fault tells the LocalManager what to do with a message, see SetFaults.
+type Fault struct {
+	// Drop loses the message, or refuses the connection.
+	Drop bool
+	// Delay delivers the message after this duration.
+	Delay time.Duration
+}
+
+// SetFaults sets the function deciding what happens to every message sent
+// from one address to another. It is also called with a nil message when a
+// connection is set up, which is refused if the message would be dropped.
+// A nil function delivers all messages right away.
+func (lm *LocalManager) SetFaults(fn func(from, to Address, msg Message) Fault) {
+	lm.Lock()
+	defer lm.Unlock()
+	lm.faults = fn
+}
+
+// SetClock sets the clock used for the delays given by SetFaults.
+func (lm *LocalManager) SetClock(c Clock) {
+	lm.Lock()
+	defer lm.Unlock()
+	lm.clock = c
+}
+
+// fault returns what to do with the message, and the clock to use for the
+// delay.
+func (lm *LocalManager) fault(from, to Address, msg Message) (Fault, Clock) {
+	lm.Lock()
+	fn, clock := lm.faults, lm.clock
+	lm.Unlock()
+	if clock == nil {
+		clock = RealClock
+	}
+	if fn == nil {
+		return Fault{}, clock
+	}
+	return fn(from, to, msg), clock
 }
 
 // NewLocalManager returns a fresh new manager that can be used by LocalConn,
@@ -105,6 +149,9 @@ func (lm *LocalManager) unsetListening(addr Address) {
 // the two connections, and launches the listening function in a go routine.
 // It returns the outgoing connection, or nil followed by an error, if any.
 func (lm *LocalManager) connect(local, remote Address, s Suite) (*LocalConn, error) {
+	if f, _ := lm.fault(local, remote, nil); f.Drop {
+		return nil, fmt.Errorf("%s can't connect to %s: unreachable", local, remote)
+	}
 	lm.Lock()
 	defer lm.Unlock()
 	if lm.stopped {
@@ -277,6 +324,16 @@ func (lc *LocalConn) Send(msg Message) (uint64, error) {
 	}
 	sentLen := uint64(len(buff))
 	lc.updateTx(sentLen)
+	f, clock := lc.manager.fault(lc.local.addr, lc.remote.addr, msg)
+	switch {
+	case f.Drop:
+		return sentLen, nil
+	case f.Delay > 0:
+		clock.AfterFunc(f.Delay, func() {
+			lc.manager.send(lc.remote, buff)
+		})
+		return sentLen, nil
+	}
 	return sentLen, lc.manager.send(lc.remote, buff)
 }
 
@@ -294,6 +351,7 @@ func (lc *LocalConn) Receive() (*Envelope, error) {
 	return &Envelope{
 		MsgType: id,
 		Msg:     body,
+		Size:    Size(len(buff)),
 	}, err
 }
 
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestLocalRouter(t *testing.T) {
@@ -365,3 +366,68 @@ type AddressTest struct {
 }
 
 var AddressTestType = RegisterMessage(&AddressTest{})
+
+func TestLocalManager_Faults(t *testing.T) {
+	lm := NewLocalManager()
+	defer lm.Stop()
+	clock := NewMockClock(time.Now())
+	lm.SetClock(clock)
+	addr1 := NewLocalAddress("127.0.0.1:2000")
+	addr2 := NewLocalAddress("127.0.0.1:2001")
+	listener, err := NewLocalListenerWithManager(lm, addr1, tSuite)
+	require.Nil(t, err)
+	incoming := make(chan Conn, 1)
+	go listener.Listen(func(c Conn) { incoming <- c })
+	defer listener.Stop()
+	for !listener.Listening() {
+		time.Sleep(time.Millisecond)
+	}
+
+	var fault Fault
+	var faultLock sync.Mutex
+	lm.SetFaults(func(from, to Address, msg Message) Fault {
+		faultLock.Lock()
+		defer faultLock.Unlock()
+		if msg == nil {
+			return Fault{Drop: fault.Drop}
+		}
+		if MessageType(msg) != basicMessageType {
+			return Fault{}
+		}
+		return fault
+	})
+	setFault := func(f Fault) {
+		faultLock.Lock()
+		fault = f
+		faultLock.Unlock()
+	}
+
+	setFault(Fault{Drop: true})
+	_, err = NewLocalConnWithManager(lm, addr2, addr1, tSuite)
+	require.NotNil(t, err)
+
+	setFault(Fault{})
+	out, err := NewLocalConnWithManager(lm, addr2, addr1, tSuite)
+	require.Nil(t, err)
+	in := <-incoming
+
+	// A dropped message is reported as sent, but never arrives.
+	setFault(Fault{Drop: true})
+	_, err = out.Send(&basicMessage{1})
+	require.Nil(t, err)
+	setFault(Fault{Delay: time.Second})
+	_, err = out.Send(&basicMessage{2})
+	require.Nil(t, err)
+	clock.WaitForWaiters(1)
+	setFault(Fault{})
+	_, err = out.Send(&basicMessage{3})
+	require.Nil(t, err)
+	env, err := in.Receive()
+	require.Nil(t, err)
+	require.Equal(t, 3, env.Msg.(*basicMessage).Value)
+
+	clock.Advance(time.Second)
+	env, err = in.Receive()
+	require.Nil(t, err)
+	require.Equal(t, 2, env.Msg.(*basicMessage).Value)
+}
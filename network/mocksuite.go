@@ -0,0 +1,336 @@
+package network
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/dedis/kyber"
+	"github.com/dedis/kyber/util/random"
+)
+
+// mockOrder is the order of the group of MockSuite, the Mersenne prime
+// 2^61-1.
+const mockOrder = uint64(1)<<61 - 1
+
+var mockOrderBig = new(big.Int).SetUint64(mockOrder)
+
+// mockLen is the length of the marshalled scalars and points.
+const mockLen = 8
+
+// MockSuite is a Suite whose operations cost next to nothing: scalars and
+// points are integers modulo a 61-bit prime, and a point is its own discrete
+// logarithm. Signatures and key exchanges still work, but are not secure at
+// all. It replaces the real suite in tests that don't exercise the
+// cryptography, for example with onet.NewLocalTest(network.NewMockSuite()).
+type MockSuite struct{}
+
+// NewMockSuite returns a MockSuite.
+func NewMockSuite() *MockSuite {
+	return &MockSuite{}
+}
+
+// String returns the name of the suite.
+func (s *MockSuite) String() string {
+	return "Mock"
+}
+
+// ScalarLen returns the length of a marshalled scalar.
+func (s *MockSuite) ScalarLen() int {
+	return mockLen
+}
+
+// Scalar returns a new scalar set to 0.
+func (s *MockSuite) Scalar() kyber.Scalar {
+	return &mockScalar{}
+}
+
+// PointLen returns the length of a marshalled point.
+func (s *MockSuite) PointLen() int {
+	return mockLen
+}
+
+// Point returns a new point set to the neutral element.
+func (s *MockSuite) Point() kyber.Point {
+	return &mockPoint{}
+}
+
+// RandomStream returns a stream from the random source of the system.
+func (s *MockSuite) RandomStream() cipher.Stream {
+	return random.New()
+}
+
+func mockAdd(a, b uint64) uint64 {
+	return (a + b) % mockOrder
+}
+
+func mockNeg(a uint64) uint64 {
+	return (mockOrder - a) % mockOrder
+}
+
+func mockMul(a, b uint64) uint64 {
+	r := new(big.Int).Mul(new(big.Int).SetUint64(a), new(big.Int).SetUint64(b))
+	return r.Mod(r, mockOrderBig).Uint64()
+}
+
+func mockInv(a uint64) uint64 {
+	r := new(big.Int).ModInverse(new(big.Int).SetUint64(a), mockOrderBig)
+	if r == nil {
+		return 0
+	}
+	return r.Uint64()
+}
+
+func mockPick(rand cipher.Stream) uint64 {
+	return random.Int(mockOrderBig, rand).Uint64()
+}
+
+func mockMarshal(v uint64) []byte {
+	buf := make([]byte, mockLen)
+	binary.BigEndian.PutUint64(buf, v)
+	return buf
+}
+
+func mockUnmarshal(buf []byte) (uint64, error) {
+	if len(buf) != mockLen {
+		return 0, errors.New("wrong length of mock value")
+	}
+	v := binary.BigEndian.Uint64(buf)
+	if v >= mockOrder {
+		return 0, errors.New("mock value out of range")
+	}
+	return v, nil
+}
+
+func mockUnmarshalFrom(r io.Reader) (uint64, int, error) {
+	buf := make([]byte, mockLen)
+	n, err := io.ReadFull(r, buf)
+	if err != nil {
+		return 0, n, err
+	}
+	v, err := mockUnmarshal(buf)
+	return v, n, err
+}
+
+// mockScalar is a scalar of MockSuite.
+type mockScalar struct {
+	v uint64
+}
+
+func (s *mockScalar) MarshalBinary() ([]byte, error) {
+	return mockMarshal(s.v), nil
+}
+
+func (s *mockScalar) UnmarshalBinary(buf []byte) error {
+	v, err := mockUnmarshal(buf)
+	if err != nil {
+		return err
+	}
+	s.v = v
+	return nil
+}
+
+func (s *mockScalar) String() string {
+	return fmt.Sprintf("%016x", s.v)
+}
+
+func (s *mockScalar) MarshalSize() int {
+	return mockLen
+}
+
+func (s *mockScalar) MarshalTo(w io.Writer) (int, error) {
+	return w.Write(mockMarshal(s.v))
+}
+
+func (s *mockScalar) UnmarshalFrom(r io.Reader) (int, error) {
+	v, n, err := mockUnmarshalFrom(r)
+	if err == nil {
+		s.v = v
+	}
+	return n, err
+}
+
+func (s *mockScalar) Equal(s2 kyber.Scalar) bool {
+	return s.v == s2.(*mockScalar).v
+}
+
+func (s *mockScalar) Set(a kyber.Scalar) kyber.Scalar {
+	s.v = a.(*mockScalar).v
+	return s
+}
+
+func (s *mockScalar) Clone() kyber.Scalar {
+	return &mockScalar{s.v}
+}
+
+func (s *mockScalar) SetInt64(v int64) kyber.Scalar {
+	if v < 0 {
+		s.v = mockNeg(uint64(-v) % mockOrder)
+	} else {
+		s.v = uint64(v) % mockOrder
+	}
+	return s
+}
+
+func (s *mockScalar) Zero() kyber.Scalar {
+	s.v = 0
+	return s
+}
+
+func (s *mockScalar) Add(a, b kyber.Scalar) kyber.Scalar {
+	s.v = mockAdd(a.(*mockScalar).v, b.(*mockScalar).v)
+	return s
+}
+
+func (s *mockScalar) Sub(a, b kyber.Scalar) kyber.Scalar {
+	s.v = mockAdd(a.(*mockScalar).v, mockNeg(b.(*mockScalar).v))
+	return s
+}
+
+func (s *mockScalar) Neg(a kyber.Scalar) kyber.Scalar {
+	s.v = mockNeg(a.(*mockScalar).v)
+	return s
+}
+
+func (s *mockScalar) One() kyber.Scalar {
+	s.v = 1
+	return s
+}
+
+func (s *mockScalar) Mul(a, b kyber.Scalar) kyber.Scalar {
+	s.v = mockMul(a.(*mockScalar).v, b.(*mockScalar).v)
+	return s
+}
+
+func (s *mockScalar) Div(a, b kyber.Scalar) kyber.Scalar {
+	s.v = mockMul(a.(*mockScalar).v, mockInv(b.(*mockScalar).v))
+	return s
+}
+
+func (s *mockScalar) Inv(a kyber.Scalar) kyber.Scalar {
+	s.v = mockInv(a.(*mockScalar).v)
+	return s
+}
+
+func (s *mockScalar) Pick(rand cipher.Stream) kyber.Scalar {
+	s.v = mockPick(rand)
+	return s
+}
+
+// SetBytes sets the scalar to the big-endian integer in buf, modulo the
+// order of the group.
+func (s *mockScalar) SetBytes(buf []byte) kyber.Scalar {
+	r := new(big.Int).SetBytes(buf)
+	s.v = r.Mod(r, mockOrderBig).Uint64()
+	return s
+}
+
+// mockPoint is a point of MockSuite. The base point is 1, so the point
+// s*B is s itself.
+type mockPoint struct {
+	v uint64
+}
+
+func (p *mockPoint) MarshalBinary() ([]byte, error) {
+	return mockMarshal(p.v), nil
+}
+
+func (p *mockPoint) UnmarshalBinary(buf []byte) error {
+	v, err := mockUnmarshal(buf)
+	if err != nil {
+		return err
+	}
+	p.v = v
+	return nil
+}
+
+func (p *mockPoint) String() string {
+	return fmt.Sprintf("%016x", p.v)
+}
+
+func (p *mockPoint) MarshalSize() int {
+	return mockLen
+}
+
+func (p *mockPoint) MarshalTo(w io.Writer) (int, error) {
+	return w.Write(mockMarshal(p.v))
+}
+
+func (p *mockPoint) UnmarshalFrom(r io.Reader) (int, error) {
+	v, n, err := mockUnmarshalFrom(r)
+	if err == nil {
+		p.v = v
+	}
+	return n, err
+}
+
+func (p *mockPoint) Equal(p2 kyber.Point) bool {
+	return p.v == p2.(*mockPoint).v
+}
+
+func (p *mockPoint) Null() kyber.Point {
+	p.v = 0
+	return p
+}
+
+func (p *mockPoint) Base() kyber.Point {
+	p.v = 1
+	return p
+}
+
+func (p *mockPoint) Pick(rand cipher.Stream) kyber.Point {
+	p.v = mockPick(rand)
+	return p
+}
+
+func (p *mockPoint) Set(a kyber.Point) kyber.Point {
+	p.v = a.(*mockPoint).v
+	return p
+}
+
+func (p *mockPoint) Clone() kyber.Point {
+	return &mockPoint{p.v}
+}
+
+// EmbedLen returns 0, as no data can be embedded in a point.
+func (p *mockPoint) EmbedLen() int {
+	return 0
+}
+
+// Embed ignores data and picks a random point.
+func (p *mockPoint) Embed(data []byte, rand cipher.Stream) kyber.Point {
+	return p.Pick(rand)
+}
+
+// Data returns no data, as none can be embedded.
+func (p *mockPoint) Data() ([]byte, error) {
+	return nil, nil
+}
+
+func (p *mockPoint) Add(a, b kyber.Point) kyber.Point {
+	p.v = mockAdd(a.(*mockPoint).v, b.(*mockPoint).v)
+	return p
+}
+
+func (p *mockPoint) Sub(a, b kyber.Point) kyber.Point {
+	p.v = mockAdd(a.(*mockPoint).v, mockNeg(b.(*mockPoint).v))
+	return p
+}
+
+func (p *mockPoint) Neg(a kyber.Point) kyber.Point {
+	p.v = mockNeg(a.(*mockPoint).v)
+	return p
+}
+
+// Mul sets the point to s*a, or to s*B if a is nil.
+func (p *mockPoint) Mul(s kyber.Scalar, a kyber.Point) kyber.Point {
+	base := uint64(1)
+	if a != nil {
+		base = a.(*mockPoint).v
+	}
+	p.v = mockMul(s.(*mockScalar).v, base)
+	return p
+}
@@ -0,0 +1,58 @@
+package network
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dedis/kyber/sign/schnorr"
+	"github.com/dedis/kyber/util/key"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMockSuite_Arithmetic(t *testing.T) {
+	s := NewMockSuite()
+	a := s.Scalar().Pick(s.RandomStream())
+	b := s.Scalar().SetInt64(-3)
+	require.True(t, s.Scalar().Add(b, s.Scalar().SetInt64(3)).Equal(s.Scalar().Zero()))
+	require.True(t, s.Scalar().Mul(s.Scalar().Div(a, b), b).Equal(a))
+	require.True(t, s.Scalar().Mul(a, s.Scalar().Inv(a)).Equal(s.Scalar().One()))
+
+	// (a+b)*B == a*B + b*B
+	sum := s.Point().Mul(s.Scalar().Add(a, b), nil)
+	require.True(t, sum.Equal(s.Point().Add(s.Point().Mul(a, nil), s.Point().Mul(b, nil))))
+	require.True(t, s.Point().Sub(sum, sum).Equal(s.Point().Null()))
+	require.True(t, s.Point().Mul(a, s.Point().Base()).Equal(s.Point().Mul(a, nil)))
+}
+
+func TestMockSuite_Marshal(t *testing.T) {
+	s := NewMockSuite()
+	p := s.Point().Pick(s.RandomStream())
+	buf, err := p.MarshalBinary()
+	require.Nil(t, err)
+	require.Equal(t, s.PointLen(), len(buf))
+	p2 := s.Point()
+	require.Nil(t, p2.UnmarshalBinary(buf))
+	require.True(t, p.Equal(p2))
+	require.NotNil(t, p2.UnmarshalBinary(buf[1:]))
+	require.NotNil(t, p2.UnmarshalBinary(bytes.Repeat([]byte{0xff}, 8)))
+
+	sc := s.Scalar().Pick(s.RandomStream())
+	var b bytes.Buffer
+	n, err := sc.MarshalTo(&b)
+	require.Nil(t, err)
+	require.Equal(t, s.ScalarLen(), n)
+	sc2 := s.Scalar()
+	_, err = sc2.UnmarshalFrom(&b)
+	require.Nil(t, err)
+	require.True(t, sc.Equal(sc2))
+}
+
+func TestMockSuite_Schnorr(t *testing.T) {
+	s := NewMockSuite()
+	kp := key.NewKeyPair(s)
+	msg := []byte("mock")
+	sig, err := schnorr.Sign(s, kp.Private, msg)
+	require.Nil(t, err)
+	require.Nil(t, schnorr.Verify(s, kp.Public, msg, sig))
+	require.NotNil(t, schnorr.Verify(s, kp.Public, []byte("other"), sig))
+}
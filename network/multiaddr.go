@@ -0,0 +1,132 @@
+package network
+
+import (
+	"errors"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dedis/onet/log"
+)
+
+// unreachableLatency is the latency recorded for an address that couldn't be
+// connected to, so that it is tried last the next time.
+const unreachableLatency = time.Duration(1<<63 - 1)
+
+var lookupSRV = net.LookupSRV
+
+// Addresses returns all the addresses of the server: Address, then
+// AltAddresses, then the targets of the SRV record, ordered by priority and
+// weight. The targets of the SRV record have the connection type of Address,
+// or TLS if Address is not set. Invalid addresses are left out.
+func (si *ServerIdentity) Addresses() []Address {
+	var addrs []Address
+	add := func(a Address) {
+		if !a.Valid() {
+			return
+		}
+		for _, b := range addrs {
+			if a == b {
+				return
+			}
+		}
+		addrs = append(addrs, a)
+	}
+	add(si.Address)
+	for _, a := range si.AltAddresses {
+		add(a)
+	}
+	if si.SRV != "" {
+		ct := si.Address.ConnType()
+		if ct == InvalidConnType {
+			ct = TLS
+		}
+		_, srvs, err := lookupSRV("", "", si.SRV)
+		if err != nil {
+			log.Lvl2("Couldn't look up", si.SRV, ":", err)
+		}
+		for _, srv := range srvs {
+			host := strings.TrimSuffix(srv.Target, ".")
+			add(NewHostPortAddress(ct, host, strconv.Itoa(int(srv.Port))))
+		}
+	}
+	return addrs
+}
+
+// connectAddresses connects to the first address of si that answers. If si
+// has more than one address, the addresses are tried from the fastest one to
+// connect to the last time, followed by the ones never tried in their
+// order, and the unreachable ones last.
+func (r *Router) connectAddresses(si *ServerIdentity) (Conn, error) {
+	addrs := si.Addresses()
+	if len(addrs) <= 1 {
+		log.Lvl3(r.address, "Connecting to", si.Address)
+		c, err := r.host.Connect(si)
+		if err != nil {
+			log.Lvl3("Could not connect to", si.Address, err)
+			return nil, err
+		}
+		log.Lvl3(r.address, "Connected to", si.Address)
+		return c, nil
+	}
+
+	r.sortAddresses(addrs)
+	var errs []string
+	for _, a := range addrs {
+		log.Lvl3(r.address, "Connecting to", si, "at", a)
+		other := *si
+		other.Address = a
+		start := time.Now()
+		c, err := r.host.Connect(&other)
+		if err != nil {
+			log.Lvl3("Could not connect to", a, err)
+			r.setLatency(a, unreachableLatency)
+			errs = append(errs, a.String()+": "+err.Error())
+			continue
+		}
+		r.setLatency(a, time.Since(start))
+		log.Lvl3(r.address, "Connected to", si, "at", a)
+		return c, nil
+	}
+	return nil, errors.New("couldn't connect to any address: " +
+		strings.Join(errs, ", "))
+}
+
+// sortAddresses sorts the addresses by the latencies measured before. The
+// addresses without latency keep their order, after the ones that could be
+// reached.
+func (r *Router) sortAddresses(addrs []Address) {
+	r.Lock()
+	defer r.Unlock()
+	latency := func(a Address) time.Duration {
+		if l, ok := r.latencies[a]; ok {
+			return l
+		}
+		// after all the reachable addresses, before the unreachable ones
+		return unreachableLatency - 1
+	}
+	sort.SliceStable(addrs, func(i, j int) bool {
+		return latency(addrs[i]) < latency(addrs[j])
+	})
+}
+
+func (r *Router) setLatency(a Address, l time.Duration) {
+	r.Lock()
+	defer r.Unlock()
+	if r.latencies == nil {
+		r.latencies = make(map[Address]time.Duration)
+	}
+	r.latencies[a] = l
+}
+
+// Latency returns the time it took to connect to the address the last time,
+// and false if the router didn't connect to it yet or couldn't. Only the
+// addresses of servers with more than one address are measured.
+func (r *Router) Latency(a Address) (time.Duration, bool) {
+	r.Lock()
+	defer r.Unlock()
+	l, ok := r.latencies[a]
+	return l, ok && l != unreachableLatency
+}
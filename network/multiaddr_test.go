@@ -0,0 +1,77 @@
+package network
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerIdentity_Addresses(t *testing.T) {
+	defer func() { lookupSRV = net.LookupSRV }()
+	lookupSRV = func(service, proto, name string) (string, []*net.SRV, error) {
+		if name != "_conode._tcp.example.org" {
+			return "", nil, errors.New("no such name")
+		}
+		return name, []*net.SRV{
+			{Target: "conode1.example.org.", Port: 7770},
+			{Target: "10.0.0.1", Port: 7770},
+		}, nil
+	}
+
+	si := NewTestServerIdentity(NewAddress(TLS, "10.0.0.1:7770"))
+	require.Equal(t, []Address{"tls://10.0.0.1:7770"}, si.Addresses())
+
+	si.AltAddresses = []Address{"tls://[2001:db8::1]:7770", "invalid", "tls://10.0.0.1:7770"}
+	si.SRV = "_conode._tcp.example.org"
+	require.Equal(t, []Address{"tls://10.0.0.1:7770", "tls://[2001:db8::1]:7770",
+		"tls://conode1.example.org:7770"}, si.Addresses())
+
+	si = &ServerIdentity{SRV: "_conode._tcp.example.org"}
+	require.Equal(t, []Address{"tls://conode1.example.org:7770",
+		"tls://10.0.0.1:7770"}, si.Addresses())
+
+	si.SRV = "unknown.example.org"
+	require.Equal(t, 0, len(si.Addresses()))
+}
+
+func TestRouter_connectAddresses(t *testing.T) {
+	h1, err := NewTestRouterTCP(0)
+	require.Nil(t, err)
+	h2, err := NewTestRouterTCP(0)
+	require.Nil(t, err)
+	go h2.Start()
+	defer h1.Stop()
+	defer h2.Stop()
+
+	// an address nobody listens on
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	closed := NewAddress(PlainTCP, l.Addr().String())
+	l.Close()
+
+	si := *h2.ServerIdentity
+	si.Address = closed
+	si.AltAddresses = []Address{h2.ServerIdentity.Address}
+	c, err := h1.connectAddresses(&si)
+	require.Nil(t, err)
+	c.Close()
+	_, ok := h1.Latency(closed)
+	require.False(t, ok)
+	_, ok = h1.Latency(h2.ServerIdentity.Address)
+	require.True(t, ok)
+
+	// the reachable address is tried first now
+	addrs := si.Addresses()
+	h1.sortAddresses(addrs)
+	require.Equal(t, []Address{h2.ServerIdentity.Address, closed}, addrs)
+
+	si.AltAddresses = nil
+	_, err = h1.connectAddresses(&si)
+	require.NotNil(t, err)
+	si.AltAddresses = []Address{closed}
+	si.Address = NewAddress(PlainTCP, "127.0.0.1:1")
+	_, err = h1.connectAddresses(&si)
+	require.NotNil(t, err)
+}
@@ -0,0 +1,294 @@
+package network
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/dedis/onet/log"
+)
+
+// ALPNProto is the application protocol the TLS connections between
+// servers announce, so that a Mux can tell them from the TLS connections of
+// the websocket clients.
+const ALPNProto = "onet"
+
+// MuxSniffTimeout is how long a Mux waits for the first bytes of a
+// connection to decide where it goes.
+var MuxSniffTimeout = 5 * time.Second
+
+// maxTLSRecord is the biggest TLS record a MatchALPN reads.
+const maxTLSRecord = 16384 + 2048
+
+// ErrMuxClosed is returned by the Accept of the listeners of a closed Mux,
+// or of a closed listener of a Mux.
+var ErrMuxClosed = errors.New("mux listener closed")
+
+// MuxMatcher tells from the first bytes of a connection whether it is for a
+// listener of a Mux. It must only Peek at r, and gets what is available
+// after MuxSniffTimeout if the client sends less.
+type MuxMatcher func(r *bufio.Reader) bool
+
+// Mux shares one listener between several protocols, for example the
+// connections between servers and the websocket, when only one port is
+// open. Every accepted connection goes to the first listener whose matcher
+// accepts its first bytes, all protocols must thus be ones where the client
+// speaks first.
+type Mux struct {
+	root      net.Listener
+	listeners []*muxListener
+	closed    bool
+	sync.Mutex
+}
+
+// NewMux returns a Mux sharing ln. It only accepts connections once Serve
+// is called.
+func NewMux(ln net.Listener) *Mux {
+	return &Mux{root: ln}
+}
+
+// ListenMux returns a Mux listening on the TCP address addr, or on the
+// socket systemd passed for it.
+func ListenMux(addr string) (*Mux, error) {
+	ln := ActivatedListener(addr)
+	if ln == nil {
+		var err error
+		ln, err = net.Listen("tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return NewMux(ln), nil
+}
+
+// Listener returns a listener getting the connections that match and no
+// listener added before. It must be called before Serve.
+func (m *Mux) Listener(match MuxMatcher) net.Listener {
+	m.Lock()
+	defer m.Unlock()
+	l := &muxListener{
+		mux:   m,
+		match: match,
+		conns: make(chan net.Conn),
+		quit:  make(chan struct{}),
+	}
+	m.listeners = append(m.listeners, l)
+	return l
+}
+
+// Addr returns the address of the shared listener.
+func (m *Mux) Addr() net.Addr {
+	return m.root.Addr()
+}
+
+// Serve accepts the connections and hands them to the listeners until the
+// Mux is closed.
+func (m *Mux) Serve() error {
+	for {
+		c, err := m.root.Accept()
+		if err != nil {
+			m.Lock()
+			closed := m.closed
+			m.Unlock()
+			if closed {
+				return nil
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(WaitRetry)
+				continue
+			}
+			return err
+		}
+		go m.route(c)
+	}
+}
+
+// route sniffs the first bytes of c and gives it to the first listener
+// that matches.
+func (m *Mux) route(c net.Conn) {
+	mc := &muxConn{Conn: c, r: bufio.NewReaderSize(c, maxTLSRecord+5)}
+	c.SetReadDeadline(time.Now().Add(MuxSniffTimeout))
+	m.Lock()
+	listeners := m.listeners
+	m.Unlock()
+	for _, l := range listeners {
+		if !l.match(mc.r) {
+			continue
+		}
+		c.SetReadDeadline(time.Time{})
+		select {
+		case l.conns <- mc:
+		case <-l.quit:
+			c.Close()
+		}
+		return
+	}
+	log.Lvl3("No listener for the connection from", c.RemoteAddr())
+	c.Close()
+}
+
+// Close stops the shared listener and all listeners of the Mux.
+func (m *Mux) Close() error {
+	m.Lock()
+	m.closed = true
+	listeners := m.listeners
+	m.Unlock()
+	for _, l := range listeners {
+		l.Close()
+	}
+	return m.root.Close()
+}
+
+// muxListener is a listener of a Mux.
+type muxListener struct {
+	mux      *Mux
+	match    MuxMatcher
+	conns    chan net.Conn
+	quit     chan struct{}
+	quitOnce sync.Once
+}
+
+// Accept implements net.Listener.
+func (l *muxListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.quit:
+		return nil, ErrMuxClosed
+	}
+}
+
+// Close implements net.Listener. It only stops this listener, the others
+// of the Mux keep getting their connections.
+func (l *muxListener) Close() error {
+	l.quitOnce.Do(func() { close(l.quit) })
+	return nil
+}
+
+// Addr implements net.Listener.
+func (l *muxListener) Addr() net.Addr {
+	return l.mux.Addr()
+}
+
+// muxConn is a connection whose first bytes were read to route it.
+type muxConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *muxConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// MatchAny matches all connections.
+func MatchAny(*bufio.Reader) bool {
+	return true
+}
+
+// httpMethods are the beginnings of the HTTP requests.
+var httpMethods = [][]byte{[]byte("GET "), []byte("POST "), []byte("PUT "),
+	[]byte("HEAD "), []byte("DELETE "), []byte("OPTIONS "), []byte("PATCH "),
+	[]byte("CONNECT "), []byte("TRACE ")}
+
+// MatchHTTP matches the plain HTTP connections, which includes the
+// websockets without TLS.
+func MatchHTTP(r *bufio.Reader) bool {
+	buf, _ := r.Peek(8)
+	for _, m := range httpMethods {
+		if bytes.HasPrefix(buf, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchTLS matches the connections starting with a TLS handshake.
+func MatchTLS(r *bufio.Reader) bool {
+	buf, _ := r.Peek(3)
+	return len(buf) == 3 && buf[0] == 0x16 && buf[1] == 3 && buf[2] <= 4
+}
+
+// MatchALPN matches the TLS connections announcing one of protos as
+// application protocol.
+func MatchALPN(protos ...string) MuxMatcher {
+	return func(r *bufio.Reader) bool {
+		if !MatchTLS(r) {
+			return false
+		}
+		hdr, err := r.Peek(5)
+		if err != nil {
+			return false
+		}
+		l := int(hdr[3])<<8 | int(hdr[4])
+		if l > maxTLSRecord {
+			return false
+		}
+		rec, err := r.Peek(5 + l)
+		if err != nil {
+			return false
+		}
+		for _, got := range clientHelloALPN(rec[5:]) {
+			for _, p := range protos {
+				if got == p {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
+
+// clientHelloALPN returns the application protocols of the ClientHello in
+// the handshake message hs, or nil if there are none or it is invalid.
+func clientHelloALPN(hs []byte) []string {
+	// type, length, version and random
+	if len(hs) < 4+2+32 || hs[0] != 1 {
+		return nil
+	}
+	b := hs[4+2+32:]
+	skip := func(lenBytes int) bool {
+		if len(b) < lenBytes {
+			return false
+		}
+		n := 0
+		for _, c := range b[:lenBytes] {
+			n = n<<8 | int(c)
+		}
+		if len(b) < lenBytes+n {
+			return false
+		}
+		b = b[lenBytes+n:]
+		return true
+	}
+	// session id, cipher suites and compression methods
+	if !skip(1) || !skip(2) || !skip(1) || len(b) < 2 {
+		return nil
+	}
+	b = b[2:]
+	for len(b) >= 4 {
+		typ := int(b[0])<<8 | int(b[1])
+		n := int(b[2])<<8 | int(b[3])
+		if len(b) < 4+n {
+			return nil
+		}
+		ext := b[4 : 4+n]
+		b = b[4+n:]
+		if typ != 16 || len(ext) < 2 {
+			continue
+		}
+		var protos []string
+		for ext = ext[2:]; len(ext) > 0; {
+			pl := int(ext[0])
+			if len(ext) < 1+pl {
+				return nil
+			}
+			protos = append(protos, string(ext[1:1+pl]))
+			ext = ext[1+pl:]
+		}
+		return protos
+	}
+	return nil
+}
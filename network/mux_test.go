@@ -0,0 +1,100 @@
+package network
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// acceptOne returns the first bytes of the next connection of ln.
+func acceptOne(t *testing.T, ln net.Listener, n int) []byte {
+	type res struct {
+		buf []byte
+		err error
+	}
+	ch := make(chan res, 1)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			ch <- res{nil, err}
+			return
+		}
+		defer c.Close()
+		buf := make([]byte, n)
+		_, err = io.ReadFull(c, buf)
+		ch <- res{buf, err}
+	}()
+	select {
+	case r := <-ch:
+		require.Nil(t, r.err)
+		return r.buf
+	case <-time.After(2 * time.Second):
+		t.Fatal("no connection")
+	}
+	return nil
+}
+
+func TestMux(t *testing.T) {
+	mux, err := ListenMux("127.0.0.1:0")
+	require.Nil(t, err)
+	defer mux.Close()
+	onet := mux.Listener(MatchALPN(ALPNProto))
+	web := mux.Listener(MatchHTTP)
+	other := mux.Listener(MatchAny)
+	go mux.Serve()
+	addr := mux.Addr().String()
+
+	c, err := net.Dial("tcp", addr)
+	require.Nil(t, err)
+	_, err = c.Write([]byte("GET /ok HTTP/1.1\r\n\r\n"))
+	require.Nil(t, err)
+	require.Equal(t, "GET /ok", string(acceptOne(t, web, 7)))
+	c.Close()
+
+	c, err = net.Dial("tcp", addr)
+	require.Nil(t, err)
+	_, err = c.Write([]byte("\x00\x00\x00\x20onet message"))
+	require.Nil(t, err)
+	require.Equal(t, "\x00\x00\x00\x20", string(acceptOne(t, other, 4)))
+	c.Close()
+
+	// The handshake can't finish, but the ClientHello is routed
+	for _, protos := range [][]string{{"h2", ALPNProto}, {"http/1.1"}} {
+		go func(protos []string) {
+			tc, err := tls.Dial("tcp", addr, &tls.Config{
+				InsecureSkipVerify: true,
+				NextProtos:         protos,
+			})
+			if err == nil {
+				tc.Close()
+			}
+		}(protos)
+		ln := other
+		if len(protos) == 2 {
+			ln = onet
+		}
+		require.Equal(t, byte(0x16), acceptOne(t, ln, 1)[0])
+	}
+
+	require.Nil(t, web.Close())
+	_, err = web.Accept()
+	require.Equal(t, ErrMuxClosed, err)
+}
+
+func TestClientHelloALPN(t *testing.T) {
+	require.Nil(t, clientHelloALPN(nil))
+	require.Nil(t, clientHelloALPN(make([]byte, 100)))
+	hs := []byte{1, 0, 0, 0, 3, 3}
+	hs = append(hs, make([]byte, 32)...)
+	// session id, cipher suites, compression
+	hs = append(hs, 0, 0, 2, 0, 0x2f, 1, 0)
+	ext := []byte{0, 16, 0, 9, 0, 7, 4, 'o', 'n', 'e', 't', 1, 'x'}
+	hs = append(hs, 0, byte(len(ext)))
+	hs = append(hs, ext...)
+	require.Equal(t, []string{"onet", "x"}, clientHelloALPN(hs))
+	require.Nil(t, clientHelloALPN(hs[:len(hs)-1]))
+}
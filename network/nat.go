@@ -0,0 +1,340 @@
+package network
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/dedis/onet/log"
+)
+
+// Servers behind a NAT cannot accept connections, but they can still open
+// connections to the others. Such a server chooses a reachable server as its
+// rendezvous with Router.SetRendezvous and keeps a connection open to it.
+// When a router cannot connect to a server, it sends the message to its
+// rendezvous instead, which relays it over the connection the server opened,
+// if it has been enabled with Router.EnableRelay. So all servers of a roster
+// must use the same rendezvous to reach the servers behind a NAT.
+//
+// As the connections of the router use TCP, there is no hole punching: the
+// messages to a server behind a NAT always go through the rendezvous, while
+// its own messages are sent directly. DiscoverExternalAddress uses STUN to
+// find out if a server is behind a NAT.
+
+// RendezvousKeepAlive is the interval at which a server sends a message to
+// its rendezvous, so that the connection is not closed by the read timeout of
+// the rendezvous or by the NAT.
+var RendezvousKeepAlive = 30 * time.Second
+
+// relayRetry is how long messages to a server that couldn't be reached are
+// sent through the rendezvous before trying to connect directly again.
+var relayRetry = 5 * time.Minute
+
+// RelayMsg carries a message through the rendezvous to a server that cannot
+// be reached directly.
+type RelayMsg struct {
+	// From is the sender of the message. It is set by the rendezvous to the
+	// server the message came from.
+	From *ServerIdentity
+	// To is the server the message is for.
+	To ServerIdentityID
+	// Data is the marshalled message.
+	Data []byte
+}
+
+// RelayMsgType is the message type of RelayMsg.
+var RelayMsgType = RegisterMessage(RelayMsg{})
+
+// RelayKeepAlive is sent to the rendezvous to keep the connection open.
+type RelayKeepAlive struct{}
+
+// RelayKeepAliveType is the message type of RelayKeepAlive.
+var RelayKeepAliveType = RegisterMessage(RelayKeepAlive{})
+
+// SetRendezvous makes the router keep a connection to the rendezvous, and
+// send the messages to the servers it cannot connect to through it. It is
+// needed for servers behind a NAT, and for the servers sending messages to
+// them.
+func (r *Router) SetRendezvous(rdv *ServerIdentity) {
+	r.Lock()
+	if r.rendezvousStop != nil {
+		close(r.rendezvousStop)
+	}
+	stop := make(chan bool)
+	r.rendezvous, r.rendezvousStop = rdv, stop
+	r.Unlock()
+	go r.keepRendezvous(rdv, stop)
+}
+
+// Rendezvous returns the rendezvous of the router, or nil if it has none.
+func (r *Router) Rendezvous() *ServerIdentity {
+	r.Lock()
+	defer r.Unlock()
+	return r.rendezvous
+}
+
+// EnableRelay makes the router relay the messages for the servers that are
+// connected to it. Only the servers used as rendezvous need it.
+func (r *Router) EnableRelay() {
+	r.Lock()
+	r.relay = true
+	r.Unlock()
+}
+
+// keepRendezvous sends keep-alive messages to the rendezvous until stop is
+// closed. Send connects again if the connection has been lost.
+func (r *Router) keepRendezvous(rdv *ServerIdentity, stop chan bool) {
+	for {
+		if r.Closed() {
+			return
+		}
+		if _, err := r.Send(rdv, &RelayKeepAlive{}); err != nil {
+			log.Lvl2(r.address, "couldn't reach rendezvous", rdv.Address, ":", err)
+		}
+		select {
+		case <-stop:
+			return
+		case <-r.Clock().After(RendezvousKeepAlive):
+		}
+	}
+}
+
+// relayTo returns the rendezvous to use for the server, or nil if it is to
+// be contacted directly.
+func (r *Router) relayTo(si *ServerIdentity) *ServerIdentity {
+	r.Lock()
+	defer r.Unlock()
+	if r.rendezvous == nil || r.rendezvous.ID.Equal(si.ID) {
+		return nil
+	}
+	return r.rendezvous
+}
+
+// relayed returns true if the server couldn't be reached directly recently.
+func (r *Router) relayed(si *ServerIdentity) bool {
+	r.Lock()
+	defer r.Unlock()
+	t, ok := r.unreachable[si.ID]
+	if ok && r.Clock().Now().Sub(t) > relayRetry {
+		delete(r.unreachable, si.ID)
+		return false
+	}
+	return ok
+}
+
+// sendRelay sends the message to the server through the rendezvous.
+func (r *Router) sendRelay(rdv, si *ServerIdentity, msg Message) (uint64, error) {
+	r.Lock()
+	if r.unreachable == nil {
+		r.unreachable = make(map[ServerIdentityID]time.Time)
+	}
+	if _, ok := r.unreachable[si.ID]; !ok {
+		r.unreachable[si.ID] = r.Clock().Now()
+	}
+	r.Unlock()
+	data, err := Marshal(msg)
+	if err != nil {
+		return 0, err
+	}
+	log.Lvl3(r.address, "sends to", si.Address, "through", rdv.Address)
+	return r.Send(rdv, &RelayMsg{From: r.ServerIdentity.Copy(), To: si.ID, Data: data})
+}
+
+// handleRelay dispatches a relayed message for this router, or relays it
+// if this router is a rendezvous.
+func (r *Router) handleRelay(remote *ServerIdentity, rm *RelayMsg) {
+	r.Lock()
+	rdv, relay, suite := r.rendezvous, r.relay, r.suite
+	r.Unlock()
+	if rm.To.Equal(r.ServerIdentity.ID) {
+		// Only the rendezvous can tell who the sender is.
+		if rdv == nil || !rdv.ID.Equal(remote.ID) || rm.From == nil {
+			log.Lvl2(r.address, "drops relayed message from", remote.Address)
+			return
+		}
+		if suite == nil {
+			log.Error(r.address, "cannot decode relayed messages without a suite")
+			return
+		}
+		typ, msg, err := Unmarshal(rm.Data, suite)
+		if err != nil {
+			log.Lvl2(r.address, "couldn't decode relayed message:", err)
+			return
+		}
+		env := &Envelope{
+			ServerIdentity: rm.From,
+			MsgType:        typ,
+			Msg:            msg,
+			Size:           Size(len(rm.Data)),
+		}
+		if err := r.Dispatch(env); err != nil {
+			log.RateLimited(10).Lvl3("Error dispatching:", err)
+		}
+		return
+	}
+	if !relay {
+		log.Lvl2(r.address, "is not a rendezvous, drops message from", remote.Address)
+		return
+	}
+	c := r.connection(rm.To)
+	if c == nil {
+		log.Lvl2(r.address, "has no connection to", rm.To, "to relay message from", remote.Address)
+		return
+	}
+	rm.From = remote
+	if _, err := c.Send(rm); err != nil {
+		log.Lvl2(r.address, "couldn't relay message to", rm.To, ":", err)
+	}
+}
+
+// STUNTimeout is how long DiscoverExternalAddress waits for the answer of
+// the STUN server.
+var STUNTimeout = 5 * time.Second
+
+const (
+	stunBindingRequest  = 0x0001
+	stunBindingResponse = 0x0101
+	stunMagicCookie     = 0x2112A442
+	stunMappedAddress   = 0x0001
+	stunXorMappedAddr   = 0x0020
+	stunHeaderLen       = 20
+)
+
+// DiscoverExternalAddress asks the STUN server, given as host:port, for the
+// address it sees the requests of this host coming from. If it is not an
+// address of this host, the host is behind a NAT.
+func DiscoverExternalAddress(stunServer string) (string, error) {
+	raddr, err := net.ResolveUDPAddr("udp", stunServer)
+	if err != nil {
+		return "", err
+	}
+	conn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	req := make([]byte, stunHeaderLen)
+	binary.BigEndian.PutUint16(req[0:], stunBindingRequest)
+	binary.BigEndian.PutUint32(req[4:], stunMagicCookie)
+	if _, err := rand.Read(req[8:stunHeaderLen]); err != nil {
+		return "", err
+	}
+	deadline := time.Now().Add(STUNTimeout)
+	if err := conn.SetDeadline(deadline); err != nil {
+		return "", err
+	}
+	buf := make([]byte, 1500)
+	// UDP can lose the request, so it is sent again every second.
+	for time.Now().Before(deadline) {
+		if _, err := conn.WriteToUDP(req, raddr); err != nil {
+			return "", err
+		}
+		if err := conn.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+			return "", err
+		}
+		for {
+			n, from, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				if ne, ok := err.(net.Error); ok && ne.Timeout() {
+					break
+				}
+				return "", err
+			}
+			if !from.IP.Equal(raddr.IP) || from.Port != raddr.Port {
+				continue
+			}
+			addr, err := parseSTUNResponse(buf[:n], req[8:stunHeaderLen])
+			if err != nil {
+				log.Lvl2("invalid STUN response from", stunServer, ":", err)
+				continue
+			}
+			return addr, nil
+		}
+	}
+	return "", fmt.Errorf("no answer from STUN server %s", stunServer)
+}
+
+// parseSTUNResponse returns the mapped address of a binding response to the
+// request with the transaction ID txID.
+func parseSTUNResponse(buf, txID []byte) (string, error) {
+	if len(buf) < stunHeaderLen {
+		return "", errors.New("response too short")
+	}
+	if binary.BigEndian.Uint16(buf[0:]) != stunBindingResponse {
+		return "", errors.New("not a binding response")
+	}
+	if binary.BigEndian.Uint32(buf[4:]) != stunMagicCookie ||
+		string(buf[8:stunHeaderLen]) != string(txID) {
+		return "", errors.New("wrong transaction")
+	}
+	length := int(binary.BigEndian.Uint16(buf[2:]))
+	if stunHeaderLen+length > len(buf) {
+		return "", errors.New("truncated response")
+	}
+	attrs := buf[stunHeaderLen : stunHeaderLen+length]
+	var mapped string
+	for len(attrs) >= 4 {
+		typ := binary.BigEndian.Uint16(attrs[0:])
+		l := int(binary.BigEndian.Uint16(attrs[2:]))
+		if 4+l > len(attrs) {
+			return "", errors.New("truncated attribute")
+		}
+		val := attrs[4 : 4+l]
+		switch typ {
+		case stunXorMappedAddr:
+			return parseSTUNAddress(val, buf[4:stunHeaderLen])
+		case stunMappedAddress:
+			addr, err := parseSTUNAddress(val, nil)
+			if err != nil {
+				return "", err
+			}
+			mapped = addr
+		}
+		// attributes are padded to 4 bytes
+		next := 4 + (l+3)&^3
+		if next > len(attrs) {
+			break
+		}
+		attrs = attrs[next:]
+	}
+	if mapped == "" {
+		return "", errors.New("no mapped address in response")
+	}
+	return mapped, nil
+}
+
+// parseSTUNAddress decodes a (XOR-)MAPPED-ADDRESS attribute. xor is the
+// magic cookie followed by the transaction ID for XOR-MAPPED-ADDRESS, and nil
+// for MAPPED-ADDRESS.
+func parseSTUNAddress(val, xor []byte) (string, error) {
+	if len(val) < 4 {
+		return "", errors.New("address attribute too short")
+	}
+	var ipLen int
+	switch val[1] {
+	case 1:
+		ipLen = net.IPv4len
+	case 2:
+		ipLen = net.IPv6len
+	default:
+		return "", fmt.Errorf("unknown address family %d", val[1])
+	}
+	if len(val) < 4+ipLen {
+		return "", errors.New("address attribute too short")
+	}
+	port := binary.BigEndian.Uint16(val[2:])
+	ip := make(net.IP, ipLen)
+	copy(ip, val[4:4+ipLen])
+	if xor != nil {
+		port ^= binary.BigEndian.Uint16(xor)
+		for i := range ip {
+			ip[i] ^= xor[i]
+		}
+	}
+	return net.JoinHostPort(ip.String(), strconv.Itoa(int(port))), nil
+}
@@ -0,0 +1,168 @@
+package network
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// envelopeProc sends the received envelopes on a channel.
+type envelopeProc chan *Envelope
+
+func (p envelopeProc) Process(env *Envelope) {
+	p <- env
+}
+
+func TestRouter_Rendezvous(t *testing.T) {
+	rdv, err := NewTestRouterTCP(0)
+	require.Nil(t, err)
+	natted, err := NewTestRouterTCP(0)
+	require.Nil(t, err)
+	sender, err := NewTestRouterTCP(0)
+	require.Nil(t, err)
+	for _, r := range []*Router{rdv, natted, sender} {
+		go r.Start()
+		defer r.Stop()
+	}
+	rdv.EnableRelay()
+	natted.SetRendezvous(rdv.ServerIdentity)
+	sender.SetRendezvous(rdv.ServerIdentity)
+	require.NotNil(t, natted.Rendezvous())
+
+	procNatted := make(envelopeProc, 1)
+	natted.RegisterProcessor(procNatted, SimpleMessageType)
+	procSender := make(envelopeProc, 1)
+	sender.RegisterProcessor(procSender, SimpleMessageType)
+
+	// wait for the natted server to be connected to the rendezvous
+	for i := 0; rdv.connection(natted.ServerIdentity.ID) == nil; i++ {
+		require.True(t, i < 100, "no connection to the rendezvous")
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the sender only knows an address where the natted server cannot be
+	// reached
+	behindNAT := *natted.ServerIdentity
+	behindNAT.Address = NewAddress(PlainTCP, "127.0.0.1:1")
+	_, err = sender.Send(&behindNAT, &SimpleMessage{3})
+	require.Nil(t, err)
+	env := <-procNatted
+	require.Equal(t, 3, env.Msg.(*SimpleMessage).I)
+	require.True(t, env.ServerIdentity.ID.Equal(sender.ServerIdentity.ID))
+	require.True(t, sender.relayed(&behindNAT))
+
+	// the answer goes directly
+	_, err = natted.Send(env.ServerIdentity, &SimpleMessage{4})
+	require.Nil(t, err)
+	env = <-procSender
+	require.Equal(t, 4, env.Msg.(*SimpleMessage).I)
+	require.True(t, env.ServerIdentity.ID.Equal(natted.ServerIdentity.ID))
+}
+
+func TestRouter_RelayDisabled(t *testing.T) {
+	rdv, err := NewTestRouterTCP(0)
+	require.Nil(t, err)
+	sender, err := NewTestRouterTCP(0)
+	require.Nil(t, err)
+	target, err := NewTestRouterTCP(0)
+	require.Nil(t, err)
+	for _, r := range []*Router{rdv, sender, target} {
+		go r.Start()
+		defer r.Stop()
+	}
+	proc := make(envelopeProc, 1)
+	target.RegisterProcessor(proc, SimpleMessageType)
+	target.SetRendezvous(rdv.ServerIdentity)
+	for i := 0; rdv.connection(target.ServerIdentity.ID) == nil; i++ {
+		require.True(t, i < 100, "no connection to the rendezvous")
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// a message that doesn't come from the rendezvous is not accepted
+	data, err := Marshal(&SimpleMessage{5})
+	require.Nil(t, err)
+	_, err = sender.Send(target.ServerIdentity, &RelayMsg{From: rdv.ServerIdentity,
+		To: target.ServerIdentity.ID, Data: data})
+	require.Nil(t, err)
+
+	// the rendezvous doesn't relay without EnableRelay
+	_, err = sender.Send(rdv.ServerIdentity, &RelayMsg{To: target.ServerIdentity.ID, Data: data})
+	require.Nil(t, err)
+
+	select {
+	case <-proc:
+		t.Fatal("message should have been dropped")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+// stunServer answers binding requests with the address of the sender, in a
+// XOR-MAPPED-ADDRESS or a MAPPED-ADDRESS attribute.
+func stunServer(t *testing.T, xor bool) (string, func()) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.Nil(t, err)
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, from, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			if n < stunHeaderLen {
+				continue
+			}
+			resp := make([]byte, stunHeaderLen+12)
+			binary.BigEndian.PutUint16(resp[0:], stunBindingResponse)
+			binary.BigEndian.PutUint16(resp[2:], 12)
+			copy(resp[4:], buf[4:stunHeaderLen])
+			attr := resp[stunHeaderLen:]
+			binary.BigEndian.PutUint16(attr[2:], 8)
+			attr[5] = 1
+			port := uint16(from.Port)
+			ip := append([]byte{}, from.IP.To4()...)
+			if xor {
+				binary.BigEndian.PutUint16(attr[0:], stunXorMappedAddr)
+				port ^= stunMagicCookie >> 16
+				for i := range ip {
+					ip[i] ^= resp[4+i]
+				}
+			} else {
+				binary.BigEndian.PutUint16(attr[0:], stunMappedAddress)
+			}
+			binary.BigEndian.PutUint16(attr[6:], port)
+			copy(attr[8:], ip)
+			conn.WriteToUDP(resp, from)
+		}
+	}()
+	return conn.LocalAddr().String(), func() { conn.Close() }
+}
+
+func TestDiscoverExternalAddress(t *testing.T) {
+	for _, xor := range []bool{true, false} {
+		addr, stop := stunServer(t, xor)
+		ext, err := DiscoverExternalAddress(addr)
+		stop()
+		require.Nil(t, err)
+		host, _, err := net.SplitHostPort(ext)
+		require.Nil(t, err)
+		require.Equal(t, "127.0.0.1", host)
+	}
+}
+
+func TestParseSTUNResponse(t *testing.T) {
+	txID := make([]byte, 12)
+	resp := make([]byte, stunHeaderLen)
+	binary.BigEndian.PutUint16(resp[0:], stunBindingResponse)
+	binary.BigEndian.PutUint32(resp[4:], stunMagicCookie)
+	_, err := parseSTUNResponse(resp, txID)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "no mapped address")
+
+	_, err = parseSTUNResponse(resp, []byte("another txid"))
+	require.NotNil(t, err)
+	_, err = parseSTUNResponse(resp[:10], txID)
+	require.NotNil(t, err)
+}
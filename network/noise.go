@@ -0,0 +1,499 @@
+package network
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/dedis/kyber"
+	"github.com/dedis/onet/log"
+)
+
+// About the Noise transport:
+//
+// Connections of type Noise are encrypted and mutually authenticated with
+// the IK handshake of the Noise protocol framework
+// (https://noiseprotocol.org/noise.html), keyed directly by the keys of the
+// ServerIdentities. The dialer knows the public key of the server from the
+// roster and sends its own public key encrypted in the first message, so
+// there are no certificates to make or to check, contrary to TLS.
+//
+// The Diffie-Hellman function is the multiplication in the group of the
+// suite, the cipher is AES-256-GCM and the hash SHA-256. Every message,
+// of the handshake or not, is sent with its length on two bytes in front.
+
+// noisePrologue is mixed into the handshake, so that both sides agree on
+// the version of the transport.
+const noisePrologue = "onet noise v1"
+
+// noiseMaxMsg is the biggest Noise message, noiseTagLen the size of the
+// authentication tag of an encrypted message.
+const (
+	noiseMaxMsg = 65535
+	noiseTagLen = 16
+)
+
+// noiseCipher encrypts or decrypts the messages in one direction.
+type noiseCipher struct {
+	aead cipher.AEAD
+	n    uint64
+}
+
+func newNoiseCipher(k []byte) (*noiseCipher, error) {
+	block, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &noiseCipher{aead: aead}, nil
+}
+
+// nonce returns the next nonce: 32 bits of zeros and the counter in big
+// endian.
+func (c *noiseCipher) nonce() []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[4:], c.n)
+	c.n++
+	return nonce
+}
+
+func (c *noiseCipher) encrypt(ad, pt []byte) []byte {
+	return c.aead.Seal(nil, c.nonce(), pt, ad)
+}
+
+func (c *noiseCipher) decrypt(ad, ct []byte) ([]byte, error) {
+	return c.aead.Open(nil, c.nonce(), ct, ad)
+}
+
+// noiseHandshake is the handshake state of one side.
+type noiseHandshake struct {
+	suite Suite
+	ck    []byte
+	h     []byte
+	// c is nil until the first key is mixed in
+	c *noiseCipher
+	// our static and ephemeral keys
+	s kyber.Scalar
+	e kyber.Scalar
+	// the static and ephemeral keys of the remote
+	rs kyber.Point
+	re kyber.Point
+}
+
+// newNoiseHandshake starts the handshake with the responder's static key,
+// which the initiator knows beforehand.
+func newNoiseHandshake(suite Suite, s kyber.Scalar, responder kyber.Point) (*noiseHandshake, error) {
+	hs := &noiseHandshake{suite: suite, s: s}
+	name := []byte("Noise_IK_" + suite.String() + "_AESGCM_SHA256")
+	if len(name) <= sha256.Size {
+		hs.h = make([]byte, sha256.Size)
+		copy(hs.h, name)
+	} else {
+		sum := sha256.Sum256(name)
+		hs.h = sum[:]
+	}
+	hs.ck = hs.h
+	hs.mixHash([]byte(noisePrologue))
+	buf, err := responder.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	hs.mixHash(buf)
+	return hs, nil
+}
+
+func (hs *noiseHandshake) mixHash(data []byte) {
+	h := sha256.New()
+	h.Write(hs.h)
+	h.Write(data)
+	hs.h = h.Sum(nil)
+}
+
+func noiseHMAC(key []byte, data ...[]byte) []byte {
+	h := hmac.New(sha256.New, key)
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+// hkdf returns the two outputs of the HKDF of the Noise specification.
+func noiseHKDF(ck, ikm []byte) ([]byte, []byte) {
+	tmp := noiseHMAC(ck, ikm)
+	out1 := noiseHMAC(tmp, []byte{1})
+	out2 := noiseHMAC(tmp, out1, []byte{2})
+	return out1, out2
+}
+
+// mixKey mixes the Diffie-Hellman of the private key and the point into
+// the chaining key and derives a new cipher key.
+func (hs *noiseHandshake) mixKey(priv kyber.Scalar, pub kyber.Point) error {
+	dh, err := hs.suite.Point().Mul(priv, pub).MarshalBinary()
+	if err != nil {
+		return err
+	}
+	var k []byte
+	hs.ck, k = noiseHKDF(hs.ck, dh)
+	hs.c, err = newNoiseCipher(k)
+	return err
+}
+
+func (hs *noiseHandshake) encryptAndHash(pt []byte) []byte {
+	ct := pt
+	if hs.c != nil {
+		ct = hs.c.encrypt(hs.h, pt)
+	}
+	hs.mixHash(ct)
+	return ct
+}
+
+func (hs *noiseHandshake) decryptAndHash(ct []byte) ([]byte, error) {
+	pt := ct
+	if hs.c != nil {
+		var err error
+		if pt, err = hs.c.decrypt(hs.h, ct); err != nil {
+			return nil, err
+		}
+	}
+	hs.mixHash(ct)
+	return pt, nil
+}
+
+// writeEphemeral creates the ephemeral key and returns its public part.
+func (hs *noiseHandshake) writeEphemeral() ([]byte, error) {
+	hs.e = hs.suite.Scalar().Pick(hs.suite.RandomStream())
+	buf, err := hs.suite.Point().Mul(hs.e, nil).MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	hs.mixHash(buf)
+	return buf, nil
+}
+
+// readEphemeral reads the ephemeral key of the remote from the start of msg
+// and returns the rest.
+func (hs *noiseHandshake) readEphemeral(msg []byte) ([]byte, error) {
+	var err error
+	hs.re, msg, err = hs.readPoint(msg)
+	if err != nil {
+		return nil, err
+	}
+	buf, err := hs.re.MarshalBinary()
+	if err != nil {
+		return nil, errors.New("invalid ephemeral key")
+	}
+	hs.mixHash(buf)
+	return msg, nil
+}
+
+// readPoint reads a point from the start of msg and returns the rest.
+func (hs *noiseHandshake) readPoint(msg []byte) (kyber.Point, []byte, error) {
+	l := hs.suite.PointLen()
+	if len(msg) < l {
+		return nil, nil, errors.New("noise message too short")
+	}
+	p := hs.suite.Point()
+	if err := p.UnmarshalBinary(msg[:l]); err != nil {
+		return nil, nil, err
+	}
+	return p, msg[l:], nil
+}
+
+// split returns the ciphers of the initiator and of the responder.
+func (hs *noiseHandshake) split() (*noiseCipher, *noiseCipher, error) {
+	k1, k2 := noiseHKDF(hs.ck, nil)
+	c1, err := newNoiseCipher(k1)
+	if err != nil {
+		return nil, nil, err
+	}
+	c2, err := newNoiseCipher(k2)
+	return c1, c2, err
+}
+
+// noiseConn is a net.Conn encrypted by the Noise transport.
+type noiseConn struct {
+	net.Conn
+	send   *noiseCipher
+	recv   *noiseCipher
+	remote kyber.Point
+	// buf holds the decrypted bytes that weren't read yet
+	buf       []byte
+	sendMutex sync.Mutex
+	recvMutex sync.Mutex
+	// handshake, if not nil, is run once before the first Read or Write.
+	handshake     func() error
+	handshakeOnce sync.Once
+	handshakeErr  error
+}
+
+func writeNoiseMsg(c net.Conn, msg []byte) error {
+	buf := make([]byte, 2, 2+len(msg))
+	binary.BigEndian.PutUint16(buf, uint16(len(msg)))
+	_, err := c.Write(append(buf, msg...))
+	return err
+}
+
+func readNoiseMsg(c net.Conn) ([]byte, error) {
+	var l [2]byte
+	if _, err := io.ReadFull(c, l[:]); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, binary.BigEndian.Uint16(l[:]))
+	_, err := io.ReadFull(c, msg)
+	return msg, err
+}
+
+// initiate runs the handshake as the initiator, with our private key s and
+// the public key of the responder.
+func (c *noiseConn) initiate(suite Suite, s kyber.Scalar, responder kyber.Point) error {
+	hs, err := newNoiseHandshake(suite, s, responder)
+	if err != nil {
+		return err
+	}
+	hs.rs = responder
+	// -> e, es, s, ss
+	msg, err := hs.writeEphemeral()
+	if err != nil {
+		return err
+	}
+	if err := hs.mixKey(hs.e, hs.rs); err != nil {
+		return err
+	}
+	spub, err := suite.Point().Mul(s, nil).MarshalBinary()
+	if err != nil {
+		return err
+	}
+	msg = append(msg, hs.encryptAndHash(spub)...)
+	if err := hs.mixKey(s, hs.rs); err != nil {
+		return err
+	}
+	msg = append(msg, hs.encryptAndHash(nil)...)
+	if err := writeNoiseMsg(c.Conn, msg); err != nil {
+		return err
+	}
+
+	// <- e, ee, se
+	msg, err = readNoiseMsg(c.Conn)
+	if err != nil {
+		return err
+	}
+	if msg, err = hs.readEphemeral(msg); err != nil {
+		return err
+	}
+	if err := hs.mixKey(hs.e, hs.re); err != nil {
+		return err
+	}
+	if err := hs.mixKey(s, hs.re); err != nil {
+		return err
+	}
+	if _, err := hs.decryptAndHash(msg); err != nil {
+		return err
+	}
+	c.send, c.recv, err = hs.split()
+	c.remote = responder
+	return err
+}
+
+// respond runs the handshake as the responder, with our private key s.
+func (c *noiseConn) respond(suite Suite, s kyber.Scalar) error {
+	hs, err := newNoiseHandshake(suite, s, suite.Point().Mul(s, nil))
+	if err != nil {
+		return err
+	}
+	// -> e, es, s, ss
+	msg, err := readNoiseMsg(c.Conn)
+	if err != nil {
+		return err
+	}
+	if msg, err = hs.readEphemeral(msg); err != nil {
+		return err
+	}
+	if err := hs.mixKey(s, hs.re); err != nil {
+		return err
+	}
+	l := suite.PointLen() + noiseTagLen
+	if len(msg) < l {
+		return errors.New("noise message too short")
+	}
+	spub, err := hs.decryptAndHash(msg[:l])
+	if err != nil {
+		return err
+	}
+	if hs.rs, _, err = hs.readPoint(spub); err != nil {
+		return err
+	}
+	if err := hs.mixKey(s, hs.rs); err != nil {
+		return err
+	}
+	if _, err := hs.decryptAndHash(msg[l:]); err != nil {
+		return err
+	}
+
+	// <- e, ee, se
+	msg, err = hs.writeEphemeral()
+	if err != nil {
+		return err
+	}
+	if err := hs.mixKey(hs.e, hs.re); err != nil {
+		return err
+	}
+	if err := hs.mixKey(hs.e, hs.rs); err != nil {
+		return err
+	}
+	msg = append(msg, hs.encryptAndHash(nil)...)
+	if err := writeNoiseMsg(c.Conn, msg); err != nil {
+		return err
+	}
+	c.recv, c.send, err = hs.split()
+	c.remote = hs.rs
+	return err
+}
+
+// doHandshake runs the handshake of the responder, if it didn't run yet.
+func (c *noiseConn) doHandshake() error {
+	c.handshakeOnce.Do(func() {
+		if c.handshake == nil {
+			return
+		}
+		c.Conn.SetDeadline(time.Now().Add(MaxIdentityExchange))
+		c.handshakeErr = c.handshake()
+		c.Conn.SetDeadline(time.Time{})
+		if c.handshakeErr != nil {
+			log.Lvl2("Noise handshake with", c.RemoteAddr(), "failed:", c.handshakeErr)
+			c.Conn.Close()
+		}
+	})
+	return c.handshakeErr
+}
+
+// Read decrypts the messages of the remote.
+func (c *noiseConn) Read(b []byte) (int, error) {
+	if err := c.doHandshake(); err != nil {
+		return 0, err
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+	c.recvMutex.Lock()
+	defer c.recvMutex.Unlock()
+	for len(c.buf) == 0 {
+		msg, err := readNoiseMsg(c.Conn)
+		if err != nil {
+			return 0, err
+		}
+		if c.buf, err = c.recv.decrypt(nil, msg); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(b, c.buf)
+	c.buf = c.buf[n:]
+	return n, nil
+}
+
+// Write encrypts b in messages of at most noiseMaxMsg bytes.
+func (c *noiseConn) Write(b []byte) (int, error) {
+	if err := c.doHandshake(); err != nil {
+		return 0, err
+	}
+	c.sendMutex.Lock()
+	defer c.sendMutex.Unlock()
+	var n int
+	for len(b) > 0 {
+		l := len(b)
+		if l > noiseMaxMsg-noiseTagLen {
+			l = noiseMaxMsg - noiseTagLen
+		}
+		if err := writeNoiseMsg(c.Conn, c.send.encrypt(nil, b[:l])); err != nil {
+			return n, err
+		}
+		n += l
+		b = b[l:]
+	}
+	return n, nil
+}
+
+// noiseListener runs the handshake of the responder on the accepted
+// connections, at their first Read or Write.
+type noiseListener struct {
+	net.Listener
+	suite Suite
+	si    *ServerIdentity
+}
+
+func (l *noiseListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	nc := &noiseConn{Conn: c}
+	nc.handshake = func() error {
+		return nc.respond(l.suite, l.si.GetPrivate())
+	}
+	return nc, nil
+}
+
+// NewNoiseListener returns a TCPListener for the Noise connections to si,
+// whose private key must be set.
+func NewNoiseListener(si *ServerIdentity, suite Suite) (*TCPListener, error) {
+	if si.GetPrivate() == nil {
+		return nil, errors.New("private key is not set")
+	}
+	tcp, err := NewTCPListener(si.Address, suite)
+	if err != nil {
+		return nil, err
+	}
+	tcp.listener = &noiseListener{tcp.listener, suite, si}
+	return tcp, nil
+}
+
+// NewNoiseConn opens a TCPConn to the server over the Noise transport. The
+// server proves it holds the private key of them.Public during the
+// handshake.
+func NewNoiseConn(us *ServerIdentity, them *ServerIdentity, suite Suite) (*TCPConn, error) {
+	return newNoiseConn(us, them, suite, nil)
+}
+
+// newNoiseConn is NewNoiseConn connecting through the proxy, if it is not
+// nil.
+func newNoiseConn(us *ServerIdentity, them *ServerIdentity, suite Suite, proxy ProxyFunc) (conn *TCPConn, err error) {
+	log.Lvl2("NewNoiseConn to:", them)
+	if them.Address.ConnType() != Noise {
+		return nil, errors.New("not a noise server")
+	}
+	if us.GetPrivate() == nil {
+		return nil, errors.New("private key is not set")
+	}
+	netAddr := them.Address.NetworkAddress()
+	for i := 1; i <= MaxRetryConnect; i++ {
+		var c net.Conn
+		c, err = DialProxy("tcp", netAddr, proxy)
+		if err == nil {
+			nc := &noiseConn{Conn: c}
+			c.SetDeadline(time.Now().Add(MaxIdentityExchange))
+			err = nc.initiate(suite, us.GetPrivate(), them.Public)
+			c.SetDeadline(time.Time{})
+			if err != nil {
+				c.Close()
+			} else {
+				return &TCPConn{conn: nc, suite: suite}, nil
+			}
+		}
+		if i < MaxRetryConnect {
+			time.Sleep(WaitRetry)
+		}
+	}
+	if err == nil {
+		err = ErrTimeout
+	}
+	return
+}
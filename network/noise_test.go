@@ -0,0 +1,144 @@
+package network
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/dedis/kyber/util/key"
+	"github.com/stretchr/testify/require"
+)
+
+func NewTestRouterNoise(port int) (*Router, error) {
+	addr := NewAddress(Noise, "127.0.0.1:"+strconv.Itoa(port))
+	kp := key.NewKeyPair(tSuite)
+	sid := NewServerIdentity(kp.Public, addr)
+	sid.SetPrivate(kp.Private)
+	h, err := NewTCPHost(sid, tSuite)
+	if err != nil {
+		return nil, err
+	}
+	h.sid.Address = h.TCPListener.Address()
+	return NewRouter(h.sid, h), nil
+}
+
+// noisePipe runs the handshake over a net.Pipe and returns both ends.
+func noisePipe(initiator, responder *key.Pair, expected *key.Pair) (*noiseConn, *noiseConn, error) {
+	c1, c2 := net.Pipe()
+	nc1 := &noiseConn{Conn: c1}
+	nc2 := &noiseConn{Conn: c2}
+	nc2.handshake = func() error {
+		return nc2.respond(tSuite, responder.Private)
+	}
+	errs := make(chan error, 1)
+	go func() {
+		// The first Read runs the handshake of the responder.
+		_, err := nc2.Read(make([]byte, 0))
+		errs <- err
+	}()
+	err := nc1.initiate(tSuite, initiator.Private, expected.Public)
+	if err != nil {
+		c1.Close()
+		c2.Close()
+		<-errs
+		return nil, nil, err
+	}
+	return nc1, nc2, nil
+}
+
+func TestNoiseHandshake(t *testing.T) {
+	kp1 := key.NewKeyPair(tSuite)
+	kp2 := key.NewKeyPair(tSuite)
+	nc1, nc2, err := noisePipe(kp1, kp2, kp2)
+	require.Nil(t, err)
+	defer nc1.Close()
+	defer nc2.Close()
+	require.True(t, nc1.remote.Equal(kp2.Public))
+
+	msg := []byte("hello over noise")
+	go nc1.Write(msg)
+	buf := make([]byte, len(msg))
+	_, err = io.ReadFull(nc2, buf)
+	require.Nil(t, err)
+	require.Equal(t, msg, buf)
+	require.True(t, nc2.remote.Equal(kp1.Public))
+
+	go nc2.Write(msg)
+	_, err = io.ReadFull(nc1, buf)
+	require.Nil(t, err)
+	require.Equal(t, msg, buf)
+}
+
+func TestNoiseWrongKey(t *testing.T) {
+	kp1 := key.NewKeyPair(tSuite)
+	kp2 := key.NewKeyPair(tSuite)
+	kp3 := key.NewKeyPair(tSuite)
+	// The initiator expects kp3, but talks to kp2.
+	_, _, err := noisePipe(kp1, kp2, kp3)
+	require.NotNil(t, err)
+}
+
+func TestNoiseBigMessage(t *testing.T) {
+	kp1 := key.NewKeyPair(tSuite)
+	kp2 := key.NewKeyPair(tSuite)
+	nc1, nc2, err := noisePipe(kp1, kp2, kp2)
+	require.Nil(t, err)
+	defer nc1.Close()
+	defer nc2.Close()
+
+	msg := bytes.Repeat([]byte("0123456789"), 3*noiseMaxMsg/10)
+	go func() {
+		n, err := nc1.Write(msg)
+		require.Nil(t, err)
+		require.Equal(t, len(msg), n)
+	}()
+	buf := make([]byte, len(msg))
+	_, err = io.ReadFull(nc2, buf)
+	require.Nil(t, err)
+	require.Equal(t, msg, buf)
+}
+
+func TestNoiseListenerNoPrivate(t *testing.T) {
+	kp := key.NewKeyPair(tSuite)
+	si := NewServerIdentity(kp.Public, NewAddress(Noise, "127.0.0.1:0"))
+	_, err := NewNoiseListener(si, tSuite)
+	require.NotNil(t, err)
+}
+
+func TestNoiseRouter(t *testing.T) {
+	r1, err := NewTestRouterNoise(0)
+	require.Nil(t, err)
+	r2, err := NewTestRouterNoise(0)
+	require.Nil(t, err)
+	require.Equal(t, Noise, r1.ServerIdentity.Address.ConnType())
+
+	rcv := make(chan bool, 1)
+	mt := RegisterMessage(&hello{})
+	r1.Dispatcher.RegisterProcessorFunc(mt, func(*Envelope) {
+		rcv <- true
+	})
+	go r1.Start()
+	go r2.Start()
+	defer r1.Stop()
+	defer r2.Stop()
+	for !r1.Listening() || !r2.Listening() {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	_, err = r2.Send(r1.ServerIdentity, aHello)
+	require.Nil(t, err)
+	select {
+	case <-rcv:
+	case <-time.After(2 * time.Second):
+		t.Fatal("message over noise didn't arrive")
+	}
+
+	// A server that claims the identity of r1 without its key is refused.
+	kp := key.NewKeyPair(tSuite)
+	fake := NewServerIdentity(kp.Public, r1.ServerIdentity.Address)
+	_, err = r2.Send(fake, aHello)
+	require.NotNil(t, err)
+}
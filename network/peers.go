@@ -0,0 +1,272 @@
+package network
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dedis/onet/log"
+)
+
+// DefaultPingInterval is how often the router measures the round-trip time
+// to the servers it is connected to.
+const DefaultPingInterval = time.Minute
+
+// PeerPing is sent to measure the round-trip time to a server, which
+// answers with a PeerPong holding the same nonce.
+type PeerPing struct {
+	Nonce uint64
+}
+
+// PeerPong is the answer to a PeerPing.
+type PeerPong struct {
+	Nonce uint64
+}
+
+func init() {
+	RegisterMessages(PeerPing{}, PeerPong{})
+	SetMessagePriority(MessageType(&PeerPing{}), PriorityHigh)
+	SetMessagePriority(MessageType(&PeerPong{}), PriorityHigh)
+}
+
+// PeerStats is the state of the connections of the router to a server.
+type PeerStats struct {
+	ServerIdentity *ServerIdentity
+	// Connections is the number of open connections to the server.
+	Connections int
+	// Established is when the oldest open connection was set up. It is
+	// zero if no connection is open.
+	Established time.Time
+	// LastActivity is when the last message was sent to or received from
+	// the server.
+	LastActivity time.Time
+	// RTT is the last round-trip time measured by a ping, zero if none
+	// was answered yet.
+	RTT time.Duration
+	// Tx and Rx are the bytes written and read, over all connections.
+	Tx uint64
+	Rx uint64
+	// MsgsIn and MsgsOut count the messages received and sent.
+	MsgsIn  uint64
+	MsgsOut uint64
+	// Reconnects is how many times a connection was set up again after all
+	// connections to the server were closed.
+	Reconnects int
+}
+
+// peer holds the PeerStats of a server together with the open connections,
+// whose traffic is added when the stats are read.
+type peer struct {
+	stats PeerStats
+	conns map[Conn]time.Time
+	// closedTx and closedRx are the traffic of the closed connections.
+	closedTx uint64
+	closedRx uint64
+}
+
+// peers holds the peer of every server the router was connected to, and
+// the pings waiting for an answer.
+type peers struct {
+	m        map[ServerIdentityID]*peer
+	pings    map[uint64]chan time.Time
+	interval time.Duration
+	sync.Mutex
+}
+
+func (p *peers) get(si *ServerIdentity) *peer {
+	if p.m == nil {
+		p.m = make(map[ServerIdentityID]*peer)
+	}
+	pe, ok := p.m[si.ID]
+	if !ok {
+		pe = &peer{
+			stats: PeerStats{ServerIdentity: si},
+			conns: make(map[Conn]time.Time),
+		}
+		p.m[si.ID] = pe
+	}
+	return pe
+}
+
+// opened registers a new connection to the server.
+func (p *peers) opened(si *ServerIdentity, c Conn) {
+	p.Lock()
+	defer p.Unlock()
+	pe := p.get(si)
+	if len(pe.conns) == 0 && !pe.stats.Established.IsZero() {
+		pe.stats.Reconnects++
+	}
+	now := time.Now()
+	pe.conns[c] = now
+	if len(pe.conns) == 1 {
+		pe.stats.Established = now
+	}
+	pe.stats.LastActivity = now
+}
+
+// closed removes the connection and keeps its traffic.
+func (p *peers) closed(si *ServerIdentity, c Conn) {
+	p.Lock()
+	defer p.Unlock()
+	pe := p.get(si)
+	if _, ok := pe.conns[c]; !ok {
+		return
+	}
+	delete(pe.conns, c)
+	pe.closedTx += c.Tx()
+	pe.closedRx += c.Rx()
+	// With no connection left, Established is kept so that the next
+	// connection counts as a reconnect.
+	if len(pe.conns) > 0 {
+		pe.stats.Established = time.Now()
+		for _, t := range pe.conns {
+			if t.Before(pe.stats.Established) {
+				pe.stats.Established = t
+			}
+		}
+	}
+}
+
+func (p *peers) received(si *ServerIdentity) {
+	p.Lock()
+	defer p.Unlock()
+	pe := p.get(si)
+	pe.stats.MsgsIn++
+	pe.stats.LastActivity = time.Now()
+}
+
+func (p *peers) sent(si *ServerIdentity) {
+	p.Lock()
+	defer p.Unlock()
+	pe := p.get(si)
+	pe.stats.MsgsOut++
+	pe.stats.LastActivity = time.Now()
+}
+
+func (pe *peer) snapshot() PeerStats {
+	st := pe.stats
+	st.Connections = len(pe.conns)
+	if st.Connections == 0 {
+		st.Established = time.Time{}
+	}
+	st.Tx, st.Rx = pe.closedTx, pe.closedRx
+	for c := range pe.conns {
+		st.Tx += c.Tx()
+		st.Rx += c.Rx()
+	}
+	return st
+}
+
+// Peers returns the state of the connections to all servers the router has
+// been connected to, sorted by address.
+func (r *Router) Peers() []PeerStats {
+	r.peers.Lock()
+	defer r.peers.Unlock()
+	var list []PeerStats
+	for _, pe := range r.peers.m {
+		list = append(list, pe.snapshot())
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ServerIdentity.Address < list[j].ServerIdentity.Address
+	})
+	return list
+}
+
+// Peer returns the state of the connections to the server with the given
+// ID, and false if the router was never connected to it.
+func (r *Router) Peer(id ServerIdentityID) (PeerStats, bool) {
+	r.peers.Lock()
+	defer r.peers.Unlock()
+	pe, ok := r.peers.m[id]
+	if !ok {
+		return PeerStats{}, false
+	}
+	return pe.snapshot(), true
+}
+
+// SetPingInterval changes how often the round-trip time to the connected
+// servers is measured, for the connections set up from now on. Zero
+// disables the pings.
+func (r *Router) SetPingInterval(d time.Duration) {
+	r.peers.Lock()
+	r.peers.interval = d
+	r.peers.Unlock()
+}
+
+// Ping sends a PeerPing to the server and waits for the answer at most
+// timeout. It returns the round-trip time, which is also kept in the
+// PeerStats of the server.
+func (r *Router) Ping(si *ServerIdentity, timeout time.Duration) (time.Duration, error) {
+	nonce := uint64(rand.Int63())
+	pong := make(chan time.Time, 1)
+	r.peers.Lock()
+	if r.peers.pings == nil {
+		r.peers.pings = make(map[uint64]chan time.Time)
+	}
+	r.peers.pings[nonce] = pong
+	r.peers.Unlock()
+	defer func() {
+		r.peers.Lock()
+		delete(r.peers.pings, nonce)
+		r.peers.Unlock()
+	}()
+
+	clock := r.Clock()
+	start := clock.Now()
+	if _, err := r.Send(si, &PeerPing{nonce}); err != nil {
+		return 0, err
+	}
+	select {
+	case t := <-pong:
+		rtt := t.Sub(start)
+		r.peers.Lock()
+		r.peers.get(si).stats.RTT = rtt
+		r.peers.Unlock()
+		return rtt, nil
+	case <-clock.After(timeout):
+		return 0, errors.New("no answer to the ping of " + si.String())
+	}
+}
+
+// handlePing answers the pings and passes the pongs to Ping.
+func (r *Router) handlePing(remote *ServerIdentity, msg Message) {
+	switch m := msg.(type) {
+	case *PeerPing:
+		if _, err := r.Send(remote, &PeerPong{m.Nonce}); err != nil {
+			log.Lvl3(r.address, "couldn't answer ping of", remote, ":", err)
+		}
+	case *PeerPong:
+		r.peers.Lock()
+		pong, ok := r.peers.pings[m.Nonce]
+		r.peers.Unlock()
+		if ok {
+			select {
+			case pong <- r.Clock().Now():
+			default:
+			}
+		}
+	}
+}
+
+// pingLoop measures the round-trip time to the remote of a connection until
+// done is closed.
+func (r *Router) pingLoop(remote *ServerIdentity, done chan bool) {
+	r.peers.Lock()
+	interval := r.peers.interval
+	r.peers.Unlock()
+	if interval <= 0 {
+		return
+	}
+	for {
+		select {
+		case <-done:
+			return
+		case <-r.Clock().After(interval):
+			if _, err := r.Ping(remote, interval); err != nil {
+				log.Lvl3(r.address, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package network
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouter_Peers(t *testing.T) {
+	h1, err := NewTestRouterTCP(0)
+	require.Nil(t, err)
+	h2, err := NewTestRouterTCP(0)
+	require.Nil(t, err)
+	go h1.Start()
+	go h2.Start()
+	defer h1.Stop()
+	defer h2.Stop()
+	require.Equal(t, 0, len(h1.Peers()))
+
+	proc := make(envelopeProc, 1)
+	h2.RegisterProcessor(proc, SimpleMessageType)
+	_, err = h1.Send(h2.ServerIdentity, &SimpleMessage{3})
+	require.Nil(t, err)
+	<-proc
+
+	peers := h1.Peers()
+	require.Equal(t, 1, len(peers))
+	p := peers[0]
+	require.True(t, p.ServerIdentity.ID.Equal(h2.ServerIdentity.ID))
+	require.Equal(t, 1, p.Connections)
+	require.False(t, p.Established.IsZero())
+	require.Equal(t, uint64(1), p.MsgsOut)
+	require.True(t, p.Tx > 0)
+	require.Equal(t, 0, p.Reconnects)
+
+	p, ok := h2.Peer(h1.ServerIdentity.ID)
+	require.True(t, ok)
+	require.Equal(t, uint64(1), p.MsgsIn)
+	require.Equal(t, p.Rx, h1.Tx())
+
+	rtt, err := h1.Ping(h2.ServerIdentity, time.Second)
+	require.Nil(t, err)
+	require.True(t, rtt > 0)
+	p, _ = h1.Peer(h2.ServerIdentity.ID)
+	require.Equal(t, rtt, p.RTT)
+
+	// close the connection and reconnect
+	h1.Lock()
+	c := h1.connections[h2.ServerIdentity.ID][0]
+	h1.Unlock()
+	require.Nil(t, c.Close())
+	for {
+		p, _ = h1.Peer(h2.ServerIdentity.ID)
+		if p.Connections == 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.True(t, p.Established.IsZero())
+	require.True(t, p.Tx > 0)
+	_, err = h1.Send(h2.ServerIdentity, &SimpleMessage{3})
+	require.Nil(t, err)
+	<-proc
+	p, _ = h1.Peer(h2.ServerIdentity.ID)
+	require.Equal(t, 1, p.Reconnects)
+	require.Equal(t, uint64(3), p.MsgsOut)
+}
+
+func TestRouter_PingInterval(t *testing.T) {
+	h1, err := NewTestRouterTCP(0)
+	require.Nil(t, err)
+	h2, err := NewTestRouterTCP(0)
+	require.Nil(t, err)
+	h1.SetPingInterval(50 * time.Millisecond)
+	go h1.Start()
+	go h2.Start()
+	defer h1.Stop()
+	defer h2.Stop()
+
+	_, err = h1.Send(h2.ServerIdentity, &SimpleMessage{3})
+	require.Nil(t, err)
+	for i := 0; ; i++ {
+		p, _ := h1.Peer(h2.ServerIdentity.ID)
+		if p.RTT > 0 {
+			break
+		}
+		require.True(t, i < 100, "no ping answered")
+		time.Sleep(10 * time.Millisecond)
+	}
+}
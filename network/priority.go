@@ -0,0 +1,92 @@
+package network
+
+import "sync"
+
+// Priority orders the messages waiting to be sent on the same connection: a
+// message is sent before all the waiting messages of lower priority, and
+// after the ones of the same priority that were waiting before it. A message
+// that is being written is never interrupted, so big messages should be
+// split to let control messages through.
+type Priority int
+
+const (
+	// PriorityLow is for bulk transfers.
+	PriorityLow Priority = -1
+	// PriorityNormal is the priority of the messages without one.
+	PriorityNormal Priority = 0
+	// PriorityHigh is for control messages like heartbeats, which must not
+	// wait behind bulk transfers.
+	PriorityHigh Priority = 1
+)
+
+var priorities = struct {
+	m map[MessageTypeID]Priority
+	sync.Mutex
+}{m: make(map[MessageTypeID]Priority)}
+
+// SetMessagePriority sets the priority of all the messages of the given
+// type, used by Router.Send.
+func SetMessagePriority(t MessageTypeID, p Priority) {
+	priorities.Lock()
+	defer priorities.Unlock()
+	priorities.m[t] = p
+}
+
+// MessagePriority returns the priority of the type of msg, PriorityNormal if
+// it has none.
+func MessagePriority(msg Message) Priority {
+	priorities.Lock()
+	defer priorities.Unlock()
+	return priorities.m[MessageType(msg)]
+}
+
+// sendQueue lets the senders on a connection through one at a time, the one
+// with the highest priority first.
+type sendQueue struct {
+	busy    bool
+	waiting []*sender
+	seq     uint64
+	sync.Mutex
+}
+
+type sender struct {
+	prio  Priority
+	seq   uint64
+	ready chan bool
+}
+
+// lock waits until all senders of higher priority, and the ones of the same
+// priority that came before, are done.
+func (q *sendQueue) lock(p Priority) {
+	q.Lock()
+	if !q.busy {
+		q.busy = true
+		q.Unlock()
+		return
+	}
+	q.seq++
+	s := &sender{p, q.seq, make(chan bool)}
+	q.waiting = append(q.waiting, s)
+	q.Unlock()
+	<-s.ready
+}
+
+// unlock lets the next sender through.
+func (q *sendQueue) unlock() {
+	q.Lock()
+	defer q.Unlock()
+	if len(q.waiting) == 0 {
+		q.busy = false
+		return
+	}
+	next := 0
+	for i, s := range q.waiting {
+		n := q.waiting[next]
+		if s.prio > n.prio || (s.prio == n.prio && s.seq < n.seq) {
+			next = i
+		}
+	}
+	s := q.waiting[next]
+	q.waiting = append(q.waiting[:next], q.waiting[next+1:]...)
+	close(s.ready)
+}
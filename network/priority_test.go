@@ -0,0 +1,78 @@
+package network
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type priorityMsg struct {
+	I int
+}
+
+var priorityMsgType = RegisterMessage(&priorityMsg{})
+
+func TestMessagePriority(t *testing.T) {
+	require.Equal(t, PriorityNormal, MessagePriority(&priorityMsg{}))
+	SetMessagePriority(priorityMsgType, PriorityHigh)
+	defer SetMessagePriority(priorityMsgType, PriorityNormal)
+	require.Equal(t, PriorityHigh, MessagePriority(&priorityMsg{}))
+	require.Equal(t, PriorityHigh, MessagePriority(&PeerPing{}))
+}
+
+func TestSendQueue(t *testing.T) {
+	q := &sendQueue{}
+	q.lock(PriorityLow)
+
+	var order []Priority
+	var orderLock sync.Mutex
+	var wg sync.WaitGroup
+	prios := []Priority{PriorityLow, PriorityNormal, PriorityHigh, PriorityNormal, PriorityHigh}
+	for i, p := range prios {
+		wg.Add(1)
+		go func(p Priority) {
+			defer wg.Done()
+			q.lock(p)
+			orderLock.Lock()
+			order = append(order, p)
+			orderLock.Unlock()
+			q.unlock()
+		}(p)
+		// make sure the senders queue up in order
+		for {
+			q.Lock()
+			n := len(q.waiting)
+			q.Unlock()
+			if n == i+1 {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	q.unlock()
+	wg.Wait()
+	require.Equal(t, []Priority{PriorityHigh, PriorityHigh, PriorityNormal,
+		PriorityNormal, PriorityLow}, order)
+	require.False(t, q.busy)
+}
+
+func TestRouter_SendPriority(t *testing.T) {
+	h1, err := NewTestRouterTCP(0)
+	require.Nil(t, err)
+	h2, err := NewTestRouterTCP(0)
+	require.Nil(t, err)
+	go h1.Start()
+	go h2.Start()
+	defer h1.Stop()
+	defer h2.Stop()
+
+	proc := make(envelopeProc, 10)
+	h2.RegisterProcessor(proc, SimpleMessageType)
+	for _, p := range []Priority{PriorityLow, PriorityHigh} {
+		_, err = h1.SendPriority(h2.ServerIdentity, &SimpleMessage{int(p)}, p)
+		require.Nil(t, err)
+		require.Equal(t, int(p), (<-proc).Msg.(*SimpleMessage).I)
+	}
+}
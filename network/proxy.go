@@ -0,0 +1,275 @@
+package network
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// ProxyFunc returns the proxy to use to connect to the address, given as
+// host:port, or nil to connect directly. The scheme of the proxy is either
+// "socks5" or "http", for a proxy supporting the CONNECT method. The user
+// of the URL is used to authenticate to the proxy.
+type ProxyFunc func(addr string) (*url.URL, error)
+
+// ProxyURL returns a ProxyFunc using the proxy u for all addresses.
+func ProxyURL(u *url.URL) ProxyFunc {
+	return func(string) (*url.URL, error) {
+		return u, nil
+	}
+}
+
+// ProxyFromEnvironment returns the proxy given by the environment
+// variables HTTPS_PROXY and NO_PROXY, or their lower-case versions, like
+// http.ProxyFromEnvironment does for https URLs. Connections to localhost
+// are never proxied.
+func ProxyFromEnvironment(addr string) (*url.URL, error) {
+	return http.ProxyFromEnvironment(&http.Request{URL: &url.URL{Scheme: "https", Host: addr}})
+}
+
+// ProxyPerHost returns a ProxyFunc using the proxy of the host of the
+// address in hosts, if it is there, and the def ProxyFunc otherwise. A nil
+// proxy in hosts means a direct connection, as does a nil def.
+func ProxyPerHost(hosts map[string]*url.URL, def ProxyFunc) ProxyFunc {
+	return func(addr string) (*url.URL, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		if u, ok := hosts[host]; ok {
+			return u, nil
+		}
+		if def == nil {
+			return nil, nil
+		}
+		return def(addr)
+	}
+}
+
+// SetProxy makes the host connect through the proxies returned by proxy.
+// Unix sockets are always connected directly.
+func (t *TCPHost) SetProxy(proxy ProxyFunc) {
+	t.proxyLock.Lock()
+	t.proxy = proxy
+	t.proxyLock.Unlock()
+}
+
+func (t *TCPHost) getProxy() ProxyFunc {
+	t.proxyLock.Lock()
+	defer t.proxyLock.Unlock()
+	return t.proxy
+}
+
+// SetProxy makes the router connect through the proxies returned by proxy.
+// It returns an error if the host of the router doesn't support proxies.
+func (r *Router) SetProxy(proxy ProxyFunc) error {
+	h, ok := r.host.(*TCPHost)
+	if !ok {
+		return errors.New("the host of the router doesn't support proxies")
+	}
+	h.SetProxy(proxy)
+	return nil
+}
+
+// HappyEyeballsDelay is how long a connection to the IPv6 addresses of a
+// host is tried before the IPv4 addresses are tried in parallel, as in
+// RFC 6555.
+var HappyEyeballsDelay = 300 * time.Millisecond
+
+// dial connects to addr, racing IPv6 and IPv4 if the host has both.
+func dial(netw, addr string) (net.Conn, error) {
+	d := &net.Dialer{
+		DualStack:     true,
+		FallbackDelay: HappyEyeballsDelay,
+	}
+	return d.Dial(netw, addr)
+}
+
+// DialProxy connects to addr, given as host:port, on the network netw.
+// TCP connections go through the proxy returned by proxy, if any.
+func DialProxy(netw, addr string, proxy ProxyFunc) (net.Conn, error) {
+	if proxy == nil || netw != "tcp" {
+		return dial(netw, addr)
+	}
+	u, err := proxy(addr)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return dial(netw, addr)
+	}
+	c, err := dial("tcp", u.Host)
+	if err != nil {
+		return nil, fmt.Errorf("proxy %s: %v", u.Host, err)
+	}
+	switch u.Scheme {
+	case "socks5", "socks5h":
+		err = socks5Connect(c, u, addr)
+	case "http":
+		err = httpConnect(c, u, addr)
+	default:
+		err = fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+	}
+	if err != nil {
+		c.Close()
+		return nil, fmt.Errorf("proxy %s: %v", u.Host, err)
+	}
+	return c, nil
+}
+
+// maxConnectResponse is the biggest response to CONNECT accepted from a
+// proxy.
+const maxConnectResponse = 8192
+
+// httpConnect asks the HTTP proxy on c to connect to addr with the CONNECT
+// method.
+func httpConnect(c net.Conn, u *url.URL, addr string) error {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if u.User != nil {
+		pw, _ := u.User.Password()
+		auth := base64.StdEncoding.EncodeToString([]byte(u.User.Username() + ":" + pw))
+		req.Header.Set("Proxy-Authorization", "Basic "+auth)
+	}
+	if err := req.Write(c); err != nil {
+		return err
+	}
+	// The header is read byte by byte, so that no byte of the connection
+	// after it is lost.
+	var head []byte
+	b := make([]byte, 1)
+	for !bytes.HasSuffix(head, []byte("\r\n\r\n")) {
+		if len(head) > maxConnectResponse {
+			return errors.New("response of proxy too long")
+		}
+		if _, err := io.ReadFull(c, b); err != nil {
+			return err
+		}
+		head = append(head, b[0])
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(head)), req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New("CONNECT failed: " + resp.Status)
+	}
+	return nil
+}
+
+const (
+	socks5Version      = 5
+	socks5NoAuth       = 0
+	socks5UserPassword = 2
+	socks5NoAcceptable = 0xff
+	socks5CmdConnect   = 1
+	socks5IPv4         = 1
+	socks5Domain       = 3
+	socks5IPv6         = 4
+)
+
+// socks5Connect asks the SOCKS5 proxy on c to connect to addr, as in RFC
+// 1928, with the username and password of RFC 1929 if u has a user.
+func socks5Connect(c net.Conn, u *url.URL, addr string) error {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 0 || port > 0xffff {
+		return errors.New("invalid port " + portStr)
+	}
+
+	methods := []byte{socks5NoAuth}
+	if u.User != nil {
+		methods = []byte{socks5UserPassword}
+	}
+	if _, err := c.Write(append([]byte{socks5Version, byte(len(methods))}, methods...)); err != nil {
+		return err
+	}
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(c, buf); err != nil {
+		return err
+	}
+	if buf[0] != socks5Version || buf[1] == socks5NoAcceptable || buf[1] != methods[0] {
+		return errors.New("no acceptable authentication method")
+	}
+	if buf[1] == socks5UserPassword {
+		user := u.User.Username()
+		pw, _ := u.User.Password()
+		if len(user) > 255 || len(pw) > 255 {
+			return errors.New("username or password too long")
+		}
+		req := []byte{1, byte(len(user))}
+		req = append(req, user...)
+		req = append(req, byte(len(pw)))
+		req = append(req, pw...)
+		if _, err := c.Write(req); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(c, buf); err != nil {
+			return err
+		}
+		if buf[1] != 0 {
+			return errors.New("authentication failed")
+		}
+	}
+
+	req := []byte{socks5Version, socks5CmdConnect, 0}
+	if ip := net.ParseIP(host); ip == nil {
+		if len(host) > 255 {
+			return errors.New("host name too long")
+		}
+		req = append(req, socks5Domain, byte(len(host)))
+		req = append(req, host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		req = append(req, socks5IPv4)
+		req = append(req, ip4...)
+	} else {
+		req = append(req, socks5IPv6)
+		req = append(req, ip.To16()...)
+	}
+	req = append(req, byte(port>>8), byte(port))
+	if _, err := c.Write(req); err != nil {
+		return err
+	}
+
+	// version, reply, reserved, address type, then the bound address
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(c, head); err != nil {
+		return err
+	}
+	if head[1] != 0 {
+		return fmt.Errorf("connection refused by proxy with code %d", head[1])
+	}
+	var addrLen int
+	switch head[3] {
+	case socks5IPv4:
+		addrLen = net.IPv4len
+	case socks5IPv6:
+		addrLen = net.IPv6len
+	case socks5Domain:
+		if _, err := io.ReadFull(c, buf[:1]); err != nil {
+			return err
+		}
+		addrLen = int(buf[0])
+	default:
+		return errors.New("unknown address type in reply")
+	}
+	// the bound address and port are not needed
+	_, err = io.ReadFull(c, make([]byte, addrLen+2))
+	return err
+}
@@ -0,0 +1,259 @@
+package network
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testProxy counts the connections that went through it.
+type testProxy struct {
+	net.Listener
+	conns int
+	sync.Mutex
+}
+
+func (p *testProxy) count() int {
+	p.Lock()
+	defer p.Unlock()
+	return p.conns
+}
+
+// pipe connects c to addr and copies the data in both directions.
+func (p *testProxy) pipe(c net.Conn, addr string) error {
+	remote, err := net.Dial("tcp", addr)
+	if err != nil {
+		return err
+	}
+	p.Lock()
+	p.conns++
+	p.Unlock()
+	go func() {
+		io.Copy(remote, c)
+		remote.Close()
+	}()
+	go func() {
+		io.Copy(c, remote)
+		c.Close()
+	}()
+	return nil
+}
+
+// newSOCKS5Proxy starts a SOCKS5 proxy accepting the user and password
+// if user is not empty.
+func newSOCKS5Proxy(t *testing.T, user, pw string) *testProxy {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	p := &testProxy{Listener: l}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				if err := p.socks5(c, user, pw); err != nil {
+					c.Close()
+				}
+			}()
+		}
+	}()
+	return p
+}
+
+func (p *testProxy) socks5(c net.Conn, user, pw string) error {
+	buf := make([]byte, 257)
+	if _, err := io.ReadFull(c, buf[:2]); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(c, buf[:buf[1]]); err != nil {
+		return err
+	}
+	method := byte(socks5NoAuth)
+	if user != "" {
+		method = socks5UserPassword
+	}
+	if buf[0] != method {
+		c.Write([]byte{socks5Version, socks5NoAcceptable})
+		return io.EOF
+	}
+	c.Write([]byte{socks5Version, method})
+	if user != "" {
+		r := bufio.NewReader(c)
+		r.ReadByte()
+		l, _ := r.ReadByte()
+		u := make([]byte, l)
+		io.ReadFull(r, u)
+		l, _ = r.ReadByte()
+		pass := make([]byte, l)
+		io.ReadFull(r, pass)
+		if string(u) != user || string(pass) != pw {
+			c.Write([]byte{1, 1})
+			return io.EOF
+		}
+		c.Write([]byte{1, 0})
+	}
+	if _, err := io.ReadFull(c, buf[:4]); err != nil {
+		return err
+	}
+	var host string
+	switch buf[3] {
+	case socks5IPv4:
+		io.ReadFull(c, buf[:4])
+		host = net.IP(buf[:4]).String()
+	case socks5IPv6:
+		io.ReadFull(c, buf[:16])
+		host = net.IP(buf[:16]).String()
+	case socks5Domain:
+		io.ReadFull(c, buf[:1])
+		l := buf[0]
+		io.ReadFull(c, buf[:l])
+		host = string(buf[:l])
+	}
+	io.ReadFull(c, buf[:2])
+	port := int(buf[0])<<8 | int(buf[1])
+	if err := p.pipe(c, net.JoinHostPort(host, strconv.Itoa(port))); err != nil {
+		c.Write([]byte{socks5Version, 5, 0, socks5IPv4, 0, 0, 0, 0, 0, 0})
+		return err
+	}
+	_, err := c.Write([]byte{socks5Version, 0, 0, socks5IPv4, 127, 0, 0, 1, 0, 0})
+	return err
+}
+
+// newHTTPProxy starts an HTTP proxy supporting CONNECT.
+func newHTTPProxy(t *testing.T) *testProxy {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	p := &testProxy{Listener: l}
+	go http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			http.Error(w, "only CONNECT", http.StatusMethodNotAllowed)
+			return
+		}
+		c, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		remote := r.Host
+		if _, err := c.Write([]byte("HTTP/1.1 200 OK\r\n\r\n")); err != nil {
+			c.Close()
+			return
+		}
+		if err := p.pipe(c, remote); err != nil {
+			c.Close()
+		}
+	}))
+	return p
+}
+
+func proxyURL(t *testing.T, s string) *url.URL {
+	u, err := url.Parse(s)
+	require.Nil(t, err)
+	return u
+}
+
+func TestDialProxy(t *testing.T) {
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer echo.Close()
+	go func() {
+		for {
+			c, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(c, c)
+		}
+	}()
+
+	socks := newSOCKS5Proxy(t, "", "")
+	defer socks.Close()
+	socksAuth := newSOCKS5Proxy(t, "alice", "secret")
+	defer socksAuth.Close()
+	httpProxy := newHTTPProxy(t)
+	defer httpProxy.Close()
+
+	for _, u := range []string{
+		"socks5://" + socks.Addr().String(),
+		"socks5://alice:secret@" + socksAuth.Addr().String(),
+		"http://" + httpProxy.Addr().String(),
+	} {
+		c, err := DialProxy("tcp", echo.Addr().String(), ProxyURL(proxyURL(t, u)))
+		require.Nil(t, err, u)
+		_, err = c.Write([]byte("hello"))
+		require.Nil(t, err)
+		buf := make([]byte, 5)
+		_, err = io.ReadFull(c, buf)
+		require.Nil(t, err)
+		require.Equal(t, "hello", string(buf))
+		c.Close()
+	}
+	require.Equal(t, 1, socks.count())
+	require.Equal(t, 1, socksAuth.count())
+	require.Equal(t, 1, httpProxy.count())
+
+	_, err = DialProxy("tcp", echo.Addr().String(),
+		ProxyURL(proxyURL(t, "socks5://alice:wrong@"+socksAuth.Addr().String())))
+	require.NotNil(t, err)
+	_, err = DialProxy("tcp", echo.Addr().String(),
+		ProxyURL(proxyURL(t, "ftp://"+socks.Addr().String())))
+	require.NotNil(t, err)
+}
+
+func TestProxyPerHost(t *testing.T) {
+	def := proxyURL(t, "socks5://127.0.0.1:1080")
+	other := proxyURL(t, "http://127.0.0.1:3128")
+	p := ProxyPerHost(map[string]*url.URL{
+		"10.0.0.1": nil,
+		"10.0.0.2": other,
+	}, ProxyURL(def))
+	for addr, exp := range map[string]*url.URL{
+		"10.0.0.1:2000": nil,
+		"10.0.0.2:2000": other,
+		"10.0.0.3:2000": def,
+	} {
+		u, err := p(addr)
+		require.Nil(t, err)
+		require.Equal(t, exp, u, addr)
+	}
+	_, err := p("no port")
+	require.NotNil(t, err)
+
+	u, err := ProxyPerHost(nil, nil)("10.0.0.3:2000")
+	require.Nil(t, err)
+	require.Nil(t, u)
+}
+
+func TestRouter_SetProxy(t *testing.T) {
+	socks := newSOCKS5Proxy(t, "", "")
+	defer socks.Close()
+
+	h1, err := NewTestRouterTCP(0)
+	require.Nil(t, err)
+	h2, err := NewTestRouterTCP(0)
+	require.Nil(t, err)
+	go h1.Start()
+	go h2.Start()
+	defer h1.Stop()
+	defer h2.Stop()
+	require.Nil(t, h1.SetProxy(ProxyURL(proxyURL(t, "socks5://"+socks.Addr().String()))))
+
+	proc := make(envelopeProc, 1)
+	h2.RegisterProcessor(proc, SimpleMessageType)
+	_, err = h1.Send(h2.ServerIdentity, &SimpleMessage{3})
+	require.Nil(t, err)
+	env := <-proc
+	require.Equal(t, 3, env.Msg.(*SimpleMessage).I)
+	require.Equal(t, 1, socks.count())
+
+	local, err := NewTestRouterLocal(2001)
+	require.Nil(t, err)
+	require.NotNil(t, local.SetProxy(nil))
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/dedis/kyber/util/encoding"
 	"github.com/dedis/onet/log"
@@ -47,6 +48,9 @@ type Router struct {
 	// Closed, or EOF). Those handler should be added by using SetErrorHandler(). The 1st argument is the remote
 	// server with whom the error happened
 	connectionErrorHandlers []func(*ServerIdentity)
+	// connectHandlers are called when a new connection is set up, see
+	// AddConnectHandler.
+	connectHandlers []func(*ServerIdentity)
 
 	// keep bandwidth of closed connections
 	traffic counterSafe
@@ -56,6 +60,48 @@ type Router struct {
 	// This field should only be set during testing. It disables an important
 	// log message meant to discourage TCP connections.
 	UnauthOk bool
+	// maxPacketSize is the biggest packet accepted on new connections.
+	maxPacketSize Size
+	// suite decodes the relayed messages, it is taken from the host.
+	suite Suite
+	// rendezvous relays the messages to servers that cannot be reached,
+	// see SetRendezvous.
+	rendezvous     *ServerIdentity
+	rendezvousStop chan bool
+	// relay is true if the router relays messages for others.
+	relay bool
+	// unreachable holds when the servers that are reached through the
+	// rendezvous failed to connect.
+	unreachable map[ServerIdentityID]time.Time
+	// latencies are the times it took to connect to the addresses of the
+	// servers with more than one address, see connect.
+	latencies map[Address]time.Duration
+	// peers holds the state of the connections to every server.
+	peers peers
+	// sendQueues order the messages waiting for a connection by priority.
+	sendQueues map[Conn]*sendQueue
+	// acl refuses incoming connections, see SetACL.
+	acl *ACL
+	// clock measures the timeouts and the intervals, see SetClock.
+	clock     Clock
+	clockLock sync.Mutex
+}
+
+// PacketSizeLimit is sent by both sides after the ServerIdentity when a new
+// connection is set up. It announces the biggest packet the sender accepts,
+// so that the other side can refuse to send bigger messages right away.
+type PacketSizeLimit struct {
+	Max Size
+}
+
+// PacketSizeLimitType is the message type of PacketSizeLimit.
+var PacketSizeLimitType = RegisterMessage(PacketSizeLimit{})
+
+// packetLimiter is implemented by connections that check the size of the
+// packets.
+type packetLimiter interface {
+	SetMaxPacketSize(max Size)
+	setRemoteMaxPacketSize(max Size)
 }
 
 // NewRouter returns a new Router attached to a ServerIdentity and the host we want to
@@ -67,11 +113,74 @@ func NewRouter(own *ServerIdentity, h Host) *Router {
 		host:                    h,
 		Dispatcher:              NewBlockingDispatcher(),
 		connectionErrorHandlers: make([]func(*ServerIdentity), 0),
+		maxPacketSize:           MaxPacketSize,
+		clock:                   RealClock,
 	}
+	r.peers.interval = DefaultPingInterval
 	r.address = h.Address()
+	switch h := h.(type) {
+	case *TCPHost:
+		r.suite = h.suite
+	case *LocalHost:
+		r.suite = h.suite
+	}
 	return r
 }
 
+// SetClock sets the clock of the pings and of the keep-alives of the
+// rendezvous. It is meant for tests, which can pass a MockClock.
+func (r *Router) SetClock(c Clock) {
+	r.clockLock.Lock()
+	defer r.clockLock.Unlock()
+	r.clock = c
+}
+
+// Clock returns the clock used by the router.
+func (r *Router) Clock() Clock {
+	r.clockLock.Lock()
+	defer r.clockLock.Unlock()
+	if r.clock == nil {
+		return RealClock
+	}
+	return r.clock
+}
+
+// MaxPacketSize returns the biggest packet accepted by this router.
+func (r *Router) MaxPacketSize() Size {
+	r.Lock()
+	defer r.Unlock()
+	return r.maxPacketSize
+}
+
+// SetMaxPacketSize changes the biggest packet accepted by this router. The
+// new limit is also announced to the remotes of open connections.
+func (r *Router) SetMaxPacketSize(max Size) {
+	r.Lock()
+	r.maxPacketSize = max
+	var conns []Conn
+	for _, arr := range r.connections {
+		conns = append(conns, arr...)
+	}
+	r.Unlock()
+	for _, c := range conns {
+		r.announcePacketSize(c)
+	}
+}
+
+// announcePacketSize sets the limit of the router on the connection and
+// sends it to the remote.
+func (r *Router) announcePacketSize(c Conn) {
+	pl, ok := c.(packetLimiter)
+	if !ok {
+		return
+	}
+	max := r.MaxPacketSize()
+	pl.SetMaxPacketSize(max)
+	if _, err := c.Send(&PacketSizeLimit{Max: max}); err != nil {
+		log.Lvl3(r.address, "couldn't announce packet size:", err)
+	}
+}
+
 // Pause casues the router to stop after reading the next incoming message. It
 // sleeps until it is woken up by Unpause. For testing use only.
 func (r *Router) Pause() {
@@ -99,6 +208,12 @@ func (r *Router) Start() {
 	// Any incoming connection waits for the remote server identity
 	// and will create a new handling routine.
 	err := r.host.Listen(func(c Conn) {
+		acl := r.ACL()
+		if !acl.AllowsAddress(c.Remote().String()) {
+			log.Lvl2(r.address, "refuses connection from", c.Remote())
+			c.Close()
+			return
+		}
 		dst, err := r.receiveServerIdentity(c)
 		if err != nil {
 			log.Error("receive server identity failed:", err)
@@ -108,6 +223,12 @@ func (r *Router) Start() {
 			}
 			return
 		}
+		if !acl.AllowsIdentity(dst) {
+			log.Lvl2(r.address, "refuses connection from", dst)
+			c.Close()
+			return
+		}
+		r.announcePacketSize(c)
 		if err := r.registerConnection(dst, c); err != nil {
 			log.Lvl3(r.address, "does not accept incoming connection from", c.Remote(), "because it's closed")
 			return
@@ -135,6 +256,10 @@ func (r *Router) Stop() error {
 	r.Lock()
 	// set the isClosed to true
 	r.isClosed = true
+	if r.rendezvousStop != nil {
+		close(r.rendezvousStop)
+		r.rendezvousStop = nil
+	}
 
 	// then close all connections
 	for _, arr := range r.connections {
@@ -155,8 +280,15 @@ func (r *Router) Stop() error {
 	return nil
 }
 
-// Send sends to an ServerIdentity without wrapping the msg into a ProtocolMsg
+// Send sends to an ServerIdentity without wrapping the msg into a ProtocolMsg.
+// The message has the priority of its type, see SetMessagePriority.
 func (r *Router) Send(e *ServerIdentity, msg Message) (uint64, error) {
+	return r.SendPriority(e, msg, MessagePriority(msg))
+}
+
+// SendPriority is like Send, but the message waits for the connection with
+// the given priority instead of the one of its type.
+func (r *Router) SendPriority(e *ServerIdentity, msg Message, prio Priority) (uint64, error) {
 	if msg == nil {
 		return 0, errors.New("Can't send nil-packet")
 	}
@@ -164,17 +296,25 @@ func (r *Router) Send(e *ServerIdentity, msg Message) (uint64, error) {
 	var totSentLen uint64
 	c := r.connection(e.ID)
 	if c == nil {
+		rdv := r.relayTo(e)
+		if rdv != nil && r.relayed(e) {
+			return r.sendRelay(rdv, e, msg)
+		}
 		var sentLen uint64
 		var err error
 		c, sentLen, err = r.connect(e)
 		totSentLen += sentLen
 		if err != nil {
+			if rdv != nil {
+				log.Lvl3(r.address, "couldn't connect to", e.Address, ":", err)
+				return r.sendRelay(rdv, e, msg)
+			}
 			return totSentLen, err
 		}
 	}
 
 	log.Lvlf4("%s sends to %s msg: %+v", r.address, e, msg)
-	sentLen, err := c.Send(msg)
+	sentLen, err := r.sendConn(c, msg, prio)
 	totSentLen += sentLen
 	if err != nil {
 		log.Lvl2(r.address, "Couldn't send to", e, ":", err, "trying again")
@@ -183,30 +323,54 @@ func (r *Router) Send(e *ServerIdentity, msg Message) (uint64, error) {
 		if err != nil {
 			return totSentLen, err
 		}
-		sentLen, err = c.Send(msg)
+		sentLen, err = r.sendConn(c, msg, prio)
 		totSentLen += sentLen
 		if err != nil {
 			return totSentLen, err
 		}
 	}
+	r.peers.sent(e)
 	log.Lvl5("Message sent")
 	return totSentLen, nil
 }
 
+// sendConn sends msg on c once the messages of higher priority waiting for
+// c are sent.
+func (r *Router) sendConn(c Conn, msg Message, prio Priority) (uint64, error) {
+	r.Lock()
+	if r.sendQueues == nil {
+		r.sendQueues = make(map[Conn]*sendQueue)
+	}
+	q, ok := r.sendQueues[c]
+	if !ok {
+		q = &sendQueue{}
+		r.sendQueues[c] = q
+	}
+	r.Unlock()
+	q.lock(prio)
+	defer q.unlock()
+	n, err := c.Send(msg)
+	if err != nil {
+		// the connection may be removed already
+		r.Lock()
+		delete(r.sendQueues, c)
+		r.Unlock()
+	}
+	return n, err
+}
+
 // connect starts a new connection and launches the listener for incoming
 // messages.
 func (r *Router) connect(si *ServerIdentity) (Conn, uint64, error) {
-	log.Lvl3(r.address, "Connecting to", si.Address)
-	c, err := r.host.Connect(si)
+	c, err := r.connectAddresses(si)
 	if err != nil {
-		log.Lvl3("Could not connect to", si.Address, err)
 		return nil, 0, err
 	}
-	log.Lvl3(r.address, "Connected to", si.Address)
 	var sentLen uint64
-	if sentLen, err = c.Send(r.ServerIdentity); err != nil {
+	if sentLen, err = c.Send(r.ServerIdentity.Copy()); err != nil {
 		return nil, sentLen, err
 	}
+	r.announcePacketSize(c)
 
 	if err = r.registerConnection(si, c); err != nil {
 		return nil, sentLen, err
@@ -222,6 +386,7 @@ func (r *Router) connect(si *ServerIdentity) (Conn, uint64, error) {
 func (r *Router) removeConnection(si *ServerIdentity, c Conn) {
 	r.Lock()
 	defer r.Unlock()
+	delete(r.sendQueues, c)
 
 	var toDelete = -1
 	arr := r.connections[si.ID]
@@ -262,10 +427,18 @@ func (r *Router) handleConn(remote *ServerIdentity, c Conn) {
 		r.traffic.updateTx(tx)
 		r.wg.Done()
 		r.removeConnection(remote, c)
+		r.peers.closed(remote, c)
 		log.Lvl4("onet close", c.Remote(), "rx", rx, "tx", tx)
 	}()
+	r.peers.opened(remote, c)
+	done := make(chan bool)
+	defer close(done)
+	go r.pingLoop(remote, done)
 	address := c.Remote()
 	log.Lvl3(r.address, "Handling new connection from", remote.Address)
+	for _, h := range r.connectHandlers {
+		h(remote)
+	}
 	for {
 		packet, err := c.Receive()
 
@@ -300,14 +473,33 @@ func (r *Router) handleConn(remote *ServerIdentity, c Conn) {
 				return
 			}
 			// Temporary error, continue.
-			log.Lvl3(r.ServerIdentity, "Error with connection", address, "=>", err)
+			log.RateLimited(10).Lvl3(r.ServerIdentity, "Error with connection", address, "=>", err)
 			continue
 		}
 
 		packet.ServerIdentity = remote
+		r.peers.received(remote)
+
+		if psl, ok := packet.Msg.(*PacketSizeLimit); ok {
+			if pl, ok := c.(packetLimiter); ok {
+				pl.setRemoteMaxPacketSize(psl.Max)
+			}
+			continue
+		}
+
+		switch m := packet.Msg.(type) {
+		case *RelayKeepAlive:
+			continue
+		case *RelayMsg:
+			r.handleRelay(remote, m)
+			continue
+		case *PeerPing, *PeerPong:
+			r.handlePing(remote, m)
+			continue
+		}
 
 		if err := r.Dispatch(packet); err != nil {
-			log.Lvl3("Error dispatching:", err)
+			log.RateLimited(10).Lvl3("Error dispatching:", err)
 		}
 
 	}
@@ -431,6 +623,11 @@ func (r *Router) receiveServerIdentity(c Conn) (*ServerIdentity, error) {
 				return nil, errors.New("mismatch between certificate CommonName and ServerIdentity.Public")
 			}
 			log.Lvl4(r.address, "Public key from CommonName and ServerIdentity match:", pub)
+		} else if nc, ok := tcpConn.conn.(*noiseConn); ok {
+			if nc.remote == nil || !nc.remote.Equal(dst.Public) {
+				return nil, errors.New("mismatch between Noise static key and ServerIdentity.Public")
+			}
+			log.Lvl4(r.address, "Public key from Noise handshake and ServerIdentity match:", nc.remote)
 		} else {
 			// We get here for TCPConn && !tls.Conn. Make them wish they were using TLS...
 			if !r.UnauthOk {
@@ -442,6 +639,13 @@ func (r *Router) receiveServerIdentity(c Conn) (*ServerIdentity, error) {
 	return dst, nil
 }
 
+// AddConnectHandler adds a function called for every new connection, be it
+// opened by us or by the remote server. It must be added before the router
+// starts.
+func (r *Router) AddConnectHandler(h func(*ServerIdentity)) {
+	r.connectHandlers = append(r.connectHandlers, h)
+}
+
 // AddErrorHandler adds a network error handler function for this router. The functions will be called
 // on network error (e.g. Timeout, Connection Closed, or EOF) with the identity of the faulty
 // remote host as 1st parameter.
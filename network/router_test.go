@@ -526,3 +526,76 @@ func waitTimeout(timeout time.Duration, repeat int,
 	}
 
 }
+
+// Test that the maximum packet size of a router is announced to the remote
+// and that too big messages are refused before being sent.
+func TestRouterMaxPacketSize(t *testing.T) {
+	h1, err1 := NewTestRouterTCP(2111)
+	h2, err2 := NewTestRouterTCP(2112)
+	if err1 != nil || err2 != nil {
+		t.Fatal("Could not setup hosts")
+	}
+	require.Equal(t, MaxPacketSize, h1.MaxPacketSize())
+	h2.SetMaxPacketSize(1000)
+	go h1.Start()
+	go h2.Start()
+	defer h1.Stop()
+	defer h2.Stop()
+
+	proc := &simpleMessageProc{t, make(chan SimpleMessage)}
+	h2.RegisterProcessor(proc, SimpleMessageType)
+	_, err := h1.Send(h2.ServerIdentity, &SimpleMessage{3})
+	require.Nil(t, err)
+	<-proc.relay
+
+	c := h1.connection(h2.ServerIdentity.ID).(*TCPConn)
+	for i := 0; i < 20 && c.remoteMaxPacketSize() == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.Equal(t, Size(1000), c.remoteMaxPacketSize())
+
+	_, err = h1.Send(h2.ServerIdentity, &BigMsg{Array: make([]byte, 2000)})
+	require.Equal(t, ErrPacketTooBig, err)
+	_, err = h1.Send(h2.ServerIdentity, &BigMsg{Array: make([]byte, 500)})
+	require.Nil(t, err)
+
+	// Raising the limit is announced on the open connection.
+	h2.SetMaxPacketSize(4000)
+	for i := 0; i < 20 && c.remoteMaxPacketSize() != 4000; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	_, err = h1.Send(h2.ServerIdentity, &BigMsg{Array: make([]byte, 2000)})
+	require.Nil(t, err)
+}
+
+// Test that the connect handlers are called on both sides of a new
+// connection.
+func TestRouterConnectHandler(t *testing.T) {
+	h1, err1 := NewTestRouterTCP(2113)
+	h2, err2 := NewTestRouterTCP(2114)
+	if err1 != nil || err2 != nil {
+		t.Fatal("Could not setup hosts")
+	}
+	connected1 := make(chan *ServerIdentity, 1)
+	connected2 := make(chan *ServerIdentity, 1)
+	h1.AddConnectHandler(func(si *ServerIdentity) { connected1 <- si })
+	h2.AddConnectHandler(func(si *ServerIdentity) { connected2 <- si })
+	go h1.Start()
+	go h2.Start()
+	defer h1.Stop()
+	defer h2.Stop()
+
+	_, err := h1.Send(h2.ServerIdentity, &SimpleMessage{3})
+	require.Nil(t, err)
+	for _, c := range []struct {
+		ch  chan *ServerIdentity
+		exp *ServerIdentity
+	}{{connected1, h2.ServerIdentity}, {connected2, h1.ServerIdentity}} {
+		select {
+		case si := <-c.ch:
+			require.True(t, si.ID.Equal(c.exp.ID))
+		case <-time.After(time.Second):
+			t.Fatal("connect handler not called")
+		}
+	}
+}
@@ -3,6 +3,7 @@ package network
 import (
 	"bytes"
 	"errors"
+	"net"
 	"strings"
 	"sync"
 	"time"
@@ -33,6 +34,10 @@ var ErrEOF = errors.New("EOF")
 // ErrCanceled means something went wrong in the sending or receiving part.
 var ErrCanceled = errors.New("Operation Canceled")
 
+// ErrPacketTooBig is returned if a message is bigger than the maximum packet
+// size announced by the remote.
+var ErrPacketTooBig = errors.New("packet too big for remote")
+
 // ErrTimeout is raised if the timeout has been reached.
 var ErrTimeout = errors.New("Timeout Error")
 
@@ -60,6 +65,8 @@ type Envelope struct {
 	Msg Message
 	// which constructors are used
 	Constructors protobuf.Constructors
+	// Size of the message on the wire, 0 if unknown
+	Size Size
 }
 
 // ServerIdentity is used to represent a Server in the whole internet.
@@ -73,6 +80,12 @@ type ServerIdentity struct {
 	Address Address
 	// Description of the server
 	Description string
+	// AltAddresses are other addresses of the server, for example an
+	// internal and a public one. They are tried after Address.
+	AltAddresses []Address
+	// SRV, if set, is a DNS SRV name, like "_conode._tcp.example.org",
+	// giving more addresses of the server.
+	SRV string
 	// This is the private key, may be nil. It is not exported so that it will never
 	// be marshalled.
 	private kyber.Scalar
@@ -105,8 +118,10 @@ var ServerIdentityType = RegisterMessage(ServerIdentity{})
 
 // ServerIdentityToml is the struct that can be marshalled into a toml file
 type ServerIdentityToml struct {
-	Public  string
-	Address Address
+	Public       string
+	Address      Address
+	AltAddresses []Address `toml:",omitempty"`
+	SRV          string    `toml:",omitempty"`
 }
 
 // NewServerIdentity creates a new ServerIdentity based on a public key and with a slice
@@ -129,20 +144,64 @@ func (si *ServerIdentity) Equal(e2 *ServerIdentity) bool {
 	return si.Public.Equal(e2.Public)
 }
 
+// keysLock protects the keys of the ServerIdentities against SetKeys.
+var keysLock sync.RWMutex
+
 // SetPrivate sets a private key associated with this ServerIdentity.
 // It will not be marshalled or output as Toml.
 //
 // Before calling NewTCPRouter for a TLS server, you must set the private
 // key with SetPrivate.
 func (si *ServerIdentity) SetPrivate(p kyber.Scalar) {
+	keysLock.Lock()
+	defer keysLock.Unlock()
 	si.private = p
 }
 
 // GetPrivate returns the private key set with SetPrivate.
 func (si *ServerIdentity) GetPrivate() kyber.Scalar {
+	keysLock.RLock()
+	defer keysLock.RUnlock()
 	return si.private
 }
 
+// SetKeys replaces the keypair of the ServerIdentity, keeping its ID, so
+// that the rosters and trees holding the ID still find it. It is used to
+// rotate the key of a running server: while it can be called, the public
+// key must be read with GetPublic and the ServerIdentity copied with Copy
+// before being sent.
+func (si *ServerIdentity) SetKeys(public kyber.Point, private kyber.Scalar) {
+	keysLock.Lock()
+	defer keysLock.Unlock()
+	si.Public = public
+	si.private = private
+}
+
+// GetPublic returns the public key, see SetKeys.
+func (si *ServerIdentity) GetPublic() kyber.Point {
+	keysLock.RLock()
+	defer keysLock.RUnlock()
+	return si.Public
+}
+
+// keys returns the keypair, both from before or both from after a call to
+// SetKeys.
+func (si *ServerIdentity) keys() (kyber.Point, kyber.Scalar) {
+	keysLock.RLock()
+	defer keysLock.RUnlock()
+	return si.Public, si.private
+}
+
+// Copy returns a copy of the ServerIdentity, without the private key, see
+// SetKeys.
+func (si *ServerIdentity) Copy() *ServerIdentity {
+	keysLock.RLock()
+	defer keysLock.RUnlock()
+	cp := *si
+	cp.private = nil
+	return &cp
+}
+
 // Toml converts an ServerIdentity to a Toml-structure
 func (si *ServerIdentity) Toml(suite Suite) *ServerIdentityToml {
 	var buf bytes.Buffer
@@ -150,8 +209,10 @@ func (si *ServerIdentity) Toml(suite Suite) *ServerIdentityToml {
 		log.Error("Error while writing public key:", err)
 	}
 	return &ServerIdentityToml{
-		Address: si.Address,
-		Public:  buf.String(),
+		Address:      si.Address,
+		Public:       buf.String(),
+		AltAddresses: si.AltAddresses,
+		SRV:          si.SRV,
 	}
 }
 
@@ -162,19 +223,22 @@ func (si *ServerIdentityToml) ServerIdentity(suite Suite) *ServerIdentity {
 		log.Error("Error while reading public key:", err)
 	}
 	return &ServerIdentity{
-		Public:  pub,
-		Address: si.Address,
+		Public:       pub,
+		Address:      si.Address,
+		AltAddresses: si.AltAddresses,
+		SRV:          si.SRV,
 	}
 }
 
 // GlobalBind returns the global-binding address. Given any IP:PORT combination,
-// it will return 0.0.0.0:PORT.
+// including a bracketed IPv6 address, it will return :PORT, which listens on
+// all IPv4 and IPv6 addresses of the system.
 func GlobalBind(address string) (string, error) {
-	addr := strings.Split(address, ":")
-	if len(addr) != 2 {
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
 		return "", errors.New("not a host:port address")
 	}
-	return "0.0.0.0:" + addr[1], nil
+	return net.JoinHostPort("", port), nil
 }
 
 // counterSafe is a struct that enables to update two counters Rx & Tx
@@ -42,11 +42,17 @@ func TestServerIdentity(t *testing.T) {
 }
 
 func TestGlobalBind(t *testing.T) {
-	_, err := GlobalBind("127.0.0.1:2000")
-	if err != nil {
+	for _, addr := range []string{"127.0.0.1:2000", "[::1]:2000", "[2001:db8::1]:2000"} {
+		global, err := GlobalBind(addr)
+		if err != nil || global != ":2000" {
+			t.Error("Wrong with global bind", addr, global)
+		}
+	}
+	_, err := GlobalBind("127.0.0.12000")
+	if err == nil {
 		t.Error("Wrong with global bind")
 	}
-	_, err = GlobalBind("127.0.0.12000")
+	_, err = GlobalBind("::1:2000")
 	if err == nil {
 		t.Error("Wrong with global bind")
 	}
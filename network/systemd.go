@@ -0,0 +1,96 @@
+package network
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/dedis/onet/log"
+)
+
+// sdListenFdsStart is the first file descriptor passed by systemd with
+// socket activation.
+const sdListenFdsStart = 3
+
+// activated holds the listeners passed by systemd that are not used yet.
+var activated = struct {
+	listeners []net.Listener
+	once      sync.Once
+	sync.Mutex
+}{}
+
+// sdListenFds returns the number of file descriptors that systemd passed to
+// this process, as told by $LISTEN_PID and $LISTEN_FDS.
+func sdListenFds() int {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return 0
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// loadActivated turns the file descriptors passed by systemd into
+// listeners. The environment variables are removed, so that the children
+// of this process don't take them as theirs.
+func loadActivated() {
+	n := sdListenFds()
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	for fd := sdListenFdsStart; fd < sdListenFdsStart+n; fd++ {
+		f := os.NewFile(uintptr(fd), "systemd-socket-"+strconv.Itoa(fd))
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			log.Error("Couldn't use socket", fd, "passed by systemd:", err)
+			continue
+		}
+		log.Lvl2("Got socket", ln.Addr(), "from systemd")
+		activated.listeners = append(activated.listeners, ln)
+	}
+}
+
+// ActivatedListener returns the listener that systemd passed to this
+// process with socket activation for the given host:port, or path of a Unix
+// socket, and nil if there is none. A listener is only returned once. An
+// empty or unspecified host matches the listeners on any address with the
+// same port.
+func ActivatedListener(addr string) net.Listener {
+	activated.once.Do(loadActivated)
+	activated.Lock()
+	defer activated.Unlock()
+	for i, ln := range activated.listeners {
+		if listenerMatches(ln.Addr(), addr) {
+			activated.listeners = append(activated.listeners[:i],
+				activated.listeners[i+1:]...)
+			return ln
+		}
+	}
+	return nil
+}
+
+// listenerMatches returns whether a listener on la can be used to listen on
+// addr.
+func listenerMatches(la net.Addr, addr string) bool {
+	if ua, ok := la.(*net.UnixAddr); ok {
+		return ua.Name == addr
+	}
+	ta, ok := la.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || port != strconv.Itoa(ta.Port) {
+		return false
+	}
+	ip := net.ParseIP(host)
+	if host == "" || ip == nil || ip.IsUnspecified() || ta.IP.IsUnspecified() {
+		return true
+	}
+	return ip.Equal(ta.IP)
+}
@@ -0,0 +1,40 @@
+package network
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestListenerMatches(t *testing.T) {
+	wildcard := &net.TCPAddr{IP: net.IPv4zero, Port: 7770}
+	local := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 7770}
+	unix := &net.UnixAddr{Name: "/run/conode.sock", Net: "unix"}
+
+	require.True(t, listenerMatches(wildcard, ":7770"))
+	require.True(t, listenerMatches(wildcard, "1.2.3.4:7770"))
+	require.False(t, listenerMatches(wildcard, ":7771"))
+	require.True(t, listenerMatches(local, "127.0.0.1:7770"))
+	require.True(t, listenerMatches(local, "0.0.0.0:7770"))
+	require.False(t, listenerMatches(local, "1.2.3.4:7770"))
+	require.False(t, listenerMatches(local, "/run/conode.sock"))
+	require.True(t, listenerMatches(unix, "/run/conode.sock"))
+	require.False(t, listenerMatches(unix, ":7770"))
+}
+
+func TestSdListenFds(t *testing.T) {
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	os.Setenv("LISTEN_FDS", "2")
+	os.Unsetenv("LISTEN_PID")
+	require.Equal(t, 0, sdListenFds())
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+	require.Equal(t, 0, sdListenFds())
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	require.Equal(t, 2, sdListenFds())
+	os.Setenv("LISTEN_FDS", "none")
+	require.Equal(t, 0, sdListenFds())
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"os"
 	"strings"
 	"sync"
 	"time"
@@ -19,8 +20,9 @@ import (
 var readTimeout = 1 * time.Minute
 
 // MaxPacketSize limits the amount of memory that is allocated before a packet
-// is checked and thrown away if it's not legit. If you need more than 10MB
-// packets, increase this value.
+// is checked and thrown away if it's not legit. It is the default for new
+// Routers, use Router.SetMaxPacketSize to change the limit of a single
+// Router.
 var MaxPacketSize = Size(10 * 1024 * 1024)
 
 // NewTCPRouter returns a new Router using TCPHost as the underlying Host.
@@ -33,6 +35,16 @@ func NewTCPRouter(sid *ServerIdentity, suite Suite) (*Router, error) {
 	return r, nil
 }
 
+// NewUnixRouter returns a Router that listens on and connects to Unix
+// sockets. It uses the same TCPHost as NewTCPRouter, so it can also connect
+// to TCP addresses.
+func NewUnixRouter(sid *ServerIdentity, suite Suite) (*Router, error) {
+	if sid.Address.ConnType() != Unix {
+		return nil, errors.New("not a unix address: " + sid.Address.String())
+	}
+	return NewTCPRouter(sid, suite)
+}
+
 // TCPConn implements the Conn interface using plain, unencrypted TCP.
 type TCPConn struct {
 	// The connection used
@@ -49,16 +61,37 @@ type TCPConn struct {
 	// So we only handle one sending packet at a time
 	sendMutex sync.Mutex
 
+	// maxSize is the biggest packet accepted, 0 means MaxPacketSize.
+	maxSize Size
+	// remoteMax is the biggest packet the remote accepts, 0 if unknown.
+	remoteMax Size
+	limitsMut sync.Mutex
+
 	counterSafe
 }
 
 // NewTCPConn will open a TCPConn to the given address.
 // In case of an error it returns a nil TCPConn and the error.
 func NewTCPConn(addr Address, suite Suite) (conn *TCPConn, err error) {
+	return dialConn("tcp", addr, suite, nil)
+}
+
+// NewUnixConn will open a TCPConn to the Unix socket of the given address.
+// The messages are framed the same way as over TCP.
+func NewUnixConn(addr Address, suite Suite) (conn *TCPConn, err error) {
+	if addr.ConnType() != Unix {
+		return nil, errors.New("not a unix address")
+	}
+	return dialConn("unix", addr, suite, nil)
+}
+
+// dialConn connects to addr on the given network, through the proxy if it
+// is not nil, retrying MaxRetryConnect times.
+func dialConn(netw string, addr Address, suite Suite, proxy ProxyFunc) (conn *TCPConn, err error) {
 	netAddr := addr.NetworkAddress()
 	for i := 1; i <= MaxRetryConnect; i++ {
 		var c net.Conn
-		c, err = net.Dial("tcp", netAddr)
+		c, err = DialProxy(netw, netAddr, proxy)
 		if err == nil {
 			conn = &TCPConn{
 				conn:  c,
@@ -89,6 +122,7 @@ func (c *TCPConn) Receive() (env *Envelope, e error) {
 	return &Envelope{
 		MsgType: id,
 		Msg:     body,
+		Size:    Size(len(buff)),
 	}, err
 }
 
@@ -106,9 +140,9 @@ func (c *TCPConn) receiveRaw() ([]byte, error) {
 	if err := binary.Read(c.conn, globalOrder, &total); err != nil {
 		return nil, handleError(err)
 	}
-	if total > MaxPacketSize {
+	if max := c.MaxPacketSize(); total > max {
 		return nil, fmt.Errorf("%v sends too big packet: %v>%v",
-			c.conn.RemoteAddr().String(), total, MaxPacketSize)
+			c.conn.RemoteAddr().String(), total, max)
 	}
 
 	b := make([]byte, total)
@@ -148,9 +182,43 @@ func (c *TCPConn) Send(msg Message) (uint64, error) {
 	if err != nil {
 		return 0, fmt.Errorf("Error marshaling  message: %s", err.Error())
 	}
+	if remote := c.remoteMaxPacketSize(); remote > 0 && Size(len(b)) > remote {
+		return 0, ErrPacketTooBig
+	}
 	return c.sendRaw(b)
 }
 
+// MaxPacketSize returns the biggest packet this connection accepts.
+func (c *TCPConn) MaxPacketSize() Size {
+	c.limitsMut.Lock()
+	defer c.limitsMut.Unlock()
+	if c.maxSize == 0 {
+		return MaxPacketSize
+	}
+	return c.maxSize
+}
+
+// SetMaxPacketSize sets the biggest packet this connection accepts.
+func (c *TCPConn) SetMaxPacketSize(max Size) {
+	c.limitsMut.Lock()
+	defer c.limitsMut.Unlock()
+	c.maxSize = max
+}
+
+// setRemoteMaxPacketSize stores the limit announced by the remote, so that
+// bigger packets are refused before they are sent.
+func (c *TCPConn) setRemoteMaxPacketSize(max Size) {
+	c.limitsMut.Lock()
+	defer c.limitsMut.Unlock()
+	c.remoteMax = max
+}
+
+func (c *TCPConn) remoteMaxPacketSize() Size {
+	c.limitsMut.Lock()
+	defer c.limitsMut.Unlock()
+	return c.remoteMax
+}
+
 // sendRaw writes the number of bytes of the message to the network then the
 // whole message b in slices of size maxChunkSize.
 // In case of an error it aborts.
@@ -260,24 +328,38 @@ type TCPListener struct {
 }
 
 // NewTCPListener returns a TCPListener. This function binds to the given
-// address.
+// address, which can also be a Unix address.
 // It returns the listener and an error if one occurred during
 // the binding.
 // A subsequent call to Address() gives the actual listening
 // address which is different if you gave it a ":0"-address.
 func NewTCPListener(addr Address, s Suite) (*TCPListener, error) {
-	if addr.ConnType() != PlainTCP && addr.ConnType() != TLS {
-		return nil, errors.New("TCPListener can only listen on TCP and TLS addresses")
+	ct := addr.ConnType()
+	if ct != PlainTCP && ct != TLS && ct != Unix && ct != Noise {
+		return nil, errors.New("TCPListener can only listen on TCP, TLS, Noise and Unix addresses")
 	}
 	t := &TCPListener{
-		conntype:     addr.ConnType(),
+		conntype:     ct,
 		quit:         make(chan bool),
 		quitListener: make(chan bool),
 		suite:        s,
 	}
+	netw := "tcp"
 	global, _ := GlobalBind(addr.NetworkAddress())
+	if ct == Unix {
+		netw = "unix"
+		global = addr.NetworkAddress()
+	}
+	if ln := ActivatedListener(global); ln != nil {
+		t.listener = ln
+		t.addr = ln.Addr()
+		return t, nil
+	}
+	if ct == Unix {
+		removeStaleSocket(global)
+	}
 	for i := 0; i < MaxRetryConnect; i++ {
-		ln, err := net.Listen("tcp", global)
+		ln, err := net.Listen(netw, global)
 		if err == nil {
 			t.listener = ln
 			break
@@ -290,6 +372,20 @@ func NewTCPListener(addr Address, s Suite) (*TCPListener, error) {
 	return t, nil
 }
 
+// removeStaleSocket removes the socket file at path if nobody listens on it
+// anymore, for example after a crash.
+func removeStaleSocket(path string) {
+	if _, err := os.Stat(path); err != nil {
+		return
+	}
+	if c, err := net.Dial("unix", path); err == nil {
+		c.Close()
+		return
+	}
+	log.Lvl2("Removing stale socket", path)
+	os.Remove(path)
+}
+
 // Listen starts to listen for incoming connections and calls fn for every
 // connection-request it receives.
 // If the connection is closed, an error will be returned.
@@ -384,6 +480,9 @@ type TCPHost struct {
 	suite Suite
 	sid   *ServerIdentity
 	*TCPListener
+	// proxy, if set, gives the proxies of the outgoing connections.
+	proxy     ProxyFunc
+	proxyLock sync.Mutex
 }
 
 // NewTCPHost returns a new Host using TCP connection based type.
@@ -393,23 +492,62 @@ func NewTCPHost(sid *ServerIdentity, s Suite) (*TCPHost, error) {
 		sid:   sid,
 	}
 	var err error
-	if sid.Address.ConnType() == TLS {
+	switch sid.Address.ConnType() {
+	case TLS:
 		h.TCPListener, err = NewTLSListener(sid, s)
-	} else {
+	case Noise:
+		h.TCPListener, err = NewNoiseListener(sid, s)
+	default:
 		h.TCPListener, err = NewTCPListener(sid.Address, s)
 	}
 	return h, err
 }
 
-// Connect can only connect to PlainTCP connections.
-// It will return an error if it is not a PlainTCP-connection-type.
+// NewTCPHostWithListener is like NewTCPHost, but accepts the connections of
+// ln instead of listening on the address of sid, for example a listener of
+// a Mux.
+func NewTCPHostWithListener(sid *ServerIdentity, s Suite, ln net.Listener) (*TCPHost, error) {
+	ct := sid.Address.ConnType()
+	if ct != PlainTCP && ct != TLS && ct != Noise {
+		return nil, errors.New("can only share the listener of TCP, TLS and Noise addresses")
+	}
+	t := &TCPListener{
+		listener:     ln,
+		addr:         ln.Addr(),
+		conntype:     ct,
+		quit:         make(chan bool),
+		quitListener: make(chan bool),
+		suite:        s,
+	}
+	var err error
+	switch ct {
+	case TLS:
+		t.listener, err = tlsListener(ln, sid, s)
+	case Noise:
+		if sid.GetPrivate() == nil {
+			return nil, errors.New("private key is not set")
+		}
+		t.listener = &noiseListener{ln, s, sid}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &TCPHost{suite: s, sid: sid, TCPListener: t}, nil
+}
+
+// Connect can only connect to PlainTCP, TLS, Noise and Unix connections.
+// It will return an error if it is another connection-type.
 func (t *TCPHost) Connect(si *ServerIdentity) (Conn, error) {
 	switch si.Address.ConnType() {
 	case PlainTCP:
-		c, err := NewTCPConn(si.Address, t.suite)
+		c, err := dialConn("tcp", si.Address, t.suite, t.getProxy())
 		return c, err
+	case Unix:
+		return NewUnixConn(si.Address, t.suite)
 	case TLS:
-		return NewTLSConn(t.sid, si, t.suite)
+		return newTLSConn(t.sid, si, t.suite, t.getProxy())
+	case Noise:
+		return newNoiseConn(t.sid, si, t.suite, t.getProxy())
 	case InvalidConnType:
 		return nil, errors.New("This address is not correctly formatted: " + si.Address.String())
 	}
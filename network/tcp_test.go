@@ -5,7 +5,10 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net"
+	"os"
+	"path"
 	"strconv"
 	"testing"
 	"time"
@@ -417,6 +420,88 @@ func TestTCPRouter(t *testing.T) {
 	}
 }
 
+// skipNoIPv6 skips the test if the system can't listen on the IPv6 loopback.
+func skipNoIPv6(t *testing.T) {
+	l, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Skip("IPv6 is not available:", err)
+	}
+	l.Close()
+}
+
+// The listener accepts IPv4 and IPv6 connections on the same port.
+func TestTCPListenerDualStack(t *testing.T) {
+	skipNoIPv6(t)
+	ln, err := NewTCPListener(NewAddress(PlainTCP, "[::1]:0"), tSuite)
+	require.Nil(t, err)
+	connReceived := make(chan bool)
+	go ln.Listen(func(c Conn) {
+		connReceived <- true
+		c.Close()
+	})
+	defer ln.Stop()
+	port := ln.Address().Port()
+	for _, host := range []string{"127.0.0.1", "::1"} {
+		c, err := net.Dial("tcp", net.JoinHostPort(host, port))
+		require.Nil(t, err, host)
+		<-connReceived
+		c.Close()
+	}
+}
+
+func TestTCPRouterIPv6(t *testing.T) {
+	skipNoIPv6(t)
+	var rs []*Router
+	for i := 0; i < 2; i++ {
+		kp := key.NewKeyPair(tSuite)
+		si := NewServerIdentity(kp.Public, NewAddress(PlainTCP, "[::1]:0"))
+		si.SetPrivate(kp.Private)
+		h, err := NewTCPHost(si, tSuite)
+		require.Nil(t, err)
+		si.Address = NewHostPortAddress(PlainTCP, "::1", h.TCPListener.Address().Port())
+		r := NewRouter(si, h)
+		r.UnauthOk = true
+		go r.Start()
+		defer r.Stop()
+		rs = append(rs, r)
+	}
+
+	proc := newSimpleMessageProc(t)
+	rs[1].RegisterProcessor(proc, SimpleMessageType)
+	_, err := rs[0].Send(rs[1].ServerIdentity, &SimpleMessage{3})
+	require.Nil(t, err)
+	require.Equal(t, 3, (<-proc.relay).I)
+}
+
+func TestUnixRouter(t *testing.T) {
+	_, err := NewUnixRouter(&ServerIdentity{Address: NewAddress(PlainTCP, "127.0.0.1:2000")}, tSuite)
+	require.NotNil(t, err)
+
+	dir, err := ioutil.TempDir("", "unix")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	kp1, kp2 := key.NewKeyPair(tSuite), key.NewKeyPair(tSuite)
+	si1 := NewServerIdentity(kp1.Public, NewUnixAddress(path.Join(dir, "1.sock")))
+	si2 := NewServerIdentity(kp2.Public, NewUnixAddress(path.Join(dir, "2.sock")))
+	r1, err := NewUnixRouter(si1, tSuite)
+	require.Nil(t, err)
+	r2, err := NewUnixRouter(si2, tSuite)
+	require.Nil(t, err)
+	go r1.Start()
+	go r2.Start()
+	defer r1.Stop()
+	defer r2.Stop()
+	for !r1.Listening() || !r2.Listening() {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	proc := newSimpleMessageProc(t)
+	r2.RegisterProcessor(proc, SimpleMessageType)
+	_, err = r1.Send(si2, &SimpleMessage{3})
+	require.Nil(t, err)
+	require.Equal(t, 3, (<-proc.relay).I)
+}
+
 // Test closing and opening of Host on same address
 func TestTCPHostClose(t *testing.T) {
 	h1, err := NewTestTCPHost(2001)
@@ -64,11 +64,9 @@ import (
 // and give it to crypto/tls via the GetCertificate and
 // GetClientCertificate callbacks in the tls.Config structure.
 type certMaker struct {
-	si      *ServerIdentity
-	suite   Suite
-	subj    pkix.Name
-	subjDer []byte // the subject encoded in ASN.1 DER format
-	k       *ecdsa.PrivateKey
+	si    *ServerIdentity
+	suite Suite
+	k     *ecdsa.PrivateKey
 }
 
 func newCertMaker(s Suite, si *ServerIdentity) (*certMaker, error) {
@@ -82,13 +80,6 @@ func newCertMaker(s Suite, si *ServerIdentity) (*certMaker, error) {
 		return nil, err
 	}
 	cm.k = k
-
-	cm.subj = pkix.Name{CommonName: cm.si.Public.String()}
-	der, err := asn1.Marshal(cm.subj.CommonName)
-	if err != nil {
-		panic("unexpected asn.1 marshal failure")
-	}
-	cm.subjDer = der
 	return cm, nil
 }
 
@@ -108,6 +99,15 @@ func (cm *certMaker) get(nonce []byte) (*tls.Certificate, error) {
 		return nil, errors.New("nonce is the wrong size")
 	}
 
+	// The subject is created for every certificate, as the key of the
+	// ServerIdentity can be rotated.
+	public, private := cm.si.keys()
+	subj := pkix.Name{CommonName: public.String()}
+	subjDer, err := asn1.Marshal(subj.CommonName)
+	if err != nil {
+		panic("unexpected asn.1 marshal failure")
+	}
+
 	// Create a signature that proves that:
 	// 1. since the nonce was generated by the peer,
 	// 2. for this public key,
@@ -118,8 +118,8 @@ func (cm *certMaker) get(nonce []byte) (*tls.Certificate, error) {
 	// that anyone trying to check these signatures themselves in antoher language
 	// will be able to easily do so with their own x509 + kyber implementation.
 	buf := bytes.NewBuffer(nonce)
-	buf.Write(cm.subjDer)
-	sig, err := schnorr.Sign(cm.suite, cm.si.GetPrivate(), buf.Bytes())
+	buf.Write(subjDer)
+	sig, err := schnorr.Sign(cm.suite, private, buf.Bytes())
 	if err != nil {
 		return nil, err
 	}
@@ -141,7 +141,7 @@ func (cm *certMaker) get(nonce []byte) (*tls.Certificate, error) {
 		NotBefore:             time.Now().Add(-5 * time.Minute),
 		SerialNumber:          serial,
 		SignatureAlgorithm:    x509.ECDSAWithSHA384,
-		Subject:               cm.subj,
+		Subject:               subj,
 		ExtraExtensions: []pkix.Extension{
 			{
 				Id:       oidDedisSig,
@@ -211,7 +211,15 @@ func NewTLSListener(si *ServerIdentity, suite Suite) (*TCPListener, error) {
 	if err != nil {
 		return nil, err
 	}
+	tcp.listener, err = tlsListener(tcp.listener, si, suite)
+	if err != nil {
+		return nil, err
+	}
+	return tcp, nil
+}
 
+// tlsListener returns ln accepting the TLS connections of other servers.
+func tlsListener(ln net.Listener, si *ServerIdentity, suite Suite) (net.Listener, error) {
 	cfg, err := tlsConfig(suite, si)
 	if err != nil {
 		return nil, err
@@ -242,8 +250,7 @@ func NewTLSListener(si *ServerIdentity, suite Suite) (*TCPListener, error) {
 	// callback, it will still call us.
 	cfg.ClientAuth = tls.RequireAnyClientCert
 
-	tcp.listener = tls.NewListener(tcp.listener, cfg)
-	return tcp, nil
+	return tls.NewListener(ln, cfg), nil
 }
 
 // NewTLSAddress returns a new Address that has type TLS with the given
@@ -359,6 +366,11 @@ func tlsConfig(suite Suite, us *ServerIdentity) (*tls.Config, error) {
 // it holds the given Public key by self-signing a certificate
 // linked to that key.
 func NewTLSConn(us *ServerIdentity, them *ServerIdentity, suite Suite) (conn *TCPConn, err error) {
+	return newTLSConn(us, them, suite, nil)
+}
+
+// newTLSConn is NewTLSConn connecting through the proxy, if it is not nil.
+func newTLSConn(us *ServerIdentity, them *ServerIdentity, suite Suite, proxy ProxyFunc) (conn *TCPConn, err error) {
 	log.Lvl2("NewTLSConn to:", them)
 	if them.Address.ConnType() != TLS {
 		return nil, errors.New("not a tls server")
@@ -374,12 +386,20 @@ func NewTLSConn(us *ServerIdentity, them *ServerIdentity, suite Suite) (conn *TC
 	}
 	vrf, nonce := makeVerifier(suite, them)
 	cfg.VerifyPeerCertificate = vrf
+	cfg.NextProtos = []string{ALPNProto}
 
 	netAddr := them.Address.NetworkAddress()
 	for i := 1; i <= MaxRetryConnect; i++ {
 		var c net.Conn
 		cfg.ServerName = string(nonce)
-		c, err = tls.Dial("tcp", netAddr, cfg)
+		c, err = DialProxy("tcp", netAddr, proxy)
+		if err == nil {
+			tc := tls.Client(c, cfg)
+			if err = tc.Handshake(); err != nil {
+				c.Close()
+			}
+			c = tc
+		}
 		if err == nil {
 			conn = &TCPConn{
 				conn:  c,
@@ -14,6 +14,11 @@ ONet is based on the following pieces:
 If you just want to use an existing protocol, usually the ONet-part is enough.
 If you want to create your own protocol, you have to learn how to use the
 ProtocolInstance.
+
+With GOOS=js and GOARCH=wasm, only the Client and the types it uses, like
+Roster and Status, are built, so that browser applications can talk to the
+servers. The files of the server, which needs the database, have the build
+tag !js.
 */
 package onet
 
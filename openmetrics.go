@@ -0,0 +1,200 @@
+// +build !js
+
+package onet
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dedis/onet/log"
+)
+
+// openMetricsPrefix is prepended to all metric names.
+const openMetricsPrefix = "onet_"
+
+// openMetricsContentType is sent by the /metrics endpoint.
+const openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// ReportStatusOpenMetrics renders the status of all StatusReporters in the
+// OpenMetrics text format. Every numeric value becomes a gauge named
+// onet_<reporter>_<key>. Values of nested maps become gauges named after
+// their inner key, with the outer key as the "key" label. All other values,
+// including strings, are collected as labels of the onet_<reporter>_info
+// metric. If two keys give the same name once sanitised, only the first
+// one in alphabetical order is exported.
+func (s *statusReporterStruct) ReportStatusOpenMetrics() []byte {
+	om := &openMetrics{
+		families: make(map[string][]string),
+		infos:    make(map[string][]string),
+		sources:  make(map[string][2]string),
+	}
+	statuses := s.ReportStatus()
+	reporters := make([]string, 0, len(statuses))
+	for reporter := range statuses {
+		reporters = append(reporters, reporter)
+	}
+	sort.Strings(reporters)
+	for _, reporter := range reporters {
+		st := statuses[reporter]
+		for _, key := range statusKeys(st) {
+			value, _ := st.Value(key)
+			om.add(reporter, key, value)
+		}
+	}
+
+	var buf bytes.Buffer
+	for _, name := range sortedKeys(om.families) {
+		samples := om.families[name]
+		sort.Strings(samples)
+		fmt.Fprintf(&buf, "# TYPE %s gauge\n", name)
+		for _, sample := range samples {
+			buf.WriteString(sample + "\n")
+		}
+	}
+	for _, name := range sortedKeys(om.infos) {
+		labels := om.infos[name]
+		sort.Strings(labels)
+		fmt.Fprintf(&buf, "# TYPE %s info\n", name)
+		fmt.Fprintf(&buf, "%s_info{%s} 1\n", name, strings.Join(labels, ","))
+	}
+	buf.WriteString("# EOF\n")
+	return buf.Bytes()
+}
+
+// statusKeys returns the sorted keys of all views of the status.
+func statusKeys(st *Status) []string {
+	seen := make(map[string]bool)
+	for k := range st.Field {
+		seen[k] = true
+	}
+	for k := range st.Numbers {
+		seen[k] = true
+	}
+	for k := range st.Integers {
+		seen[k] = true
+	}
+	for k := range st.values {
+		seen[k] = true
+	}
+	keys := make([]string, 0, len(seen))
+	for k := range seen {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// openMetrics collects the gauges and the labels of the info metrics, and
+// the reporter and key each sanitised name comes from.
+type openMetrics struct {
+	families map[string][]string
+	infos    map[string][]string
+	sources  map[string][2]string
+}
+
+// claim returns whether name can be used for the key of the reporter, that
+// is if no other key has been exported under the same name.
+func (om *openMetrics) claim(name, reporter, key string) bool {
+	source := [2]string{reporter, key}
+	if other, ok := om.sources[name]; ok && other != source {
+		log.Warnf("OpenMetrics: %s/%s and %s/%s are both exported as %s, skipping the latter",
+			other[0], other[1], reporter, key, name)
+		return false
+	}
+	om.sources[name] = source
+	return true
+}
+
+// add adds the samples of one status value to either the gauges or the
+// labels of the info metric.
+func (om *openMetrics) add(reporter, key string, value interface{}) {
+	if nested, ok := value.(map[string]interface{}); ok {
+		label := fmt.Sprintf(`key="%s"`, openMetricsEscape(key))
+		inners := make([]string, 0, len(nested))
+		for inner := range nested {
+			inners = append(inners, inner)
+		}
+		sort.Strings(inners)
+		for _, inner := range inners {
+			if f, ok := openMetricsValue(nested[inner]); ok {
+				name := openMetricsName(reporter, inner)
+				if om.claim(name, reporter, inner) {
+					om.families[name] = append(om.families[name],
+						fmt.Sprintf("%s{%s} %s", name, label, formatOpenMetric(f)))
+				}
+			}
+		}
+		return
+	}
+	if f, ok := openMetricsValue(value); ok {
+		name := openMetricsName(reporter, key)
+		if om.claim(name, reporter, key) {
+			om.families[name] = append(om.families[name], name+" "+formatOpenMetric(f))
+		}
+		return
+	}
+	name := openMetricsName(reporter, "")
+	label := openMetricsLabel(key)
+	if !om.claim(name+"_info", reporter, "") || !om.claim(name+"{"+label+"}", reporter, key) {
+		return
+	}
+	om.infos[name] = append(om.infos[name], fmt.Sprintf(`%s="%s"`,
+		label, openMetricsEscape(statusString(value))))
+}
+
+func formatOpenMetric(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// openMetricsName returns the metric name for the key of a reporter, with
+// all characters not allowed in metric names replaced by '_'.
+func openMetricsName(reporter, key string) string {
+	name := openMetricsPrefix + reporter
+	if key != "" {
+		name += "_" + key
+	}
+	return openMetricsLabel(name)
+}
+
+// openMetricsLabel replaces all characters that are not allowed in a label
+// name by '_'.
+func openMetricsLabel(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' ||
+			r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// openMetricsEscape escapes a label value.
+func openMetricsEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// GetStatusOpenMetrics returns the status of all reporters of this server in
+// the OpenMetrics text format. The same output is served on the /metrics
+// path of the websocket port, to the clients of the admin API.
+func (c *Server) GetStatusOpenMetrics() []byte {
+	return c.statusReporterStruct.ReportStatusOpenMetrics()
+}
+
+// serveOpenMetrics is the handler of the /metrics path.
+func (c *Server) serveOpenMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", openMetricsContentType)
+	w.Write(c.GetStatusOpenMetrics())
+}
@@ -0,0 +1,82 @@
+package onet
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dedis/onet/log"
+	"github.com/stretchr/testify/assert"
+)
+
+type metricsTestReporter struct{}
+
+func (m *metricsTestReporter) GetStatus() *Status {
+	st := NewStatus()
+	st.Set("Tx.Count", 3)
+	st.Set("Uptime", 1500*time.Millisecond)
+	st.Set("Open", true)
+	st.Set("Version", "2.0")
+	st.Set("Name", `say "hi"`)
+	st.Set("tls://1.2.3.4:2000", map[string]interface{}{"Score": 1.5, "Reports": 2})
+	return st
+}
+
+func TestSRStruct_OpenMetrics(t *testing.T) {
+	srs := newStatusReporterStruct()
+	srs.RegisterStatusReporter("Test", &metricsTestReporter{})
+	srs.RegisterStatusReporter("Dummy", &dummyTestReporter{5})
+	assert.Equal(t, `# TYPE onet_Test_Open gauge
+onet_Test_Open 1
+# TYPE onet_Test_Reports gauge
+onet_Test_Reports{key="tls://1.2.3.4:2000"} 2
+# TYPE onet_Test_Score gauge
+onet_Test_Score{key="tls://1.2.3.4:2000"} 1.5
+# TYPE onet_Test_Tx_Count gauge
+onet_Test_Tx_Count 3
+# TYPE onet_Test_Uptime gauge
+onet_Test_Uptime 1.5
+# TYPE onet_Dummy info
+onet_Dummy_info{Connections="5"} 1
+# TYPE onet_Test info
+onet_Test_info{Name="say \"hi\"",Version="2.0"} 1
+# EOF
+`, string(srs.ReportStatusOpenMetrics()))
+}
+
+type duplicateMetricsReporter struct{}
+
+func (d *duplicateMetricsReporter) GetStatus() *Status {
+	st := NewStatus()
+	st.Set("Tx.Count", 1)
+	st.Set("Tx_Count", 2)
+	st.Set("Peer.Name", "a")
+	st.Set("Peer_Name", "b")
+	return st
+}
+
+func TestSRStruct_OpenMetricsDuplicates(t *testing.T) {
+	logs := log.Capture(t)
+	srs := newStatusReporterStruct()
+	srs.RegisterStatusReporter("Dup", &duplicateMetricsReporter{})
+	assert.Equal(t, `# TYPE onet_Dup_Tx_Count gauge
+onet_Dup_Tx_Count 1
+# TYPE onet_Dup info
+onet_Dup_info{Peer_Name="a"} 1
+# EOF
+`, string(srs.ReportStatusOpenMetrics()))
+	logs.Contains(t, "Dup/Tx.Count and Dup/Tx_Count")
+}
+
+func TestLogStatus_OpenMetrics(t *testing.T) {
+	defer log.SetDebugVisible(log.DebugVisible())
+	log.SetDebugVisible(1)
+	log.ResetCounts()
+	log.Lvl1("counted")
+	log.Lvl1("counted")
+	srs := newStatusReporterStruct()
+	srs.RegisterStatusReporter("Log", logStatus{})
+	metrics := string(srs.ReportStatusOpenMetrics())
+	assert.True(t, strings.Contains(metrics, `onet_Log_Messages{key="level 1"} 2`), metrics)
+	assert.True(t, strings.Contains(metrics, `onet_Log_CallerMessages{key="onet.TestLogStatus_OpenMetrics:`), metrics)
+}
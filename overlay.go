@@ -1,6 +1,9 @@
+// +build !js
+
 package onet
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sync"
@@ -8,7 +11,8 @@ import (
 
 	"github.com/dedis/onet/log"
 	"github.com/dedis/onet/network"
-	"gopkg.in/satori/go.uuid.v1"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Overlay keeps all trees and entity-lists for a given Server. It creates
@@ -21,6 +25,11 @@ type Overlay struct {
 	// mapping from Roster.id to Roster
 	entityLists    map[RosterID]*Roster
 	entityListLock sync.Mutex
+	// how many signatures of trusted keys a Roster received from others
+	// needs
+	rosterThreshold int
+	// the keys whose signatures count for rosterThreshold, by their string
+	trustedKeys map[string]bool
 	// cache for relating token(~Node) to TreeNode
 	cache *treeNodeCache
 
@@ -49,7 +58,38 @@ type Overlay struct {
 	protoIO *messageProxyStore
 
 	pendingConfigs    map[TokenID]*GenericConfig
+	pendingBudgets    map[TokenID]*ProtocolBudget
 	pendingConfigsMut sync.Mutex
+
+	// pause is used by Quiesce and Resume
+	pause dispatchPause
+
+	// limits of the resources used by a protocol instance
+	limits    ProtocolLimits
+	limitsMut sync.Mutex
+
+	// policy decides which protocols others can start here
+	policy    ProtocolPolicy
+	policyMut sync.Mutex
+
+	// resources reserved by the protocols
+	reservations reservations
+
+	// IDs of the gossiped messages already received
+	gossipSeen *gossipSeen
+
+	// msgTracer records the messages, see TraceMessages
+	msgTracer     *messageTracer
+	msgTracerLock sync.Mutex
+
+	// round-trip times between the members of rosters
+	latencies *latencies
+
+	// handlers of the requests and requests waiting for their replies
+	rpcs *rpcs
+
+	// stores the trees and rosters in the database
+	treeCache *treeCache
 }
 
 // NewOverlay creates a new overlay-structure
@@ -58,12 +98,17 @@ func NewOverlay(c *Server) *Overlay {
 		server:             c,
 		trees:              make(map[TreeID]*Tree),
 		entityLists:        make(map[RosterID]*Roster),
-		cache:              newTreeNodeCache(),
+		cache:              newTreeNodeCache(func() network.Clock { return c.Clock() }),
 		instances:          make(map[TokenID]*TreeNodeInstance),
 		instancesInfo:      make(map[TokenID]bool),
 		protocolInstances:  make(map[TokenID]ProtocolInstance),
 		pendingTreeMarshal: make(map[RosterID][]*TreeMarshal),
 		pendingConfigs:     make(map[TokenID]*GenericConfig),
+		pendingBudgets:     make(map[TokenID]*ProtocolBudget),
+		gossipSeen:         newGossipSeen(),
+		latencies:          newLatencies(),
+		rpcs:               newRPCs(),
+		treeCache:          newTreeCache(),
 	}
 	o.protoIO = newMessageProxyStore(c.suite, c, o)
 	// messages going to protocol instances
@@ -73,23 +118,52 @@ func NewOverlay(c *Server) *Overlay {
 		SendTreeMsgID,      // send a tree back to a request
 		RequestRosterMsgID, // request a roster
 		SendRosterMsgID,    // send a roster back to request
-		ConfigMsgID)        // fetch config information
+		ConfigMsgID,        // fetch config information
+		BudgetMsgID,        // execution budget of a run
+		AbortMsgID,         // abort of a child after a panic
+		GossipMsgID)        // gossiped messages
+	o.registerLatencies()
+	o.registerRPCs()
+	go o.treeCacheGC()
 	return o
 }
 
 // stop stops goroutines associated with this overlay.
 func (o *Overlay) stop() {
 	o.cache.stop()
+	o.latencies.stop()
+	o.treeCache.stop()
 }
 
 // Process implements the Processor interface so it process the messages that it
-// wants.
+// wants. If the overlay is quiesced, the messages are stored until Resume is
+// called.
 func (o *Overlay) Process(env *network.Envelope) {
+	if !o.pause.enter(o, env) {
+		return
+	}
+	defer o.pause.leave()
+	o.process(env)
+}
+
+func (o *Overlay) process(env *network.Envelope) {
 	// Messages handled by the overlay directly without any messageProxyIO
 	if env.MsgType.Equal(ConfigMsgID) {
 		o.handleConfigMessage(env)
 		return
 	}
+	if env.MsgType.Equal(BudgetMsgID) {
+		o.handleBudgetMessage(env)
+		return
+	}
+	if env.MsgType.Equal(AbortMsgID) {
+		o.handleAbortMessage(env)
+		return
+	}
+	if env.MsgType.Equal(GossipMsgID) {
+		o.handleGossip(env)
+		return
+	}
 
 	// get messageProxy or default one
 	io := o.protoIO.getByPacketType(env.MsgType)
@@ -115,8 +189,23 @@ func (o *Overlay) Process(env *network.Envelope) {
 			ServerIdentity: env.ServerIdentity,
 			Msg:            inner,
 			MsgType:        typ,
+			size:           uint64(env.Size),
+		}
+		o.traceMessage(false, protoMsg.From, protoMsg.To, env.ServerIdentity, inner,
+			protoMsg.size)
+		if info.TraceContext == nil {
+			o.TransmitMsg(protoMsg, io)
+			return
 		}
-		o.TransmitMsg(protoMsg, io)
+		ctx, span := tracer().Start(extractTrace(context.Background(), info.TraceContext),
+			"onet.overlay.process",
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(
+				attribute.String("onet.server", o.server.Address().String()),
+				attribute.String("onet.message", fmt.Sprintf("%T", inner)),
+				attribute.String("onet.from", env.ServerIdentity.Address.String())))
+		protoMsg.TraceContext = injectTrace(ctx)
+		endSpan(span, o.TransmitMsg(protoMsg, io))
 	}
 }
 
@@ -139,6 +228,7 @@ func (o *Overlay) TransmitMsg(onetMsg *ProtocolMsg, io MessageProxy) error {
 	var pi ProtocolInstance
 	o.instancesLock.Lock()
 	pi, ok := o.protocolInstances[onetMsg.To.ID()]
+	tni := o.instances[onetMsg.To.ID()]
 	done := o.instancesInfo[onetMsg.To.ID()]
 	o.instancesLock.Unlock()
 	if done {
@@ -152,27 +242,58 @@ func (o *Overlay) TransmitMsg(onetMsg *ProtocolMsg, io MessageProxy) error {
 		if err != nil {
 			return errors.New("No TreeNode defined in this tree here")
 		}
-		tni := o.newTreeNodeInstanceFromToken(tn, onetMsg.To, io)
+		if err := o.checkPolicy(onetMsg.ServerIdentity, onetMsg.To.ProtoID, tree); err != nil {
+			log.Lvl2(o.server.Address(), err)
+			o.server.RecordEvent(EventProtocolFailure, err)
+			o.server.Audit(AuditAuthFailure, onetMsg.ServerIdentity.String(), err)
+			return err
+		}
+		reserved, err := o.acquire(onetMsg.To.ProtoID)
+		if err != nil {
+			log.Error(o.server.Address(), "refusing new instance:", err)
+			o.server.RecordEvent(EventProtocolFailure, "refusing new instance: ", err)
+			o.refuseInstance(onetMsg, err)
+			return err
+		}
+		tni = o.newTreeNodeInstanceFromToken(tn, onetMsg.To, io)
+		tni.reserved = reserved
+		tni.SetTraceContext(extractTrace(context.Background(), onetMsg.TraceContext))
+		if b := o.getBudget(onetMsg.To.ID()); b != nil {
+			tni.SetBudget(b)
+		}
 		// retrieve the possible generic config for this message
 		config := o.getConfig(onetMsg.To.ID())
 		// request the PI from the Service and binds the two
 		pi, err = o.server.serviceManager.newProtocol(tni, config)
 		if err != nil {
+			o.nodeDone(tni.Token())
+			o.server.RecordEvent(EventProtocolFailure, "creating ",
+				tni.ProtocolName(), ": ", err)
 			return err
 		}
 		if pi == nil {
+			o.nodeDone(tni.Token())
 			return nil
 		}
-		go pi.Dispatch()
+		go func() {
+			defer tni.recoverPanic("dispatching")
+			pi.Dispatch()
+		}()
 		if err := o.RegisterProtocolInstance(pi); err != nil {
+			o.nodeDone(tni.Token())
 			return errors.New("Error Binding TreeNodeInstance and ProtocolInstance:" +
 				err.Error())
 		}
+		o.server.Audit(AuditProtocolStart, onetMsg.ServerIdentity.String(),
+			tni.ProtocolName(), " ", tni.TokenID())
 		log.Lvl4(o.server.Address(), "Overlay created new ProtocolInstace msg => ",
 			fmt.Sprintf("%+v", onetMsg.To))
 	}
 	// TODO Check if TreeNodeInstance is already Done
-	pi.ProcessProtocolMsg(onetMsg)
+	func() {
+		defer tni.recoverPanic(fmt.Sprintf("processing %T", onetMsg.Msg))
+		pi.ProcessProtocolMsg(onetMsg)
+	}()
 	return nil
 }
 
@@ -269,45 +390,110 @@ func (o *Overlay) requestTree(si *network.ServerIdentity, onetMsg *ProtocolMsg,
 	return err
 }
 
-// RegisterTree takes a tree and puts it in the map
+// RegisterTree takes a tree and puts it in the map. A new tree is also
+// stored in the database, see SetTreeCacheTTL.
 func (o *Overlay) RegisterTree(t *Tree) {
 	o.treesMut.Lock()
+	known := o.trees[t.ID] != nil
 	o.trees[t.ID] = t
 	o.treesMut.Unlock()
+	if !known {
+		o.storeTree(t)
+	}
 	o.checkPendingMessages(t)
 }
 
 // TreeFromToken searches for the tree corresponding to a token.
 func (o *Overlay) TreeFromToken(tok *Token) *Tree {
-	o.treesMut.Lock()
-	defer o.treesMut.Unlock()
-	return o.trees[tok.TreeID]
+	return o.Tree(tok.TreeID)
 }
 
-// Tree returns the tree given by treeId or nil if not found
+// Tree returns the tree given by treeId or nil if not found. Trees that
+// are not in memory are searched in the database.
 func (o *Overlay) Tree(tid TreeID) *Tree {
+	o.treesMut.Lock()
+	t := o.trees[tid]
+	o.treesMut.Unlock()
+	if t != nil {
+		return t
+	}
+	if t = o.loadTree(tid); t == nil {
+		return nil
+	}
 	o.treesMut.Lock()
 	defer o.treesMut.Unlock()
-	return o.trees[tid]
+	if known := o.trees[tid]; known != nil {
+		return known
+	}
+	o.trees[tid] = t
+	return t
 }
 
-// RegisterRoster puts an entityList in the map
-func (o *Overlay) RegisterRoster(el *Roster) {
+// RegisterRoster puts an entityList in the map. A new roster is also
+// stored in the database, see SetTreeCacheTTL. It returns an error and
+// doesn't register the roster if it isn't signed by enough of its members,
+// see SetRosterThreshold.
+func (o *Overlay) RegisterRoster(el *Roster) error {
+	if err := o.VerifyRoster(el); err != nil {
+		return err
+	}
+	o.registerRoster(el)
+	return nil
+}
+
+// registerRoster puts an entityList in the map without verifying its
+// signatures, for the rosters of the instances started by this server.
+func (o *Overlay) registerRoster(el *Roster) {
 	o.entityListLock.Lock()
-	defer o.entityListLock.Unlock()
+	known := o.entityLists[el.ID] != nil
 	o.entityLists[el.ID] = el
+	o.entityListLock.Unlock()
+	if !known {
+		o.storeRoster(el)
+	}
+}
+
+// peers returns all members of the known rosters, except this server.
+func (o *Overlay) peers() []*network.ServerIdentity {
+	o.entityListLock.Lock()
+	defer o.entityListLock.Unlock()
+	seen := map[network.ServerIdentityID]bool{o.server.ServerIdentity.ID: true}
+	var list []*network.ServerIdentity
+	for _, ro := range o.entityLists {
+		for _, si := range ro.List {
+			if !seen[si.ID] {
+				seen[si.ID] = true
+				list = append(list, si)
+			}
+		}
+	}
+	return list
 }
 
 // RosterFromToken returns the entitylist corresponding to a token
 func (o *Overlay) RosterFromToken(tok *Token) *Roster {
-	return o.entityLists[tok.RosterID]
+	return o.Roster(tok.RosterID)
 }
 
-// Roster returns the entityList given by RosterID
+// Roster returns the entityList given by RosterID. Rosters that are not in
+// memory are searched in the database.
 func (o *Overlay) Roster(elid RosterID) *Roster {
+	o.entityListLock.Lock()
+	ro := o.entityLists[elid]
+	o.entityListLock.Unlock()
+	if ro != nil {
+		return ro
+	}
+	if ro = o.loadRoster(elid); ro == nil {
+		return nil
+	}
 	o.entityListLock.Lock()
 	defer o.entityListLock.Unlock()
-	return o.entityLists[elid]
+	if known := o.entityLists[elid]; known != nil {
+		return known
+	}
+	o.entityLists[elid] = ro
+	return ro
 }
 
 // TreeNodeFromToken returns the treeNode corresponding to a token
@@ -437,7 +623,11 @@ func (o *Overlay) handleSendRoster(si *network.ServerIdentity, roster *Roster) {
 	if roster.ID.IsNil() {
 		log.Lvl2("Received an empty Roster")
 	} else {
-		o.RegisterRoster(roster)
+		if err := o.RegisterRoster(roster); err != nil {
+			log.Error("Refusing roster from", si, ":", err)
+			return
+		}
+		o.checkOwnEntry(si, roster)
 		// Check if some trees can be constructed from this entitylist
 		o.checkPendingTreeMarshal(roster)
 	}
@@ -478,6 +668,13 @@ func (o *Overlay) getConfig(id TokenID) *GenericConfig {
 // in the `NewProtocol` method if a Service has created the protocol and set the
 // config with `SetConfig`. It can be nil.
 func (o *Overlay) SendToTreeNode(from *Token, to *TreeNode, msg network.Message, io MessageProxy, c *GenericConfig) (uint64, error) {
+	return o.sendToTreeNode(from, to, msg, io, c, nil)
+}
+
+// sendToTreeNode is like SendToTreeNode, but also sends the trace context
+// tc of the sending instance.
+func (o *Overlay) sendToTreeNode(from *Token, to *TreeNode, msg network.Message,
+	io MessageProxy, c *GenericConfig, tc map[string]string) (uint64, error) {
 	tokenTo := from.ChangeTreeNodeID(to.ID)
 	var totSentLen uint64
 
@@ -497,14 +694,23 @@ func (o *Overlay) SendToTreeNode(from *Token, to *TreeNode, msg network.Message,
 			From: from,
 			To:   tokenTo,
 		},
+		TraceContext: tc,
 	}
 	final, err := io.Wrap(msg, info)
 	if err != nil {
 		return totSentLen, err
 	}
 
-	sentLen, err := o.server.Send(to.ServerIdentity, final)
+	// the priority is the one of the message, not of its wrapper
+	prio := network.PriorityNormal
+	if msg != nil {
+		prio = network.MessagePriority(msg)
+	}
+	sentLen, err := o.server.SendPriority(to.ServerIdentity, final, prio)
 	totSentLen += sentLen
+	if err == nil {
+		o.traceMessage(true, from, tokenTo, to.ServerIdentity, msg, sentLen)
+	}
 	return totSentLen, err
 }
 
@@ -525,6 +731,8 @@ func (o *Overlay) nodeDelete(tok *Token) {
 		return
 	}
 	log.Lvl4("Closing node", tok.ID())
+	o.release(tni)
+	tni.endTrace()
 	err := tni.closeDispatch()
 	if err != nil {
 		log.Error("Error while closing node:", err)
@@ -553,19 +761,32 @@ func (o *Overlay) Close() {
 // so the protocol will be picked up by the correct service and handled by its
 // NewProtocol method. If the sid is NilServiceID, then the protocol is handled by onet alone.
 func (o *Overlay) CreateProtocol(name string, t *Tree, sid ServiceID) (ProtocolInstance, error) {
+	if o.Quiesced() {
+		return nil, ErrQuiesced
+	}
+	reserved, err := o.acquire(ProtocolNameToID(name))
+	if err != nil {
+		return nil, err
+	}
 	io := o.protoIO.getByName(name)
 	tni := o.NewTreeNodeInstanceFromService(t, t.Root, ProtocolNameToID(name), sid, io)
+	tni.reserved = reserved
 	pi, err := o.server.protocolInstantiate(tni.token.ProtoID, tni)
 	if err != nil {
+		o.nodeDone(tni.Token())
 		return nil, err
 	}
 	if err = o.RegisterProtocolInstance(pi); err != nil {
+		o.nodeDone(tni.Token())
 		return nil, err
 	}
+	o.server.Audit(AuditProtocolStart, auditLocal, name, " ", tni.TokenID())
 	go func() {
+		defer tni.recoverPanic("dispatching")
 		err := pi.Dispatch()
 		if err != nil {
 			log.Error(err)
+			o.server.RecordEvent(EventProtocolFailure, name, ": ", err)
 		}
 	}()
 	return pi, err
@@ -577,10 +798,18 @@ func (o *Overlay) StartProtocol(name string, t *Tree, sid ServiceID) (ProtocolIn
 	if err != nil {
 		return nil, err
 	}
+	o.instancesLock.Lock()
+	tni := o.instances[pi.Token().ID()]
+	o.instancesLock.Unlock()
 	go func() {
+		if tni != nil {
+			tni.traceEvent("start")
+		}
+		defer tni.recoverPanic("starting")
 		err := pi.Start()
 		if err != nil {
 			log.Error("Error while starting:", err)
+			o.server.RecordEvent(EventProtocolFailure, "starting ", name, ": ", err)
 		}
 	}()
 	return pi, err
@@ -601,11 +830,11 @@ func (o *Overlay) NewTreeNodeInstanceFromProtocol(t *Tree, tn *TreeNode, protoID
 		TreeID:     t.ID,
 		RosterID:   t.Roster.ID,
 		ProtoID:    protoID,
-		RoundID:    RoundID(uuid.NewV4()),
+		RoundID:    RoundID(newUUID()),
 	}
 	tni := o.newTreeNodeInstanceFromToken(tn, tok, io)
 	o.RegisterTree(t)
-	o.RegisterRoster(t.Roster)
+	o.registerRoster(t.Roster)
 	return tni
 }
 
@@ -618,14 +847,20 @@ func (o *Overlay) NewTreeNodeInstanceFromService(t *Tree, tn *TreeNode, protoID
 		RosterID:   t.Roster.ID,
 		ProtoID:    protoID,
 		ServiceID:  servID,
-		RoundID:    RoundID(uuid.NewV4()),
+		RoundID:    RoundID(newUUID()),
 	}
 	tni := o.newTreeNodeInstanceFromToken(tn, tok, io)
 	o.RegisterTree(t)
-	o.RegisterRoster(t.Roster)
+	o.registerRoster(t.Roster)
 	return tni
 }
 
+// Clock returns the clock of the server, which measures the timeouts of the
+// protocols.
+func (o *Overlay) Clock() network.Clock {
+	return o.server.Clock()
+}
+
 // ServerIdentity Returns the entity of the Host
 func (o *Overlay) ServerIdentity() *network.ServerIdentity {
 	return o.server.ServerIdentity
@@ -694,6 +929,7 @@ type treeNodeCache struct {
 	Entries  map[TreeID]*cacheEntry
 	stopCh   chan (struct{})
 	stopOnce sync.Once
+	clock    func() network.Clock
 	sync.Mutex
 }
 
@@ -705,10 +941,11 @@ type cacheEntry struct {
 var cacheTime = 5 * time.Minute
 var cleanEvery = 1 * time.Minute
 
-func newTreeNodeCache() *treeNodeCache {
+func newTreeNodeCache(clock func() network.Clock) *treeNodeCache {
 	tnc := &treeNodeCache{
 		Entries: make(map[TreeID]*cacheEntry),
 		stopCh:  make(chan struct{}),
+		clock:   clock,
 	}
 	go tnc.cleaner()
 	return tnc
@@ -721,7 +958,7 @@ func (tnc *treeNodeCache) stop() {
 func (tnc *treeNodeCache) cleaner() {
 	for {
 		select {
-		case <-time.After(cleanEvery):
+		case <-tnc.clock().After(cleanEvery):
 			tnc.clean()
 		case <-tnc.stopCh:
 			return
@@ -730,8 +967,8 @@ func (tnc *treeNodeCache) cleaner() {
 }
 
 func (tnc *treeNodeCache) clean() {
+	now := tnc.clock().Now()
 	tnc.Lock()
-	now := time.Now()
 	for k := range tnc.Entries {
 		if now.After(tnc.Entries[k].expiration) {
 			delete(tnc.Entries, k)
@@ -744,12 +981,13 @@ func (tnc *treeNodeCache) clean() {
 // children of the treenode since that's most likely what we are going
 // to query.
 func (tnc *treeNodeCache) Set(tree *Tree, treeNode *TreeNode) {
+	now := tnc.clock().Now()
 	tnc.Lock()
 	ce, ok := tnc.Entries[tree.ID]
 	if !ok {
 		ce = &cacheEntry{
 			treeNodeMap: make(map[TreeNodeID]*TreeNode),
-			expiration:  time.Now().Add(cacheTime),
+			expiration:  now.Add(cacheTime),
 		}
 	}
 	// add treenode
@@ -770,17 +1008,18 @@ func (tnc *treeNodeCache) Set(tree *Tree, treeNode *TreeNode) {
 // GetFromToken returns the TreeNode that the token is pointing at, or
 // nil if there is none for this token.
 func (tnc *treeNodeCache) GetFromToken(tok *Token) *TreeNode {
+	now := tnc.clock().Now()
 	tnc.Lock()
 	defer tnc.Unlock()
 	if tok == nil {
 		return nil
 	}
 	ce, ok := tnc.Entries[tok.TreeID]
-	if !ok || time.Now().After(ce.expiration) {
+	if !ok || now.After(ce.expiration) {
 		// no tree cached for this token
 		return nil
 	}
-	ce.expiration = time.Now().Add(cacheTime)
+	ce.expiration = now.Add(cacheTime)
 
 	tn, ok := ce.treeNodeMap[tok.TreeNodeID]
 	if !ok {
@@ -805,10 +1044,11 @@ func (d *defaultProtoIO) Wrap(msg interface{}, info *OverlayMsg) (interface{}, e
 		}
 		typ := network.MessageType(msg)
 		protoMsg := &ProtocolMsg{
-			From:     info.TreeNodeInfo.From,
-			To:       info.TreeNodeInfo.To,
-			MsgSlice: buff,
-			MsgType:  typ,
+			From:         info.TreeNodeInfo.From,
+			To:           info.TreeNodeInfo.To,
+			MsgSlice:     buff,
+			MsgType:      typ,
+			TraceContext: info.TraceContext,
 		}
 		return protoMsg, nil
 	}
@@ -847,6 +1087,7 @@ func (d *defaultProtoIO) Unwrap(msg interface{}) (interface{}, *OverlayMsg, erro
 			To:   onetMsg.To,
 			From: onetMsg.From,
 		}
+		returnOverlay.TraceContext = onetMsg.TraceContext
 		returnMsg = protoMsg
 	case *RequestTree:
 		returnOverlay.RequestTree = inner
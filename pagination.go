@@ -0,0 +1,163 @@
+package onet
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"reflect"
+
+	"github.com/dedis/onet/network"
+)
+
+// DefaultPageSize is the size of a page if the request doesn't give one.
+const DefaultPageSize = 50
+
+// DefaultMaxPageSize is the largest page a ServiceProcessor accepts, unless
+// set otherwise with SetMaxPageSize.
+const DefaultMaxPageSize = 1000
+
+// cursorVersion is the first byte of the cursors, so that their format can
+// change without mistaking old cursors for new ones.
+const cursorVersion = 1
+
+// ErrInvalidCursor is returned if a cursor has not been returned by
+// EncodeCursor.
+var ErrInvalidCursor = errors.New("invalid page cursor")
+
+// PageRequest asks for one page of a list. A request of an endpoint
+// returning a list has it as a field called Page, and the reply has a
+// PageInfo field called Page. The ServiceProcessor then checks the page size
+// before calling the handler, and Client.SendProtobufPages can get all the
+// pages.
+type PageRequest struct {
+	// Cursor is the NextCursor of the previous page, or empty for the
+	// first page.
+	Cursor string
+	// Size is the maximal number of items of the page. If 0, it is set to
+	// DefaultPageSize before the handler is called.
+	Size int
+}
+
+// PageInfo describes the page of a list returned by an endpoint.
+type PageInfo struct {
+	// NextCursor is given in the request of the next page. It is empty on
+	// the last page.
+	NextCursor string
+	// Total is the number of items of the whole list, or -1 if it is not
+	// known.
+	Total int
+}
+
+// EncodeCursor returns an opaque cursor for the position in a list. The
+// position can be an offset, see PageRequest.Page, or a key in the
+// database to continue from.
+func EncodeCursor(pos []byte) string {
+	return base64.RawURLEncoding.EncodeToString(append([]byte{cursorVersion}, pos...))
+}
+
+// DecodeCursor returns the position of a cursor returned by EncodeCursor.
+// The empty cursor has a nil position.
+func DecodeCursor(cursor string) ([]byte, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	buf, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(buf) == 0 || buf[0] != cursorVersion {
+		return nil, ErrInvalidCursor
+	}
+	return buf[1:], nil
+}
+
+// Page returns the items [start, end) of a list of total items that are in
+// the requested page, and the PageInfo of the reply.
+func (pr *PageRequest) Page(total int) (start, end int, info PageInfo, err error) {
+	pos, err := DecodeCursor(pr.Cursor)
+	if err != nil {
+		return
+	}
+	if pos != nil {
+		if len(pos) != 8 {
+			err = ErrInvalidCursor
+			return
+		}
+		start = int(binary.BigEndian.Uint64(pos))
+		if start < 0 {
+			err = ErrInvalidCursor
+			return
+		}
+	}
+	if start > total {
+		start = total
+	}
+	size := pr.Size
+	if size <= 0 {
+		size = DefaultPageSize
+	}
+	end = start + size
+	if end >= total {
+		end = total
+	} else {
+		next := make([]byte, 8)
+		binary.BigEndian.PutUint64(next, uint64(end))
+		info.NextCursor = EncodeCursor(next)
+	}
+	info.Total = total
+	return
+}
+
+// pageRequestType is the type of the Page field of requests.
+var pageRequestType = reflect.TypeOf(PageRequest{})
+
+// pageInfoType is the type of the Page field of replies.
+var pageInfoType = reflect.TypeOf(PageInfo{})
+
+// pageField returns the Page field of the struct v, if it has the type t.
+func pageField(v reflect.Value, t reflect.Type) (reflect.Value, bool) {
+	if v.Kind() != reflect.Struct {
+		return reflect.Value{}, false
+	}
+	f := v.FieldByName("Page")
+	if !f.IsValid() || f.Type() != t {
+		return reflect.Value{}, false
+	}
+	return f, true
+}
+
+// SendProtobufPages gets all pages of a list: msg and ret are pointers to
+// structs with a Page field of type PageRequest and PageInfo. msg is sent
+// with the cursor of the previous reply until the last page, and fn is
+// called with every reply decoded into ret.
+func (c *Client) SendProtobufPages(dst *network.ServerIdentity, msg interface{},
+	ret interface{}, fn func() error) error {
+	mv := reflect.ValueOf(msg)
+	rv := reflect.ValueOf(ret)
+	if mv.Kind() != reflect.Ptr || rv.Kind() != reflect.Ptr {
+		return errors.New("msg and ret must be pointers")
+	}
+	mp, ok := pageField(mv.Elem(), pageRequestType)
+	if !ok {
+		return errors.New("msg has no Page field of type PageRequest")
+	}
+	rp, ok := pageField(rv.Elem(), pageInfoType)
+	if !ok {
+		return errors.New("ret has no Page field of type PageInfo")
+	}
+	pr := mp.Addr().Interface().(*PageRequest)
+	info := rp.Addr().Interface().(*PageInfo)
+	for {
+		rv.Elem().Set(reflect.Zero(rv.Elem().Type()))
+		if err := c.SendProtobuf(dst, msg, ret); err != nil {
+			return err
+		}
+		if err := fn(); err != nil {
+			return err
+		}
+		if info.NextCursor == "" {
+			return nil
+		}
+		if info.NextCursor == pr.Cursor {
+			return errors.New("server returned the same cursor again")
+		}
+		pr.Cursor = info.NextCursor
+	}
+}
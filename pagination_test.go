@@ -0,0 +1,140 @@
+package onet
+
+import (
+	"testing"
+
+	"github.com/dedis/onet/log"
+	"github.com/dedis/protobuf"
+	"github.com/stretchr/testify/require"
+)
+
+const pageServiceName = "PageService"
+
+func init() {
+	RegisterNewService(pageServiceName, newPageService)
+}
+
+// ListItems asks for a page of the items of pageService.
+type ListItems struct {
+	Page PageRequest
+}
+
+// ListItemsReply holds a page of the items of pageService.
+type ListItemsReply struct {
+	Items []int
+	Page  PageInfo
+}
+
+type pageService struct {
+	*ServiceProcessor
+	items []int
+}
+
+func newPageService(c *Context) (Service, error) {
+	s := &pageService{ServiceProcessor: NewServiceProcessor(c)}
+	for i := 0; i < 12; i++ {
+		s.items = append(s.items, i)
+	}
+	s.SetMaxPageSize(5)
+	log.ErrFatal(s.RegisterHandler(s.ListItems))
+	return s, nil
+}
+
+func (s *pageService) ListItems(req *ListItems) (*ListItemsReply, error) {
+	start, end, info, err := req.Page.Page(len(s.items))
+	if err != nil {
+		return nil, err
+	}
+	return &ListItemsReply{Items: s.items[start:end], Page: info}, nil
+}
+
+func TestCursor(t *testing.T) {
+	pos, err := DecodeCursor("")
+	require.Nil(t, err)
+	require.Nil(t, pos)
+
+	c := EncodeCursor([]byte("key"))
+	pos, err = DecodeCursor(c)
+	require.Nil(t, err)
+	require.Equal(t, []byte("key"), pos)
+
+	_, err = DecodeCursor("not a cursor")
+	require.Equal(t, ErrInvalidCursor, err)
+	_, err = DecodeCursor("AA")
+	require.Equal(t, ErrInvalidCursor, err)
+}
+
+func TestPageRequest_Page(t *testing.T) {
+	pr := &PageRequest{Size: 3}
+	var got [][2]int
+	for {
+		start, end, info, err := pr.Page(7)
+		require.Nil(t, err)
+		require.Equal(t, 7, info.Total)
+		got = append(got, [2]int{start, end})
+		if info.NextCursor == "" {
+			break
+		}
+		pr.Cursor = info.NextCursor
+	}
+	require.Equal(t, [][2]int{{0, 3}, {3, 6}, {6, 7}}, got)
+
+	// an empty list has one empty page
+	start, end, info, err := (&PageRequest{}).Page(0)
+	require.Nil(t, err)
+	require.Equal(t, 0, start)
+	require.Equal(t, 0, end)
+	require.Equal(t, "", info.NextCursor)
+
+	_, _, _, err = (&PageRequest{Cursor: EncodeCursor([]byte("key"))}).Page(7)
+	require.Equal(t, ErrInvalidCursor, err)
+}
+
+func TestServiceProcessor_CheckPage(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	servers := local.GenServers(1)
+	s := local.Services[servers[0].ServerIdentity.ID][ServiceFactory.ServiceID(pageServiceName)].(*pageService)
+
+	buf, err := protobuf.Encode(&ListItems{Page: PageRequest{Size: 6}})
+	require.Nil(t, err)
+	_, err = s.ProcessClientRequest(nil, "ListItems", buf)
+	ve, ok := err.(*ValidationError)
+	require.True(t, ok)
+	require.Equal(t, "Page.Size", ve.Violations[0].Field)
+
+	msg := &ListItems{Page: PageRequest{Cursor: "wrong"}}
+	ve, ok = s.checkPage(msg).(*ValidationError)
+	require.True(t, ok)
+	require.Equal(t, "Page.Cursor", ve.Violations[0].Field)
+
+	msg = &ListItems{}
+	require.Nil(t, s.checkPage(msg))
+	require.Equal(t, DefaultPageSize, msg.Page.Size)
+	require.Nil(t, s.checkPage(&SimpleMessage{}))
+}
+
+func TestClient_SendProtobufPages(t *testing.T) {
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	servers := local.GenServers(1)
+	c := NewClient(tSuite, pageServiceName)
+
+	var items []int
+	pages := 0
+	reply := &ListItemsReply{}
+	err := c.SendProtobufPages(servers[0].ServerIdentity, &ListItems{Page: PageRequest{Size: 5}},
+		reply, func() error {
+			pages++
+			require.Equal(t, 12, reply.Page.Total)
+			items = append(items, reply.Items...)
+			return nil
+		})
+	require.Nil(t, err)
+	require.Equal(t, 3, pages)
+	require.Equal(t, 12, len(items))
+	require.Equal(t, 11, items[11])
+
+	require.NotNil(t, c.SendProtobufPages(servers[0].ServerIdentity, &SimpleMessage{},
+		reply, func() error { return nil }))
+}
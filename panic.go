@@ -0,0 +1,112 @@
+// +build !js
+
+package onet
+
+import (
+	"fmt"
+	"runtime/debug"
+
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+)
+
+// ProtocolPanicError is the error of an instance aborted because the code of
+// its protocol panicked. The server keeps running, and the parent of the node
+// is told with a RemoteAbortError.
+type ProtocolPanicError struct {
+	Protocol string
+	Address  network.Address
+	// During tells what the instance was doing, e.g. the message it handled
+	During string
+	// Value is the value given to panic
+	Value string
+	// Stack is the stack of the goroutine that panicked
+	Stack string
+}
+
+func (e *ProtocolPanicError) Error() string {
+	return fmt.Sprintf("protocol %s panicked at %s while %s: %s",
+		e.Protocol, e.Address, e.During, e.Value)
+}
+
+// RemoteAbortError is the error of an instance aborted because one of its
+// children aborted after a panic. It is passed on up to the root.
+type RemoteAbortError struct {
+	// Origin is the node that panicked
+	Origin *network.ServerIdentity
+	Reason string
+}
+
+func (e *RemoteAbortError) Error() string {
+	return fmt.Sprintf("aborted by %s: %s", e.Origin, e.Reason)
+}
+
+// recoverPanic stops a panic of the protocol and aborts the instance
+// instead, so that one bad message doesn't crash the server. It must be
+// deferred. A nil instance lets the panic go on.
+func (n *TreeNodeInstance) recoverPanic(during string) {
+	if n == nil {
+		return
+	}
+	r := recover()
+	if r == nil {
+		return
+	}
+	err := &ProtocolPanicError{
+		Protocol: n.ProtocolName(),
+		Address:  n.ServerIdentity().Address,
+		During:   during,
+		Value:    fmt.Sprint(r),
+		Stack:    string(debug.Stack()),
+	}
+	log.Error(err.Error() + "\n" + err.Stack)
+	n.abortUp(err)
+}
+
+// abortUp aborts the instance and its parent, so that the error reaches the
+// root of the tree.
+func (n *TreeNodeInstance) abortUp(err error) {
+	if !n.abort(err) || n.IsRoot() {
+		return
+	}
+	msg := &AbortMsg{Dest: n.token.ChangeTreeNodeID(n.Parent().ID).ID()}
+	if rae, ok := err.(*RemoteAbortError); ok {
+		msg.Origin, msg.Reason = rae.Origin, rae.Reason
+	} else {
+		msg.Origin, msg.Reason = n.ServerIdentity(), err.Error()
+	}
+	if _, err := n.overlay.server.Send(n.Parent().ServerIdentity, msg); err != nil {
+		log.Error(n.ServerIdentity().Address, "couldn't tell parent about abort:", err)
+	}
+}
+
+// handleAbortMessage aborts the instance whose child aborted. The aborts
+// only travel up the tree, so an abort that doesn't come from a child of
+// the instance is ignored.
+func (o *Overlay) handleAbortMessage(env *network.Envelope) {
+	am, ok := env.Msg.(*AbortMsg)
+	if !ok {
+		log.Error(o.server.Address(), "wrong abort type")
+		return
+	}
+	o.instancesLock.Lock()
+	tni := o.instances[am.Dest]
+	o.instancesLock.Unlock()
+	if tni == nil {
+		log.Lvl3(o.server.Address(), "abort for unknown instance", am.Dest)
+		return
+	}
+	fromChild := false
+	for _, c := range tni.Children() {
+		if env.ServerIdentity != nil && c.ServerIdentity.ID.Equal(env.ServerIdentity.ID) {
+			fromChild = true
+			break
+		}
+	}
+	if !fromChild {
+		log.Warn(o.server.Address(), "ignoring abort of", am.Dest, "from", env.ServerIdentity,
+			"which is not a child")
+		return
+	}
+	tni.abortUp(&RemoteAbortError{Origin: am.Origin, Reason: am.Reason})
+}
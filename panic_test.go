@@ -0,0 +1,102 @@
+package onet
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dedis/onet/network"
+	"github.com/stretchr/testify/require"
+)
+
+type panicMsg struct {
+	Value int
+}
+
+type panicProtocol struct {
+	*TreeNodeInstance
+}
+
+func newPanicProtocol(n *TreeNodeInstance) (ProtocolInstance, error) {
+	p := &panicProtocol{n}
+	return p, p.RegisterHandler(p.handlePanic)
+}
+
+func (p *panicProtocol) Start() error {
+	return p.SendToChildren(&panicMsg{42})
+}
+
+func (p *panicProtocol) handlePanic(struct {
+	*TreeNode
+	panicMsg
+}) error {
+	panic("bad message")
+}
+
+func init() {
+	network.RegisterMessage(panicMsg{})
+	GlobalProtocolRegister("panicProtocol", newPanicProtocol)
+}
+
+func TestProtocolPanicError(t *testing.T) {
+	err := &ProtocolPanicError{Protocol: "p", Address: "tcp://1.2.3.4:5",
+		During: "handling *onet.panicMsg", Value: "bad"}
+	require.Equal(t, "protocol p panicked at tcp://1.2.3.4:5 while handling *onet.panicMsg: bad",
+		err.Error())
+	rae := &RemoteAbortError{Origin: &network.ServerIdentity{Address: "tcp://1.2.3.4:5"},
+		Reason: err.Error()}
+	require.True(t, strings.HasSuffix(rae.Error(), err.Error()))
+}
+
+func TestProtocolPanic_AbortsTree(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	servers, _, tree := local.GenTree(2, true)
+	pi, err := servers[0].StartProtocol("panicProtocol", tree)
+	require.Nil(t, err)
+	root := pi.(*panicProtocol).TreeNodeInstance
+
+	waitAborted(t, root)
+	rae, ok := root.AbortError().(*RemoteAbortError)
+	require.True(t, ok, "wrong error: %v", root.AbortError())
+	require.True(t, rae.Origin.Equal(servers[1].ServerIdentity))
+	require.Contains(t, rae.Reason, "bad message")
+}
+
+func TestProtocolPanic_Go(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	tni := newLimitedInstance(t, local, ProtocolLimits{})
+
+	tni.Go(func() { panic("in go-routine") })
+	waitAborted(t, tni)
+	ppe, ok := tni.AbortError().(*ProtocolPanicError)
+	require.True(t, ok, "wrong error: %v", tni.AbortError())
+	require.Equal(t, "in go-routine", ppe.Value)
+	require.Equal(t, "running a go-routine", ppe.During)
+	require.Contains(t, ppe.Stack, "TestProtocolPanic_Go")
+}
+
+func TestProtocolPanic_AbortFromNonChild(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	GlobalProtocolRegister("ProtocolOverlay", func(n *TreeNodeInstance) (ProtocolInstance, error) {
+		return &ProtocolOverlay{TreeNodeInstance: n}, nil
+	})
+	servers, _, tree := local.GenTree(3, true)
+	// A tree where servers[2] is not a child of the root
+	line := tree.Roster.GenerateNaryTree(1)
+	pi, err := servers[0].CreateProtocol("ProtocolOverlay", line)
+	require.Nil(t, err)
+	root := pi.(*ProtocolOverlay).TreeNodeInstance
+	defer root.Done()
+	abort := &AbortMsg{Dest: root.TokenID(), Origin: servers[2].ServerIdentity,
+		Reason: "forged"}
+
+	servers[0].overlay.handleAbortMessage(&network.Envelope{
+		ServerIdentity: servers[2].ServerIdentity, Msg: abort})
+	require.Nil(t, root.AbortError())
+
+	servers[0].overlay.handleAbortMessage(&network.Envelope{
+		ServerIdentity: servers[1].ServerIdentity, Msg: abort})
+	require.NotNil(t, root.AbortError())
+}
@@ -0,0 +1,41 @@
+// +build !js
+
+package onet
+
+import (
+	"fmt"
+
+	"github.com/dedis/onet/network"
+)
+
+// ProtocolPolicy decides whether this server takes part in an instance of
+// the protocol that si asks it to join in tree. An error refuses the
+// instance: no ProtocolInstance is created and the message is dropped.
+type ProtocolPolicy func(si *network.ServerIdentity, protocol string, tree *Tree) error
+
+// SetProtocolPolicy sets the policy asked before this server creates a
+// ProtocolInstance for the message of another server. The instances started
+// by the services of this server are not checked. A nil policy allows all
+// protocols.
+func (c *Server) SetProtocolPolicy(p ProtocolPolicy) {
+	c.overlay.policyMut.Lock()
+	defer c.overlay.policyMut.Unlock()
+	c.overlay.policy = p
+	c.Audit(AuditConfigChange, auditLocal, "new protocol policy")
+}
+
+// checkPolicy returns the error of the policy for the instance of the
+// protocol in tree asked by si.
+func (o *Overlay) checkPolicy(si *network.ServerIdentity, protoID ProtocolID, tree *Tree) error {
+	o.policyMut.Lock()
+	policy := o.policy
+	o.policyMut.Unlock()
+	if policy == nil {
+		return nil
+	}
+	name := o.server.protocols.ProtocolIDToName(protoID)
+	if err := policy(si, name, tree); err != nil {
+		return fmt.Errorf("protocol %s from %s refused: %s", name, si, err)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package onet
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_SetProtocolPolicy(t *testing.T) {
+	var policyProto = "simplePolicy"
+	received := make(chan bool, 10)
+	GlobalProtocolRegister(policyProto, func(n *TreeNodeInstance) (ProtocolInstance, error) {
+		ps := &SimpleProtocol{TreeNodeInstance: n, Chan: received}
+		log.ErrFatal(ps.RegisterHandler(ps.ReceiveMessage))
+		return ps, nil
+	})
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	h, _, tree := local.GenTree(2, true)
+
+	asked := make(chan string, 10)
+	policy := func(allow bool) ProtocolPolicy {
+		return func(si *network.ServerIdentity, protocol string, tr *Tree) error {
+			require.True(t, si.ID.Equal(h[0].ServerIdentity.ID))
+			require.True(t, tr.ID.Equal(tree.ID))
+			asked <- protocol
+			if !allow {
+				return errors.New("not allowed")
+			}
+			return nil
+		}
+	}
+	h[1].SetProtocolPolicy(policy(false))
+
+	// The root only sends to the child, which refuses
+	_, err := h[0].StartProtocol(policyProto, tree)
+	require.Nil(t, err)
+	require.True(t, <-received)
+	select {
+	case p := <-asked:
+		require.Equal(t, policyProto, p)
+	case <-time.After(time.Second):
+		t.Fatal("policy wasn't asked")
+	}
+	select {
+	case <-received:
+		t.Fatal("refused protocol got the message")
+	case <-time.After(100 * time.Millisecond):
+	}
+	h[1].overlay.instancesLock.Lock()
+	require.Equal(t, 0, len(h[1].overlay.instances))
+	h[1].overlay.instancesLock.Unlock()
+
+	h[1].SetProtocolPolicy(policy(true))
+	_, err = h[0].StartProtocol(policyProto, tree)
+	require.Nil(t, err)
+	require.True(t, <-received)
+	require.Equal(t, policyProto, <-asked)
+	require.True(t, <-received)
+
+	h[1].SetProtocolPolicy(nil)
+	_, err = h[0].StartProtocol(policyProto, tree)
+	require.Nil(t, err)
+	require.True(t, <-received)
+	require.True(t, <-received)
+}
@@ -1,7 +1,11 @@
+// +build !js
+
 package onet
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"reflect"
 
@@ -10,6 +14,8 @@ import (
 	"github.com/dedis/onet/log"
 	"github.com/dedis/onet/network"
 	"github.com/dedis/protobuf"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // ServiceProcessor allows for an easy integration of external messages
@@ -19,12 +25,24 @@ import (
 type ServiceProcessor struct {
 	handlers map[string]serviceHandler
 	*Context
+	// maxPageSize is the largest page accepted, see SetMaxPageSize
+	maxPageSize int
 }
 
-// serviceHandler stores the handler and the message-type.
+// serviceHandler stores the handler and the message-type, and how the
+// requests are validated.
 type serviceHandler struct {
-	handler interface{}
-	msgType reflect.Type
+	handler     interface{}
+	msgType     reflect.Type
+	constraints []fieldConstraint
+	validators  []Validator
+	// streaming is set for handlers registered with RegisterStreamingHandler
+	streaming bool
+	// withContext is set if the handler takes a context.Context first
+	withContext bool
+	// call, if set by RegisterHandlerTyped, calls the handler without
+	// reflection
+	call func(ctx context.Context, msg interface{}) (interface{}, error)
 }
 
 // NewServiceProcessor initializes your ServiceProcessor.
@@ -36,6 +54,7 @@ func NewServiceProcessor(c *Context) *ServiceProcessor {
 }
 
 var errType = reflect.TypeOf((*error)(nil)).Elem()
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
 
 // RegisterHandler will store the given handler that will be used by the service.
 // WebSocket will then forward requests to "ws://service_name/struct_name"
@@ -46,47 +65,87 @@ var errType = reflect.TypeOf((*error)(nil)).Elem()
 //  * ret is a pointer to a struct of the return-message.
 //  * err is can be nil, or any type that implements error.
 //
+// f can also take a context.Context before msg, which holds the span of the
+// request. It is given to TreeNodeInstance.SetTraceContext, so that the
+// protocols started for the request are part of its trace. The context is
+// cancelled when the client disconnects, when the server stops, or when the
+// deadline set by Server.SetRequestTimeout passes. ClientFromContext returns
+// the client of the request.
+//
 // struct_name is stripped of its package-name, so a structure like
 // network.Body will be converted to Body.
+//
+// With Go 1.18 or later, RegisterHandlerTyped checks the signature of the
+// handler at compile time.
 func (p *ServiceProcessor) RegisterHandler(f interface{}) error {
+	name, h, err := checkHandler(f)
+	if err != nil {
+		return err
+	}
+	log.Lvl4("Registering handler", name)
+	p.handlers[name] = h
+	return nil
+}
+
+// CheckHandlers returns an error if one of the functions cannot be given to
+// RegisterHandler. A service can call it from a test or from the init
+// function of its package, so that a badly declared handler shows up before
+// the service is started.
+func CheckHandlers(fs ...interface{}) error {
+	for _, f := range fs {
+		if _, _, err := checkHandler(f); err != nil {
+			return fmt.Errorf("%T: %v", f, err)
+		}
+	}
+	return nil
+}
+
+// checkHandler returns the name of the message handled by f and its
+// serviceHandler, or an error if f has a wrong signature.
+func checkHandler(f interface{}) (string, serviceHandler, error) {
 	ft := reflect.TypeOf(f)
 	// Check that we have the correct channel-type.
-	if ft.Kind() != reflect.Func {
-		return errors.New("Input is not a function")
+	if ft == nil || ft.Kind() != reflect.Func {
+		return "", serviceHandler{}, errors.New("Input is not a function")
 	}
-	if ft.NumIn() != 1 {
-		return errors.New("Need one argument: *struct")
+	withContext := ft.NumIn() == 2 && ft.In(0) == contextType
+	if ft.NumIn() != 1 && !withContext {
+		return "", serviceHandler{}, errors.New("Need one argument: *struct")
 	}
-	cr := ft.In(0)
+	cr := ft.In(ft.NumIn() - 1)
 	if cr.Kind() != reflect.Ptr {
-		return errors.New("Argument must be a *pointer* to a struct")
+		return "", serviceHandler{}, errors.New("Argument must be a *pointer* to a struct")
 	}
 	if cr.Elem().Kind() != reflect.Struct {
-		return errors.New("Argument must be a pointer to *struct*")
+		return "", serviceHandler{}, errors.New("Argument must be a pointer to *struct*")
 	}
 	if ft.NumOut() != 2 {
-		return errors.New("Need 2 return values: network.Body and error")
+		return "", serviceHandler{}, errors.New("Need 2 return values: network.Body and error")
 	}
 
 	ret := ft.Out(0)
 	if ret.Kind() != reflect.Interface {
 		if ret.Kind() != reflect.Ptr {
-			return errors.New("1st return value must be a *pointer* to a struct or an interface")
+			return "", serviceHandler{}, errors.New("1st return value must be a *pointer* to a struct or an interface")
 		}
 		if ret.Elem().Kind() != reflect.Struct {
-			return errors.New("1st return value must be a pointer to a *struct* or an interface")
+			return "", serviceHandler{}, errors.New("1st return value must be a pointer to a *struct* or an interface")
 		}
 	}
 
 	if !ft.Out(1).Implements(errType) {
-		return errors.New("2nd return value has to implement error, but is: " +
+		return "", serviceHandler{}, errors.New("2nd return value has to implement error, but is: " +
 			ft.Out(1).String())
 	}
 
-	log.Lvl4("Registering handler", cr.String())
+	constraints, err := parseConstraints(cr.Elem())
+	if err != nil {
+		return "", serviceHandler{}, err
+	}
+
 	pm := strings.Split(cr.Elem().String(), ".")[1]
-	p.handlers[pm] = serviceHandler{f, cr.Elem()}
-	return nil
+	return pm, serviceHandler{handler: f, msgType: cr.Elem(),
+		constraints: constraints, withContext: withContext}, nil
 }
 
 // RegisterHandlers takes a vararg of messages to register and returns
@@ -115,6 +174,8 @@ func (p *ServiceProcessor) NewProtocol(tn *TreeNodeInstance, conf *GenericConfig
 // and sends it back. It uses the path to find the appropriate handler-
 // function. It implements the Server interface.
 func (p *ServiceProcessor) ProcessClientRequest(req *http.Request, path string, buf []byte) ([]byte, error) {
+	ctx, span := tracer().Start(requestContext(req), "onet.service "+path,
+		trace.WithAttributes(attribute.String("onet.path", path)))
 	mh, ok := p.handlers[path]
 	reply, err := func() (interface{}, error) {
 		if !ok {
@@ -122,19 +183,29 @@ func (p *ServiceProcessor) ProcessClientRequest(req *http.Request, path string,
 			log.Error(err)
 			return nil, err
 		}
-		msg := reflect.New(mh.msgType).Interface()
-		err := protobuf.DecodeWithConstructors(buf, msg,
-			network.DefaultConstructors(p.Context.server.Suite()))
+		if mh.streaming {
+			return nil, errors.New("The requested message is a stream: " + path)
+		}
+		msg, err := p.decode(mh, buf)
 		if err != nil {
 			return nil, err
 		}
+		// The client may be gone while the request waited for a free slot.
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 
-		to := reflect.TypeOf(mh.handler).In(0)
+		if mh.call != nil {
+			return mh.call(ctx, msg)
+		}
 		f := reflect.ValueOf(mh.handler)
-
-		arg := reflect.New(to.Elem())
+		arg := reflect.New(mh.msgType)
 		arg.Elem().Set(reflect.ValueOf(msg).Elem())
-		ret := f.Call([]reflect.Value{arg})
+		args := []reflect.Value{arg}
+		if mh.withContext {
+			args = []reflect.Value{reflect.ValueOf(ctx), arg}
+		}
+		ret := f.Call(args)
 
 		ierr := ret[1].Interface()
 		if ierr != nil {
@@ -142,6 +213,7 @@ func (p *ServiceProcessor) ProcessClientRequest(req *http.Request, path string,
 		}
 		return ret[0].Interface(), nil
 	}()
+	endSpan(span, err)
 	if err != nil {
 		return nil, err
 	}
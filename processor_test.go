@@ -58,6 +58,14 @@ func TestProcessor_RegisterMessages(t *testing.T) {
 	assert.Error(t, p.RegisterHandlers(procMsg3, procMsgWrong4))
 }
 
+func TestCheckHandlers(t *testing.T) {
+	require.Nil(t, CheckHandlers(procMsg, procMsg2, procMsg3, procMsg4))
+	err := CheckHandlers(procMsg, procMsgWrong4)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "func(")
+	require.NotNil(t, CheckHandlers(nil))
+}
+
 func TestServiceProcessor_ProcessClientRequest(t *testing.T) {
 	h1 := NewLocalServer(tSuite, 2000)
 	defer h1.Close()
@@ -0,0 +1,44 @@
+//go:build go1.18 && !js
+// +build go1.18,!js
+
+package onet
+
+import (
+	"context"
+	"errors"
+	"reflect"
+
+	"github.com/dedis/onet/log"
+)
+
+// RegisterHandlerTyped is like RegisterHandler for a handler taking a
+// context.Context, but the signature of f is checked by the compiler. Req
+// must be a named struct, and the requests are sent to
+// "ws://service_name/Req" with Req stripped of its package-name. f is
+// called directly, without reflection.
+func RegisterHandlerTyped[Req, Resp any](p *ServiceProcessor,
+	f func(context.Context, *Req) (*Resp, error)) error {
+	if f == nil {
+		return errors.New("Input is not a function")
+	}
+	rt := reflect.TypeOf((*Req)(nil)).Elem()
+	if rt.Kind() != reflect.Struct || rt.Name() == "" {
+		return errors.New("Argument must be a pointer to a named *struct*")
+	}
+	constraints, err := parseConstraints(rt)
+	if err != nil {
+		return err
+	}
+	name := rt.Name()
+	log.Lvl4("Registering typed handler", name)
+	p.handlers[name] = serviceHandler{
+		handler:     f,
+		msgType:     rt,
+		constraints: constraints,
+		withContext: true,
+		call: func(ctx context.Context, msg interface{}) (interface{}, error) {
+			return f(ctx, msg.(*Req))
+		},
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+//go:build go1.18
+// +build go1.18
+
+package onet
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dedis/protobuf"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterHandlerTyped(t *testing.T) {
+	h1 := NewLocalServer(tSuite, 2000)
+	defer h1.Close()
+	p := NewServiceProcessor(&Context{server: h1})
+	require.Nil(t, RegisterHandlerTyped(p, func(ctx context.Context, msg *testMsg) (*testMsg, error) {
+		if msg.I == 42 {
+			return nil, errors.New("42 is NOT the answer")
+		}
+		return &testMsg{msg.I + 1}, nil
+	}))
+	require.NotNil(t, RegisterHandlerTyped[int, testMsg](p, func(context.Context, *int) (*testMsg, error) {
+		return nil, nil
+	}))
+
+	buf, err := protobuf.Encode(&testMsg{11})
+	require.Nil(t, err)
+	rep, err := p.ProcessClientRequest(nil, "testMsg", buf)
+	require.Nil(t, err)
+	val := &testMsg{}
+	require.Nil(t, protobuf.Decode(rep, val))
+	require.Equal(t, 12, val.I)
+
+	buf, err = protobuf.Encode(&testMsg{42})
+	require.Nil(t, err)
+	_, err = p.ProcessClientRequest(nil, "testMsg", buf)
+	require.NotNil(t, err)
+}
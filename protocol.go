@@ -1,3 +1,5 @@
+// +build !js
+
 package onet
 
 import (
@@ -58,6 +60,7 @@ type protocolStorage struct {
 	// Instantiators maps the name of the protocols to the `NewProtocol`-
 	// methods.
 	instantiators map[string]NewProtocol
+	sync.RWMutex
 }
 
 // newProtocolStorage returns an initialized ProtocolStorage-struct.
@@ -69,6 +72,12 @@ func newProtocolStorage() *protocolStorage {
 
 // ProtocolIDToName returns the name to the corresponding protocolID.
 func (ps *protocolStorage) ProtocolIDToName(id ProtocolID) string {
+	ps.RLock()
+	defer ps.RUnlock()
+	return ps.idToName(id)
+}
+
+func (ps *protocolStorage) idToName(id ProtocolID) string {
 	for n := range ps.instantiators {
 		if id.Equal(ProtocolNameToID(n)) {
 			return n
@@ -80,15 +89,36 @@ func (ps *protocolStorage) ProtocolIDToName(id ProtocolID) string {
 // ProtocolExists returns whether a certain protocol already has been
 // registered.
 func (ps *protocolStorage) ProtocolExists(protoID ProtocolID) bool {
-	_, ok := ps.instantiators[ps.ProtocolIDToName(protoID)]
+	_, ok := ps.instantiator(protoID)
 	return ok
 }
 
+// instantiator returns the NewProtocol of the protocol with the given ID.
+func (ps *protocolStorage) instantiator(protoID ProtocolID) (NewProtocol, bool) {
+	ps.RLock()
+	defer ps.RUnlock()
+	fn, ok := ps.instantiators[ps.idToName(protoID)]
+	return fn, ok
+}
+
+// all returns a copy of the registered protocols.
+func (ps *protocolStorage) all() map[string]NewProtocol {
+	ps.RLock()
+	defer ps.RUnlock()
+	all := make(map[string]NewProtocol, len(ps.instantiators))
+	for name, fn := range ps.instantiators {
+		all[name] = fn
+	}
+	return all
+}
+
 // Register takes a name and a NewProtocol and stores it in the structure.
 // If the protocol already exists, a warning is printed and the NewProtocol is
 // *not* stored.
 func (ps *protocolStorage) Register(name string, protocol NewProtocol) (ProtocolID, error) {
 	id := ProtocolNameToID(name)
+	ps.Lock()
+	defer ps.Unlock()
 	if _, exists := ps.instantiators[name]; exists {
 		return ProtocolID(uuid.Nil),
 			fmt.Errorf("Protocol -%s- already exists - not overwriting", name)
@@ -98,6 +128,15 @@ func (ps *protocolStorage) Register(name string, protocol NewProtocol) (Protocol
 	return id, nil
 }
 
+// set stores the NewProtocol, replacing the one registered under the same
+// name, if any.
+func (ps *protocolStorage) set(name string, protocol NewProtocol) ProtocolID {
+	ps.Lock()
+	defer ps.Unlock()
+	ps.instantiators[name] = protocol
+	return ProtocolNameToID(name)
+}
+
 // ProtocolNameToID returns the ProtocolID corresponding to the given name.
 func ProtocolNameToID(name string) ProtocolID {
 	url := network.NamespaceURL + "protocolname/" + name
@@ -149,13 +188,23 @@ type NewMessageProxy func() MessageProxy
 
 type messageProxyFactoryStruct struct {
 	factories []NewMessageProxy
+	sync.Mutex
 }
 
 // RegisterMessageProxy stores the message proxy creation function
 func (mpfs *messageProxyFactoryStruct) RegisterMessageProxy(n NewMessageProxy) {
+	mpfs.Lock()
+	defer mpfs.Unlock()
 	mpfs.factories = append(mpfs.factories, n)
 }
 
+// all returns the registered message proxy creation functions.
+func (mpfs *messageProxyFactoryStruct) all() []NewMessageProxy {
+	mpfs.Lock()
+	defer mpfs.Unlock()
+	return append([]NewMessageProxy(nil), mpfs.factories...)
+}
+
 var messageProxyFactory = messageProxyFactoryStruct{}
 
 // RegisterMessageProxy saves a new NewMessageProxy under its name.
@@ -211,7 +260,7 @@ func newMessageProxyStore(s network.Suite, disp network.Dispatcher, proc network
 		// also add the default one
 		defaultIO: &defaultProtoIO{s},
 	}
-	for name, newIO := range messageProxyFactory.factories {
+	for name, newIO := range messageProxyFactory.all() {
 		io := newIO()
 		pstore.protos = append(pstore.protos, io)
 		disp.RegisterProcessor(proc, io.PacketType())
@@ -3,6 +3,7 @@ package onet
 import (
 	"errors"
 	"fmt"
+	"sync"
 	"testing"
 
 	"github.com/dedis/onet/log"
@@ -115,6 +116,23 @@ func TestProtocolRegistration(t *testing.T) {
 	}
 }
 
+func TestProtocolStorage_Concurrent(t *testing.T) {
+	ps := newProtocolStorage()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("proto%d", i%5)
+			ps.Register(name, NewProtocolTest)
+			require.True(t, ps.ProtocolExists(ProtocolNameToID(name)))
+			ps.all()
+		}(i)
+	}
+	wg.Wait()
+	require.Equal(t, 5, len(ps.all()))
+}
+
 // This makes h2 the leader, so it creates a tree and entity list
 // and start a protocol. H1 should receive that message and request the entity
 // list and the treelist and then instantiate the protocol.
@@ -0,0 +1,60 @@
+// +build !js
+
+package onet
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ProtocolRegistry is a set of protocols that can be given to a server with
+// ServerOptions.Protocols, instead of the global ones registered with
+// GlobalProtocolRegister. Servers in the same process can so know different
+// protocols.
+type ProtocolRegistry struct {
+	storage *protocolStorage
+}
+
+// NewProtocolRegistry returns an empty ProtocolRegistry.
+func NewProtocolRegistry() *ProtocolRegistry {
+	return &ProtocolRegistry{newProtocolStorage()}
+}
+
+// GlobalProtocols returns a ProtocolRegistry with a copy of the protocols
+// registered with GlobalProtocolRegister.
+func GlobalProtocols() *ProtocolRegistry {
+	pr := NewProtocolRegistry()
+	pr.storage.instantiators = protocols.all()
+	return pr
+}
+
+// ComposeProtocolRegistries returns a new ProtocolRegistry with the
+// protocols of all the given registries. It returns an error if two of them
+// have a protocol with the same name.
+func ComposeProtocolRegistries(regs ...*ProtocolRegistry) (*ProtocolRegistry, error) {
+	pr := NewProtocolRegistry()
+	for _, r := range regs {
+		for name, fn := range r.storage.all() {
+			if _, err := pr.Register(name, fn); err != nil {
+				return nil, fmt.Errorf("cannot compose registries: %v", err)
+			}
+		}
+	}
+	return pr, nil
+}
+
+// Register adds the protocol to the registry. It returns an error if a
+// protocol with the same name is already registered.
+func (pr *ProtocolRegistry) Register(name string, protocol NewProtocol) (ProtocolID, error) {
+	return pr.storage.Register(name, protocol)
+}
+
+// Names returns the sorted names of the protocols of the registry.
+func (pr *ProtocolRegistry) Names() []string {
+	var names []string
+	for name := range pr.storage.all() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,76 @@
+package onet
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/dedis/kyber/util/key"
+	"github.com/dedis/onet/network"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProtocolRegistry_Compose(t *testing.T) {
+	r1 := NewProtocolRegistry()
+	_, err := r1.Register("one", NewProtocolTest)
+	require.Nil(t, err)
+	_, err = r1.Register("one", NewProtocolTest)
+	require.NotNil(t, err)
+	r2 := NewProtocolRegistry()
+	_, err = r2.Register("two", NewProtocolTest)
+	require.Nil(t, err)
+
+	r, err := ComposeProtocolRegistries(r1, r2)
+	require.Nil(t, err)
+	require.Equal(t, []string{"one", "two"}, r.Names())
+	_, err = ComposeProtocolRegistries(r1, r2, r1)
+	require.NotNil(t, err)
+
+	global := GlobalProtocols()
+	require.Contains(t, global.Names(), AggregateProtocolName)
+	// The copy doesn't change the global protocols.
+	_, err = global.Register("onlyInTheCopy", NewProtocolTest)
+	require.Nil(t, err)
+	require.False(t, protocols.ProtocolExists(ProtocolNameToID("onlyInTheCopy")))
+}
+
+func TestServer_Protocols(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "protocols")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmp)
+
+	reg := NewProtocolRegistry()
+	_, err = reg.Register("registryProto", NewProtocolTest)
+	require.Nil(t, err)
+	kp := key.NewKeyPair(tSuite)
+	si := network.NewServerIdentity(kp.Public, network.NewAddress(network.PlainTCP, "127.0.0.1:0"))
+	si.SetPrivate(kp.Private)
+	c, err := NewServerTCPWithOptions(si, tSuite, ServerOptions{DBPath: tmp, Protocols: reg})
+	require.Nil(t, err)
+	defer c.Close()
+	require.True(t, c.protocols.ProtocolExists(ProtocolNameToID("registryProto")))
+	require.False(t, c.protocols.ProtocolExists(ProtocolNameToID(AggregateProtocolName)))
+}
+
+func TestServer_ProtocolRegisterLocal(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	servers := local.GenServers(2)
+
+	_, err := servers[0].ProtocolRegister(AggregateProtocolName, NewProtocolTest)
+	require.NotNil(t, err)
+	errLocal := errors.New("local protocol")
+	id := servers[0].ProtocolRegisterLocal(AggregateProtocolName,
+		func(*TreeNodeInstance) (ProtocolInstance, error) { return nil, errLocal })
+	fn, ok := servers[0].protocols.instantiator(id)
+	require.True(t, ok)
+	_, err = fn(nil)
+	require.Equal(t, errLocal, err)
+	// The other server still has the global protocol.
+	fn, ok = servers[1].protocols.instantiator(id)
+	require.True(t, ok)
+	require.Equal(t, reflect.ValueOf(NewAggregateProtocol).Pointer(),
+		reflect.ValueOf(fn).Pointer())
+}
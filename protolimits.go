@@ -0,0 +1,220 @@
+// +build !js
+
+package onet
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+)
+
+// ProtocolLimits are the hard limits of the resources a single protocol
+// instance can use on this server. If an instance goes over one of them, it
+// is aborted by the Overlay. A value of 0 means no limit.
+type ProtocolLimits struct {
+	// MaxBufferedBytes limits the size of the messages waiting to be
+	// dispatched to the instance.
+	MaxBufferedBytes uint64
+	// MaxGoroutines limits the number of go-routines started with
+	// TreeNodeInstance.Go that are running at the same time.
+	MaxGoroutines int
+	// MaxRuntime limits the time between the creation of the instance and
+	// its end. It only applies to instances created after the limits have
+	// been set.
+	MaxRuntime time.Duration
+}
+
+// protocolUsage tracks the resources used by a TreeNodeInstance.
+type protocolUsage struct {
+	buffered   uint64
+	goroutines int
+	started    time.Time
+	// handling is the time spent in the handlers and channels
+	handling time.Duration
+	timer    network.Timer
+	aborted  bool
+	// abortErr is why the instance has been aborted
+	abortErr error
+	// the execution budget of the run and what has been used of it
+	budget      *ProtocolBudget
+	budgetTimer network.Timer
+	messages    uint64
+	bytes       uint64
+	sync.Mutex
+}
+
+// SetProtocolLimits sets the limits of the protocol instances of this
+// overlay.
+func (o *Overlay) SetProtocolLimits(l ProtocolLimits) {
+	o.limitsMut.Lock()
+	defer o.limitsMut.Unlock()
+	o.limits = l
+}
+
+// ProtocolLimits returns the limits of the protocol instances of this
+// overlay.
+func (o *Overlay) ProtocolLimits() ProtocolLimits {
+	o.limitsMut.Lock()
+	defer o.limitsMut.Unlock()
+	return o.limits
+}
+
+// SetProtocolLimits sets the limits of the protocol instances running on
+// this server, see ProtocolLimits.
+func (c *Server) SetProtocolLimits(l ProtocolLimits) {
+	c.overlay.SetProtocolLimits(l)
+	c.Audit(AuditConfigChange, auditLocal, fmt.Sprintf("protocol limits %+v", l))
+}
+
+// abort stops the instance because it used too many resources or failed.
+// It returns false if the instance was already aborted.
+func (n *TreeNodeInstance) abort(err error) bool {
+	n.usage.Lock()
+	if n.usage.aborted {
+		n.usage.Unlock()
+		return false
+	}
+	n.usage.aborted = true
+	n.usage.abortErr = err
+	n.usage.Unlock()
+	log.Errorf("%s: aborting protocol %s: %s", n.ServerIdentity().Address,
+		n.ProtocolName(), err)
+	n.overlay.server.RecordEvent(EventProtocolFailure, "aborting ",
+		n.ProtocolName(), ": ", err)
+	// The overlay might be locked by the caller.
+	go n.overlay.nodeDone(n.token)
+	return true
+}
+
+// AbortError returns why the instance has been aborted by the overlay, or
+// nil if it hasn't been. It is a *BudgetExceededError if the instance went
+// over its budget, a *ProtocolPanicError if the protocol panicked, and a
+// *RemoteAbortError if a child panicked.
+func (n *TreeNodeInstance) AbortError() error {
+	n.usage.Lock()
+	defer n.usage.Unlock()
+	return n.usage.abortErr
+}
+
+// startUsage starts the accounting of the resources and the timer of the
+// maximum runtime.
+func (n *TreeNodeInstance) startUsage() {
+	n.usage.started = n.Clock().Now()
+	if max := n.overlay.ProtocolLimits().MaxRuntime; max > 0 {
+		n.usage.timer = n.Clock().AfterFunc(max, func() {
+			n.abort(fmt.Errorf("running for more than %s", max))
+		})
+	}
+}
+
+func (n *TreeNodeInstance) stopUsage() {
+	n.usage.Lock()
+	defer n.usage.Unlock()
+	if n.usage.timer != nil {
+		n.usage.timer.Stop()
+	}
+	if n.usage.budgetTimer != nil {
+		n.usage.budgetTimer.Stop()
+	}
+}
+
+// msgSize returns the size of msg for the accounting.
+func msgSize(msg *ProtocolMsg) uint64 {
+	if msg.size > 0 {
+		return msg.size
+	}
+	return uint64(len(msg.MsgSlice))
+}
+
+// bufferMsg counts msg as buffered and returns true, or aborts the instance
+// and returns false if that would exceed the limit.
+func (n *TreeNodeInstance) bufferMsg(msg *ProtocolMsg) bool {
+	max := n.overlay.ProtocolLimits().MaxBufferedBytes
+	size := msgSize(msg)
+	n.usage.Lock()
+	if n.usage.aborted {
+		n.usage.Unlock()
+		return false
+	}
+	if max > 0 && n.usage.buffered+size > max {
+		n.usage.Unlock()
+		n.abort(fmt.Errorf("more than %d bytes of messages buffered", max))
+		return false
+	}
+	n.usage.buffered += size
+	n.usage.Unlock()
+	return true
+}
+
+// dispatched removes msg from the buffered bytes and adds the time it took
+// to handle it.
+func (pu *protocolUsage) dispatched(msg *ProtocolMsg, took time.Duration) {
+	pu.Lock()
+	defer pu.Unlock()
+	if size := msgSize(msg); size <= pu.buffered {
+		pu.buffered -= size
+	} else {
+		pu.buffered = 0
+	}
+	pu.handling += took
+}
+
+// Go runs fn in a new go-routine that is accounted to this protocol
+// instance. If this would make the instance run more go-routines than
+// allowed, fn is not run and the instance is aborted.
+func (n *TreeNodeInstance) Go(fn func()) {
+	max := n.overlay.ProtocolLimits().MaxGoroutines
+	n.usage.Lock()
+	if max > 0 && n.usage.goroutines >= max {
+		n.usage.Unlock()
+		n.abort(fmt.Errorf("more than %d go-routines", max))
+		return
+	}
+	n.usage.goroutines++
+	n.usage.Unlock()
+	go func() {
+		defer func() {
+			n.usage.Lock()
+			n.usage.goroutines--
+			n.usage.Unlock()
+		}()
+		defer n.recoverPanic("running a go-routine")
+		fn()
+	}()
+}
+
+// usageStatus returns the resources used by the instance.
+func (n *TreeNodeInstance) usageStatus() map[string]interface{} {
+	n.usage.Lock()
+	defer n.usage.Unlock()
+	return map[string]interface{}{
+		"Buffered":   n.usage.buffered,
+		"Goroutines": n.usage.goroutines,
+		"Runtime":    n.Clock().Now().Sub(n.usage.started),
+		"Handling":   n.usage.handling,
+		"Messages":   n.usage.messages,
+		"Bytes":      n.usage.bytes,
+	}
+}
+
+// GetStatus implements the StatusReporter interface. It returns the
+// resources used by every running protocol instance.
+func (o *Overlay) GetStatus() *Status {
+	o.instancesLock.Lock()
+	tnis := make([]*TreeNodeInstance, 0, len(o.instances))
+	for _, tni := range o.instances {
+		tnis = append(tnis, tni)
+	}
+	o.instancesLock.Unlock()
+	st := NewStatus()
+	st.Set("Instances", len(tnis))
+	st.Set("Reservations", o.reservationStatus())
+	for _, tni := range tnis {
+		st.Set(tni.ProtocolName()+"/"+tni.TokenID().String(),
+			tni.usageStatus())
+	}
+	return st
+}
@@ -0,0 +1,90 @@
+package onet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dedis/onet/network"
+	"github.com/stretchr/testify/require"
+)
+
+// newLimitedInstance returns a running instance of ProtocolOverlay on the
+// root of a new tree, with the given limits.
+func newLimitedInstance(t *testing.T, local *LocalTest, l ProtocolLimits) *TreeNodeInstance {
+	GlobalProtocolRegister("ProtocolOverlay", func(n *TreeNodeInstance) (ProtocolInstance, error) {
+		return &ProtocolOverlay{TreeNodeInstance: n}, nil
+	})
+	h, _, tree := local.GenTree(2, true)
+	h[0].SetProtocolLimits(l)
+	pi, err := h[0].CreateProtocol("ProtocolOverlay", tree)
+	require.Nil(t, err)
+	return pi.(*ProtocolOverlay).TreeNodeInstance
+}
+
+// waitAborted waits until the instance has been removed from the overlay.
+func waitAborted(t *testing.T, tni *TreeNodeInstance) {
+	for i := 0; i < 50; i++ {
+		tni.overlay.instancesLock.Lock()
+		_, ok := tni.overlay.instances[tni.TokenID()]
+		tni.overlay.instancesLock.Unlock()
+		if !ok {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("instance has not been aborted")
+}
+
+func TestProtocolLimits_Buffered(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	tni := newLimitedInstance(t, local, ProtocolLimits{MaxBufferedBytes: 100})
+
+	require.True(t, tni.bufferMsg(&ProtocolMsg{size: 60}))
+	tni.usage.dispatched(&ProtocolMsg{size: 60}, time.Millisecond)
+	require.Equal(t, uint64(0), tni.usageStatus()["Buffered"])
+	require.Equal(t, time.Millisecond, tni.usageStatus()["Handling"])
+
+	require.False(t, tni.bufferMsg(&ProtocolMsg{size: 200}))
+	waitAborted(t, tni)
+	require.False(t, tni.bufferMsg(&ProtocolMsg{size: 1}))
+}
+
+func TestProtocolLimits_Goroutines(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	tni := newLimitedInstance(t, local, ProtocolLimits{MaxGoroutines: 1})
+
+	release := make(chan bool)
+	tni.Go(func() { <-release })
+	require.Equal(t, 1, tni.usageStatus()["Goroutines"])
+	ran := false
+	tni.Go(func() { ran = true })
+	waitAborted(t, tni)
+	require.False(t, ran)
+	close(release)
+}
+
+func TestProtocolLimits_Runtime(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	tni := newLimitedInstance(t, local, ProtocolLimits{MaxRuntime: 50 * time.Millisecond})
+	st := tni.overlay.GetStatus()
+	_, ok := st.Value(tni.ProtocolName() + "/" + tni.TokenID().String())
+	require.True(t, ok)
+	waitAborted(t, tni)
+}
+
+func TestProtocolLimits_RuntimeMockClock(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	clock := network.NewMockClock(time.Now())
+	local.SetClock(clock)
+	tni := newLimitedInstance(t, local, ProtocolLimits{MaxRuntime: time.Hour})
+
+	clock.Advance(time.Minute)
+	require.Equal(t, time.Minute, tni.usageStatus()["Runtime"])
+	require.Nil(t, tni.AbortError())
+	clock.Advance(time.Hour)
+	waitAborted(t, tni)
+}
@@ -0,0 +1,235 @@
+// +build !js
+
+package onet
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"sync"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+)
+
+// ErrQuiesced is returned when a protocol is created while the overlay is
+// quiesced.
+var ErrQuiesced = errors.New("overlay is quiesced")
+
+// pausedBucket holds the messages received while the overlay is quiesced.
+var pausedBucket = []byte("onet_paused")
+
+// pausedMsg is a message received while the overlay was quiesced, as it is
+// stored in the database.
+type pausedMsg struct {
+	ServerIdentity *network.ServerIdentity
+	Msg            []byte
+}
+
+func init() {
+	network.RegisterMessage(pausedMsg{})
+}
+
+// dispatchPause tracks the messages being processed by the overlay and
+// whether new messages must be buffered.
+type dispatchPause struct {
+	paused   bool
+	inflight int
+	// idle is closed once no message is processed anymore, if Quiesce is
+	// waiting for it
+	idle chan struct{}
+	// messages that couldn't be stored in the database
+	buffer []*network.Envelope
+	sync.Mutex
+}
+
+// Quiesce stops the creation of new protocol instances and pauses the
+// dispatch of protocol messages. It returns once all messages being
+// processed are done. Messages received afterwards are stored in the
+// database, so that they survive a restart, and are processed by Resume,
+// or when the server starts again. Protocol instances keep running, but
+// they don't get new messages.
+//
+// If ctx is done before all messages are processed, the overlay is resumed
+// and the error of ctx is returned.
+func (o *Overlay) Quiesce(ctx context.Context) error {
+	o.pause.Lock()
+	o.pause.paused = true
+	if o.pause.inflight == 0 {
+		o.pause.Unlock()
+		return nil
+	}
+	if o.pause.idle == nil {
+		o.pause.idle = make(chan struct{})
+	}
+	done := o.pause.idle
+	o.pause.Unlock()
+	log.Lvl2(o.server.Address(), "quiescing overlay")
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		o.Resume()
+		return ctx.Err()
+	}
+}
+
+// Quiesced returns whether the overlay is quiesced.
+func (o *Overlay) Quiesced() bool {
+	o.pause.Lock()
+	defer o.pause.Unlock()
+	return o.pause.paused
+}
+
+// Resume processes the messages received while the overlay was quiesced, in
+// the order they arrived, and then resumes the normal dispatch.
+func (o *Overlay) Resume() {
+	for {
+		o.pause.Lock()
+		envs, err := o.takePaused()
+		if err != nil {
+			log.Error("Couldn't read paused messages:", err)
+		}
+		envs = append(envs, o.pause.buffer...)
+		o.pause.buffer = nil
+		if len(envs) == 0 {
+			o.pause.paused = false
+			o.pause.Unlock()
+			log.Lvl2(o.server.Address(), "resumed overlay")
+			return
+		}
+		o.pause.Unlock()
+		for _, env := range envs {
+			o.process(env)
+		}
+	}
+}
+
+// enter returns false if the overlay is quiesced, after buffering env.
+// Else it counts env as being processed until leave is called.
+func (dp *dispatchPause) enter(o *Overlay, env *network.Envelope) bool {
+	dp.Lock()
+	defer dp.Unlock()
+	if !dp.paused {
+		dp.inflight++
+		return true
+	}
+	if err := o.storePaused(env); err != nil {
+		log.Error("Couldn't store paused message, keeping it in memory:", err)
+		dp.buffer = append(dp.buffer, env)
+	}
+	return false
+}
+
+func (dp *dispatchPause) leave() {
+	dp.Lock()
+	defer dp.Unlock()
+	dp.inflight--
+	if dp.inflight == 0 && dp.idle != nil {
+		close(dp.idle)
+		dp.idle = nil
+	}
+}
+
+// resumePaused processes the messages left in the database by a server
+// that has been stopped while quiesced. The overlay stays quiesced until
+// they are processed, so that the messages received meanwhile come after
+// them.
+func (o *Overlay) resumePaused() {
+	var found bool
+	o.server.serviceManager.dbView(func(tx *bolt.Tx) error {
+		found = tx.Bucket(pausedBucket) != nil
+		return nil
+	})
+	if !found {
+		return
+	}
+	o.pause.Lock()
+	o.pause.paused = true
+	o.pause.Unlock()
+	log.Lvl2(o.server.Address(), "processing the messages stored while quiesced")
+	go o.Resume()
+}
+
+// storePaused appends env to the paused messages in the database.
+func (o *Overlay) storePaused(env *network.Envelope) error {
+	msg, err := network.Marshal(env.Msg)
+	if err != nil {
+		return err
+	}
+	buf, err := network.Marshal(&pausedMsg{ServerIdentity: env.ServerIdentity, Msg: msg})
+	if err != nil {
+		return err
+	}
+	return o.server.serviceManager.dbUpdate(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(pausedBucket)
+		if err != nil {
+			return err
+		}
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, seq)
+		return b.Put(key, buf)
+	})
+}
+
+// takePaused removes all paused messages from the database and returns them
+// in the order they have been stored.
+func (o *Overlay) takePaused() ([]*network.Envelope, error) {
+	var bufs [][]byte
+	err := o.server.serviceManager.dbUpdate(func(tx *bolt.Tx) error {
+		b := tx.Bucket(pausedBucket)
+		if b == nil {
+			return nil
+		}
+		err := b.ForEach(func(k, v []byte) error {
+			buf := make([]byte, len(v))
+			copy(buf, v)
+			bufs = append(bufs, buf)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return tx.DeleteBucket(pausedBucket)
+	})
+	if err != nil {
+		return nil, err
+	}
+	suite := o.suite()
+	var envs []*network.Envelope
+	for _, buf := range bufs {
+		_, m, err := network.Unmarshal(buf, suite)
+		if err != nil {
+			log.Error("Dropping invalid paused message:", err)
+			continue
+		}
+		pm := m.(*pausedMsg)
+		typ, msg, err := network.Unmarshal(pm.Msg, suite)
+		if err != nil {
+			log.Error("Dropping invalid paused message:", err)
+			continue
+		}
+		envs = append(envs, &network.Envelope{
+			ServerIdentity: pm.ServerIdentity,
+			MsgType:        typ,
+			Msg:            msg,
+		})
+	}
+	return envs, nil
+}
+
+// Quiesce pauses the overlay of the server, see Overlay.Quiesce.
+func (c *Server) Quiesce(ctx context.Context) error {
+	return c.overlay.Quiesce(ctx)
+}
+
+// Resume resumes the overlay of the server, see Overlay.Resume.
+func (c *Server) Resume() {
+	c.overlay.Resume()
+}
@@ -0,0 +1,79 @@
+package onet
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dedis/onet/network"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/satori/go.uuid.v1"
+)
+
+func TestOverlay_Quiesce(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	h, _, tree := local.GenTree(2, true)
+	o := h[0].overlay
+
+	require.Nil(t, h[0].Quiesce(context.Background()))
+	require.True(t, o.Quiesced())
+	_, err := h[0].CreateProtocol("ProtocolOverlay", tree)
+	require.Equal(t, ErrQuiesced, err)
+
+	// Messages received while quiesced are stored and processed by Resume
+	// in order.
+	dest := TokenID(uuid.NewV4())
+	for _, d := range []string{"first", "second"} {
+		o.Process(&network.Envelope{
+			ServerIdentity: h[1].ServerIdentity,
+			MsgType:        ConfigMsgID,
+			Msg:            &ConfigMsg{Config: GenericConfig{Data: []byte(d)}, Dest: dest},
+		})
+	}
+	require.Nil(t, o.getConfig(dest))
+	h[0].Resume()
+	require.False(t, o.Quiesced())
+	require.Equal(t, []byte("second"), o.getConfig(dest).Data)
+	envs, err := o.takePaused()
+	require.Nil(t, err)
+	require.Empty(t, envs)
+}
+
+func TestOverlay_QuiesceTimeout(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	o := local.GenServers(1)[0].overlay
+
+	// A message that is being processed blocks the quiescence.
+	o.pause.enter(o, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	require.Equal(t, context.DeadlineExceeded, o.Quiesce(ctx))
+	require.False(t, o.Quiesced())
+	o.pause.leave()
+	require.Nil(t, o.Quiesce(context.Background()))
+	o.Resume()
+}
+
+func TestOverlay_ResumePaused(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	h := local.GenServers(2)
+	o := h[0].overlay
+
+	// Messages left by a server stopped while quiesced are processed at
+	// the next start.
+	dest := TokenID(uuid.NewV4())
+	require.Nil(t, o.storePaused(&network.Envelope{
+		ServerIdentity: h[1].ServerIdentity,
+		MsgType:        ConfigMsgID,
+		Msg:            &ConfigMsg{Config: GenericConfig{Data: []byte("stored")}, Dest: dest},
+	}))
+	o.resumePaused()
+	for i := 0; i < 50 && o.Quiesced(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.False(t, o.Quiesced())
+	require.Equal(t, []byte("stored"), o.getConfig(dest).Data)
+}
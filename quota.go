@@ -0,0 +1,222 @@
+// +build !js
+
+package onet
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+)
+
+// ErrQuotaExceeded is returned by Context.Save and Context.Publish if the
+// data would make the service use more than its storage quota.
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
+
+// storageUsageTTL is how long the measured usage of a service is trusted.
+// The writes through Context.Save and Context.Publish update it, but the
+// writes to the additional buckets are only seen when it is measured again.
+const storageUsageTTL = time.Minute
+
+// storageQuotas holds the storage limits of the services and a cache of
+// their usage. The usage of a service counts the keys and values of its
+// bucket and of its additional buckets.
+type storageQuotas struct {
+	limits   map[string]int64
+	usage    map[string]int64
+	measured map[string]time.Time
+	// names returns the bucket names of all services, to know which
+	// service an additional bucket belongs to
+	names func() []string
+	sync.Mutex
+}
+
+func (sq *storageQuotas) setLimit(name string, max int64) {
+	sq.Lock()
+	defer sq.Unlock()
+	if sq.limits == nil {
+		sq.limits = make(map[string]int64)
+	}
+	sq.limits[name] = max
+}
+
+func (sq *storageQuotas) limit(name string) int64 {
+	sq.Lock()
+	defer sq.Unlock()
+	return sq.limits[name]
+}
+
+// forget removes the cached usage, so that it is measured again before the
+// next write.
+func (sq *storageQuotas) forget(name string) {
+	sq.Lock()
+	defer sq.Unlock()
+	delete(sq.usage, name)
+}
+
+// current returns the usage of the service name, measured in tx if the
+// cached one is missing or too old. The caller must hold the lock.
+func (sq *storageQuotas) current(tx *bolt.Tx, name string) int64 {
+	if usage, ok := sq.usage[name]; ok &&
+		time.Since(sq.measured[name]) < storageUsageTTL {
+		return usage
+	}
+	var names []string
+	if sq.names != nil {
+		names = sq.names()
+	}
+	usage := serviceUsage(tx, name, names)
+	if sq.usage == nil {
+		sq.usage = make(map[string]int64)
+		sq.measured = make(map[string]time.Time)
+	}
+	sq.usage[name] = usage
+	sq.measured[name] = time.Now()
+	return usage
+}
+
+// usageOf returns the usage of the service name, measured in tx if needed.
+func (sq *storageQuotas) usageOf(tx *bolt.Tx, name string) int64 {
+	sq.Lock()
+	defer sq.Unlock()
+	return sq.current(tx, name)
+}
+
+// charge checks whether delta more bytes keep the service name in its
+// quota, and adds them to its usage if they do. It must be called in the
+// transaction of the write, before the data is written, and the usage must
+// be forgotten if the transaction fails.
+func (sq *storageQuotas) charge(tx *bolt.Tx, name string, delta int64) error {
+	sq.Lock()
+	defer sq.Unlock()
+	if _, ok := sq.usage[name]; !ok && sq.limits[name] <= 0 {
+		return nil
+	}
+	usage := sq.current(tx, name)
+	if max := sq.limits[name]; max > 0 && delta > 0 && usage+delta > max {
+		return ErrQuotaExceeded
+	}
+	sq.usage[name] = usage + delta
+	return nil
+}
+
+// put checks whether storing value under key in the bucket of the service
+// stays in its quota, and stores it if it does. It must be called in the
+// transaction of the write.
+func (sq *storageQuotas) put(tx *bolt.Tx, name []byte, key, value []byte) error {
+	b := tx.Bucket(name)
+	delta := int64(len(value))
+	if old := b.Get(key); old != nil {
+		delta -= int64(len(old))
+	} else {
+		delta += int64(len(key))
+	}
+	if err := sq.charge(tx, string(name), delta); err != nil {
+		return err
+	}
+	return b.Put(key, value)
+}
+
+// serviceUsage returns the size of the keys and values of the bucket name
+// and of the additional buckets of that service. names are the buckets of
+// all services, so that the additional buckets of a service "foo" don't
+// include the ones of a service "foo_bar".
+func serviceUsage(tx *bolt.Tx, name string, names []string) int64 {
+	names = append(names, name)
+	var usage int64
+	tx.ForEach(func(bn []byte, b *bolt.Bucket) error {
+		if bucketOwner(string(bn), names) == name {
+			usage += bucketUsage(b)
+		}
+		return nil
+	})
+	return usage
+}
+
+// bucketOwner returns the longest of names that is either the bucket
+// itself or followed by '_' in it, or "" if there is none.
+func bucketOwner(bucket string, names []string) string {
+	owner := ""
+	for _, n := range names {
+		if len(n) > len(owner) &&
+			(bucket == n || strings.HasPrefix(bucket, n+"_")) {
+			owner = n
+		}
+	}
+	return owner
+}
+
+func bucketUsage(b *bolt.Bucket) int64 {
+	var usage int64
+	b.ForEach(func(k, v []byte) error {
+		usage += int64(len(k))
+		if v == nil {
+			usage += bucketUsage(b.Bucket(k))
+		} else {
+			usage += int64(len(v))
+		}
+		return nil
+	})
+	return usage
+}
+
+// SetStorageQuota limits the data this service can store in the database to
+// max bytes of keys and values. Context.Save and Context.Publish return
+// ErrQuotaExceeded if the limit would be passed. The data in the
+// additional buckets counts towards the quota, but as the writes through
+// the *bolt.DB of GetAdditionalBucket can't be checked, the quota is only
+// advisory for them: they are seen when the usage is measured again, at
+// most a minute later, and then make the next checked writes fail. A max
+// of 0 removes the quota.
+func (c *Context) SetStorageQuota(max int64) {
+	c.manager.quotas.setLimit(string(c.bucketName), max)
+	c.manager.quotas.forget(string(c.bucketName))
+}
+
+// StorageUsage returns how many bytes of keys and values this service
+// stores in the database.
+func (c *Context) StorageUsage() (int64, error) {
+	var usage int64
+	err := c.manager.dbView(func(tx *bolt.Tx) error {
+		usage = serviceUsage(tx, string(c.bucketName), c.manager.storageNames())
+		return nil
+	})
+	return usage, err
+}
+
+// addStorageStatus adds the storage usage and quota of every service to the
+// status. The usage is only measured if the cached one is too old. It must
+// be called with dbMut held.
+func (s *serviceManager) addStorageStatus(status *Status) {
+	err := s.db.View(func(tx *bolt.Tx) error {
+		for _, name := range s.storageNames() {
+			status.Set("Storage."+name, map[string]interface{}{
+				"Usage": s.quotas.usageOf(tx, name),
+				"Quota": s.quotas.limit(name),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		status.Set("StorageError", err.Error())
+	}
+}
+
+// storageNames returns the names of the buckets of all services, including
+// the ones of the tenants.
+func (s *serviceManager) storageNames() []string {
+	names := s.availableServices()
+	s.tenantsMut.RLock()
+	defer s.tenantsMut.RUnlock()
+	for _, tn := range s.tenants {
+		if tn == nil {
+			continue
+		}
+		for name := range tn.ids {
+			names = append(names, tn.name+"/"+name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,60 @@
+package onet
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/dedis/onet/network"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContext_StorageQuota(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "conode")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmp)
+	network.RegisterMessage(ContextData{})
+	c := createContext(t, tmp)
+
+	require.Nil(t, c.Save([]byte("a"), &ContextData{1, "one"}))
+	usage, err := c.StorageUsage()
+	require.Nil(t, err)
+	require.NotZero(t, usage)
+
+	c.SetStorageQuota(usage + 10)
+	// Overwriting with data of the same size is always possible.
+	require.Nil(t, c.Save([]byte("a"), &ContextData{2, "two"}))
+	require.Equal(t, ErrQuotaExceeded,
+		c.Save([]byte("b"), &ContextData{3, "a string longer than the quota"}))
+	msg, err := c.Load([]byte("b"))
+	require.Nil(t, err)
+	require.Nil(t, msg)
+	_, err = c.Publish("events", &ContextData{3, "a string longer than the quota"})
+	require.Equal(t, ErrQuotaExceeded, err)
+	after, err := c.StorageUsage()
+	require.Nil(t, err)
+	require.Equal(t, usage, after)
+
+	c.SetStorageQuota(0)
+	require.Nil(t, c.Save([]byte("b"), &ContextData{3, "a string longer than the quota"}))
+}
+
+func TestServiceManager_StorageStatus(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	srv := local.GenServers(1)[0]
+	st := srv.serviceManager.GetStatus()
+	v, ok := st.Value("Storage." + serviceWebSocket)
+	require.True(t, ok)
+	require.Equal(t, int64(0), v.(map[string]interface{})["Quota"])
+}
+
+func TestBucketOwner(t *testing.T) {
+	names := []string{"foo", "foo_bar", "tenant/foo"}
+	require.Equal(t, "foo", bucketOwner("foo", names))
+	require.Equal(t, "foo", bucketOwner("foo_new", names))
+	require.Equal(t, "foo_bar", bucketOwner("foo_bar", names))
+	require.Equal(t, "foo_bar", bucketOwner("foo_bar_new", names))
+	require.Equal(t, "tenant/foo", bucketOwner("tenant/foo_new", names))
+	require.Equal(t, "", bucketOwner("foobar", names))
+}
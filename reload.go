@@ -0,0 +1,86 @@
+// +build !js
+
+package onet
+
+import (
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/dedis/onet/log"
+)
+
+// SetReloader sets the function applying a new configuration to the server,
+// called by Reload. It returns the names of the settings that changed but
+// can only be applied by a restart.
+func (c *Server) SetReloader(fn func() ([]string, error)) {
+	c.reloadLock.Lock()
+	defer c.reloadLock.Unlock()
+	c.reloader = fn
+}
+
+// Reload reads the ACL file and the certificate files of the websocket
+// again, and calls the function given to SetReloader. It is called when the
+// server receives SIGHUP. The settings that need a restart are logged and
+// recorded as an EventConfigReloaded.
+func (c *Server) Reload() error {
+	log.Lvl1(c.Address(), "reloads its configuration")
+	if err := c.ReloadACL(); err != nil {
+		return err
+	}
+	c.websocket.Lock()
+	certs := c.websocket.certs
+	c.websocket.Unlock()
+	if certs != nil {
+		if err := certs.forceReload(); err != nil {
+			return err
+		}
+	}
+	c.reloadLock.Lock()
+	fn := c.reloader
+	c.reloadLock.Unlock()
+	var restart []string
+	if fn != nil {
+		var err error
+		if restart, err = fn(); err != nil {
+			return err
+		}
+	}
+	if len(restart) > 0 {
+		log.Warn("These settings changed, but need a restart:", strings.Join(restart, ", "))
+		c.RecordEvent(EventConfigReloaded, "restart needed for ", strings.Join(restart, ", "))
+	} else {
+		c.RecordEvent(EventConfigReloaded, "all settings applied")
+	}
+	c.Audit(AuditConfigChange, auditLocal, "configuration reloaded")
+	return nil
+}
+
+// handleSIGHUP calls Reload whenever the process receives SIGHUP, until
+// stopSIGHUP is called. It does nothing where there are no reloadSignals.
+func (c *Server) handleSIGHUP() {
+	c.reloadLock.Lock()
+	defer c.reloadLock.Unlock()
+	if c.sighup != nil || len(reloadSignals) == 0 {
+		return
+	}
+	c.sighup = make(chan os.Signal, 1)
+	signal.Notify(c.sighup, reloadSignals...)
+	go func(ch chan os.Signal) {
+		for range ch {
+			if err := c.Reload(); err != nil {
+				log.Error("Couldn't reload the configuration:", err)
+			}
+		}
+	}(c.sighup)
+}
+
+func (c *Server) stopSIGHUP() {
+	c.reloadLock.Lock()
+	defer c.reloadLock.Unlock()
+	if c.sighup != nil {
+		signal.Stop(c.sighup)
+		close(c.sighup)
+		c.sighup = nil
+	}
+}
@@ -0,0 +1,11 @@
+// +build !js
+
+package onet
+
+import (
+	"os"
+	"syscall"
+)
+
+// reloadSignals are the signals making the server call Reload.
+var reloadSignals = []os.Signal{syscall.SIGHUP}
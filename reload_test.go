@@ -0,0 +1,31 @@
+package onet
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_Reload(t *testing.T) {
+	l := NewLocalTest(tSuite)
+	defer l.CloseAll()
+	s := l.GenServers(1)[0]
+
+	require.Nil(t, s.Reload())
+	events := s.Events()
+	require.Equal(t, EventConfigReloaded, events[len(events)-1].Kind)
+	require.Equal(t, "all settings applied", events[len(events)-1].Message)
+
+	s.SetReloader(func() ([]string, error) {
+		return []string{"Address", "DBPath"}, nil
+	})
+	require.Nil(t, s.Reload())
+	events = s.Events()
+	require.Equal(t, "restart needed for Address, DBPath", events[len(events)-1].Message)
+
+	s.SetReloader(func() ([]string, error) {
+		return nil, errors.New("invalid file")
+	})
+	require.NotNil(t, s.Reload())
+}
@@ -0,0 +1,32 @@
+// +build freebsd linux darwin
+
+package onet
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_SIGHUP(t *testing.T) {
+	l := NewLocalTest(tSuite)
+	defer l.CloseAll()
+	s := l.GenServers(1)[0]
+
+	reloaded := make(chan bool, 1)
+	s.SetReloader(func() ([]string, error) {
+		reloaded <- true
+		return nil, nil
+	})
+	// Start installs the handler in the background, make sure it is there
+	// before sending the signal.
+	s.handleSIGHUP()
+	require.Nil(t, syscall.Kill(syscall.Getpid(), syscall.SIGHUP))
+	select {
+	case <-reloaded:
+	case <-time.After(2 * time.Second):
+		t.Fatal("SIGHUP didn't reload the configuration")
+	}
+}
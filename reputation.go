@@ -0,0 +1,211 @@
+// +build !js
+
+package onet
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/dedis/onet/network"
+)
+
+func init() {
+	network.RegisterMessage(PeerReputation{})
+}
+
+// ReputationHalfLife is the time after which the score of a peer is halved
+// if no new misbehavior is reported.
+var ReputationHalfLife = 24 * time.Hour
+
+// ReputationStatusPeers is the maximum number of peers that are shown in the
+// status report, starting with the worst one.
+var ReputationStatusPeers = 10
+
+// reputationBucket is the name of the bucket that holds the reputation of all
+// peers. It is shared by all services of a Server.
+var reputationBucket = []byte("onet_reputation")
+
+// PeerReputation holds the misbehavior score of a peer. A score of 0 means
+// that no misbehavior has been reported, the higher the score, the worse the
+// peer. The score decays over time with ReputationHalfLife.
+type PeerReputation struct {
+	// ID of the ServerIdentity of the peer
+	ID network.ServerIdentityID
+	// Address of the peer the last time it has been reported
+	Address network.Address
+	// Score is the decayed sum of all penalties reported
+	Score float64
+	// Reports counts how many times misbehavior has been reported
+	Reports int
+	// Updated is the time of the last report, in nanoseconds since the epoch
+	Updated int64
+}
+
+// decay applies the exponential decay of the score between the last update
+// and now.
+func (pr *PeerReputation) decay(now time.Time) {
+	elapsed := now.Sub(time.Unix(0, pr.Updated))
+	if elapsed > 0 && ReputationHalfLife > 0 {
+		pr.Score *= math.Pow(0.5, float64(elapsed)/float64(ReputationHalfLife))
+	}
+	pr.Updated = now.UnixNano()
+}
+
+// reputationStore keeps the reputation of the peers in the database of the
+// Server, so that it survives restarts and is shared between the services.
+type reputationStore struct {
+	sm    *serviceManager
+	suite network.Suite
+	// serializes read-modify-write cycles
+	sync.Mutex
+}
+
+// newReputationStore makes sure the reputation bucket exists in the database
+// of the serviceManager.
+func newReputationStore(sm *serviceManager, suite network.Suite) (*reputationStore, error) {
+	err := sm.dbUpdate(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(reputationBucket)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &reputationStore{sm: sm, suite: suite}, nil
+}
+
+// load returns the stored reputation of id, or nil if there is none.
+func (rs *reputationStore) load(id network.ServerIdentityID) (*PeerReputation, error) {
+	var buf []byte
+	err := rs.sm.dbView(func(tx *bolt.Tx) error {
+		v := tx.Bucket(reputationBucket).Get(id[:])
+		if v != nil {
+			buf = make([]byte, len(v))
+			copy(buf, v)
+		}
+		return nil
+	})
+	if err != nil || buf == nil {
+		return nil, err
+	}
+	_, msg, err := network.Unmarshal(buf, rs.suite)
+	if err != nil {
+		return nil, err
+	}
+	pr, ok := msg.(*PeerReputation)
+	if !ok {
+		return nil, fmt.Errorf("wrong type in reputation of %s", id)
+	}
+	return pr, nil
+}
+
+// store writes pr to the database.
+func (rs *reputationStore) store(pr *PeerReputation) error {
+	buf, err := network.Marshal(pr)
+	if err != nil {
+		return err
+	}
+	return rs.sm.dbUpdate(func(tx *bolt.Tx) error {
+		return tx.Bucket(reputationBucket).Put(pr.ID[:], buf)
+	})
+}
+
+// report adds penalty to the decayed score of si and returns the new
+// reputation.
+func (rs *reputationStore) report(si *network.ServerIdentity, penalty float64) (*PeerReputation, error) {
+	rs.Lock()
+	defer rs.Unlock()
+	pr, err := rs.load(si.ID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if pr == nil {
+		pr = &PeerReputation{ID: si.ID, Updated: now.UnixNano()}
+	}
+	pr.decay(now)
+	pr.Address = si.Address
+	pr.Score += penalty
+	pr.Reports++
+	return pr, rs.store(pr)
+}
+
+// get returns the decayed reputation of the peer with the given id. If
+// nothing has been reported for that peer, an empty reputation is returned.
+func (rs *reputationStore) get(id network.ServerIdentityID) (*PeerReputation, error) {
+	pr, err := rs.load(id)
+	if err != nil {
+		return nil, err
+	}
+	if pr == nil {
+		return &PeerReputation{ID: id}, nil
+	}
+	pr.decay(time.Now())
+	return pr, nil
+}
+
+// reset removes all reputation of the peer with the given id.
+func (rs *reputationStore) reset(id network.ServerIdentityID) error {
+	rs.Lock()
+	defer rs.Unlock()
+	return rs.sm.dbUpdate(func(tx *bolt.Tx) error {
+		return tx.Bucket(reputationBucket).Delete(id[:])
+	})
+}
+
+// all returns the decayed reputation of all known peers, starting with the
+// worst one.
+func (rs *reputationStore) all() ([]*PeerReputation, error) {
+	var bufs [][]byte
+	err := rs.sm.dbView(func(tx *bolt.Tx) error {
+		return tx.Bucket(reputationBucket).ForEach(func(k, v []byte) error {
+			buf := make([]byte, len(v))
+			copy(buf, v)
+			bufs = append(bufs, buf)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	prs := make([]*PeerReputation, 0, len(bufs))
+	for _, buf := range bufs {
+		_, msg, err := network.Unmarshal(buf, rs.suite)
+		if err != nil {
+			return nil, err
+		}
+		pr, ok := msg.(*PeerReputation)
+		if !ok {
+			return nil, fmt.Errorf("wrong type in reputation bucket")
+		}
+		pr.decay(now)
+		prs = append(prs, pr)
+	}
+	sort.Slice(prs, func(i, j int) bool { return prs[i].Score > prs[j].Score })
+	return prs, nil
+}
+
+// GetStatus implements the StatusReporter interface. It returns the number
+// of peers with a reputation and the score of the worst ones.
+func (rs *reputationStore) GetStatus() *Status {
+	prs, err := rs.all()
+	if err != nil {
+		return &Status{Field: map[string]string{"Error": err.Error()}}
+	}
+	st := NewStatus()
+	st.Set("Peers", len(prs))
+	for i, pr := range prs {
+		if i >= ReputationStatusPeers {
+			break
+		}
+		st.Set(pr.Address.String(), map[string]interface{}{
+			"Score":   pr.Score,
+			"Reports": pr.Reports,
+		})
+	}
+	return st
+}
@@ -0,0 +1,67 @@
+package onet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeerReputation_Decay(t *testing.T) {
+	now := time.Now()
+	pr := &PeerReputation{Score: 4, Updated: now.Add(-ReputationHalfLife).UnixNano()}
+	pr.decay(now)
+	require.InDelta(t, 2, pr.Score, 1e-9)
+	require.Equal(t, now.UnixNano(), pr.Updated)
+
+	pr.decay(now.Add(2 * ReputationHalfLife))
+	require.InDelta(t, 0.5, pr.Score, 1e-9)
+}
+
+func TestContext_ReportPeer(t *testing.T) {
+	l := NewLocalTest(tSuite)
+	defer l.CloseAll()
+	servers := l.GenServers(3)
+	s := servers[0]
+	c := newContext(s, s.overlay, ServiceID{}, s.serviceManager)
+	bad, worse := servers[1].ServerIdentity, servers[2].ServerIdentity
+
+	pr, err := c.PeerReputation(bad)
+	require.Nil(t, err)
+	require.Equal(t, 0.0, pr.Score)
+	require.Equal(t, 0, pr.Reports)
+
+	pr, err = c.ReportPeer(bad, 1)
+	require.Nil(t, err)
+	require.Equal(t, 1, pr.Reports)
+	_, err = c.ReportPeer(worse, 5)
+	require.Nil(t, err)
+	_, err = c.ReportPeer(worse, 5)
+	require.Nil(t, err)
+
+	pr, err = c.PeerReputation(worse)
+	require.Nil(t, err)
+	require.Equal(t, 2, pr.Reports)
+	require.True(t, pr.Score > 9 && pr.Score <= 10)
+	require.Equal(t, worse.Address, pr.Address)
+
+	prs, err := c.PeerReputations()
+	require.Nil(t, err)
+	require.Equal(t, 2, len(prs))
+	require.Equal(t, worse.ID, prs[0].ID)
+
+	st := c.ReportStatus()["Reputation"]
+	require.NotNil(t, st)
+	require.Equal(t, "2", st.Field["Peers"])
+	v, ok := st.Value(worse.Address.String())
+	require.True(t, ok)
+	require.Equal(t, 2, v.(map[string]interface{})["Reports"])
+
+	require.Nil(t, c.ResetPeerReputation(worse))
+	pr, err = c.PeerReputation(worse)
+	require.Nil(t, err)
+	require.Equal(t, 0, pr.Reports)
+	prs, err = c.PeerReputations()
+	require.Nil(t, err)
+	require.Equal(t, 1, len(prs))
+}
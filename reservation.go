@@ -0,0 +1,145 @@
+// +build !js
+
+package onet
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/dedis/onet/log"
+)
+
+// ErrReservationExceeded is returned when a protocol instance cannot be
+// created because its protocol already uses all its reserved resources on
+// this node.
+var ErrReservationExceeded = errors.New("protocol reservation exceeded")
+
+// ProtocolReservation are the resources a protocol can use on a node. A
+// service sets it on all nodes, so that a burst of requests cannot start
+// more heavy rounds than the nodes of the roster can handle. A value of 0
+// means no limit.
+type ProtocolReservation struct {
+	// MaxInstances is the maximum number of instances of the protocol
+	// running at the same time on a node.
+	MaxInstances int
+	// MemoryHint is the memory an instance is expected to use. The sum of
+	// the hints of the running instances cannot go over the memory budget
+	// of the overlay.
+	MemoryHint uint64
+}
+
+// reservations keeps track of the resources used by the running instances
+// of the protocols with a reservation.
+type reservations struct {
+	protocols map[ProtocolID]ProtocolReservation
+	running   map[ProtocolID]int
+	memory    uint64
+	budget    uint64
+	sync.Mutex
+}
+
+// ReserveProtocol sets the reservation of the protocol called name. It is
+// enforced for instances created with CreateProtocol and StartProtocol, and
+// for the instances created when a message for a new instance arrives. The
+// instances already running are accounted for.
+func (o *Overlay) ReserveProtocol(name string, r ProtocolReservation) {
+	id := ProtocolNameToID(name)
+	res := &o.reservations
+	res.Lock()
+	defer res.Unlock()
+	if res.protocols == nil {
+		res.protocols = make(map[ProtocolID]ProtocolReservation)
+	}
+	res.protocols[id] = r
+}
+
+// SetMemoryBudget sets the memory available to the instances of the
+// protocols with a MemoryHint. 0 means no limit.
+func (o *Overlay) SetMemoryBudget(budget uint64) {
+	o.reservations.Lock()
+	defer o.reservations.Unlock()
+	o.reservations.budget = budget
+}
+
+// ReserveProtocol sets the reservation of the protocol called name on this
+// node. Every node of the roster must do it, which is the case if it is
+// done in the constructor of the service.
+func (c *Context) ReserveProtocol(name string, r ProtocolReservation) {
+	c.overlay.ReserveProtocol(name, r)
+}
+
+// acquire reserves the resources of a new instance of the protocol id. It
+// returns the reservation to be stored in the instance, which is nil if
+// the protocol has none.
+func (o *Overlay) acquire(id ProtocolID) (*ProtocolReservation, error) {
+	res := &o.reservations
+	res.Lock()
+	defer res.Unlock()
+	r, ok := res.protocols[id]
+	if !ok {
+		return nil, nil
+	}
+	if r.MaxInstances > 0 && res.running[id] >= r.MaxInstances {
+		log.Lvl2(o.server.Address(), "already running", res.running[id],
+			"instances of", o.server.protocols.ProtocolIDToName(id))
+		return nil, ErrReservationExceeded
+	}
+	if res.budget > 0 && res.memory+r.MemoryHint > res.budget {
+		log.Lvl2(o.server.Address(), "memory budget used:", res.memory)
+		return nil, ErrReservationExceeded
+	}
+	if res.running == nil {
+		res.running = make(map[ProtocolID]int)
+	}
+	res.running[id]++
+	res.memory += r.MemoryHint
+	return &r, nil
+}
+
+// refuseInstance tells the sender of msg that no instance is created for
+// it, so that its instance, and the root, abort instead of waiting.
+func (o *Overlay) refuseInstance(msg *ProtocolMsg, err error) {
+	if msg.From == nil || msg.ServerIdentity == nil {
+		return
+	}
+	refusal := &AbortMsg{
+		Dest:   msg.From.ID(),
+		Origin: o.server.ServerIdentity,
+		Reason: "refusing new instance: " + err.Error(),
+	}
+	if _, err := o.server.Send(msg.ServerIdentity, refusal); err != nil {
+		log.Error(o.server.Address(), "couldn't refuse instance:", err)
+	}
+}
+
+// release frees the resources reserved for tni, if any.
+func (o *Overlay) release(tni *TreeNodeInstance) {
+	res := &o.reservations
+	res.Lock()
+	defer res.Unlock()
+	if tni.reserved == nil {
+		return
+	}
+	res.running[tni.token.ProtoID]--
+	res.memory -= tni.reserved.MemoryHint
+	tni.reserved = nil
+}
+
+// reservationStatus returns the number of running instances of each
+// protocol with a reservation and their maximum, and the memory they
+// hinted with the budget.
+func (o *Overlay) reservationStatus() map[string]interface{} {
+	res := &o.reservations
+	res.Lock()
+	defer res.Unlock()
+	st := map[string]interface{}{
+		"Memory":       res.memory,
+		"MemoryBudget": res.budget,
+	}
+	for id, r := range res.protocols {
+		name := o.server.protocols.ProtocolIDToName(id)
+		st[name+".Running"] = res.running[id]
+		st[name+".MaxInstances"] = r.MaxInstances
+	}
+	return st
+}
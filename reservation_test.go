@@ -0,0 +1,75 @@
+package onet
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOverlay_ReserveProtocol(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	GlobalProtocolRegister("ProtocolOverlay", func(n *TreeNodeInstance) (ProtocolInstance, error) {
+		return &ProtocolOverlay{TreeNodeInstance: n}, nil
+	})
+	h, _, tree := local.GenTree(2, true)
+	o := h[0].overlay
+	o.ReserveProtocol("ProtocolOverlay", ProtocolReservation{MaxInstances: 2})
+
+	pi1, err := h[0].CreateProtocol("ProtocolOverlay", tree)
+	require.Nil(t, err)
+	_, err = h[0].CreateProtocol("ProtocolOverlay", tree)
+	require.Nil(t, err)
+	_, err = h[0].CreateProtocol("ProtocolOverlay", tree)
+	require.Equal(t, ErrReservationExceeded, err)
+	require.Equal(t, 2, o.reservationStatus()["ProtocolOverlay.Running"])
+	require.Equal(t, 2, o.reservationStatus()["ProtocolOverlay.MaxInstances"])
+
+	pi1.(*ProtocolOverlay).Done()
+	pi3, err := h[0].CreateProtocol("ProtocolOverlay", tree)
+	require.Nil(t, err)
+	pi3.(*ProtocolOverlay).Done()
+	require.Equal(t, 1, o.reservationStatus()["ProtocolOverlay.Running"])
+}
+
+func TestOverlay_MemoryBudget(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	GlobalProtocolRegister("ProtocolOverlay", func(n *TreeNodeInstance) (ProtocolInstance, error) {
+		return &ProtocolOverlay{TreeNodeInstance: n}, nil
+	})
+	h, _, tree := local.GenTree(2, true)
+	o := h[0].overlay
+	o.SetMemoryBudget(1000)
+	o.ReserveProtocol("ProtocolOverlay", ProtocolReservation{MemoryHint: 600})
+
+	pi, err := h[0].CreateProtocol("ProtocolOverlay", tree)
+	require.Nil(t, err)
+	_, err = h[0].CreateProtocol("ProtocolOverlay", tree)
+	require.Equal(t, ErrReservationExceeded, err)
+	pi.(*ProtocolOverlay).Done()
+	require.Equal(t, uint64(0), o.reservationStatus()["Memory"])
+	require.Equal(t, uint64(1000), o.reservationStatus()["MemoryBudget"])
+}
+
+func TestOverlay_RefusedInstance(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	servers, _, tree := local.GenTree(2, true)
+	child := servers[1].overlay
+	child.SetMemoryBudget(100)
+	child.ReserveProtocol("panicProtocol", ProtocolReservation{MemoryHint: 600})
+
+	pi, err := servers[0].StartProtocol("panicProtocol", tree)
+	require.Nil(t, err)
+	root := pi.(*panicProtocol).TreeNodeInstance
+	waitAborted(t, root)
+	rae, ok := root.AbortError().(*RemoteAbortError)
+	require.True(t, ok, "wrong error: %v", root.AbortError())
+	require.True(t, rae.Origin.Equal(servers[1].ServerIdentity))
+	require.Contains(t, rae.Reason, ErrReservationExceeded.Error())
+
+	child.instancesLock.Lock()
+	defer child.instancesLock.Unlock()
+	require.Equal(t, 0, len(child.instances))
+}
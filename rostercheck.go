@@ -0,0 +1,172 @@
+// +build !js
+
+package onet
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/dedis/kyber"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+)
+
+// RosterMismatchError is returned by Server.CheckRoster if an entry of the
+// roster is about the server, but doesn't match its configuration. Such an
+// entry usually comes from an outdated or hand-edited group file, and the
+// other nodes will fail to connect to the server.
+type RosterMismatchError struct {
+	// Index of the entry in the roster
+	Index int
+	// Diffs describe the fields that don't match, one per line
+	Diffs []string
+}
+
+func (e *RosterMismatchError) Error() string {
+	return fmt.Sprintf("roster entry %d doesn't match this server:\n\t%s",
+		e.Index, strings.Join(e.Diffs, "\n\t"))
+}
+
+// CheckRoster returns a *RosterMismatchError if an entry of the roster has
+// the public key or the address of the server, but not its suite, public
+// key and address.
+func (c *Server) CheckRoster(ro *Roster) error {
+	own := c.ServerIdentity.Copy()
+	for i, si := range ro.List {
+		sameSuite := reflect.TypeOf(si.Public) == reflect.TypeOf(own.Public)
+		samePublic := sameSuite && si.Public.Equal(own.Public)
+		sameHost := si.Address.NetworkAddress() == own.Address.NetworkAddress()
+		if !samePublic && !sameHost {
+			continue
+		}
+		var diffs []string
+		if !sameSuite {
+			diffs = append(diffs, fmt.Sprintf("suite: roster has a key of type %T, server uses %s",
+				si.Public, c.suite))
+		} else if !samePublic {
+			diffs = append(diffs, fmt.Sprintf("public key: roster has %s, server has %s",
+				si.Public, own.Public))
+		}
+		if si.Address != own.Address {
+			diffs = append(diffs, fmt.Sprintf("address: roster has %s, server has %s",
+				si.Address, own.Address))
+		}
+		if len(diffs) > 0 {
+			return &RosterMismatchError{Index: i, Diffs: diffs}
+		}
+	}
+	return nil
+}
+
+// checkOwnEntry is used by the overlay to warn about received rosters with
+// a wrong entry of this server.
+func (o *Overlay) checkOwnEntry(from *network.ServerIdentity, ro *Roster) {
+	if err := o.server.CheckRoster(ro); err != nil {
+		log.Warn("Roster", ro.ID, "from", from, "lists this server wrongly:", err)
+		o.server.RecordEvent(EventRosterMismatch, "roster ", ro.ID, ": ", err)
+	}
+}
+
+// SetRosterThreshold sets how many members of a Roster must have signed it
+// before this overlay accepts it from another node or in RegisterRoster.
+// Only the signatures of this server and of the members of the rosters
+// given to TrustRoster count, each public key once: a client could
+// otherwise add new keys to a Roster and sign it with them. A threshold
+// smaller than the size of the Roster doesn't prevent that on its own. A
+// threshold bigger than the number of distinct keys of the Roster requires
+// all of them to sign, so a Roster with untrusted members is refused. The
+// default of 0 accepts unsigned rosters.
+func (o *Overlay) SetRosterThreshold(threshold int) {
+	o.entityListLock.Lock()
+	defer o.entityListLock.Unlock()
+	o.rosterThreshold = threshold
+}
+
+// TrustRoster adds the members of ro, usually the group of the servers, to
+// the keys whose signatures count for SetRosterThreshold.
+func (o *Overlay) TrustRoster(ro *Roster) {
+	o.entityListLock.Lock()
+	defer o.entityListLock.Unlock()
+	if o.trustedKeys == nil {
+		o.trustedKeys = make(map[string]bool)
+	}
+	for _, si := range ro.List {
+		if si.Public != nil {
+			o.trustedKeys[si.Public.String()] = true
+		}
+	}
+}
+
+// trusts returns whether the signature of public counts for the threshold.
+// It must be called with entityListLock held.
+func (o *Overlay) trusts(public kyber.Point) bool {
+	return public.Equal(o.server.ServerIdentity.GetPublic()) ||
+		o.trustedKeys[public.String()]
+}
+
+// SetRosterThreshold sets how many members of a Roster must have signed it
+// before this server accepts it, see Overlay.SetRosterThreshold.
+func (c *Server) SetRosterThreshold(threshold int) {
+	c.overlay.SetRosterThreshold(threshold)
+	c.Audit(AuditConfigChange, auditLocal, fmt.Sprintf("roster threshold %d", threshold))
+}
+
+// TrustRoster adds the members of ro to the keys whose signatures count
+// for the roster threshold, see Overlay.TrustRoster.
+func (c *Server) TrustRoster(ro *Roster) {
+	c.overlay.TrustRoster(ro)
+	c.Audit(AuditConfigChange, auditLocal, fmt.Sprintf("trusted roster of %d members", len(ro.List)))
+}
+
+// VerifyRoster returns an error if the Roster has not been signed by
+// enough trusted members, as set by SetRosterThreshold.
+func (o *Overlay) VerifyRoster(ro *Roster) error {
+	o.entityListLock.Lock()
+	threshold := o.rosterThreshold
+	o.entityListLock.Unlock()
+	if threshold <= 0 {
+		return nil
+	}
+	keys := make(map[string]bool)
+	for _, si := range ro.List {
+		if si.Public != nil {
+			keys[si.Public.String()] = true
+		}
+	}
+	if threshold > len(keys) {
+		threshold = len(keys)
+	}
+	signers, err := ro.Signers(o.suite())
+	if err != nil {
+		return err
+	}
+	o.entityListLock.Lock()
+	n := 0
+	for _, public := range signers {
+		if o.trusts(public) {
+			n++
+		}
+	}
+	o.entityListLock.Unlock()
+	if n < threshold || n == 0 {
+		return fmt.Errorf("roster %s has %d trusted signatures, need %d",
+			ro.ID, n, threshold)
+	}
+	return nil
+}
+
+// SignRoster adds the signature of this server to the Roster. If the Roster
+// still holds a key of this server that has been rotated and is in its grace
+// period, that key is used.
+func (c *Server) SignRoster(ro *Roster) error {
+	for _, si := range ro.List {
+		if si.Public == nil || si.Public.Equal(c.ServerIdentity.GetPublic()) {
+			continue
+		}
+		if private := c.retiredPrivate(si.Public); private != nil {
+			return ro.Sign(c.suite, private)
+		}
+	}
+	return ro.Sign(c.suite, c.privateKey())
+}
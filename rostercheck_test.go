@@ -0,0 +1,46 @@
+package onet
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dedis/kyber/util/key"
+	"github.com/dedis/onet/network"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_CheckRoster(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	servers, ro, _ := local.GenTree(3, false)
+	require.Nil(t, servers[1].CheckRoster(ro))
+
+	// another public key for the address of servers[1]
+	wrong := *ro
+	wrong.List = append([]*network.ServerIdentity{}, ro.List...)
+	kp := key.NewKeyPair(tSuite)
+	wrong.List[1] = network.NewServerIdentity(kp.Public, ro.List[1].Address)
+	err := servers[1].CheckRoster(&wrong)
+	require.NotNil(t, err)
+	mismatch, ok := err.(*RosterMismatchError)
+	require.True(t, ok)
+	require.Equal(t, 1, mismatch.Index)
+	require.Equal(t, 1, len(mismatch.Diffs))
+	require.True(t, strings.HasPrefix(mismatch.Diffs[0], "public key:"))
+
+	// another address for the public key of servers[1]
+	addr := network.NewAddress(network.TLS, "127.0.0.1:1")
+	wrong.List[1] = network.NewServerIdentity(ro.List[1].Public, addr)
+	err = servers[1].CheckRoster(&wrong)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "address: roster has tls://127.0.0.1:1")
+	require.Nil(t, servers[0].CheckRoster(&wrong))
+
+	// a key of another suite
+	mock := network.NewMockSuite()
+	wrong.List[1] = network.NewServerIdentity(mock.Point().Pick(mock.RandomStream()),
+		ro.List[1].Address)
+	err = servers[1].CheckRoster(&wrong)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "suite: roster has a key of type")
+}
@@ -0,0 +1,111 @@
+package onet
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/dedis/kyber"
+	"github.com/dedis/kyber/sign/schnorr"
+	"github.com/dedis/onet/network"
+)
+
+// RosterSignature is the schnorr signature of one member of a Roster on the
+// hash of that Roster.
+type RosterSignature struct {
+	// Index of the signer in Roster.List
+	Index     int
+	Signature []byte
+}
+
+// Hash returns the hash of the ID and the members of the Roster, which is
+// the message signed by the members. Signatures are not included.
+func (ro *Roster) Hash() ([]byte, error) {
+	h := sha256.New()
+	h.Write(ro.ID[:])
+	for _, si := range ro.List {
+		if si.Public == nil {
+			return nil, errors.New("member without public key")
+		}
+		buf, err := si.Public.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		h.Write(buf)
+		h.Write([]byte(si.Address))
+	}
+	return h.Sum(nil), nil
+}
+
+// Sign adds the signature of the member with the given private key to the
+// Roster. A previous signature of the same member is replaced.
+func (ro *Roster) Sign(suite network.Suite, private kyber.Scalar) error {
+	public := suite.Point().Mul(private, nil)
+	index := -1
+	for i, si := range ro.List {
+		if si.Public != nil && si.Public.Equal(public) {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return errors.New("signer is not a member of the roster")
+	}
+	msg, err := ro.Hash()
+	if err != nil {
+		return err
+	}
+	sig, err := schnorr.Sign(suite, private, msg)
+	if err != nil {
+		return err
+	}
+	for i := range ro.Signatures {
+		if ro.Signatures[i].Index == index {
+			ro.Signatures[i].Signature = sig
+			return nil
+		}
+	}
+	ro.Signatures = append(ro.Signatures, RosterSignature{index, sig})
+	return nil
+}
+
+// VerifySignatures checks all signatures of the Roster and returns the
+// number of distinct public keys that signed it. Any invalid signature is
+// an error, as it means that the Roster has been tampered with. Anybody can
+// create a Roster with new keys and sign it with them, so the number alone
+// doesn't tell whether the Roster can be trusted, see
+// Overlay.SetRosterThreshold.
+func (ro *Roster) VerifySignatures(suite network.Suite) (int, error) {
+	signers, err := ro.Signers(suite)
+	return len(signers), err
+}
+
+// Signers checks all signatures of the Roster, like VerifySignatures, and
+// returns the distinct public keys that signed it.
+func (ro *Roster) Signers(suite network.Suite) ([]kyber.Point, error) {
+	if len(ro.Signatures) == 0 {
+		return nil, nil
+	}
+	msg, err := ro.Hash()
+	if err != nil {
+		return nil, err
+	}
+	var signers []kyber.Point
+	seen := make(map[string]bool)
+	for _, rs := range ro.Signatures {
+		if rs.Index < 0 || rs.Index >= len(ro.List) {
+			return nil, fmt.Errorf("signature index %d out of range", rs.Index)
+		}
+		public := ro.List[rs.Index].Public
+		err := schnorr.Verify(suite, public, msg, rs.Signature)
+		if err != nil {
+			return nil, fmt.Errorf("invalid signature of %s: %s",
+				ro.List[rs.Index], err)
+		}
+		if !seen[public.String()] {
+			seen[public.String()] = true
+			signers = append(signers, public)
+		}
+	}
+	return signers, nil
+}
@@ -0,0 +1,105 @@
+package onet
+
+import (
+	"testing"
+
+	"github.com/dedis/onet/network"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoster_Sign(t *testing.T) {
+	l := NewLocalTest(tSuite)
+	defer l.CloseAll()
+	servers, ro, _ := l.GenTree(3, false)
+
+	n, err := ro.VerifySignatures(tSuite)
+	require.Nil(t, err)
+	require.Equal(t, 0, n)
+
+	require.Nil(t, servers[0].SignRoster(ro))
+	require.Nil(t, servers[1].SignRoster(ro))
+	// Signing twice must not count twice
+	require.Nil(t, servers[1].SignRoster(ro))
+	n, err = ro.VerifySignatures(tSuite)
+	require.Nil(t, err)
+	require.Equal(t, 2, n)
+
+	outsider := l.GenServers(1)[0]
+	require.NotNil(t, outsider.SignRoster(ro))
+
+	// A key listed twice counts once, even with a signature per index
+	dup := NewRoster([]*network.ServerIdentity{servers[0].ServerIdentity,
+		servers[0].ServerIdentity, servers[1].ServerIdentity})
+	require.Nil(t, servers[0].SignRoster(dup))
+	dup.Signatures = append(dup.Signatures,
+		RosterSignature{1, dup.Signatures[0].Signature})
+	n, err = dup.VerifySignatures(tSuite)
+	require.Nil(t, err)
+	require.Equal(t, 1, n)
+
+	// Changing the roster invalidates the signatures
+	ro.List[0], ro.List[2] = ro.List[2], ro.List[0]
+	_, err = ro.VerifySignatures(tSuite)
+	require.NotNil(t, err)
+}
+
+func TestOverlay_VerifyRoster(t *testing.T) {
+	l := NewLocalTest(tSuite)
+	defer l.CloseAll()
+	servers, ro, _ := l.GenTree(3, false)
+	o := servers[1].overlay
+
+	require.Nil(t, o.VerifyRoster(ro))
+	o.SetRosterThreshold(2)
+	o.TrustRoster(ro)
+	require.NotNil(t, o.VerifyRoster(ro))
+	o.handleSendRoster(servers[0].ServerIdentity, ro)
+	require.Nil(t, o.Roster(ro.ID))
+	require.NotNil(t, o.RegisterRoster(ro))
+	require.Nil(t, o.Roster(ro.ID))
+
+	require.Nil(t, servers[0].SignRoster(ro))
+	require.NotNil(t, o.VerifyRoster(ro))
+	require.Nil(t, servers[2].SignRoster(ro))
+	require.Nil(t, o.VerifyRoster(ro))
+	o.handleSendRoster(servers[0].ServerIdentity, ro)
+	require.NotNil(t, o.Roster(ro.ID))
+
+	// A threshold bigger than the roster needs all members
+	o.SetRosterThreshold(10)
+	require.NotNil(t, o.VerifyRoster(ro))
+	require.Nil(t, servers[1].SignRoster(ro))
+	require.Nil(t, o.VerifyRoster(ro))
+}
+
+func TestOverlay_VerifyRosterUntrusted(t *testing.T) {
+	l := NewLocalTest(tSuite)
+	defer l.CloseAll()
+	servers, group, _ := l.GenTree(2, false)
+	o := servers[0].overlay
+	o.SetRosterThreshold(2)
+	o.TrustRoster(group)
+
+	// Fresh keys signing their own roster are not enough, whatever the
+	// size of the roster.
+	outsiders := l.GenServers(3)
+	ro := NewRoster([]*network.ServerIdentity{servers[0].ServerIdentity,
+		outsiders[0].ServerIdentity, outsiders[1].ServerIdentity,
+		outsiders[2].ServerIdentity})
+	for _, s := range outsiders {
+		require.Nil(t, s.SignRoster(ro))
+	}
+	n, err := ro.VerifySignatures(tSuite)
+	require.Nil(t, err)
+	require.Equal(t, 3, n)
+	require.NotNil(t, o.VerifyRoster(ro))
+
+	// This server's own signature counts, as do those of the group.
+	require.Nil(t, servers[0].SignRoster(ro))
+	require.NotNil(t, o.VerifyRoster(ro))
+	ro.List = append(ro.List, servers[1].ServerIdentity)
+	ro.Signatures = nil
+	require.Nil(t, servers[0].SignRoster(ro))
+	require.Nil(t, servers[1].SignRoster(ro))
+	require.Nil(t, o.VerifyRoster(ro))
+}
@@ -0,0 +1,205 @@
+// +build !js
+
+package onet
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+)
+
+// ErrRPCTimeout is returned by SendRequest if the reply doesn't arrive in
+// time.
+var ErrRPCTimeout = errors.New("timeout waiting for the reply")
+
+// RPCHandler answers a request of the server si, sent with SendRequest. The
+// returned message is sent back to si, or the error if it is not nil.
+type RPCHandler func(si *network.ServerIdentity, req network.Message) (network.Message, error)
+
+// rpcRequest carries a request for the handler of Service, or for the
+// handlers of the overlay if it is empty.
+type rpcRequest struct {
+	Nonce   uint64
+	Service string
+	Msg     []byte
+}
+
+// rpcReply carries the reply to a request, or the error of the handler.
+type rpcReply struct {
+	Nonce uint64
+	Msg   []byte
+	Error string
+}
+
+var rpcRequestID = network.RegisterMessage(rpcRequest{})
+var rpcReplyID = network.RegisterMessage(rpcReply{})
+
+// rpcs holds the handlers of the requests and the requests waiting for
+// their replies.
+type rpcs struct {
+	// handlers by service and message type
+	handlers map[string]map[network.MessageTypeID]RPCHandler
+	replies  map[uint64]chan *network.Envelope
+	sync.Mutex
+}
+
+func newRPCs() *rpcs {
+	return &rpcs{
+		handlers: make(map[string]map[network.MessageTypeID]RPCHandler),
+		replies:  make(map[uint64]chan *network.Envelope),
+	}
+}
+
+// handler returns the handler of the request, or nil.
+func (r *rpcs) handler(service string, msgType network.MessageTypeID) RPCHandler {
+	r.Lock()
+	defer r.Unlock()
+	return r.handlers[service][msgType]
+}
+
+func (r *rpcs) register(service string, msgType network.MessageTypeID, fn RPCHandler) {
+	r.Lock()
+	defer r.Unlock()
+	if r.handlers[service] == nil {
+		r.handlers[service] = make(map[network.MessageTypeID]RPCHandler)
+	}
+	r.handlers[service][msgType] = fn
+}
+
+// RegisterRPC makes fn answer the requests of type msgType sent with
+// Overlay.SendRequest. A second handler for the same type replaces the
+// first.
+func (o *Overlay) RegisterRPC(msgType network.MessageTypeID, fn RPCHandler) {
+	o.rpcs.register("", msgType, fn)
+}
+
+// SendRequest sends req to si and returns the reply of the handler
+// registered there with Overlay.RegisterRPC. It doesn't need a tree or a
+// protocol instance, and returns ErrRPCTimeout if the reply doesn't arrive
+// within timeout.
+func (o *Overlay) SendRequest(si *network.ServerIdentity, req network.Message,
+	timeout time.Duration) (network.Message, error) {
+	return o.sendRequest("", si, req, timeout)
+}
+
+// RegisterRPC makes fn answer the requests of type msgType sent by this
+// service on other servers with Context.SendRequest.
+func (c *Context) RegisterRPC(msgType network.MessageTypeID, fn RPCHandler) {
+	c.overlay.rpcs.register(c.name, msgType, fn)
+}
+
+// SendRequest sends req to the same service on si and returns the reply of
+// its handler registered with Context.RegisterRPC, or ErrRPCTimeout if the
+// reply doesn't arrive within timeout.
+func (c *Context) SendRequest(si *network.ServerIdentity, req network.Message,
+	timeout time.Duration) (network.Message, error) {
+	return c.overlay.sendRequest(c.name, si, req, timeout)
+}
+
+// sendRequest sends the request for the handler of service and waits for
+// the reply. A request to this server calls the handler directly.
+func (o *Overlay) sendRequest(service string, si *network.ServerIdentity,
+	req network.Message, timeout time.Duration) (network.Message, error) {
+	buf, err := network.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	if si.ID.Equal(o.server.ServerIdentity.ID) {
+		reply := o.answerRPC(si, &rpcRequest{Service: service, Msg: buf})
+		return o.rpcResult(reply)
+	}
+
+	nonce := uint64(rand.Int63())
+	replies := make(chan *network.Envelope, 1)
+	o.rpcs.Lock()
+	o.rpcs.replies[nonce] = replies
+	o.rpcs.Unlock()
+	defer func() {
+		o.rpcs.Lock()
+		delete(o.rpcs.replies, nonce)
+		o.rpcs.Unlock()
+	}()
+
+	if _, err := o.server.Send(si, &rpcRequest{Nonce: nonce, Service: service,
+		Msg: buf}); err != nil {
+		return nil, err
+	}
+	timer := o.Clock().After(timeout)
+	for {
+		select {
+		case env := <-replies:
+			// Only the server that was asked can answer
+			if !env.ServerIdentity.ID.Equal(si.ID) {
+				continue
+			}
+			return o.rpcResult(env.Msg.(*rpcReply))
+		case <-timer:
+			return nil, ErrRPCTimeout
+		}
+	}
+}
+
+// rpcResult returns the message or the error of the reply.
+func (o *Overlay) rpcResult(reply *rpcReply) (network.Message, error) {
+	if reply.Error != "" {
+		return nil, errors.New(reply.Error)
+	}
+	_, msg, err := network.Unmarshal(reply.Msg, o.server.suite)
+	return msg, err
+}
+
+// answerRPC calls the handler of the request of si and returns its reply.
+func (o *Overlay) answerRPC(si *network.ServerIdentity, req *rpcRequest) *rpcReply {
+	reply := &rpcReply{Nonce: req.Nonce}
+	typ, msg, err := network.Unmarshal(req.Msg, o.server.suite)
+	if err != nil {
+		reply.Error = "invalid request: " + err.Error()
+		return reply
+	}
+	fn := o.rpcs.handler(req.Service, typ)
+	if fn == nil {
+		reply.Error = "no handler for the request"
+		return reply
+	}
+	ret, err := fn(si, msg)
+	if err != nil {
+		reply.Error = err.Error()
+		return reply
+	}
+	if reply.Msg, err = network.Marshal(ret); err != nil {
+		reply.Error = "invalid reply: " + err.Error()
+	}
+	return reply
+}
+
+// registerRPCs lets the server answer the requests of others and pass on
+// the replies to the waiting requests.
+func (o *Overlay) registerRPCs() {
+	o.server.RegisterProcessorFunc(rpcRequestID, func(env *network.Envelope) {
+		req := env.Msg.(*rpcRequest)
+		// A handler might send requests itself, it must not block the
+		// receiving goroutine of the connection.
+		go func() {
+			reply := o.answerRPC(env.ServerIdentity, req)
+			if _, err := o.server.Send(env.ServerIdentity, reply); err != nil {
+				log.Lvl2(o.server.Address(), "couldn't send reply:", err)
+			}
+		}()
+	})
+	o.server.RegisterProcessorFunc(rpcReplyID, func(env *network.Envelope) {
+		reply := env.Msg.(*rpcReply)
+		o.rpcs.Lock()
+		ch := o.rpcs.replies[reply.Nonce]
+		o.rpcs.Unlock()
+		if ch != nil {
+			select {
+			case ch <- env:
+			default:
+			}
+		}
+	})
+}
@@ -0,0 +1,80 @@
+package onet
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dedis/onet/network"
+	"github.com/stretchr/testify/require"
+)
+
+type rpcTestRequest struct {
+	I int
+}
+
+type rpcTestReply struct {
+	I int
+}
+
+var rpcTestRequestID = network.RegisterMessage(rpcTestRequest{})
+var rpcTestReplyID = network.RegisterMessage(rpcTestReply{})
+
+func TestOverlay_SendRequest(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	servers := local.GenServers(2)
+	o0, o1 := servers[0].overlay, servers[1].overlay
+
+	slow := make(chan bool)
+	o1.RegisterRPC(rpcTestRequestID, func(si *network.ServerIdentity, req network.Message) (network.Message, error) {
+		require.True(t, si.ID.Equal(servers[0].ServerIdentity.ID))
+		i := req.(*rpcTestRequest).I
+		switch i {
+		case 0:
+			return nil, errors.New("zero")
+		case -1:
+			<-slow
+		}
+		return &rpcTestReply{I: 2 * i}, nil
+	})
+
+	reply, err := o0.SendRequest(servers[1].ServerIdentity, &rpcTestRequest{I: 21}, time.Second)
+	require.Nil(t, err)
+	require.Equal(t, 42, reply.(*rpcTestReply).I)
+
+	_, err = o0.SendRequest(servers[1].ServerIdentity, &rpcTestRequest{I: 0}, time.Second)
+	require.NotNil(t, err)
+	require.Equal(t, "zero", err.Error())
+
+	// No handler for this type
+	_, err = o0.SendRequest(servers[1].ServerIdentity, &rpcTestReply{I: 1}, time.Second)
+	require.NotNil(t, err)
+
+	_, err = o0.SendRequest(servers[1].ServerIdentity, &rpcTestRequest{I: -1}, 100*time.Millisecond)
+	require.Equal(t, ErrRPCTimeout, err)
+	close(slow)
+
+	// A request to itself doesn't go through the network
+	_, err = o1.SendRequest(servers[1].ServerIdentity, &rpcTestRequest{I: 0}, time.Second)
+	require.NotNil(t, err)
+}
+
+func TestContext_SendRequest(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	servers := local.GenServers(2)
+	c0 := servers[0].Service(tenantServiceName).(*tenantService).c
+	c1 := servers[1].Service(tenantServiceName).(*tenantService).c
+	c1.RegisterRPC(rpcTestRequestID, func(si *network.ServerIdentity, req network.Message) (network.Message, error) {
+		return &rpcTestReply{I: req.(*rpcTestRequest).I + 1}, nil
+	})
+
+	reply, err := c0.SendRequest(servers[1].ServerIdentity, &rpcTestRequest{I: 1}, time.Second)
+	require.Nil(t, err)
+	require.Equal(t, 2, reply.(*rpcTestReply).I)
+
+	// The handlers of a service don't answer the requests of the overlay
+	_, err = servers[0].overlay.SendRequest(servers[1].ServerIdentity, &rpcTestRequest{I: 1}, time.Second)
+	require.NotNil(t, err)
+}
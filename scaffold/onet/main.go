@@ -0,0 +1,79 @@
+// The onet command generates new services and protocols:
+//
+//   onet [-dir <dir>] [-import <path>] new service <name>
+//   onet [-dir <dir>] [-import <path>] new protocol <name>
+//
+// The code is written to dir, by default the lower-case name in the current
+// directory. The import path is guessed from GOPATH if it is not given.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"go/build"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/scaffold"
+)
+
+var dir, importPath string
+
+func init() {
+	flag.StringVar(&dir, "dir", "", "directory of the generated code")
+	flag.StringVar(&importPath, "import", "", "import path of the generated code")
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: onet [flags] new service|protocol <name>")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	args := flag.Args()
+	if len(args) != 3 || args[0] != "new" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	kind, name := args[1], args[2]
+	if dir == "" {
+		dir = strings.ToLower(name)
+	}
+	if importPath == "" {
+		var err error
+		if importPath, err = guessImportPath(dir); err != nil {
+			log.Fatal(err, "- please give it with -import")
+		}
+	}
+	s, err := scaffold.New(name, importPath)
+	log.ErrFatal(err)
+	switch kind {
+	case "service":
+		err = s.Service(dir)
+	case "protocol":
+		err = s.Protocol(dir)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	log.ErrFatal(err)
+	log.Info("Created", kind, s.Name, "in", dir)
+}
+
+// guessImportPath returns the import path of dir if it is in the GOPATH.
+func guessImportPath(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for _, p := range filepath.SplitList(build.Default.GOPATH) {
+		src := filepath.Join(p, "src") + string(filepath.Separator)
+		if strings.HasPrefix(abs, src) {
+			return filepath.ToSlash(strings.TrimPrefix(abs, src)), nil
+		}
+	}
+	return "", errors.New(dir + " is not in the GOPATH")
+}
@@ -0,0 +1,99 @@
+// Package scaffold generates the skeleton of a new service or protocol, so
+// that new projects start with the same layout and the current APIs of onet.
+//
+// A service gets its messages, a client, a counting protocol, the tests of
+// both and a simulation. A protocol only gets the protocol and its test.
+// The command in scaffold/onet calls it as
+//
+//   onet new service <name>
+//   onet new protocol <name>
+package scaffold
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// Scaffold holds the names used in the generated code.
+type Scaffold struct {
+	// Name is the name of the service or protocol, as registered to onet.
+	Name string
+	// Package is the name of the generated Go package.
+	Package string
+	// ImportPath is the import path of the generated package, used by the
+	// simulation.
+	ImportPath string
+}
+
+var validName = regexp.MustCompile("^[a-zA-Z][a-zA-Z0-9]*$")
+
+// New returns a Scaffold for the given name. The package is the name in
+// lower case.
+func New(name, importPath string) (*Scaffold, error) {
+	if !validName.MatchString(name) {
+		return nil, fmt.Errorf("invalid name %q: must be letters and digits, starting with a letter", name)
+	}
+	if importPath == "" {
+		return nil, errors.New("missing import path")
+	}
+	return &Scaffold{
+		Name:       strings.ToUpper(name[:1]) + name[1:],
+		Package:    strings.ToLower(name),
+		ImportPath: importPath,
+	}, nil
+}
+
+// Service writes a new service to dir, which must not exist or be empty.
+func (s *Scaffold) Service(dir string) error {
+	return s.write(dir, serviceFiles)
+}
+
+// Protocol writes a new protocol to dir, which must not exist or be empty.
+func (s *Scaffold) Protocol(dir string) error {
+	return s.write(dir, protocolFiles)
+}
+
+// write executes the templates and writes the files. It doesn't write
+// anything if a template fails.
+func (s *Scaffold) write(dir string, files map[string]string) error {
+	if entries, err := ioutil.ReadDir(dir); err == nil && len(entries) > 0 {
+		return fmt.Errorf("%s is not empty", dir)
+	}
+	out := make(map[string][]byte)
+	for name, tmpl := range files {
+		name = strings.Replace(name, "NAME", s.Package, -1)
+		t, err := template.New(name).Parse(tmpl)
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, s); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		src := buf.Bytes()
+		if filepath.Ext(name) == ".go" {
+			if src, err = format.Source(src); err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+		}
+		out[name] = src
+	}
+	for name, src := range out {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(path, src, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
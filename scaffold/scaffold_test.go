@@ -0,0 +1,73 @@
+package scaffold
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dedis/onet/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	log.MainTest(m)
+}
+
+func TestNew(t *testing.T) {
+	s, err := New("myCounter", "example.com/mycounter")
+	require.Nil(t, err)
+	require.Equal(t, "MyCounter", s.Name)
+	require.Equal(t, "mycounter", s.Package)
+
+	for _, name := range []string{"", "1st", "my-counter", "a b"} {
+		_, err = New(name, "example.com/x")
+		require.NotNil(t, err, name)
+	}
+	_, err = New("counter", "")
+	require.NotNil(t, err)
+}
+
+func TestScaffold_Service(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scaffold")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	s, err := New("counter", "example.com/counter")
+	require.Nil(t, err)
+	require.Nil(t, s.Service(dir))
+	for name := range serviceFiles {
+		name = strings.Replace(name, "NAME", s.Package, -1)
+		buf, err := ioutil.ReadFile(filepath.Join(dir, name))
+		require.Nil(t, err, name)
+		require.NotContains(t, string(buf), "{{", name)
+	}
+	sim, err := ioutil.ReadFile(filepath.Join(dir, "simulation", "simul.go"))
+	require.Nil(t, err)
+	require.Contains(t, string(sim), `"example.com/counter"`)
+	toml, err := ioutil.ReadFile(filepath.Join(dir, "simulation", "counter.toml"))
+	require.Nil(t, err)
+	require.Contains(t, string(toml), `Simulation = "Counter"`)
+
+	// doesn't overwrite
+	require.NotNil(t, s.Service(dir))
+	require.NotNil(t, s.Protocol(dir))
+}
+
+func TestScaffold_Protocol(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scaffold")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	s, err := New("Echo", "example.com/echo")
+	require.Nil(t, err)
+	require.Nil(t, s.Protocol(filepath.Join(dir, "echo")))
+	files, err := ioutil.ReadDir(filepath.Join(dir, "echo"))
+	require.Nil(t, err)
+	require.Equal(t, len(protocolFiles), len(files))
+	buf, err := ioutil.ReadFile(filepath.Join(dir, "echo", "protocol.go"))
+	require.Nil(t, err)
+	require.Contains(t, string(buf), "package echo\n")
+	require.Contains(t, string(buf), `"EchoProtocol"`)
+}
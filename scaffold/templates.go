@@ -0,0 +1,403 @@
+package scaffold
+
+// The templates are executed with a *Scaffold. NAME in the file names is
+// replaced by the package name.
+
+var protocolFiles = map[string]string{
+	"protocol.go":      protocolTemplate,
+	"protocol_test.go": protocolTestTemplate,
+}
+
+var serviceFiles = map[string]string{
+	"protocol.go":                 protocolTemplate,
+	"protocol_test.go":            protocolTestTemplate,
+	"struct.go":                   structTemplate,
+	"service.go":                  serviceTemplate,
+	"service_test.go":             serviceTestTemplate,
+	"api.go":                      apiTemplate,
+	"simulation/simul.go":         simulationTemplate,
+	"simulation/NAME.toml":        simulationTomlTemplate,
+	"simulation/simul_test.go":    simulationTestTemplate,
+	"simulation/local_simul.toml": simulationLocalTomlTemplate,
+}
+
+const protocolTemplate = `package {{.Package}}
+
+import (
+	"sync"
+
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/network"
+)
+
+// ProtocolName is the name under which the protocol is registered.
+const ProtocolName = "{{.Name}}Protocol"
+
+func init() {
+	network.RegisterMessages(Announce{}, Reply{})
+	onet.GlobalProtocolRegister(ProtocolName, NewProtocol)
+}
+
+// Announce is sent from the root down the tree.
+type Announce struct {
+	Message string
+}
+
+// Reply is sent up the tree with the number of nodes of the subtree.
+type Reply struct {
+	Nodes int
+}
+
+// Protocol counts the nodes of the tree: the announcement goes down to the
+// leaves, and every node replies with the size of its subtree.
+type Protocol struct {
+	*onet.TreeNodeInstance
+	// Count gets the number of nodes on the root.
+	Count chan int
+
+	replies  int
+	children int
+	sync.Mutex
+}
+
+// NewProtocol returns a new Protocol.
+func NewProtocol(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+	p := &Protocol{
+		TreeNodeInstance: n,
+		Count:            make(chan int, 1),
+	}
+	err := p.RegisterHandlers(p.handleAnnounce, p.handleReply)
+	return p, err
+}
+
+// Start sends the announcement to the children of the root.
+func (p *Protocol) Start() error {
+	return p.handleAnnounce(struct {
+		*onet.TreeNode
+		Announce
+	}{p.TreeNode(), Announce{"count"}})
+}
+
+func (p *Protocol) handleAnnounce(msg struct {
+	*onet.TreeNode
+	Announce
+}) error {
+	if p.IsLeaf() {
+		return p.finish(1)
+	}
+	return p.SendToChildren(&msg.Announce)
+}
+
+func (p *Protocol) handleReply(msg struct {
+	*onet.TreeNode
+	Reply
+}) error {
+	p.Lock()
+	p.replies++
+	p.children += msg.Nodes
+	done := p.replies == len(p.Children())
+	count := p.children + 1
+	p.Unlock()
+	if !done {
+		return nil
+	}
+	return p.finish(count)
+}
+
+// finish sends the count to the parent, or to Count on the root.
+func (p *Protocol) finish(count int) error {
+	defer p.Done()
+	if p.IsRoot() {
+		p.Count <- count
+		return nil
+	}
+	return p.SendToParent(&Reply{count})
+}
+`
+
+const protocolTestTemplate = `package {{.Package}}
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dedis/kyber/suites"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/log"
+	"github.com/stretchr/testify/require"
+)
+
+var tSuite = suites.MustFind("Ed25519")
+
+func TestMain(m *testing.M) {
+	log.MainTest(m)
+}
+
+func TestProtocol(t *testing.T) {
+	for _, n := range []int{1, 2, 5, 13} {
+		local := onet.NewLocalTest(tSuite)
+		_, _, tree := local.GenBigTree(n, n, 2, true)
+		pi, err := local.StartProtocol(ProtocolName, tree)
+		require.Nil(t, err)
+		select {
+		case count := <-pi.(*Protocol).Count:
+			require.Equal(t, n, count)
+		case <-time.After(10 * time.Second):
+			t.Fatal("protocol didn't finish")
+		}
+		local.CloseAll()
+	}
+}
+`
+
+const structTemplate = `package {{.Package}}
+
+import (
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/network"
+)
+
+func init() {
+	network.RegisterMessages(&CountRequest{}, &CountReply{})
+}
+
+// CountRequest asks the service to count the nodes of the roster.
+type CountRequest struct {
+	Roster *onet.Roster
+}
+
+// CountReply is the number of nodes that replied.
+type CountReply struct {
+	Nodes int
+}
+`
+
+const serviceTemplate = `package {{.Package}}
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/log"
+)
+
+// ServiceName is the name under which the service is registered.
+const ServiceName = "{{.Name}}"
+
+// Timeout is how long the service waits for the protocol.
+var Timeout = 10 * time.Second
+
+var serviceID onet.ServiceID
+
+func init() {
+	var err error
+	serviceID, err = onet.RegisterNewService(ServiceName, newService)
+	log.ErrFatal(err)
+}
+
+// Service runs the protocol for the clients.
+type Service struct {
+	*onet.ServiceProcessor
+}
+
+// Count runs the protocol over the roster, with this server as root, and
+// returns the number of nodes.
+func (s *Service) Count(ctx context.Context, req *CountRequest) (*CountReply, error) {
+	if req.Roster == nil || len(req.Roster.List) == 0 {
+		return nil, errors.New("empty roster")
+	}
+	tree := req.Roster.GenerateNaryTreeWithRoot(2, s.ServerIdentity())
+	if tree == nil {
+		return nil, errors.New("this server is not in the roster")
+	}
+	pi, err := s.CreateProtocol(ProtocolName, tree)
+	if err != nil {
+		return nil, err
+	}
+	pi.(*Protocol).SetTraceContext(ctx)
+	if err := pi.Start(); err != nil {
+		return nil, err
+	}
+	select {
+	case count := <-pi.(*Protocol).Count:
+		return &CountReply{Nodes: count}, nil
+	case <-time.After(Timeout):
+		return nil, errors.New("timeout while counting")
+	}
+}
+
+func newService(c *onet.Context) (onet.Service, error) {
+	s := &Service{
+		ServiceProcessor: onet.NewServiceProcessor(c),
+	}
+	if err := s.RegisterHandlers(s.Count); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+`
+
+const serviceTestTemplate = `package {{.Package}}
+
+import (
+	"testing"
+
+	"github.com/dedis/onet"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_Count(t *testing.T) {
+	local := onet.NewTCPTest(tSuite)
+	defer local.CloseAll()
+	_, ro, _ := local.GenTree(5, true)
+
+	c := NewClient(tSuite)
+	count, err := c.Count(ro)
+	require.Nil(t, err)
+	require.Equal(t, 5, count)
+
+	_, err = c.Count(&onet.Roster{})
+	require.NotNil(t, err)
+}
+`
+
+const apiTemplate = `package {{.Package}}
+
+import (
+	"errors"
+
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/network"
+)
+
+// Client sends the requests of the service.
+type Client struct {
+	*onet.Client
+}
+
+// NewClient returns a Client using the given suite.
+func NewClient(suite network.Suite) *Client {
+	return &Client{Client: onet.NewClient(suite, ServiceName)}
+}
+
+// Count asks the first server of the roster to count the nodes.
+func (c *Client) Count(ro *onet.Roster) (int, error) {
+	if len(ro.List) == 0 {
+		return 0, errors.New("empty roster")
+	}
+	reply := &CountReply{}
+	if err := c.SendProtobuf(ro.List[0], &CountRequest{Roster: ro}, reply); err != nil {
+		return 0, err
+	}
+	return reply.Nodes, nil
+}
+`
+
+const simulationTemplate = `package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/BurntSushi/toml"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/simul"
+	"github.com/dedis/onet/simul/monitor"
+	"{{.ImportPath}}"
+)
+
+func init() {
+	onet.SimulationRegister("{{.Name}}", NewSimulation)
+}
+
+// Simulation runs the protocol of {{.Package}} on a tree.
+type Simulation struct {
+	onet.SimulationBFTree
+}
+
+// NewSimulation returns the simulation configured by the toml file.
+func NewSimulation(config string) (onet.Simulation, error) {
+	s := &Simulation{}
+	if _, err := toml.Decode(config, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Setup creates the roster and the tree of the simulation.
+func (s *Simulation) Setup(dir string, hosts []string) (*onet.SimulationConfig, error) {
+	sc := &onet.SimulationConfig{}
+	s.CreateRoster(sc, hosts, 2000)
+	if err := s.CreateTree(sc); err != nil {
+		return nil, err
+	}
+	return sc, nil
+}
+
+// Run runs the protocol for every round and measures its time.
+func (s *Simulation) Run(config *onet.SimulationConfig) error {
+	size := config.Tree.Size()
+	log.Lvl2("Size is:", size, "rounds:", s.Rounds)
+	for round := 0; round < s.Rounds; round++ {
+		log.Lvl1("Starting round", round)
+		m := monitor.NewTimeMeasure("round")
+		pi, err := config.Overlay.CreateProtocol({{.Package}}.ProtocolName,
+			config.Tree, onet.NilServiceID)
+		if err != nil {
+			return err
+		}
+		if err := pi.Start(); err != nil {
+			return err
+		}
+		count := <-pi.(*{{.Package}}.Protocol).Count
+		m.Record()
+		if count != size {
+			return errors.New(fmt.Sprint("counted ", count, " instead of ", size))
+		}
+	}
+	return nil
+}
+
+func main() {
+	simul.Start()
+}
+`
+
+const simulationTestTemplate = `package main
+
+import (
+	"testing"
+
+	"github.com/dedis/onet/simul"
+)
+
+func TestSimulation(t *testing.T) {
+	simul.Start("local_simul.toml")
+}
+`
+
+const simulationTomlTemplate = `Simulation = "{{.Name}}"
+Servers = 8
+BF = 2
+Rounds = 5
+Suite = "Ed25519"
+
+Hosts
+3
+7
+15
+31
+`
+
+const simulationLocalTomlTemplate = `Simulation = "{{.Name}}"
+Servers = 1
+BF = 2
+Rounds = 1
+Suite = "Ed25519"
+
+Hosts
+3
+`
@@ -0,0 +1,314 @@
+// +build !js
+
+package onet
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+	"gopkg.in/satori/go.uuid.v1"
+)
+
+// TaskFunc is the work of a task registered with Context.RegisterTask. It
+// gets the data given when the task was scheduled.
+type TaskFunc func(data []byte) error
+
+var taskBucket = []byte("onet_tasks")
+
+// storedTask is a scheduled run of a task in the database, so that it is
+// run after a restart of the server.
+type storedTask struct {
+	Service string
+	Name    string
+	// Next is when the task runs next, in unix nanoseconds
+	Next int64
+	// Spec is the cron specification, empty for a task that runs once
+	Spec string
+	Data []byte
+}
+
+func init() {
+	network.RegisterMessage(&storedTask{})
+}
+
+// scheduler runs the tasks of the services at their time, instead of the
+// services having their own goroutines. It stops all tasks when the server
+// closes.
+type scheduler struct {
+	manager *serviceManager
+	// the registered tasks, by service and name
+	tasks map[string]*taskType
+	// the scheduled runs, by ID
+	pending map[string]*pendingTask
+	running sync.WaitGroup
+	stopped bool
+	sync.Mutex
+}
+
+// taskType is a registered task.
+type taskType struct {
+	fn TaskFunc
+	// slots limits the concurrent runs, nil if there is no limit
+	slots chan struct{}
+}
+
+// pendingTask is a scheduled run of a task.
+type pendingTask struct {
+	storedTask
+	id    string
+	cron  *cronSchedule
+	timer network.Timer
+}
+
+func newScheduler(s *serviceManager) *scheduler {
+	return &scheduler{
+		manager: s,
+		tasks:   make(map[string]*taskType),
+		pending: make(map[string]*pendingTask),
+	}
+}
+
+// RegisterTask makes fn the work of the task name of this service, with at
+// most maxConcurrent runs at the same time, or no limit if it is 0. The runs
+// of the task that were scheduled before the server restarted are
+// scheduled again, the ones that were missed are run at once.
+func (c *Context) RegisterTask(name string, fn TaskFunc, maxConcurrent int) error {
+	return c.manager.scheduler.register(c.name, name, fn, maxConcurrent)
+}
+
+// ScheduleTask runs the task name once at the given time, with data. It
+// returns the ID of the run, for CancelTask.
+func (c *Context) ScheduleTask(name string, at time.Time, data []byte) (string, error) {
+	return c.manager.scheduler.schedule(storedTask{
+		Service: c.name,
+		Name:    name,
+		Next:    at.UnixNano(),
+		Data:    data,
+	})
+}
+
+// ScheduleCron runs the task name at the times of the cron specification
+// spec, with data, until it is cancelled. The specification has the five
+// fields "minute hour day-of-month month day-of-week", or is one of
+// "@every <duration>", "@hourly", "@daily", "@weekly", "@monthly" and
+// "@yearly". It returns the ID of the schedule, for CancelTask.
+func (c *Context) ScheduleCron(name, spec string, data []byte) (string, error) {
+	return c.manager.scheduler.schedule(storedTask{
+		Service: c.name,
+		Name:    name,
+		Spec:    spec,
+		Data:    data,
+	})
+}
+
+// CancelTask stops the scheduled run, or the cron schedule, with the given
+// ID. The runs that already started are not stopped.
+func (c *Context) CancelTask(id string) error {
+	return c.manager.scheduler.cancel(id)
+}
+
+// register adds the task and schedules its stored runs.
+func (sc *scheduler) register(service, name string, fn TaskFunc, maxConcurrent int) error {
+	if fn == nil {
+		return errors.New("no function for task " + name)
+	}
+	tt := &taskType{fn: fn}
+	if maxConcurrent > 0 {
+		tt.slots = make(chan struct{}, maxConcurrent)
+	}
+	sc.Lock()
+	sc.tasks[service+"/"+name] = tt
+	sc.Unlock()
+
+	var stored []*pendingTask
+	err := sc.manager.dbView(func(tx *bolt.Tx) error {
+		b := tx.Bucket(taskBucket)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			_, msg, err := network.Unmarshal(v, sc.manager.server.suite)
+			if err != nil {
+				log.Error("Dropping invalid stored task:", err)
+				return nil
+			}
+			st := msg.(*storedTask)
+			if st.Service == service && st.Name == name {
+				stored = append(stored, &pendingTask{storedTask: *st, id: string(k)})
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	for _, pt := range stored {
+		if pt.Spec != "" {
+			if pt.cron, err = parseCron(pt.Spec); err != nil {
+				return err
+			}
+		}
+		log.Lvl3("Restoring task", service, name)
+		sc.arm(pt)
+	}
+	return nil
+}
+
+// schedule stores the run of st and arms its timer.
+func (sc *scheduler) schedule(st storedTask) (string, error) {
+	sc.Lock()
+	_, ok := sc.tasks[st.Service+"/"+st.Name]
+	sc.Unlock()
+	if !ok {
+		return "", errors.New("unknown task " + st.Name)
+	}
+	pt := &pendingTask{storedTask: st, id: uuid.NewV4().String()}
+	if st.Spec != "" {
+		var err error
+		if pt.cron, err = parseCron(st.Spec); err != nil {
+			return "", err
+		}
+		pt.Next = pt.cron.next(sc.now()).UnixNano()
+	}
+	if err := sc.store(pt); err != nil {
+		return "", err
+	}
+	sc.arm(pt)
+	return pt.id, nil
+}
+
+// cancel stops and forgets the run with the given id.
+func (sc *scheduler) cancel(id string) error {
+	sc.Lock()
+	pt, ok := sc.pending[id]
+	if ok {
+		pt.timer.Stop()
+		delete(sc.pending, id)
+	}
+	sc.Unlock()
+	if !ok {
+		return errors.New("no scheduled task " + id)
+	}
+	return sc.forget(id)
+}
+
+func (sc *scheduler) now() time.Time {
+	return sc.manager.server.Clock().Now()
+}
+
+// arm starts the timer of the run.
+func (sc *scheduler) arm(pt *pendingTask) {
+	sc.Lock()
+	defer sc.Unlock()
+	if sc.stopped {
+		return
+	}
+	d := time.Unix(0, pt.Next).Sub(sc.now())
+	if d < 0 {
+		d = 0
+	}
+	sc.pending[pt.id] = pt
+	pt.timer = sc.manager.server.Clock().AfterFunc(d, func() { sc.run(pt) })
+}
+
+// run calls the task, then schedules the next run of a cron task or
+// forgets a task that runs once.
+func (sc *scheduler) run(pt *pendingTask) {
+	sc.Lock()
+	tt := sc.tasks[pt.Service+"/"+pt.Name]
+	if sc.stopped || sc.pending[pt.id] != pt {
+		sc.Unlock()
+		return
+	}
+	sc.running.Add(1)
+	sc.Unlock()
+	defer sc.running.Done()
+
+	if tt.slots != nil {
+		tt.slots <- struct{}{}
+	}
+	log.Lvl3("Running task", pt.Service, pt.Name)
+	if err := tt.fn(pt.Data); err != nil {
+		log.Error("Task", pt.Service, pt.Name, "failed:", err)
+	}
+	if tt.slots != nil {
+		<-tt.slots
+	}
+
+	var next time.Time
+	if pt.cron != nil {
+		next = pt.cron.next(sc.now())
+	}
+	sc.Lock()
+	if sc.pending[pt.id] != pt {
+		// cancelled while running
+		sc.Unlock()
+		return
+	}
+	if next.IsZero() {
+		delete(sc.pending, pt.id)
+		sc.Unlock()
+		if err := sc.forget(pt.id); err != nil {
+			log.Error("Couldn't remove task:", err)
+		}
+		return
+	}
+	sc.Unlock()
+	pt.Next = next.UnixNano()
+	if err := sc.store(pt); err != nil {
+		log.Error("Couldn't store task:", err)
+	}
+	sc.arm(pt)
+}
+
+// store writes the run to the database.
+func (sc *scheduler) store(pt *pendingTask) error {
+	buf, err := network.Marshal(&pt.storedTask)
+	if err != nil {
+		return err
+	}
+	return sc.manager.dbUpdate(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(taskBucket)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(pt.id), buf)
+	})
+}
+
+// forget removes the run from the database.
+func (sc *scheduler) forget(id string) error {
+	return sc.manager.dbUpdate(func(tx *bolt.Tx) error {
+		b := tx.Bucket(taskBucket)
+		if b == nil {
+			return nil
+		}
+		return b.Delete([]byte(id))
+	})
+}
+
+// stop cancels the timers and waits for the running tasks. The scheduled
+// runs stay in the database for the next start.
+func (sc *scheduler) stop() {
+	sc.Lock()
+	sc.stopped = true
+	for _, pt := range sc.pending {
+		pt.timer.Stop()
+	}
+	sc.Unlock()
+	sc.running.Wait()
+}
+
+// GetStatus implements StatusReporter.
+func (sc *scheduler) GetStatus() *Status {
+	sc.Lock()
+	defer sc.Unlock()
+	st := NewStatus()
+	st.Set("Registered", len(sc.tasks))
+	st.Set("Scheduled", len(sc.pending))
+	return st
+}
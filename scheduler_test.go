@@ -0,0 +1,81 @@
+package onet
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dedis/onet/network"
+	"github.com/stretchr/testify/require"
+)
+
+// armedTimer returns the timer of the scheduled run id once it is not old
+// anymore.
+func armedTimer(sc *scheduler, id string, old network.Timer) network.Timer {
+	for {
+		sc.Lock()
+		var tm network.Timer
+		if pt := sc.pending[id]; pt != nil {
+			tm = pt.timer
+		}
+		sc.Unlock()
+		if tm != nil && tm != old {
+			return tm
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestContext_ScheduleTask(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	s := local.GenServers(1)[0]
+	clock := network.NewMockClock(time.Date(2018, 3, 14, 10, 0, 0, 0, time.UTC))
+	s.SetClock(clock)
+	c := s.Service(callServiceName).(*callService).Context
+
+	runs := make(chan string, 10)
+	task := func(data []byte) error {
+		runs <- string(data)
+		return errors.New("failing is logged only")
+	}
+	require.Nil(t, c.RegisterTask("task", task, 1))
+	_, err := c.ScheduleTask("unknown", clock.Now(), nil)
+	require.NotNil(t, err)
+	_, err = c.ScheduleCron("task", "invalid", nil)
+	require.NotNil(t, err)
+
+	_, err = c.ScheduleTask("task", clock.Now().Add(time.Minute), []byte("once"))
+	require.Nil(t, err)
+	cron, err := c.ScheduleCron("task", "*/10 * * * *", []byte("cron"))
+	require.Nil(t, err)
+	cancelled, err := c.ScheduleTask("task", clock.Now().Add(time.Hour), []byte("no"))
+	require.Nil(t, err)
+	require.Nil(t, c.CancelTask(cancelled))
+	require.NotNil(t, c.CancelTask(cancelled))
+
+	timer := armedTimer(s.serviceManager.scheduler, cron, nil)
+	clock.Advance(time.Minute)
+	require.Equal(t, "once", <-runs)
+	clock.Advance(9 * time.Minute)
+	require.Equal(t, "cron", <-runs)
+	timer = armedTimer(s.serviceManager.scheduler, cron, timer)
+	clock.Advance(10 * time.Minute)
+	require.Equal(t, "cron", <-runs)
+	armedTimer(s.serviceManager.scheduler, cron, timer)
+	require.Equal(t, 1, storedCount(t, s, taskBucket))
+
+	// After a restart, the task is scheduled again once registered
+	sm := s.serviceManager
+	sm.scheduler.stop()
+	sm.scheduler = newScheduler(sm)
+	require.Equal(t, 0, len(runs))
+	clock.Advance(time.Hour)
+	require.Equal(t, 0, len(runs))
+	require.Nil(t, c.RegisterTask("task", task, 1))
+	timer = armedTimer(sm.scheduler, cron, nil)
+	require.Equal(t, "cron", <-runs)
+	armedTimer(sm.scheduler, cron, timer)
+	require.Nil(t, c.CancelTask(cron))
+	require.Equal(t, 0, storedCount(t, s, taskBucket))
+}
@@ -0,0 +1,145 @@
+package onet
+
+import (
+	cryptorand "crypto/rand"
+	"math/rand"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/dedis/kyber/util/key"
+	"github.com/dedis/kyber/util/random"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+	"gopkg.in/satori/go.uuid.v1"
+)
+
+// EnvSeed is the environment variable that turns on the deterministic mode
+// of LocalTest, with its value as seed.
+const EnvSeed = "ONET_SEED"
+
+// seed is the source of the keys, identifiers and random choices of onet
+// in the deterministic mode.
+var seed struct {
+	value int64
+	rand  *rand.Rand
+	sync.Mutex
+}
+
+// SetSeed turns on the deterministic mode: the keys of the servers created
+// by LocalTest and the simulations, the IDs of rosters, trees nodes and
+// protocol rounds, and the random choices of onet all come from seed. A run
+// with the same seed creates the same values, as long as they are created
+// in the same order.
+//
+// The seed is global to the process: all LocalTests, servers and tests
+// running in parallel draw from the same source, so they only get the same
+// values if they run in the same order. It covers neither the scheduling
+// of the go-routines nor the order in which the messages arrive, nor the
+// randomness of the libraries onet uses.
+func SetSeed(s int64) {
+	seed.Lock()
+	defer seed.Unlock()
+	seed.value = s
+	seed.rand = rand.New(rand.NewSource(s))
+}
+
+// ClearSeed turns off the deterministic mode.
+func ClearSeed() {
+	seed.Lock()
+	defer seed.Unlock()
+	seed.rand = nil
+}
+
+// Seed returns the seed in use and whether the deterministic mode is on.
+func Seed() (int64, bool) {
+	seed.Lock()
+	defer seed.Unlock()
+	return seed.value, seed.rand != nil
+}
+
+// seedFromEnv turns on the deterministic mode if EnvSeed is set.
+func seedFromEnv() {
+	str := os.Getenv(EnvSeed)
+	if str == "" {
+		return
+	}
+	s, err := strconv.ParseInt(str, 10, 64)
+	if err != nil {
+		log.Error("Wrong", EnvSeed, ":", err)
+		return
+	}
+	SetSeed(s)
+	log.Lvl1("Deterministic mode with seed", s)
+}
+
+// seededReader reads from the seeded source, or from the system if the
+// deterministic mode is off.
+type seededReader struct{}
+
+func (seededReader) Read(p []byte) (int, error) {
+	seed.Lock()
+	defer seed.Unlock()
+	if seed.rand == nil {
+		return cryptorand.Read(p)
+	}
+	return seed.rand.Read(p)
+}
+
+// newKeyPair returns a new key pair, taken from the seed in the
+// deterministic mode.
+func newKeyPair(suite network.Suite) *key.Pair {
+	if _, ok := Seed(); !ok {
+		return key.NewKeyPair(suite)
+	}
+	priv := suite.Scalar().Pick(random.New(seededReader{}))
+	return &key.Pair{
+		Private: priv,
+		Public:  suite.Point().Mul(priv, nil),
+	}
+}
+
+// newUUID returns a new random (version 4) UUID, taken from the seed in the
+// deterministic mode.
+func newUUID() uuid.UUID {
+	seed.Lock()
+	defer seed.Unlock()
+	if seed.rand == nil {
+		return uuid.NewV4()
+	}
+	var u uuid.UUID
+	seed.rand.Read(u[:])
+	u[6] = (u[6] & 0x0f) | 0x40
+	u[8] = (u[8] & 0x3f) | 0x80
+	return u
+}
+
+// randIntn returns a random int in [0,n).
+func randIntn(n int) int {
+	seed.Lock()
+	defer seed.Unlock()
+	if seed.rand == nil {
+		return rand.Intn(n)
+	}
+	return seed.rand.Intn(n)
+}
+
+// randPerm returns a random permutation of [0,n).
+func randPerm(n int) []int {
+	seed.Lock()
+	defer seed.Unlock()
+	if seed.rand == nil {
+		return rand.Perm(n)
+	}
+	return seed.rand.Perm(n)
+}
+
+// randFloat64 returns a random float64 in [0.0,1.0).
+func randFloat64() float64 {
+	seed.Lock()
+	defer seed.Unlock()
+	if seed.rand == nil {
+		return rand.Float64()
+	}
+	return seed.rand.Float64()
+}
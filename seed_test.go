@@ -0,0 +1,54 @@
+package onet
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeed(t *testing.T) {
+	defer ClearSeed()
+	_, ok := Seed()
+	require.False(t, ok)
+	require.NotEqual(t, newUUID(), newUUID())
+
+	draw := func() []interface{} {
+		SetSeed(42)
+		return []interface{}{newUUID(), randIntn(1000), randPerm(10),
+			randFloat64(), newKeyPair(tSuite).Public.String()}
+	}
+	first := draw()
+	require.Equal(t, first, draw())
+	s, ok := Seed()
+	require.True(t, ok)
+	require.Equal(t, int64(42), s)
+
+	u := newUUID()
+	require.Equal(t, byte(0x40), u[6]&0xf0)
+	require.Equal(t, byte(0x80), u[8]&0xc0)
+
+	ClearSeed()
+	_, ok = Seed()
+	require.False(t, ok)
+}
+
+func TestSeed_Tree(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	defer ClearSeed()
+	_, ro, _ := local.GenTree(5, false)
+
+	build := func() (*Roster, *Tree) {
+		SetSeed(1)
+		r := NewRoster(ro.List)
+		return r, r.GenerateBinaryTree()
+	}
+	ro1, tree1 := build()
+	sub1 := ro1.RandomSubset(ro.List[0], 2)
+	ro2, tree2 := build()
+	sub2 := ro2.RandomSubset(ro.List[0], 2)
+	require.Equal(t, ro1.ID, ro2.ID)
+	require.Equal(t, tree1.Root.ID, tree2.Root.ID)
+	require.Equal(t, tree1.Root.Children[1].ID, tree2.Root.Children[1].ID)
+	require.Equal(t, sub1.List, sub2.List)
+}
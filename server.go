@@ -1,3 +1,5 @@
+// +build !js
+
 package onet
 
 import (
@@ -6,7 +8,6 @@ import (
 	"os"
 	"runtime"
 	"sort"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -20,8 +21,15 @@ import (
 // Server connects the Router, the Overlay, and the Services together. It sets
 // up everything and returns once a working network has been set up.
 type Server struct {
-	// Our private-key
+	// Our private-key, replaced by RotateKey
 	private kyber.Scalar
+	// keySaver stores the rotated keys, see SetKeySaver
+	keySaver KeySaver
+	keyLock  sync.RWMutex
+	// rotateLock makes the calls to RotateKey one after the other
+	rotateLock sync.Mutex
+	// dbKey is the key the name of the database is derived from
+	dbKey kyber.Point
 	*network.Router
 	// Overlay handles the mapping from tree and entityList to ServerIdentity.
 	// It uses tokens to represent an unique ProtocolInstance in the system
@@ -37,6 +45,33 @@ type Server struct {
 	websocket *WebSocket
 	// when this node has been started
 	started time.Time
+	// runtime feature flags
+	features *featureFlags
+	// our retired keys and the new keys of our peers
+	keyRotations *keyRotations
+	// the latest significant events, for the operators
+	events *eventLog
+	// audit is the audit log, see EnableAuditLog
+	audit *auditLog
+	// aclFile is the file the ACL is reloaded from, see SetACLFile
+	aclFile string
+	aclLock sync.Mutex
+	// adminToken must be given by the clients of the admin API, if set
+	adminToken string
+	// logRing is dumped by the admin API, see SetLogRing
+	logRing   *log.RingLogger
+	adminLock sync.Mutex
+	// serviceConfigs are the configurations of the services, by name
+	serviceConfigs map[string]interface{}
+	// reloader applies a new configuration, see SetReloader, and sighup
+	// receives the signals asking for it
+	reloader   func() ([]string, error)
+	sighup     chan os.Signal
+	reloadLock sync.Mutex
+	// systemdStop stops the notifications to systemd, see notifySystemd
+	systemdStop chan struct{}
+	// mux shares the port between the router and the websocket, if set
+	mux *network.Mux
 
 	suite network.Suite
 }
@@ -61,20 +96,50 @@ func newServer(s network.Suite, dbPath string, r *network.Router, pkey kyber.Sca
 	} else {
 		delDb = true
 	}
+	return newServerDB(s, dbPath, delDb, r, pkey, nil, nil, nil)
+}
 
+// newServerDB is newServer with the database in dbPath, deleted on close if
+// delDb is true. The name of the database is derived from dbKey, or from the
+// key of the router if it is nil. The services without configuration in
+// configs get their default one. The server knows the protocols of protos,
+// or the global ones if it is nil.
+func newServerDB(s network.Suite, dbPath string, delDb bool, r *network.Router, pkey kyber.Scalar,
+	dbKey kyber.Point, configs map[string]interface{}, protos *ProtocolRegistry) *Server {
+	if dbKey == nil {
+		dbKey = r.ServerIdentity.GetPublic()
+	}
 	c := &Server{
 		private:              pkey,
+		dbKey:                dbKey,
 		statusReporterStruct: newStatusReporterStruct(),
 		Router:               r,
 		protocols:            newProtocolStorage(),
+		features:             newFeatureFlags(),
+		keyRotations:         newKeyRotations(),
+		events:               newEventLog(DefaultEventLogSize),
+		serviceConfigs:       configs,
 		suite:                s,
 	}
+	c.loadFeaturesFromEnv()
+	c.audit = newAuditLog(c)
 	c.overlay = NewOverlay(c)
 	c.websocket = NewWebSocket(r.ServerIdentity)
+	c.websocket.audit = c.audit
+	c.websocket.registerService(OnetServiceName, &onetService{c}, nil)
+	c.registerAdmin()
+	c.recordPeerEvents()
 	c.serviceManager = newServiceManager(c, c.overlay, dbPath, delDb)
 	c.statusReporterStruct.RegisterStatusReporter("Generic", c)
-	for name, inst := range protocols.instantiators {
-		log.Lvl4("Registering global protocol", name)
+	c.statusReporterStruct.RegisterStatusReporter("Protocols", c.overlay)
+	c.statusReporterStruct.RegisterStatusReporter("Peers", peersStatus{r})
+	c.statusReporterStruct.RegisterStatusReporter("Log", logStatus{})
+	c.RegisterProcessorFunc(KeyRotationMsgID, c.handleKeyRotation)
+	if protos == nil {
+		protos = GlobalProtocols()
+	}
+	for name, inst := range protos.storage.all() {
+		log.Lvl4("Registering protocol", name)
 		c.ProtocolRegister(name, inst)
 	}
 	return c
@@ -88,6 +153,99 @@ func NewServerTCP(e *network.ServerIdentity, suite network.Suite) *Server {
 	return newServer(suite, "", r, e.GetPrivate())
 }
 
+// NewServerTCPWithDB is like NewServerTCP, but keeps the database in dbPath
+// instead of the default location. The directory is created if needed.
+func NewServerTCPWithDB(e *network.ServerIdentity, suite network.Suite, dbPath string) (*Server, error) {
+	return NewServerTCPWithOptions(e, suite, ServerOptions{DBPath: dbPath})
+}
+
+// ServerOptions are the settings of a server that must be known before its
+// services are started.
+type ServerOptions struct {
+	// DBPath is the directory of the database. If it is empty, the
+	// default location is used.
+	DBPath string
+	// ServiceConfigs holds the settings of the services, by service name,
+	// see RegisterNewServiceWithConfig.
+	ServiceConfigs map[string]map[string]interface{}
+	// Protocols are the protocols known to the server, in addition to the
+	// ones registered by its services. If it is nil, the server knows the
+	// protocols given to GlobalProtocolRegister.
+	Protocols *ProtocolRegistry
+	// Tenants are started after the default services, see AddTenant.
+	Tenants []Tenant
+	// SharedPort makes the websocket listen on the port of the server,
+	// instead of the one above. The clients must use Client.SetSharedPort.
+	SharedPort bool
+	// DBCompaction, if set, compacts the database before it is opened,
+	// and in the background if its Interval is set, see DBCompaction. A
+	// failed compaction is logged and leaves the database as it is.
+	DBCompaction *DBCompaction
+	// FirstPublic is the key the server had before its key was rotated,
+	// see RotateKey. The ServerIdentity keeps the ID derived from it, and
+	// the name of the database is derived from it. If it is nil, the key of
+	// the ServerIdentity is used.
+	FirstPublic kyber.Point
+}
+
+// NewServerTCPWithOptions is like NewServerTCP, with the given options. It
+// returns an error if the settings of a service are invalid.
+func NewServerTCPWithOptions(e *network.ServerIdentity, suite network.Suite, opts ServerOptions) (*Server, error) {
+	configs, err := parseServiceConfigs(opts.ServiceConfigs)
+	if err != nil {
+		return nil, err
+	}
+	dbPath := opts.DBPath
+	if dbPath == "" {
+		dbPath = dbPathFromEnv()
+	}
+	if err := os.MkdirAll(dbPath, 0750); err != nil {
+		return nil, err
+	}
+	var r *network.Router
+	var mux *network.Mux
+	if opts.SharedPort {
+		r, mux, err = newSharedRouter(e, suite)
+	} else {
+		r, err = network.NewTCPRouter(e, suite)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var compacted time.Time
+	if opts.DBCompaction != nil {
+		start := time.Now()
+		dbKey := opts.FirstPublic
+		if dbKey == nil {
+			dbKey = e.GetPublic()
+		}
+		done, err := CompactDBFile(dbFileName(dbPath, dbKey), *opts.DBCompaction)
+		if err != nil {
+			log.Error("Compacting db failed, keeping it as it is:", err)
+		} else if done {
+			compacted = start
+		}
+	}
+	c := newServerDB(suite, dbPath, false, r, e.GetPrivate(), opts.FirstPublic, configs, opts.Protocols)
+	if !compacted.IsZero() {
+		c.serviceManager.compaction.done(compacted)
+	}
+	if opts.DBCompaction != nil {
+		c.SetDBCompaction(*opts.DBCompaction)
+	}
+	if mux != nil {
+		c.mux = mux
+		c.websocket.shareListener(mux)
+	}
+	for _, t := range opts.Tenants {
+		if err := c.AddTenant(t); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
 // Suite can (and should) be used to get the underlying Suite.
 // Currently the suite is hardcoded into the network library.
 // Don't use network.Suite but Host's Suite function instead if possible.
@@ -99,23 +257,81 @@ func (c *Server) Suite() network.Suite {
 func (c *Server) GetStatus() *Status {
 	a := c.serviceManager.availableServices()
 	sort.Strings(a)
-	return &Status{Field: map[string]string{
-		"Available_Services": strings.Join(a, ","),
-		"TX_bytes":           strconv.FormatUint(c.Router.Tx(), 10),
-		"RX_bytes":           strconv.FormatUint(c.Router.Rx(), 10),
-		"Uptime":             time.Now().Sub(c.started).String(),
-		"System": fmt.Sprintf("%s/%s/%s", runtime.GOOS, runtime.GOARCH,
-			runtime.Version()),
-		"Version":     Version,
-		"Host":        c.ServerIdentity.Address.Host(),
-		"Port":        c.ServerIdentity.Address.Port(),
-		"Description": c.ServerIdentity.Description,
-		"ConnType":    string(c.ServerIdentity.Address.ConnType()),
-	}}
+	st := NewStatus()
+	st.Set("Available_Services", strings.Join(a, ","))
+	st.Set("TX_bytes", c.Router.Tx())
+	st.Set("RX_bytes", c.Router.Rx())
+	st.Set("Uptime", c.Clock().Now().Sub(c.started))
+	st.Set("System", fmt.Sprintf("%s/%s/%s", runtime.GOOS, runtime.GOARCH,
+		runtime.Version()))
+	st.Set("Version", Version)
+	st.Set("Host", c.ServerIdentity.Address.Host())
+	st.Set("Port", c.ServerIdentity.Address.Port())
+	st.Set("Description", c.ServerIdentity.Description)
+	st.Set("ConnType", string(c.ServerIdentity.Address.ConnType()))
+	st.Set("Features", strings.Join(c.Features(), ","))
+	st.Set("Tenants", strings.Join(c.Tenants(), ","))
+	return st
+}
+
+// logStatus reports the number of messages of the log package, by level
+// and by call site. As the log is shared, all the servers of a process
+// report the same numbers.
+type logStatus struct{}
+
+// GetStatus returns one entry per level and one per call site, which
+// /metrics shows as onet_Log_Messages and onet_Log_CallerMessages.
+func (logStatus) GetStatus() *Status {
+	st := NewStatus()
+	for level, n := range log.Counts() {
+		st.Set("level "+level, map[string]interface{}{"Messages": n})
+	}
+	for site, n := range log.CallerCounts() {
+		st.Set(site, map[string]interface{}{"CallerMessages": n})
+	}
+	return st
+}
+
+// peersStatus reports the state of the connections of the router to the
+// other servers.
+type peersStatus struct {
+	router *network.Router
+}
+
+// GetStatus returns one entry per server, under its address.
+func (p peersStatus) GetStatus() *Status {
+	st := NewStatus()
+	for _, peer := range p.router.Peers() {
+		established := ""
+		if !peer.Established.IsZero() {
+			established = peer.Established.Format(time.RFC3339)
+		}
+		st.Set(peer.ServerIdentity.Address.String(), map[string]interface{}{
+			"Connections":  peer.Connections,
+			"Established":  established,
+			"LastActivity": peer.LastActivity.Format(time.RFC3339),
+			"RTT":          peer.RTT,
+			"TX_bytes":     peer.Tx,
+			"RX_bytes":     peer.Rx,
+			"MsgsIn":       peer.MsgsIn,
+			"MsgsOut":      peer.MsgsOut,
+			"Reconnects":   peer.Reconnects,
+		})
+	}
+	return st
+}
+
+// GetStatusJSON returns the status of all reporters of this server, encoded
+// as a JSON object with one entry per reporter. Contrary to the string map
+// of GetStatus, numbers and durations keep their type.
+func (c *Server) GetStatusJSON() ([]byte, error) {
+	return c.statusReporterStruct.ReportStatusJSON()
 }
 
 // Close closes the overlay and the Router
 func (c *Server) Close() error {
+	c.stopSIGHUP()
+	c.stopSystemd()
 	c.overlay.stop()
 	c.websocket.stop()
 	c.overlay.Close()
@@ -124,6 +340,9 @@ func (c *Server) Close() error {
 		log.Lvl3("Error closing database: " + err.Error())
 	}
 	err = c.Router.Stop()
+	if c.mux != nil {
+		c.mux.Close()
+	}
 	log.Lvl3("Host Close", c.ServerIdentity.Address, "listening?", c.Router.Listening())
 	return err
 }
@@ -150,9 +369,16 @@ func (c *Server) ProtocolRegister(name string, protocol NewProtocol) (ProtocolID
 	return c.protocols.Register(name, protocol)
 }
 
+// ProtocolRegisterLocal registers the protocol only on this server. Unlike
+// ProtocolRegister, it replaces a protocol of the same name, so that two
+// servers of the same process can run different implementations of it.
+func (c *Server) ProtocolRegisterLocal(name string, protocol NewProtocol) ProtocolID {
+	return c.protocols.set(name, protocol)
+}
+
 // protocolInstantiate instantiate a protocol from its ID
 func (c *Server) protocolInstantiate(protoID ProtocolID, tni *TreeNodeInstance) (ProtocolInstance, error) {
-	fn, ok := c.protocols.instantiators[c.protocols.ProtocolIDToName(protoID)]
+	fn, ok := c.protocols.instantiator(protoID)
 	if !ok {
 		return nil, errors.New("No protocol constructor with this ID")
 	}
@@ -162,9 +388,20 @@ func (c *Server) protocolInstantiate(protoID ProtocolID, tni *TreeNodeInstance)
 // Start makes the router and the websocket listen on their respective
 // ports.
 func (c *Server) Start() {
-	c.started = time.Now()
+	c.started = c.Clock().Now()
+	c.overlay.resumeProtocols()
+	c.overlay.resumePaused()
 	go c.Router.Start()
+	if c.mux != nil {
+		go func() {
+			if err := c.mux.Serve(); err != nil {
+				log.Error("Couldn't share the port:", err)
+			}
+		}()
+	}
+	c.handleSIGHUP()
+	c.notifySystemd()
 	c.websocket.start()
 	log.Lvl1("Started server at %s on address %s with public key %s",
-		c.started, c.ServerIdentity.Address, c.ServerIdentity.Public)
+		c.started, c.ServerIdentity.Address, c.ServerIdentity.GetPublic())
 }
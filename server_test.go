@@ -1,10 +1,15 @@
 package onet
 
 import (
+	"io/ioutil"
+	"os"
+	"path"
 	"testing"
 
 	"github.com/coreos/bbolt"
+	"github.com/dedis/kyber/util/key"
 	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
 	"github.com/stretchr/testify/require"
 	"gopkg.in/satori/go.uuid.v1"
 )
@@ -46,6 +51,25 @@ func TestServer_Database(t *testing.T) {
 	c.Close()
 }
 
+func TestServer_NewServerTCPWithDB(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "serverdb")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmp)
+	dbPath := path.Join(tmp, "db")
+
+	kp := key.NewKeyPair(tSuite)
+	si := network.NewServerIdentity(kp.Public, network.NewAddress(network.PlainTCP, "127.0.0.1:0"))
+	si.SetPrivate(kp.Private)
+	c, err := NewServerTCPWithDB(si, tSuite, dbPath)
+	require.Nil(t, err)
+	dbFile := c.serviceManager.dbFileName()
+	require.Equal(t, dbPath, path.Dir(dbFile))
+	require.Nil(t, c.Close())
+	// The database is kept after the server is closed.
+	_, err = os.Stat(dbFile)
+	require.Nil(t, err)
+}
+
 type ServerProtocol struct {
 	*TreeNodeInstance
 }
@@ -1,3 +1,5 @@
+// +build !js
+
 package onet
 
 import (
@@ -6,11 +8,11 @@ import (
 	"net/http"
 	"os"
 	"path"
-	"strconv"
 
 	"sync"
 
 	bolt "github.com/coreos/bbolt"
+	"github.com/dedis/kyber"
 	"github.com/dedis/onet/log"
 	"github.com/dedis/onet/network"
 	"gopkg.in/satori/go.uuid.v1"
@@ -90,6 +92,8 @@ type serviceEntry struct {
 	constructor NewServiceFunc
 	serviceID   ServiceID
 	name        string
+	// config is the default configuration, if the service has one
+	config interface{}
 }
 
 // ServiceFactory is the global service factory to instantiate Services
@@ -100,16 +104,26 @@ var ServiceFactory = serviceFactory{
 // Register takes a name and a function, then creates a ServiceID out of it and stores the
 // mapping and the creation function.
 func (s *serviceFactory) Register(name string, fn NewServiceFunc) (ServiceID, error) {
-	if !s.ServiceID(name).Equal(NilServiceID) {
-		return NilServiceID, fmt.Errorf("service %s already registered", name)
+	return s.register(name, fn, nil)
+}
+
+func (s *serviceFactory) register(name string, fn NewServiceFunc, config interface{}) (ServiceID, error) {
+	if name == OnetServiceName {
+		return NilServiceID, fmt.Errorf("service name %s is reserved for onet", name)
 	}
-	id := ServiceID(uuid.NewV5(uuid.NamespaceURL, name))
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
+	for _, c := range s.constructors {
+		if c.name == name {
+			return NilServiceID, fmt.Errorf("service %s already registered", name)
+		}
+	}
+	id := ServiceID(uuid.NewV5(uuid.NamespaceURL, name))
 	s.constructors = append(s.constructors, serviceEntry{
 		constructor: fn,
 		serviceID:   id,
 		name:        name,
+		config:      config,
 	})
 	return id, nil
 }
@@ -210,6 +224,21 @@ type serviceManager struct {
 	// a bbolt database for all services
 	db     *bolt.DB
 	dbPath string
+	// protects db, which is nil once closed
+	dbMut sync.RWMutex
+	// the statistics of the compaction
+	compaction *dbCompactor
+	// the misbehavior of the peers, stored in db
+	reputation *reputationStore
+	// the storage limits of the services
+	quotas storageQuotas
+	// the subscriptions to the streams of the services
+	streams streamHub
+	// runs the tasks of the services
+	scheduler *scheduler
+	// the other sets of services, by tenant name
+	tenants    map[string]*tenant
+	tenantsMut sync.RWMutex
 	// should the db be deleted on close?
 	delDb bool
 	// the dispatcher can take registration of Processors
@@ -224,6 +253,7 @@ func newServiceManager(svr *Server, o *Overlay, dbPath string, delDb bool) *serv
 		server:     svr,
 		dbPath:     dbPath,
 		delDb:      delDb,
+		tenants:    make(map[string]*tenant),
 		Dispatcher: network.NewRoutineDispatcher(),
 	}
 
@@ -232,6 +262,13 @@ func newServiceManager(svr *Server, o *Overlay, dbPath string, delDb bool) *serv
 		log.Panic("Failed to create new database: " + err.Error())
 	}
 	s.db = db
+	s.compaction = newDBCompactor(s)
+	s.quotas.names = s.storageNames
+	s.scheduler = newScheduler(s)
+	s.reputation, err = newReputationStore(s, svr.suite)
+	if err != nil {
+		log.Panic("Failed to create reputation bucket: " + err.Error())
+	}
 
 	ids := ServiceFactory.registeredServiceIDs()
 	for _, id := range ids {
@@ -242,21 +279,51 @@ func newServiceManager(svr *Server, o *Overlay, dbPath string, delDb bool) *serv
 		if err != nil {
 			log.Panic("Failed to create bucket: " + err.Error())
 		}
+		if err = s.migrate(name); err != nil {
+			log.Panic("Failed to migrate storage: " + err.Error())
+		}
 
 		cont := newContext(svr, o, id, s)
+		var ok bool
+		if cont.config, ok = svr.serviceConfigs[name]; !ok {
+			cont.config, err = ServiceFactory.serviceConfig(name, nil)
+			if err != nil {
+				log.Panic("Invalid default configuration:", err)
+			}
+		}
 		s, err := ServiceFactory.start(name, cont)
 		if err != nil {
 			log.Panic("Trying to instantiate service", name, ":", err)
 		}
+		if err := replayJournal(s, cont); err != nil {
+			log.Panic("Replaying the journal of service", name, ":", err)
+		}
 		log.Lvl3("Started Service", name)
 		services[id] = s
-		svr.websocket.registerService(name, s)
+		svr.websocket.registerService(name, s, cont)
 	}
+	s.registerProcessorFunc(TenantMsgID, s.processTenantMsg)
 	log.Lvl3(svr.Address(), "instantiated all services")
 	svr.statusReporterStruct.RegisterStatusReporter("Db", s)
+	svr.statusReporterStruct.RegisterStatusReporter("Reputation", s.reputation)
+	svr.statusReporterStruct.RegisterStatusReporter("Tasks", s.scheduler)
 	return s
 }
 
+// dbView runs fn in a read-only transaction of the database.
+func (s *serviceManager) dbView(fn func(*bolt.Tx) error) error {
+	s.dbMut.RLock()
+	defer s.dbMut.RUnlock()
+	return s.db.View(fn)
+}
+
+// dbUpdate runs fn in a read-write transaction of the database.
+func (s *serviceManager) dbUpdate(fn func(*bolt.Tx) error) error {
+	s.dbMut.RLock()
+	defer s.dbMut.RUnlock()
+	return s.db.Update(fn)
+}
+
 // openDb opens a database at `path`. It creates the database if it does not exist.
 // The caller must ensure that all parent directories exist.
 func openDb(path string) (*bolt.DB, error) {
@@ -276,8 +343,14 @@ func createBucketForService(db *bolt.DB, bucketName string) error {
 }
 
 func (s *serviceManager) dbFileName() string {
-	pub, _ := s.server.ServerIdentity.Public.MarshalBinary()
-	return path.Join(s.dbPath, fmt.Sprintf("%x.db", pub))
+	return dbFileName(s.dbPath, s.server.dbKey)
+}
+
+// dbFileName returns the file of the database of the server with the given
+// public key.
+func dbFileName(dbPath string, public kyber.Point) string {
+	pub, _ := public.MarshalBinary()
+	return path.Join(dbPath, fmt.Sprintf("%x.db", pub))
 }
 
 // Process implements the Processor interface: service manager will relay
@@ -290,6 +363,11 @@ func (s *serviceManager) Process(env *network.Envelope) {
 // closeDatabase closes the database.
 // It also removes the database file if the path is not default (i.e. testing config)
 func (s *serviceManager) closeDatabase() error {
+	s.scheduler.stop()
+	s.compaction.close()
+	s.dbMut.Lock()
+	defer s.dbMut.Unlock()
+	dbFile := s.dbFileName()
 	if s.db != nil {
 		err := s.db.Close()
 		if err != nil {
@@ -298,7 +376,7 @@ func (s *serviceManager) closeDatabase() error {
 	}
 
 	if s.delDb {
-		err := os.Remove(s.dbFileName())
+		err := os.Remove(dbFile)
 		if err != nil {
 			return err
 		}
@@ -308,31 +386,35 @@ func (s *serviceManager) closeDatabase() error {
 
 // GetStatus is a function that returns the status report of the server.
 func (s *serviceManager) GetStatus() *Status {
+	s.dbMut.RLock()
+	defer s.dbMut.RUnlock()
 	if s.db == nil {
 		return &Status{Field: map[string]string{"Open": "false"}}
 	}
 	st := s.db.Stats()
-	return &Status{Field: map[string]string{
-		"Open":             "true",
-		"FreePageN":        strconv.Itoa(st.FreePageN),
-		"PendingPageN":     strconv.Itoa(st.PendingPageN),
-		"FreeAlloc":        strconv.Itoa(st.FreeAlloc),
-		"FreelistInuse":    strconv.Itoa(st.FreelistInuse),
-		"TxN":              strconv.Itoa(st.TxN),
-		"OpenTxN":          strconv.Itoa(st.OpenTxN),
-		"Tx.PageCount":     strconv.Itoa(st.TxStats.PageCount),
-		"Tx.PageAlloc":     strconv.Itoa(st.TxStats.PageAlloc),
-		"Tx.CursorCount":   strconv.Itoa(st.TxStats.CursorCount),
-		"Tx.NodeCount":     strconv.Itoa(st.TxStats.NodeCount),
-		"Tx.NodeDeref":     strconv.Itoa(st.TxStats.NodeDeref),
-		"Tx.Rebalance":     strconv.Itoa(st.TxStats.Rebalance),
-		"Tx.RebalanceTime": st.TxStats.RebalanceTime.String(),
-		"Tx.Split":         strconv.Itoa(st.TxStats.Split),
-		"Tx.Spill":         strconv.Itoa(st.TxStats.Spill),
-		"Tx.SpillTime":     st.TxStats.SpillTime.String(),
-		"Tx.Write":         strconv.Itoa(st.TxStats.Write),
-		"Tx.WriteTime":     st.TxStats.WriteTime.String(),
-	}}
+	status := NewStatus()
+	status.Set("Open", true)
+	status.Set("FreePageN", st.FreePageN)
+	status.Set("PendingPageN", st.PendingPageN)
+	status.Set("FreeAlloc", st.FreeAlloc)
+	status.Set("FreelistInuse", st.FreelistInuse)
+	status.Set("TxN", st.TxN)
+	status.Set("OpenTxN", st.OpenTxN)
+	status.Set("Tx.PageCount", st.TxStats.PageCount)
+	status.Set("Tx.PageAlloc", st.TxStats.PageAlloc)
+	status.Set("Tx.CursorCount", st.TxStats.CursorCount)
+	status.Set("Tx.NodeCount", st.TxStats.NodeCount)
+	status.Set("Tx.NodeDeref", st.TxStats.NodeDeref)
+	status.Set("Tx.Rebalance", st.TxStats.Rebalance)
+	status.Set("Tx.RebalanceTime", st.TxStats.RebalanceTime)
+	status.Set("Tx.Split", st.TxStats.Split)
+	status.Set("Tx.Spill", st.TxStats.Spill)
+	status.Set("Tx.SpillTime", st.TxStats.SpillTime)
+	status.Set("Tx.Write", st.TxStats.Write)
+	status.Set("Tx.WriteTime", st.TxStats.WriteTime)
+	s.compaction.addStatus(s.db, status)
+	s.addStorageStatus(status)
+	return status
 }
 
 // registerProcessor the processor to the service manager and tells the host to dispatch
@@ -380,11 +462,23 @@ func (s *serviceManager) serviceByID(id ServiceID) (Service, bool) {
 	var serv Service
 	var ok bool
 	if serv, ok = s.services[id]; !ok {
-		return nil, false
+		if serv, _ = s.tenantService(id); serv == nil {
+			return nil, false
+		}
 	}
 	return serv, true
 }
 
+// serviceName returns the name of the service with this id, prefixed by
+// "<tenant>/" for the services of a tenant, or "" if there is none.
+func (s *serviceManager) serviceName(id ServiceID) string {
+	if name := ServiceFactory.Name(id); name != "" {
+		return name
+	}
+	_, name := s.tenantService(id)
+	return name
+}
+
 // newProtocol contains the logic of how and where a ProtocolInstance is
 // created. If the token's ServiceID is nil, then onet handles the creation of
 // the PI. If the corresponding service returns (nil,nil), then onet handles
@@ -0,0 +1,67 @@
+// +build !js
+
+package onet
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/dedis/onet/network"
+	"github.com/dedis/protobuf"
+)
+
+// LocalCallAddr is the RemoteAddr of the requests of CallService to a
+// service of the same server.
+const LocalCallAddr = "local"
+
+// CallService sends msg to the service of the given name on dst, as
+// Client.SendProtobuf does, and decodes the reply into ret if it is not
+// nil. If dst is this server, or nil, the request is given directly to
+// the service, without going through the websocket. The services of a
+// tenant call the services of the same tenant.
+func (c *Context) CallService(dst *network.ServerIdentity, service string, msg, ret interface{}) error {
+	return c.CallServiceWithContext(context.Background(), dst, service, msg, ret)
+}
+
+// CallServiceWithContext is like CallService, but the request is cancelled
+// with ctx.
+func (c *Context) CallServiceWithContext(ctx context.Context, dst *network.ServerIdentity, service string, msg, ret interface{}) error {
+	if dst != nil && !dst.ID.Equal(c.server.ServerIdentity.ID) {
+		name := service
+		if c.tenant != nil {
+			name = c.tenant.name + "/" + service
+		}
+		cl := NewClient(c.server.suite, name)
+		defer cl.Close()
+		return cl.SendProtobufWithContext(ctx, dst, msg, ret)
+	}
+
+	s := c.Service(service)
+	if s == nil {
+		return errors.New("no service " + service + " on this server")
+	}
+	buf, err := protobuf.Encode(msg)
+	if err != nil {
+		return err
+	}
+	path := strings.Split(reflect.TypeOf(msg).String(), ".")[1]
+	req := (&http.Request{
+		Method:     "GET",
+		URL:        &url.URL{Path: "/" + service + "/" + path},
+		Header:     http.Header{},
+		RemoteAddr: LocalCallAddr,
+	}).WithContext(ctx)
+	reply, err := c.server.websocket.handler(s)(req, service, path, buf)
+	if err != nil {
+		return err
+	}
+	if ret != nil {
+		return protobuf.DecodeWithConstructors(reply, ret,
+			network.DefaultConstructors(c.server.suite))
+	}
+	return nil
+}
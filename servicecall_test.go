@@ -0,0 +1,67 @@
+package onet
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/dedis/protobuf"
+	"github.com/stretchr/testify/require"
+)
+
+const callServiceName = "CallService"
+
+type CallRequest struct {
+	I int
+}
+
+type CallReply struct {
+	I      int
+	Remote string
+}
+
+// callService answers CallRequests with I+1 and the address of the caller.
+type callService struct {
+	*ServiceProcessor
+}
+
+func init() {
+	RegisterNewService(callServiceName, func(c *Context) (Service, error) {
+		return &callService{NewServiceProcessor(c)}, nil
+	})
+}
+
+func (s *callService) ProcessClientRequest(req *http.Request, path string, buf []byte) ([]byte, error) {
+	cr := &CallRequest{}
+	if err := protobuf.Decode(buf, cr); err != nil {
+		return nil, err
+	}
+	return protobuf.Encode(&CallReply{cr.I + 1, req.RemoteAddr})
+}
+
+func TestContext_CallService(t *testing.T) {
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	servers := local.GenServers(2)
+	c := servers[0].Service(callServiceName).(*callService).Context
+
+	reply := &CallReply{}
+	require.Nil(t, c.CallService(nil, callServiceName, &CallRequest{1}, reply))
+	require.Equal(t, 2, reply.I)
+	require.Equal(t, LocalCallAddr, reply.Remote)
+	require.Nil(t, c.CallService(servers[0].ServerIdentity, callServiceName, &CallRequest{2}, reply))
+	require.Equal(t, LocalCallAddr, reply.Remote)
+
+	require.Nil(t, c.CallService(servers[1].ServerIdentity, callServiceName, &CallRequest{3}, reply))
+	require.Equal(t, 4, reply.I)
+	require.NotEqual(t, LocalCallAddr, reply.Remote)
+
+	require.NotNil(t, c.CallService(nil, "unknown", &CallRequest{}, nil))
+	require.NotNil(t, c.CallService(servers[1].ServerIdentity, "unknown", &CallRequest{}, nil))
+
+	// The services of a tenant call the same tenant
+	require.Nil(t, servers[0].AddTenant(Tenant{Name: "test", Services: []string{callServiceName}}))
+	tc := servers[0].TenantService("test", callServiceName).(*callService).Context
+	require.Nil(t, tc.CallService(nil, callServiceName, &CallRequest{5}, reply))
+	require.Equal(t, 6, reply.I)
+	require.NotNil(t, tc.CallService(servers[1].ServerIdentity, callServiceName, &CallRequest{}, nil))
+}
@@ -0,0 +1,117 @@
+// +build !js
+
+package onet
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// ServiceConfigValidator is implemented by the configurations of the
+// services that check their settings.
+type ServiceConfigValidator interface {
+	Validate() error
+}
+
+// RegisterNewServiceWithConfig is like RegisterNewService, for a service
+// with settings. config is a pointer to a struct holding the default
+// settings. Every server gives its service a copy of it, overwritten by the
+// settings of the service's block in the configuration of the server, see
+// ServerOptions. The service gets it from Context.ServiceConfig. If config
+// implements ServiceConfigValidator, the settings are checked before the
+// server starts.
+func RegisterNewServiceWithConfig(name string, fn NewServiceFunc, config interface{}) (ServiceID, error) {
+	v := reflect.ValueOf(config)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return NilServiceID, errors.New("the configuration must be a pointer to a struct")
+	}
+	return ServiceFactory.register(name, fn, config)
+}
+
+// ServiceConfig returns the configuration of the service, of the type given
+// to RegisterNewServiceWithConfig, or nil if it has none.
+func (c *Context) ServiceConfig() interface{} {
+	return c.config
+}
+
+// serviceConfig returns the configuration of the service, with the settings
+// applied to a copy of its default configuration. It is nil if the service
+// has no configuration.
+func (s *serviceFactory) serviceConfig(name string, settings map[string]interface{}) (interface{}, error) {
+	s.mutex.RLock()
+	var def interface{}
+	found := false
+	for _, c := range s.constructors {
+		if c.name == name {
+			def, found = c.config, true
+			break
+		}
+	}
+	s.mutex.RUnlock()
+	if !found {
+		return nil, fmt.Errorf("settings for unknown service %s", name)
+	}
+	if def == nil {
+		if len(settings) > 0 {
+			return nil, fmt.Errorf("service %s has no settings", name)
+		}
+		return nil, nil
+	}
+
+	cfg := reflect.New(reflect.TypeOf(def).Elem())
+	cfg.Elem().Set(reflect.ValueOf(def).Elem())
+	if len(settings) > 0 {
+		buf, err := json.Marshal(settings)
+		if err != nil {
+			return nil, fmt.Errorf("service %s: %v", name, err)
+		}
+		dec := json.NewDecoder(bytes.NewReader(buf))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(cfg.Interface()); err != nil {
+			return nil, fmt.Errorf("service %s: %v", name, err)
+		}
+	}
+	if v, ok := cfg.Interface().(ServiceConfigValidator); ok {
+		if err := v.Validate(); err != nil {
+			return nil, fmt.Errorf("service %s: %v", name, err)
+		}
+	}
+	return cfg.Interface(), nil
+}
+
+// parseServiceConfigs returns the configurations of all the registered
+// services that have one, by name, with the given settings.
+func parseServiceConfigs(settings map[string]map[string]interface{}) (map[string]interface{}, error) {
+	names := make([]string, 0, len(settings))
+	for name := range settings {
+		names = append(names, name)
+	}
+	for _, name := range ServiceFactory.RegisteredServiceNames() {
+		if _, ok := settings[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	configs := make(map[string]interface{})
+	for _, name := range names {
+		cfg, err := ServiceFactory.serviceConfig(name, settings[name])
+		if err != nil {
+			return nil, err
+		}
+		if cfg != nil {
+			configs[name] = cfg
+		}
+	}
+	return configs, nil
+}
+
+// CheckServiceConfigs returns an error if the settings of a service, given
+// by service name, are unknown or invalid.
+func CheckServiceConfigs(settings map[string]map[string]interface{}) error {
+	_, err := parseServiceConfigs(settings)
+	return err
+}
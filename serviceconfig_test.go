@@ -0,0 +1,82 @@
+package onet
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const configServiceName = "ConfigService"
+
+type configServiceConfig struct {
+	Interval int
+	Name     string
+}
+
+func (c *configServiceConfig) Validate() error {
+	if c.Interval <= 0 {
+		return errors.New("Interval must be positive")
+	}
+	return nil
+}
+
+type configService struct {
+	*ServiceProcessor
+	config *configServiceConfig
+}
+
+func init() {
+	RegisterNewServiceWithConfig(configServiceName, func(c *Context) (Service, error) {
+		return &configService{
+			ServiceProcessor: NewServiceProcessor(c),
+			config:           c.ServiceConfig().(*configServiceConfig),
+		}, nil
+	}, &configServiceConfig{Interval: 10, Name: "default"})
+}
+
+func TestRegisterNewServiceWithConfig(t *testing.T) {
+	fn := func(c *Context) (Service, error) { return nil, nil }
+	_, err := RegisterNewServiceWithConfig("BadConfig", fn, configServiceConfig{})
+	require.NotNil(t, err)
+	_, err = RegisterNewServiceWithConfig("BadConfig", fn, new(int))
+	require.NotNil(t, err)
+}
+
+func TestParseServiceConfigs(t *testing.T) {
+	configs, err := parseServiceConfigs(nil)
+	require.Nil(t, err)
+	require.Equal(t, &configServiceConfig{Interval: 10, Name: "default"},
+		configs[configServiceName])
+
+	configs, err = parseServiceConfigs(map[string]map[string]interface{}{
+		configServiceName: {"Interval": 5},
+	})
+	require.Nil(t, err)
+	require.Equal(t, &configServiceConfig{Interval: 5, Name: "default"},
+		configs[configServiceName])
+
+	for _, settings := range []map[string]map[string]interface{}{
+		{configServiceName: {"Interval": 0}},
+		{configServiceName: {"Intervall": 5}},
+		{configServiceName: {"Interval": "five"}},
+		{"NoSuchService": {"Interval": 5}},
+		{clientServiceName: {"Interval": 5}},
+	} {
+		require.NotNil(t, CheckServiceConfigs(settings), "%v", settings)
+	}
+}
+
+func TestContext_ServiceConfig(t *testing.T) {
+	l := NewLocalTest(tSuite)
+	defer l.CloseAll()
+	s := l.GenServers(1)[0]
+
+	cs := s.Service(configServiceName).(*configService)
+	require.Equal(t, 10, cs.config.Interval)
+	// Every server has its own copy.
+	cs.config.Interval = 3
+	configs, err := parseServiceConfigs(nil)
+	require.Nil(t, err)
+	require.Equal(t, 10, configs[configServiceName].(*configServiceConfig).Interval)
+}
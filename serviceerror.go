@@ -0,0 +1,180 @@
+package onet
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// ErrorCode classifies a ServiceError, so that clients can react to it
+// without parsing the message.
+type ErrorCode int
+
+const (
+	// ErrorUnknown is the code of errors without classification.
+	ErrorUnknown ErrorCode = iota
+	// ErrorInvalidRequest is returned for requests that can't be handled
+	// as they are.
+	ErrorInvalidRequest
+	// ErrorNotFound is returned if the request refers to something the
+	// service doesn't know.
+	ErrorNotFound
+	// ErrorUnauthorized is returned if the client may not do the request.
+	ErrorUnauthorized
+	// ErrorUnavailable is returned if the service can't handle the request
+	// for now.
+	ErrorUnavailable
+	// ErrorTimeout is returned if the request took too long.
+	ErrorTimeout
+	// ErrorInternal is returned for failures of the service itself.
+	ErrorInternal
+)
+
+var errorCodeNames = map[ErrorCode]string{
+	ErrorUnknown:        "unknown",
+	ErrorInvalidRequest: "invalid request",
+	ErrorNotFound:       "not found",
+	ErrorUnauthorized:   "unauthorized",
+	ErrorUnavailable:    "unavailable",
+	ErrorTimeout:        "timeout",
+	ErrorInternal:       "internal",
+}
+
+func (c ErrorCode) String() string {
+	if n, ok := errorCodeNames[c]; ok {
+		return n
+	}
+	return fmt.Sprintf("code %d", int(c))
+}
+
+// ServiceError is an error that a service handler returns to give the
+// client more than a message. It is sent over the websocket as is, and
+// Client.Send returns it to the caller.
+type ServiceError struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+	// Retryable tells the client that the same request might succeed
+	// later.
+	Retryable bool `json:"retryable"`
+	// Detail is specific to the service, e.g. an encoded message
+	Detail []byte `json:"detail,omitempty"`
+}
+
+// NewServiceError returns a ServiceError with the given code and message.
+func NewServiceError(code ErrorCode, retryable bool, format string, args ...interface{}) *ServiceError {
+	return &ServiceError{
+		Code:      code,
+		Message:   fmt.Sprintf(format, args...),
+		Retryable: retryable,
+	}
+}
+
+func (e *ServiceError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// IsRetryable returns whether the request that returned err might succeed
+// if it is sent again.
+func IsRetryable(err error) bool {
+	if err == ErrServiceBusy {
+		return true
+	}
+	se, ok := err.(*ServiceError)
+	return ok && se.Retryable
+}
+
+// maxCloseText is the longest text of a close message: control frames
+// carry at most 125 bytes, two of which are the code.
+const maxCloseText = 123
+
+// closeText shortens the text of an error so that it fits in a close
+// message.
+func closeText(s string) string {
+	if len(s) > maxCloseText {
+		return s[:maxCloseText]
+	}
+	return s
+}
+
+// writeServiceError sends the ServiceError or ValidationError se as a text
+// message. It is only done in reply to binary requests, so that the client
+// can tell it from a reply. The server closes the websocket with
+// wsServiceErrorCode or wsInvalidCode afterwards.
+func writeServiceError(ws *websocket.Conn, se error) error {
+	buf, err := json.Marshal(se)
+	if err != nil {
+		return err
+	}
+	return ws.WriteMessage(websocket.TextMessage, buf)
+}
+
+// readReply reads the next reply of the server. A ServiceError or
+// ValidationError sent by the server is returned as the error.
+func readReply(conn clientConn) ([]byte, error) {
+	mt, buf, err := conn.ReadMessage()
+	if err != nil {
+		return nil, wsError(err)
+	}
+	if mt != websocket.TextMessage {
+		return buf, nil
+	}
+	var reply struct {
+		ServiceError
+		Violations []Violation `json:"violations"`
+	}
+	if err := json.Unmarshal(buf, &reply); err != nil {
+		return nil, fmt.Errorf("couldn't decode error of the service: %v", err)
+	}
+	// Wait for the close message that follows.
+	conn.ReadMessage()
+	if reply.Violations != nil {
+		return nil, &ValidationError{Violations: reply.Violations}
+	}
+	return nil, &reply.ServiceError
+}
+
+// Violation is a single constraint of a request that is not met.
+type Violation struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+// ValidationError is returned when a request to a service endpoint doesn't
+// meet the constraints of the endpoint. The handler is not called in that
+// case. The client receives the same error, with all violations, in a
+// message before the websocket is closed with wsInvalidCode.
+type ValidationError struct {
+	Violations []Violation `json:"violations"`
+}
+
+// validationPrefix starts the text of every ValidationError.
+const validationPrefix = "invalid request: "
+
+func (ve *ValidationError) Error() string {
+	strs := make([]string, len(ve.Violations))
+	for i, v := range ve.Violations {
+		strs[i] = v.Field + ": " + v.Reason
+	}
+	return validationPrefix + strings.Join(strs, "; ")
+}
+
+// parseValidationError returns the ValidationError that has str as text,
+// or nil if str is not the text of a ValidationError. It reads the close
+// message of the servers that send the violations only there, which is cut
+// if they don't fit.
+func parseValidationError(str string) *ValidationError {
+	if !strings.HasPrefix(str, validationPrefix) {
+		return nil
+	}
+	ve := &ValidationError{}
+	for _, v := range strings.Split(strings.TrimPrefix(str, validationPrefix), "; ") {
+		fr := strings.SplitN(v, ": ", 2)
+		if len(fr) != 2 {
+			fr = append(fr, "")
+		}
+		ve.Violations = append(ve.Violations, Violation{fr[0], fr[1]})
+	}
+	return ve
+}
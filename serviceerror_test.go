@@ -0,0 +1,74 @@
+package onet
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestServiceError(t *testing.T) {
+	se := NewServiceError(ErrorNotFound, false, "no block %d", 3)
+	require.Equal(t, "not found: no block 3", se.Error())
+	require.Equal(t, "code 42", ErrorCode(42).String())
+
+	require.True(t, IsRetryable(ErrServiceBusy))
+	require.True(t, IsRetryable(NewServiceError(ErrorUnavailable, true, "later")))
+	require.False(t, IsRetryable(se))
+	require.False(t, IsRetryable(errors.New("unavailable")))
+}
+
+func TestCloseText(t *testing.T) {
+	require.Equal(t, "short", closeText("short"))
+	require.Equal(t, maxCloseText, len(closeText(strings.Repeat("a", 200))))
+}
+
+func TestClient_ServiceError(t *testing.T) {
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	server := local.GenServers(1)[0]
+	sent := &ServiceError{
+		Code:      ErrorUnavailable,
+		Message:   strings.Repeat("too many requests, ", 10),
+		Retryable: true,
+		Detail:    []byte{1, 2, 3},
+	}
+	server.UseServiceMiddleware(func(next ServiceRequestHandler) ServiceRequestHandler {
+		return func(req *http.Request, service, path string, msg []byte) ([]byte, error) {
+			return nil, sent
+		}
+	})
+
+	client := NewClient(tSuite, serviceWebSocket)
+	err := client.SendProtobuf(server.ServerIdentity, &SimpleResponse{1}, nil)
+	se, ok := err.(*ServiceError)
+	require.True(t, ok, "wrong error: %v", err)
+	require.Equal(t, sent, se)
+	require.True(t, IsRetryable(err))
+}
+
+func TestClient_ValidationError(t *testing.T) {
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	server := local.GenServers(1)[0]
+	// Too many violations to fit in a close message.
+	sent := &ValidationError{}
+	for i := 0; i < 10; i++ {
+		sent.Violations = append(sent.Violations,
+			Violation{"Field" + strconv.Itoa(i), "must be at most 10"})
+	}
+	server.UseServiceMiddleware(func(next ServiceRequestHandler) ServiceRequestHandler {
+		return func(req *http.Request, service, path string, msg []byte) ([]byte, error) {
+			return nil, sent
+		}
+	})
+
+	client := NewClient(tSuite, serviceWebSocket)
+	err := client.SendProtobuf(server.ServerIdentity, &SimpleResponse{1}, nil)
+	ve, ok := err.(*ValidationError)
+	require.True(t, ok, "wrong error: %v", err)
+	require.Equal(t, sent, ve)
+}
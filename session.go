@@ -0,0 +1,173 @@
+// +build !js
+
+package onet
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/dedis/onet/log"
+	"github.com/dedis/protobuf"
+	"github.com/gorilla/websocket"
+)
+
+// ErrSessionUnauthorized is sent to the client of a session for a stream it
+// may not subscribe to.
+var ErrSessionUnauthorized = errors.New("not authorized to subscribe to the stream")
+
+// SessionAuthorizer returns whether the client of a session, which
+// connected with the request r, may subscribe to stream.
+type SessionAuthorizer func(r *http.Request, stream string) bool
+
+// SetSessionAuthorizer lets the clients of the session endpoint of the
+// service, at "/<service>/session", subscribe to the streams auth allows.
+// Without it, all subscriptions are refused. The path "session" is
+// reserved for this endpoint, a request type named "session" can't be sent
+// to the service.
+func (c *Context) SetSessionAuthorizer(auth SessionAuthorizer) {
+	h := &c.manager.streams
+	h.Lock()
+	defer h.Unlock()
+	if h.auths == nil {
+		h.auths = make(map[string]SessionAuthorizer)
+	}
+	h.auths[string(c.bucketName)] = auth
+}
+
+// sessionAuthorized returns whether the client of the session may
+// subscribe to stream.
+func (c *Context) sessionAuthorized(r *http.Request, stream string) bool {
+	h := &c.manager.streams
+	h.Lock()
+	auth := h.auths[string(c.bucketName)]
+	h.Unlock()
+	return auth != nil && auth(r, stream)
+}
+
+// sessionSub is a subscription of a session, forwarded by its own
+// go-routine.
+type sessionSub struct {
+	*Subscription
+	stream string
+}
+
+// session handles a persistent connection where the client subscribes to
+// the streams of the service, and the server pushes the events published
+// on them with Context.Publish. It returns the number of bytes sent once
+// the client disconnects.
+func (t wsHandler) session(ws *websocket.Conn, r *http.Request) int {
+	reqs := make(chan *SessionSubscribe)
+	gone := make(chan error, 1)
+	events := make(chan SessionEvent)
+	ended := make(chan *sessionSub)
+	done := make(chan bool)
+	subs := make(map[string]*sessionSub)
+	defer func() {
+		close(done)
+		for _, s := range subs {
+			s.Close()
+		}
+	}()
+
+	go func() {
+		for {
+			_, buf, err := ws.ReadMessage()
+			if err != nil {
+				gone <- err
+				return
+			}
+			req := &SessionSubscribe{}
+			if err := protobuf.Decode(buf, req); err != nil {
+				gone <- err
+				return
+			}
+			select {
+			case reqs <- req:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	tx := 0
+	send := func(ev SessionEvent) error {
+		buf, err := protobuf.Encode(&ev)
+		if err != nil {
+			return err
+		}
+		tx += len(buf)
+		return ws.WriteMessage(websocket.BinaryMessage, buf)
+	}
+	for {
+		var err error
+		select {
+		case req := <-reqs:
+			if old, ok := subs[req.Stream]; ok {
+				delete(subs, req.Stream)
+				old.Close()
+			}
+			if req.Unsubscribe {
+				continue
+			}
+			if !t.context.sessionAuthorized(r, req.Stream) {
+				log.Lvl2("Session of", r.RemoteAddr, "may not subscribe to", req.Stream)
+				err = send(SessionEvent{Stream: req.Stream,
+					Error: ErrSessionUnauthorized.Error()})
+				break
+			}
+			log.Lvl3("Session of", r.RemoteAddr, "subscribes to", req.Stream)
+			sub, serr := t.context.Subscribe(req.Stream, req.Cursor)
+			if serr != nil {
+				err = send(SessionEvent{Stream: req.Stream, Error: serr.Error()})
+				break
+			}
+			s := &sessionSub{sub, req.Stream}
+			subs[req.Stream] = s
+			go s.forward(events, ended, done)
+		case s := <-ended:
+			// Events has been closed by the hub, not by the session.
+			if subs[s.stream] == s {
+				delete(subs, s.stream)
+				err = send(SessionEvent{Stream: s.stream,
+					Error: "subscriber too slow"})
+			}
+		case ev := <-events:
+			err = send(ev)
+		case err := <-gone:
+			log.Lvl3("Session of", r.RemoteAddr, "closed:", err)
+			return tx
+		}
+		if err != nil {
+			log.Error(err)
+			return tx
+		}
+	}
+}
+
+// forward sends the backlog and the events of the subscription to the
+// session, until the subscription or the session is closed.
+func (s *sessionSub) forward(events chan<- SessionEvent, ended chan<- *sessionSub,
+	done <-chan bool) {
+	push := func(ev StreamEvent) bool {
+		select {
+		case events <- SessionEvent{Stream: s.stream, Cursor: ev.Cursor, Data: ev.Data}:
+			return true
+		case <-done:
+			return false
+		}
+	}
+	for _, ev := range s.Backlog {
+		if !push(ev) {
+			return
+		}
+	}
+	for ev := range s.Events {
+		if !push(ev) {
+			return
+		}
+	}
+	select {
+	case ended <- s:
+	case <-done:
+	}
+}
@@ -0,0 +1,103 @@
+package onet
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/dedis/onet/log"
+	"github.com/stretchr/testify/require"
+)
+
+const sessionServiceName = "sessionService"
+
+// onlyTx lets the sessions subscribe to the "tx" stream only.
+func onlyTx(r *http.Request, stream string) bool {
+	return stream == "tx"
+}
+
+func TestSession_Push(t *testing.T) {
+	var ctx *Context
+	_, err := RegisterNewService(sessionServiceName, func(c *Context) (Service, error) {
+		ctx = c
+		c.SetSessionAuthorizer(onlyTx)
+		return &slowService{}, nil
+	})
+	log.ErrFatal(err)
+	defer UnregisterService(sessionServiceName)
+
+	local := NewTCPTest(tSuite)
+	server := local.GenServers(1)[0]
+	defer local.CloseAll()
+
+	_, err = ctx.Publish("tx", &SimpleResponse{1})
+	require.Nil(t, err)
+
+	sess, err := NewClient(tSuite, sessionServiceName).Session(server.ServerIdentity)
+	require.Nil(t, err)
+	defer sess.Close()
+	require.Nil(t, sess.Subscribe("tx", 0))
+
+	// The backlog comes first, then the new events.
+	rep := &SimpleResponse{}
+	stream, cursor, err := sess.ReadMessage(rep)
+	require.Nil(t, err)
+	require.Equal(t, "tx", stream)
+	require.Equal(t, uint64(1), cursor)
+	require.Equal(t, 1, rep.Val)
+
+	_, err = ctx.Publish("tx", &SimpleResponse{2})
+	require.Nil(t, err)
+	_, cursor, err = sess.ReadMessage(rep)
+	require.Nil(t, err)
+	require.Equal(t, uint64(2), cursor)
+	require.Equal(t, 2, rep.Val)
+
+	// After unsubscribing, a new subscription resumes from the cursor.
+	require.Nil(t, sess.Unsubscribe("tx"))
+	_, err = ctx.Publish("tx", &SimpleResponse{3})
+	require.Nil(t, err)
+	require.Nil(t, sess.Subscribe("tx", cursor))
+	_, cursor, err = sess.ReadMessage(rep)
+	require.Nil(t, err)
+	require.Equal(t, uint64(3), cursor)
+	require.Equal(t, 3, rep.Val)
+
+	// Only the streams allowed by the service can be subscribed to.
+	_, err = ctx.Publish("secret", &SimpleResponse{4})
+	require.Nil(t, err)
+	require.Nil(t, sess.Subscribe("secret", 0))
+	ev, err := sess.Read()
+	require.Nil(t, err)
+	require.Equal(t, "secret", ev.Stream)
+	require.Equal(t, ErrSessionUnauthorized.Error(), ev.Error)
+}
+
+func TestSession_CursorExpired(t *testing.T) {
+	var ctx *Context
+	_, err := RegisterNewService(sessionServiceName, func(c *Context) (Service, error) {
+		ctx = c
+		c.SetStreamBacklog("tx", 1)
+		c.SetSessionAuthorizer(onlyTx)
+		return &slowService{}, nil
+	})
+	log.ErrFatal(err)
+	defer UnregisterService(sessionServiceName)
+
+	local := NewTCPTest(tSuite)
+	server := local.GenServers(1)[0]
+	defer local.CloseAll()
+
+	for i := 0; i < 3; i++ {
+		_, err = ctx.Publish("tx", &SimpleResponse{i})
+		require.Nil(t, err)
+	}
+
+	sess, err := NewClient(tSuite, sessionServiceName).Session(server.ServerIdentity)
+	require.Nil(t, err)
+	defer sess.Close()
+	require.Nil(t, sess.Subscribe("tx", 1))
+	ev, err := sess.Read()
+	require.Nil(t, err)
+	require.Equal(t, "tx", ev.Stream)
+	require.Equal(t, ErrCursorExpired.Error(), ev.Error)
+}
@@ -0,0 +1,53 @@
+// +build !js
+
+package onet
+
+import (
+	"bufio"
+	"errors"
+
+	"github.com/dedis/onet/network"
+)
+
+// newSharedRouter returns a router getting its connections from a Mux on
+// the address of e, and the Mux, whose other connections are for the
+// websocket. The servers connect over TLS with the ALPNProto, the websocket
+// clients with plain HTTP or TLS without it; on a plain TCP or Noise
+// address, all but the HTTP and TLS connections are for the router.
+func newSharedRouter(e *network.ServerIdentity, suite network.Suite) (*network.Router, *network.Mux, error) {
+	var match network.MuxMatcher
+	switch e.Address.ConnType() {
+	case network.TLS:
+		match = network.MatchALPN(network.ALPNProto)
+	case network.PlainTCP, network.Noise:
+		match = func(r *bufio.Reader) bool {
+			return !network.MatchHTTP(r) && !network.MatchTLS(r)
+		}
+	default:
+		return nil, nil, errors.New("can't share the port of " + e.Address.String())
+	}
+	global, err := network.GlobalBind(e.Address.NetworkAddress())
+	if err != nil {
+		return nil, nil, err
+	}
+	mux, err := network.ListenMux(global)
+	if err != nil {
+		return nil, nil, err
+	}
+	h, err := network.NewTCPHostWithListener(e, suite, mux.Listener(match))
+	if err != nil {
+		mux.Close()
+		return nil, nil, err
+	}
+	return network.NewRouter(e, h), mux, nil
+}
+
+// shareListener makes the websocket serve the connections of the mux not
+// taken by the router, instead of listening one port above the server.
+func (w *WebSocket) shareListener(mux *network.Mux) {
+	if w.server == nil {
+		return
+	}
+	w.listener = mux.Listener(network.MatchAny)
+	w.server.Server.Addr = mux.Addr().String()
+}
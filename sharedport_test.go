@@ -0,0 +1,56 @@
+package onet
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/dedis/kyber/util/key"
+	"github.com/dedis/onet/network"
+	"github.com/stretchr/testify/require"
+)
+
+// newSharedServer returns a started server with a TLS address and a shared
+// port.
+func newSharedServer(t *testing.T, dir string) *Server {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	addr := ln.Addr().String()
+	require.Nil(t, ln.Close())
+	kp := key.NewKeyPair(tSuite)
+	si := network.NewServerIdentity(kp.Public, network.NewAddress(network.TLS, addr))
+	si.SetPrivate(kp.Private)
+	c, err := NewServerTCPWithOptions(si, tSuite, ServerOptions{DBPath: dir, SharedPort: true})
+	require.Nil(t, err)
+	c.Start()
+	return c
+}
+
+func TestServer_SharedPort(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "sharedport")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmp)
+	s1 := newSharedServer(t, tmp)
+	defer s1.Close()
+	s2 := newSharedServer(t, tmp)
+	defer s2.Close()
+
+	_, err = s2.Ping(s1.ServerIdentity, 5*time.Second)
+	require.Nil(t, err)
+
+	cl := NewClient(tSuite, OnetServiceName)
+	cl.SetSharedPort(true)
+	defer cl.Close()
+	reply := &CheckConnectivityReply{}
+	ro := NewRoster([]*network.ServerIdentity{s1.ServerIdentity, s2.ServerIdentity})
+	require.Nil(t, cl.SendProtobuf(s1.ServerIdentity,
+		&CheckConnectivity{Roster: ro, Timeout: int64(5 * time.Second)}, reply))
+	require.Equal(t, "", reply.Errors[1])
+
+	si := network.NewServerIdentity(s1.ServerIdentity.Public,
+		network.NewAddress(network.Unix, "/tmp/onet-shared.sock"))
+	_, _, err = newSharedRouter(si, tSuite)
+	require.NotNil(t, err)
+}
@@ -9,6 +9,7 @@ import (
 
 	"errors"
 	"math"
+	"net/http"
 	"time"
 
 	"github.com/dedis/onet/log"
@@ -29,9 +30,11 @@ var simRange = ""
 var race = false
 var runWait = 180 * time.Second
 var experimentWait = 0 * time.Second
+var dashboardAddress = ""
+var dashboard *monitor.Dashboard
 
 func init() {
-	flag.StringVar(&platformDst, "platform", platformDst, "platform to deploy to [localhost,mininet,deterlab]")
+	flag.StringVar(&platformDst, "platform", platformDst, "platform to deploy to [localhost,mininet,deterlab,kubernetes,netem]")
 	flag.BoolVar(&nobuild, "nobuild", false, "Don't rebuild all helpers")
 	flag.BoolVar(&clean, "clean", false, "Only clean platform")
 	flag.StringVar(&build, "build", "", "List of packages to build")
@@ -41,6 +44,7 @@ func init() {
 	flag.StringVar(&simRange, "range", simRange, "Range of simulations to run. 0: or 3:4 or :4")
 	flag.DurationVar(&runWait, "runwait", runWait, "How long to wait for each simulation to finish - overwrites .toml-value")
 	flag.DurationVar(&experimentWait, "experimentwait", experimentWait, "How long to wait for the whole experiment to finish")
+	flag.StringVar(&dashboardAddress, "dashboard", dashboardAddress, "Address to serve the dashboard of the running simulation on, e.g. localhost:8080")
 	log.RegisterFlags()
 }
 
@@ -52,6 +56,13 @@ func startBuild() {
 		log.Fatal("Platform not recognized.", platformDst)
 	}
 	log.Lvl1("Deploying to", platformDst)
+	if dashboardAddress != "" {
+		dashboard = monitor.NewDashboard()
+		go func() {
+			log.Error("Dashboard stopped:", http.ListenAndServe(dashboardAddress, dashboard))
+		}()
+		log.Lvl1("Dashboard is at http://" + dashboardAddress)
+	}
 
 	simulations := flag.Args()
 	if len(simulations) == 0 {
@@ -118,25 +129,20 @@ func RunTests(name string, runconfigs []*platform.RunConfig) {
 	}
 
 	mkTestDir()
-	var f *os.File
 	args := os.O_CREATE | os.O_RDWR | os.O_TRUNC
 	// If a range is given, we only append
 	if simRange != "" {
 		args = os.O_CREATE | os.O_RDWR | os.O_APPEND
 	}
-	f, err := os.OpenFile(testFile(name), args, 0660)
-	if err != nil {
-		log.Fatal("error opening test file:", err)
-	}
-	defer func() {
-		if err := f.Close(); err != nil {
-			log.Error("Couln't close", f.Name())
-		}
-	}()
-	err = f.Sync()
-	if err != nil {
-		log.Fatal("error syncing test file:", err)
-	}
+	f := openTestFile(testFile(name), args)
+	defer closeTestFile(f)
+	// machine-readable outputs with percentiles and raw samples
+	fSummary := openTestFile(testFileExt(name, "_summary.csv"), args)
+	defer closeTestFile(fSummary)
+	fSamples := openTestFile(testFileExt(name, "_samples.csv"), args)
+	defer closeTestFile(fSamples)
+	fJSON := openTestFile(testFileExt(name, ".json"), args)
+	defer closeTestFile(fJSON)
 
 	start, stop := getStartStop(len(runconfigs))
 	for i, rc := range runconfigs {
@@ -163,20 +169,49 @@ func RunTests(name string, runconfigs []*platform.RunConfig) {
 		} else {
 			stats.WriteValues(f)
 		}
-		err = f.Sync()
-		if err != nil {
-			log.Fatal("error syncing data to test file:", err)
+		log.ErrFatal(stats.WriteSummaryCSV(fSummary, i == 0))
+		log.ErrFatal(stats.WriteSamplesCSV(fSamples, i == 0))
+		log.ErrFatal(stats.WriteJSON(fJSON, true))
+		for _, file := range []*os.File{f, fSummary, fSamples, fJSON} {
+			if err := file.Sync(); err != nil {
+				log.Fatal("error syncing data to test file:", err)
+			}
 		}
 	}
 }
 
+// openTestFile opens the file with the given flags, or stops the
+// simulation.
+func openTestFile(name string, flags int) *os.File {
+	f, err := os.OpenFile(name, flags, 0660)
+	if err != nil {
+		log.Fatal("error opening test file:", err)
+	}
+	if err = f.Sync(); err != nil {
+		log.Fatal("error syncing test file:", err)
+	}
+	return f
+}
+
+func closeTestFile(f *os.File) {
+	if err := f.Close(); err != nil {
+		log.Error("Couln't close", f.Name())
+	}
+}
+
 // RunTest a single test - takes a test-file as a string that will be copied
 // to the deterlab-server
 func RunTest(rc *platform.RunConfig) (*monitor.Stats, error) {
 	CheckHosts(rc)
 	rc.Delete("simulation")
+	if rc.Get("Seed") == "random" {
+		// Choose the seed here, so that it is recorded in the results.
+		rc.Put("Seed", strconv.FormatInt(time.Now().UnixNano(), 10))
+		log.Lvl1("Using seed", rc.Get("Seed"))
+	}
 	rs := monitor.NewStats(rc.Map(), "hosts", "bf")
 	monitor := monitor.NewMonitor(rs)
+	monitor.Dashboard = dashboard
 
 	if err := deployP.Deploy(rc); err != nil {
 		log.Error(err)
@@ -295,7 +330,13 @@ func mkTestDir() {
 }
 
 func testFile(name string) string {
-	return "test_data/" + name + ".csv"
+	return testFileExt(name, ".csv")
+}
+
+// testFileExt returns the path of the output file of the test with the
+// given suffix.
+func testFileExt(name, suffix string) string {
+	return "test_data/" + name + suffix
 }
 
 // returns a tuple of start and stop configurations to run
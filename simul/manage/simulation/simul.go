@@ -56,8 +56,8 @@ func (e *simulation) Setup(dir string, hosts []string) (
 func (e *simulation) Run(config *onet.SimulationConfig) error {
 	size := config.Tree.Size()
 	log.Lvl2("Size is:", size, "rounds:", e.Rounds)
-	for round := 0; round < e.Rounds; round++ {
-		log.Lvl1("Starting round", round)
+	for r := config.ResumeRound(); r < e.Rounds; r++ {
+		log.Lvl1("Starting round", r)
 		round := monitor.NewTimeMeasure("round")
 		p, err := config.Overlay.CreateProtocol("Count", config.Tree, onet.NilServiceID)
 		if err != nil {
@@ -70,6 +70,9 @@ func (e *simulation) Run(config *onet.SimulationConfig) error {
 			return errors.New("Didn't get " + strconv.Itoa(size) +
 				" children")
 		}
+		if err := config.Checkpoint(r + 1); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -0,0 +1,261 @@
+package monitor
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// dashboardPoints is the number of values kept per measure for the time
+// series of the dashboard. Once reached, every other value is dropped, so
+// that long runs are still shown from their start.
+const dashboardPoints = 512
+
+// roundMeasure is the measure the dashboard counts the rounds with, as
+// recorded by a TimeMeasure called "round".
+const roundMeasure = "round_wall"
+
+// Dashboard is a web page showing the progress of the simulation while it
+// runs: the rounds done, the resources and messages of every node as sent
+// by NodeMeasure, and the time series of the measures. It is an
+// http.Handler serving the page at / and its data as JSON at /data, and
+// shows the run of the Monitor it is given to.
+type Dashboard struct {
+	status   DashboardStatus
+	measures map[string]*DashboardMeasure
+	nodes    map[string]*DashboardNode
+	sync.Mutex
+}
+
+// DashboardStatus is the data shown by the dashboard.
+type DashboardStatus struct {
+	// Run holds the numeric fields of the run config
+	Run     map[string]int
+	Started time.Time
+	// Rounds is the number of rounds of the run, 0 if it is not known
+	Rounds     int
+	RoundsDone int
+	Nodes      []DashboardNode
+	Measures   []DashboardMeasure
+}
+
+// DashboardNode holds the latest values sent by the NodeMeasure of a node.
+type DashboardNode struct {
+	Node    string
+	Values  map[string]float64
+	Updated time.Time
+}
+
+// DashboardMeasure is the time series of a measure. The time of a point is
+// in seconds since the start of the run.
+type DashboardMeasure struct {
+	Name   string
+	Count  int
+	Last   float64
+	Avg    float64
+	Points [][2]float64
+	// step is the number of values between two points
+	step int
+	sum  float64
+}
+
+// NewDashboard returns a dashboard showing nothing until it is given to a
+// Monitor.
+func NewDashboard() *Dashboard {
+	d := &Dashboard{}
+	d.startRun(nil)
+	return d
+}
+
+// startRun clears the dashboard for the run with the given stats.
+func (d *Dashboard) startRun(s *Stats) {
+	d.Lock()
+	defer d.Unlock()
+	d.status = DashboardStatus{Run: map[string]int{}, Started: time.Now()}
+	if s != nil {
+		d.status.Run = s.Static()
+		d.status.Rounds = d.status.Run["rounds"]
+	}
+	d.measures = make(map[string]*DashboardMeasure)
+	d.nodes = make(map[string]*DashboardNode)
+}
+
+// update adds a measure received by the monitor.
+func (d *Dashboard) update(sm *singleMeasure) {
+	d.Lock()
+	defer d.Unlock()
+	now := time.Now()
+	if sm.Node != "" {
+		n := d.nodes[sm.Node]
+		if n == nil {
+			n = &DashboardNode{Node: sm.Node, Values: make(map[string]float64)}
+			d.nodes[sm.Node] = n
+		}
+		n.Values[sm.Name] = sm.Value
+		n.Updated = now
+		return
+	}
+	if sm.Name == roundMeasure {
+		d.status.RoundsDone++
+	}
+	m := d.measures[sm.Name]
+	if m == nil {
+		m = &DashboardMeasure{Name: sm.Name, step: 1}
+		d.measures[sm.Name] = m
+	}
+	m.Count++
+	m.Last = sm.Value
+	m.sum += sm.Value
+	m.Avg = m.sum / float64(m.Count)
+	if (m.Count-1)%m.step != 0 {
+		return
+	}
+	m.Points = append(m.Points,
+		[2]float64{now.Sub(d.status.Started).Seconds(), sm.Value})
+	if len(m.Points) >= dashboardPoints {
+		for i := 0; i < len(m.Points)/2; i++ {
+			m.Points[i] = m.Points[2*i]
+		}
+		m.Points = m.Points[:len(m.Points)/2]
+		m.step *= 2
+	}
+}
+
+// Status returns what the dashboard shows, with the nodes and measures
+// sorted by name.
+func (d *Dashboard) Status() DashboardStatus {
+	d.Lock()
+	defer d.Unlock()
+	st := d.status
+	st.Run = make(map[string]int, len(d.status.Run))
+	for k, v := range d.status.Run {
+		st.Run[k] = v
+	}
+	st.Nodes = []DashboardNode{}
+	for _, n := range d.nodes {
+		values := make(map[string]float64, len(n.Values))
+		for k, v := range n.Values {
+			values[k] = v
+		}
+		st.Nodes = append(st.Nodes, DashboardNode{n.Node, values, n.Updated})
+	}
+	sort.Slice(st.Nodes, func(i, j int) bool {
+		return st.Nodes[i].Node < st.Nodes[j].Node
+	})
+	st.Measures = []DashboardMeasure{}
+	for _, m := range d.measures {
+		mc := *m
+		mc.Points = append([][2]float64{}, m.Points...)
+		st.Measures = append(st.Measures, mc)
+	}
+	sort.Slice(st.Measures, func(i, j int) bool {
+		return st.Measures[i].Name < st.Measures[j].Name
+	})
+	return st
+}
+
+// ServeHTTP implements http.Handler.
+func (d *Dashboard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(dashboardPage))
+	case "/data":
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(d.Status()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// dashboardPage fetches /data every two seconds and draws it.
+const dashboardPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>onet simulation</title>
+<style>
+body { font-family: sans-serif; margin: 1em 2em; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+td, th { padding: 2px 10px; text-align: right; border-bottom: 1px solid #ddd; }
+td:first-child, th:first-child { text-align: left; }
+#progress { width: 400px; height: 16px; }
+svg { background: #f8f8f8; }
+polyline { fill: none; stroke: #36c; stroke-width: 1.5; }
+</style>
+</head>
+<body>
+<h2>Run</h2>
+<p id="run"></p>
+<p>Rounds: <progress id="progress"></progress> <span id="rounds"></span></p>
+<h2>Nodes</h2>
+<table id="nodes"></table>
+<h2>Measures</h2>
+<table id="measures"></table>
+<script>
+function fmt(v) {
+  return Math.abs(v) >= 1000 || v == Math.round(v) ? Math.round(v).toString() : v.toPrecision(4);
+}
+function row(cells, tag) {
+  var tr = document.createElement("tr");
+  cells.forEach(function(c) {
+    var td = document.createElement(tag || "td");
+    if (c instanceof Node) { td.appendChild(c); } else { td.textContent = c; }
+    tr.appendChild(td);
+  });
+  return tr;
+}
+function chart(points) {
+  var ns = "http://www.w3.org/2000/svg", w = 300, h = 40;
+  var svg = document.createElementNS(ns, "svg");
+  svg.setAttribute("width", w);
+  svg.setAttribute("height", h);
+  if (points.length == 0) { return svg; }
+  var tmax = points[points.length - 1][0] || 1;
+  var vmin = Math.min.apply(null, points.map(function(p) { return p[1]; }));
+  var vmax = Math.max.apply(null, points.map(function(p) { return p[1]; }));
+  var line = document.createElementNS(ns, "polyline");
+  line.setAttribute("points", points.map(function(p) {
+    return (p[0] / tmax * w) + "," + (h - 2 - (p[1] - vmin) / ((vmax - vmin) || 1) * (h - 4));
+  }).join(" "));
+  svg.appendChild(line);
+  return svg;
+}
+function update() {
+  fetch("data").then(function(r) { return r.json(); }).then(function(st) {
+    document.getElementById("run").textContent = Object.keys(st.Run).sort().map(function(k) {
+      return k + "=" + st.Run[k];
+    }).join(", ") + " - started " + new Date(st.Started).toLocaleTimeString();
+    var progress = document.getElementById("progress");
+    if (st.Rounds > 0) {
+      progress.max = st.Rounds;
+      progress.value = st.RoundsDone;
+    } else {
+      progress.removeAttribute("value");
+    }
+    document.getElementById("rounds").textContent = st.RoundsDone + (st.Rounds > 0 ? " / " + st.Rounds : "");
+    var nodes = document.getElementById("nodes");
+    nodes.innerHTML = "";
+    nodes.appendChild(row(["Node", "CPU", "Memory [MB]", "Msgs in", "Msgs out", "Updated"], "th"));
+    st.Nodes.forEach(function(n) {
+      var v = n.Values;
+      nodes.appendChild(row([n.Node, fmt(v.cpu || 0), fmt((v.memory || 0) / 1e6),
+        fmt(v.msgs_in || 0), fmt(v.msgs_out || 0), new Date(n.Updated).toLocaleTimeString()]));
+    });
+    var measures = document.getElementById("measures");
+    measures.innerHTML = "";
+    measures.appendChild(row(["Measure", "Count", "Last", "Avg", "Over time"], "th"));
+    st.Measures.forEach(function(m) {
+      measures.appendChild(row([m.Name, m.Count, fmt(m.Last), fmt(m.Avg), chart(m.Points || [])]));
+    });
+  }).catch(function() {}).then(function() { setTimeout(update, 2000); });
+}
+update();
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,104 @@
+package monitor
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDashboard_update(t *testing.T) {
+	d := NewDashboard()
+	d.startRun(NewStats(map[string]string{"hosts": "4", "rounds": "10"}))
+	for i := 0; i < 3; i++ {
+		d.update(newSingleMeasure(roundMeasure, float64(i)))
+	}
+	d.update(&singleMeasure{Name: "cpu", Value: 0.5, Node: "10.0.0.2"})
+	d.update(&singleMeasure{Name: "cpu", Value: 0.25, Node: "10.0.0.1"})
+
+	st := d.Status()
+	require.Equal(t, 4, st.Run["hosts"])
+	require.Equal(t, 10, st.Rounds)
+	require.Equal(t, 3, st.RoundsDone)
+	require.Equal(t, 2, len(st.Nodes))
+	require.Equal(t, "10.0.0.1", st.Nodes[0].Node)
+	require.Equal(t, 0.25, st.Nodes[0].Values["cpu"])
+	require.Equal(t, 1, len(st.Measures))
+	m := st.Measures[0]
+	require.Equal(t, 3, m.Count)
+	require.Equal(t, 2.0, m.Last)
+	require.Equal(t, 1.0, m.Avg)
+	require.Equal(t, 3, len(m.Points))
+
+	d.startRun(nil)
+	require.Equal(t, 0, len(d.Status().Measures))
+}
+
+func TestDashboard_points(t *testing.T) {
+	d := NewDashboard()
+	n := 3 * dashboardPoints
+	for i := 0; i < n; i++ {
+		d.update(newSingleMeasure("setup", float64(i)))
+	}
+	m := d.Status().Measures[0]
+	require.Equal(t, n, m.Count)
+	require.True(t, len(m.Points) < dashboardPoints)
+	require.True(t, len(m.Points) >= dashboardPoints/4)
+	require.Equal(t, 0.0, m.Points[0][1])
+	// The points are still evenly spread over all values.
+	step := m.Points[1][1] - m.Points[0][1]
+	for i := 1; i < len(m.Points); i++ {
+		require.Equal(t, step, m.Points[i][1]-m.Points[i-1][1])
+	}
+}
+
+func TestDashboard_ServeHTTP(t *testing.T) {
+	d := NewDashboard()
+	d.update(newSingleMeasure("setup", 1))
+
+	w := httptest.NewRecorder()
+	d.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	require.Equal(t, 200, w.Code)
+	require.True(t, strings.Contains(w.Body.String(), "<html>"))
+
+	w = httptest.NewRecorder()
+	d.ServeHTTP(w, httptest.NewRequest("GET", "/data", nil))
+	require.Equal(t, 200, w.Code)
+	var st DashboardStatus
+	require.Nil(t, json.Unmarshal(w.Body.Bytes(), &st))
+	require.Equal(t, "setup", st.Measures[0].Name)
+
+	w = httptest.NewRecorder()
+	d.ServeHTTP(w, httptest.NewRequest("GET", "/other", nil))
+	require.Equal(t, 404, w.Code)
+}
+
+func TestDashboard_Monitor(t *testing.T) {
+	stat := NewStats(map[string]string{"servers": "1"})
+	mon := NewMonitor(stat)
+	mon.SinkPort = 0
+	mon.Dashboard = NewDashboard()
+	go mon.Listen()
+	port := <-mon.sinkPortChan
+	require.Nil(t, ConnectSink("localhost:"+strconv.Itoa(int(port))))
+
+	RecordSingleMeasure("setup", 3)
+	NewNodeMeasure("node1", func() (uint64, uint64) { return 5, 7 }).Record()
+	EndAndCleanup()
+	for i := 0; i < 50 && len(mon.Dashboard.Status().Nodes) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	st := mon.Dashboard.Status()
+	require.Equal(t, 1, len(st.Nodes))
+	require.Equal(t, 5.0, st.Nodes[0].Values["msgs_in"])
+	require.Equal(t, 7.0, st.Nodes[0].Values["msgs_out"])
+	require.True(t, st.Nodes[0].Values["memory"] > 0)
+	// The measures of the nodes are not part of the statistics.
+	require.NotNil(t, stat.Value("setup"))
+	require.Nil(t, stat.Value("msgs_in"))
+}
@@ -0,0 +1,212 @@
+package monitor
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/dedis/onet/log"
+	"github.com/montanaflynn/stats"
+)
+
+// This file holds the machine-readable output of the stats: a summary of
+// every measurement with its percentiles, and the raw samples, as CSV or
+// JSON.
+
+// Percentiles are the percentiles given in the summary of a Value.
+var Percentiles = []float64{50, 95, 99}
+
+// Summary holds the statistics of a Value, and optionally its samples.
+type Summary struct {
+	Name        string
+	N           int
+	Min         float64
+	Max         float64
+	Avg         float64
+	Sum         float64
+	Dev         float64
+	Percentiles map[string]float64
+	Samples     []float64 `json:",omitempty"`
+}
+
+// Export holds the static fields of a run and the summary of its
+// measurements.
+type Export struct {
+	Static   map[string]int
+	Measures []Summary
+}
+
+// Samples returns a copy of the values stored.
+func (t *Value) Samples() []float64 {
+	t.Lock()
+	defer t.Unlock()
+	return append([]float64{}, t.store...)
+}
+
+// Percentile returns the nearest-rank percentile of the values stored,
+// 0 < perc <= 100. It returns NaN if there are no values.
+func (t *Value) Percentile(perc float64) float64 {
+	t.Lock()
+	defer t.Unlock()
+	p, err := stats.PercentileNearestRank(t.store, perc)
+	if err != nil {
+		log.Lvl3("Monitor: no percentile", perc, "for", t.name, ":", err)
+		return math.NaN()
+	}
+	return p
+}
+
+// Summary returns the statistics of the values stored. Collect must have
+// been called before. If samples is true, the values themselves are
+// included. The percentiles are missing if there are no values, and the
+// deviation of a single value is 0, so that the summary can be written as
+// JSON.
+func (t *Value) Summary(samples bool) Summary {
+	sum := Summary{
+		Name:        t.name,
+		N:           len(t.Samples()),
+		Min:         t.Min(),
+		Max:         t.Max(),
+		Avg:         t.Avg(),
+		Sum:         t.Sum(),
+		Dev:         t.Dev(),
+		Percentiles: make(map[string]float64),
+	}
+	if math.IsNaN(sum.Dev) {
+		sum.Dev = 0
+	}
+	if sum.N > 0 {
+		for _, p := range Percentiles {
+			sum.Percentiles[percentileName(p)] = t.Percentile(p)
+		}
+	}
+	if samples {
+		sum.Samples = t.Samples()
+	}
+	return sum
+}
+
+// percentileName returns the name of the column of the percentile p, like
+// "p95".
+func percentileName(p float64) string {
+	return "p" + strconv.FormatFloat(p, 'f', -1, 64)
+}
+
+// Export returns the static fields and the summary of all the measurements,
+// ordered by name.
+func (s *Stats) Export(samples bool) Export {
+	s.Collect()
+	s.Lock()
+	defer s.Unlock()
+	e := Export{Static: make(map[string]int)}
+	for _, k := range s.staticKeys {
+		if v, ok := s.static[k]; ok {
+			e.Static[k] = v
+		}
+	}
+	for _, k := range s.keys {
+		e.Measures = append(e.Measures, s.values[k].Summary(samples))
+	}
+	return e
+}
+
+// WriteJSON writes the export of the stats as one line of JSON, so that
+// the stats of consecutive runs can be appended to the same file.
+func (s *Stats) WriteJSON(w io.Writer, samples bool) error {
+	buf, err := json.Marshal(s.Export(samples))
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(buf, '\n'))
+	return err
+}
+
+// WriteSummaryCSV writes one line per measurement with the static fields,
+// the name of the measurement, the number of samples, min, max, avg, sum,
+// dev and the percentiles. If header is true, the names of the columns are
+// written first.
+func (s *Stats) WriteSummaryCSV(w io.Writer, header bool) error {
+	e := s.Export(false)
+	statics := s.staticFields()
+	cw := csv.NewWriter(w)
+	if header {
+		fields := append(statics, "measure", "n", "min", "max", "avg", "sum", "dev")
+		for _, p := range Percentiles {
+			fields = append(fields, percentileName(p))
+		}
+		if err := cw.Write(fields); err != nil {
+			return err
+		}
+	}
+	for _, m := range e.Measures {
+		row := append(staticValues(e, statics), m.Name, strconv.Itoa(m.N))
+		for _, f := range []float64{m.Min, m.Max, m.Avg, m.Sum, m.Dev} {
+			row = append(row, formatFloat(f))
+		}
+		for _, p := range Percentiles {
+			if v, ok := m.Percentiles[percentileName(p)]; ok {
+				row = append(row, formatFloat(v))
+			} else {
+				row = append(row, "NaN")
+			}
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteSamplesCSV writes one line per sample with the static fields, the
+// name of the measurement, the index of the sample and its value. If header
+// is true, the names of the columns are written first.
+func (s *Stats) WriteSamplesCSV(w io.Writer, header bool) error {
+	e := s.Export(true)
+	statics := s.staticFields()
+	cw := csv.NewWriter(w)
+	if header {
+		if err := cw.Write(append(statics, "measure", "sample", "value")); err != nil {
+			return err
+		}
+	}
+	for _, m := range e.Measures {
+		for i, v := range m.Samples {
+			row := append(staticValues(e, statics), m.Name, strconv.Itoa(i),
+				formatFloat(v))
+			if err := cw.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// staticFields returns the names of the static fields that have a value.
+func (s *Stats) staticFields() []string {
+	s.Lock()
+	defer s.Unlock()
+	var fields []string
+	for _, k := range s.staticKeys {
+		if _, ok := s.static[k]; ok {
+			fields = append(fields, k)
+		}
+	}
+	return fields
+}
+
+func staticValues(e Export, fields []string) []string {
+	values := make([]string, len(fields))
+	for i, f := range fields {
+		values[i] = fmt.Sprintf("%d", e.Static[f])
+	}
+	return values
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
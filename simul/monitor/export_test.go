@@ -0,0 +1,74 @@
+package monitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newExportStats() *Stats {
+	s := NewStats(map[string]string{"hosts": "2", "bf": "3"}, "hosts", "bf")
+	for i := 1; i <= 100; i++ {
+		s.Update(newSingleMeasure("round", float64(i)))
+	}
+	s.Update(newSingleMeasure("setup", 5))
+	return s
+}
+
+func TestValue_Summary(t *testing.T) {
+	v := NewValue("test")
+	for i := 1; i <= 100; i++ {
+		v.Store(float64(i))
+	}
+	v.Collect()
+	sum := v.Summary(false)
+	require.Equal(t, 100, sum.N)
+	require.Equal(t, 50.0, sum.Percentiles["p50"])
+	require.Equal(t, 95.0, sum.Percentiles["p95"])
+	require.Equal(t, 99.0, sum.Percentiles["p99"])
+	require.Nil(t, sum.Samples)
+	require.Equal(t, 100, len(v.Summary(true).Samples))
+
+	// Collecting again must give the same results.
+	v.Collect()
+	require.Equal(t, sum, v.Summary(false))
+
+	empty := NewValue("empty")
+	empty.Collect()
+	require.Equal(t, 0, len(empty.Summary(false).Percentiles))
+}
+
+func TestStats_WriteJSON(t *testing.T) {
+	buf := &bytes.Buffer{}
+	require.Nil(t, newExportStats().WriteJSON(buf, true))
+	require.Equal(t, 1, strings.Count(buf.String(), "\n"))
+
+	var e Export
+	require.Nil(t, json.Unmarshal(buf.Bytes(), &e))
+	require.Equal(t, map[string]int{"hosts": 2, "bf": 3}, e.Static)
+	require.Equal(t, 2, len(e.Measures))
+	require.Equal(t, "round", e.Measures[0].Name)
+	require.Equal(t, 100, len(e.Measures[0].Samples))
+	require.Equal(t, 0.0, e.Measures[1].Dev)
+}
+
+func TestStats_WriteCSV(t *testing.T) {
+	s := newExportStats()
+	buf := &bytes.Buffer{}
+	require.Nil(t, s.WriteSummaryCSV(buf, true))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Equal(t, 3, len(lines))
+	require.Equal(t, "hosts,bf,measure,n,min,max,avg,sum,dev,p50,p95,p99", lines[0])
+	require.True(t, strings.HasPrefix(lines[1], "2,3,round,100,1,100,50.5,5050,"))
+	require.True(t, strings.HasSuffix(lines[1], ",50,95,99"))
+
+	buf.Reset()
+	require.Nil(t, s.WriteSamplesCSV(buf, false))
+	lines = strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Equal(t, 101, len(lines))
+	require.Equal(t, "2,3,round,0,1", lines[0])
+	require.Equal(t, "2,3,setup,0,5", lines[100])
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"runtime"
 	"time"
 
 	"sync"
@@ -47,6 +48,9 @@ type Measure interface {
 type singleMeasure struct {
 	Name  string
 	Value float64
+	// Node is set for the measures of a NodeMeasure, which only go to the
+	// dashboard
+	Node string `json:",omitempty"`
 }
 
 // TimeMeasure represents a measure regarding time: It includes the wallclock
@@ -191,6 +195,68 @@ func (cm *CounterIOMeasure) Record() {
 	cm.baseTx = bTx
 }
 
+// NodeMeasure sends the CPU and memory used by this process and the number
+// of messages of its servers to the monitor. Contrary to the other measures,
+// they are only shown by the Dashboard and are not part of the statistics.
+type NodeMeasure struct {
+	node     string
+	messages func() (in, out uint64)
+	lastCPU  float64
+	lastWall time.Time
+}
+
+// NewNodeMeasure returns a NodeMeasure for the given node. messages returns
+// the number of messages received and sent so far, it can be nil.
+func NewNodeMeasure(node string, messages func() (in, out uint64)) *NodeMeasure {
+	nm := &NodeMeasure{node: node, messages: messages, lastWall: time.Now()}
+	sys, usr := getRTime()
+	nm.lastCPU = sys + usr
+	return nm
+}
+
+// Record sends the following values of the node:
+//
+// - cpu: the CPU used since the last Record, 1 being one core
+//
+// - memory: the bytes obtained from the system
+//
+// - msgs_in and msgs_out: the number of messages received and sent
+//
+// As it is meant to be called periodically, nothing is sent if the sink
+// isn't connected.
+func (nm *NodeMeasure) Record() {
+	global.Lock()
+	connected := global.connection != nil
+	global.Unlock()
+	if !connected {
+		return
+	}
+	sys, usr := getRTime()
+	now := time.Now()
+	cpu := 0.0
+	if wall := now.Sub(nm.lastWall).Seconds(); wall > 0 {
+		cpu = (sys + usr - nm.lastCPU) / wall
+	}
+	nm.lastCPU, nm.lastWall = sys+usr, now
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	values := []*singleMeasure{
+		{Name: "cpu", Value: cpu},
+		{Name: "memory", Value: float64(ms.Sys)},
+	}
+	if nm.messages != nil {
+		in, out := nm.messages()
+		values = append(values, &singleMeasure{Name: "msgs_in", Value: float64(in)},
+			&singleMeasure{Name: "msgs_out", Value: float64(out)})
+	}
+	for _, v := range values {
+		v.Node = nm.node
+		if err := send(v); err != nil {
+			log.Lvl2("Couldn't send node measure", v.Name, ":", err)
+		}
+	}
+}
+
 // Send transmits the given struct over the network.
 func send(v interface{}) error {
 	global.Lock()
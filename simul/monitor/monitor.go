@@ -59,6 +59,9 @@ type Monitor struct {
 
 	SinkPort     uint16
 	sinkPortChan chan uint16
+
+	// Dashboard, if set, shows the measures while the simulation runs
+	Dashboard *Dashboard
 }
 
 // NewMonitor returns a new monitor given the stats
@@ -92,6 +95,9 @@ func (m *Monitor) Listen() error {
 	m.listener = ln
 	m.listenerLock.Unlock()
 	log.Lvl2("Monitor listening for stats on", Sink, ":", m.SinkPort)
+	if m.Dashboard != nil {
+		m.Dashboard.startRun(m.stats)
+	}
 	finished := false
 	go func() {
 		for {
@@ -204,6 +210,12 @@ func (m *Monitor) handleConnection(conn net.Conn) {
 // updateMeasures will add that specific measure to the global stats
 // in a concurrently safe manner
 func (m *Monitor) update(meas *singleMeasure) {
-	// updating
+	if m.Dashboard != nil {
+		m.Dashboard.update(meas)
+	}
+	// the measures of the nodes are only for the dashboard
+	if meas.Node != "" {
+		return
+	}
 	m.stats.Update(meas)
 }
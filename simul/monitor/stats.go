@@ -305,6 +305,17 @@ func (s *Stats) String() string {
 	return fmt.Sprintf("{Stats: %s}", str)
 }
 
+// Static returns the fields of the run config the stats were created with.
+func (s *Stats) Static() map[string]int {
+	s.Lock()
+	defer s.Unlock()
+	static := make(map[string]int, len(s.static))
+	for k, v := range s.static {
+		static[k] = v
+	}
+	return static
+}
+
 // Read a config file and fills up some fields for Stats struct
 func (s *Stats) readRunConfig(rc map[string]string, defaults ...string) {
 	// First find the defaults keys
@@ -370,6 +381,8 @@ type Value struct {
 
 	// Store where are kept the values
 	store []float64
+	// filtered is set once the DataFilter has been applied to the store
+	filtered bool
 	sync.Mutex
 }
 
@@ -387,6 +400,7 @@ func (t *Value) Store(newTime float64) {
 	t.Lock()
 	defer t.Unlock()
 	t.store = append(t.store, newTime)
+	t.filtered = false
 }
 
 // Collect will collect all float64 stored in the store's Value and will compute
@@ -398,12 +412,13 @@ func (t *Value) Collect() {
 	// optimized).
 	// streaming dev algo taken from http://www.johndcook.com/blog/standard_deviation/
 	t.sum = 0
+	t.n = 0
 	for _, newTime := range t.store {
 		// nothings takes 0 ms to complete, so we know it's the first time
 		if t.min > newTime || t.n == 0 {
 			t.min = newTime
 		}
-		if t.max < newTime {
+		if t.max < newTime || t.n == 0 {
 			t.max = newTime
 		}
 
@@ -423,11 +438,16 @@ func (t *Value) Collect() {
 	}
 }
 
-// Filter outs its Values
+// Filter outs its Values. The values are only filtered once, so that
+// collecting them again doesn't remove more values.
 func (t *Value) Filter(filt DataFilter) {
 	t.Lock()
 	defer t.Unlock()
+	if t.filtered {
+		return
+	}
 	t.store = filt.Filter(t.name, t.store)
+	t.filtered = true
 }
 
 // AverageValue will create a Value averaging all Values given
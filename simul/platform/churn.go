@@ -0,0 +1,182 @@
+package platform
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+	"github.com/dedis/onet/simul/monitor"
+)
+
+// churnRestartDelay is the time given to the restarted servers to be up
+// before the simulation is closed.
+const churnRestartDelay = 2 * time.Second
+
+// churnEvent kills a fraction of the nodes at Kill and restarts them at
+// Restart, both counted from the start of the simulation.
+type churnEvent struct {
+	Kill     time.Duration
+	Restart  time.Duration
+	Fraction float64
+}
+
+// parseChurn reads the Churn parameter of a simulation: a comma-separated
+// list of events of the form "kill-restart:percent", e.g.
+// "10s-30s:20%, 1m-1m30s:50%" kills 20% of the nodes after 10 seconds and
+// restarts them 20 seconds later, then kills half of the nodes after a
+// minute.
+func parseChurn(s string) ([]churnEvent, error) {
+	var events []churnEvent
+	for _, e := range strings.Split(s, ",") {
+		e = strings.TrimSpace(e)
+		if e == "" {
+			continue
+		}
+		sl := strings.SplitN(e, ":", 2)
+		times := strings.SplitN(sl[0], "-", 2)
+		if len(sl) != 2 || len(times) != 2 {
+			return nil, fmt.Errorf("churn event %q is not kill-restart:percent", e)
+		}
+		var ce churnEvent
+		var err error
+		if ce.Kill, err = time.ParseDuration(strings.TrimSpace(times[0])); err != nil {
+			return nil, err
+		}
+		if ce.Restart, err = time.ParseDuration(strings.TrimSpace(times[1])); err != nil {
+			return nil, err
+		}
+		if ce.Restart <= ce.Kill {
+			return nil, fmt.Errorf("churn event %q restarts before it kills", e)
+		}
+		pct, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(sl[1]), "%"), 64)
+		if err != nil {
+			return nil, err
+		}
+		if pct <= 0 || pct > 100 {
+			return nil, fmt.Errorf("churn event %q: percent out of range", e)
+		}
+		ce.Fraction = pct / 100
+		events = append(events, ce)
+	}
+	if len(events) == 0 {
+		return nil, errors.New("no churn events")
+	}
+	return events, nil
+}
+
+// victims returns the nodes killed by the event with the given index. Every
+// process of the simulation finds the same nodes, as they only depend on
+// the roster and the seed. The root is never killed, as it runs the
+// simulation.
+func (ce churnEvent) victims(ro *onet.Roster, root *network.ServerIdentity,
+	seed int64, index int) []*network.ServerIdentity {
+	var nodes []*network.ServerIdentity
+	for _, si := range ro.List {
+		if !si.ID.Equal(root.ID) {
+			nodes = append(nodes, si)
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Address < nodes[j].Address
+	})
+	n := int(float64(len(nodes))*ce.Fraction + 0.5)
+	rnd := rand.New(rand.NewSource(seed + int64(index)))
+	var victims []*network.ServerIdentity
+	for _, i := range rnd.Perm(len(nodes))[:n] {
+		victims = append(victims, nodes[i])
+	}
+	return victims
+}
+
+// lastRestart returns the time of the last restart of the events.
+func lastRestart(events []churnEvent) time.Duration {
+	var last time.Duration
+	for _, ce := range events {
+		if ce.Restart > last {
+			last = ce.Restart
+		}
+	}
+	return last
+}
+
+// churner kills and restarts the servers of this process following the
+// churn events.
+type churner struct {
+	events []churnEvent
+	seed   int64
+	roster *onet.Roster
+	root   *network.ServerIdentity
+	// nodes are the servers of this process and their simulation
+	nodes map[network.ServerIdentityID]*churnNode
+	// servers counts the running servers, so that the process only ends
+	// when the restarted servers are closed
+	servers *sync.WaitGroup
+	once    sync.Once
+	sync.Mutex
+}
+
+type churnNode struct {
+	sc  *onet.SimulationConfig
+	sim onet.Simulation
+}
+
+// start schedules the events. It is called when the simulation starts, and
+// only does something the first time.
+func (c *churner) start() {
+	c.once.Do(func() {
+		for i, ce := range c.events {
+			var local []*churnNode
+			for _, si := range ce.victims(c.roster, c.root, c.seed, i) {
+				if n, ok := c.nodes[si.ID]; ok {
+					local = append(local, n)
+				}
+			}
+			if len(local) == 0 {
+				continue
+			}
+			log.Lvlf2("Churn event %d kills %d local nodes at %s and restarts them at %s",
+				i, len(local), ce.Kill, ce.Restart)
+			time.AfterFunc(ce.Kill, func() { c.kill(local) })
+			time.AfterFunc(ce.Restart, func() { c.restart(local) })
+		}
+	})
+}
+
+func (c *churner) kill(nodes []*churnNode) {
+	c.Lock()
+	defer c.Unlock()
+	for _, n := range nodes {
+		log.Lvl2("Churn kills", n.sc.Server.ServerIdentity.Address)
+		// The restarted server will be waited for instead.
+		c.servers.Add(1)
+		if err := n.sc.Server.Close(); err != nil {
+			log.Error("Couldn't close server:", err)
+		}
+	}
+	monitor.RecordSingleMeasure("churn_killed", float64(len(nodes)))
+}
+
+func (c *churner) restart(nodes []*churnNode) {
+	c.Lock()
+	defer c.Unlock()
+	for _, n := range nodes {
+		log.Lvl2("Churn restarts", n.sc.Server.ServerIdentity.Address)
+		n.sc.ReplaceServer()
+		go func(s *onet.Server) {
+			defer c.servers.Done()
+			s.Start()
+		}(n.sc.Server)
+		if err := n.sim.Node(n.sc); err != nil {
+			log.Error("Couldn't set up restarted node:", err)
+		}
+	}
+	monitor.RecordSingleMeasure("churn_restarted", float64(len(nodes)))
+}
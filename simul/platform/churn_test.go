@@ -0,0 +1,50 @@
+package platform
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/network"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/satori/go.uuid.v1"
+)
+
+func TestParseChurn(t *testing.T) {
+	events, err := parseChurn("10s-30s:20%, 1m-1m30s:50")
+	require.Nil(t, err)
+	require.Equal(t, []churnEvent{
+		{10 * time.Second, 30 * time.Second, 0.2},
+		{time.Minute, 90 * time.Second, 0.5},
+	}, events)
+	require.Equal(t, 90*time.Second, lastRestart(events))
+
+	for _, bad := range []string{"", "10s:20%", "10s-30s", "30s-10s:20%",
+		"10s-30s:0%", "10s-30s:120%", "ten-30s:20%"} {
+		_, err := parseChurn(bad)
+		require.NotNil(t, err, bad)
+	}
+}
+
+func TestChurnEvent_Victims(t *testing.T) {
+	ro := &onet.Roster{}
+	for i := 0; i < 11; i++ {
+		addr := network.NewAddress(network.TLS, "10.0.0.1:"+strconv.Itoa(2000+i))
+		si := network.NewServerIdentity(nil, addr)
+		si.ID = network.ServerIdentityID(uuid.NewV5(uuid.NamespaceURL, addr.String()))
+		ro.List = append(ro.List, si)
+	}
+	root := ro.List[0]
+	ce := churnEvent{Fraction: 0.3}
+	victims := ce.victims(ro, root, 1, 0)
+	require.Equal(t, 3, len(victims))
+	for _, v := range victims {
+		require.False(t, v.ID.Equal(root.ID))
+	}
+	// Every process finds the same victims.
+	require.Equal(t, victims, ce.victims(ro, root, 1, 0))
+
+	ce.Fraction = 1
+	require.Equal(t, 10, len(ce.victims(ro, root, 1, 1)))
+}
@@ -0,0 +1,377 @@
+package platform
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/app"
+	"github.com/dedis/onet/log"
+)
+
+// Kubernetes runs the simulation in a cluster. Every run builds an image
+// with the simulation-binary and its configuration, and starts one pod per
+// server as an indexed Job. The pods find each other through a headless
+// Service and send their measures to the monitor of this machine, so
+// MonitorHost must be reachable from the cluster.
+//
+// The following variables of the .toml-file configure the platform:
+//
+//  - Image - repository the images are pushed to, e.g. registry.local/simul
+//  - MonitorHost - address of this machine as seen from the pods
+//  - Namespace - namespace of the runs, deleted by Cleanup (default: onet-simul)
+//  - Context - context of kubectl to use (default: the current one)
+//  - BaseImage - image the simulation-binary is added to (default: debian:stable-slim)
+type Kubernetes struct {
+	// The simulation to run
+	Simulation string
+	// Number of pods
+	Servers int
+	// Suite used for the simulation
+	Suite string
+	// Debug level of the pods
+	Debug int
+	// Time to wait for the Job to end
+	RunWait time.Duration
+	// PreScript is run in each pod before the simulation is started
+	PreScript string
+
+	// Image is the repository the images of the runs are pushed to
+	Image string
+	// BaseImage is the image the simulation-binary is added to
+	BaseImage string
+	// Namespace holds the resources of the runs
+	Namespace string
+	// Context of kubectl, empty for the current one
+	Context string
+	// MonitorHost is the address the pods connect to for the monitor
+	MonitorHost string
+	// Port of the monitor
+	MonitorPort int
+
+	// Where the simulation-binary is built
+	buildDir string
+	// Where the image of a run is assembled
+	deployDir string
+	// run counts the runs, so that every run has its own resources
+	run int
+	// name of the Job and Service of the current run
+	name string
+	// image of the current run
+	image string
+	// started is true if the Job of the current run is applied
+	started bool
+	// done receives the end of the Job
+	done chan error
+}
+
+// kubernetesManifest holds the resources of a run: the namespace, a
+// headless Service giving a DNS-name to every pod, and the Job starting the
+// simulation-binary in the pods. The index of a pod is in the environment
+// variable JOB_COMPLETION_INDEX, and its hostname is the name of the Job
+// followed by the index.
+var kubernetesManifest = template.Must(template.New("kubernetes").Parse(`apiVersion: v1
+kind: Namespace
+metadata:
+  name: {{.Namespace}}
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: {{.Name}}
+  namespace: {{.Namespace}}
+  labels:
+    run: {{.Name}}
+spec:
+  clusterIP: None
+  publishNotReadyAddresses: true
+  selector:
+    run: {{.Name}}
+---
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: {{.Name}}
+  namespace: {{.Namespace}}
+  labels:
+    run: {{.Name}}
+spec:
+  completions: {{.Servers}}
+  parallelism: {{.Servers}}
+  completionMode: Indexed
+  backoffLimit: 0
+  template:
+    metadata:
+      labels:
+        run: {{.Name}}
+    spec:
+      subdomain: {{.Name}}
+      restartPolicy: Never
+      containers:
+      - name: simul
+        image: {{.Image}}
+        workingDir: /simul
+        command:
+        - sh
+        - -c
+        - |
+          address={{.Name}}-$JOB_COMPLETION_INDEX.{{.Name}}
+          until getent hosts $address > /dev/null; do sleep 1; done
+{{- if .PreScript}}
+          ./{{.PreScript}} kubernetes || exit 1
+{{- end}}
+          exec ./simul -address=$address -simul={{.Simulation}} -monitor={{.Monitor}} -debug={{.Debug}} -suite={{.Suite}}
+`))
+
+// kubernetesDockerfile adds the files of a run to the base image.
+const kubernetesDockerfile = `FROM %s
+COPY . /simul
+`
+
+// Configure implements the Platform-interface. It checks the configuration
+// and prepares the build- and deploy-directories.
+func (k *Kubernetes) Configure(pc *Config) {
+	wd, _ := os.Getwd()
+	k.buildDir = wd + "/build"
+	k.deployDir = wd + "/deploy"
+	k.Suite = pc.Suite
+	k.MonitorPort = pc.MonitorPort
+	k.Debug = pc.Debug
+	if k.Namespace == "" {
+		k.Namespace = "onet-simul"
+	}
+	if k.BaseImage == "" {
+		k.BaseImage = "debian:stable-slim"
+	}
+	if k.Simulation == "" {
+		log.Fatal("No simulation defined in runconfig")
+	}
+	if k.Image == "" {
+		log.Fatal("Kubernetes needs an Image to push the simulation to")
+	}
+	if k.MonitorHost == "" {
+		log.Fatal("Kubernetes needs the MonitorHost the pods can reach this machine at")
+	}
+
+	// Clean the build- and deploy-dir, then (re-)create them
+	for _, d := range []string{k.buildDir, k.deployDir} {
+		os.RemoveAll(d)
+		log.ErrFatal(os.Mkdir(d, 0700))
+	}
+}
+
+// Build implements the Platform interface and compiles the simulation for
+// the pods.
+func (k *Kubernetes) Build(build string, arg ...string) error {
+	log.Lvl1("Building for kubernetes")
+	start := time.Now()
+	out, err := Build(".", k.buildDir+"/simul", "amd64", "linux", arg...)
+	if err != nil {
+		log.Lvl1(out)
+		return err
+	}
+	log.Lvl1("Build is finished after", time.Since(start))
+	return nil
+}
+
+// Cleanup deletes the namespace with all resources of the former runs.
+func (k *Kubernetes) Cleanup() error {
+	log.Lvl3("Deleting namespace", k.Namespace)
+	out, err := k.kubectl("delete", "namespace", k.Namespace,
+		"--ignore-not-found", "--wait=true").CombinedOutput()
+	if err != nil {
+		log.Lvl2("Error while cleaning up:", err, string(out))
+	}
+	return nil
+}
+
+// Deploy sets up the simulation for the pods of the run, builds the image
+// holding it and pushes it, so that Start only has to create the Job.
+func (k *Kubernetes) Deploy(rc *RunConfig) error {
+	log.Lvl2("Kubernetes: Deploying and writing config-files")
+	sim, err := onet.NewSimulation(k.Simulation, string(rc.Toml()))
+	if err != nil {
+		return err
+	}
+	if k.Servers, err = rc.GetInt("Servers"); err != nil {
+		return err
+	}
+	if k.RunWait, err = rc.GetDuration("RunWait"); err != nil && err != ErrorFieldNotPresent {
+		return err
+	}
+	k.run++
+	k.name = "onet-" + strconv.Itoa(k.run)
+	k.image = fmt.Sprintf("%s:run-%d", k.Image, time.Now().Unix())
+
+	// Start every run from an empty directory, as it becomes the image
+	os.RemoveAll(k.deployDir)
+	if err := os.Mkdir(k.deployDir, 0700); err != nil {
+		return err
+	}
+	k.PreScript = rc.Get("PreScript")
+	if k.PreScript != "" {
+		if _, err := os.Stat(k.PreScript); !os.IsNotExist(err) {
+			if err := app.Copy(k.deployDir, k.PreScript); err != nil {
+				return err
+			}
+		}
+	}
+	if err := app.Copy(k.deployDir, k.buildDir+"/simul"); err != nil {
+		return err
+	}
+	sc, err := sim.Setup(k.deployDir, k.addresses())
+	if err != nil {
+		return err
+	}
+	sc.Config = string(rc.Toml())
+	if err := sc.Save(k.deployDir); err != nil {
+		return err
+	}
+	dockerfile := fmt.Sprintf(kubernetesDockerfile, k.BaseImage)
+	err = ioutil.WriteFile(k.deployDir+"/Dockerfile", []byte(dockerfile), 0660)
+	if err != nil {
+		return err
+	}
+
+	log.Lvl1("Building and pushing", k.image)
+	for _, args := range [][]string{
+		{"build", "-t", k.image, k.deployDir},
+		{"push", k.image},
+	} {
+		out, err := exec.Command("docker", args...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("docker %s: %s\n%s", args[0], err, out)
+		}
+	}
+	return nil
+}
+
+// addresses returns the DNS-names of the pods of the run.
+func (k *Kubernetes) addresses() []string {
+	addresses := make([]string, k.Servers)
+	for i := range addresses {
+		addresses[i] = fmt.Sprintf("%s-%d.%s", k.name, i, k.name)
+	}
+	return addresses
+}
+
+// manifest returns the resources of the run.
+func (k *Kubernetes) manifest() ([]byte, error) {
+	var buf bytes.Buffer
+	err := kubernetesManifest.Execute(&buf, struct {
+		*Kubernetes
+		Name    string
+		Image   string
+		Monitor string
+	}{k, k.name, k.image, k.MonitorHost + ":" + strconv.Itoa(k.MonitorPort)})
+	return buf.Bytes(), err
+}
+
+// Start creates the resources of the run, which starts the pods, and
+// follows the Job until it ends.
+func (k *Kubernetes) Start(args ...string) error {
+	manifest, err := k.manifest()
+	if err != nil {
+		return err
+	}
+	manifestFile := k.buildDir + "/" + k.name + ".yaml"
+	if err := ioutil.WriteFile(manifestFile, manifest, 0660); err != nil {
+		return err
+	}
+	log.Lvl1("Starting", k.Servers, "pods of", k.Simulation, "in", k.Namespace)
+	out, err := k.kubectl("apply", "-f", manifestFile).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("kubectl apply: %s\n%s", err, out)
+	}
+	k.started = true
+	k.done = make(chan error, 1)
+	go func(name string) {
+		for {
+			time.Sleep(2 * time.Second)
+			out, err := k.kubectl("get", "job", name, "-o",
+				"jsonpath={.status.succeeded}/{.status.failed}").Output()
+			if err != nil {
+				log.Lvl2("Couldn't get the status of", name, err)
+				continue
+			}
+			succeeded, failed := parseJobStatus(string(out))
+			if failed > 0 {
+				k.done <- fmt.Errorf("%d pods of %s failed", failed, name)
+				return
+			}
+			if succeeded == k.Servers {
+				k.done <- nil
+				return
+			}
+		}
+	}(k.name)
+	return nil
+}
+
+// Wait blocks until the Job ends or RunWait passes, then writes the logs of
+// the pods to the build-directory and deletes the resources of the run.
+func (k *Kubernetes) Wait() error {
+	if !k.started {
+		return nil
+	}
+	k.started = false
+	wait := k.RunWait
+	if wait == 0 {
+		wait = 600 * time.Second
+	}
+	var err error
+	select {
+	case err = <-k.done:
+	case <-time.After(wait):
+		err = errors.New("simulation didn't end after " + wait.String())
+	}
+	if err != nil {
+		log.Error(k.name, ":", err)
+	}
+
+	logs, errLogs := k.kubectl("logs", "-l", "run="+k.name, "--prefix",
+		"--tail=-1", "--max-log-requests="+strconv.Itoa(k.Servers)).CombinedOutput()
+	if errLogs != nil {
+		log.Lvl2("Couldn't get the logs of", k.name, errLogs)
+	}
+	logFile := k.buildDir + "/" + k.name + ".log"
+	if errLogs := ioutil.WriteFile(logFile, logs, 0660); errLogs == nil {
+		log.Lvl1("Logs of the pods are in", logFile)
+	}
+
+	out, errDel := k.kubectl("delete", "job,service", "-l", "run="+k.name,
+		"--ignore-not-found").CombinedOutput()
+	if errDel != nil {
+		log.Lvl2("Couldn't delete", k.name, errDel, string(out))
+	}
+	return err
+}
+
+// kubectl returns the command to run kubectl in the namespace and context
+// of the platform.
+func (k *Kubernetes) kubectl(args ...string) *exec.Cmd {
+	flags := []string{"--namespace", k.Namespace}
+	if k.Context != "" {
+		flags = append(flags, "--context", k.Context)
+	}
+	return exec.Command("kubectl", append(flags, args...)...)
+}
+
+// parseJobStatus reads the number of succeeded and failed pods as returned
+// by kubectl, where a missing number is 0.
+func parseJobStatus(s string) (succeeded, failed int) {
+	sl := strings.SplitN(strings.TrimSpace(s), "/", 2)
+	succeeded, _ = strconv.Atoi(sl[0])
+	if len(sl) == 2 {
+		failed, _ = strconv.Atoi(sl[1])
+	}
+	return
+}
@@ -0,0 +1,65 @@
+package platform
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKubernetes_addresses(t *testing.T) {
+	k := &Kubernetes{Servers: 3, name: "onet-2"}
+	require.Equal(t, []string{"onet-2-0.onet-2", "onet-2-1.onet-2", "onet-2-2.onet-2"},
+		k.addresses())
+}
+
+func TestKubernetes_manifest(t *testing.T) {
+	k := &Kubernetes{
+		Simulation:  "CoSi",
+		Servers:     5,
+		Suite:       "Ed25519",
+		Debug:       2,
+		Namespace:   "simul",
+		MonitorHost: "10.0.0.1",
+		MonitorPort: 10000,
+		name:        "onet-1",
+		image:       "registry/simul:run-1",
+	}
+	m, err := k.manifest()
+	require.Nil(t, err)
+	manifest := string(m)
+	for _, s := range []string{
+		"name: simul\n",
+		"completions: 5\n",
+		"subdomain: onet-1\n",
+		"image: registry/simul:run-1\n",
+		"address=onet-1-$JOB_COMPLETION_INDEX.onet-1\n",
+		"-simul=CoSi -monitor=10.0.0.1:10000 -debug=2 -suite=Ed25519\n",
+	} {
+		require.Contains(t, manifest, s)
+	}
+	require.NotContains(t, manifest, "kubernetes ||")
+
+	k.PreScript = "pre.sh"
+	m, err = k.manifest()
+	require.Nil(t, err)
+	require.Contains(t, string(m), "\n          ./pre.sh kubernetes || exit 1\n          exec ./simul")
+	require.Equal(t, 3, strings.Count(string(m), "\n---\n")+1)
+}
+
+func TestKubernetes_parseJobStatus(t *testing.T) {
+	for _, tv := range []struct {
+		in                string
+		succeeded, failed int
+	}{
+		{"", 0, 0},
+		{"/", 0, 0},
+		{"3/", 3, 0},
+		{"2/1", 2, 1},
+		{"/1\n", 0, 1},
+	} {
+		s, f := parseJobStatus(tv.in)
+		require.Equal(t, tv.succeeded, s, tv.in)
+		require.Equal(t, tv.failed, f, tv.in)
+	}
+}
@@ -0,0 +1,381 @@
+package platform
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/app"
+	"github.com/dedis/onet/log"
+)
+
+// netemBridge connects the network namespaces of the servers, and holds
+// netemGateway, where the monitor is reached.
+const netemBridge = "onetbr"
+const netemGateway = "10.211.0.1"
+
+// Netem runs every server of the simulation in its own network namespace on
+// this machine, connected to the others through a bridge. The links between
+// the namespaces are shaped with tc: netem adds the delay and htb limits the
+// bandwidth, both per destination. It has to run as root on Linux.
+//
+// The links are given in the .toml-file, either for all links or per link:
+//
+//  - Delay - one-way delay of the links in ms
+//  - Bandwidth - bandwidth of the links in Mbps, 0 for no limit
+//  - DelayMatrix - file with the delays, row i holding the delays from
+//    server i to every server
+//  - BandwidthMatrix - file with the bandwidths, in the same form
+//
+// Hosts on the same server share its namespace, so the links between them
+// are not shaped. Use as many servers as hosts to shape every link.
+type Netem struct {
+	// The simulation to run
+	Simulation string
+	// Number of namespaces
+	Servers int
+	// Suite used for the simulation
+	Suite string
+	// Debug level of the servers
+	Debug int
+	// PreScript is run before the simulation is started
+	PreScript string
+
+	// Delay in ms of the links
+	Delay float64
+	// Bandwidth in Mbps of the links
+	Bandwidth float64
+	// DelayMatrix is the file with the delay of every link
+	DelayMatrix string
+	// BandwidthMatrix is the file with the bandwidth of every link
+	BandwidthMatrix string
+
+	// Port of the monitor
+	monitorPort int
+	// Where the simulation is built and run
+	runDir string
+	// The delays and bandwidths of the links of the run
+	delays     [][]float64
+	bandwidths [][]float64
+	// The processes of the servers
+	cmds []*exec.Cmd
+	// errors of the processes go here, nil once all are done
+	errChan chan error
+	wgRun   sync.WaitGroup
+	sync.Mutex
+}
+
+// Configure implements the Platform-interface.
+func (n *Netem) Configure(pc *Config) {
+	if runtime.GOOS != "linux" {
+		log.Fatal("Netem needs the network namespaces of Linux")
+	}
+	pwd, _ := os.Getwd()
+	n.runDir = pwd + "/build"
+	os.RemoveAll(n.runDir)
+	log.ErrFatal(os.Mkdir(n.runDir, 0770))
+	n.Suite = pc.Suite
+	n.Debug = pc.Debug
+	n.monitorPort = pc.MonitorPort
+	if n.Simulation == "" {
+		log.Fatal("No simulation defined in runconfig")
+	}
+}
+
+// Build compiles the simulation, as every namespace runs its own process.
+func (n *Netem) Build(build string, arg ...string) error {
+	log.Lvl1("Building for netem")
+	start := time.Now()
+	out, err := Build(".", n.runDir+"/simul", runtime.GOARCH, runtime.GOOS, arg...)
+	if err != nil {
+		log.Lvl1(out)
+		return err
+	}
+	log.Lvl1("Build is finished after", time.Since(start))
+	return nil
+}
+
+// Cleanup kills the processes of the servers and removes all namespaces
+// and the bridge, also those of an earlier simulation.
+func (n *Netem) Cleanup() error {
+	n.Lock()
+	for _, cmd := range n.cmds {
+		if cmd.Process != nil {
+			cmd.Process.Kill()
+		}
+	}
+	n.cmds = nil
+	n.Unlock()
+
+	out, err := exec.Command("ip", "netns", "list").Output()
+	if err != nil {
+		log.Lvl2("Couldn't list namespaces:", err)
+	}
+	for _, ns := range netemNamespaces(string(out)) {
+		runNetem("ip", "netns", "del", ns)
+	}
+	runNetem("ip", "link", "del", netemBridge)
+	return nil
+}
+
+// Deploy writes the configuration of the simulation and reads the links of
+// the run.
+func (n *Netem) Deploy(rc *RunConfig) error {
+	var err error
+	if n.Servers, err = rc.GetInt("Servers"); err != nil {
+		return err
+	}
+	if err := n.readLinks(rc); err != nil {
+		return err
+	}
+
+	n.PreScript = rc.Get("PreScript")
+	if n.PreScript != "" {
+		if _, err := os.Stat(n.PreScript); !os.IsNotExist(err) {
+			if err := app.Copy(n.runDir, n.PreScript); err != nil {
+				return err
+			}
+		}
+	}
+
+	log.Lvl2("Netem: Deploying and writing config-files for", n.Servers, "servers")
+	sim, err := onet.NewSimulation(n.Simulation, string(rc.Toml()))
+	if err != nil {
+		return err
+	}
+	addresses := make([]string, n.Servers)
+	for i := range addresses {
+		addresses[i] = netemAddress(i)
+	}
+	sc, err := sim.Setup(n.runDir, addresses)
+	if err != nil {
+		return err
+	}
+	sc.Config = string(rc.Toml())
+	return sc.Save(n.runDir)
+}
+
+// readLinks sets the delays and bandwidths of the run, from the matrices if
+// they are given, else from Delay and Bandwidth.
+func (n *Netem) readLinks(rc *RunConfig) error {
+	var err error
+	uniform := func(name string, def float64) ([][]float64, error) {
+		v := def
+		if s := rc.Get(name); s != "" {
+			if v, err = strconv.ParseFloat(s, 64); err != nil {
+				return nil, fmt.Errorf("%s: %s", name, err)
+			}
+		}
+		m := make([][]float64, n.Servers)
+		for i := range m {
+			m[i] = make([]float64, n.Servers)
+			for j := range m[i] {
+				m[i][j] = v
+			}
+		}
+		return m, nil
+	}
+	if file := rc.Get("DelayMatrix"); file != "" {
+		n.delays, err = readMatrix(file, n.Servers)
+	} else {
+		n.delays, err = uniform("Delay", n.Delay)
+	}
+	if err != nil {
+		return err
+	}
+	if file := rc.Get("BandwidthMatrix"); file != "" {
+		n.bandwidths, err = readMatrix(file, n.Servers)
+	} else {
+		n.bandwidths, err = uniform("Bandwidth", n.Bandwidth)
+	}
+	return err
+}
+
+// readMatrix reads the values of the links between size servers from a
+// file. Every line is a row, with the values separated by spaces or commas.
+// Empty lines and lines starting with # are skipped. Larger matrices are
+// cut to size.
+func readMatrix(file string, size int) ([][]float64, error) {
+	buf, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var m [][]float64
+	for _, line := range strings.Split(string(buf), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' || len(m) == size {
+			continue
+		}
+		fields := strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		})
+		if len(fields) < size {
+			return nil, fmt.Errorf("%s: row %d has %d values, need %d",
+				file, len(m)+1, len(fields), size)
+		}
+		row := make([]float64, size)
+		for j := range row {
+			if row[j], err = strconv.ParseFloat(fields[j], 64); err != nil {
+				return nil, fmt.Errorf("%s: row %d: %s", file, len(m)+1, err)
+			}
+			if row[j] < 0 {
+				return nil, fmt.Errorf("%s: row %d: negative value", file, len(m)+1)
+			}
+		}
+		m = append(m, row)
+	}
+	if len(m) < size {
+		return nil, fmt.Errorf("%s has %d rows, need %d", file, len(m), size)
+	}
+	return m, nil
+}
+
+// Start creates the namespaces and the links, then starts the simulation in
+// every namespace.
+func (n *Netem) Start(args ...string) error {
+	log.Lvl1("Creating", n.Servers, "namespaces")
+	for _, c := range n.setupCommands() {
+		if out, err := exec.Command(c[0], c[1:]...).CombinedOutput(); err != nil {
+			return fmt.Errorf("%s: %s\n%s", strings.Join(c, " "), err, out)
+		}
+	}
+
+	// If PreScript is defined, run it in every namespace _before_ the
+	// simulation.
+	if n.PreScript != "" {
+		for i := 0; i < n.Servers; i++ {
+			cmd := exec.Command("ip", "netns", "exec", netemNamespace(i),
+				"sh", "-c", "./"+n.PreScript+" netem")
+			cmd.Dir = n.runDir
+			if out, err := cmd.CombinedOutput(); err != nil {
+				log.Fatal("error deploying PreScript: ", err, string(out))
+			}
+		}
+	}
+
+	n.Lock()
+	defer n.Unlock()
+	n.errChan = make(chan error, n.Servers+1)
+	monitor := netemGateway + ":" + strconv.Itoa(n.monitorPort)
+	log.Lvl1("Starting", n.Servers, "applications of", n.Simulation)
+	for i := 0; i < n.Servers; i++ {
+		cmd := exec.Command("ip", "netns", "exec", netemNamespace(i), "./simul",
+			"-address="+netemAddress(i), "-simul="+n.Simulation,
+			"-monitor="+monitor, "-debug="+strconv.Itoa(n.Debug), "-suite="+n.Suite)
+		cmd.Dir = n.runDir
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Start(); err != nil {
+			return err
+		}
+		n.cmds = append(n.cmds, cmd)
+		n.wgRun.Add(1)
+		go func(i int) {
+			defer n.wgRun.Done()
+			if err := cmd.Wait(); err != nil {
+				log.Error("Error running", netemAddress(i), ":", err)
+				n.errChan <- err
+			}
+		}(i)
+	}
+	return nil
+}
+
+// Wait for all processes to finish, or one of them to fail, then remove the
+// namespaces.
+func (n *Netem) Wait() error {
+	if n.errChan == nil {
+		return errors.New("netem is not started")
+	}
+	go func() {
+		n.wgRun.Wait()
+		n.errChan <- nil
+	}()
+	err := <-n.errChan
+	n.Cleanup()
+	return err
+}
+
+// setupCommands returns the commands creating the namespaces and shaping
+// their links. Every namespace has an htb class per destination, limited to
+// the bandwidth of the link, with a netem qdisc adding its delay. The rest
+// of the traffic, e.g. to the monitor, goes through the unlimited class 1:1.
+func (n *Netem) setupCommands() [][]string {
+	cmds := [][]string{
+		{"ip", "link", "add", netemBridge, "type", "bridge"},
+		{"ip", "addr", "add", netemGateway + "/16", "dev", netemBridge},
+		{"ip", "link", "set", netemBridge, "up"},
+	}
+	for i := 0; i < n.Servers; i++ {
+		ns := netemNamespace(i)
+		cmds = append(cmds,
+			[]string{"ip", "netns", "add", ns},
+			[]string{"ip", "link", "add", ns, "type", "veth", "peer", "name", "eth0", "netns", ns},
+			[]string{"ip", "link", "set", ns, "master", netemBridge},
+			[]string{"ip", "link", "set", ns, "up"},
+			[]string{"ip", "-n", ns, "addr", "add", netemAddress(i) + "/16", "dev", "eth0"},
+			[]string{"ip", "-n", ns, "link", "set", "eth0", "up"},
+			[]string{"ip", "-n", ns, "link", "set", "lo", "up"},
+			[]string{"tc", "-n", ns, "qdisc", "add", "dev", "eth0", "root", "handle", "1:", "htb", "default", "1"},
+			[]string{"tc", "-n", ns, "class", "add", "dev", "eth0", "parent", "1:", "classid", "1:1", "htb", "rate", "100gbit"},
+		)
+		for j := 0; j < n.Servers; j++ {
+			if i == j {
+				continue
+			}
+			class := fmt.Sprintf("%x", j+2)
+			rate := "100gbit"
+			if bw := n.bandwidths[i][j]; bw > 0 {
+				rate = strconv.FormatFloat(bw, 'f', -1, 64) + "mbit"
+			}
+			cmds = append(cmds,
+				[]string{"tc", "-n", ns, "class", "add", "dev", "eth0", "parent", "1:", "classid", "1:" + class, "htb", "rate", rate},
+				[]string{"tc", "-n", ns, "qdisc", "add", "dev", "eth0", "parent", "1:" + class, "handle", class + ":",
+					"netem", "delay", strconv.FormatFloat(n.delays[i][j], 'f', -1, 64) + "ms", "limit", "100000"},
+				[]string{"tc", "-n", ns, "filter", "add", "dev", "eth0", "protocol", "ip", "parent", "1:", "prio", "1",
+					"u32", "match", "ip", "dst", netemAddress(j) + "/32", "flowid", "1:" + class},
+			)
+		}
+	}
+	return cmds
+}
+
+// netemNamespace returns the name of the namespace of the server, which is
+// also the name of its end of the link to the bridge.
+func netemNamespace(i int) string {
+	return "onet-" + strconv.Itoa(i)
+}
+
+// netemAddress returns the address of the server in its namespace.
+func netemAddress(i int) string {
+	return fmt.Sprintf("10.211.%d.%d", (i+2)/256, (i+2)%256)
+}
+
+// netemNamespaces returns the namespaces of the simulation in the output of
+// 'ip netns list'.
+func netemNamespaces(list string) []string {
+	var nss []string
+	for _, line := range strings.Split(list, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && strings.HasPrefix(fields[0], "onet-") {
+			nss = append(nss, fields[0])
+		}
+	}
+	return nss
+}
+
+// runNetem runs a command of the cleanup, where errors only mean that there
+// was nothing to clean up.
+func runNetem(name string, args ...string) {
+	if out, err := exec.Command(name, args...).CombinedOutput(); err != nil {
+		log.Lvl3(name, args, err, string(out))
+	}
+}
@@ -0,0 +1,69 @@
+package platform
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/dedis/onet/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetem_readMatrix(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "matrix")
+	log.ErrFatal(err)
+	defer os.Remove(tmpfile.Name())
+	tmpfile.WriteString("# delays in ms\n0, 10, 20\n\n10 0 30\n20\t30\t0\n1 2 3\n")
+	tmpfile.Close()
+
+	m, err := readMatrix(tmpfile.Name(), 3)
+	require.Nil(t, err)
+	require.Equal(t, [][]float64{{0, 10, 20}, {10, 0, 30}, {20, 30, 0}}, m)
+	m, err = readMatrix(tmpfile.Name(), 2)
+	require.Nil(t, err)
+	require.Equal(t, [][]float64{{0, 10}, {10, 0}}, m)
+	_, err = readMatrix(tmpfile.Name(), 5)
+	require.NotNil(t, err)
+}
+
+func TestNetem_readLinks(t *testing.T) {
+	n := &Netem{Servers: 2, Bandwidth: 100}
+	rc := makeRunConfig(2, 2)
+	rc.Put("Delay", "12.5")
+	require.Nil(t, n.readLinks(rc))
+	require.Equal(t, [][]float64{{12.5, 12.5}, {12.5, 12.5}}, n.delays)
+	require.Equal(t, [][]float64{{100, 100}, {100, 100}}, n.bandwidths)
+
+	rc.Put("Delay", "a lot")
+	require.NotNil(t, n.readLinks(rc))
+}
+
+func TestNetem_setupCommands(t *testing.T) {
+	n := &Netem{
+		Servers:    2,
+		delays:     [][]float64{{0, 10}, {20.5, 0}},
+		bandwidths: [][]float64{{0, 0}, {1.5, 0}},
+	}
+	var cmds []string
+	for _, c := range n.setupCommands() {
+		cmds = append(cmds, strings.Join(c, " "))
+	}
+	require.Contains(t, cmds, "ip -n onet-1 addr add 10.211.0.3/16 dev eth0")
+	require.Contains(t, cmds, "tc -n onet-0 class add dev eth0 parent 1: classid 1:3 htb rate 100gbit")
+	require.Contains(t, cmds, "tc -n onet-0 qdisc add dev eth0 parent 1:3 handle 3: netem delay 10ms limit 100000")
+	require.Contains(t, cmds, "tc -n onet-1 class add dev eth0 parent 1: classid 1:2 htb rate 1.5mbit")
+	require.Contains(t, cmds, "tc -n onet-1 qdisc add dev eth0 parent 1:2 handle 2: netem delay 20.5ms limit 100000")
+	require.Contains(t, cmds, "tc -n onet-1 filter add dev eth0 protocol ip parent 1: prio 1 u32 match ip dst 10.211.0.2/32 flowid 1:2")
+	for _, c := range cmds {
+		require.False(t, strings.HasPrefix(c, "tc -n onet-0") && strings.Contains(c, "10.211.0.2/32"), c)
+	}
+}
+
+func TestNetem_addresses(t *testing.T) {
+	require.Equal(t, "10.211.0.2", netemAddress(0))
+	require.Equal(t, "10.211.0.255", netemAddress(253))
+	require.Equal(t, "10.211.1.0", netemAddress(254))
+	require.Equal(t, []string{"onet-0", "onet-12"},
+		netemNamespaces("onet-0 (id: 1)\nother\nonet-12\n\n"))
+}
@@ -57,9 +57,11 @@ type Config struct {
 var deterlab = "deterlab"
 var localhost = "localhost"
 var mininet = "mininet"
+var kubernetes = "kubernetes"
+var netem = "netem"
 
 // NewPlatform returns the appropriate platform
-// [deterlab,localhost]
+// [deterlab,localhost,mininet,kubernetes,netem]
 func NewPlatform(t string) Platform {
 	var p Platform
 	switch t {
@@ -67,6 +69,10 @@ func NewPlatform(t string) Platform {
 		p = &Deterlab{}
 	case localhost:
 		p = &Localhost{}
+	case kubernetes:
+		p = &Kubernetes{}
+	case netem:
+		p = &Netem{}
 	case mininet:
 		p = &MiniNet{}
 		_, err := os.Stat("server_list")
@@ -13,6 +13,10 @@ import (
 	"github.com/dedis/onet/simul/monitor"
 )
 
+// nodeMeasureInterval is the time between two measures of the resources and
+// messages of a process, as shown by the dashboard of the monitor.
+const nodeMeasureInterval = 2 * time.Second
+
 type simulInit struct{}
 type simulInitDone struct{}
 
@@ -39,6 +43,7 @@ func Simulate(suite, serverAddress, simul, monitorAddress string) error {
 	var wgServer, wgSimulInit sync.WaitGroup
 	var ready = make(chan bool)
 	measureNodeBW := true
+	var churn *churner
 	if len(scs) > 0 {
 		cfg := &conf{}
 		_, err := toml.Decode(scs[0].Config, cfg)
@@ -46,6 +51,23 @@ func Simulate(suite, serverAddress, simul, monitorAddress string) error {
 			return err
 		}
 		measureNodeBW = cfg.IndividualStats == ""
+		if cfg.Seed != 0 {
+			onet.SetSeed(cfg.Seed)
+		}
+		if cfg.Churn != "" {
+			events, err := parseChurn(cfg.Churn)
+			if err != nil {
+				return err
+			}
+			churn = &churner{
+				events:  events,
+				seed:    cfg.Seed,
+				roster:  scs[0].Roster,
+				root:    scs[0].Tree.Root.ServerIdentity,
+				nodes:   make(map[network.ServerIdentityID]*churnNode),
+				servers: &wgServer,
+			}
+		}
 	}
 	for i, sc := range scs {
 		// Starting all servers for that server
@@ -78,11 +100,17 @@ func Simulate(suite, serverAddress, simul, monitorAddress string) error {
 		// Need to store sc in a tmp-variable so it's correctly passed
 		// to the Register-functions.
 		scTmp := sc
+		if churn != nil {
+			churn.nodes[server.ServerIdentity.ID] = &churnNode{scTmp, sim}
+		}
 		server.RegisterProcessorFunc(simulInitID, func(env *network.Envelope) {
 			err = sim.Node(scTmp)
 			if err != nil {
 				log.Error(err)
 			}
+			if churn != nil {
+				churn.start()
+			}
 			scTmp.Server.Send(env.ServerIdentity, &simulInitDone{})
 		})
 		server.RegisterProcessorFunc(simulInitDoneID, func(env *network.Envelope) {
@@ -94,6 +122,8 @@ func Simulate(suite, serverAddress, simul, monitorAddress string) error {
 			rootSC = sc
 		}
 	}
+	stopNodeMeasure := make(chan struct{})
+	go measureNode(serverAddress, scs, stopNodeMeasure)
 	if rootSim != nil {
 		// If this cothority has the root-server, it will start the simulation
 		log.Lvl2("Starting protocol", simul, "on server", rootSC.Server.ServerIdentity.Address)
@@ -129,6 +159,7 @@ func Simulate(suite, serverAddress, simul, monitorAddress string) error {
 		childrenWait.Record()
 		log.Lvl2("Broadcasting start")
 		syncWait := monitor.NewTimeMeasure("SimulSyncWait")
+		started := time.Now()
 		wgSimulInit.Add(len(rootSC.Tree.Roster.List))
 		for _, conode := range rootSC.Tree.Roster.List {
 			go rootSC.Server.Send(conode, &simulInit{})
@@ -143,6 +174,15 @@ func Simulate(suite, serverAddress, simul, monitorAddress string) error {
 		}
 		measureNet.Record()
 
+		// The killed nodes must be back to be closed.
+		if churn != nil {
+			if wait := lastRestart(churn.events) - time.Since(started); wait > 0 {
+				log.Lvl1("Waiting", wait, "for the churn to end")
+				time.Sleep(wait)
+			}
+			time.Sleep(churnRestartDelay)
+		}
+
 		// Test if all ServerIdentities are used in the tree, else we'll run into
 		// troubles with CloseAll
 		if !rootSC.Tree.UsesList() {
@@ -162,12 +202,40 @@ func Simulate(suite, serverAddress, simul, monitorAddress string) error {
 	log.Lvl3(serverAddress, scs[0].Server.ServerIdentity, "is waiting for all servers to close")
 	wgServer.Wait()
 	log.Lvl2(serverAddress, "has all servers closed")
+	close(stopNodeMeasure)
 	if monitorAddress != "" {
 		monitor.EndAndCleanup()
 	}
 	return nil
 }
 
+// measureNode records the resources of the process and the messages of its
+// servers until stop is closed.
+func measureNode(address string, scs []*onet.SimulationConfig, stop chan struct{}) {
+	nm := monitor.NewNodeMeasure(address, func() (in, out uint64) {
+		for _, sc := range scs {
+			for _, p := range sc.Server.Peers() {
+				in += p.MsgsIn
+				out += p.MsgsOut
+			}
+		}
+		return
+	})
+	ticker := time.NewTicker(nodeMeasureInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			nm.Record()
+		case <-stop:
+			return
+		}
+	}
+}
+
 type conf struct {
 	IndividualStats string
+	Seed            int64
+	// Churn kills and restarts nodes during the simulation, see parseChurn
+	Churn string
 }
@@ -1,3 +1,5 @@
+// +build !js
+
 package onet
 
 import (
@@ -12,7 +14,6 @@ import (
 	"github.com/BurntSushi/toml"
 	"github.com/dedis/kyber"
 	"github.com/dedis/kyber/suites"
-	"github.com/dedis/kyber/util/key"
 	"github.com/dedis/onet/log"
 	"github.com/dedis/onet/network"
 )
@@ -64,6 +65,8 @@ type SimulationConfig struct {
 	Server *Server
 	// Additional configuration used to run
 	Config string
+	// checkpoints stores the state of the server for a restart
+	checkpoints *checkpointer
 }
 
 // SimulationConfigFile stores the state of the simulation's config.
@@ -116,10 +119,19 @@ func LoadSimulationConfig(s, dir, ca string) ([]*SimulationConfig, error) {
 		for _, e := range sc.Roster.List {
 			if strings.Contains(e.Address.String(), ca) {
 				e.SetPrivate(scf.PrivateKeys[e.Address])
+				cp, err := newCheckpointer(sc.Config)
+				if err != nil {
+					return nil, err
+				}
+				if err := cp.restore(e, dir); err != nil {
+					return nil, err
+				}
 				server := NewServerTCP(e, suite)
 				scNew := *sc
 				scNew.Server = server
 				scNew.Overlay = server.overlay
+				scNew.checkpoints = cp
+				scNew.registerCheckpoints()
 				ret = append(ret, &scNew)
 			}
 		}
@@ -163,6 +175,18 @@ func (sc *SimulationConfig) Save(dir string) error {
 	return nil
 }
 
+// ReplaceServer replaces the server, which must be closed, with a new server
+// with the same identity and database, as if it restarted. The new server
+// still has to be started. It is used for the churn of the simulations.
+func (sc *SimulationConfig) ReplaceServer() {
+	server := NewServerTCP(sc.Server.ServerIdentity, sc.Server.Suite())
+	sc.Server = server
+	sc.Overlay = server.overlay
+	if sc.checkpoints != nil {
+		sc.registerCheckpoints()
+	}
+}
+
 // GetService returns the service with the given name.
 func (sc *SimulationConfig) GetService(name string) Service {
 	return sc.Server.serviceManager.service(name)
@@ -206,6 +230,8 @@ type SimulationBFTree struct {
 	Depth      int
 	Suite      string
 	PreScript  string // executable script to run before the simulation on each machine
+	// Seed turns on the deterministic mode if it is not 0, see SetSeed
+	Seed int64
 }
 
 // CreateRoster creates an Roster with the host-names in 'addresses'.
@@ -239,7 +265,11 @@ func (s *SimulationBFTree) CreateRoster(sc *SimulationConfig, addresses []string
 	}
 	entities := make([]*network.ServerIdentity, hosts)
 	log.Lvl3("Doing", hosts, "hosts")
-	key := key.NewKeyPair(suite)
+	if s.Seed != 0 {
+		SetSeed(s.Seed)
+		log.Lvl1("Deterministic simulation with seed", s.Seed)
+	}
+	key := newKeyPair(suite)
 	for c := 0; c < hosts; c++ {
 		key.Private.Add(key.Private, suite.Scalar().One())
 		key.Public.Add(key.Public, suite.Point().Base())
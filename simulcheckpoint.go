@@ -0,0 +1,282 @@
+// +build !js
+
+package onet
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+)
+
+// checkpointTimeout is how long the root waits for the servers to store a
+// checkpoint.
+var checkpointTimeout = time.Minute
+
+// simulCheckpoint asks a server to store the checkpoint of a round, or to
+// commit it if Commit is true.
+type simulCheckpoint struct {
+	Round  int
+	Commit bool
+}
+
+// simulCheckpointDone is the reply to simulCheckpoint, with Error set if it
+// failed.
+type simulCheckpointDone struct {
+	Round  int
+	Commit bool
+	Error  string
+}
+
+var simulCheckpointID = network.RegisterMessage(simulCheckpoint{})
+var simulCheckpointDoneID = network.RegisterMessage(simulCheckpointDone{})
+
+// checkpointer stores the checkpoints of a server of a simulation. A
+// checkpoint is stored in two steps: every server first copies its database
+// to dir/round-N, then every server marks this copy as the one to restore,
+// once all copies are done. A crash between the marks of two servers leaves
+// them one round apart.
+type checkpointer struct {
+	// dir holds the checkpoints of the run, "" if there are none
+	dir string
+	// resumed is the round the database has been restored to
+	resumed int
+	// replies of the servers to the checkpoint of the root
+	replies chan *simulCheckpointDone
+	sync.Mutex
+}
+
+// newCheckpointer returns the checkpointer of a simulation with the given
+// config. The checkpoints are kept in a directory named after the config in
+// the directory given by the Checkpoints parameter, so that every run of a
+// simulation has its own. There are none if the parameter is not set.
+func newCheckpointer(config string) (*checkpointer, error) {
+	var conf struct{ Checkpoints string }
+	if _, err := toml.Decode(config, &conf); err != nil {
+		return nil, err
+	}
+	if conf.Checkpoints == "" {
+		return &checkpointer{}, nil
+	}
+	sum := sha256.Sum256([]byte(config))
+	return &checkpointer{dir: filepath.Join(conf.Checkpoints, fmt.Sprintf("%x", sum[:8]))}, nil
+}
+
+// dbName is the name of the database of the server, in its directory as
+// well as in the checkpoints.
+func dbName(si *network.ServerIdentity) string {
+	pub, _ := si.Public.MarshalBinary()
+	return fmt.Sprintf("%x.db", pub)
+}
+
+// roundDir is the directory of the checkpoint of the round.
+func (cp *checkpointer) roundDir(round int) string {
+	return filepath.Join(cp.dir, "round-"+strconv.Itoa(round))
+}
+
+// committed returns the round of the last committed checkpoint of the
+// server, or 0 if there is none.
+func (cp *checkpointer) committed(si *network.ServerIdentity) (int, error) {
+	buf, err := ioutil.ReadFile(filepath.Join(cp.dir, dbName(si)+".round"))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(buf)))
+}
+
+// restore copies the database of the last committed checkpoint of the
+// server to dbDir, before the server opens it.
+func (cp *checkpointer) restore(si *network.ServerIdentity, dbDir string) error {
+	if cp.dir == "" {
+		return nil
+	}
+	round, err := cp.committed(si)
+	if err != nil || round == 0 {
+		return err
+	}
+	src, err := os.Open(filepath.Join(cp.roundDir(round), dbName(si)))
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	if err := writeFileAtomic(filepath.Join(dbDir, dbName(si)), func(w io.Writer) error {
+		_, err := io.Copy(w, src)
+		return err
+	}); err != nil {
+		return err
+	}
+	log.Lvl2("Restored", si.Address, "to the checkpoint of round", round)
+	cp.resumed = round
+	return nil
+}
+
+// save copies the database of the server to the checkpoint of the round.
+func (cp *checkpointer) save(s *Server, round int) error {
+	dir := cp.roundDir(round)
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, dbName(s.ServerIdentity)), func(w io.Writer) error {
+		_, err := s.BackupDB(w)
+		return err
+	})
+}
+
+// commit makes the checkpoint of the round the one to restore for the
+// server, and removes its older checkpoints.
+func (cp *checkpointer) commit(s *Server, round int) error {
+	name := dbName(s.ServerIdentity)
+	err := writeFileAtomic(filepath.Join(cp.dir, name+".round"), func(w io.Writer) error {
+		_, err := fmt.Fprintln(w, round)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	old, _ := filepath.Glob(filepath.Join(cp.dir, "round-*", name))
+	for _, f := range old {
+		if filepath.Dir(f) != cp.roundDir(round) {
+			os.Remove(f)
+			// only removed once the other servers are done with it
+			os.Remove(filepath.Dir(f))
+		}
+	}
+	return nil
+}
+
+// writeFileAtomic writes a file through a temporary file, so that it is
+// either complete or not there at all.
+func writeFileAtomic(name string, write func(w io.Writer) error) error {
+	tmp := name + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	err = write(f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if errClose := f.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// registerCheckpoints lets the server of the config store checkpoints for
+// the root.
+func (sc *SimulationConfig) registerCheckpoints() {
+	sc.Server.RegisterProcessorFunc(simulCheckpointID, func(env *network.Envelope) {
+		msg := env.Msg.(*simulCheckpoint)
+		var err error
+		if msg.Commit {
+			err = sc.checkpoints.commit(sc.Server, msg.Round)
+		} else {
+			err = sc.checkpoints.save(sc.Server, msg.Round)
+		}
+		reply := &simulCheckpointDone{Round: msg.Round, Commit: msg.Commit}
+		if err != nil {
+			log.Error("Couldn't store checkpoint:", err)
+			reply.Error = err.Error()
+		}
+		if _, err := sc.Server.Send(env.ServerIdentity, reply); err != nil {
+			log.Error("Couldn't reply to checkpoint:", err)
+		}
+	})
+	sc.Server.RegisterProcessorFunc(simulCheckpointDoneID, func(env *network.Envelope) {
+		cp := sc.checkpoints
+		cp.Lock()
+		replies := cp.replies
+		cp.Unlock()
+		if replies != nil {
+			select {
+			case replies <- env.Msg.(*simulCheckpointDone):
+			default:
+			}
+		}
+	})
+}
+
+// Checkpoint stores the state of all servers of the simulation once the
+// given number of rounds is done, so that a run stopped by a crash can
+// continue from there, see ResumeRound. It is called by the root in Run,
+// and stores the databases of the servers. It does nothing if the
+// Checkpoints parameter of the simulation is not set.
+func (sc *SimulationConfig) Checkpoint(round int) error {
+	cp := sc.checkpoints
+	if cp == nil || cp.dir == "" {
+		return nil
+	}
+	start := time.Now()
+	for _, commit := range []bool{false, true} {
+		if err := sc.checkpointStep(round, commit); err != nil {
+			return err
+		}
+	}
+	log.Lvl2("Checkpoint of round", round, "took", time.Since(start))
+	return nil
+}
+
+// checkpointStep sends one step of the checkpoint to all servers and waits
+// for their replies.
+func (sc *SimulationConfig) checkpointStep(round int, commit bool) error {
+	cp := sc.checkpoints
+	replies := make(chan *simulCheckpointDone, len(sc.Roster.List))
+	cp.Lock()
+	cp.replies = replies
+	cp.Unlock()
+	defer func() {
+		cp.Lock()
+		cp.replies = nil
+		cp.Unlock()
+	}()
+	for _, si := range sc.Roster.List {
+		_, err := sc.Server.Send(si, &simulCheckpoint{Round: round, Commit: commit})
+		if err != nil {
+			return err
+		}
+	}
+	timeout := time.After(checkpointTimeout)
+	for done := 0; done < len(sc.Roster.List); {
+		select {
+		case r := <-replies:
+			if r.Round != round || r.Commit != commit {
+				continue
+			}
+			if r.Error != "" {
+				return errors.New("checkpoint failed: " + r.Error)
+			}
+			done++
+		case <-timeout:
+			return fmt.Errorf("checkpoint of round %d timed out", round)
+		}
+	}
+	return nil
+}
+
+// ResumeRound returns the round of the checkpoint the servers have been
+// restored to, or 0 if the simulation starts from scratch. Run should
+// continue from this round.
+func (sc *SimulationConfig) ResumeRound() int {
+	if sc.checkpoints == nil {
+		return 0
+	}
+	return sc.checkpoints.resumed
+}
@@ -0,0 +1,91 @@
+package onet
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/dedis/onet/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCheckpointer(t *testing.T) {
+	cp, err := newCheckpointer("Rounds = 10")
+	require.Nil(t, err)
+	require.Equal(t, "", cp.dir)
+
+	cp, err = newCheckpointer("Rounds = 10\nCheckpoints = \"/tmp/cp\"")
+	require.Nil(t, err)
+	require.Equal(t, "/tmp/cp", filepath.Dir(cp.dir))
+	cp2, err := newCheckpointer("Rounds = 20\nCheckpoints = \"/tmp/cp\"")
+	require.Nil(t, err)
+	require.NotEqual(t, cp.dir, cp2.dir)
+
+	_, err = newCheckpointer("Rounds = ")
+	require.NotNil(t, err)
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atomic")
+	log.ErrFatal(err)
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "file")
+
+	require.Nil(t, writeFileAtomic(name, func(w io.Writer) error {
+		_, err := w.Write([]byte("first"))
+		return err
+	}))
+	require.NotNil(t, writeFileAtomic(name, func(w io.Writer) error {
+		w.Write([]byte("partial"))
+		return errors.New("failed")
+	}))
+	buf, err := ioutil.ReadFile(name)
+	require.Nil(t, err)
+	require.Equal(t, "first", string(buf))
+	_, err = os.Stat(name + ".tmp")
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestSimulationCheckpoint(t *testing.T) {
+	sc, _, err := createBFTree(3, 2, []string{"127.0.0.1"})
+	require.Nil(t, err)
+	dir, err := ioutil.TempDir("", "simulation")
+	log.ErrFatal(err)
+	defer os.RemoveAll(dir)
+	cpDir := filepath.Join(dir, "checkpoints")
+	sc.Config = "Rounds = 3\nCheckpoints = " + strconv.Quote(cpDir)
+	sc.Save(dir)
+
+	load := func() (*SimulationConfig, []*SimulationConfig) {
+		scs, err := LoadSimulationConfig("Ed25519", dir, "127.0.0.1")
+		require.Nil(t, err)
+		var root *SimulationConfig
+		for _, s := range scs {
+			go s.Server.Start()
+			if s.Server.ServerIdentity.ID.Equal(s.Tree.Root.ServerIdentity.ID) {
+				root = s
+			}
+		}
+		require.NotNil(t, root)
+		return root, scs
+	}
+	root, scs := load()
+	require.Equal(t, 0, root.ResumeRound())
+	require.Nil(t, root.Checkpoint(1))
+	require.Nil(t, root.Checkpoint(2))
+	rounds, err := filepath.Glob(filepath.Join(cpDir, "*", "round-*"))
+	require.Nil(t, err)
+	require.Equal(t, 1, len(rounds))
+	require.Equal(t, "round-2", filepath.Base(rounds[0]))
+	closeAll(scs)
+
+	root, scs = load()
+	defer closeAll(scs)
+	for _, s := range scs {
+		require.Equal(t, 2, s.ResumeRound())
+	}
+}
@@ -0,0 +1,92 @@
+// +build !js
+
+package onet
+
+import (
+	"errors"
+	"sort"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/dedis/onet/network"
+)
+
+// Snapshot gives a consistent view of the data of a service, as it was when
+// the snapshot has been taken. Writes through Context.Save can continue
+// while the snapshot is open, but they are not visible in it. This lets a
+// service read its state for a whole protocol round without holding a lock
+// that blocks the other requests.
+//
+// The snapshot is a copy in memory of the data of the service, so taking
+// it costs the size of that data, but it doesn't hold the database.
+type Snapshot struct {
+	data  map[string][]byte
+	keys  []string
+	suite network.Suite
+}
+
+// Snapshot returns a read-only snapshot of the data stored by this service.
+// It should be closed with Snapshot.Close to release the memory early.
+func (c *Context) Snapshot() (*Snapshot, error) {
+	s := &Snapshot{data: make(map[string][]byte), suite: c.server.suite}
+	err := c.manager.dbView(func(tx *bolt.Tx) error {
+		b := tx.Bucket(c.bucketName)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			if v == nil {
+				// nested bucket
+				return nil
+			}
+			s.data[string(k)] = append([]byte{}, v...)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	for k := range s.data {
+		s.keys = append(s.keys, k)
+	}
+	sort.Strings(s.keys)
+	return s, nil
+}
+
+// Load returns the data stored under key at the time the snapshot was
+// taken, or nil if there was none.
+func (s *Snapshot) Load(key []byte) (interface{}, error) {
+	if s.data == nil {
+		return nil, errors.New("snapshot is closed")
+	}
+	v, ok := s.data[string(key)]
+	if !ok {
+		return nil, nil
+	}
+	_, ret, err := network.Unmarshal(v, s.suite)
+	return ret, err
+}
+
+// ForEach calls fn for every key of the snapshot, in byte-sorted order. The
+// iteration stops at the first error returned by fn.
+func (s *Snapshot) ForEach(fn func(key []byte, data interface{}) error) error {
+	if s.data == nil {
+		return errors.New("snapshot is closed")
+	}
+	for _, k := range s.keys {
+		_, ret, err := network.Unmarshal(s.data[k], s.suite)
+		if err != nil {
+			return err
+		}
+		if err := fn([]byte(k), ret); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close releases the snapshot. It can be called more than once.
+func (s *Snapshot) Close() error {
+	s.data = nil
+	s.keys = nil
+	return nil
+}
@@ -0,0 +1,49 @@
+package onet
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/dedis/onet/network"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContext_Snapshot(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "conode")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmp)
+	network.RegisterMessage(ContextData{})
+	c := createContext(t, tmp)
+
+	require.Nil(t, c.Save([]byte("a"), &ContextData{1, "one"}))
+	snap, err := c.Snapshot()
+	require.Nil(t, err)
+	defer snap.Close()
+
+	// Writes are not blocked by the snapshot and are not visible in it.
+	require.Nil(t, c.Save([]byte("a"), &ContextData{2, "two"}))
+	require.Nil(t, c.Save([]byte("b"), &ContextData{3, "three"}))
+
+	msg, err := snap.Load([]byte("a"))
+	require.Nil(t, err)
+	require.Equal(t, 1, msg.(*ContextData).I)
+	msg, err = snap.Load([]byte("b"))
+	require.Nil(t, err)
+	require.Nil(t, msg)
+	var keys []string
+	require.Nil(t, snap.ForEach(func(k []byte, data interface{}) error {
+		keys = append(keys, string(k))
+		return nil
+	}))
+	require.Equal(t, []string{"a"}, keys)
+
+	msg, err = c.Load([]byte("a"))
+	require.Nil(t, err)
+	require.Equal(t, 2, msg.(*ContextData).I)
+
+	require.Nil(t, snap.Close())
+	require.Nil(t, snap.Close())
+	_, err = snap.Load([]byte("a"))
+	require.NotNil(t, err)
+}
@@ -1,39 +1,209 @@
 package onet
 
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+)
+
 // Status holds key/value pairs of the status to be returned to the requester.
+// Field is the string view of all values, some reporters only fill it in.
+// Numbers holds the scalar numeric values, with durations in seconds, and
+// Integers the exact values of the integers, for the clients that get the
+// status through protobuf. The typed values given to Set, which can also be
+// nested maps and slices, are only kept for the JSON and OpenMetrics views
+// of the local server and are not sent over the network.
 type Status struct {
-	Field map[string]string
+	Field    map[string]string
+	Numbers  map[string]float64
+	Integers map[string]int64
+	values   map[string]interface{}
+}
+
+// NewStatus returns an empty Status ready to be filled with Set.
+func NewStatus() *Status {
+	return &Status{
+		Field:    make(map[string]string),
+		Numbers:  make(map[string]float64),
+		Integers: make(map[string]int64),
+		values:   make(map[string]interface{}),
+	}
+}
+
+// Set stores the typed value under the given key and updates the string view
+// in Field and the numeric views in Numbers and Integers.
+func (s *Status) Set(key string, value interface{}) {
+	if s.Field == nil {
+		s.Field = make(map[string]string)
+	}
+	if s.values == nil {
+		s.values = make(map[string]interface{})
+	}
+	s.values[key] = value
+	s.Field[key] = statusString(value)
+	delete(s.Numbers, key)
+	delete(s.Integers, key)
+	switch value.(type) {
+	case string, bool:
+		return
+	}
+	if f, ok := openMetricsValue(value); ok {
+		if s.Numbers == nil {
+			s.Numbers = make(map[string]float64)
+		}
+		s.Numbers[key] = f
+	}
+	if i, ok := statusInteger(value); ok {
+		if s.Integers == nil {
+			s.Integers = make(map[string]int64)
+		}
+		s.Integers[key] = i
+	}
 }
 
-// StatusReporter is the interface that all structures that want to return a status will implement.
-type StatusReporter interface {
-	GetStatus() *Status
+// Value returns the typed value of the given key. If the status has been
+// received over the network, the integer or number is returned, and if the
+// reporter only filled in Field, the string is returned.
+func (s *Status) Value(key string) (interface{}, bool) {
+	if v, ok := s.values[key]; ok {
+		return v, true
+	}
+	if v, ok := s.Integers[key]; ok {
+		return v, true
+	}
+	if v, ok := s.Numbers[key]; ok {
+		return v, true
+	}
+	v, ok := s.Field[key]
+	return v, ok
 }
 
-// statusReporterStruct holds a map of all StatusReporters.
-type statusReporterStruct struct {
-	statusReporters map[string]StatusReporter
+// MarshalJSON returns all values of the status as a JSON object. Durations
+// are given in seconds, so that they can be used as numbers.
+func (s *Status) MarshalJSON() ([]byte, error) {
+	m := make(map[string]interface{}, len(s.Field))
+	for k, v := range s.Field {
+		m[k] = v
+	}
+	for k, v := range s.Numbers {
+		m[k] = v
+	}
+	for k, v := range s.Integers {
+		m[k] = v
+	}
+	for k, v := range s.values {
+		m[k] = statusJSON(v)
+	}
+	return json.Marshal(m)
 }
 
-// newStatusReporterStruct creates a new instance of the newStatusReporterStruct.
-func newStatusReporterStruct() *statusReporterStruct {
-	return &statusReporterStruct{
-		statusReporters: make(map[string]StatusReporter),
+// statusInteger returns the value of an integer that fits in an int64.
+func statusInteger(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case time.Duration:
+		return 0, false
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint:
+		return int64(v), uint64(v) <= math.MaxInt64
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		return int64(v), v <= math.MaxInt64
 	}
+	return 0, false
 }
 
-// RegisterStatusReporter registers a status reporter.
-func (s *statusReporterStruct) RegisterStatusReporter(name string, sr StatusReporter) {
-	s.statusReporters[name] = sr
+// statusString returns the string view of a status value. Scalars use their
+// usual formatting, composite values are rendered as JSON.
+func statusString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case fmt.Stringer:
+		return v.String()
+	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32,
+		uint64, float32, float64:
+		return fmt.Sprint(v)
+	}
+	buf, err := json.Marshal(statusJSON(value))
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(buf)
+}
 
+// statusJSON replaces durations with seconds, also inside nested maps and
+// slices created by reporters.
+func statusJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case time.Duration:
+		return v.Seconds()
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[k] = statusJSON(e)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, e := range v {
+			l[i] = statusJSON(e)
+		}
+		return l
+	}
+	return value
 }
 
-// ReportStatus gets the status of all StatusReporters within the Registry and
-// puts them in a map
-func (s *statusReporterStruct) ReportStatus() map[string]*Status {
-	m := make(map[string]*Status)
-	for key, val := range s.statusReporters {
-		m[key] = val.GetStatus()
+// openMetricsValue returns the numeric value of a status value, if it has
+// one. Durations are converted to seconds. Strings have no numeric value,
+// even if they look like a number, like a version "2.0".
+func openMetricsValue(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case time.Duration:
+		return v.Seconds(), true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
 	}
-	return m
+	return 0, false
 }
@@ -1,12 +1,15 @@
 package onet
 
 import (
+	"encoding/json"
 	"strings"
 	"testing"
+	"time"
 
 	"strconv"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestSRStruct(t *testing.T) {
@@ -31,10 +34,69 @@ func TestStatusHost(t *testing.T) {
 	assert.Equal(t, len(services), len(a))
 }
 
+func TestStatusPeers(t *testing.T) {
+	l := NewTCPTest(tSuite)
+	defer l.CloseAll()
+	servers, _, _ := l.GenTree(2, true)
+
+	_, err := servers[0].Send(servers[1].ServerIdentity, &SimpleMessage{3})
+	require.Nil(t, err)
+	st := servers[0].statusReporterStruct.ReportStatus()["Peers"]
+	require.NotNil(t, st)
+	v, ok := st.Value(servers[1].ServerIdentity.Address.String())
+	require.True(t, ok)
+	peer := v.(map[string]interface{})
+	require.Equal(t, 1, peer["Connections"])
+	require.True(t, peer["MsgsOut"].(uint64) >= 1)
+}
+
 type dummyTestReporter struct {
 	Status int
 }
 
 func (d *dummyTestReporter) GetStatus() *Status {
-	return &Status{map[string]string{"Connections": strconv.Itoa(d.Status)}}
+	return &Status{Field: map[string]string{"Connections": strconv.Itoa(d.Status)}}
+}
+
+func TestStatus_Set(t *testing.T) {
+	st := NewStatus()
+	st.Set("Count", 42)
+	st.Set("Uptime", 90*time.Second)
+	st.Set("Name", "conode")
+	st.Set("Nested", map[string]interface{}{"Tx": uint64(1), "Wait": time.Second})
+	assert.Equal(t, "42", st.Field["Count"])
+	assert.Equal(t, "1m30s", st.Field["Uptime"])
+	assert.Equal(t, "conode", st.Field["Name"])
+	assert.Equal(t, `{"Tx":1,"Wait":1}`, st.Field["Nested"])
+
+	v, ok := st.Value("Count")
+	assert.True(t, ok)
+	assert.Equal(t, 42, v)
+	old := &Status{Field: map[string]string{"Connections": "5"}}
+	v, ok = old.Value("Connections")
+	assert.True(t, ok)
+	assert.Equal(t, "5", v)
+	_, ok = old.Value("Unknown")
+	assert.False(t, ok)
+	// Only the exported maps are sent over the network.
+	wire := &Status{Field: st.Field, Numbers: st.Numbers, Integers: st.Integers}
+	v, ok = wire.Value("Count")
+	assert.True(t, ok)
+	assert.Equal(t, int64(42), v)
+	v, ok = wire.Value("Uptime")
+	assert.True(t, ok)
+	assert.Equal(t, float64(90), v)
+
+	buf, err := json.Marshal(st)
+	require.Nil(t, err)
+	assert.Equal(t, `{"Count":42,"Name":"conode","Nested":{"Tx":1,"Wait":1},"Uptime":90}`,
+		string(buf))
+}
+
+func TestSRStruct_JSON(t *testing.T) {
+	srs := newStatusReporterStruct()
+	srs.RegisterStatusReporter("Dummy", &dummyTestReporter{5})
+	buf, err := srs.ReportStatusJSON()
+	require.Nil(t, err)
+	assert.Equal(t, `{"Dummy":{"Connections":"5"}}`, string(buf))
 }
@@ -0,0 +1,188 @@
+// +build !js
+
+package onet
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// StatusVersion is the version of the schema of StatusReport. It changes
+// whenever fields are added or their meaning changes.
+const StatusVersion = 2
+
+// maxStatusRemoved is the number of removed keys remembered for the delta
+// reports. Older tokens get a full report.
+const maxStatusRemoved = 10000
+
+// StatusReport is the status of all reporters of a server. If Full is
+// false, it only holds the values that changed since the token given in
+// the request, and the keys that have been removed since then. Token is
+// given in the next request to only get the changes.
+type StatusReport struct {
+	Version   int
+	Token     uint64
+	Full      bool
+	Reporters map[string]*Status
+	Removed   map[string][]string
+}
+
+// statusHistory remembers when every status value changed for the last
+// time. The tokens start at the creation time in nanoseconds, so that the
+// tokens of a former run of the server are not mistaken for current ones.
+type statusHistory struct {
+	base  uint64
+	token uint64
+	// horizon is the oldest token that can get a delta
+	horizon uint64
+	values  map[string]map[string]string
+	changed map[string]map[string]uint64
+	removed map[string]map[string]uint64
+	nremove int
+	sync.Mutex
+}
+
+func newStatusHistory() *statusHistory {
+	base := uint64(time.Now().UnixNano())
+	return &statusHistory{
+		base:    base,
+		token:   base,
+		horizon: base,
+		values:  make(map[string]map[string]string),
+		changed: make(map[string]map[string]uint64),
+		removed: make(map[string]map[string]uint64),
+	}
+}
+
+// update compares the report with the former one and returns the token of
+// the report. The token is only increased if something changed.
+func (h *statusHistory) update(report map[string]*Status) uint64 {
+	next := h.token + 1
+	dirty := false
+	for reporter, st := range report {
+		if h.values[reporter] == nil {
+			h.values[reporter] = make(map[string]string)
+			h.changed[reporter] = make(map[string]uint64)
+		}
+		for key, v := range st.Field {
+			if old, ok := h.values[reporter][key]; ok && old == v {
+				continue
+			}
+			h.values[reporter][key] = v
+			h.changed[reporter][key] = next
+			delete(h.removed[reporter], key)
+			dirty = true
+		}
+	}
+	for reporter, values := range h.values {
+		for key := range values {
+			if st, ok := report[reporter]; ok {
+				if _, ok := st.Field[key]; ok {
+					continue
+				}
+			}
+			delete(values, key)
+			delete(h.changed[reporter], key)
+			if h.removed[reporter] == nil {
+				h.removed[reporter] = make(map[string]uint64)
+			}
+			h.removed[reporter][key] = next
+			h.nremove++
+			dirty = true
+		}
+	}
+	if dirty {
+		h.token = next
+	}
+	if h.nremove > maxStatusRemoved {
+		h.removed = make(map[string]map[string]uint64)
+		h.nremove = 0
+		h.horizon = h.token
+	}
+	return h.token
+}
+
+// report returns the changes of report since the given token, or all of
+// it if the token is unknown.
+func (h *statusHistory) report(report map[string]*Status, since uint64) *StatusReport {
+	h.Lock()
+	defer h.Unlock()
+	sr := &StatusReport{
+		Version: StatusVersion,
+		Token:   h.update(report),
+		Full:    since < h.horizon || since > h.token,
+	}
+	if sr.Full {
+		sr.Reporters = report
+		return sr
+	}
+	sr.Reporters = make(map[string]*Status)
+	for reporter, st := range report {
+		delta := &Status{}
+		for key, v := range st.Field {
+			if h.changed[reporter][key] <= since {
+				continue
+			}
+			if delta.Field == nil {
+				delta.Field = make(map[string]string)
+			}
+			delta.Field[key] = v
+			if tv, ok := st.values[key]; ok {
+				if delta.values == nil {
+					delta.values = make(map[string]interface{})
+				}
+				delta.values[key] = tv
+			}
+			if n, ok := st.Numbers[key]; ok {
+				if delta.Numbers == nil {
+					delta.Numbers = make(map[string]float64)
+				}
+				delta.Numbers[key] = n
+			}
+			if i, ok := st.Integers[key]; ok {
+				if delta.Integers == nil {
+					delta.Integers = make(map[string]int64)
+				}
+				delta.Integers[key] = i
+			}
+		}
+		if delta.Field != nil {
+			sr.Reporters[reporter] = delta
+		}
+	}
+	for reporter, keys := range h.removed {
+		for key, t := range keys {
+			if t > since {
+				if sr.Removed == nil {
+					sr.Removed = make(map[string][]string)
+				}
+				sr.Removed[reporter] = append(sr.Removed[reporter], key)
+			}
+		}
+	}
+	return sr
+}
+
+// ReportStatusSince returns the status of all reporters that changed since
+// the token of an earlier report. A token of 0 returns the full status.
+func (s *statusReporterStruct) ReportStatusSince(since uint64) *StatusReport {
+	return s.history.report(s.ReportStatus(), since)
+}
+
+// GetStatusSince returns the status of the server that changed since the
+// token of an earlier report, see StatusReport. The same report is served
+// as JSON on the /status path of the websocket port, with the token given
+// as since=, to the clients of the admin API.
+func (c *Server) GetStatusSince(since uint64) *StatusReport {
+	return c.statusReporterStruct.ReportStatusSince(since)
+}
+
+// serveStatus is the handler of the /status path.
+func (c *Server) serveStatus(w http.ResponseWriter, r *http.Request) {
+	since, _ := strconv.ParseUint(r.URL.Query().Get("since"), 10, 64)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c.GetStatusSince(since))
+}
@@ -0,0 +1,110 @@
+package onet
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// mapReporter returns the values of its map.
+type mapReporter struct {
+	values map[string]interface{}
+}
+
+func (m *mapReporter) GetStatus() *Status {
+	st := NewStatus()
+	for k, v := range m.values {
+		st.Set(k, v)
+	}
+	return st
+}
+
+func TestStatus_Numbers(t *testing.T) {
+	st := NewStatus()
+	st.Set("Count", 42)
+	st.Set("Uptime", 90*time.Second)
+	st.Set("Name", "42")
+	require.Equal(t, float64(42), st.Numbers["Count"])
+	require.Equal(t, float64(90), st.Numbers["Uptime"])
+	require.Equal(t, int64(42), st.Integers["Count"])
+	_, ok := st.Integers["Uptime"]
+	require.False(t, ok)
+	_, ok = st.Numbers["Name"]
+	require.False(t, ok)
+	st.Set("Count", "many")
+	_, ok = st.Numbers["Count"]
+	require.False(t, ok)
+	_, ok = st.Integers["Count"]
+	require.False(t, ok)
+}
+
+func TestStatus_ReportSince(t *testing.T) {
+	srs := newStatusReporterStruct()
+	mr := &mapReporter{map[string]interface{}{"Tx": 1, "Rx": 2, "Name": "conode"}}
+	srs.RegisterStatusReporter("Map", mr)
+	srs.RegisterStatusReporter("Dummy", &dummyTestReporter{5})
+
+	full := srs.ReportStatusSince(0)
+	require.Equal(t, StatusVersion, full.Version)
+	require.True(t, full.Full)
+	require.Equal(t, "conode", full.Reporters["Map"].Field["Name"])
+	require.Equal(t, "5", full.Reporters["Dummy"].Field["Connections"])
+
+	// Nothing changed
+	delta := srs.ReportStatusSince(full.Token)
+	require.False(t, delta.Full)
+	require.Equal(t, full.Token, delta.Token)
+	require.Empty(t, delta.Reporters)
+	require.Empty(t, delta.Removed)
+
+	mr.values["Tx"] = 10
+	delete(mr.values, "Rx")
+	delta = srs.ReportStatusSince(full.Token)
+	require.False(t, delta.Full)
+	require.True(t, delta.Token > full.Token)
+	require.Equal(t, 1, len(delta.Reporters))
+	require.Equal(t, map[string]string{"Tx": "10"}, delta.Reporters["Map"].Field)
+	require.Equal(t, int64(10), delta.Reporters["Map"].Integers["Tx"])
+	require.Equal(t, float64(10), delta.Reporters["Map"].Numbers["Tx"])
+	require.Equal(t, []string{"Rx"}, delta.Removed["Map"])
+
+	// An older token still gets all the changes since then.
+	mr.values["Rx"] = 3
+	delta2 := srs.ReportStatusSince(delta.Token)
+	require.Equal(t, map[string]string{"Rx": "3"}, delta2.Reporters["Map"].Field)
+	require.Empty(t, delta2.Removed)
+	delta = srs.ReportStatusSince(full.Token)
+	require.Equal(t, 2, len(delta.Reporters["Map"].Field))
+	require.Empty(t, delta.Removed)
+
+	// Unknown tokens get a full report.
+	require.True(t, srs.ReportStatusSince(1).Full)
+	require.True(t, srs.ReportStatusSince(delta.Token+1).Full)
+}
+
+func TestServer_serveStatus(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	srv := local.GenServers(1)[0]
+
+	rec := httptest.NewRecorder()
+	srv.serveStatus(rec, httptest.NewRequest("GET", "/status", nil))
+	var report struct {
+		Version int
+		Token   uint64
+		Full    bool
+	}
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	require.Equal(t, StatusVersion, report.Version)
+	require.True(t, report.Full)
+
+	rec = httptest.NewRecorder()
+	srv.serveStatus(rec, httptest.NewRequest("GET",
+		"/status?since="+strconv.FormatUint(report.Token, 10), nil))
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	require.False(t, report.Full)
+}
@@ -0,0 +1,207 @@
+// +build !js
+
+package onet
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+	"github.com/dedis/protobuf"
+	"github.com/gorilla/websocket"
+)
+
+// StreamingService is implemented by services with streaming endpoints,
+// where one request gets a sequence of replies. ServiceProcessor implements
+// it for the handlers registered with RegisterStreamingHandler.
+type StreamingService interface {
+	// IsStreaming returns whether the requests on path are streamed.
+	IsStreaming(path string) bool
+	// ProcessClientStreamRequest starts the stream for the request. The
+	// encoded replies are sent on the returned channel, which is closed at
+	// the end of the stream. The caller closes stop if the client goes away,
+	// after which no more replies are sent.
+	ProcessClientStreamRequest(req *http.Request, path string, buf []byte,
+		stop chan bool) (<-chan []byte, error)
+}
+
+// RegisterStreamingHandler stores a handler that replies with a stream of
+// messages. The path is the same as for RegisterHandler, f must be of the
+// form:
+// func(msg *Request)(replies chan *Reply, stop chan bool, err error)
+//
+//  * replies is the channel of the messages sent to the client. The handler
+//    closes it at the end of the stream.
+//  * stop is closed by onet when the client disconnects. The handler must
+//    then stop sending replies.
+//
+// Sending on replies blocks until the client is ready for the message, so
+// a slow client slows down the handler instead of filling the memory.
+func (p *ServiceProcessor) RegisterStreamingHandler(f interface{}) error {
+	ft := reflect.TypeOf(f)
+	if ft.Kind() != reflect.Func {
+		return errors.New("Input is not a function")
+	}
+	if ft.NumIn() != 1 {
+		return errors.New("Need one argument: *struct")
+	}
+	cr := ft.In(0)
+	if cr.Kind() != reflect.Ptr || cr.Elem().Kind() != reflect.Struct {
+		return errors.New("Argument must be a *pointer* to a struct")
+	}
+	if ft.NumOut() != 3 {
+		return errors.New("Need 3 return values: chan *struct, chan bool and error")
+	}
+	ret := ft.Out(0)
+	if ret.Kind() != reflect.Chan || ret.ChanDir()&reflect.RecvDir == 0 {
+		return errors.New("1st return value must be a channel")
+	}
+	if ret.Elem().Kind() != reflect.Ptr || ret.Elem().Elem().Kind() != reflect.Struct {
+		return errors.New("1st return value must be a channel of *pointers* to a struct")
+	}
+	if ft.Out(1) != reflect.TypeOf(make(chan bool)) {
+		return errors.New("2nd return value must be a chan bool")
+	}
+	if !ft.Out(2).Implements(errType) {
+		return errors.New("3rd return value has to implement error, but is: " +
+			ft.Out(2).String())
+	}
+
+	constraints, err := parseConstraints(cr.Elem())
+	if err != nil {
+		return err
+	}
+
+	log.Lvl4("Registering streaming handler", cr.String())
+	pm := strings.Split(cr.Elem().String(), ".")[1]
+	p.handlers[pm] = serviceHandler{handler: f, msgType: cr.Elem(),
+		constraints: constraints, streaming: true}
+	return nil
+}
+
+// IsStreaming implements StreamingService.
+func (p *ServiceProcessor) IsStreaming(path string) bool {
+	mh, ok := p.handlers[path]
+	return ok && mh.streaming
+}
+
+// ProcessClientStreamRequest implements StreamingService: it calls the
+// streaming handler and encodes its replies.
+func (p *ServiceProcessor) ProcessClientStreamRequest(req *http.Request, path string,
+	buf []byte, stop chan bool) (<-chan []byte, error) {
+	mh, ok := p.handlers[path]
+	if !ok || !mh.streaming {
+		return nil, errors.New("The requested stream hasn't been registered: " + path)
+	}
+	msg, err := p.decode(mh, buf)
+	if err != nil {
+		return nil, err
+	}
+	ret := reflect.ValueOf(mh.handler).Call([]reflect.Value{reflect.ValueOf(msg)})
+	if ierr := ret[2].Interface(); ierr != nil {
+		return nil, ierr.(error)
+	}
+	replies := ret[0]
+	handlerStop := ret[1].Interface().(chan bool)
+
+	out := make(chan []byte)
+	go func() {
+		defer close(out)
+		// Forward the stop of the client to the handler.
+		defer func() {
+			if handlerStop != nil {
+				close(handlerStop)
+			}
+		}()
+		cases := []reflect.SelectCase{
+			{Dir: reflect.SelectRecv, Chan: replies},
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(stop)},
+		}
+		for {
+			chosen, reply, ok := reflect.Select(cases)
+			if chosen == 1 || !ok {
+				return
+			}
+			buf, err := protobuf.Encode(reply.Interface())
+			if err != nil {
+				log.Error("couldn't encode reply of stream:", err)
+				return
+			}
+			select {
+			case out <- buf:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// decode returns the request in buf for the handler, once it has been
+// validated.
+func (p *ServiceProcessor) decode(mh serviceHandler, buf []byte) (interface{}, error) {
+	msg := reflect.New(mh.msgType).Interface()
+	err := protobuf.DecodeWithConstructors(buf, msg,
+		network.DefaultConstructors(p.Context.server.Suite()))
+	if err != nil {
+		return nil, err
+	}
+	if err := mh.validate(msg); err != nil {
+		return nil, err
+	}
+	if err := p.checkPage(msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// stream sends the replies of a streaming endpoint until the stream ends
+// or the client disconnects.
+func (t wsHandler) stream(ws *websocket.Conn, ss StreamingService, r *http.Request,
+	path string, buf []byte, msgs <-chan wsMessage) (int, error) {
+	if t.ws != nil {
+		if l := t.ws.limiter(t.serviceName); l != nil {
+			if !l.acquire() {
+				return 0, ErrServiceBusy
+			}
+			defer l.release()
+		}
+	}
+	stop := make(chan bool)
+	defer close(stop)
+	out, err := ss.ProcessClientStreamRequest(r, path, buf, stop)
+	if err != nil {
+		return 0, err
+	}
+
+	tx := 0
+	for {
+		select {
+		case reply, ok := <-out:
+			if !ok {
+				ws.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+					time.Now().Add(time.Millisecond*500))
+				return tx, nil
+			}
+			if err := ws.WriteMessage(websocket.BinaryMessage, reply); err != nil {
+				return tx, err
+			}
+			tx += len(reply)
+		case m := <-msgs:
+			// The client doesn't send anything more, so a message only
+			// comes when it disconnects.
+			if m.err != nil {
+				log.Lvl3("Client of stream", path, "disconnected:", m.err)
+				return tx, nil
+			}
+		case <-r.Context().Done():
+			log.Lvl3("Stream", path, "cancelled:", r.Context().Err())
+			return tx, nil
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package onet
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dedis/onet/log"
+	"github.com/dedis/protobuf"
+	"github.com/stretchr/testify/require"
+)
+
+type streamMsg struct {
+	N int
+}
+
+type streamReply struct {
+	I int
+}
+
+func procStream(msg *streamMsg) (chan *streamReply, chan bool, error) {
+	replies := make(chan *streamReply)
+	stop := make(chan bool)
+	go func() {
+		defer close(replies)
+		for i := 0; msg.N == 0 || i < msg.N; i++ {
+			select {
+			case replies <- &streamReply{i}:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return replies, stop, nil
+}
+
+func procStreamWrong1(msg *streamMsg) (chan *streamReply, error) {
+	return nil, nil
+}
+
+func procStreamWrong2(msg *streamMsg) (chan streamReply, chan bool, error) {
+	return nil, nil, nil
+}
+
+func procStreamWrong3(msg *streamMsg) (chan *streamReply, chan int, error) {
+	return nil, nil, nil
+}
+
+func procStreamWrong4(msg streamMsg) (chan *streamReply, chan bool, error) {
+	return nil, nil, nil
+}
+
+func TestProcessor_RegisterStreamingHandler(t *testing.T) {
+	h1 := NewLocalServer(tSuite, 2000)
+	defer h1.Close()
+	p := NewServiceProcessor(&Context{server: h1})
+	require.Nil(t, p.RegisterStreamingHandler(procStream))
+	require.True(t, p.IsStreaming("streamMsg"))
+	require.Nil(t, p.RegisterHandler(procMsg))
+	require.False(t, p.IsStreaming("testMsg"))
+
+	for _, f := range []interface{}{procStreamWrong1, procStreamWrong2,
+		procStreamWrong3, procStreamWrong4, procMsg} {
+		fsig := reflect.TypeOf(f).String()
+		log.Lvl2("Checking function", fsig)
+		require.NotNil(t, p.RegisterStreamingHandler(f),
+			"Could register wrong function: "+fsig)
+	}
+
+	// A stream can't be used as a simple request.
+	buf, err := protobuf.Encode(&streamMsg{1})
+	require.Nil(t, err)
+	_, err = p.ProcessClientRequest(nil, "streamMsg", buf)
+	require.NotNil(t, err)
+}
+
+func TestProcessor_ProcessClientStreamRequest(t *testing.T) {
+	h1 := NewLocalServer(tSuite, 2000)
+	defer h1.Close()
+	p := NewServiceProcessor(&Context{server: h1})
+	require.Nil(t, p.RegisterStreamingHandler(procStream))
+
+	buf, err := protobuf.Encode(&streamMsg{5})
+	require.Nil(t, err)
+	out, err := p.ProcessClientStreamRequest(nil, "streamMsg", buf, make(chan bool))
+	require.Nil(t, err)
+	i := 0
+	for rep := range out {
+		val := &streamReply{}
+		require.Nil(t, protobuf.Decode(rep, val))
+		require.Equal(t, i, val.I)
+		i++
+	}
+	require.Equal(t, 5, i)
+
+	_, err = p.ProcessClientStreamRequest(nil, "testMsg", buf, make(chan bool))
+	require.NotNil(t, err)
+}
+
+func TestProcessor_ProcessClientStreamRequestStop(t *testing.T) {
+	h1 := NewLocalServer(tSuite, 2000)
+	defer h1.Close()
+	p := NewServiceProcessor(&Context{server: h1})
+	require.Nil(t, p.RegisterStreamingHandler(procStream))
+
+	// An endless stream stops when the client goes away.
+	buf, err := protobuf.Encode(&streamMsg{0})
+	require.Nil(t, err)
+	stop := make(chan bool)
+	out, err := p.ProcessClientStreamRequest(nil, "streamMsg", buf, stop)
+	require.Nil(t, err)
+	<-out
+	<-out
+	close(stop)
+	done := make(chan bool)
+	go func() {
+		for range out {
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("stream didn't stop")
+	}
+}
@@ -0,0 +1,219 @@
+// +build !js
+
+package onet
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/protobuf"
+)
+
+// ErrCursorExpired is returned by Subscribe if some events after the cursor
+// are not in the backlog anymore.
+var ErrCursorExpired = errors.New("cursor is older than the backlog of the stream")
+
+// DefaultStreamBacklog is the number of events kept per stream, unless
+// changed with SetStreamBacklog.
+const DefaultStreamBacklog = 1000
+
+// streamChannelLength is the number of events that can wait in the channel
+// of a subscription before it is closed.
+const streamChannelLength = 100
+
+// StreamEvent is an event published to a stream. The cursor increases with
+// every event of the stream, a client resumes after the last cursor it
+// received.
+type StreamEvent struct {
+	Cursor uint64
+	// Data is the protobuf-encoded message
+	Data []byte
+}
+
+// Subscription is a subscriber of a stream. It gets the events of the
+// backlog after its cursor, and then the new events on Events. If the
+// subscriber doesn't keep up, Events is closed and it has to subscribe
+// again with the cursor of the last event it got.
+type Subscription struct {
+	Backlog []StreamEvent
+	Events  <-chan StreamEvent
+	events  chan StreamEvent
+	hub     *streamHub
+	name    string
+}
+
+// streamHub holds the subscriptions and backlog sizes of all streams of a
+// server, indexed by the bucket of the stream.
+type streamHub struct {
+	backlogs map[string]int
+	subs     map[string]map[*Subscription]bool
+	// the authorizers of the sessions, by bucket of the service
+	auths map[string]SessionAuthorizer
+	sync.Mutex
+}
+
+// streamBucket returns the bucket of the stream, which is an additional
+// bucket of the service, so it counts in its storage quota.
+func (c *Context) streamBucket(stream string) []byte {
+	return append(append([]byte{}, c.bucketName...), []byte("_stream_"+stream)...)
+}
+
+// SetStreamBacklog sets the number of events of the stream kept for
+// clients that reconnect. The older events are removed when the next event
+// is published.
+func (c *Context) SetStreamBacklog(stream string, n int) {
+	h := &c.manager.streams
+	h.Lock()
+	defer h.Unlock()
+	if h.backlogs == nil {
+		h.backlogs = make(map[string]int)
+	}
+	h.backlogs[string(c.streamBucket(stream))] = n
+}
+
+// Publish adds msg to the backlog of the stream and sends it to the
+// subscribers. It returns the cursor of the new event, or ErrQuotaExceeded
+// if the backlog would make the service pass its storage quota.
+func (c *Context) Publish(stream string, msg interface{}) (uint64, error) {
+	buf, err := protobuf.Encode(msg)
+	if err != nil {
+		return 0, err
+	}
+	name := c.streamBucket(stream)
+	h := &c.manager.streams
+	h.Lock()
+	defer h.Unlock()
+	backlog, ok := h.backlogs[string(name)]
+	if !ok {
+		backlog = DefaultStreamBacklog
+	}
+	var ev StreamEvent
+	err = c.manager.dbUpdate(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(name)
+		if err != nil {
+			return err
+		}
+		ev.Cursor, err = b.NextSequence()
+		if err != nil {
+			return err
+		}
+		ev.Data = buf
+		key := cursorKey(ev.Cursor)
+		// Remove the events that are too old.
+		var old [][]byte
+		var delta int64
+		if backlog > 0 {
+			delta = int64(len(key) + len(buf))
+		}
+		cur := b.Cursor()
+		for k, v := cur.First(); k != nil &&
+			binary.BigEndian.Uint64(k)+uint64(backlog) <= ev.Cursor; k, v = cur.Next() {
+			old = append(old, k)
+			delta -= int64(len(k) + len(v))
+		}
+		if err := c.manager.quotas.charge(tx, string(c.bucketName), delta); err != nil {
+			return err
+		}
+		if backlog > 0 {
+			if err := b.Put(key, buf); err != nil {
+				return err
+			}
+		}
+		for _, k := range old {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if err != ErrQuotaExceeded {
+			c.manager.quotas.forget(string(c.bucketName))
+		}
+		return 0, err
+	}
+	for sub := range h.subs[string(name)] {
+		select {
+		case sub.events <- ev:
+		default:
+			log.Lvl2("Subscriber of", stream, "is too slow, closing")
+			h.remove(sub)
+		}
+	}
+	return ev.Cursor, nil
+}
+
+// Subscribe returns a subscription to the stream for the events after
+// cursor. A cursor of 0 gets all events of the backlog. If events after
+// the cursor have been removed from the backlog, ErrCursorExpired is
+// returned, and the client has to start again from 0.
+func (c *Context) Subscribe(stream string, cursor uint64) (*Subscription, error) {
+	name := c.streamBucket(stream)
+	h := &c.manager.streams
+	h.Lock()
+	defer h.Unlock()
+	sub := &Subscription{
+		events: make(chan StreamEvent, streamChannelLength),
+		hub:    h,
+		name:   string(name),
+	}
+	sub.Events = sub.events
+	err := c.manager.dbView(func(tx *bolt.Tx) error {
+		b := tx.Bucket(name)
+		if b == nil {
+			return nil
+		}
+		cur := b.Cursor()
+		first, _ := cur.First()
+		if cursor > 0 && first != nil && binary.BigEndian.Uint64(first) > cursor+1 {
+			return ErrCursorExpired
+		}
+		if cursor > 0 && first == nil && b.Sequence() > cursor {
+			return ErrCursorExpired
+		}
+		for k, v := cur.Seek(cursorKey(cursor + 1)); k != nil; k, v = cur.Next() {
+			sub.Backlog = append(sub.Backlog, StreamEvent{
+				Cursor: binary.BigEndian.Uint64(k),
+				Data:   append([]byte{}, v...),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if h.subs == nil {
+		h.subs = make(map[string]map[*Subscription]bool)
+	}
+	if h.subs[sub.name] == nil {
+		h.subs[sub.name] = make(map[*Subscription]bool)
+	}
+	h.subs[sub.name][sub] = true
+	return sub, nil
+}
+
+// Close stops the subscription and closes Events.
+func (s *Subscription) Close() {
+	s.hub.Lock()
+	defer s.hub.Unlock()
+	s.hub.remove(s)
+}
+
+// remove closes the subscription if it is still open. The caller must hold
+// the lock.
+func (h *streamHub) remove(sub *Subscription) {
+	if !h.subs[sub.name][sub] {
+		return
+	}
+	delete(h.subs[sub.name], sub)
+	close(sub.events)
+}
+
+func cursorKey(cursor uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, cursor)
+	return key
+}
@@ -0,0 +1,74 @@
+package onet
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestContext_SubscribeReplay(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "conode")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmp)
+	c := createContext(t, tmp)
+
+	sub, err := c.Subscribe("tx", 0)
+	require.Nil(t, err)
+	require.Equal(t, 0, len(sub.Backlog))
+	for i := 1; i <= 3; i++ {
+		cursor, err := c.Publish("tx", &SimpleResponse{i})
+		require.Nil(t, err)
+		require.Equal(t, uint64(i), cursor)
+	}
+	for i := 1; i <= 3; i++ {
+		require.Equal(t, uint64(i), (<-sub.Events).Cursor)
+	}
+	sub.Close()
+	_, ok := <-sub.Events
+	require.False(t, ok)
+	sub.Close()
+
+	// A client that got the first event resumes after it.
+	sub, err = c.Subscribe("tx", 1)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(sub.Backlog))
+	require.Equal(t, uint64(2), sub.Backlog[0].Cursor)
+	sub.Close()
+
+	c.SetStreamBacklog("tx", 2)
+	_, err = c.Publish("tx", &SimpleResponse{4})
+	require.Nil(t, err)
+	_, err = c.Subscribe("tx", 1)
+	require.Equal(t, ErrCursorExpired, err)
+	sub, err = c.Subscribe("tx", 0)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(sub.Backlog))
+	require.Equal(t, uint64(3), sub.Backlog[0].Cursor)
+	sub.Close()
+
+	// Other streams are independent.
+	sub, err = c.Subscribe("blocks", 0)
+	require.Nil(t, err)
+	require.Equal(t, 0, len(sub.Backlog))
+}
+
+func TestContext_SubscribeSlow(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "conode")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmp)
+	c := createContext(t, tmp)
+
+	sub, err := c.Subscribe("tx", 0)
+	require.Nil(t, err)
+	for i := 0; i <= streamChannelLength; i++ {
+		_, err := c.Publish("tx", &SimpleResponse{i})
+		require.Nil(t, err)
+	}
+	n := 0
+	for range sub.Events {
+		n++
+	}
+	require.Equal(t, streamChannelLength, n)
+}
@@ -0,0 +1,114 @@
+// +build !js
+
+package onet
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/dedis/onet/log"
+)
+
+// sdNotify sends state to the service manager, if the process was started by
+// systemd with a $NOTIFY_SOCKET. Nothing is sent otherwise.
+func sdNotify(state string) error {
+	name := os.Getenv("NOTIFY_SOCKET")
+	if name == "" {
+		return nil
+	}
+	if name[0] == '@' {
+		// abstract socket
+		name = "\x00" + name[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: name, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// sdWatchdogInterval returns the interval in which systemd expects a ping
+// from this process, as told by $WATCHDOG_USEC, and 0 if the watchdog is
+// not enabled.
+func sdWatchdogInterval() time.Duration {
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" &&
+		pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// notifySystemd tells systemd that the server is ready once the router
+// listens, and then pings the watchdog of systemd at half of its interval
+// for as long as the router is listening, if the watchdog is enabled. It
+// does nothing when the server wasn't started by systemd.
+func (c *Server) notifySystemd() {
+	if os.Getenv("NOTIFY_SOCKET") == "" {
+		return
+	}
+	c.reloadLock.Lock()
+	defer c.reloadLock.Unlock()
+	if c.systemdStop != nil {
+		return
+	}
+	stop := make(chan struct{})
+	c.systemdStop = stop
+	go func() {
+		for !c.Router.Listening() {
+			select {
+			case <-stop:
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+		if err := sdNotify("READY=1"); err != nil {
+			log.Error("Couldn't notify systemd:", err)
+			return
+		}
+		interval := sdWatchdogInterval()
+		if interval == 0 {
+			return
+		}
+		ticker := time.NewTicker(interval / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				// A router that stopped listening isn't serving anymore,
+				// so systemd is left to restart the server.
+				if !c.Router.Listening() {
+					log.Warn("Router isn't listening, stopping the watchdog pings")
+					return
+				}
+				if err := sdNotify("WATCHDOG=1"); err != nil {
+					log.Error("Couldn't ping the systemd watchdog:", err)
+				}
+			}
+		}
+	}()
+}
+
+// stopSystemd stops the notifications started by notifySystemd and tells
+// systemd that the server is stopping.
+func (c *Server) stopSystemd() {
+	c.reloadLock.Lock()
+	defer c.reloadLock.Unlock()
+	if c.systemdStop == nil {
+		return
+	}
+	close(c.systemdStop)
+	c.systemdStop = nil
+	if err := sdNotify("STOPPING=1"); err != nil {
+		log.Lvl2("Couldn't notify systemd:", err)
+	}
+}
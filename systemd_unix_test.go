@@ -0,0 +1,59 @@
+// +build freebsd linux darwin
+
+package onet
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSdNotify(t *testing.T) {
+	defer os.Unsetenv("NOTIFY_SOCKET")
+	os.Unsetenv("NOTIFY_SOCKET")
+	require.Nil(t, sdNotify("READY=1"))
+
+	dir, err := ioutil.TempDir("", "systemd")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: name, Net: "unixgram"})
+	require.Nil(t, err)
+	defer conn.Close()
+
+	os.Setenv("NOTIFY_SOCKET", name)
+	require.Nil(t, sdNotify("READY=1"))
+	buf := make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	require.Nil(t, err)
+	require.Equal(t, "READY=1", string(buf[:n]))
+
+	os.Setenv("NOTIFY_SOCKET", filepath.Join(dir, "missing"))
+	require.NotNil(t, sdNotify("READY=1"))
+}
+
+func TestSdWatchdogInterval(t *testing.T) {
+	defer os.Unsetenv("WATCHDOG_USEC")
+	defer os.Unsetenv("WATCHDOG_PID")
+	os.Unsetenv("WATCHDOG_PID")
+	os.Unsetenv("WATCHDOG_USEC")
+	require.Equal(t, time.Duration(0), sdWatchdogInterval())
+
+	os.Setenv("WATCHDOG_USEC", "2000000")
+	require.Equal(t, 2*time.Second, sdWatchdogInterval())
+	os.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	require.Equal(t, 2*time.Second, sdWatchdogInterval())
+	os.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()+1))
+	require.Equal(t, time.Duration(0), sdWatchdogInterval())
+
+	os.Unsetenv("WATCHDOG_PID")
+	os.Setenv("WATCHDOG_USEC", "soon")
+	require.Equal(t, time.Duration(0), sdWatchdogInterval())
+}
@@ -0,0 +1,237 @@
+// +build !js
+
+package onet
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+	"gopkg.in/satori/go.uuid.v1"
+)
+
+// Tenant is a set of services hosted by a server next to its default
+// services. The services of a tenant are separate instances: they have
+// their own ServiceID, storage and websocket path "/<tenant>/<service>/",
+// and only exchange messages with the services of the same tenant on other
+// servers. All tenants share the connections and the key of the server.
+type Tenant struct {
+	// Name is the name of the tenant, it must not contain a "/".
+	Name string
+	// Services are the names of the services to start for the tenant. If
+	// it is empty, all registered services are started.
+	Services []string
+	// ServiceConfigs holds the settings of the services of the tenant, by
+	// service name, see RegisterNewServiceWithConfig.
+	ServiceConfigs map[string]map[string]interface{}
+}
+
+// TenantMsg carries a message between the services of a tenant on
+// different servers.
+type TenantMsg struct {
+	Tenant string
+	Msg    []byte
+}
+
+// TenantMsgID is the message type of TenantMsg.
+var TenantMsgID = network.RegisterMessage(TenantMsg{})
+
+// tenant holds the running services of a Tenant, and dispatches the
+// messages sent to them.
+type tenant struct {
+	name     string
+	services map[ServiceID]Service
+	ids      map[string]ServiceID
+	network.Dispatcher
+}
+
+// tenantServiceID returns the ServiceID of the service name of the tenant.
+func tenantServiceID(tenant, name string) ServiceID {
+	return ServiceID(uuid.NewV5(uuid.NamespaceURL, tenant+"/"+name))
+}
+
+// service returns the service of the tenant with this name, or nil.
+func (tn *tenant) service(name string) Service {
+	id, ok := tn.ids[name]
+	if !ok {
+		return nil
+	}
+	return tn.services[id]
+}
+
+// wrap returns msg in a TenantMsg, so that the receiving server dispatches
+// it to the services of this tenant.
+func (tn *tenant) wrap(msg interface{}) (*TenantMsg, error) {
+	buf, err := network.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	return &TenantMsg{Tenant: tn.name, Msg: buf}, nil
+}
+
+// AddTenant starts the services of t on this server. The services of a
+// tenant can't be stopped, a tenant is removed by restarting the server
+// without it.
+func (c *Server) AddTenant(t Tenant) error {
+	return c.serviceManager.addTenant(t)
+}
+
+// Tenants returns the names of the tenants of this server, sorted.
+func (c *Server) Tenants() []string {
+	return c.serviceManager.tenantNames()
+}
+
+// TenantService returns the service name of the tenant, or nil if the
+// tenant doesn't exist or doesn't run this service.
+func (c *Server) TenantService(tenant, name string) Service {
+	tn := c.serviceManager.tenant(tenant)
+	if tn == nil {
+		return nil
+	}
+	return tn.service(name)
+}
+
+// addTenant checks t and starts its services. If a service fails to start,
+// the ones started before keep running.
+func (s *serviceManager) addTenant(t Tenant) error {
+	if t.Name == "" || strings.Contains(t.Name, "/") {
+		return errors.New("invalid tenant name \"" + t.Name + "\"")
+	}
+	if t.Name == OnetServiceName || !ServiceFactory.ServiceID(t.Name).Equal(NilServiceID) {
+		return errors.New("tenant name " + t.Name + " is the name of a service")
+	}
+	names := t.Services
+	if len(names) == 0 {
+		names = ServiceFactory.RegisteredServiceNames()
+	}
+	for _, name := range names {
+		if ServiceFactory.ServiceID(name).Equal(NilServiceID) {
+			return fmt.Errorf("tenant %s: unknown service %s", t.Name, name)
+		}
+	}
+	configs, err := parseServiceConfigs(t.ServiceConfigs)
+	if err != nil {
+		return fmt.Errorf("tenant %s: %s", t.Name, err)
+	}
+
+	s.tenantsMut.Lock()
+	if _, ok := s.tenants[t.Name]; ok {
+		s.tenantsMut.Unlock()
+		return errors.New("tenant " + t.Name + " already exists")
+	}
+	// Reserve the name while the services start, they might ask for
+	// the tenants of the server.
+	s.tenants[t.Name] = nil
+	s.tenantsMut.Unlock()
+	tn := &tenant{
+		name:       t.Name,
+		services:   make(map[ServiceID]Service),
+		ids:        make(map[string]ServiceID),
+		Dispatcher: network.NewRoutineDispatcher(),
+	}
+	defer func() {
+		s.tenantsMut.Lock()
+		s.tenants[t.Name] = tn
+		s.tenantsMut.Unlock()
+	}()
+	for _, name := range names {
+		bucket := t.Name + "/" + name
+		s.dbMut.RLock()
+		err := createBucketForService(s.db, bucket)
+		s.dbMut.RUnlock()
+		if err != nil {
+			return err
+		}
+		if err := s.migrateBucket(name, bucket); err != nil {
+			return err
+		}
+		id := tenantServiceID(t.Name, name)
+		cont := newContext(s.server, s.server.overlay, id, s)
+		cont.name = bucket
+		cont.bucketName = []byte(bucket)
+		cont.tenant = tn
+		cont.config = configs[name]
+		svc, err := ServiceFactory.start(name, cont)
+		if err != nil {
+			return fmt.Errorf("tenant %s: starting %s: %s", t.Name, name, err)
+		}
+		if err := replayJournal(svc, cont); err != nil {
+			return fmt.Errorf("tenant %s: replaying the journal of %s: %s", t.Name, name, err)
+		}
+		tn.services[id] = svc
+		tn.ids[name] = id
+		s.server.websocket.registerService(bucket, svc, cont)
+	}
+	log.Lvl3(s.server.Address(), "started tenant", t.Name)
+	return nil
+}
+
+// tenant returns the tenant with this name, or nil.
+func (s *serviceManager) tenant(name string) *tenant {
+	s.tenantsMut.RLock()
+	defer s.tenantsMut.RUnlock()
+	return s.tenants[name]
+}
+
+// tenantNames returns the names of all tenants, sorted.
+func (s *serviceManager) tenantNames() []string {
+	s.tenantsMut.RLock()
+	defer s.tenantsMut.RUnlock()
+	names := make([]string, 0, len(s.tenants))
+	for name := range s.tenants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// tenantService returns the service of a tenant with this id, and the name
+// it has on the websocket.
+func (s *serviceManager) tenantService(id ServiceID) (Service, string) {
+	s.tenantsMut.RLock()
+	defer s.tenantsMut.RUnlock()
+	for _, tn := range s.tenants {
+		if tn == nil {
+			continue
+		}
+		if svc, ok := tn.services[id]; ok {
+			for name, sid := range tn.ids {
+				if sid.Equal(id) {
+					return svc, tn.name + "/" + name
+				}
+			}
+		}
+	}
+	return nil, ""
+}
+
+// processTenantMsg unwraps a TenantMsg and dispatches it to the services of
+// its tenant.
+func (s *serviceManager) processTenantMsg(env *network.Envelope) {
+	tm, ok := env.Msg.(*TenantMsg)
+	if !ok {
+		return
+	}
+	tn := s.tenant(tm.Tenant)
+	if tn == nil {
+		log.Lvl2(s.server.Address(), "got a message for unknown tenant", tm.Tenant)
+		return
+	}
+	typ, msg, err := network.Unmarshal(tm.Msg, s.server.suite)
+	if err != nil {
+		log.Error("Invalid message for tenant", tm.Tenant, ":", err)
+		return
+	}
+	err = tn.Dispatch(&network.Envelope{
+		ServerIdentity: env.ServerIdentity,
+		MsgType:        typ,
+		Msg:            msg,
+		Size:           env.Size,
+	})
+	if err != nil {
+		log.Lvl2(s.server.Address(), "tenant", tm.Tenant, ":", err)
+	}
+}
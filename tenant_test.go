@@ -0,0 +1,97 @@
+package onet
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dedis/onet/network"
+	"github.com/stretchr/testify/require"
+)
+
+const tenantServiceName = "TenantService"
+
+type tenantTestMsg struct {
+	I int
+}
+
+var tenantTestMsgID = network.RegisterMessage(tenantTestMsg{})
+
+// tenantService forwards the tenantTestMsgs it gets to got.
+type tenantService struct {
+	c   *Context
+	got chan int
+}
+
+func init() {
+	RegisterNewService(tenantServiceName, func(c *Context) (Service, error) {
+		s := &tenantService{c: c, got: make(chan int, 10)}
+		c.RegisterProcessorFunc(tenantTestMsgID, func(env *network.Envelope) {
+			s.got <- env.Msg.(*tenantTestMsg).I
+		})
+		return s, nil
+	})
+}
+
+func (s *tenantService) NewProtocol(*TreeNodeInstance, *GenericConfig) (ProtocolInstance, error) {
+	return nil, nil
+}
+
+func (s *tenantService) ProcessClientRequest(*http.Request, string, []byte) ([]byte, error) {
+	return nil, nil
+}
+
+func (s *tenantService) Process(*network.Envelope) {}
+
+func requireGot(t *testing.T, s *tenantService, i int) {
+	select {
+	case got := <-s.got:
+		require.Equal(t, i, got)
+	case <-time.After(time.Second):
+		t.Fatal("didn't get", i)
+	}
+}
+
+func TestServer_AddTenant(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	servers := local.GenServers(2)
+	for _, s := range servers {
+		require.Nil(t, s.AddTenant(Tenant{Name: "staging",
+			Services: []string{tenantServiceName}}))
+	}
+	require.Equal(t, []string{"staging"}, servers[0].Tenants())
+	require.Nil(t, servers[0].TenantService("staging", ismServiceName))
+	require.Nil(t, servers[0].TenantService("prod", tenantServiceName))
+
+	def0 := servers[0].Service(tenantServiceName).(*tenantService)
+	def1 := servers[1].Service(tenantServiceName).(*tenantService)
+	ten0 := servers[0].TenantService("staging", tenantServiceName).(*tenantService)
+	ten1 := servers[1].TenantService("staging", tenantServiceName).(*tenantService)
+	require.NotEqual(t, def0.c.ServiceID(), ten0.c.ServiceID())
+	require.Equal(t, ten0, ten0.c.Service(tenantServiceName))
+
+	// The messages only reach the same tenant
+	require.Nil(t, def0.c.SendRaw(servers[1].ServerIdentity, &tenantTestMsg{1}))
+	requireGot(t, def1, 1)
+	require.Nil(t, ten0.c.SendRaw(servers[1].ServerIdentity, &tenantTestMsg{2}))
+	requireGot(t, ten1, 2)
+	require.Equal(t, 0, len(def1.got))
+
+	// The storage is separate
+	require.Nil(t, def0.c.Save([]byte("key"), &tenantTestMsg{3}))
+	v, err := ten0.c.Load([]byte("key"))
+	require.Nil(t, err)
+	require.Nil(t, v)
+	require.Nil(t, ten0.c.Save([]byte("key"), &tenantTestMsg{4}))
+	v, err = def0.c.Load([]byte("key"))
+	require.Nil(t, err)
+	require.Equal(t, 3, v.(*tenantTestMsg).I)
+
+	require.NotNil(t, servers[0].AddTenant(Tenant{Name: "staging"}))
+	require.NotNil(t, servers[0].AddTenant(Tenant{Name: "a/b"}))
+	require.NotNil(t, servers[0].AddTenant(Tenant{Name: tenantServiceName}))
+	require.NotNil(t, servers[0].AddTenant(Tenant{Name: "prod",
+		Services: []string{"unknown"}}))
+	require.Equal(t, []string{"staging"}, servers[0].Tenants())
+}
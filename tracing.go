@@ -0,0 +1,148 @@
+// +build !js
+
+package onet
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName is the name of the OpenTelemetry tracer used by onet. The spans
+// are only recorded once an application sets a tracer provider with
+// otel.SetTracerProvider.
+//
+// A client request is traced from the websocket to the service handler,
+// and from there to the protocol instances it starts on the other nodes of
+// the roster: the trace context is sent along with the protocol messages.
+// The client can give its own trace context in the traceparent header of
+// the websocket request.
+const TracerName = "github.com/dedis/onet"
+
+// tracePropagator encodes the trace context in the protocol messages and
+// reads it from the websocket requests. It is always the W3C trace context,
+// whatever the global propagator of the application is.
+var tracePropagator propagation.TextMapPropagator = propagation.TraceContext{}
+
+func tracer() trace.Tracer {
+	return otel.Tracer(TracerName)
+}
+
+// injectTrace returns the trace context of ctx as it is sent in the
+// messages, or nil if there is no span in ctx.
+func injectTrace(ctx context.Context) map[string]string {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return nil
+	}
+	carrier := propagation.MapCarrier{}
+	tracePropagator.Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return nil
+	}
+	return carrier
+}
+
+// extractTrace returns ctx with the remote span of the trace context tc, as
+// returned by injectTrace.
+func extractTrace(ctx context.Context, tc map[string]string) context.Context {
+	if len(tc) == 0 {
+		return ctx
+	}
+	return tracePropagator.Extract(ctx, propagation.MapCarrier(tc))
+}
+
+// requestContext returns the context of the request, or the background
+// context if there is no request.
+func requestContext(r *http.Request) context.Context {
+	if r == nil {
+		return context.Background()
+	}
+	return r.Context()
+}
+
+// endSpan ends the span, and marks it as failed if err is not nil.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// startSpan starts the span of a websocket request, which continues the
+// trace of the client if it sent one in the headers.
+func (t wsHandler) startSpan(r *http.Request, path string) (context.Context, trace.Span) {
+	ctx := tracePropagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	return tracer().Start(ctx, "onet.websocket "+t.serviceName+"/"+path,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("onet.service", t.serviceName),
+			attribute.String("onet.path", path),
+			attribute.String("net.peer.addr", r.RemoteAddr)))
+}
+
+// protocolTrace holds the span of a protocol instance. It is started the
+// first time it is needed, so that SetTraceContext can still choose its
+// parent after the instance has been created.
+type protocolTrace struct {
+	parent context.Context
+	ctx    context.Context
+	span   trace.Span
+	ended  bool
+	sync.Mutex
+}
+
+// SetTraceContext makes the span of the protocol instance a child of the
+// span in ctx, typically the one of the client request given to the
+// service. It must be called before the protocol is started, and has no
+// effect afterwards.
+func (n *TreeNodeInstance) SetTraceContext(ctx context.Context) {
+	n.trace.Lock()
+	defer n.trace.Unlock()
+	if n.trace.span == nil {
+		n.trace.parent = ctx
+	}
+}
+
+// TraceContext returns a context with the span of the protocol instance,
+// for example to create child spans of the steps of the protocol.
+func (n *TreeNodeInstance) TraceContext() context.Context {
+	n.trace.Lock()
+	defer n.trace.Unlock()
+	if n.trace.span == nil && !n.trace.ended {
+		parent := n.trace.parent
+		if parent == nil {
+			parent = context.Background()
+		}
+		n.trace.ctx, n.trace.span = tracer().Start(parent,
+			"onet.protocol "+n.ProtocolName(),
+			trace.WithAttributes(
+				attribute.String("onet.protocol", n.ProtocolName()),
+				attribute.String("onet.server", n.ServerIdentity().Address.String()),
+				attribute.String("onet.token", n.TokenID().String()),
+				attribute.Bool("onet.root", n.IsRoot())))
+	}
+	return n.trace.ctx
+}
+
+// traceEvent adds an event to the span of the instance.
+func (n *TreeNodeInstance) traceEvent(name string) {
+	trace.SpanFromContext(n.TraceContext()).AddEvent(name)
+}
+
+// endTrace ends the span of the instance, if it has been started.
+func (n *TreeNodeInstance) endTrace() {
+	n.trace.Lock()
+	defer n.trace.Unlock()
+	if n.trace.span == nil || n.trace.ended {
+		return
+	}
+	n.trace.ended = true
+	endSpan(n.trace.span, n.AbortError())
+}
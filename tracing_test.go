@@ -0,0 +1,131 @@
+package onet
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dedis/onet/log"
+	"github.com/dedis/protobuf"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordSpans installs a tracer provider recording all spans, until the
+// returned function is called.
+func recordSpans() (*tracetest.SpanRecorder, func()) {
+	old := otel.GetTracerProvider()
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	return sr, func() { otel.SetTracerProvider(old) }
+}
+
+// findSpans returns the ended spans with the given name.
+func findSpans(sr *tracetest.SpanRecorder, name string) []sdktrace.ReadOnlySpan {
+	var spans []sdktrace.ReadOnlySpan
+	for _, s := range sr.Ended() {
+		if s.Name() == name {
+			spans = append(spans, s)
+		}
+	}
+	return spans
+}
+
+func TestTracing_InjectExtract(t *testing.T) {
+	_, restore := recordSpans()
+	defer restore()
+
+	require.Nil(t, injectTrace(context.Background()))
+	ctx, span := tracer().Start(context.Background(), "test")
+	defer span.End()
+	tc := injectTrace(ctx)
+	require.NotNil(t, tc)
+
+	remote := trace.SpanContextFromContext(extractTrace(context.Background(), tc))
+	require.True(t, remote.IsRemote())
+	require.Equal(t, span.SpanContext().TraceID(), remote.TraceID())
+	require.Equal(t, span.SpanContext().SpanID(), remote.SpanID())
+}
+
+func TestTracing_ProtoIO(t *testing.T) {
+	tc := map[string]string{"traceparent": "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"}
+	io := &defaultProtoIO{suite: tSuite}
+	wrapped, err := io.Wrap(&SimpleMessage{3}, &OverlayMsg{
+		TreeNodeInfo: &TreeNodeInfo{From: &Token{}, To: &Token{}},
+		TraceContext: tc,
+	})
+	require.Nil(t, err)
+	require.Equal(t, tc, wrapped.(*ProtocolMsg).TraceContext)
+	_, info, err := io.Unwrap(wrapped)
+	require.Nil(t, err)
+	require.Equal(t, tc, info.TraceContext)
+}
+
+func procMsgContext(ctx context.Context, msg *testMsg) (*testMsg, error) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return nil, errors.New("no span in the context")
+	}
+	return msg, nil
+}
+
+func TestTracing_ServiceProcessor(t *testing.T) {
+	sr, restore := recordSpans()
+	defer restore()
+	h1 := NewLocalServer(tSuite, 2000)
+	defer h1.Close()
+	p := NewServiceProcessor(&Context{server: h1})
+	log.ErrFatal(p.RegisterHandler(procMsgContext))
+
+	buf, err := protobuf.Encode(&testMsg{11})
+	log.ErrFatal(err)
+	req := httptest.NewRequest("GET", "/testService/testMsg", nil)
+	req.Header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	ctx, span := wsHandler{serviceName: testServiceName}.startSpan(req, "testMsg")
+	_, err = p.ProcessClientRequest(req.WithContext(ctx), "testMsg", buf)
+	require.Nil(t, err)
+	span.End()
+
+	ws := findSpans(sr, "onet.websocket testService/testMsg")
+	require.Equal(t, 1, len(ws))
+	require.Equal(t, "0af7651916cd43dd8448eb211c80319c", ws[0].SpanContext().TraceID().String())
+	dispatch := findSpans(sr, "onet.service testMsg")
+	require.Equal(t, 1, len(dispatch))
+	require.Equal(t, ws[0].SpanContext().SpanID(), dispatch[0].Parent().SpanID())
+}
+
+// A protocol started for a request has its spans on all nodes of the tree
+// in the trace of the request.
+func TestTracing_Protocol(t *testing.T) {
+	sr, restore := recordSpans()
+	defer restore()
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	tni := newLimitedInstance(t, local, ProtocolLimits{})
+
+	ctx, span := tracer().Start(context.Background(), "request")
+	tni.SetTraceContext(ctx)
+	require.Nil(t, tni.SendToChildren(&SimpleMessage{1}))
+	span.End()
+
+	traceID := span.SpanContext().TraceID()
+	for i := 0; i < 50; i++ {
+		var nodes int
+		for _, s := range sr.Started() {
+			if s.Name() == "onet.protocol ProtocolOverlay" &&
+				s.SpanContext().TraceID() == traceID {
+				nodes++
+			}
+		}
+		if nodes == len(tni.Tree().List()) {
+			require.NotEmpty(t, findSpans(sr, "onet.overlay.process"))
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("the protocol spans of the children are not in the trace")
+}
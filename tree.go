@@ -1,10 +1,10 @@
 package onet
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
-
-	"math/rand"
+	"sync"
 
 	"github.com/dedis/kyber"
 	"github.com/dedis/onet/log"
@@ -36,6 +36,30 @@ type Tree struct {
 	ID     TreeID
 	Roster *Roster
 	Root   *TreeNode
+	// index speeds up Search, it is nil if the tree has been created
+	// without NewTree or MakeTree.
+	index *treeIndex
+}
+
+// treeIndex maps the TreeNodeIDs of a tree to its nodes.
+type treeIndex struct {
+	nodes map[TreeNodeID]*TreeNode
+	sync.Mutex
+}
+
+// get returns the node with the given id. As nodes can be added to the tree
+// after its creation, the index is rebuilt if id is not found.
+func (ti *treeIndex) get(root *TreeNode, id TreeNodeID) *TreeNode {
+	ti.Lock()
+	defer ti.Unlock()
+	if tn, ok := ti.nodes[id]; ok {
+		return tn
+	}
+	ti.nodes = make(map[TreeNodeID]*TreeNode)
+	root.Visit(0, func(d int, tn *TreeNode) {
+		ti.nodes[tn.ID] = tn
+	})
+	return ti.nodes[id]
 }
 
 // TreeID uniquely identifies a Tree struct in the onet framework.
@@ -70,6 +94,7 @@ func NewTree(roster *Roster, root *TreeNode) *Tree {
 		Roster: roster,
 		Root:   root,
 		ID:     TreeID(uuid.NewV5(uuid.NamespaceURL, url)),
+		index:  &treeIndex{},
 	}
 	t.computeSubtreeAggregate(root)
 	return t
@@ -168,21 +193,25 @@ func (t *Tree) String() string {
 
 // Dump returns string about the tree
 func (t *Tree) Dump() string {
-	ret := "Tree " + t.ID.String() + " is:"
+	var ret bytes.Buffer
+	ret.WriteString("Tree " + t.ID.String() + " is:")
 	t.Root.Visit(0, func(d int, tn *TreeNode) {
 		if tn.Parent != nil {
-			ret += fmt.Sprintf("\n%d - %s/%s has parent %s/%s", d,
+			fmt.Fprintf(&ret, "\n%d - %s/%s has parent %s/%s", d,
 				tn.ServerIdentity.Public, tn.ServerIdentity.Address,
 				tn.Parent.ServerIdentity.Public, tn.Parent.ServerIdentity.Address)
 		} else {
-			ret += fmt.Sprintf("\n%s/%s is root", tn.ServerIdentity.Public, tn.ServerIdentity.Address)
+			fmt.Fprintf(&ret, "\n%s/%s is root", tn.ServerIdentity.Public, tn.ServerIdentity.Address)
 		}
 	})
-	return ret
+	return ret.String()
 }
 
 // Search searches the Tree for the given TreeNodeID and returns the corresponding TreeNode
 func (t *Tree) Search(tn TreeNodeID) (ret *TreeNode) {
+	if t.index != nil {
+		return t.index.get(t.Root, tn)
+	}
 	found := func(d int, tns *TreeNode) {
 		if tns.ID.Equal(tn) {
 			ret = tns
@@ -207,19 +236,17 @@ func (t *Tree) IsBinary(root *TreeNode) bool {
 	return t.IsNary(root, 2)
 }
 
-// IsNary returns true if every node has two or no children
+// IsNary returns true if every node has N or no children
 func (t *Tree) IsNary(root *TreeNode, N int) bool {
-	nChild := len(root.Children)
-	if nChild != N && nChild != 0 {
-		log.Lvl3("Only", nChild, "children for", root.ID)
-		return false
-	}
-	for _, c := range root.Children {
-		if !t.IsNary(c, N) {
-			return false
+	nary := true
+	root.Visit(0, func(d int, tn *TreeNode) {
+		nChild := len(tn.Children)
+		if nary && nChild != N && nChild != 0 {
+			log.Lvl3("Only", nChild, "children for", tn.ID)
+			nary = false
 		}
-	}
-	return true
+	})
+	return nary
 }
 
 // Size returns the number of all TreeNodes
@@ -252,23 +279,28 @@ func (t *Tree) UsesList() bool {
 
 // computeSubtreeAggregate will compute the aggregate subtree public key for
 // each node of the tree.
-// root is the root of the subtree we want to compute the aggregate for
-// recursive function so it will go down to the leaves then go up to the root
+// root is the root of the subtree we want to compute the aggregate for.
+// The nodes are handled in reverse depth-first order, so that the children
+// are always done before their parent.
 // Return the aggregate sub tree public key for this root (and compute each sub
 // aggregate public key for each of the children).
 func (t *Tree) computeSubtreeAggregate(root *TreeNode) kyber.Point {
-	// Cloning the root public key does two things for us. First, it
-	// gets agg set to the right kind of kyber.Group for this tree.
-	// Second, it is the first component of the aggregate. The rest
-	// of the subtree aggregates are added via the DFS.
-	agg := root.ServerIdentity.Public.Clone()
-
-	// DFS search
-	for _, ch := range root.Children {
-		agg = agg.Add(agg, t.computeSubtreeAggregate(ch))
+	var nodes []*TreeNode
+	root.Visit(0, func(d int, tn *TreeNode) {
+		nodes = append(nodes, tn)
+	})
+	for i := len(nodes) - 1; i >= 0; i-- {
+		tn := nodes[i]
+		// Cloning the public key does two things for us. First, it
+		// gets agg set to the right kind of kyber.Group for this tree.
+		// Second, it is the first component of the aggregate.
+		agg := tn.ServerIdentity.Public.Clone()
+		for _, ch := range tn.Children {
+			agg = agg.Add(agg, ch.PublicAggregateSubTree)
+		}
+		tn.PublicAggregateSubTree = agg
 	}
-	root.PublicAggregateSubTree = agg
-	return agg
+	return root.PublicAggregateSubTree
 }
 
 // TreeMarshal is used to send and receive a tree-structure without having
@@ -288,12 +320,17 @@ type TreeMarshal struct {
 }
 
 func (tm *TreeMarshal) String() string {
-	s := fmt.Sprintf("%v", tm.ServerIdentityID)
-	s += "\n"
-	for i := range tm.Children {
-		s += tm.Children[i].String()
+	var s bytes.Buffer
+	stack := []*TreeMarshal{tm}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		fmt.Fprintf(&s, "%v\n", n.ServerIdentityID)
+		for i := len(n.Children) - 1; i >= 0; i-- {
+			stack = append(stack, n.Children[i])
+		}
 	}
-	return s
+	return s.String()
 }
 
 // TreeMarshalTypeID of TreeMarshal message as registered in network
@@ -302,13 +339,26 @@ var TreeMarshalTypeID = network.RegisterMessage(TreeMarshal{})
 // TreeMarshalCopyTree takes a TreeNode and returns a corresponding
 // TreeMarshal
 func TreeMarshalCopyTree(tr *TreeNode) *TreeMarshal {
-	tm := &TreeMarshal{
-		TreeNodeID:       tr.ID,
-		ServerIdentityID: tr.ServerIdentity.ID,
+	copyNode := func(tn *TreeNode) *TreeMarshal {
+		return &TreeMarshal{
+			TreeNodeID:       tn.ID,
+			ServerIdentityID: tn.ServerIdentity.ID,
+		}
 	}
-	for i := range tr.Children {
-		tm.Children = append(tm.Children,
-			TreeMarshalCopyTree(tr.Children[i]))
+	type pair struct {
+		tn *TreeNode
+		tm *TreeMarshal
+	}
+	tm := copyNode(tr)
+	stack := []pair{{tr, tm}}
+	for len(stack) > 0 {
+		p := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, c := range p.tn.Children {
+			ctm := copyNode(c)
+			p.tm.Children = append(p.tm.Children, ctm)
+			stack = append(stack, pair{c, ctm})
+		}
 	}
 	return tm
 }
@@ -321,6 +371,7 @@ func (tm TreeMarshal) MakeTree(ro *Roster) (*Tree, error) {
 	tree := &Tree{
 		ID:     tm.TreeID,
 		Roster: ro,
+		index:  &treeIndex{},
 	}
 	tree.Root = tm.Children[0].MakeTreeFromList(nil, ro)
 	tree.computeSubtreeAggregate(tree.Root)
@@ -329,16 +380,29 @@ func (tm TreeMarshal) MakeTree(ro *Roster) (*Tree, error) {
 
 // MakeTreeFromList creates a sub-tree given an Roster
 func (tm *TreeMarshal) MakeTreeFromList(parent *TreeNode, ro *Roster) *TreeNode {
-	idx, ent := ro.Search(tm.ServerIdentityID)
-	tn := &TreeNode{
-
-		Parent:         parent,
-		ID:             tm.TreeNodeID,
-		ServerIdentity: ent,
-		RosterIndex:    idx,
+	makeNode := func(tm *TreeMarshal, parent *TreeNode) *TreeNode {
+		idx, ent := ro.Search(tm.ServerIdentityID)
+		return &TreeNode{
+			Parent:         parent,
+			ID:             tm.TreeNodeID,
+			ServerIdentity: ent,
+			RosterIndex:    idx,
+		}
 	}
-	for _, c := range tm.Children {
-		tn.Children = append(tn.Children, c.MakeTreeFromList(tn, ro))
+	type pair struct {
+		tm *TreeMarshal
+		tn *TreeNode
+	}
+	tn := makeNode(tm, parent)
+	stack := []pair{{tm, tn}}
+	for len(stack) > 0 {
+		p := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, c := range p.tm.Children {
+			ctn := makeNode(c, p.tn)
+			p.tn.Children = append(p.tn.Children, ctn)
+			stack = append(stack, pair{c, ctn})
+		}
 	}
 	return tn
 }
@@ -350,6 +414,8 @@ type Roster struct {
 	// List is the list of actual entities.
 	List      []*network.ServerIdentity
 	Aggregate kyber.Point
+	// Signatures of the members of the List on the Roster, see Sign.
+	Signatures []RosterSignature
 }
 
 // RosterID uniquely identifies an Roster
@@ -383,7 +449,7 @@ func NewRoster(ids []*network.ServerIdentity) *Roster {
 	}
 
 	r := &Roster{
-		ID: RosterID(uuid.NewV4()),
+		ID: RosterID(newUUID()),
 	}
 	// Take a copy of ids, in case the caller tries to change it later.
 	r.List = append(r.List, ids...)
@@ -589,16 +655,20 @@ func (ro *Roster) GenerateStar() *Tree {
 	return ro.GenerateNaryTree(len(ro.List) - 1)
 }
 
-// RandomServerIdentity returns a random element of the Roster.
+// RandomServerIdentity returns a random element of the Roster. In the
+// deterministic mode, the choice comes from the seed of the process, see
+// SetSeed.
 func (ro *Roster) RandomServerIdentity() *network.ServerIdentity {
 	if ro.List == nil || len(ro.List) == 0 {
 		return nil
 	}
-	return ro.List[rand.Int()%len(ro.List)]
+	return ro.List[randIntn(len(ro.List))]
 }
 
 // RandomSubset returns a new Roster which starts with root and is
-// followed by a random subset of n elements of ro, not including root.
+// followed by a random subset of n elements of ro, not including root. In
+// the deterministic mode, the subset comes from the seed of the process,
+// see SetSeed.
 func (ro *Roster) RandomSubset(root *network.ServerIdentity, n int) *Roster {
 	if n > len(ro.List) {
 		n = len(ro.List)
@@ -606,7 +676,7 @@ func (ro *Roster) RandomSubset(root *network.ServerIdentity, n int) *Roster {
 	out := make([]*network.ServerIdentity, 1, n+1)
 	out[0] = root
 
-	perm := rand.Perm(len(ro.List))
+	perm := randPerm(len(ro.List))
 	for _, p := range perm {
 		if !ro.List[p].ID.Equal(root.ID) {
 			out = append(out, ro.List[p])
@@ -687,7 +757,7 @@ func NewTreeNode(entityIdx int, ni *network.ServerIdentity) *TreeNode {
 		RosterIndex:    entityIdx,
 		Parent:         nil,
 		Children:       make([]*TreeNode, 0),
-		ID:             TreeNodeID(uuid.NewV4()),
+		ID:             TreeNodeID(newUUID()),
 	}
 	return tn
 }
@@ -732,21 +802,24 @@ func (t *TreeNode) AddChild(c *TreeNode) {
 	c.Parent = t
 }
 
-// Equal tests if that node is equal to the given node
+// Equal tests if that node is equal to the given node, including all
+// their children.
 func (t *TreeNode) Equal(t2 *TreeNode) bool {
-	if !t.ID.Equal(t2.ID) || !t.ServerIdentity.ID.Equal(t2.ServerIdentity.ID) {
-		log.Lvl4("TreeNode: ids are not equal")
-		return false
-	}
-	if len(t.Children) != len(t2.Children) {
-		log.Lvl4("TreeNode: number of children are not equal")
-		return false
-	}
-	for i, c := range t.Children {
-		if !c.Equal(t2.Children[i]) {
-			log.Lvl4("TreeNode: children are not equal")
+	stack := [][2]*TreeNode{{t, t2}}
+	for len(stack) > 0 {
+		a, b := stack[len(stack)-1][0], stack[len(stack)-1][1]
+		stack = stack[:len(stack)-1]
+		if !a.ID.Equal(b.ID) || !a.ServerIdentity.ID.Equal(b.ServerIdentity.ID) {
+			log.Lvl4("TreeNode: ids are not equal")
 			return false
 		}
+		if len(a.Children) != len(b.Children) {
+			log.Lvl4("TreeNode: number of children are not equal")
+			return false
+		}
+		for i, c := range a.Children {
+			stack = append(stack, [2]*TreeNode{c, b.Children[i]})
+		}
 	}
 	return true
 }
@@ -756,12 +829,21 @@ func (t *TreeNode) String() string {
 	return string(t.ID.String())
 }
 
-// Visit is a recursive function that allows for depth-first calling on all
-// nodes
+// Visit allows for depth-first calling on all nodes. It uses an explicit
+// stack, so that very deep trees can be visited.
 func (t *TreeNode) Visit(firstDepth int, fn func(depth int, n *TreeNode)) {
-	fn(firstDepth, t)
-	for _, c := range t.Children {
-		c.Visit(firstDepth+1, fn)
+	type entry struct {
+		tn    *TreeNode
+		depth int
+	}
+	stack := []entry{{t, firstDepth}}
+	for len(stack) > 0 {
+		e := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		fn(e.depth, e.tn)
+		for i := len(e.tn.Children) - 1; i >= 0; i-- {
+			stack = append(stack, entry{e.tn.Children[i], e.depth + 1})
+		}
 	}
 }
 
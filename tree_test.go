@@ -12,6 +12,7 @@ import (
 	"github.com/dedis/onet/log"
 	"github.com/dedis/onet/network"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var prefix = "127.0.0.1:"
@@ -621,3 +622,60 @@ func genLocalTree(count, port int) (*Tree, *Roster) {
 	tree := peerList.GenerateBinaryTree()
 	return tree, peerList
 }
+
+// Chain-shaped trees with thousands of nodes must be handled without
+// recursion.
+func TestTree_DeepChain(t *testing.T) {
+	depth := 5000
+	ro := genRoster(tSuite, genLocalhostPeerNames(3, 2000))
+	root := NewTreeNode(0, ro.List[0])
+	last := root
+	for i := 1; i < depth; i++ {
+		tn := NewTreeNode(i%3, ro.List[i%3])
+		last.AddChild(tn)
+		last = tn
+	}
+	tree := NewTree(ro, root)
+	require.Equal(t, depth, tree.Size())
+	require.Equal(t, depth-1, root.SubtreeCount())
+	require.True(t, tree.IsNary(root, 1))
+	require.Equal(t, last, tree.Search(last.ID))
+
+	var depths []int
+	root.Visit(0, func(d int, tn *TreeNode) {
+		depths = append(depths, d)
+	})
+	require.Equal(t, depth-1, depths[depth-1])
+
+	agg := tSuite.Point().Null()
+	for _, tn := range tree.List() {
+		agg.Add(agg, tn.ServerIdentity.Public)
+	}
+	require.True(t, agg.Equal(root.PublicAggregateSubTree))
+
+	tm := tree.MakeTreeMarshal()
+	tree2, err := tm.MakeTree(ro)
+	require.Nil(t, err)
+	require.True(t, tree.Equal(tree2))
+	require.Equal(t, last.ID, tree2.Search(last.ID).ID)
+
+	// Nodes added after the creation of the tree are found, too.
+	tn := NewTreeNode(0, ro.List[0])
+	last.AddChild(tn)
+	require.Equal(t, tn, tree.Search(tn.ID))
+	require.False(t, tree.Equal(tree2))
+}
+
+func TestTree_VisitOrder(t *testing.T) {
+	tree, _ := genLocalTree(7, 2000)
+	var order []*TreeNode
+	var visit func(tn *TreeNode)
+	visit = func(tn *TreeNode) {
+		order = append(order, tn)
+		for _, c := range tn.Children {
+			visit(c)
+		}
+	}
+	visit(tree.Root)
+	require.Equal(t, order, tree.List())
+}
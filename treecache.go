@@ -0,0 +1,296 @@
+// +build !js
+
+package onet
+
+import (
+	"sync"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+)
+
+// DefaultTreeCacheTTL is how long the trees and rosters known to the
+// overlay are kept in the database once they are not used anymore.
+const DefaultTreeCacheTTL = 24 * time.Hour
+
+// treeCacheGCEvery is how often the stored trees and rosters are collected.
+var treeCacheGCEvery = time.Hour
+
+var treeCacheBucket = []byte("onet_trees")
+var rosterCacheBucket = []byte("onet_rosters")
+
+// storedTree is a tree in the database, with the time it was stored or
+// last seen in use.
+type storedTree struct {
+	Stored int64
+	Tree   *TreeMarshal
+}
+
+// storedRoster is a roster in the database, with the time it was stored or
+// last seen in use.
+type storedRoster struct {
+	Stored int64
+	Roster *Roster
+}
+
+func init() {
+	network.RegisterMessages(&storedTree{}, &storedRoster{})
+}
+
+// treeCache keeps the trees and rosters of the overlay in the database, so
+// that a restarted server knows them without asking its peers.
+type treeCache struct {
+	ttl      time.Duration
+	stopCh   chan bool
+	stopOnce sync.Once
+	sync.Mutex
+}
+
+func newTreeCache() *treeCache {
+	return &treeCache{ttl: DefaultTreeCacheTTL, stopCh: make(chan bool)}
+}
+
+func (tc *treeCache) stop() {
+	tc.stopOnce.Do(func() { close(tc.stopCh) })
+}
+
+// SetTreeCacheTTL sets how long the trees and rosters are kept in the
+// database of the server once they are not used anymore. A ttl of 0 stops
+// the storing and removes the stored ones at the next collection.
+func (c *Server) SetTreeCacheTTL(ttl time.Duration) {
+	c.overlay.treeCache.Lock()
+	c.overlay.treeCache.ttl = ttl
+	c.overlay.treeCache.Unlock()
+}
+
+func (tc *treeCache) getTTL() time.Duration {
+	tc.Lock()
+	defer tc.Unlock()
+	return tc.ttl
+}
+
+// cacheDB returns the serviceManager holding the database, or nil if the
+// server has none yet or the cache is disabled.
+func (o *Overlay) cacheDB() *serviceManager {
+	if o.treeCache.getTTL() <= 0 {
+		return nil
+	}
+	return o.server.serviceManager
+}
+
+// storeTree writes the tree to the database.
+func (o *Overlay) storeTree(t *Tree) {
+	sm := o.cacheDB()
+	if sm == nil {
+		return
+	}
+	buf, err := network.Marshal(&storedTree{time.Now().UnixNano(), t.MakeTreeMarshal()})
+	if err == nil {
+		err = sm.dbUpdate(func(tx *bolt.Tx) error {
+			b, err := tx.CreateBucketIfNotExists(treeCacheBucket)
+			if err != nil {
+				return err
+			}
+			return b.Put(t.ID[:], buf)
+		})
+	}
+	if err != nil {
+		log.Error("Couldn't store tree:", err)
+	}
+}
+
+// storeRoster writes the roster to the database.
+func (o *Overlay) storeRoster(ro *Roster) {
+	sm := o.cacheDB()
+	if sm == nil {
+		return
+	}
+	buf, err := network.Marshal(&storedRoster{time.Now().UnixNano(), ro})
+	if err == nil {
+		err = sm.dbUpdate(func(tx *bolt.Tx) error {
+			b, err := tx.CreateBucketIfNotExists(rosterCacheBucket)
+			if err != nil {
+				return err
+			}
+			return b.Put(ro.ID[:], buf)
+		})
+	}
+	if err != nil {
+		log.Error("Couldn't store roster:", err)
+	}
+}
+
+// loadStored returns the message stored under the key in the bucket, or
+// nil if there is none or it expired.
+func (o *Overlay) loadStored(bucket, key []byte) network.Message {
+	sm := o.cacheDB()
+	if sm == nil {
+		return nil
+	}
+	var buf []byte
+	err := sm.dbView(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(bucket); b != nil {
+			if v := b.Get(key); v != nil {
+				buf = append([]byte{}, v...)
+			}
+		}
+		return nil
+	})
+	if err != nil || buf == nil {
+		return nil
+	}
+	_, msg, err := network.Unmarshal(buf, o.suite())
+	if err != nil {
+		log.Error("Dropping invalid stored tree or roster:", err)
+		return nil
+	}
+	if time.Since(storedTime(msg)) > o.treeCache.getTTL() {
+		return nil
+	}
+	return msg
+}
+
+// loadRoster returns the stored roster with the given ID, or nil.
+func (o *Overlay) loadRoster(id RosterID) *Roster {
+	sr, ok := o.loadStored(rosterCacheBucket, id[:]).(*storedRoster)
+	if !ok {
+		return nil
+	}
+	log.Lvl3(o.server.Address(), "loaded roster", id, "from the database")
+	return sr.Roster
+}
+
+// loadTree returns the stored tree with the given ID, or nil. Its roster
+// must be known or stored, too.
+func (o *Overlay) loadTree(id TreeID) *Tree {
+	st, ok := o.loadStored(treeCacheBucket, id[:]).(*storedTree)
+	if !ok {
+		return nil
+	}
+	ro := o.Roster(st.Tree.RosterID)
+	if ro == nil {
+		return nil
+	}
+	t, err := st.Tree.MakeTree(ro)
+	if err != nil {
+		log.Error("Couldn't make stored tree:", err)
+		return nil
+	}
+	log.Lvl3(o.server.Address(), "loaded tree", id, "from the database")
+	return t
+}
+
+// treeCacheGC collects the stored trees and rosters every treeCacheGCEvery
+// until the overlay stops.
+func (o *Overlay) treeCacheGC() {
+	for {
+		select {
+		case <-o.treeCache.stopCh:
+			return
+		case <-time.After(treeCacheGCEvery):
+			if err := o.collectStored(); err != nil {
+				log.Error("Couldn't collect stored trees:", err)
+			}
+		}
+	}
+}
+
+// collectStored removes the trees and rosters that expired, and marks the
+// ones still in memory as used now, so that they are kept as long as they
+// are in use.
+func (o *Overlay) collectStored() error {
+	sm := o.server.serviceManager
+	if sm == nil {
+		return nil
+	}
+	ttl := o.treeCache.getTTL()
+	now := time.Now()
+	inUse := func(bucket, k []byte) bool {
+		if string(bucket) == string(treeCacheBucket) {
+			var id TreeID
+			copy(id[:], k)
+			o.treesMut.Lock()
+			defer o.treesMut.Unlock()
+			return o.trees[id] != nil
+		}
+		var id RosterID
+		copy(id[:], k)
+		o.entityListLock.Lock()
+		defer o.entityListLock.Unlock()
+		return o.entityLists[id] != nil
+	}
+	return sm.dbUpdate(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{treeCacheBucket, rosterCacheBucket} {
+			b := tx.Bucket(bucket)
+			if b == nil {
+				continue
+			}
+			if ttl <= 0 {
+				if err := tx.DeleteBucket(bucket); err != nil {
+					return err
+				}
+				continue
+			}
+			updates := make(map[string][]byte)
+			err := b.ForEach(func(k, v []byte) error {
+				if inUse(bucket, k) {
+					updates[string(k)] = touchStored(v, now, o.suite())
+					return nil
+				}
+				_, msg, err := network.Unmarshal(v, o.suite())
+				if err == nil && now.Sub(storedTime(msg)) <= ttl {
+					return nil
+				}
+				updates[string(k)] = nil
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for k, v := range updates {
+				if v == nil {
+					err = b.Delete([]byte(k))
+				} else {
+					err = b.Put([]byte(k), v)
+				}
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// storedTime returns when a storedTree or storedRoster was stored.
+func storedTime(msg network.Message) time.Time {
+	switch m := msg.(type) {
+	case *storedTree:
+		return time.Unix(0, m.Stored)
+	case *storedRoster:
+		return time.Unix(0, m.Stored)
+	}
+	return time.Time{}
+}
+
+// touchStored returns buf with the stored time set to now, or nil if it
+// can't be read, so that it is removed.
+func touchStored(buf []byte, now time.Time, suite network.Suite) []byte {
+	_, msg, err := network.Unmarshal(buf, suite)
+	if err != nil {
+		return nil
+	}
+	switch m := msg.(type) {
+	case *storedTree:
+		m.Stored = now.UnixNano()
+	case *storedRoster:
+		m.Stored = now.UnixNano()
+	}
+	buf, err = network.Marshal(msg)
+	if err != nil {
+		return nil
+	}
+	return buf
+}
@@ -0,0 +1,85 @@
+package onet
+
+import (
+	"testing"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/stretchr/testify/require"
+)
+
+// forget removes all trees and rosters from the memory of the overlay, like
+// a restart of the server.
+func forget(o *Overlay) {
+	o.treesMut.Lock()
+	o.trees = make(map[TreeID]*Tree)
+	o.treesMut.Unlock()
+	o.entityListLock.Lock()
+	o.entityLists = make(map[RosterID]*Roster)
+	o.entityListLock.Unlock()
+}
+
+// storedCount returns the number of entries in the bucket.
+func storedCount(t *testing.T, s *Server, bucket []byte) int {
+	n := 0
+	require.Nil(t, s.serviceManager.dbView(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(bucket); b != nil {
+			n = b.Stats().KeyN
+		}
+		return nil
+	}))
+	return n
+}
+
+func TestOverlay_TreeCache(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	servers, roster, tree := local.GenTree(3, true)
+	o := servers[0].overlay
+
+	forget(o)
+	require.True(t, tree.Equal(o.Tree(tree.ID)))
+	require.Equal(t, roster.ID, o.Roster(roster.ID).ID)
+	// Loading doesn't store again
+	require.Equal(t, 1, storedCount(t, servers[0], treeCacheBucket))
+
+	// Without the roster, the tree can't be made
+	require.Nil(t, o.cacheDB().dbUpdate(func(tx *bolt.Tx) error {
+		return tx.Bucket(rosterCacheBucket).Delete(roster.ID[:])
+	}))
+	forget(o)
+	require.Nil(t, o.Tree(tree.ID))
+}
+
+func TestOverlay_TreeCacheTTL(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	servers, roster, tree := local.GenTree(2, true)
+	s := servers[0]
+	o := s.overlay
+
+	s.SetTreeCacheTTL(100 * time.Millisecond)
+	time.Sleep(200 * time.Millisecond)
+	// Still in memory, so it is kept
+	require.Nil(t, o.collectStored())
+	require.Equal(t, 1, storedCount(t, s, treeCacheBucket))
+	require.Equal(t, 1, storedCount(t, s, rosterCacheBucket))
+
+	forget(o)
+	require.NotNil(t, o.Tree(tree.ID))
+	forget(o)
+	time.Sleep(200 * time.Millisecond)
+	require.Nil(t, o.Tree(tree.ID))
+	require.Nil(t, o.Roster(roster.ID))
+	require.Nil(t, o.collectStored())
+	require.Equal(t, 0, storedCount(t, s, treeCacheBucket))
+	require.Equal(t, 0, storedCount(t, s, rosterCacheBucket))
+
+	// Disabled cache
+	s.SetTreeCacheTTL(0)
+	o.RegisterRoster(roster)
+	o.RegisterTree(tree)
+	require.Equal(t, 0, storedCount(t, s, treeCacheBucket))
+	forget(o)
+	require.Nil(t, o.Tree(tree.ID))
+}
@@ -0,0 +1,309 @@
+// +build !js
+
+package onet
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+)
+
+// HealthConfig configures the failure detection of a TreeNodeInstance. The
+// instance sends a heartbeat to its parent and children every Interval, and
+// declares a neighbour dead if nothing has been received from it during
+// Misses intervals.
+type HealthConfig struct {
+	Interval time.Duration
+	Misses   int
+	// Reparent lets the children of a dead node attach themselves to their
+	// grandparent, which then treats them as its own children. Without it,
+	// the tree is left as it is.
+	Reparent bool
+}
+
+// treeHeartbeat is sent by the nodes monitoring their health to their
+// parent and children.
+type treeHeartbeat struct{}
+
+// treeAdopt is sent by a node to its grandparent when its parent died, so
+// that the grandparent adds it to its children.
+type treeAdopt struct{}
+
+// treeFlush is queued to the dispatcher when a child died, so that the
+// messages waiting for it to be aggregated are dispatched.
+type treeFlush struct{}
+
+func init() {
+	network.RegisterMessages(&treeHeartbeat{}, &treeAdopt{})
+	// The heartbeats must not wait behind bulk transfers, or the
+	// neighbours are taken for dead.
+	network.SetMessagePriority(network.MessageType(&treeHeartbeat{}), network.PriorityHigh)
+	network.SetMessagePriority(network.MessageType(&treeAdopt{}), network.PriorityHigh)
+}
+
+// treeHealth holds the view of the neighbours of a monitored
+// TreeNodeInstance, which differs from the tree once nodes died.
+type treeHealth struct {
+	conf      HealthConfig
+	onFailure func(failed *TreeNode)
+	parent    *TreeNode
+	children  []*TreeNode
+	lastSeen  map[TreeNodeID]time.Time
+	// failed holds the dead parent that is kept when not re-parenting, so
+	// that it is neither probed nor declared dead again until it is seen.
+	failed map[TreeNodeID]bool
+	stop   chan bool
+	sync.Mutex
+}
+
+// MonitorHealth starts the failure detection of the parent and children of
+// this node, as configured by conf. Every time a neighbour is declared dead,
+// onFailure is called with it, after the tree view of this node has been
+// updated. If Reparent is set, Parent and Children return the new
+// neighbours and messages that were waiting for the dead child to be
+// aggregated are dispatched. onFailure can be nil.
+//
+// MonitorHealth must be called on all nodes of the tree, typically in the
+// constructor of the protocol.
+func (n *TreeNodeInstance) MonitorHealth(conf HealthConfig, onFailure func(failed *TreeNode)) error {
+	if conf.Interval <= 0 || conf.Misses <= 0 {
+		return errors.New("interval and misses must be positive")
+	}
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	if n.health != nil {
+		return errors.New("health of this node is already monitored")
+	}
+	h := &treeHealth{
+		conf:      conf,
+		onFailure: onFailure,
+		parent:    n.treeNode.Parent,
+		children:  append([]*TreeNode{}, n.treeNode.Children...),
+		lastSeen:  make(map[TreeNodeID]time.Time),
+		failed:    make(map[TreeNodeID]bool),
+		stop:      make(chan bool),
+	}
+	now := time.Now()
+	for _, tn := range h.neighbours() {
+		h.lastSeen[tn.ID] = now
+	}
+	n.health = h
+	go n.healthLoop(h)
+	return nil
+}
+
+// neighbours returns the parent and the children. The caller must hold the
+// lock.
+func (h *treeHealth) neighbours() []*TreeNode {
+	nbs := append([]*TreeNode{}, h.children...)
+	if h.parent != nil {
+		nbs = append(nbs, h.parent)
+	}
+	return nbs
+}
+
+// alive returns the neighbours that are not known to have failed. The
+// caller must hold the lock.
+func (h *treeHealth) alive() []*TreeNode {
+	var nbs []*TreeNode
+	for _, tn := range h.neighbours() {
+		if !h.failed[tn.ID] {
+			nbs = append(nbs, tn)
+		}
+	}
+	return nbs
+}
+
+// getHealth returns the health monitor of this node, or nil if it is not
+// monitored.
+func (n *TreeNodeInstance) getHealth() *treeHealth {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	return n.health
+}
+
+// stopHealth stops the monitoring, if it has been started.
+func (n *TreeNodeInstance) stopHealth() {
+	n.mtx.Lock()
+	h := n.health
+	n.mtx.Unlock()
+	if h == nil {
+		return
+	}
+	h.Lock()
+	defer h.Unlock()
+	if h.stop != nil {
+		close(h.stop)
+		h.stop = nil
+	}
+}
+
+// healthLoop sends the heartbeats and looks for dead neighbours until the
+// monitoring is stopped.
+func (n *TreeNodeInstance) healthLoop(h *treeHealth) {
+	h.Lock()
+	stop := h.stop
+	h.Unlock()
+	ticker := time.NewTicker(h.conf.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		h.Lock()
+		nbs := h.alive()
+		var dead []*TreeNode
+		deadline := time.Now().Add(-time.Duration(h.conf.Misses) * h.conf.Interval)
+		for _, tn := range nbs {
+			if h.lastSeen[tn.ID].Before(deadline) {
+				dead = append(dead, tn)
+			}
+		}
+		h.Unlock()
+		for _, tn := range dead {
+			n.neighbourFailed(h, tn)
+		}
+		h.Lock()
+		nbs = h.alive()
+		h.Unlock()
+		for _, tn := range nbs {
+			if err := n.SendTo(tn, &treeHeartbeat{}); err != nil {
+				log.Lvl3(n.Info(), "couldn't send heartbeat to", tn.Name(), err)
+			}
+		}
+	}
+}
+
+// neighbourFailed removes the dead node from the view of this node,
+// re-parents if needed and tells the protocol. Without re-parenting, a
+// dead parent stays the parent, but it is only reported once, until it is
+// seen again.
+func (n *TreeNodeInstance) neighbourFailed(h *treeHealth, dead *TreeNode) {
+	var adoptBy *TreeNode
+	h.Lock()
+	if h.failed[dead.ID] || !h.isNeighbour(dead) {
+		h.Unlock()
+		return
+	}
+	delete(h.lastSeen, dead.ID)
+	if h.parent != nil && h.parent.ID.Equal(dead.ID) {
+		if h.conf.Reparent {
+			h.parent = dead.Parent
+			if h.parent != nil {
+				h.lastSeen[h.parent.ID] = time.Now()
+				adoptBy = h.parent
+			}
+		} else {
+			h.failed[dead.ID] = true
+		}
+	} else {
+		for i, c := range h.children {
+			if c.ID.Equal(dead.ID) {
+				h.children = append(h.children[:i], h.children[i+1:]...)
+				break
+			}
+		}
+	}
+	h.Unlock()
+
+	log.Lvl2(n.Info(), "detected failure of", dead.Name())
+	n.overlay.server.RecordEvent(EventProtocolFailure, n.ProtocolName(),
+		": neighbour ", dead.ServerIdentity.Address, " is not responding")
+	if adoptBy != nil {
+		if err := n.SendTo(adoptBy, &treeAdopt{}); err != nil {
+			log.Error(n.Info(), "couldn't ask to be adopted:", err)
+		}
+	} else {
+		n.queueFlush()
+	}
+	if h.onFailure != nil {
+		h.onFailure(dead)
+	}
+}
+
+// queueFlush makes the dispatcher go through the aggregated messages.
+func (n *TreeNodeInstance) queueFlush() {
+	n.msgDispatchQueueMutex.Lock()
+	n.msgDispatchQueue = append(n.msgDispatchQueue, &ProtocolMsg{Msg: &treeFlush{}})
+	n.notifyDispatch()
+	n.msgDispatchQueueMutex.Unlock()
+}
+
+// flushAggregates dispatches the aggregated messages that are complete
+// after a child died.
+func (n *TreeNodeInstance) flushAggregates() error {
+	for mt, msgs := range n.msgQueue {
+		if len(msgs) < len(n.Children()) {
+			continue
+		}
+		delete(n.msgQueue, mt)
+		var err error
+		if n.channels[mt] != nil {
+			err = n.dispatchChannel(msgs)
+		} else {
+			err = n.dispatchHandler(msgs)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleHealthMsg takes care of the messages of the health monitoring and
+// returns false if msg is not one of them.
+func (n *TreeNodeInstance) handleHealthMsg(msg *ProtocolMsg) bool {
+	if !isHealthMsg(msg.Msg) {
+		return false
+	}
+	h := n.getHealth()
+	if h == nil {
+		return true
+	}
+	from := n.Tree().Search(msg.From.TreeNodeID)
+	if from == nil {
+		return true
+	}
+	h.Lock()
+	defer h.Unlock()
+	if _, ok := msg.Msg.(*treeAdopt); ok && h.conf.Reparent {
+		if !h.isNeighbour(from) {
+			log.Lvl2(n.Info(), "adopting", from.Name())
+			h.children = append(h.children, from)
+		}
+	}
+	if h.isNeighbour(from) {
+		if h.failed[from.ID] {
+			log.Lvl2(n.Info(), from.Name(), "is responding again")
+			delete(h.failed, from.ID)
+		}
+		h.lastSeen[from.ID] = time.Now()
+	}
+	return true
+}
+
+// isNeighbour returns whether tn is the parent or a child. The caller must
+// hold the lock.
+func (h *treeHealth) isNeighbour(tn *TreeNode) bool {
+	for _, nb := range h.neighbours() {
+		if nb.ID.Equal(tn.ID) {
+			return true
+		}
+	}
+	return false
+}
+
+// isHealthMsg returns whether msg is sent by the health monitoring, so
+// that it doesn't count in the budget of the protocol.
+func isHealthMsg(msg interface{}) bool {
+	switch msg.(type) {
+	case *treeHeartbeat, *treeAdopt:
+		return true
+	}
+	return false
+}
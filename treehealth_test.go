@@ -0,0 +1,97 @@
+package onet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dedis/onet/network"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTreeHealth_Config(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	tni := newLimitedInstance(t, local, ProtocolLimits{})
+	require.NotNil(t, tni.MonitorHealth(HealthConfig{}, nil))
+	require.Nil(t, tni.MonitorHealth(HealthConfig{Interval: time.Hour, Misses: 1}, nil))
+	require.NotNil(t, tni.MonitorHealth(HealthConfig{Interval: time.Hour, Misses: 1}, nil))
+}
+
+func TestTreeHealth_Priority(t *testing.T) {
+	require.Equal(t, network.PriorityHigh, network.MessagePriority(&treeHeartbeat{}))
+	require.Equal(t, network.PriorityHigh, network.MessagePriority(&treeAdopt{}))
+}
+
+func TestTreeHealth_Reparent(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	GlobalProtocolRegister("ProtocolOverlay", func(n *TreeNodeInstance) (ProtocolInstance, error) {
+		return &ProtocolOverlay{TreeNodeInstance: n}, nil
+	})
+	servers, ro, _ := local.GenTree(3, false)
+	// A chain root -> middle -> leaf
+	tree := ro.GenerateNaryTree(1)
+	for _, s := range servers {
+		s.overlay.RegisterTree(tree)
+	}
+	pi, err := servers[0].CreateProtocol("ProtocolOverlay", tree)
+	require.Nil(t, err)
+	root := pi.(*ProtocolOverlay).TreeNodeInstance
+	middle := tree.Root.Children[0]
+	leaf := middle.Children[0]
+
+	conf := HealthConfig{Interval: time.Hour, Misses: 1, Reparent: true}
+	failed := make(chan *TreeNode, 1)
+	require.Nil(t, root.MonitorHealth(conf, func(tn *TreeNode) {
+		failed <- tn
+	}))
+	h := root.getHealth()
+	root.neighbourFailed(h, middle)
+	require.Equal(t, middle.ID, (<-failed).ID)
+	require.True(t, root.IsLeaf())
+
+	// The leaf asks to be adopted.
+	require.True(t, root.handleHealthMsg(&ProtocolMsg{
+		From: &Token{TreeNodeID: leaf.ID},
+		Msg:  &treeAdopt{},
+	}))
+	require.Equal(t, 1, len(root.Children()))
+	require.Equal(t, leaf.ID, root.Children()[0].ID)
+	require.False(t, root.handleHealthMsg(&ProtocolMsg{Msg: &SimpleMessage{}}))
+}
+
+func TestTreeHealth_DeadParent(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	servers, ro, _ := local.GenTree(2, false)
+	tree := ro.GenerateNaryTree(1)
+	leaf := tree.Root.Children[0]
+	tni := servers[1].overlay.NewTreeNodeInstanceFromProtocol(tree, leaf,
+		ProtocolNameToID("ProtocolOverlay"), servers[1].overlay.protoIO.getByName(""))
+	defer tni.Done()
+
+	failed := make(chan *TreeNode, 2)
+	require.Nil(t, tni.MonitorHealth(HealthConfig{Interval: time.Hour, Misses: 1},
+		func(tn *TreeNode) {
+			failed <- tn
+		}))
+	h := tni.getHealth()
+	tni.neighbourFailed(h, tree.Root)
+	require.Equal(t, tree.Root.ID, (<-failed).ID)
+	// The dead parent is kept, but not reported nor probed again.
+	require.Equal(t, tree.Root.ID, tni.Parent().ID)
+	tni.neighbourFailed(h, tree.Root)
+	require.Equal(t, 0, len(failed))
+	h.Lock()
+	require.Empty(t, h.alive())
+	h.Unlock()
+
+	// Once it is seen again, it is monitored again.
+	require.True(t, tni.handleHealthMsg(&ProtocolMsg{
+		From: &Token{TreeNodeID: tree.Root.ID},
+		Msg:  &treeHeartbeat{},
+	}))
+	h.Lock()
+	require.Equal(t, 1, len(h.alive()))
+	h.Unlock()
+}
@@ -1,3 +1,5 @@
+// +build !js
+
 package onet
 
 import (
@@ -5,6 +7,7 @@ import (
 	"fmt"
 	"reflect"
 	"sync"
+	"time"
 
 	"github.com/dedis/kyber"
 	"github.com/dedis/onet/log"
@@ -56,6 +59,17 @@ type TreeNodeInstance struct {
 	// used for the CounterIO interface
 	tx safeAdder
 	rx safeAdder
+
+	// resources used by this instance
+	usage protocolUsage
+	// health monitoring of the neighbours, if enabled
+	health *treeHealth
+	// resources reserved by the overlay for this instance, if any
+	reserved *ProtocolReservation
+	// span of this instance
+	trace protocolTrace
+	// checkpointed is set if the instance has a checkpoint to remove
+	checkpointed bool
 }
 
 type safeAdder struct {
@@ -103,6 +117,7 @@ func newTreeNodeInstance(o *Overlay, tok *Token, tn *TreeNode, io MessageProxy)
 		protoIO:              io,
 		sentTo:               make(map[TreeNodeID]bool),
 	}
+	n.startUsage()
 	go n.dispatchMsgReader()
 	return n
 }
@@ -118,13 +133,31 @@ func (n *TreeNodeInstance) ServerIdentity() *network.ServerIdentity {
 	return n.treeNode.ServerIdentity
 }
 
-// Parent returns the parent-TreeNode of ourselves
+// Clock returns the clock of the server. Protocols should use it for their
+// timeouts, so that tests can run them with a network.MockClock.
+func (n *TreeNodeInstance) Clock() network.Clock {
+	return n.overlay.Clock()
+}
+
+// Parent returns the parent-TreeNode of ourselves. If the health of the
+// node is monitored, it is the parent after re-parenting.
 func (n *TreeNodeInstance) Parent() *TreeNode {
+	if h := n.getHealth(); h != nil {
+		h.Lock()
+		defer h.Unlock()
+		return h.parent
+	}
 	return n.treeNode.Parent
 }
 
-// Children returns the children of ourselves
+// Children returns the children of ourselves. If the health of the node is
+// monitored, dead children are left out and adopted ones are added.
 func (n *TreeNodeInstance) Children() []*TreeNode {
+	if h := n.getHealth(); h != nil {
+		h.Lock()
+		defer h.Unlock()
+		return append([]*TreeNode{}, h.children...)
+	}
 	return n.treeNode.Children
 }
 
@@ -135,12 +168,12 @@ func (n *TreeNodeInstance) Root() *TreeNode {
 
 // IsRoot returns whether whether we are at the top of the tree
 func (n *TreeNodeInstance) IsRoot() bool {
-	return n.treeNode.Parent == nil
+	return n.Parent() == nil
 }
 
 // IsLeaf returns whether whether we are at the bottom of the tree
 func (n *TreeNodeInstance) IsLeaf() bool {
-	return len(n.treeNode.Children) == 0
+	return len(n.Children()) == 0
 }
 
 // SendTo sends to a given node
@@ -148,17 +181,35 @@ func (n *TreeNodeInstance) SendTo(to *TreeNode, msg interface{}) error {
 	if to == nil {
 		return errors.New("Sent to a nil TreeNode")
 	}
+	if err := n.AbortError(); err != nil {
+		return err
+	}
 	var c *GenericConfig
-	// only sends the config once
+	// only sends the config and the budget once
 	n.configMut.Lock()
-	if !n.sentTo[to.ID] {
+	first := !n.sentTo[to.ID]
+	if first {
 		c = n.config
 		n.sentTo[to.ID] = true
 	}
 	n.configMut.Unlock()
 
-	sentLen, err := n.overlay.SendToTreeNode(n.token, to, msg, n.protoIO, c)
+	if b := n.Budget(); first && b != nil {
+		sentLen, err := n.overlay.sendBudget(n.token, to, b)
+		n.tx.add(sentLen)
+		if err != nil {
+			return err
+		}
+	}
+	var tc map[string]string
+	if !isHealthMsg(msg) {
+		tc = injectTrace(n.TraceContext())
+	}
+	sentLen, err := n.overlay.sendToTreeNode(n.token, to, msg, n.protoIO, c, tc)
 	n.tx.add(sentLen)
+	if err == nil && !isHealthMsg(msg) && !n.spendBudget(sentLen) {
+		return n.AbortError()
+	}
 	return err
 }
 
@@ -330,6 +381,8 @@ func (n *TreeNodeInstance) closeDispatch() error {
 	n.closing = true
 	n.notifyDispatch()
 	n.msgDispatchQueueMutex.Unlock()
+	n.stopUsage()
+	n.stopHealth()
 	pni := n.ProtocolInstance()
 	if pni == nil {
 		return errors.New("Can't shutdown empty ProtocolInstance")
@@ -420,6 +473,12 @@ func (n *TreeNodeInstance) dispatchChannel(msgSlice []*ProtocolMsg) error {
 // This allows a protocol to have a backlog of messages.
 func (n *TreeNodeInstance) ProcessProtocolMsg(msg *ProtocolMsg) {
 	log.Lvl4(n.Info(), "Received message")
+	if n.handleHealthMsg(msg) {
+		return
+	}
+	if !n.spendBudget(msgSize(msg)) || !n.bufferMsg(msg) {
+		return
+	}
 	n.msgDispatchQueueMutex.Lock()
 	n.msgDispatchQueue = append(n.msgDispatchQueue, msg)
 	n.notifyDispatch()
@@ -454,7 +513,9 @@ func (n *TreeNodeInstance) dispatchMsgReader() {
 			msg := n.msgDispatchQueue[0]
 			n.msgDispatchQueue = n.msgDispatchQueue[1:]
 			n.msgDispatchQueueMutex.Unlock()
-			err := n.dispatchMsgToProtocol(msg)
+			start := time.Now()
+			err := n.dispatchRecover(msg)
+			n.usage.dispatched(msg, time.Since(start))
 			if err != nil {
 				log.Errorf("%s: error while dispatching message %s: %s",
 					n.Name(), reflect.TypeOf(msg.Msg), err)
@@ -467,8 +528,18 @@ func (n *TreeNodeInstance) dispatchMsgReader() {
 	}
 }
 
+// dispatchRecover dispatches msg, and aborts the instance if the protocol
+// panics while handling it.
+func (n *TreeNodeInstance) dispatchRecover(msg *ProtocolMsg) error {
+	defer n.recoverPanic(fmt.Sprintf("handling %T", msg.Msg))
+	return n.dispatchMsgToProtocol(msg)
+}
+
 // dispatchMsgToProtocol will dispatch this onet.Data to the right instance
 func (n *TreeNodeInstance) dispatchMsgToProtocol(onetMsg *ProtocolMsg) error {
+	if _, ok := onetMsg.Msg.(*treeFlush); ok {
+		return n.flushAggregates()
+	}
 
 	n.rx.add(uint64(len(onetMsg.MsgSlice)))
 
@@ -559,6 +630,7 @@ func (n *TreeNodeInstance) Done() {
 	log.Lvl3(n.Info(), "has finished. Deleting its resources")
 	n.closeDispatch()
 	n.overlay.nodeDone(n.token)
+	n.overlay.forgetCheckpoint(n)
 }
 
 // OnDoneCallback should be called if we want to control the Done() of the node.
@@ -570,9 +642,11 @@ func (n *TreeNodeInstance) OnDoneCallback(fn func() bool) {
 	n.onDoneCallback = fn
 }
 
-// Private returns the private key of the entity
+// Private returns the private key of the entity. If the key of the server
+// has been rotated, it is the private key of the public key in the tree, as
+// long as the old key is in its grace period.
 func (n *TreeNodeInstance) Private() kyber.Scalar {
-	return n.Host().private
+	return n.Host().privateFor(n.Public())
 }
 
 // Public returns the public key of the entity
@@ -630,7 +704,7 @@ func (n *TreeNodeInstance) Index() int {
 func (n *TreeNodeInstance) Broadcast(msg interface{}) []error {
 	var errs []error
 	for _, node := range n.List() {
-		if !node.Equal(n.TreeNode()) {
+		if !node.ID.Equal(n.TreeNode().ID) {
 			if err := n.SendTo(node, msg); err != nil {
 				errs = append(errs, err)
 			}
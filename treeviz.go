@@ -0,0 +1,102 @@
+// +build !js
+
+package onet
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// ToDOT returns the tree in the DOT language of graphviz. Every node is
+// labeled with the address of its server and its index in the roster, so
+// that a server appearing more than once in the tree can be recognized.
+func (t *Tree) ToDOT() string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "digraph \"%s\" {\n", t.ID)
+	ids := t.vizIDs()
+	t.Root.Visit(0, func(d int, tn *TreeNode) {
+		fmt.Fprintf(&b, "\t%s [label=%q];\n", ids[tn.ID], vizLabel(tn))
+		if tn.Parent != nil {
+			fmt.Fprintf(&b, "\t%s -> %s;\n", ids[tn.Parent.ID], ids[tn.ID])
+		}
+	})
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// ToMermaid returns the tree as a mermaid flowchart, which can be pasted in
+// markdown documents.
+func (t *Tree) ToMermaid() string {
+	var b bytes.Buffer
+	b.WriteString("graph TD\n")
+	ids := t.vizIDs()
+	t.Root.Visit(0, func(d int, tn *TreeNode) {
+		node := fmt.Sprintf("%s[\"%s\"]", ids[tn.ID],
+			strings.Replace(vizLabel(tn), "\"", "#quot;", -1))
+		if tn.Parent == nil {
+			fmt.Fprintf(&b, "\t%s\n", node)
+		} else {
+			fmt.Fprintf(&b, "\t%s --> %s\n", ids[tn.Parent.ID], node)
+		}
+	})
+	return b.String()
+}
+
+// vizIDs returns short identifiers for the nodes, in depth-first order.
+func (t *Tree) vizIDs() map[TreeNodeID]string {
+	ids := make(map[TreeNodeID]string)
+	t.Root.Visit(0, func(d int, tn *TreeNode) {
+		ids[tn.ID] = fmt.Sprintf("n%d", len(ids))
+	})
+	return ids
+}
+
+func vizLabel(tn *TreeNode) string {
+	return fmt.Sprintf("%d: %s", tn.RosterIndex, tn.ServerIdentity.Address)
+}
+
+// activeTrees returns the trees used by the running protocol instances, with
+// the names of the protocols using each of them.
+func (o *Overlay) activeTrees() ([]*Tree, map[TreeID][]string) {
+	o.instancesLock.Lock()
+	defer o.instancesLock.Unlock()
+	var trees []*Tree
+	protos := make(map[TreeID][]string)
+	for _, tni := range o.instances {
+		t := tni.Tree()
+		if t == nil {
+			continue
+		}
+		if _, ok := protos[t.ID]; !ok {
+			trees = append(trees, t)
+		}
+		protos[t.ID] = append(protos[t.ID], tni.ProtocolName())
+	}
+	sort.Slice(trees, func(i, j int) bool {
+		return trees[i].ID.String() < trees[j].ID.String()
+	})
+	return trees, protos
+}
+
+// serveTrees is the handler of the /trees path. It renders the trees of all
+// active protocol instances in DOT, or in mermaid if the query contains
+// format=mermaid. Only the clients of the admin API get them.
+func (c *Server) serveTrees(w http.ResponseWriter, r *http.Request) {
+	mermaid := r.URL.Query().Get("format") == "mermaid"
+	trees, protos := c.overlay.activeTrees()
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, t := range trees {
+		names := protos[t.ID]
+		sort.Strings(names)
+		if mermaid {
+			fmt.Fprintf(w, "%%%% protocols: %s\n%s\n",
+				strings.Join(names, ", "), t.ToMermaid())
+		} else {
+			fmt.Fprintf(w, "// protocols: %s\n%s\n",
+				strings.Join(names, ", "), t.ToDOT())
+		}
+	}
+}
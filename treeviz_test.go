@@ -0,0 +1,49 @@
+package onet
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTree_ToDOT(t *testing.T) {
+	names := genLocalhostPeerNames(3, 2000)
+	tree := genRoster(tSuite, names).GenerateBinaryTree()
+	dot := tree.ToDOT()
+	require.True(t, strings.HasPrefix(dot, "digraph \""+tree.ID.String()+"\" {\n"))
+	require.Contains(t, dot, "n0 [label=\"0: "+names[0].String()+"\"];")
+	require.Contains(t, dot, "n0 -> n1;")
+	require.Contains(t, dot, "n0 -> n2;")
+	require.True(t, strings.HasSuffix(dot, "}\n"))
+}
+
+func TestTree_ToMermaid(t *testing.T) {
+	names := genLocalhostPeerNames(3, 2000)
+	tree := genRoster(tSuite, names).GenerateBinaryTree()
+	mm := tree.ToMermaid()
+	require.True(t, strings.HasPrefix(mm, "graph TD\n"))
+	require.Contains(t, mm, "\tn0[\"0: "+names[0].String()+"\"]\n")
+	require.Contains(t, mm, "\tn0 --> n2[\"2: "+names[2].String()+"\"]\n")
+}
+
+func TestServer_serveTrees(t *testing.T) {
+	GlobalProtocolRegister("ProtocolOverlay", func(n *TreeNodeInstance) (ProtocolInstance, error) {
+		return &ProtocolOverlay{TreeNodeInstance: n}, nil
+	})
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	h, _, tree := local.GenTree(2, true)
+	_, err := h[0].CreateProtocol("ProtocolOverlay", tree)
+	require.Nil(t, err)
+
+	rec := httptest.NewRecorder()
+	h[0].serveTrees(rec, httptest.NewRequest("GET", "/trees", nil))
+	require.Contains(t, rec.Body.String(), "// protocols: ProtocolOverlay\n")
+	require.Contains(t, rec.Body.String(), tree.ToDOT())
+
+	rec = httptest.NewRecorder()
+	h[0].serveTrees(rec, httptest.NewRequest("GET", "/trees?format=mermaid", nil))
+	require.Contains(t, rec.Body.String(), tree.ToMermaid())
+}
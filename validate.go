@@ -0,0 +1,184 @@
+// +build !js
+
+package onet
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Validator checks a decoded request before the handler is called. It gets
+// a pointer to the request and returns the violations it found.
+type Validator func(msg interface{}) []Violation
+
+// fieldConstraint is the parsed `validate` tag of a field. The tag is a
+// comma-separated list of:
+//	required - the field must not be the zero value
+//	min=N    - minimum value of numbers, or minimum length
+//	max=N    - maximum value of numbers, or maximum length
+// where the length is the one of strings, slices and maps.
+type fieldConstraint struct {
+	index    int
+	name     string
+	required bool
+	min, max *int64
+}
+
+// parseConstraints returns the constraints in the `validate` tags of the
+// fields of the struct t.
+func parseConstraints(t reflect.Type) ([]fieldConstraint, error) {
+	var fcs []fieldConstraint
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("validate")
+		if tag == "" {
+			continue
+		}
+		fc := fieldConstraint{index: i, name: f.Name}
+		for _, c := range strings.Split(tag, ",") {
+			kv := strings.SplitN(strings.TrimSpace(c), "=", 2)
+			switch {
+			case kv[0] == "required" && len(kv) == 1:
+				fc.required = true
+			case (kv[0] == "min" || kv[0] == "max") && len(kv) == 2:
+				n, err := strconv.ParseInt(kv[1], 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("%s.%s: wrong number in %s", t.Name(), f.Name, c)
+				}
+				if kv[0] == "min" {
+					fc.min = &n
+				} else {
+					fc.max = &n
+				}
+			default:
+				return nil, fmt.Errorf("%s.%s: unknown constraint %s", t.Name(), f.Name, c)
+			}
+		}
+		if (fc.min != nil || fc.max != nil) && sizeOf(reflect.Zero(f.Type)) == nil {
+			return nil, fmt.Errorf("%s.%s: min and max need a number, string, slice or map",
+				t.Name(), f.Name)
+		}
+		fcs = append(fcs, fc)
+	}
+	return fcs, nil
+}
+
+// sizeOf returns the value of numbers or the length of strings, slices and
+// maps, or nil for other kinds.
+func sizeOf(v reflect.Value) *int64 {
+	var n int64
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n = int64(v.Uint())
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		n = int64(v.Len())
+	default:
+		return nil
+	}
+	return &n
+}
+
+// checkConstraints returns the violations of the constraints by the struct
+// v.
+func checkConstraints(fcs []fieldConstraint, v reflect.Value) []Violation {
+	var vs []Violation
+	for _, fc := range fcs {
+		f := v.Field(fc.index)
+		if fc.required && isZero(f) {
+			vs = append(vs, Violation{fc.name, "required"})
+			continue
+		}
+		size := sizeOf(f)
+		if size == nil {
+			continue
+		}
+		if fc.min != nil && *size < *fc.min {
+			vs = append(vs, Violation{fc.name, fmt.Sprintf("must be at least %d", *fc.min)})
+		}
+		if fc.max != nil && *size > *fc.max {
+			vs = append(vs, Violation{fc.name, fmt.Sprintf("must be at most %d", *fc.max)})
+		}
+	}
+	return vs
+}
+
+func isZero(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	}
+	return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+}
+
+// RegisterValidator adds a validation function to the endpoint of the
+// handler for msg, which must be registered already. The validators run
+// after the checks of the `validate` tags and before the handler, in the
+// order they are registered.
+func (p *ServiceProcessor) RegisterValidator(msg interface{}, v Validator) error {
+	t := reflect.TypeOf(msg)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	path := strings.Split(t.String(), ".")[1]
+	mh, ok := p.handlers[path]
+	if !ok {
+		return errors.New("no handler registered for " + path)
+	}
+	mh.validators = append(mh.validators, v)
+	p.handlers[path] = mh
+	return nil
+}
+
+// validate returns a ValidationError if msg, a pointer to the request of
+// the handler, is not valid.
+func (sh serviceHandler) validate(msg interface{}) error {
+	vs := checkConstraints(sh.constraints, reflect.ValueOf(msg).Elem())
+	for _, v := range sh.validators {
+		vs = append(vs, v(msg)...)
+	}
+	if len(vs) > 0 {
+		return &ValidationError{Violations: vs}
+	}
+	return nil
+}
+
+// SetMaxPageSize sets the largest page size accepted by the endpoints of
+// the service. Larger requests are refused with a ValidationError.
+func (p *ServiceProcessor) SetMaxPageSize(max int) {
+	p.maxPageSize = max
+}
+
+// checkPage refuses requests with a page size too big or a wrong cursor,
+// and sets the default page size. msg is a pointer to the request.
+func (p *ServiceProcessor) checkPage(msg interface{}) error {
+	f, ok := pageField(reflect.ValueOf(msg).Elem(), pageRequestType)
+	if !ok {
+		return nil
+	}
+	pr := f.Addr().Interface().(*PageRequest)
+	max := p.maxPageSize
+	if max <= 0 {
+		max = DefaultMaxPageSize
+	}
+	var vs []Violation
+	if pr.Size < 0 || pr.Size > max {
+		vs = append(vs, Violation{"Page.Size", fmt.Sprintf("must be between 0 and %d", max)})
+	}
+	if _, err := DecodeCursor(pr.Cursor); err != nil {
+		vs = append(vs, Violation{"Page.Cursor", err.Error()})
+	}
+	if len(vs) > 0 {
+		return &ValidationError{Violations: vs}
+	}
+	if pr.Size == 0 {
+		pr.Size = DefaultPageSize
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package onet
+
+import (
+	"testing"
+
+	"github.com/dedis/onet/network"
+	"github.com/dedis/protobuf"
+	"github.com/stretchr/testify/require"
+)
+
+type validMsg struct {
+	Name  string   `validate:"required,max=8"`
+	Count int      `validate:"min=1,max=10"`
+	Tags  []string `validate:"max=2"`
+}
+
+type wrongTagMsg struct {
+	Name string `validate:"requird"`
+}
+
+type wrongKindMsg struct {
+	Sub validMsg `validate:"min=1"`
+}
+
+func procValid(msg *validMsg) (network.Message, error) {
+	return msg, nil
+}
+
+func procWrongTag(msg *wrongTagMsg) (network.Message, error) {
+	return msg, nil
+}
+
+func procWrongKind(msg *wrongKindMsg) (network.Message, error) {
+	return msg, nil
+}
+
+func TestValidate_Constraints(t *testing.T) {
+	p := NewServiceProcessor(&Context{})
+	require.Nil(t, p.RegisterHandler(procValid))
+	require.NotNil(t, p.RegisterHandler(procWrongTag))
+	require.NotNil(t, p.RegisterHandler(procWrongKind))
+
+	sh := p.handlers["validMsg"]
+	require.Nil(t, sh.validate(&validMsg{Name: "onet", Count: 1}))
+
+	err := sh.validate(&validMsg{Count: 11, Tags: []string{"a", "b", "c"}})
+	require.NotNil(t, err)
+	ve, ok := err.(*ValidationError)
+	require.True(t, ok)
+	require.Equal(t, []Violation{
+		{"Name", "required"},
+		{"Count", "must be at most 10"},
+		{"Tags", "must be at most 2"},
+	}, ve.Violations)
+
+	err = sh.validate(&validMsg{Name: "too long name", Count: 0})
+	require.NotNil(t, err)
+	require.Equal(t, "invalid request: Name: must be at most 8; Count: must be at least 1",
+		err.Error())
+	require.Equal(t, err, parseValidationError(err.Error()))
+	require.Nil(t, parseValidationError("other error"))
+}
+
+func TestValidate_Validator(t *testing.T) {
+	p := NewServiceProcessor(&Context{})
+	require.NotNil(t, p.RegisterValidator(&validMsg{}, nil))
+	require.Nil(t, p.RegisterHandler(procValid))
+	require.Nil(t, p.RegisterValidator(&validMsg{}, func(msg interface{}) []Violation {
+		if msg.(*validMsg).Name == "root" {
+			return []Violation{{"Name", "reserved"}}
+		}
+		return nil
+	}))
+
+	buf, err := protobuf.Encode(&validMsg{Name: "root", Count: 1})
+	require.Nil(t, err)
+	_, err = p.ProcessClientRequest(nil, "validMsg", buf)
+	require.NotNil(t, err)
+	require.Equal(t, "invalid request: Name: reserved", err.Error())
+
+	buf, err = protobuf.Encode(&validMsg{Name: "user", Count: 1})
+	require.Nil(t, err)
+	_, err = p.ProcessClientRequest(nil, "validMsg", buf)
+	require.Nil(t, err)
+}
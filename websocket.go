@@ -1,3 +1,5 @@
+// +build !js
+
 package onet
 
 import (
@@ -5,30 +7,52 @@ import (
 	"fmt"
 	"net"
 	"net/http"
-	"reflect"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/dedis/onet/log"
 	"github.com/dedis/onet/network"
-	"github.com/dedis/protobuf"
 	"github.com/gorilla/websocket"
 	"gopkg.in/tylerb/graceful.v1"
 )
 
+func init() {
+	// graceful closes the connections of a stopped websocket in the
+	// background, which are not leaks of the tests.
+	log.IgnoreGoroutine("tylerb/graceful")
+}
+
 // WebSocket handles incoming client-requests using the websocket
 // protocol. When making a new WebSocket, it will listen one port above the
 // ServerIdentity-port-#.
 // The websocket protocol has been chosen as smallest common denominator
 // for languages including JavaScript.
 type WebSocket struct {
-	services  map[string]Service
-	server    *graceful.Server
-	mux       *http.ServeMux
-	startstop chan bool
-	started   bool
+	services map[string]Service
+	limiters map[string]*wsLimiter
+	// CORS and security headers of the server and of the services
+	headers        *HTTPHeaders
+	serviceHeaders map[string]*HTTPHeaders
+	server         *graceful.Server
+	mux            *http.ServeMux
+	startstop      chan bool
+	started        bool
+	// shutdown is closed when the websocket stops, to cancel the requests
+	shutdown     chan struct{}
+	shutdownOnce sync.Once
+	// requestTimeout is the deadline of the requests, see SetRequestTimeout
+	requestTimeout time.Duration
+	// middlewares wrap the requests to the services
+	middlewares []ServiceMiddleware
+	// acl refuses the requests of some clients
+	acl *network.ACL
+	// certs holds the certificate files of the TLS configuration, if any
+	certs *certReloader
+	// listener, if set, is shared with the router, see shareListener
+	listener net.Listener
+	// audit records the requests, nil if there is no server
+	audit *auditLog
 	sync.Mutex
 }
 
@@ -36,11 +60,12 @@ type WebSocket struct {
 // ServerIdentity.
 func NewWebSocket(si *network.ServerIdentity) *WebSocket {
 	w := &WebSocket{
-		services:  make(map[string]Service),
-		startstop: make(chan bool),
+		services:       make(map[string]Service),
+		limiters:       make(map[string]*wsLimiter),
+		serviceHeaders: make(map[string]*HTTPHeaders),
+		startstop:      make(chan bool),
+		shutdown:       make(chan struct{}),
 	}
-	webHost, err := getWebAddress(si, true)
-	log.ErrFatal(err)
 	w.mux = http.NewServeMux()
 	w.mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
 		log.Lvl4("ok?", r.RemoteAddr)
@@ -74,11 +99,20 @@ func NewWebSocket(si *network.ServerIdentity) *WebSocket {
 			time.Now().Add(time.Millisecond*500))
 		ws.Close()
 	})
+	// A Unix socket has no port, so there is no port above it for the
+	// websocket. Clients have to use a server with a TCP address.
+	if si.Address.ConnType() == network.Unix {
+		log.Lvl2("No websocket for unix address", si.Address)
+		return w
+	}
+	webHost, err := getWebAddress(si, true)
+	log.ErrFatal(err)
 	w.server = &graceful.Server{
 		Timeout: 100 * time.Millisecond,
 		Server: &http.Server{
-			Addr:    webHost,
-			Handler: w.mux,
+			Addr:     webHost,
+			Handler:  headerHandler{w},
+			ErrorLog: log.NewStdLogger(2, "websocket: "),
 		},
 		NoSignalHandling: true,
 	}
@@ -87,19 +121,24 @@ func NewWebSocket(si *network.ServerIdentity) *WebSocket {
 
 // start listening on the port.
 func (w *WebSocket) start() {
+	if w.server == nil {
+		return
+	}
 	w.Lock()
 	w.started = true
 	w.Unlock()
 	log.Lvl2("Starting to listen on", w.server.Server.Addr)
 	go func() {
-		w.server.ListenAndServe()
+		if err := w.listenAndServe(); err != nil {
+			log.Error("Couldn't serve websocket:", err)
+		}
 	}()
 	w.startstop <- true
 }
 
 // registerService stores a service to the given path. All requests to that
 // path and it's sub-endpoints will be forwarded to ProcessClientRequest.
-func (w *WebSocket) registerService(service string, s Service) error {
+func (w *WebSocket) registerService(service string, s Service, c *Context) error {
 	if service == "ok" {
 		return errors.New("service name \"ok\" is not allowed")
 	}
@@ -108,11 +147,33 @@ func (w *WebSocket) registerService(service string, s Service) error {
 	h := &wsHandler{
 		service:     s,
 		serviceName: service,
+		context:     c,
+		ws:          w,
 	}
 	w.mux.Handle(fmt.Sprintf("/%s/", service), h)
 	return nil
 }
 
+// setConcurrency limits the number of concurrent requests to the service to
+// max, with up to queue requests waiting for a free slot. A max of 0 or less
+// removes the limit.
+func (w *WebSocket) setConcurrency(service string, max, queue int) {
+	w.Lock()
+	defer w.Unlock()
+	if max <= 0 {
+		delete(w.limiters, service)
+		return
+	}
+	w.limiters[service] = newWsLimiter(max, queue)
+}
+
+// limiter returns the limiter of the service, or nil if it has none.
+func (w *WebSocket) limiter(service string) *wsLimiter {
+	w.Lock()
+	defer w.Unlock()
+	return w.limiters[service]
+}
+
 // stop the websocket and free the port.
 func (w *WebSocket) stop() {
 	w.Lock()
@@ -121,15 +182,60 @@ func (w *WebSocket) stop() {
 		return
 	}
 	log.Lvl3("Stopping", w.server.Server.Addr)
+	w.shutdownOnce.Do(func() { close(w.shutdown) })
 	w.server.Stop(100 * time.Millisecond)
 	<-w.startstop
 	w.started = false
 }
 
+// wsLimiter limits the number of requests a service handles in parallel.
+type wsLimiter struct {
+	slots   chan struct{}
+	queue   int
+	waiting int
+	sync.Mutex
+}
+
+func newWsLimiter(max, queue int) *wsLimiter {
+	return &wsLimiter{
+		slots: make(chan struct{}, max),
+		queue: queue,
+	}
+}
+
+// acquire waits for a free slot. It returns false without waiting if there
+// are already as many requests waiting as the queue allows.
+func (l *wsLimiter) acquire() bool {
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+	}
+	l.Lock()
+	if l.waiting >= l.queue {
+		l.Unlock()
+		return false
+	}
+	l.waiting++
+	l.Unlock()
+	l.slots <- struct{}{}
+	l.Lock()
+	l.waiting--
+	l.Unlock()
+	return true
+}
+
+func (l *wsLimiter) release() {
+	<-l.slots
+}
+
 // Pass the request to the websocket.
 type wsHandler struct {
 	serviceName string
 	service     Service
+	// context of the service, for the sessions
+	context *Context
+	ws      *WebSocket
 }
 
 // Wrapper-function so that http.Requests get 'upgraded' to websockets
@@ -147,11 +253,9 @@ func (t wsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	u := websocket.Upgrader{
 		EnableCompression: true,
 		// As the website will not be served from ourselves, we
-		// need to accept _all_ origins. Cross-site scripting is
-		// required.
-		CheckOrigin: func(*http.Request) bool {
-			return true
-		},
+		// need to accept all origins, unless restricted with
+		// SetHTTPHeaders. Cross-site scripting is required.
+		CheckOrigin: t.ws.checkOrigin,
 	}
 	ws, err := u.Upgrade(w, r, http.Header{})
 	if err != nil {
@@ -162,13 +266,34 @@ func (t wsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		ws.Close()
 	}()
 
+	if t.context != nil &&
+		strings.TrimPrefix(r.URL.Path, "/"+t.serviceName+"/") == sessionPath {
+		tx = t.session(ws, r)
+		ok = true
+		return
+	}
+
+	// The requests are cancelled when the client disconnects or the server
+	// stops.
+	connCtx, cancel := t.connContext(r)
+	defer cancel()
+	msgs := readMessages(connCtx, ws, cancel)
+
 	// Loop for each message
+	lastType := websocket.BinaryMessage
 	for err == nil {
-		mt, buf, rerr := ws.ReadMessage()
-		if rerr != nil {
-			err = rerr
+		var m wsMessage
+		select {
+		case m = <-msgs:
+		case <-connCtx.Done():
+			m.err = connCtx.Err()
+		}
+		if m.err != nil {
+			err = m.err
 			break
 		}
+		mt, buf := m.mt, m.buf
+		lastType = mt
 		rx += len(buf)
 		n++
 
@@ -176,7 +301,25 @@ func (t wsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		var reply []byte
 		path := strings.TrimPrefix(r.URL.Path, "/"+t.serviceName+"/")
 		log.Lvlf2("ws request from %s: %s/%s", r.RemoteAddr, t.serviceName, path)
-		reply, err = s.ProcessClientRequest(r, path, buf)
+		ss, isStreaming := s.(StreamingService)
+		isStreaming = isStreaming && ss.IsStreaming(path)
+		reqCtx, cancelReq := t.requestContext(connCtx, r, path, !isStreaming)
+		ctx, span := t.startSpan(r.WithContext(reqCtx), path)
+		if isStreaming {
+			var sent int
+			sent, err = t.stream(ws, ss, r.WithContext(ctx), path, buf, msgs)
+			cancelReq()
+			tx += sent
+			endSpan(span, err)
+			if err == nil {
+				ok = true
+				return
+			}
+			break
+		}
+		reply, err = t.process(s, r.WithContext(ctx), path, buf)
+		cancelReq()
+		endSpan(span, err)
 		if err == nil {
 			tx += len(reply)
 			err := ws.WriteMessage(mt, reply)
@@ -187,203 +330,54 @@ func (t wsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	code := 4000
+	text := err.Error()
+	if err == ErrServiceBusy {
+		code = wsBusyCode
+	} else if _, ok := err.(*ValidationError); ok {
+		code = wsInvalidCode
+		// The violations don't always fit in the close message.
+		if lastType == websocket.BinaryMessage {
+			if err := writeServiceError(ws, err); err != nil {
+				log.Error("couldn't send error:", err)
+			}
+			text = "invalid request"
+		}
+	} else if se, ok := err.(*ServiceError); ok && lastType == websocket.BinaryMessage {
+		if err := writeServiceError(ws, se); err != nil {
+			log.Error("couldn't send error:", err)
+		}
+		code = wsServiceErrorCode
+	}
 	ws.WriteControl(websocket.CloseMessage,
-		websocket.FormatCloseMessage(4000, err.Error()),
+		websocket.FormatCloseMessage(code, closeText(text)),
 		time.Now().Add(time.Millisecond*500))
 	ok = true
 	return
 }
 
-type destination struct {
-	si   *network.ServerIdentity
-	path string
-}
-
-// Client is a struct used to communicate with a remote Service running on a
-// onet.Server. Using Send it can connect to multiple remote Servers.
-type Client struct {
-	service     string
-	connections map[destination]*websocket.Conn
-	suite       network.Suite
-
-	// whether to keep the connection
-	keep bool
-	rx   uint64
-	tx   uint64
-	sync.Mutex
-}
-
-// NewClient returns a client using the service s. On the first Send, the
-// connection will be started, until Close is called.
-func NewClient(suite network.Suite, s string) *Client {
-	return &Client{
-		service:     s,
-		connections: make(map[destination]*websocket.Conn),
-		suite:       suite,
-	}
-}
-
-// NewClientKeep returns a Client that doesn't close the connection between
-// two messages if it's the same server.
-func NewClientKeep(suite network.Suite, s string) *Client {
-	return &Client{
-		service:     s,
-		keep:        true,
-		connections: make(map[destination]*websocket.Conn),
-		suite:       suite,
-	}
-}
-
-// Suite returns the cryptographic suite in use on this connection.
-func (c *Client) Suite() network.Suite {
-	return c.suite
-}
-
-// Send will marshal the message into a ClientRequest message and send it.
-func (c *Client) Send(dst *network.ServerIdentity, path string, buf []byte) ([]byte, error) {
-	c.Lock()
-	defer c.Unlock()
-	dest := destination{dst, path}
-	conn, ok := c.connections[dest]
-	if !ok {
-		// Open connection to service.
-		url, err := getWebAddress(dst, false)
-		if err != nil {
-			return nil, err
-		}
-		log.Lvlf4("Sending %x to %s/%s/%s", buf, url, c.service, path)
-		d := &websocket.Dialer{}
-		// Re-try to connect in case the websocket is just about to start
-		for a := 0; a < network.MaxRetryConnect; a++ {
-			conn, _, err = d.Dial(fmt.Sprintf("ws://%s/%s/%s", url, c.service, path),
-				http.Header{"Origin": []string{"http://" + url}})
-			if err == nil {
-				break
+// process passes the request to the service, if the concurrency limit of
+// the service allows it.
+func (t wsHandler) process(s Service, r *http.Request, path string, buf []byte) ([]byte, error) {
+	if t.ws != nil {
+		if l := t.ws.limiter(t.serviceName); l != nil {
+			if !l.acquire() {
+				log.Lvl2("Service", t.serviceName, "is busy, refusing", r.RemoteAddr)
+				return nil, ErrServiceBusy
 			}
-			time.Sleep(network.WaitRetry)
-		}
-		if err != nil {
-			return nil, err
+			defer l.release()
 		}
-		c.connections[dest] = conn
-	}
-	defer func() {
-		if !c.keep {
-			if err := c.closeConn(dest); err != nil {
-				log.Errorf("error while closing the connection to %v : %v\n", dest, err)
-			}
-		}
-	}()
-	if err := conn.WriteMessage(websocket.BinaryMessage, buf); err != nil {
-		return nil, err
-	}
-	c.tx += uint64(len(buf))
-	_, rcv, err := conn.ReadMessage()
-	if err != nil {
-		return nil, err
-	}
-	log.Lvlf4("Received %x", rcv)
-	c.rx += uint64(len(rcv))
-	return rcv, nil
-}
-
-// SendProtobuf wraps protobuf.(En|De)code over the Client.Send-function. It
-// takes the destination, a pointer to a msg-structure that will be
-// protobuf-encoded and sent over the websocket. If ret is non-nil, it
-// has to be a pointer to the struct that is sent back to the
-// client. If there is no error, the ret-structure is filled with the
-// data from the service.
-func (c *Client) SendProtobuf(dst *network.ServerIdentity, msg interface{}, ret interface{}) error {
-	buf, err := protobuf.Encode(msg)
-	if err != nil {
-		return err
-	}
-	path := strings.Split(reflect.TypeOf(msg).String(), ".")[1]
-	reply, err := c.Send(dst, path, buf)
-	if err != nil {
-		return err
 	}
-	if ret != nil {
-		return protobuf.DecodeWithConstructors(reply, ret,
-			network.DefaultConstructors(c.suite))
+	reply, err := t.ws.handler(s)(r, t.serviceName, path, buf)
+	if err != nil && t.context != nil {
+		t.context.RecordEvent(EventServiceError, path, ": ", err)
 	}
-	return nil
-}
-
-// SendToAll sends a message to all ServerIdentities of the Roster and returns
-// all errors encountered concatenated together as a string.
-func (c *Client) SendToAll(dst *Roster, path string, buf []byte) ([][]byte, error) {
-	msgs := make([][]byte, len(dst.List))
-	var errstrs []string
-	for i, e := range dst.List {
-		var err error
-		msgs[i], err = c.Send(e, path, buf)
+	if t.ws != nil {
 		if err != nil {
-			errstrs = append(errstrs, fmt.Sprint(e.String(), err.Error()))
+			t.ws.audit.record(AuditClientRequest, r.RemoteAddr, t.serviceName, "/", path, " failed: ", err)
+		} else {
+			t.ws.audit.record(AuditClientRequest, r.RemoteAddr, t.serviceName, "/", path)
 		}
 	}
-	var err error
-	if len(errstrs) > 0 {
-		err = errors.New(strings.Join(errstrs, "\n"))
-	}
-	return msgs, err
-}
-
-// Close sends a close-command to all open connections and returns nil if no
-// errors occurred or all errors encountered concatenated together as a string.
-func (c *Client) Close() error {
-	c.Lock()
-	defer c.Unlock()
-	var errstrs []string
-	for dest := range c.connections {
-		if err := c.closeConn(dest); err != nil {
-			errstrs = append(errstrs, err.Error())
-		}
-	}
-	var err error
-	if len(errstrs) > 0 {
-		err = errors.New(strings.Join(errstrs, "\n"))
-	}
-	return err
-}
-
-// closeConn sends a close-command to the connection.
-func (c *Client) closeConn(dst destination) error {
-	conn, ok := c.connections[dst]
-	if ok {
-		delete(c.connections, dst)
-		conn.WriteMessage(websocket.CloseMessage, nil)
-		return conn.Close()
-	}
-	return nil
-}
-
-// Tx returns the number of bytes transmitted by this Client. It implements
-// the monitor.CounterIOMeasure interface.
-func (c *Client) Tx() uint64 {
-	c.Lock()
-	defer c.Unlock()
-	return c.tx
-}
-
-// Rx returns the number of bytes read by this Client. It implements
-// the monitor.CounterIOMeasure interface.
-func (c *Client) Rx() uint64 {
-	c.Lock()
-	defer c.Unlock()
-	return c.rx
-}
-
-// getWebAddress returns the host:port+1 of the serverIdentity. If
-// global is true, the address is set to the unspecified 0.0.0.0-address.
-func getWebAddress(si *network.ServerIdentity, global bool) (string, error) {
-	p, err := strconv.Atoi(si.Address.Port())
-	if err != nil {
-		return "", err
-	}
-	host := si.Address.Host()
-	if global {
-		host = "0.0.0.0"
-	}
-	return net.JoinHostPort(host, strconv.Itoa(p+1)), nil
+	return reply, err
 }
@@ -7,6 +7,7 @@ import (
 	"fmt"
 
 	"sync"
+	"time"
 
 	"github.com/dedis/onet/log"
 	"github.com/dedis/onet/network"
@@ -56,7 +57,7 @@ func TestGetWebHost(t *testing.T) {
 	require.NotNil(t, err)
 	url, err = getWebAddress(&network.ServerIdentity{Address: "tcp://8.8.8.8:7770"}, true)
 	log.ErrFatal(err)
-	require.Equal(t, "0.0.0.0:7771", url)
+	require.Equal(t, ":7771", url)
 	url, err = getWebAddress(&network.ServerIdentity{Address: "tcp://8.8.8.8:7770"}, false)
 	log.ErrFatal(err)
 	require.Equal(t, "8.8.8.8:7771", url)
@@ -172,6 +173,75 @@ func TestWebSocket_Error(t *testing.T) {
 	assert.NotEqual(t, "", log.GetStdOut())
 }
 
+func TestWsLimiter(t *testing.T) {
+	l := newWsLimiter(1, 1)
+	require.True(t, l.acquire())
+	done := make(chan bool)
+	go func() {
+		done <- l.acquire()
+	}()
+	// Wait for the second request to be queued
+	for {
+		l.Lock()
+		w := l.waiting
+		l.Unlock()
+		if w == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	require.False(t, l.acquire())
+	l.release()
+	require.True(t, <-done)
+	l.release()
+}
+
+func TestWebSocket_Busy(t *testing.T) {
+	block := make(chan bool)
+	_, err := RegisterNewService(slowServiceName, func(c *Context) (Service, error) {
+		c.SetMaxConcurrentRequests(1, 0)
+		return &slowService{block}, nil
+	})
+	log.ErrFatal(err)
+	defer UnregisterService(slowServiceName)
+
+	local := NewTCPTest(tSuite)
+	server := local.GenServers(1)[0]
+	defer local.CloseAll()
+
+	done := make(chan error)
+	go func() {
+		_, err := NewClient(tSuite, slowServiceName).Send(server.ServerIdentity, "slow", nil)
+		done <- err
+	}()
+	// Wait for the first request to occupy the only slot
+	block <- true
+	_, err = NewClient(tSuite, slowServiceName).Send(server.ServerIdentity, "slow", nil)
+	require.Equal(t, ErrServiceBusy, err)
+	block <- true
+	require.Nil(t, <-done)
+}
+
+const slowServiceName = "slowService"
+
+// slowService only returns once it has been told twice on block.
+type slowService struct {
+	block chan bool
+}
+
+func (ss *slowService) ProcessClientRequest(req *http.Request, path string, buf []byte) ([]byte, error) {
+	<-ss.block
+	<-ss.block
+	return []byte(path), nil
+}
+
+func (ss *slowService) NewProtocol(tn *TreeNodeInstance, conf *GenericConfig) (ProtocolInstance, error) {
+	return nil, nil
+}
+
+func (ss *slowService) Process(env *network.Envelope) {
+}
+
 const serviceWebSocket = "WebSocket"
 
 type ServiceWebSocket struct {
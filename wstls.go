@@ -0,0 +1,209 @@
+// +build !js
+
+package onet
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/net/http2"
+)
+
+// WebSocketTLS configures the websocket of a server to serve wss:// and
+// https:// itself, without a reverse proxy in front of it.
+type WebSocketTLS struct {
+	// CertFile and KeyFile are the PEM files of the certificate chain and
+	// its private key. They are read again once they changed, so a renewed
+	// certificate is used without restarting the server.
+	CertFile string
+	KeyFile  string
+	// ACMEDomains are the domains to get a certificate for from Let's
+	// Encrypt, if no CertFile is given. The domains are validated with the
+	// tls-alpn-01 challenge, so the websocket must be reachable on port 443
+	// of the domains.
+	ACMEDomains []string
+	// ACMECache is the directory where the certificates from Let's Encrypt
+	// are kept between restarts. If empty, they are only kept in memory.
+	ACMECache string
+	// ACMEEmail is the contact address given to Let's Encrypt, for example
+	// for expiry notices.
+	ACMEEmail string
+	// DisableHTTP2 only serves HTTP/1.1. The websockets always use
+	// HTTP/1.1, but the other paths like /metrics can use HTTP/2.
+	DisableHTTP2 bool
+}
+
+// certReloader returns the certificate in the files, which are read again
+// whenever one of them is modified.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	cert     *tls.Certificate
+	modTime  time.Time
+	sync.Mutex
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	cr := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := cr.reload(); err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+// modified returns the latest modification time of the files.
+func (cr *certReloader) modified() (time.Time, error) {
+	var latest time.Time
+	for _, f := range []string{cr.certFile, cr.keyFile} {
+		fi, err := os.Stat(f)
+		if err != nil {
+			return latest, err
+		}
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// reload reads the files if they changed since the last time. The caller
+// must not hold the lock.
+func (cr *certReloader) reload() error {
+	mod, err := cr.modified()
+	if err != nil {
+		return err
+	}
+	cr.Lock()
+	defer cr.Unlock()
+	if cr.cert != nil && mod.Equal(cr.modTime) {
+		return nil
+	}
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return err
+	}
+	if cr.cert != nil {
+		log.Lvl2("Reloaded websocket certificate from", cr.certFile)
+	}
+	cr.cert = &cert
+	cr.modTime = mod
+	return nil
+}
+
+// forceReload reads the files even if they didn't change.
+func (cr *certReloader) forceReload() error {
+	cr.Lock()
+	cr.modTime = time.Time{}
+	cr.Unlock()
+	return cr.reload()
+}
+
+// getCertificate is used as tls.Config.GetCertificate. If the new files
+// can't be read, for example while they are being written, the former
+// certificate is kept.
+func (cr *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if err := cr.reload(); err != nil {
+		log.Error("Couldn't reload websocket certificate:", err)
+	}
+	cr.Lock()
+	defer cr.Unlock()
+	return cr.cert, nil
+}
+
+// tlsConfig returns the configuration of the TLS listener, and the
+// certReloader of the certificate files if they are used. HTTP/2 comes
+// first in NextProtos, as the server's order decides which protocol is
+// used; the websocket clients only offer HTTP/1.1.
+func (conf *WebSocketTLS) tlsConfig() (*tls.Config, *certReloader, error) {
+	tc := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{http2.NextProtoTLS, "http/1.1"},
+	}
+	if conf.DisableHTTP2 {
+		tc.NextProtos = []string{"http/1.1"}
+	}
+	var cr *certReloader
+	switch {
+	case conf.CertFile != "":
+		var err error
+		cr, err = newCertReloader(conf.CertFile, conf.KeyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		tc.GetCertificate = cr.getCertificate
+	case len(conf.ACMEDomains) > 0:
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(conf.ACMEDomains...),
+			Email:      conf.ACMEEmail,
+		}
+		if conf.ACMECache != "" {
+			m.Cache = autocert.DirCache(conf.ACMECache)
+		}
+		tc.GetCertificate = m.GetCertificate
+		tc.NextProtos = append(tc.NextProtos, acme.ALPNProto)
+	default:
+		return nil, nil, errors.New("need a certificate file or ACME domains")
+	}
+	return tc, cr, nil
+}
+
+// SetWebSocketTLS makes the websocket of the server use TLS. It must be
+// called before the server is started.
+func (c *Server) SetWebSocketTLS(conf *WebSocketTLS) error {
+	return c.websocket.setTLS(conf)
+}
+
+// setTLS configures the http server for TLS and HTTP/2.
+func (w *WebSocket) setTLS(conf *WebSocketTLS) error {
+	w.Lock()
+	defer w.Unlock()
+	if w.server == nil {
+		return errors.New("this server has no websocket")
+	}
+	if w.started {
+		return errors.New("websocket is already started")
+	}
+	tc, cr, err := conf.tlsConfig()
+	if err != nil {
+		return err
+	}
+	w.server.Server.TLSConfig = tc
+	w.certs = cr
+	if conf.DisableHTTP2 {
+		w.server.Server.TLSNextProto = make(map[string]func(*http.Server,
+			*tls.Conn, http.Handler))
+		return nil
+	}
+	return http2.ConfigureServer(w.server.Server, nil)
+}
+
+// listenAndServe serves the websocket on the socket passed by systemd for
+// its address, or else on a new one. The listener is wrapped in the TLS
+// configuration of the server, if there is one.
+func (w *WebSocket) listenAndServe() error {
+	ln := w.listener
+	if ln == nil {
+		ln = network.ActivatedListener(w.server.Server.Addr)
+	}
+	if ln == nil {
+		var err error
+		ln, err = net.Listen("tcp", w.server.Server.Addr)
+		if err != nil {
+			return err
+		}
+	}
+	if w.server.Server.TLSConfig != nil {
+		ln = tls.NewListener(ln, w.server.Server.TLSConfig)
+	}
+	return w.server.Serve(ln)
+}
@@ -0,0 +1,144 @@
+package onet
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/dedis/onet/network"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/acme"
+)
+
+// writeTestCert writes a new self-signed certificate for 127.0.0.1 to
+// cert.pem and key.pem in dir.
+func writeTestCert(t *testing.T, dir string, serial int64) (string, string, *x509.Certificate) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &priv.PublicKey, priv)
+	require.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.Nil(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(priv)
+	require.Nil(t, err)
+
+	certFile, keyFile := path.Join(dir, "cert.pem"), path.Join(dir, "key.pem")
+	require.Nil(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{
+		Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.Nil(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{
+		Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	// Make sure the modification is seen even on coarse file systems.
+	mod := time.Now().Add(time.Duration(serial) * time.Second)
+	require.Nil(t, os.Chtimes(certFile, mod, mod))
+	require.Nil(t, os.Chtimes(keyFile, mod, mod))
+	return certFile, keyFile, cert
+}
+
+func TestCertReloader(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "wstls")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmp)
+
+	_, err = newCertReloader(path.Join(tmp, "cert.pem"), path.Join(tmp, "key.pem"))
+	require.NotNil(t, err)
+
+	certFile, keyFile, cert1 := writeTestCert(t, tmp, 1)
+	cr, err := newCertReloader(certFile, keyFile)
+	require.Nil(t, err)
+	got, err := cr.getCertificate(nil)
+	require.Nil(t, err)
+	require.Equal(t, cert1.Raw, got.Certificate[0])
+
+	// A renewed certificate is picked up.
+	_, _, cert2 := writeTestCert(t, tmp, 2)
+	got, err = cr.getCertificate(nil)
+	require.Nil(t, err)
+	require.Equal(t, cert2.Raw, got.Certificate[0])
+
+	// A broken file keeps the former certificate.
+	require.Nil(t, ioutil.WriteFile(certFile, []byte("garbage"), 0600))
+	got, err = cr.getCertificate(nil)
+	require.Nil(t, err)
+	require.Equal(t, cert2.Raw, got.Certificate[0])
+	require.NotNil(t, cr.forceReload())
+	got, err = cr.getCertificate(nil)
+	require.Nil(t, err)
+	require.Equal(t, cert2.Raw, got.Certificate[0])
+}
+
+func TestWebSocketTLS_tlsConfig(t *testing.T) {
+	_, _, err := (&WebSocketTLS{}).tlsConfig()
+	require.NotNil(t, err)
+
+	conf, cr, err := (&WebSocketTLS{ACMEDomains: []string{"example.com"}}).tlsConfig()
+	require.Nil(t, err)
+	require.Nil(t, cr)
+	require.NotNil(t, conf.GetCertificate)
+	require.Contains(t, conf.NextProtos, acme.ALPNProto)
+	require.Equal(t, "h2", conf.NextProtos[0])
+
+	conf, _, err = (&WebSocketTLS{ACMEDomains: []string{"example.com"},
+		DisableHTTP2: true}).tlsConfig()
+	require.Nil(t, err)
+	require.NotContains(t, conf.NextProtos, "h2")
+}
+
+func TestWebSocket_TLS(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "wstls")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmp)
+	certFile, keyFile, cert := writeTestCert(t, tmp, 1)
+
+	si := &network.ServerIdentity{Address: network.NewAddress(network.PlainTCP, "127.0.0.1:2160")}
+	w := NewWebSocket(si)
+	require.Nil(t, w.setTLS(&WebSocketTLS{CertFile: certFile, KeyFile: keyFile}))
+	go w.start()
+	defer w.stop()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	var conn *tls.Conn
+	for i := 0; i < 10; i++ {
+		conn, err = tls.Dial("tcp", "127.0.0.1:2161", &tls.Config{
+			RootCAs:    pool,
+			NextProtos: []string{"h2", "http/1.1"},
+		})
+		if err == nil {
+			break
+		}
+		time.Sleep(network.WaitRetry)
+	}
+	require.Nil(t, err)
+	require.Equal(t, "h2", conn.ConnectionState().NegotiatedProtocol)
+	require.Nil(t, conn.Close())
+
+	// The other paths are served over HTTP/2.
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: pool},
+		ForceAttemptHTTP2: true,
+	}}
+	resp, err := client.Get("https://127.0.0.1:2161/ok")
+	require.Nil(t, err)
+	require.Nil(t, resp.Body.Close())
+	require.Equal(t, "HTTP/2.0", resp.Proto)
+	require.NotNil(t, w.setTLS(&WebSocketTLS{CertFile: certFile, KeyFile: keyFile}))
+}